@@ -0,0 +1,154 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/acm"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// ACM certificates: https://docs.aws.amazon.com/sdk-for-go/api/service/acm
+
+type ACMCertificates struct{}
+
+// ParseDomainPatterns compiles the patterns of the domains whose certificates
+// are swept. The patterns must match the whole domain.
+func ParseDomainPatterns(patterns []string) ([]*regexp.Regexp, error) {
+	var compiled []*regexp.Regexp
+	for _, pattern := range patterns {
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid domain pattern %q: %w", pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// ManagesCertificateDomain tells whether the certificates for domain are swept.
+func (opts Options) ManagesCertificateDomain(domain string) bool {
+	for _, re := range opts.CertificateDomains {
+		if re.MatchString(domain) {
+			return true
+		}
+	}
+	return false
+}
+
+func (ACMCertificates) MarkAndSweep(opts Options, set *Set) error {
+	if len(opts.CertificateDomains) == 0 {
+		return nil
+	}
+	logger := logrus.WithField("options", opts)
+	svc := acm.New(opts.Session, aws.NewConfig().WithRegion(opts.Region))
+
+	var toDelete []*acmCertificate // Paged call, defer deletion until we have the whole list.
+
+	pageFunc := func(page *acm.ListCertificatesOutput, _ bool) bool {
+		for _, c := range page.CertificateSummaryList {
+			if !opts.ManagesCertificateDomain(aws.StringValue(c.DomainName)) {
+				continue
+			}
+			cert := &acmCertificate{arn: aws.StringValue(c.CertificateArn), domain: aws.StringValue(c.DomainName)}
+			desc, err := svc.DescribeCertificate(&acm.DescribeCertificateInput{CertificateArn: c.CertificateArn})
+			if err != nil {
+				logger.Warningf("%s: failed describing certificate: %v", cert.ARN(), err)
+				continue
+			}
+			// Certificates in use, e.g. by load balancers or distributions,
+			// cannot be deleted. They are swept once their users are.
+			if desc.Certificate == nil || len(desc.Certificate.InUseBy) > 0 {
+				continue
+			}
+			tagResp, err := svc.ListTagsForCertificate(&acm.ListTagsForCertificateInput{CertificateArn: c.CertificateArn})
+			if err != nil {
+				logger.Warningf("%s: failed listing tags: %v", cert.ARN(), err)
+				continue
+			}
+			tags := Tags{}
+			for _, t := range tagResp.Tags {
+				tags.Add(t.Key, t.Value)
+			}
+			if !set.Mark(opts, cert, certificateCreationTime(desc.Certificate), tags) {
+				continue
+			}
+			logger.Warningf("%s: deleting %T: %s", cert.ARN(), c, cert.domain)
+			if !opts.DryRun {
+				toDelete = append(toDelete, cert)
+			}
+		}
+		return true
+	}
+
+	if err := svc.ListCertificatesPages(&acm.ListCertificatesInput{}, pageFunc); err != nil {
+		return err
+	}
+
+	for _, c := range toDelete {
+		if _, err := svc.DeleteCertificate(&acm.DeleteCertificateInput{CertificateArn: aws.String(c.arn)}); err != nil {
+			if aerr, ok := err.(awserr.Error); ok && aerr.Code() == acm.ErrCodeResourceNotFoundException {
+				continue
+			}
+			logger.Warningf("%s: delete failed: %v", c.ARN(), err)
+		}
+	}
+	return nil
+}
+
+func (ACMCertificates) ListAll(opts Options) (*Set, error) {
+	svc := acm.New(opts.Session, aws.NewConfig().WithRegion(opts.Region))
+	set := NewSet(0)
+
+	err := svc.ListCertificatesPages(&acm.ListCertificatesInput{}, func(page *acm.ListCertificatesOutput, _ bool) bool {
+		now := time.Now()
+		for _, c := range page.CertificateSummaryList {
+			set.firstSeen[aws.StringValue(c.CertificateArn)] = now
+		}
+		return true
+	})
+
+	return set, errors.Wrapf(err, "couldn't list ACM certificates for %q in %q", opts.Account, opts.Region)
+}
+
+// certificateCreationTime returns when the certificate was requested, or
+// imported for imported certificates.
+func certificateCreationTime(c *acm.CertificateDetail) *time.Time {
+	if c.CreatedAt != nil {
+		return c.CreatedAt
+	}
+	return c.ImportedAt
+}
+
+type acmCertificate struct {
+	arn    string
+	domain string
+}
+
+func (c acmCertificate) ARN() string {
+	return c.arn
+}
+
+func (c acmCertificate) ResourceKey() string {
+	return c.ARN()
+}
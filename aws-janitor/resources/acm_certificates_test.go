@@ -0,0 +1,51 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"testing"
+)
+
+func TestManagesCertificateDomain(t *testing.T) {
+	patterns, err := ParseDomainPatterns([]string{`e2e-[0-9a-f]+\.test-cncf-aws\.k8s\.io`, `\*\.ci\.example\.com`})
+	if err != nil {
+		t.Fatalf("unexpected error parsing patterns: %v", err)
+	}
+	opts := Options{CertificateDomains: patterns}
+	for _, tc := range []struct {
+		domain      string
+		shouldMatch bool
+	}{
+		{domain: "e2e-71149fffac.test-cncf-aws.k8s.io", shouldMatch: true},
+		{domain: "*.ci.example.com", shouldMatch: true},
+		// Patterns match the whole domain.
+		{domain: "api.e2e-71149fffac.test-cncf-aws.k8s.io"},
+		{domain: "e2e-71149fffac.test-cncf-aws.k8s.io.evil.com"},
+		{domain: "www.example.com"},
+	} {
+		if got := opts.ManagesCertificateDomain(tc.domain); got != tc.shouldMatch {
+			t.Errorf("domain %q: expected match %t, got %t", tc.domain, tc.shouldMatch, got)
+		}
+	}
+
+	if (Options{}).ManagesCertificateDomain("www.example.com") {
+		t.Error("expected no domain to be managed without patterns")
+	}
+	if _, err := ParseDomainPatterns([]string{"("}); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// ParsedARN holds the parts of an ARN.
+type ParsedARN struct {
+	Partition string `json:"partition"`
+	Service   string `json:"service"`
+	Region    string `json:"region,omitempty"`
+	Account   string `json:"account,omitempty"`
+	// ResourceType is the type of the resource within the service, e.g. vpc.
+	ResourceType string `json:"resourceType,omitempty"`
+	// ID is the identifier users refer to the resource by, e.g. vpc-1.
+	ID string `json:"id"`
+}
+
+// ARNParser parses the resource part of the ARNs of a service, which follows
+// the generic arn:partition:service:region:account: prefix, into the resource
+// type and the ID of the resource.
+type ARNParser func(resource string) (resourceType, id string, err error)
+
+var (
+	arnParsersLock sync.RWMutex
+	// arnParsers are the parsers of the ARNs of the services whose ARNs do not
+	// end with the ID of the resource.
+	arnParsers = map[string]ARNParser{
+		"route53": parseRoute53Resource,
+	}
+)
+
+// RegisterARNParser registers the parser of the ARNs of service, replacing
+// the default one which takes the last segment of the ARN as the ID.
+func RegisterARNParser(service string, parser ARNParser) {
+	arnParsersLock.Lock()
+	defer arnParsersLock.Unlock()
+	arnParsers[service] = parser
+}
+
+// ParseARN parses arn with the parser registered for its service.
+func ParseARN(arn string) (ParsedARN, error) {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) != 6 || parts[0] != "arn" {
+		return ParsedARN{}, fmt.Errorf("invalid ARN %q", arn)
+	}
+	parsed := ParsedARN{Partition: parts[1], Service: parts[2], Region: parts[3], Account: parts[4]}
+
+	arnParsersLock.RLock()
+	parser, ok := arnParsers[parsed.Service]
+	arnParsersLock.RUnlock()
+	if !ok {
+		parser = parseResource
+	}
+	var err error
+	if parsed.ResourceType, parsed.ID, err = parser(parts[5]); err != nil {
+		return ParsedARN{}, fmt.Errorf("invalid ARN %q: %v", arn, err)
+	}
+	return parsed, nil
+}
+
+// parseResource parses resources of the forms id, type/id and type:id. Only
+// the last segment of a path like type/path/id is the ID.
+func parseResource(resource string) (string, string, error) {
+	if resource == "" {
+		return "", "", fmt.Errorf("missing resource")
+	}
+	idx := strings.IndexAny(resource, "/:")
+	if idx < 0 {
+		return "", resource, nil
+	}
+	return resource[:idx], resource[strings.LastIndexAny(resource, "/:")+1:], nil
+}
+
+// parseRoute53Resource parses the resources of the record sets, of the form
+// type/zone/name, with the zone and name as ID since names are not unique
+// across zones. The zone may keep the /hostedzone/ prefix of the API.
+func parseRoute53Resource(resource string) (string, string, error) {
+	parts := strings.SplitN(resource, "/", 2)
+	if len(parts) != 2 {
+		return parseResource(resource)
+	}
+	return parts[0], strings.TrimPrefix(parts[1], "/hostedzone/"), nil
+}
+
+// arnOfKey returns the ARN in a resource key, which is either the ARN itself
+// or an ID followed by :: and the ARN.
+func arnOfKey(key string) string {
+	if idx := strings.Index(key, "::arn:"); idx >= 0 {
+		return key[idx+2:]
+	}
+	return key
+}
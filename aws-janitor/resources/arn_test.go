@@ -0,0 +1,85 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+func TestParseARN(t *testing.T) {
+	testCases := []struct {
+		name      string
+		arn       string
+		expected  ParsedARN
+		expectErr bool
+	}{
+		{
+			name:     "type and ID",
+			arn:      "arn:aws:ec2:us-east-1:123:vpc/vpc-1",
+			expected: ParsedARN{Partition: "aws", Service: "ec2", Region: "us-east-1", Account: "123", ResourceType: "vpc", ID: "vpc-1"},
+		},
+		{
+			name:     "global resource with a path",
+			arn:      "arn:aws:iam::123:role/path/to/role-1",
+			expected: ParsedARN{Partition: "aws", Service: "iam", Account: "123", ResourceType: "role", ID: "role-1"},
+		},
+		{
+			name:     "ID only",
+			arn:      "arn:aws:sqs:us-west-1:123:queue-1",
+			expected: ParsedARN{Partition: "aws", Service: "sqs", Region: "us-west-1", Account: "123", ID: "queue-1"},
+		},
+		{
+			name:     "route53 record set",
+			arn:      "arn:aws:route53::123:A//hostedzone/Z1/www.example.com.",
+			expected: ParsedARN{Partition: "aws", Service: "route53", Account: "123", ResourceType: "A", ID: "Z1/www.example.com."},
+		},
+		{
+			name:      "not an ARN",
+			arn:       "vpc-1",
+			expectErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			parsed, err := ParseARN(tc.arn)
+			if tc.expectErr != (err != nil) {
+				t.Fatalf("expected error %t, got %v", tc.expectErr, err)
+			}
+			if parsed != tc.expected {
+				t.Errorf("expected %+v, got %+v", tc.expected, parsed)
+			}
+		})
+	}
+}
+
+func TestRegisterARNParser(t *testing.T) {
+	RegisterARNParser("test", func(resource string) (string, string, error) {
+		return "thing", "id-" + resource, nil
+	})
+	defer func() {
+		arnParsersLock.Lock()
+		delete(arnParsers, "test")
+		arnParsersLock.Unlock()
+	}()
+	item := InventoryItem{ARNString: "arn:aws:test:us-east-1:123:1", Key: "arn:aws:test:us-east-1:123:1"}
+	opts := Options{OnlyResources: sets.NewString("id-1")}
+	if !opts.Targets(item) {
+		t.Error("expected the resource to be targeted by the ID of its parser")
+	}
+}
@@ -28,7 +28,8 @@ import (
 )
 
 // CleanAll cleans all of the resources for all of the regions visible to
-// the provided AWS session.
+// the provided AWS session. Like MarkAndSweep, it never sweeps the S3 buckets
+// of opts.KeepBuckets.
 func CleanAll(opts Options, region string) error {
 	regionList, err := regions.ParseRegion(opts.Session, region)
 	if err != nil {
@@ -38,10 +39,16 @@ func CleanAll(opts Options, region string) error {
 
 	var errs []error
 
+	if !opts.SweepsRegional() {
+		regionList = nil
+	}
 	for _, r := range regionList {
 		opts.Region = r
 		logger := logrus.WithField("options", opts)
 		for _, typ := range RegionalTypeList {
+			if !opts.SweepsType(typ) {
+				continue
+			}
 			logger.Debugf("Cleaning resource type %T", typ)
 			set, err := typ.ListAll(opts)
 			if err != nil {
@@ -63,6 +70,9 @@ func CleanAll(opts Options, region string) error {
 
 	opts.Region = regions.Default
 	for _, typ := range GlobalTypeList {
+		if !opts.SweepsGlobal() || !opts.SweepsType(typ) {
+			continue
+		}
 		set, err := typ.ListAll(opts)
 		if err != nil {
 			errs = append(errs, errors.Wrapf(err, "Failed to list resources of type %T", typ))
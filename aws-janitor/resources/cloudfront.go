@@ -0,0 +1,146 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudfront"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// CloudFront distributions: https://docs.aws.amazon.com/sdk-for-go/api/service/cloudfront
+
+type CloudFrontDistributions struct{}
+
+func (CloudFrontDistributions) MarkAndSweep(opts Options, set *Set) error {
+	logger := logrus.WithField("options", opts)
+	svc := cloudfront.New(opts.Session, aws.NewConfig().WithRegion(opts.Region))
+
+	var toDelete []*cloudfrontDistribution // Paged call, defer deletion until we have the whole list.
+
+	pageFunc := func(page *cloudfront.ListDistributionsOutput, _ bool) bool {
+		if page.DistributionList == nil {
+			return true
+		}
+		for _, d := range page.DistributionList.Items {
+			dist := &cloudfrontDistribution{
+				arn:      aws.StringValue(d.ARN),
+				id:       aws.StringValue(d.Id),
+				deployed: aws.StringValue(d.Status) == "Deployed",
+			}
+			tagResp, err := svc.ListTagsForResource(&cloudfront.ListTagsForResourceInput{Resource: d.ARN})
+			if err != nil {
+				logger.Warningf("%s: failed listing tags: %v", dist.ARN(), err)
+				continue
+			}
+			tags := Tags{}
+			if tagResp.Tags != nil {
+				for _, t := range tagResp.Tags.Items {
+					tags.Add(t.Key, t.Value)
+				}
+			}
+			// Distributions do not tell when they were created.
+			if !set.Mark(opts, dist, nil, tags) {
+				continue
+			}
+			logger.Warningf("%s: deleting %T: %s", dist.ARN(), d, dist.id)
+			if !opts.DryRun {
+				toDelete = append(toDelete, dist)
+			}
+		}
+		return true
+	}
+
+	if err := svc.ListDistributionsPages(&cloudfront.ListDistributionsInput{}, pageFunc); err != nil {
+		return err
+	}
+
+	for _, d := range toDelete {
+		if err := d.delete(svc, logger); err != nil {
+			logger.Warningf("%s: delete failed: %v", d.ARN(), err)
+		}
+	}
+	return nil
+}
+
+func (CloudFrontDistributions) ListAll(opts Options) (*Set, error) {
+	svc := cloudfront.New(opts.Session, aws.NewConfig().WithRegion(opts.Region))
+	set := NewSet(0)
+
+	err := svc.ListDistributionsPages(&cloudfront.ListDistributionsInput{}, func(page *cloudfront.ListDistributionsOutput, _ bool) bool {
+		if page.DistributionList == nil {
+			return true
+		}
+		now := time.Now()
+		for _, d := range page.DistributionList.Items {
+			set.firstSeen[aws.StringValue(d.ARN)] = now
+		}
+		return true
+	})
+
+	return set, errors.Wrapf(err, "couldn't list cloudfront distributions for %q in %q", opts.Account, opts.Region)
+}
+
+type cloudfrontDistribution struct {
+	arn      string
+	id       string
+	deployed bool
+}
+
+func (d cloudfrontDistribution) ARN() string {
+	return d.arn
+}
+
+func (d cloudfrontDistribution) ResourceKey() string {
+	return d.ARN()
+}
+
+// delete disables the distribution, which must be disabled and deployed to be
+// deleted. As it takes a while, the distribution is deleted by a later sweep.
+func (d cloudfrontDistribution) delete(svc *cloudfront.CloudFront, logger logrus.FieldLogger) error {
+	config, err := svc.GetDistributionConfig(&cloudfront.GetDistributionConfigInput{Id: aws.String(d.id)})
+	if err != nil {
+		return errors.Wrapf(err, "error getting the config of cloudfront distribution %q", d.id)
+	}
+	if config.DistributionConfig == nil {
+		return fmt.Errorf("GetDistributionConfig returned nil DistributionConfig")
+	}
+	if aws.BoolValue(config.DistributionConfig.Enabled) {
+		config.DistributionConfig.Enabled = aws.Bool(false)
+		if _, err := svc.UpdateDistribution(&cloudfront.UpdateDistributionInput{
+			Id:                 aws.String(d.id),
+			IfMatch:            config.ETag,
+			DistributionConfig: config.DistributionConfig,
+		}); err != nil {
+			return errors.Wrapf(err, "error disabling cloudfront distribution %q", d.id)
+		}
+		logger.Infof("%s: disabled, will be deleted once deployed", d.ARN())
+		return nil
+	}
+	if !d.deployed {
+		logger.Infof("%s: disabled but not deployed yet, will be deleted later", d.ARN())
+		return nil
+	}
+	if _, err := svc.DeleteDistribution(&cloudfront.DeleteDistributionInput{Id: aws.String(d.id), IfMatch: config.ETag}); err != nil {
+		return errors.Wrapf(err, "error deleting cloudfront distribution %q", d.id)
+	}
+	return nil
+}
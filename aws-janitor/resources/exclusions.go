@@ -0,0 +1,181 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/yaml"
+)
+
+// exclusionsReloadPeriod is how often the exclusions file is checked for changes.
+const exclusionsReloadPeriod = 10 * time.Second
+
+// Exclusion protects resources from the janitor until it expires.
+type Exclusion struct {
+	// Resource is the ARN, resource key or ID of the excluded resource.
+	Resource string `json:"resource,omitempty"`
+	// Pattern is a regular expression matched against the ARN, resource key
+	// and ID of resources.
+	Pattern string `json:"pattern,omitempty"`
+	// Expires is when the exclusion stops applying. It applies forever if unset.
+	Expires *time.Time `json:"expires,omitempty"`
+	// Reason explains why the resources are excluded.
+	Reason string `json:"reason,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// matches tells whether the exclusion applies to a resource with these
+// identifiers at now.
+func (e *Exclusion) matches(ids []string, now time.Time) bool {
+	if e.Expires != nil && now.After(*e.Expires) {
+		return false
+	}
+	for _, id := range ids {
+		if id == e.Resource || (e.pattern != nil && e.pattern.MatchString(id)) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseExclusions parses a YAML list of exclusions.
+func ParseExclusions(b []byte) ([]Exclusion, error) {
+	var exclusions []Exclusion
+	if err := yaml.Unmarshal(b, &exclusions); err != nil {
+		return nil, err
+	}
+	for idx := range exclusions {
+		e := &exclusions[idx]
+		if (e.Resource == "") == (e.Pattern == "") {
+			return nil, fmt.Errorf("exclusion %d: exactly one of resource and pattern must be set", idx)
+		}
+		if e.Pattern != "" {
+			pattern, err := regexp.Compile(e.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("exclusion %d: invalid pattern: %v", idx, err)
+			}
+			e.pattern = pattern
+		}
+	}
+	return exclusions, nil
+}
+
+// Exclusions holds the exclusions read from a file, which is reloaded when it
+// changes so that resources can be protected without restarting the janitor.
+type Exclusions struct {
+	path string
+
+	lock       sync.Mutex
+	exclusions []Exclusion
+	modTime    time.Time
+	checked    time.Time
+}
+
+// LoadExclusions reads the exclusions from path.
+func LoadExclusions(path string) (*Exclusions, error) {
+	e := &Exclusions{path: path}
+	if err := e.reload(time.Now()); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// reload reads the exclusions file again if it changed since it was last read.
+func (e *Exclusions) reload(now time.Time) error {
+	e.checked = now
+	info, err := os.Stat(e.path)
+	if err != nil {
+		return err
+	}
+	if info.ModTime().Equal(e.modTime) {
+		return nil
+	}
+	b, err := ioutil.ReadFile(e.path)
+	if err != nil {
+		return err
+	}
+	exclusions, err := ParseExclusions(b)
+	if err != nil {
+		return fmt.Errorf("invalid exclusions file %s: %v", e.path, err)
+	}
+	for _, exclusion := range exclusions {
+		if exclusion.Expires != nil && now.After(*exclusion.Expires) {
+			logrus.Warningf("exclusion of %s%s expired on %v and is ignored", exclusion.Resource, exclusion.Pattern, exclusion.Expires)
+		}
+	}
+	e.exclusions = exclusions
+	e.modTime = info.ModTime()
+	logrus.Infof("loaded %d exclusions from %s", len(exclusions), e.path)
+	return nil
+}
+
+// Excludes tells whether r is protected by an exclusion which did not expire.
+// A nil Exclusions excludes nothing.
+func (e *Exclusions) Excludes(r Interface) bool {
+	if e == nil {
+		return false
+	}
+	now := time.Now()
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if now.Sub(e.checked) > exclusionsReloadPeriod {
+		// Keep the exclusions last read if the file became invalid, so that a
+		// typo does not expose protected resources.
+		if err := e.reload(now); err != nil {
+			logrus.WithError(err).Error("failed to reload exclusions, keeping the previous ones")
+		}
+	}
+	ids := identifiers(r)
+	for idx := range e.exclusions {
+		if e.exclusions[idx].matches(ids, now) {
+			return true
+		}
+	}
+	return false
+}
+
+// Patterns returns regular expressions matching the resources protected by
+// the exclusions which did not expire, for sweepers which can't be handed an
+// Exclusions, like the GCP janitor. A nil Exclusions returns none.
+func (e *Exclusions) Patterns() []string {
+	if e == nil {
+		return nil
+	}
+	now := time.Now()
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	var patterns []string
+	for _, exclusion := range e.exclusions {
+		if exclusion.Expires != nil && now.After(*exclusion.Expires) {
+			continue
+		}
+		if exclusion.Resource != "" {
+			patterns = append(patterns, "^"+regexp.QuoteMeta(exclusion.Resource)+"$")
+		} else {
+			patterns = append(patterns, exclusion.Pattern)
+		}
+	}
+	return patterns
+}
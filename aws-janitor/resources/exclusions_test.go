@@ -0,0 +1,156 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestExclusions(t *testing.T) {
+	vpc := vpc{Account: "123", Region: "us-east-1", ID: "vpc-1"}
+	testCases := []struct {
+		name      string
+		content   string
+		expectErr bool
+		expected  bool
+	}{
+		{
+			name:    "no exclusions",
+			content: "[]",
+		},
+		{
+			name:     "excluded by ID",
+			content:  "- resource: vpc-1\n  reason: shared",
+			expected: true,
+		},
+		{
+			name:     "excluded by pattern",
+			content:  "- pattern: ^arn:aws:ec2:us-east-1:123:vpc/",
+			expected: true,
+		},
+		{
+			name:    "expired exclusion",
+			content: "- resource: vpc-1\n  expires: 2020-01-01T00:00:00Z",
+		},
+		{
+			name:     "unexpired exclusion",
+			content:  "- resource: vpc-1\n  expires: 2999-01-01T00:00:00Z",
+			expected: true,
+		},
+		{
+			name:    "other resource",
+			content: "- resource: vpc-2",
+		},
+		{
+			name:      "resource and pattern",
+			content:   "- resource: vpc-1\n  pattern: vpc-.*",
+			expectErr: true,
+		},
+		{
+			name:      "invalid pattern",
+			content:   "- pattern: vpc-(",
+			expectErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "exclusions.yaml")
+			if err := ioutil.WriteFile(path, []byte(tc.content), 0644); err != nil {
+				t.Fatalf("failed to write exclusions: %v", err)
+			}
+			exclusions, err := LoadExclusions(path)
+			if (err != nil) != tc.expectErr {
+				t.Fatalf("expected error %t, got %v", tc.expectErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if excluded := exclusions.Excludes(vpc); excluded != tc.expected {
+				t.Errorf("expected excluded %t, got %t", tc.expected, excluded)
+			}
+			// Excluded resources are never deleted.
+			if swept := NewSet(0).Mark(Options{Exclusions: exclusions}, vpc, nil, Tags{}); swept == tc.expected {
+				t.Errorf("expected swept %t, got %t", !tc.expected, swept)
+			}
+		})
+	}
+}
+
+func TestExclusionsReload(t *testing.T) {
+	vpc := vpc{Account: "123", Region: "us-east-1", ID: "vpc-1"}
+	path := filepath.Join(t.TempDir(), "exclusions.yaml")
+	write := func(content string, modTime time.Time) {
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write exclusions: %v", err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatalf("failed to set modification time: %v", err)
+		}
+	}
+
+	write("[]", time.Now().Add(-time.Hour))
+	exclusions, err := LoadExclusions(path)
+	if err != nil {
+		t.Fatalf("failed to load exclusions: %v", err)
+	}
+	if exclusions.Excludes(vpc) {
+		t.Fatal("expected no exclusion")
+	}
+
+	write("- resource: vpc-1", time.Now())
+	exclusions.checked = time.Time{}
+	if !exclusions.Excludes(vpc) {
+		t.Fatal("expected the new exclusion to be loaded")
+	}
+
+	write("- pattern: vpc-(", time.Now().Add(time.Minute))
+	exclusions.checked = time.Time{}
+	if !exclusions.Excludes(vpc) {
+		t.Error("expected the previous exclusions to be kept when the file is invalid")
+	}
+
+	var none *Exclusions
+	if none.Excludes(vpc) {
+		t.Error("expected no exclusions to exclude nothing")
+	}
+}
+
+func TestExclusionsPatterns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "exclusions.yaml")
+	content := "- resource: shared.project\n- pattern: ^keep-\n- resource: old\n  expires: 2020-01-01T00:00:00Z"
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write exclusions: %v", err)
+	}
+	exclusions, err := LoadExclusions(path)
+	if err != nil {
+		t.Fatalf("failed to load exclusions: %v", err)
+	}
+	expected := []string{`^shared\.project$`, "^keep-"}
+	if patterns := exclusions.Patterns(); !reflect.DeepEqual(expected, patterns) {
+		t.Errorf("expected patterns %v, got %v", expected, patterns)
+	}
+
+	var none *Exclusions
+	if patterns := none.Patterns(); len(patterns) != 0 {
+		t.Errorf("expected no patterns, got %v", patterns)
+	}
+}
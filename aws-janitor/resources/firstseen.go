@@ -0,0 +1,65 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/sirupsen/logrus"
+)
+
+// ec2Taggable is implemented by the EC2 resources which can be tagged by ID.
+// Other resources only rely on the Set to record when they were first seen.
+type ec2Taggable interface {
+	Interface
+	ec2ID() string
+}
+
+// pendingTag is a resource to tag with the time it was first seen.
+type pendingTag struct {
+	r         ec2Taggable
+	firstSeen time.Time
+}
+
+// TagFirstSeen tags the resources queued by Mark in opts.Region with the time
+// they were first seen, in the FirstSeenTagKey tag. Failures are only logged,
+// as the Set still records the first seen time.
+func (s *Set) TagFirstSeen(opts Options) {
+	pending := s.untagged
+	s.untagged = nil
+	if len(pending) == 0 {
+		return
+	}
+
+	logger := logrus.WithField("options", opts)
+	svc := ec2.New(opts.Session, aws.NewConfig().WithRegion(opts.Region))
+	for _, p := range pending {
+		value := p.firstSeen.UTC().Format(time.RFC3339)
+		if opts.DryRun {
+			logger.Infof("%s: would tag %s=%s", p.r.ARN(), opts.FirstSeenTagKey, value)
+			continue
+		}
+		if _, err := svc.CreateTags(&ec2.CreateTagsInput{
+			Resources: []*string{aws.String(p.r.ec2ID())},
+			Tags:      []*ec2.Tag{{Key: aws.String(opts.FirstSeenTagKey), Value: aws.String(value)}},
+		}); err != nil {
+			logger.Warningf("%s: failed to tag first seen time: %v", p.r.ARN(), err)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMarkFirstSeenTag(t *testing.T) {
+	const tagKey = "janitor/first-seen"
+	old := time.Now().Add(-2 * time.Hour).UTC().Format(time.RFC3339)
+	testCases := []struct {
+		name          string
+		tagKey        string
+		r             Interface
+		tags          Tags
+		expectSwept   bool
+		expectPending bool
+	}{
+		{
+			name: "tag strategy disabled",
+			r:    vpc{ID: "vpc-1"},
+			tags: Tags{tagKey: old},
+		},
+		{
+			name:        "expired per tag",
+			tagKey:      tagKey,
+			r:           vpc{ID: "vpc-1"},
+			tags:        Tags{tagKey: old},
+			expectSwept: true,
+		},
+		{
+			name:          "untagged taggable resource",
+			tagKey:        tagKey,
+			r:             vpc{ID: "vpc-1"},
+			tags:          Tags{},
+			expectPending: true,
+		},
+		{
+			name:          "invalid tag",
+			tagKey:        tagKey,
+			r:             vpc{ID: "vpc-1"},
+			tags:          Tags{tagKey: "yesterday"},
+			expectPending: true,
+		},
+		{
+			name:   "resource not taggable",
+			tagKey: tagKey,
+			r:      fakeResource{Name: "role"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewSet(time.Hour)
+			opts := Options{FirstSeenTagKey: tc.tagKey}
+			if swept := s.Mark(opts, tc.r, nil, tc.tags); swept != tc.expectSwept {
+				t.Errorf("expected swept %t, got %t", tc.expectSwept, swept)
+			}
+			if pending := len(s.untagged) > 0; pending != tc.expectPending {
+				t.Errorf("expected pending tag %t, got %t", tc.expectPending, pending)
+			}
+		})
+	}
+}
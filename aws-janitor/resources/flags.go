@@ -0,0 +1,98 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+// Flags are the flags shared by aws-janitor and the aws provider of
+// cloud-janitor to select and mark the resources to sweep.
+type Flags struct {
+	Path            string
+	Region          string
+	TTLTagKey       string
+	FirstSeenTagKey string
+	GlobalResources string
+
+	ExcludeTags        common.CommaSeparatedStrings
+	IncludeTags        common.CommaSeparatedStrings
+	OnlyTypes          common.CommaSeparatedStrings
+	CertificateDomains common.CommaSeparatedStrings
+}
+
+// AddFlags adds the flags to fs.
+func (f *Flags) AddFlags(fs *flag.FlagSet) {
+	fs.StringVar(&f.Path, "path", "", "S3 path for mark data, required unless cleaning all resources. Its bucket is never swept")
+	fs.StringVar(&f.Region, "region", "", "The region to clean (otherwise defaults to all regions)")
+	fs.StringVar(&f.TTLTagKey, "ttl-tag-key", "", "If set, allow resources to use a tag with this key to override TTL")
+	fs.StringVar(&f.FirstSeenTagKey, "first-seen-tag-key", "", "If set, tag taggable resources with this key and the time they were first seen, e.g. janitor/first-seen, so that their age survives the loss of the mark data")
+	fs.StringVar(&f.GlobalResources, "global-resources", GlobalInclude, fmt.Sprintf("Whether to sweep the non-regional resources, e.g. IAM roles, one of %v. Run the janitors of single regions with skip and a single one with only to sweep them once per account", GlobalResourceModes))
+	fs.Var(&f.ExcludeTags, "exclude-tags",
+		"Resources with any of these tags will not be managed by the janitor. Given as a comma-separated list of tags in key[=value] format; excluding the value will match any tag with that key. Keys can be repeated.")
+	fs.Var(&f.IncludeTags, "include-tags",
+		"Resources must include all of these tags in order to be managed by the janitor. Given as a comma-separated list of tags in key[=value] format; excluding the value will match any tag with that key. Keys can be repeated.")
+	fs.Var(&f.OnlyTypes, "only-type",
+		fmt.Sprintf("If set, only sweep resources of these types. Given as a comma-separated list of types among %v. S3Buckets are only swept if selected here.", TypeNames()))
+	fs.Var(&f.CertificateDomains, "certificate-domains",
+		"If set, sweep the unused ACM certificates for the domains matching these patterns, which are never swept otherwise. Given as a comma-separated list of regular expressions matching the whole domain, e.g. e2e-.*\\.example\\.com.")
+}
+
+// Options validates the flags and returns the Options they select for
+// sweeping account with sess.
+func (f *Flags) Options(sess *session.Session, account string) (Options, error) {
+	if !sets.NewString(GlobalResourceModes...).Has(f.GlobalResources) {
+		return Options{}, fmt.Errorf("--global-resources must be one of %v", GlobalResourceModes)
+	}
+	excludeTM, err := TagMatcherForTags(f.ExcludeTags)
+	if err != nil {
+		return Options{}, errors.Wrap(err, "invalid --exclude-tags")
+	}
+	includeTM, err := TagMatcherForTags(f.IncludeTags)
+	if err != nil {
+		return Options{}, errors.Wrap(err, "invalid --include-tags")
+	}
+	onlyTypes, err := ParseOnlyTypes(f.OnlyTypes)
+	if err != nil {
+		return Options{}, errors.Wrap(err, "invalid --only-type")
+	}
+	certDomains, err := ParseDomainPatterns(f.CertificateDomains)
+	if err != nil {
+		return Options{}, errors.Wrap(err, "invalid --certificate-domains")
+	}
+	return Options{
+		Session:     sess,
+		Account:     account,
+		ExcludeTags: excludeTM,
+		IncludeTags: includeTM,
+		TTLTagKey:   f.TTLTagKey,
+
+		FirstSeenTagKey: f.FirstSeenTagKey,
+
+		OnlyTypes: onlyTypes,
+
+		CertificateDomains: certDomains,
+		GlobalResources:    f.GlobalResources,
+	}, nil
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"flag"
+	"testing"
+)
+
+func TestFlagsOptions(t *testing.T) {
+	testCases := []struct {
+		name        string
+		args        []string
+		expectErr   bool
+		expectTypes []string
+	}{
+		{
+			name: "defaults",
+		},
+		{
+			name:        "selected types",
+			args:        []string{"--only-type=S3Buckets,VPCs", "--global-resources=" + GlobalOnly},
+			expectTypes: []string{"S3Buckets", "VPCs"},
+		},
+		{
+			name:      "unknown global mode",
+			args:      []string{"--global-resources=sometimes"},
+			expectErr: true,
+		},
+		{
+			name:      "invalid certificate domains",
+			args:      []string{"--certificate-domains=e2e-("},
+			expectErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var f Flags
+			fs := flag.NewFlagSet(tc.name, flag.ContinueOnError)
+			f.AddFlags(fs)
+			if err := fs.Parse(tc.args); err != nil {
+				t.Fatalf("failed to parse flags: %v", err)
+			}
+			opts, err := f.Options(nil, "123")
+			if (err != nil) != tc.expectErr {
+				t.Fatalf("expected error %t, got %v", tc.expectErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if opts.Account != "123" || opts.GlobalResources != f.GlobalResources {
+				t.Errorf("unexpected options %+v", opts)
+			}
+			if got := opts.OnlyTypes.List(); len(got) != len(tc.expectTypes) || (len(got) > 0 && !opts.OnlyTypes.HasAll(tc.expectTypes...)) {
+				t.Errorf("expected types %v, got %v", tc.expectTypes, got)
+			}
+		})
+	}
+}
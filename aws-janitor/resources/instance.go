@@ -122,3 +122,7 @@ func (i instance) ARN() string {
 func (i instance) ResourceKey() string {
 	return i.ARN()
 }
+
+func (i instance) ec2ID() string {
+	return i.InstanceID
+}
@@ -139,3 +139,7 @@ func (ig internetGateway) ARN() string {
 func (ig internetGateway) ResourceKey() string {
 	return ig.ARN()
 }
+
+func (ig internetGateway) ec2ID() string {
+	return ig.ID
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+)
+
+// InventoryItem is a resource the janitor can see.
+type InventoryItem struct {
+	// Type is the name of the janitor type listing the resource, e.g. VPCs.
+	Type string `json:"type"`
+	// Key is the resource key of the resource.
+	Key string `json:"key"`
+	ParsedARN
+	// ARNString is the ARN of the resource.
+	ARNString string `json:"arn"`
+	// Excluded tells whether the resource is protected by an exclusion.
+	Excluded bool `json:"excluded,omitempty"`
+}
+
+// ARN implements Interface, so that items can be matched like the resources
+// they describe.
+func (i InventoryItem) ARN() string {
+	return i.ARNString
+}
+
+// ResourceKey implements Interface.
+func (i InventoryItem) ResourceKey() string {
+	return i.Key
+}
+
+// InventoryFilter restricts an inventory.
+type InventoryFilter struct {
+	// Match, if set, is matched against the ARN, resource key and ID of the
+	// resources.
+	Match *regexp.Regexp
+	// SkipExcluded leaves out the resources protected by an exclusion.
+	SkipExcluded bool
+}
+
+// keeps tells whether item is part of the inventory according to opts and f.
+func (f InventoryFilter) keeps(opts Options, item InventoryItem) bool {
+	if !opts.Targets(item) || (f.SkipExcluded && item.Excluded) {
+		return false
+	}
+	if f.Match == nil {
+		return true
+	}
+	for _, id := range identifiers(item) {
+		if f.Match.MatchString(id) {
+			return true
+		}
+	}
+	return false
+}
+
+// inventoryItems returns the items for the resources t listed in s.
+func inventoryItems(opts Options, t Type, s *Set, f InventoryFilter) []InventoryItem {
+	var items []InventoryItem
+	for _, key := range s.GetARNs() {
+		item := InventoryItem{Type: TypeName(t), Key: key, ARNString: arnOfKey(key)}
+		parsed, err := ParseARN(item.ARNString)
+		if err != nil {
+			logrus.WithError(err).Warningf("failed to parse the ARN of resource %s", key)
+		}
+		item.ParsedARN = parsed
+		item.Excluded = opts.Exclusions.Excludes(item)
+		if f.keeps(opts, item) {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Inventory lists the resources of the types swept according to opts in
+// regionList, and the global resources, without marking or deleting them.
+// Failures to list a type are logged and skipped, so that one missing
+// permission does not hide the other resources.
+func Inventory(opts Options, regionList []string, globalRegion string, f InventoryFilter) []InventoryItem {
+	var items []InventoryItem
+	list := func(t Type, region string) {
+		if !opts.SweepsType(t) {
+			return
+		}
+		opts.Region = region
+		set, err := t.ListAll(opts)
+		if err != nil {
+			logrus.WithError(err).Errorf("failed to list %s in %q", TypeName(t), region)
+			return
+		}
+		items = append(items, inventoryItems(opts, t, set, f)...)
+	}
+	for _, region := range regionList {
+		for _, t := range RegionalTypeList {
+			list(t, region)
+		}
+	}
+	for _, t := range GlobalTypeList {
+		list(t, globalRegion)
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].Type != items[j].Type {
+			return items[i].Type < items[j].Type
+		}
+		return items[i].Key < items[j].Key
+	})
+	return items
+}
+
+var inventoryCSVHeader = []string{"type", "region", "account", "service", "resource_type", "id", "arn", "key", "excluded"}
+
+// WriteInventory writes items to w in format, either json or csv.
+func WriteInventory(w io.Writer, items []InventoryItem, format string) error {
+	switch format {
+	case "json":
+		if items == nil {
+			items = []InventoryItem{}
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(items)
+	case "csv":
+		writer := csv.NewWriter(w)
+		if err := writer.Write(inventoryCSVHeader); err != nil {
+			return err
+		}
+		for _, item := range items {
+			if err := writer.Write([]string{item.Type, item.Region, item.Account, item.Service, item.ResourceType,
+				item.ID, item.ARNString, item.Key, fmt.Sprint(item.Excluded)}); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	default:
+		return fmt.Errorf("unknown inventory format %q, must be json or csv", format)
+	}
+}
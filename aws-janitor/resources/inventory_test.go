@@ -0,0 +1,51 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestInventory(t *testing.T) {
+	set := NewSet(0)
+	for _, key := range []string{
+		"arn:aws:ec2:us-east-1:123:vpc/vpc-2",
+		"arn:aws:ec2:us-east-1:123:vpc/vpc-1",
+		"AROA1::arn:aws:iam::123:role/role-1",
+	} {
+		set.firstSeen[key] = time.Now()
+	}
+	items := inventoryItems(Options{}, VPCs{}, set, InventoryFilter{Match: regexp.MustCompile("^vpc-1$|^role-1$")})
+
+	buf := &bytes.Buffer{}
+	if err := WriteInventory(buf, items, "csv"); err != nil {
+		t.Fatalf("failed to write the inventory: %v", err)
+	}
+	expected := `type,region,account,service,resource_type,id,arn,key,excluded
+VPCs,,123,iam,role,role-1,arn:aws:iam::123:role/role-1,AROA1::arn:aws:iam::123:role/role-1,false
+VPCs,us-east-1,123,ec2,vpc,vpc-1,arn:aws:ec2:us-east-1:123:vpc/vpc-1,arn:aws:ec2:us-east-1:123:vpc/vpc-1,false
+`
+	if buf.String() != expected {
+		t.Errorf("expected inventory\n%s\ngot\n%s", expected, buf.String())
+	}
+	if err := WriteInventory(buf, items, "yaml"); err == nil {
+		t.Error("expected an unknown format to be rejected")
+	}
+}
@@ -17,7 +17,10 @@ limitations under the License.
 package resources
 
 import (
+	"regexp"
+
 	"github.com/aws/aws-sdk-go/aws/session"
+	"k8s.io/apimachinery/pkg/util/sets"
 )
 
 // Options holds parameters for resource functions.
@@ -37,8 +40,59 @@ type Options struct {
 	// The value of the tag must be a valid Go time.Duration string.
 	TTLTagKey string
 
+	// If set, taggable resources are tagged with this key and the time they were
+	// first seen, which is used alongside the Set to compute their age.
+	FirstSeenTagKey string
+
 	// Whether to actually delete resources, or just report what would be deleted.
 	DryRun bool
+
+	// If set, only resources of the types with these names, e.g. VPCs, are swept.
+	OnlyTypes sets.String
+	// If set, only the resources with these ARNs, resource keys or IDs are swept.
+	OnlyResources sets.String
+	// If not nil, only the resources with these resource keys, as read from a
+	// reviewed plan, are swept. An empty plan sweeps nothing.
+	Planned sets.String
+
+	// Resources protected by these exclusions are never swept.
+	Exclusions *Exclusions `json:"-"`
+
+	// The S3 buckets with these names, e.g. the one storing the Set, are never
+	// swept.
+	KeepBuckets sets.String
+
+	// Only the unused ACM certificates for domains matching one of these
+	// patterns are swept. None are swept if unset.
+	CertificateDomains []*regexp.Regexp
+
+	// Whether the non-regional resources are swept along with the regional
+	// ones, see GlobalResourceModes. They are swept by default.
+	GlobalResources string
+}
+
+const (
+	// GlobalInclude sweeps the non-regional resources after the regional ones.
+	GlobalInclude = "include"
+	// GlobalSkip only sweeps the regional resources, e.g. in the janitors of
+	// single regions, while another janitor sweeps the non-regional ones once
+	// for the account.
+	GlobalSkip = "skip"
+	// GlobalOnly only sweeps the non-regional resources.
+	GlobalOnly = "only"
+)
+
+// GlobalResourceModes are the valid values of Options.GlobalResources.
+var GlobalResourceModes = []string{GlobalInclude, GlobalSkip, GlobalOnly}
+
+// SweepsRegional tells whether the regional resources are swept.
+func (opts Options) SweepsRegional() bool {
+	return opts.GlobalResources != GlobalOnly
+}
+
+// SweepsGlobal tells whether the non-regional resources are swept.
+func (opts Options) SweepsGlobal() bool {
+	return opts.GlobalResources != GlobalSkip
 }
 
 type Type interface {
@@ -78,6 +132,7 @@ var RegionalTypeList = []Type{
 	Addresses{},
 	ElasticFileSystems{},
 	SQSQueues{},
+	ACMCertificates{},
 }
 
 // Non-regional AWS resource types, in dependency order
@@ -85,4 +140,7 @@ var GlobalTypeList = []Type{
 	IAMInstanceProfiles{},
 	IAMRoles{},
 	Route53ResourceRecordSets{},
+	CloudFrontDistributions{},
+	// Only swept when selected by OnlyTypes, see optInTypes.
+	S3Buckets{},
 }
@@ -103,3 +103,7 @@ func (ng natGateway) ARN() string {
 func (ng natGateway) ResourceKey() string {
 	return ng.ARN()
 }
+
+func (ng natGateway) ec2ID() string {
+	return ng.ID
+}
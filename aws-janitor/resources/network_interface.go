@@ -116,3 +116,7 @@ func (eni networkInterface) ARN() string {
 func (eni networkInterface) ResourceKey() string {
 	return eni.ARN()
 }
+
+func (eni networkInterface) ec2ID() string {
+	return eni.ID
+}
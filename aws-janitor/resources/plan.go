@@ -0,0 +1,77 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// Plan lists the resources a sweep would delete, so that it can be reviewed
+// before a later sweep deletes only these resources.
+type Plan struct {
+	// Account is the account the plan was made for.
+	Account string `json:"account"`
+	// Created is when the plan was made.
+	Created time.Time `json:"created"`
+	// Resources are the keys of the resources to delete.
+	Resources []string `json:"resources"`
+}
+
+// NewPlan returns a plan to delete the resources swept in s.
+func NewPlan(account string, s *Set) *Plan {
+	keys := append([]string{}, s.Swept()...)
+	sort.Strings(keys)
+	return &Plan{Account: account, Created: time.Now(), Resources: keys}
+}
+
+// ReadPlan reads a plan written by WritePlan.
+func ReadPlan(path string) (*Plan, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	plan := &Plan{}
+	if err := json.Unmarshal(b, plan); err != nil {
+		return nil, fmt.Errorf("invalid plan %s: %v", path, err)
+	}
+	return plan, nil
+}
+
+// WritePlan writes the plan to path.
+func (p *Plan) WritePlan(path string) error {
+	b, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0644)
+}
+
+// Keys returns the resource keys in the plan, for use as the Planned option.
+func (p *Plan) Keys() sets.String {
+	return sets.NewString(p.Resources...)
+}
+
+// InPlan tells whether r is swept according to the Planned option.
+func (opts Options) InPlan(r Interface) bool {
+	return opts.Planned == nil || opts.Planned.Has(r.ResourceKey())
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+func TestPlan(t *testing.T) {
+	planned := vpc{Account: "123", Region: "us-east-1", ID: "vpc-1"}
+	unplanned := vpc{Account: "123", Region: "us-east-1", ID: "vpc-2"}
+
+	// Writing a plan is a dry run recording what would be deleted.
+	s := NewSet(0)
+	s.Mark(Options{}, planned, nil, Tags{})
+	path := filepath.Join(t.TempDir(), "plan.json")
+	if err := NewPlan("123", s).WritePlan(path); err != nil {
+		t.Fatalf("failed to write plan: %v", err)
+	}
+	plan, err := ReadPlan(path)
+	if err != nil {
+		t.Fatalf("failed to read plan: %v", err)
+	}
+	if plan.Account != "123" || !reflect.DeepEqual(plan.Resources, []string{planned.ResourceKey()}) {
+		t.Fatalf("unexpected plan %+v", plan)
+	}
+
+	testCases := []struct {
+		name     string
+		planned  sets.String
+		r        vpc
+		expected bool
+	}{
+		{
+			name:     "no plan",
+			r:        unplanned,
+			expected: true,
+		},
+		{
+			name:     "in plan",
+			planned:  plan.Keys(),
+			r:        planned,
+			expected: true,
+		},
+		{
+			name:    "not in plan",
+			planned: plan.Keys(),
+			r:       unplanned,
+		},
+		{
+			name:    "empty plan",
+			planned: sets.NewString(),
+			r:       planned,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := Options{Planned: tc.planned}
+			if swept := NewSet(0).Mark(opts, tc.r, nil, Tags{}); swept != tc.expected {
+				t.Errorf("expected swept %t, got %t", tc.expected, swept)
+			}
+		})
+	}
+}
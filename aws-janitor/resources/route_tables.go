@@ -122,3 +122,7 @@ func (rt routeTable) ARN() string {
 func (rt routeTable) ResourceKey() string {
 	return rt.ARN()
 }
+
+func (rt routeTable) ec2ID() string {
+	return rt.ID
+}
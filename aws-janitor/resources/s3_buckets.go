@@ -0,0 +1,155 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// S3 buckets: https://docs.aws.amazon.com/sdk-for-go/api/service/s3
+
+type S3Buckets struct{}
+
+func (S3Buckets) MarkAndSweep(opts Options, set *Set) error {
+	logger := logrus.WithField("options", opts)
+	svc := s3.New(opts.Session, aws.NewConfig().WithRegion(opts.Region))
+
+	resp, err := svc.ListBuckets(&s3.ListBucketsInput{})
+	if err != nil {
+		return err
+	}
+
+	var toDelete []*s3Bucket
+	for _, b := range resp.Buckets {
+		bucket := &s3Bucket{name: aws.StringValue(b.Name)}
+		if opts.KeepBuckets.Has(bucket.name) {
+			continue
+		}
+		// Buckets are listed globally, but must be emptied and deleted from
+		// their region.
+		location, err := svc.GetBucketLocation(&s3.GetBucketLocationInput{Bucket: b.Name})
+		if err != nil {
+			logger.Warningf("%s: failed getting the region: %v", bucket.ARN(), err)
+			continue
+		}
+		bucket.region = s3.NormalizeBucketLocation(aws.StringValue(location.LocationConstraint))
+		tags, err := bucket.tags(s3.New(opts.Session, aws.NewConfig().WithRegion(bucket.region)))
+		if err != nil {
+			logger.Warningf("%s: failed listing tags: %v", bucket.ARN(), err)
+			continue
+		}
+		if !set.Mark(opts, bucket, b.CreationDate, tags) {
+			continue
+		}
+		logger.Warningf("%s: deleting %T: %s", bucket.ARN(), b, bucket.name)
+		if !opts.DryRun {
+			toDelete = append(toDelete, bucket)
+		}
+	}
+
+	for _, b := range toDelete {
+		if err := b.delete(s3.New(opts.Session, aws.NewConfig().WithRegion(b.region))); err != nil {
+			logger.Warningf("%s: delete failed: %v", b.ARN(), err)
+		}
+	}
+	return nil
+}
+
+func (S3Buckets) ListAll(opts Options) (*Set, error) {
+	svc := s3.New(opts.Session, aws.NewConfig().WithRegion(opts.Region))
+	set := NewSet(0)
+	resp, err := svc.ListBuckets(&s3.ListBucketsInput{})
+	if err != nil {
+		return set, errors.Wrapf(err, "couldn't list s3 buckets for %q in %q", opts.Account, opts.Region)
+	}
+	now := time.Now()
+	for _, b := range resp.Buckets {
+		set.firstSeen[s3Bucket{name: aws.StringValue(b.Name)}.ARN()] = now
+	}
+	return set, nil
+}
+
+type s3Bucket struct {
+	name   string
+	region string
+}
+
+func (b s3Bucket) ARN() string {
+	return fmt.Sprintf("arn:aws:s3:::%s", b.name)
+}
+
+func (b s3Bucket) ResourceKey() string {
+	return b.ARN()
+}
+
+func (b s3Bucket) tags(svc *s3.S3) (Tags, error) {
+	tags := Tags{}
+	resp, err := svc.GetBucketTagging(&s3.GetBucketTaggingInput{Bucket: aws.String(b.name)})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "NoSuchTagSet" {
+			return tags, nil
+		}
+		return nil, err
+	}
+	for _, t := range resp.TagSet {
+		tags.Add(t.Key, t.Value)
+	}
+	return tags, nil
+}
+
+// delete deletes every version of the objects of the bucket, as buckets must
+// be empty to be deleted, then the bucket.
+func (b s3Bucket) delete(svc *s3.S3) error {
+	var deleteErr error
+	err := svc.ListObjectVersionsPages(&s3.ListObjectVersionsInput{Bucket: aws.String(b.name)}, func(page *s3.ListObjectVersionsOutput, _ bool) bool {
+		var objects []*s3.ObjectIdentifier
+		for _, v := range page.Versions {
+			objects = append(objects, &s3.ObjectIdentifier{Key: v.Key, VersionId: v.VersionId})
+		}
+		for _, m := range page.DeleteMarkers {
+			objects = append(objects, &s3.ObjectIdentifier{Key: m.Key, VersionId: m.VersionId})
+		}
+		if len(objects) == 0 {
+			return true
+		}
+		// Pages hold at most 1000 versions, as many as may be deleted at once.
+		if _, deleteErr = svc.DeleteObjects(&s3.DeleteObjectsInput{
+			Bucket: aws.String(b.name),
+			Delete: &s3.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		}); deleteErr != nil {
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return errors.Wrapf(err, "error listing the objects of s3 bucket %q", b.name)
+	}
+	if deleteErr != nil {
+		return errors.Wrapf(deleteErr, "error deleting the objects of s3 bucket %q", b.name)
+	}
+	if _, err := svc.DeleteBucket(&s3.DeleteBucketInput{Bucket: aws.String(b.name)}); err != nil {
+		return errors.Wrapf(err, "error deleting s3 bucket %q", b.name)
+	}
+	return nil
+}
@@ -156,3 +156,7 @@ func (sg securityGroup) ARN() string {
 func (sg securityGroup) ResourceKey() string {
 	return sg.ARN()
 }
+
+func (sg securityGroup) ec2ID() string {
+	return sg.ID
+}
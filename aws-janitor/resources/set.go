@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -27,6 +28,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/sets"
 
 	s3path "sigs.k8s.io/boskos/aws-janitor/s3"
 )
@@ -37,9 +39,21 @@ type Set struct {
 	firstSeen map[string]time.Time // ARN -> first time we saw
 	marked    map[string]bool      // ARN -> seen this run
 	swept     []string             // List of resources we attempted to sweep (to summarize)
+	untagged  []pendingTag         // Resources to tag with their first seen time
 	ttl       time.Duration
+
+	namespace       string      // Namespace resources are marked in, see SetNamespace
+	sweptNamespaces sets.String // Namespaces marked this run, all if nil
 }
 
+// GlobalNamespace is the namespace of the Set the non-regional resources are
+// marked in.
+const GlobalNamespace = "global"
+
+// namespaceSeparator separates the namespace from the resource key in the
+// keys of the Set. It never appears in ARNs.
+const namespaceSeparator = "|"
+
 func NewSet(ttl time.Duration) *Set {
 	return &Set{
 		firstSeen: make(map[string]time.Time),
@@ -48,6 +62,35 @@ func NewSet(ttl time.Duration) *Set {
 	}
 }
 
+// SetNamespace makes the resources marked from now on recorded in namespace,
+// the default one being empty. Once it is called, MarkComplete only forgets the
+// resources of the namespaces set during the run, so janitors sweeping some of
+// the namespaces, e.g. only the non-regional resources, keep the others.
+func (s *Set) SetNamespace(namespace string) {
+	if s.sweptNamespaces == nil {
+		s.sweptNamespaces = sets.NewString()
+	}
+	s.sweptNamespaces.Insert(namespace)
+	s.namespace = namespace
+}
+
+// namespacedKey returns the key the resource key is recorded under in the
+// current namespace.
+func (s *Set) namespacedKey(key string) string {
+	if s.namespace == "" {
+		return key
+	}
+	return s.namespace + namespaceSeparator + key
+}
+
+// namespaceOf returns the namespace of a key of the Set.
+func namespaceOf(key string) string {
+	if idx := strings.Index(key, namespaceSeparator); idx >= 0 {
+		return key[:idx]
+	}
+	return ""
+}
+
 func (s *Set) GetARNs() []string {
 	slice := make([]string, len(s.firstSeen))
 	i := 0
@@ -109,12 +152,27 @@ func (s *Set) Save(sess *session.Session, p *s3path.Path) error {
 // and the global TTL is not set to 0, then the TTL duration in this tag's value will
 // be used for this resource.
 //
+// If the FirstSeenTagKey option is set, a first seen time recorded in this tag is
+// also taken into account, and taggable resources lacking the tag are queued to
+// be tagged by TagFirstSeen, so that their age survives the loss of the Set.
+//
+// Resources not targeted by the OnlyResources option, not in the Planned option
+// when it is set, or protected by the Exclusions option are never deleted.
+//
 // If Mark(r) returns true, the resource is managed per tags, and the TTL has expired
 // for r and it should be deleted.
 // If the created time is not provided, the current time is used instead.
 func (s *Set) Mark(opts Options, r Interface, created *time.Time, tags Tags) bool {
 	key := r.ResourceKey()
-	s.marked[key] = true
+	stored := s.namespacedKey(key)
+	s.marked[stored] = true
+	// Resources recorded before namespaces were introduced keep their age.
+	if t, ok := s.firstSeen[key]; ok && stored != key {
+		if _, ok := s.firstSeen[stored]; !ok {
+			s.firstSeen[stored] = t
+		}
+		delete(s.firstSeen, key)
+	}
 
 	// Calculate the most likely creation time based on whichever is first:
 	// - the current time
@@ -126,12 +184,24 @@ func (s *Set) Mark(opts Options, r Interface, created *time.Time, tags Tags) boo
 		firstSeen = *created
 	}
 
-	if t, ok := s.firstSeen[key]; ok && t.Before(firstSeen) {
+	if t, ok := s.firstSeen[stored]; ok && t.Before(firstSeen) {
 		firstSeen = t
 	}
-	s.firstSeen[key] = firstSeen
+	tagged := false
+	if val, ok := tags[opts.FirstSeenTagKey]; opts.FirstSeenTagKey != "" && ok {
+		t, err := time.Parse(time.RFC3339, val)
+		if err != nil {
+			logrus.Errorf("resource %s: invalid time '%s' in tag '%s': %v", key, val, opts.FirstSeenTagKey, err)
+		} else {
+			tagged = true
+			if t.Before(firstSeen) {
+				firstSeen = t
+			}
+		}
+	}
+	s.firstSeen[stored] = firstSeen
 
-	if !opts.ManagedPerTags(tags) {
+	if !opts.Targets(r) || !opts.InPlan(r) || opts.Exclusions.Excludes(r) || !opts.ManagedPerTags(tags) {
 		return false
 	}
 
@@ -153,15 +223,27 @@ func (s *Set) Mark(opts Options, r Interface, created *time.Time, tags Tags) boo
 		s.swept = append(s.swept, key)
 		return true
 	}
+	if t, ok := r.(ec2Taggable); ok && opts.FirstSeenTagKey != "" && !tagged {
+		s.untagged = append(s.untagged, pendingTag{r: t, firstSeen: firstSeen})
+	}
 	return false
 }
 
+// Swept returns the resources Mark advised to delete.
+func (s *Set) Swept() []string {
+	return s.swept
+}
+
 // MarkComplete figures out which ARNs were in previous passes but not
 // this one, and eliminates them. It should only be run after all
-// resources have been marked.
+// resources have been marked. Only the resources of the namespaces marked
+// this run are eliminated, see SetNamespace.
 func (s *Set) MarkComplete() int {
 	var gone []string
 	for key := range s.firstSeen {
+		if s.sweptNamespaces != nil && !s.sweptNamespaces.Has(namespaceOf(key)) {
+			continue
+		}
 		if !s.marked[key] {
 			gone = append(gone, key)
 		}
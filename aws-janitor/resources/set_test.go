@@ -17,6 +17,7 @@ limitations under the License.
 package resources
 
 import (
+	"reflect"
 	"testing"
 	"time"
 )
@@ -187,3 +188,26 @@ func TestMarkCreationTimes(t *testing.T) {
 		}
 	}
 }
+
+func TestSetNamespaces(t *testing.T) {
+	threeHoursAgo := time.Now().Add(-3 * time.Hour)
+	s := NewSet(time.Hour)
+	s.firstSeen["regional"] = threeHoursAgo
+	s.firstSeen["global|deleted"] = threeHoursAgo
+	// Recorded before the namespaces were introduced.
+	s.firstSeen["role"] = threeHoursAgo
+
+	s.SetNamespace(GlobalNamespace)
+	if !s.Mark(Options{}, fakeResource{Name: "role"}, nil, nil) {
+		t.Error("expected the role recorded outside of the namespace to keep its age")
+	}
+	if len(s.swept) != 1 || s.swept[0] != "role" {
+		t.Errorf("expected the resource key to be swept, got %v", s.swept)
+	}
+	s.MarkComplete()
+
+	expected := []string{"global|role", "regional"}
+	if got := s.GetARNs(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected only the resources of the swept namespace to be forgotten, got %v", got)
+	}
+}
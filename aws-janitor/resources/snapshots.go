@@ -116,3 +116,7 @@ func (s snapshot) ARN() string {
 func (s snapshot) ResourceKey() string {
 	return s.ARN()
 }
+
+func (s snapshot) ec2ID() string {
+	return s.ID
+}
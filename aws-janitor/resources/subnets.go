@@ -99,3 +99,7 @@ func (sub subnet) ARN() string {
 func (sub subnet) ResourceKey() string {
 	return sub.ARN()
 }
+
+func (sub subnet) ec2ID() string {
+	return sub.ID
+}
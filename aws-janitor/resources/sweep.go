@@ -0,0 +1,82 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/boskos/aws-janitor/regions"
+	s3path "sigs.k8s.io/boskos/aws-janitor/s3"
+)
+
+// MarkAndSweep marks the resources of the regions in regionList, then the
+// non-regional ones, in set, sweeping those which outlived its TTL.
+// Regional and non-regional resources are marked in their own namespaces,
+// so janitors sweeping only one kind don't forget the other.
+func MarkAndSweep(opts Options, regionList []string, set *Set) error {
+	if opts.SweepsRegional() {
+		set.SetNamespace("")
+		for _, region := range regionList {
+			opts.Region = region
+			for _, typ := range RegionalTypeList {
+				if !opts.SweepsType(typ) {
+					continue
+				}
+				if err := typ.MarkAndSweep(opts, set); err != nil {
+					return errors.Wrapf(err, "Error sweeping %T", typ)
+				}
+			}
+			set.TagFirstSeen(opts)
+		}
+	}
+
+	if opts.SweepsGlobal() {
+		opts.Region = regions.Default
+		set.SetNamespace(GlobalNamespace)
+		for _, typ := range GlobalTypeList {
+			if !opts.SweepsType(typ) {
+				continue
+			}
+			if err := typ.MarkAndSweep(opts, set); err != nil {
+				return errors.Wrapf(err, "Error sweeping %T", typ)
+			}
+		}
+	}
+	return nil
+}
+
+// MarkSweepAndSave runs MarkAndSweep, then forgets the resources of set which
+// are gone and saves it to path. It returns the number of resources swept.
+func MarkSweepAndSave(opts Options, regionList []string, set *Set, path *s3path.Path) (int, error) {
+	if err := MarkAndSweep(opts, regionList, set); err != nil {
+		return 0, err
+	}
+	var swept int
+	if opts.Targeted() {
+		// Resources outside of the targeted sweep were not marked, so they
+		// must not be forgotten.
+		swept = len(set.Swept())
+		logrus.Infof("targeted sweep, resources swept: %v", set.Swept())
+	} else {
+		swept = set.MarkComplete()
+	}
+	if err := set.Save(opts.Session, path); err != nil {
+		return 0, errors.Wrapf(err, "Error saving s3://%s%s", path.Bucket, path.Key)
+	}
+	return swept, nil
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// TypeName returns the name a resource type is selected by, e.g. VPCs.
+func TypeName(t Type) string {
+	return reflect.TypeOf(t).Name()
+}
+
+// TypeNames returns the names of all the known resource types, sorted.
+func TypeNames() []string {
+	var names []string
+	for _, t := range append(append([]Type{}, RegionalTypeList...), GlobalTypeList...) {
+		names = append(names, TypeName(t))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseOnlyTypes validates the names of resource types to restrict a sweep to.
+func ParseOnlyTypes(names []string) (sets.String, error) {
+	known := sets.NewString(TypeNames()...)
+	only := sets.NewString()
+	for _, name := range names {
+		if !known.Has(name) {
+			return nil, fmt.Errorf("unknown resource type %q, must be one of %v", name, known.List())
+		}
+		only.Insert(name)
+	}
+	return only, nil
+}
+
+// optInTypes are only swept when selected by OnlyTypes: S3 buckets hold data
+// that often outlives any TTL, so sweeping every old bucket of an account by
+// default would be too destructive.
+var optInTypes = sets.NewString(TypeName(S3Buckets{}))
+
+// SweepsType tells whether resources of type t are swept.
+func (opts Options) SweepsType(t Type) bool {
+	if opts.OnlyTypes.Len() == 0 {
+		return !optInTypes.Has(TypeName(t))
+	}
+	return opts.OnlyTypes.Has(TypeName(t))
+}
+
+// Targets tells whether r is swept according to OnlyResources, which matches
+// either the ARN, the resource key, or the ID at the end of the ARN of r.
+func (opts Options) Targets(r Interface) bool {
+	if opts.OnlyResources.Len() == 0 {
+		return true
+	}
+	return opts.OnlyResources.HasAny(identifiers(r)...)
+}
+
+// identifiers returns the ARN, the resource key and the ID at the end of the
+// ARN of r, which users may refer to r by, along with the ID parsed by the
+// ARN parser of its service if it differs.
+func identifiers(r Interface) []string {
+	arn := r.ARN()
+	ids := []string{arn, r.ResourceKey(), arn[strings.LastIndexAny(arn, "/:")+1:]}
+	if parsed, err := ParseARN(arn); err == nil && parsed.ID != ids[2] {
+		ids = append(ids, parsed.ID)
+	}
+	return ids
+}
+
+// Targeted tells whether the sweep is restricted to some types or resources.
+func (opts Options) Targeted() bool {
+	return opts.OnlyTypes.Len() > 0 || opts.OnlyResources.Len() > 0
+}
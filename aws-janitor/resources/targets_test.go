@@ -0,0 +1,86 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+func TestTargets(t *testing.T) {
+	vpc := vpc{Account: "123", Region: "us-east-1", ID: "vpc-1"}
+	testCases := []struct {
+		name          string
+		onlyResources []string
+		expected      bool
+	}{
+		{
+			name:     "untargeted sweep",
+			expected: true,
+		},
+		{
+			name:          "targeted by ARN",
+			onlyResources: []string{"arn:aws:ec2:us-east-1:123:vpc/vpc-1"},
+			expected:      true,
+		},
+		{
+			name:          "targeted by ID",
+			onlyResources: []string{"vpc-2", "vpc-1"},
+			expected:      true,
+		},
+		{
+			name:          "not targeted",
+			onlyResources: []string{"vpc-2"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := Options{OnlyResources: sets.NewString(tc.onlyResources...)}
+			if targeted := opts.Targets(vpc); targeted != tc.expected {
+				t.Errorf("expected targeted %t, got %t", tc.expected, targeted)
+			}
+			// Resources that are not targeted are never deleted.
+			if swept := NewSet(0).Mark(opts, vpc, nil, Tags{}); swept != tc.expected {
+				t.Errorf("expected swept %t, got %t", tc.expected, swept)
+			}
+		})
+	}
+}
+
+func TestParseOnlyTypes(t *testing.T) {
+	only, err := ParseOnlyTypes([]string{"VPCs", "IAMRoles"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	opts := Options{OnlyTypes: only}
+	if !opts.SweepsType(VPCs{}) || !opts.SweepsType(IAMRoles{}) || opts.SweepsType(Subnets{}) {
+		t.Errorf("expected only VPCs and IAMRoles to be swept, got %v", only.List())
+	}
+	if _, err := ParseOnlyTypes([]string{"vpcs"}); err == nil {
+		t.Error("expected an unknown type to be rejected")
+	}
+}
+
+func TestSweepsOptInTypes(t *testing.T) {
+	if opts := (Options{}); !opts.SweepsType(IAMRoles{}) || opts.SweepsType(S3Buckets{}) {
+		t.Error("expected S3 buckets to be left out of untargeted sweeps")
+	}
+	if opts := (Options{OnlyTypes: sets.NewString("S3Buckets")}); !opts.SweepsType(S3Buckets{}) {
+		t.Error("expected S3 buckets to be swept when selected")
+	}
+}
@@ -109,3 +109,7 @@ func (vol volume) ARN() string {
 func (vol volume) ResourceKey() string {
 	return vol.ARN()
 }
+
+func (vol volume) ec2ID() string {
+	return vol.ID
+}
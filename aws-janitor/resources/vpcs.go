@@ -111,3 +111,7 @@ func (vp vpc) ARN() string {
 func (vp vpc) ResourceKey() string {
 	return vp.ARN()
 }
+
+func (vp vpc) ec2ID() string {
+	return vp.ID
+}
@@ -24,13 +24,16 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math/rand"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
-	"syscall"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
@@ -48,11 +51,62 @@ var (
 	ErrNotFound = errors.New("resources not found")
 	// ErrAlreadyInUse is returned by Acquire when resources are already being requested.
 	ErrAlreadyInUse = errors.New("resources already used by another user")
+	// ErrQuotaExceeded is returned by Acquire when the owner already holds its
+	// quota of resources of the requested type.
+	ErrQuotaExceeded = errors.New("owner quota exceeded")
+	// ErrHoldExpired is returned by Confirm when the hold lapsed before it was
+	// confirmed.
+	ErrHoldExpired = errors.New("hold expired")
+	// ErrLameDuck is returned by Acquire, Hold and AcquireByState while boskos
+	// is draining for maintenance and does not grant new leases.
+	ErrLameDuck = errors.New("boskos is draining for maintenance")
+	// ErrTypeNotFound is returned by DeclareDemand when the resource type is not
+	// a dynamic resource type, and by Acquire when it does not exist.
+	ErrTypeNotFound = errors.New("resource type not found")
+	// ErrCleanupPaused is returned by Acquire when dirty resources are requested
+	// while their cleanup is paused after too many failures.
+	ErrCleanupPaused = errors.New("cleanup paused")
+	// ErrTransitionDenied is returned by Acquire, AcquireByState and Release
+	// when the transition webhook of the resource type denies the state change.
+	ErrTransitionDenied = errors.New("state transition denied")
+	// ErrTransitionNotAllowed is returned by Acquire, AcquireByState and
+	// Release when the state change is not one of the transitions the config
+	// allows for the resource type.
+	ErrTransitionNotAllowed = errors.New("state transition not allowed")
+	// ErrShardNotAssigned is returned by AcquireInShard when the membership of
+	// the client in the shard group lapsed.
+	ErrShardNotAssigned = errors.New("shard not assigned")
+	// ErrTenantMismatch is returned by Acquire when the resource type belongs
+	// to another tenant than the tenant of the client.
+	ErrTenantMismatch = errors.New("resource type of another tenant")
+	// ErrPolicyDenied is returned by Acquire when the policy of the resource
+	// type does not allow the client to acquire it.
+	ErrPolicyDenied = errors.New("denied by the policy of the resource type")
+	// ErrApprovalPending is returned by Acquire and AcquireBatch while the
+	// acquisition waits for an operator to approve it. AcquireWait keeps
+	// waiting.
+	ErrApprovalPending = errors.New("acquisition pending approval")
+	// ErrApprovalDenied is returned by Acquire and AcquireBatch when the
+	// acquisition was denied, or not approved in time.
+	ErrApprovalDenied = errors.New("acquisition denied")
+	// ErrUserDataTooLarge is returned by UpdateOne and Update when a value
+	// of the user data exceeds the limit of boskos.
+	ErrUserDataTooLarge = errors.New("user data too large")
 	// ErrContextRequired is returned by AcquireWait and AcquireByStateWait when
 	// they are invoked with a nil context.
 	ErrContextRequired = errors.New("context required")
 )
 
+// WaitEstimateExceededError is returned by AcquireWithMaxWait when boskos
+// estimates that no resource will be available within the max wait.
+type WaitEstimateExceededError struct {
+	common.WaitEstimateExceeded
+}
+
+func (e *WaitEstimateExceededError) Error() string {
+	return e.Message
+}
+
 // Client defines the public Boskos client object
 type Client struct {
 	// Dialer is the net.Dialer used to establish connections to the remote
@@ -66,7 +120,23 @@ type Client struct {
 	url         string
 	username    string
 	getPassword func() []byte
-	lock        sync.Mutex
+	// getToken returns the scoped token the client authenticates with, if any.
+	getToken func() []byte
+	// tenant is the tenant the client acquires resources on behalf of.
+	tenant string
+	// v2API is set while the server serves the v2 API, with its structured
+	// errors, as told by the responses of the server.
+	v2API int32
+	lock  sync.Mutex
+	// deprecations holds the IDs of the deprecations already logged.
+	deprecations sync.Map
+	// health holds the last health advisory received for each degraded type.
+	health sync.Map
+	// loadAdvice holds the last load advice received for each exhausted type.
+	loadAdvice sync.Map
+	// retryAfter holds the last delay boskos advised to wait before retrying
+	// to acquire each type.
+	retryAfter sync.Map
 
 	storage storage.PersistenceLayer
 }
@@ -143,6 +213,27 @@ func NewClientWithPasswordGetter(owner string, urlString, username string, passw
 	return client, nil
 }
 
+// SetTenant makes the client acquire resources on behalf of tenant, when
+// several teams share a boskos instance with pools of their own. Clients
+// authenticating as a caller of a tenant act on its behalf by default. It
+// must be called before the client is used.
+func (c *Client) SetTenant(tenant string) {
+	c.tenant = tenant
+}
+
+// SetTokenFile makes the client authenticate with the bearer token held by
+// tokenFile, a scoped token or one of the tokens authenticated by the server,
+// rather than with basic auth. The file is watched, so the token
+// can be rotated without restarting the client. It must be called before the
+// client is used.
+func (c *Client) SetTokenFile(tokenFile string) error {
+	if err := secret.Add(tokenFile); err != nil {
+		return err
+	}
+	c.getToken = secret.GetTokenGenerator(tokenFile)
+	return nil
+}
+
 // public method
 
 // Acquire asks boskos for a resource of certain type in certain state, and set the resource to dest state.
@@ -155,7 +246,22 @@ func (c *Client) Acquire(rtype, state, dest string) (*common.Resource, error) {
 // Returns the resource on success.
 // Boskos Priority are FIFO.
 func (c *Client) AcquireWithPriority(rtype, state, dest, requestID string) (*common.Resource, error) {
-	r, err := c.acquire(rtype, state, dest, requestID)
+	return c.AcquireWithMaxWait(rtype, state, dest, requestID, 0)
+}
+
+// AcquireWithMaxWait is like AcquireWithPriority, but asks boskos to fail fast
+// with a *WaitEstimateExceededError if it estimates that the resource will not
+// be available within maxWait, so callers can give up early or try another type.
+// A zero maxWait disables the estimate.
+func (c *Client) AcquireWithMaxWait(rtype, state, dest, requestID string, maxWait time.Duration) (*common.Resource, error) {
+	return c.AcquirePrioritized(rtype, state, dest, requestID, 0, maxWait)
+}
+
+// AcquirePrioritized is like AcquireWithMaxWait for a request of the given
+// priority. Boskos serves the waiting requests of a higher priority first, and
+// those of the same priority in FIFO order. The default priority is zero.
+func (c *Client) AcquirePrioritized(rtype, state, dest, requestID string, priority int, maxWait time.Duration) (*common.Resource, error) {
+	r, err := c.acquire(rtype, state, dest, requestID, "", "", priority, maxWait, 0, 0, false)
 	if err != nil {
 		return nil, err
 	}
@@ -168,6 +274,304 @@ func (c *Client) AcquireWithPriority(rtype, state, dest, requestID string) (*com
 	return r, nil
 }
 
+// AcquireWithLease is like Acquire, but boskos releases the resource to the
+// dirty state once lease expires, even if the client is killed before it
+// releases the resource and whether or not it keeps sending heartbeats.
+func (c *Client) AcquireWithLease(rtype, state, dest, requestID string, lease time.Duration) (*common.Resource, error) {
+	r, err := c.acquire(rtype, state, dest, requestID, "", "", 0, 0, lease, 0, false)
+	if err != nil {
+		return nil, err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.storage.Add(*r)
+
+	return r, nil
+}
+
+// AcquireWithSelector is like AcquireWithPriority, but only considers the
+// resources whose user data match the label selector, e.g.
+// region=us-east-1,size=large.
+func (c *Client) AcquireWithSelector(rtype, state, dest, requestID, selector string) (*common.Resource, error) {
+	r, err := c.acquire(rtype, state, dest, requestID, "", selector, 0, 0, 0, 0, false)
+	if err != nil {
+		return nil, err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.storage.Add(*r)
+
+	return r, nil
+}
+
+// AcquireFlavor is like AcquireWithPriority, but only considers the resources
+// of the given flavor of rtype, a dynamic resource type with flavors.
+func (c *Client) AcquireFlavor(rtype, state, dest, requestID, flavor string) (*common.Resource, error) {
+	return c.AcquireWithSelector(rtype, state, dest, requestID, common.FlavorUserDataKey+"="+flavor)
+}
+
+// AcquireWithFallback is like AcquireWithMaxWait, but asks boskos for a
+// resource of the fallback type of rtype in its config when rtype is exhausted.
+// The type of the returned resource tells which type was acquired.
+func (c *Client) AcquireWithFallback(rtype, state, dest, requestID string, maxWait time.Duration) (*common.Resource, error) {
+	r, err := c.acquire(rtype, state, dest, requestID, "", "", 0, maxWait, 0, 0, true)
+	if err != nil {
+		return nil, err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.storage.Add(*r)
+
+	return r, nil
+}
+
+// JoinShardGroup makes the client owner a member of the shard group for ttl,
+// or renews its membership, and returns its current shard. Replicas sharing
+// work join the same group and acquire with AcquireInShard, so that no
+// resource is handed to two of them. The membership must be renewed well
+// within ttl; once it lapses, AcquireInShard returns ErrShardNotAssigned.
+// Boskos only lets admins join shard groups, so the client must authenticate
+// as one.
+func (c *Client) JoinShardGroup(group string, ttl time.Duration) (*common.ShardAssignment, error) {
+	values := url.Values{}
+	values.Set("group", group)
+	values.Set("owner", c.owner)
+	if ttl > 0 {
+		values.Set("ttl", ttl.String())
+	}
+
+	var assignment common.ShardAssignment
+	work := func(retriedErrs *[]error) (bool, error) {
+		resp, err := c.httpPost("/shards", values, "", nil)
+		if err != nil {
+			*retriedErrs = append(*retriedErrs, err)
+			return false, nil
+		}
+		defer resp.Body.Close()
+
+		switch resp.StatusCode {
+		case http.StatusOK:
+			if err := json.NewDecoder(resp.Body).Decode(&assignment); err != nil {
+				return false, err
+			}
+			return true, nil
+		default:
+			*retriedErrs = append(*retriedErrs, fmt.Errorf("status %s, status code %v joining shard group %s", resp.Status, resp.StatusCode, group))
+			return false, nil
+		}
+	}
+
+	if err := retry(work); err != nil {
+		return nil, err
+	}
+	return &assignment, nil
+}
+
+// AcquireInShard is like Acquire, but only considers the resources of the
+// shard of the client in group, which must have been joined with
+// JoinShardGroup.
+func (c *Client) AcquireInShard(rtype, state, dest, group string) (*common.Resource, error) {
+	r, err := c.acquire(rtype, state, dest, "", group, "", 0, 0, 0, 0, false)
+	if err != nil {
+		return nil, err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.storage.Add(*r)
+
+	return r, nil
+}
+
+// Hold asks boskos to hold a resource of certain type in certain state for
+// ttl. The hold must be confirmed with Confirm, which moves the resource to
+// dest, otherwise boskos returns the resource to its original state.
+// Returns the held resource on success.
+func (c *Client) Hold(rtype, state, dest string, ttl time.Duration) (*common.Resource, error) {
+	r, err := c.hold(rtype, state, dest, ttl)
+	if err != nil {
+		return nil, err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.storage.Add(*r)
+
+	return r, nil
+}
+
+// ClaimExpired asks boskos for a resource of certain type whose lease expired,
+// moving it to dest under the owner of the client. With a positive expire,
+// the busy, cleaning and leased resources not updated for that long are also
+// claimable. Returns ErrNotFound if there is none.
+func (c *Client) ClaimExpired(rtype, dest string, expire time.Duration) (*common.Resource, error) {
+	r, err := c.claimExpired(rtype, dest, expire)
+	if err != nil {
+		return nil, err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.storage.Add(*r)
+
+	return r, nil
+}
+
+// Confirm confirms a hold obtained with Hold, moving the resource to the
+// destination state of the hold.
+func (c *Client) Confirm(name string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	r, err := c.confirm(name)
+	if err != nil {
+		if err == ErrHoldExpired {
+			if deleteErr := c.storage.Delete(name); deleteErr != nil {
+				logrus.WithError(deleteErr).Warningf("failed to forget expired hold on %s", name)
+			}
+		}
+		return err
+	}
+	_, err = c.storage.Update(*r)
+	return err
+}
+
+// DeclareDemand tells boskos that count resources of rtype will be acquired
+// in about in, so it can create dynamic resources ahead of time. It returns the
+// number of resources created.
+func (c *Client) DeclareDemand(rtype string, count int, in time.Duration) (int, error) {
+	values := url.Values{}
+	values.Set("type", rtype)
+	values.Set("count", strconv.Itoa(count))
+	values.Set("in", in.String())
+
+	var declared common.DemandDeclared
+	work := func(retriedErrs *[]error) (bool, error) {
+		resp, err := c.httpPost("/demand", values, "", nil)
+		if err != nil {
+			*retriedErrs = append(*retriedErrs, err)
+			return false, nil
+		}
+		defer resp.Body.Close()
+
+		switch resp.StatusCode {
+		case http.StatusOK:
+			if err := json.NewDecoder(resp.Body).Decode(&declared); err != nil {
+				return false, err
+			}
+			return true, nil
+		case http.StatusNotFound:
+			return false, ErrTypeNotFound
+		default:
+			*retriedErrs = append(*retriedErrs, fmt.Errorf("status %s, status code %v declaring demand for %s", resp.Status, resp.StatusCode, rtype))
+			return false, nil
+		}
+	}
+
+	return declared.Created, retry(work)
+}
+
+// ReportRegionUsage reports that used out of the limit of the quota of region
+// is in use for rtype, so that boskos places new dynamic resources of rtype in
+// the regions with the most headroom. It is meant to be called by janitors.
+func (c *Client) ReportRegionUsage(rtype, region string, used, limit int) error {
+	values := url.Values{}
+	values.Set("type", rtype)
+	values.Set("region", region)
+	values.Set("used", strconv.Itoa(used))
+	values.Set("limit", strconv.Itoa(limit))
+
+	work := func(retriedErrs *[]error) (bool, error) {
+		resp, err := c.httpPost("/regionusage", values, "", nil)
+		if err != nil {
+			*retriedErrs = append(*retriedErrs, err)
+			return false, nil
+		}
+		defer resp.Body.Close()
+
+		switch resp.StatusCode {
+		case http.StatusOK:
+			return true, nil
+		case http.StatusNotFound:
+			return false, ErrTypeNotFound
+		default:
+			*retriedErrs = append(*retriedErrs, fmt.Errorf("status %s, status code %v reporting usage of %s in %s", resp.Status, resp.StatusCode, rtype, region))
+			return false, nil
+		}
+	}
+
+	return retry(work)
+}
+
+// Book books slices consecutive time slices of a resource of the time-sliced
+// rtype, starting at notBefore at the earliest. The resource is moved to the
+// busy state for the client's owner once its booking starts, and released as
+// dirty when it ends. ErrNotFound is returned if rtype is not time-sliced or
+// no slot is available.
+func (c *Client) Book(rtype string, slices int, notBefore time.Time) (*common.Booking, error) {
+	values := url.Values{}
+	values.Set("type", rtype)
+	values.Set("owner", c.owner)
+	values.Set("slices", strconv.Itoa(slices))
+	if !notBefore.IsZero() {
+		values.Set("not_before", notBefore.Format(time.RFC3339))
+	}
+
+	var booking common.Booking
+	work := func(retriedErrs *[]error) (bool, error) {
+		resp, err := c.httpPost("/book", values, "", nil)
+		if err != nil {
+			*retriedErrs = append(*retriedErrs, err)
+			return false, nil
+		}
+		defer resp.Body.Close()
+
+		switch resp.StatusCode {
+		case http.StatusOK:
+			if err := json.NewDecoder(resp.Body).Decode(&booking); err != nil {
+				return false, err
+			}
+			return true, nil
+		case http.StatusNotFound:
+			return false, ErrNotFound
+		default:
+			*retriedErrs = append(*retriedErrs, fmt.Errorf("status %s, status code %v booking %s", resp.Status, resp.StatusCode, rtype))
+			return false, nil
+		}
+	}
+
+	if err := retry(work); err != nil {
+		return nil, err
+	}
+	return &booking, nil
+}
+
+// CancelBooking cancels a booking obtained with Book. A booking in progress
+// releases the resource as dirty.
+func (c *Client) CancelBooking(booking common.Booking) error {
+	values := url.Values{}
+	values.Set("name", booking.Name)
+	values.Set("owner", c.owner)
+	values.Set("start", booking.Start.Format(time.RFC3339))
+
+	work := func(retriedErrs *[]error) (bool, error) {
+		resp, err := c.httpPost("/cancelbooking", values, "", nil)
+		if err != nil {
+			*retriedErrs = append(*retriedErrs, err)
+			return false, nil
+		}
+		defer resp.Body.Close()
+
+		switch resp.StatusCode {
+		case http.StatusOK:
+			return true, nil
+		case http.StatusNotFound:
+			return false, ErrNotFound
+		default:
+			*retriedErrs = append(*retriedErrs, fmt.Errorf("status %s, status code %v cancelling booking of %s", resp.Status, resp.StatusCode, booking.Name))
+			return false, nil
+		}
+	}
+
+	return retry(work)
+}
+
 // AcquireWait blocks until Acquire returns the specified resource or the
 // provided context is cancelled or its deadline exceeded.
 func (c *Client) AcquireWait(ctx context.Context, rtype, state, dest string) (*common.Resource, error) {
@@ -184,28 +588,71 @@ func (c *Client) AcquireWaitWithPriority(ctx context.Context, rtype, state, dest
 		return nil, ErrContextRequired
 	}
 	// Try to acquire the resource until available or the context is
-	// cancelled or its deadline exceeded.
+	// cancelled or its deadline exceeded. Boskos holds each attempt open
+	// until a resource is available or the long poll times out.
 	for {
-		r, err := c.AcquireWithPriority(rtype, state, dest, requestID)
+		wait := longPollTimeout
+		if deadline, ok := ctx.Deadline(); ok {
+			if untilDeadline := time.Until(deadline); untilDeadline < wait {
+				wait = untilDeadline
+			}
+		}
+		start := time.Now()
+		r, err := c.acquire(rtype, state, dest, requestID, "", "", 0, 0, 0, wait, false)
 		if err != nil {
-			if err == ErrAlreadyInUse || err == ErrNotFound {
+			if err == ErrAlreadyInUse || err == ErrNotFound || err == ErrQuotaExceeded || err == ErrLameDuck || err == ErrApprovalPending {
+				// Attempts failing before the end of the long poll, e.g. as
+				// servers without long polls fail right away, back off.
+				var delay time.Duration
+				if time.Since(start) < wait {
+					delay = c.retryDelay(rtype)
+				}
 				select {
 				case <-ctx.Done():
 					return nil, err
-				case <-time.After(3 * time.Second):
+				case <-time.After(delay):
 					continue
 				}
 			}
 			return nil, err
 		}
+		c.lock.Lock()
+		c.storage.Add(*r)
+		c.lock.Unlock()
 		return r, nil
 	}
 }
 
+// longPollTimeout is how long AcquireWait asks boskos to hold each attempt
+// open for.
+const longPollTimeout = time.Minute
+
+// defaultRetryDelay is how long AcquireWait waits before retrying when
+// boskos gave no advice.
+const defaultRetryDelay = 3 * time.Second
+
+// retryDelay returns how long to wait before retrying to acquire rtype: the
+// delay advised by boskos, or defaultRetryDelay, plus up to a tenth of it at
+// random so that clients failing together do not retry together.
+func (c *Client) retryDelay(rtype string) time.Duration {
+	delay := defaultRetryDelay
+	if advised, ok := c.retryAfter.Load(rtype); ok {
+		delay = advised.(time.Duration)
+	}
+	return delay + time.Duration(rand.Int63n(int64(delay)/10+1))
+}
+
 // AcquireByState asks boskos for a resources of certain type, and set the resource to dest state.
 // Returns a list of resources on success.
 func (c *Client) AcquireByState(state, dest string, names []string) ([]common.Resource, error) {
-	resources, err := c.acquireByState(state, dest, names)
+	return c.AcquireByStateWithPriority(state, dest, names, "")
+}
+
+// AcquireByStateWithPriority is like AcquireByState, but requests with a
+// requestID wait in line: boskos only hands the resources to the oldest request
+// for the same names, and only once all of them are available.
+func (c *Client) AcquireByStateWithPriority(state, dest string, names []string, requestID string) ([]common.Resource, error) {
+	resources, err := c.acquireByState(state, dest, names, requestID)
 	if err != nil {
 		return nil, err
 	}
@@ -217,19 +664,21 @@ func (c *Client) AcquireByState(state, dest string, names []string) ([]common.Re
 	return resources, nil
 }
 
-// AcquireByStateWait blocks until AcquireByState returns the specified
+// AcquireByStateWait blocks until AcquireByStateWithPriority returns the specified
 // resource(s) or the provided context is cancelled or its deadline
 // exceeded.
 func (c *Client) AcquireByStateWait(ctx context.Context, state, dest string, names []string) ([]common.Resource, error) {
 	if ctx == nil {
 		return nil, ErrContextRequired
 	}
+	// request with FIFO priority among the waiters for the same names
+	requestID := uuid.New().String()
 	// Try to acquire the resource(s) until available or the context is
 	// cancelled or its deadline exceeded.
 	for {
-		r, err := c.AcquireByState(state, dest, names)
+		r, err := c.AcquireByStateWithPriority(state, dest, names, requestID)
 		if err != nil {
-			if err == ErrAlreadyInUse || err == ErrNotFound {
+			if err == ErrAlreadyInUse || err == ErrNotFound || err == ErrLameDuck {
 				select {
 				case <-ctx.Done():
 					return nil, err
@@ -243,6 +692,22 @@ func (c *Client) AcquireByStateWait(ctx context.Context, state, dest string, nam
 	}
 }
 
+// AcquireBatch asks boskos for the resources of every type of needs at once:
+// either all of them are acquired, or none. Requests with a requestID wait in
+// line in the queue of every requested type.
+func (c *Client) AcquireBatch(needs common.ResourceNeeds, state, dest, requestID string) ([]common.Resource, error) {
+	resources, err := c.acquireBatch(needs, state, dest, requestID)
+	if err != nil {
+		return nil, err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, r := range resources {
+		c.storage.Add(r)
+	}
+	return resources, nil
+}
+
 // ReleaseAll returns all resources hold by the client back to boskos and set them to dest state.
 func (c *Client) ReleaseAll(dest string) error {
 	c.lock.Lock()
@@ -280,6 +745,19 @@ func (c *Client) ReleaseOne(name, dest string) error {
 	return nil
 }
 
+// ReleaseCleaned is like ReleaseOne, for janitors releasing a resource they
+// cleaned, reporting how long the cleanup took to boskos.
+func (c *Client) ReleaseCleaned(name, dest string, cleanupDuration time.Duration) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if _, err := c.storage.Get(name); err != nil {
+		return fmt.Errorf("no resource name %v", name)
+	}
+	c.storage.Delete(name)
+	return c.release(name, dest, cleanupDuration)
+}
+
 // UpdateAll signals update for all resources hold by the client.
 func (c *Client) UpdateAll(state string) error {
 	c.lock.Lock()
@@ -346,6 +824,23 @@ func (c *Client) UpdateOne(name, state string, userData *common.UserData) error
 	return c.updateLocalResource(r, state, userData)
 }
 
+// UpdateOneWithProgress is like UpdateOne, also reporting what the job is
+// doing with the resource, so that operators can follow long-running jobs.
+// The progress shows in listings until the next report or the release.
+func (c *Client) UpdateOneWithProgress(name, state string, userData *common.UserData, progress common.Progress) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	r, err := c.storage.Get(name)
+	if err != nil {
+		return fmt.Errorf("no resource name %v", name)
+	}
+	if err := c.update(r.Name, state, userData, &progress); err != nil {
+		return err
+	}
+	return c.updateLocalResource(r, state, userData)
+}
+
 // Reset will scan all boskos resources of type, in state, last updated before expire, and set them to dest state.
 // Returns a map of {resourceName:owner} for further actions.
 func (c *Client) Reset(rtype, state string, expire time.Duration, dest string) (map[string]string, error) {
@@ -366,6 +861,69 @@ func (c *Client) HasResource() bool {
 
 // private methods
 
+// HealthAdvisory returns the health advisory boskos sent along with the last
+// acquire response for rtype, or nil if rtype was healthy then. Clients can
+// use it to back off or to pick another type while rtype is degraded.
+func (c *Client) HealthAdvisory(rtype string) *common.HealthAdvisory {
+	if advisory, ok := c.health.Load(rtype); ok {
+		return advisory.(*common.HealthAdvisory)
+	}
+	return nil
+}
+
+// LoadAdvice returns the last load advice boskos sent for rtype, which tells
+// how exhausted it was when an acquire last failed, or nil if the last
+// acquire did not fail for lack of resources.
+func (c *Client) LoadAdvice(rtype string) *common.LoadAdvice {
+	if advice, ok := c.loadAdvice.Load(rtype); ok {
+		return advice.(*common.LoadAdvice)
+	}
+	return nil
+}
+
+// observeLoad records the load advice and the Retry-After headers of an
+// acquire response.
+func (c *Client) observeLoad(rtype string, header http.Header) {
+	if seconds, err := strconv.Atoi(header.Get("Retry-After")); err == nil && seconds > 0 {
+		c.retryAfter.Store(rtype, time.Duration(seconds)*time.Second)
+	} else {
+		c.retryAfter.Delete(rtype)
+	}
+	value := header.Get(common.LoadAdviceHeader)
+	if value == "" {
+		c.loadAdvice.Delete(rtype)
+		return
+	}
+	advice := &common.LoadAdvice{}
+	if err := json.Unmarshal([]byte(value), advice); err != nil {
+		logrus.WithError(err).Warningf("invalid %s header", common.LoadAdviceHeader)
+		return
+	}
+	if advice.Type != rtype {
+		return
+	}
+	c.loadAdvice.Store(rtype, advice)
+	logrus.WithField("type", rtype).Debugf("Resource type is exhausted, retrying in %vs: %+v", advice.RetryAfterSeconds, advice)
+}
+
+// observeHealth records the health advisory header of an acquire response.
+func (c *Client) observeHealth(rtype, header string) {
+	if header == "" {
+		c.health.Delete(rtype)
+		return
+	}
+	advisory := &common.HealthAdvisory{}
+	if err := json.Unmarshal([]byte(header), advisory); err != nil {
+		logrus.WithError(err).Warningf("invalid %s header", common.HealthAdvisoryHeader)
+		return
+	}
+	if advisory.Type != rtype {
+		return
+	}
+	c.health.Store(rtype, advisory)
+	logrus.WithField("type", rtype).Debugf("Resource type is degraded: %v", advisory.Conditions)
+}
+
 func (c *Client) updateLocalResource(res common.Resource, state string, data *common.UserData) error {
 	res.State = state
 	if res.UserData == nil {
@@ -377,7 +935,7 @@ func (c *Client) updateLocalResource(res common.Resource, state string, data *co
 	return err
 }
 
-func (c *Client) acquire(rtype, state, dest, requestID string) (*common.Resource, error) {
+func (c *Client) acquire(rtype, state, dest, requestID, shardGroup, selector string, priority int, maxWait, lease, wait time.Duration, fallback bool) (*common.Resource, error) {
 	values := url.Values{}
 	values.Set("type", rtype)
 	values.Set("state", state)
@@ -386,6 +944,27 @@ func (c *Client) acquire(rtype, state, dest, requestID string) (*common.Resource
 	if requestID != "" {
 		values.Set("request_id", requestID)
 	}
+	if shardGroup != "" {
+		values.Set("shard_group", shardGroup)
+	}
+	if selector != "" {
+		values.Set("selector", selector)
+	}
+	if priority != 0 {
+		values.Set("priority", strconv.Itoa(priority))
+	}
+	if maxWait > 0 {
+		values.Set("max_wait", maxWait.String())
+	}
+	if lease > 0 {
+		values.Set("lease", lease.String())
+	}
+	if fallback {
+		values.Set("fallback", "true")
+	}
+	if wait > 0 {
+		values.Set("wait", wait.String())
+	}
 
 	res := common.Resource{}
 
@@ -397,6 +976,8 @@ func (c *Client) acquire(rtype, state, dest, requestID string) (*common.Resource
 			return false, nil
 		}
 		defer resp.Body.Close()
+		c.observeHealth(rtype, resp.Header.Get(common.HealthAdvisoryHeader))
+		c.observeLoad(rtype, resp.Header)
 
 		switch resp.StatusCode {
 		case http.StatusOK:
@@ -416,7 +997,40 @@ func (c *Client) acquire(rtype, state, dest, requestID string) (*common.Resource
 		case http.StatusUnauthorized:
 			return false, ErrAlreadyInUse
 		case http.StatusNotFound:
+			// Only the v2 API tells unknown types from exhausted ones.
+			if apiError(resp).Code == common.ErrorResourceTypeNotFound {
+				return false, ErrTypeNotFound
+			}
 			return false, ErrNotFound
+		case http.StatusServiceUnavailable:
+			return false, ErrLameDuck
+		case http.StatusLocked:
+			return false, ErrCleanupPaused
+		case http.StatusForbidden:
+			if resp.Header.Get(common.TenantHeader) != "" {
+				return false, ErrTenantMismatch
+			}
+			switch apiError(resp).Code {
+			case common.ErrorPolicyDenied:
+				return false, ErrPolicyDenied
+			case common.ErrorApprovalDenied:
+				return false, ErrApprovalDenied
+			}
+			return false, ErrTransitionDenied
+		case http.StatusAccepted:
+			return false, ErrApprovalPending
+		case http.StatusUnprocessableEntity:
+			return false, ErrTransitionNotAllowed
+		case http.StatusConflict:
+			return false, ErrShardNotAssigned
+		case http.StatusTooManyRequests:
+			return false, ErrQuotaExceeded
+		case http.StatusPreconditionFailed:
+			estimate := &WaitEstimateExceededError{}
+			if err := json.NewDecoder(resp.Body).Decode(&estimate.WaitEstimateExceeded); err != nil {
+				return false, err
+			}
+			return false, estimate
 		default:
 			*retriedErrs = append(*retriedErrs, fmt.Errorf("status %s, status code %v", resp.Status, resp.StatusCode))
 			// Swallow it so we can retry
@@ -427,12 +1041,134 @@ func (c *Client) acquire(rtype, state, dest, requestID string) (*common.Resource
 	return &res, retry(work)
 }
 
-func (c *Client) acquireByState(state, dest string, names []string) ([]common.Resource, error) {
+func (c *Client) hold(rtype, state, dest string, ttl time.Duration) (*common.Resource, error) {
+	values := url.Values{}
+	values.Set("type", rtype)
+	values.Set("state", state)
+	values.Set("owner", c.owner)
+	values.Set("dest", dest)
+	if ttl > 0 {
+		values.Set("ttl", ttl.String())
+	}
+
+	res := common.Resource{}
+
+	work := func(retriedErrs *[]error) (bool, error) {
+		resp, err := c.httpPost("/hold", values, "", nil)
+		if err != nil {
+			*retriedErrs = append(*retriedErrs, err)
+			return false, nil
+		}
+		defer resp.Body.Close()
+
+		switch resp.StatusCode {
+		case http.StatusOK:
+			if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+				return false, err
+			}
+			if res.Name == "" {
+				return false, fmt.Errorf("unable to parse resource")
+			}
+			return true, nil
+		case http.StatusUnauthorized:
+			return false, ErrAlreadyInUse
+		case http.StatusNotFound:
+			return false, ErrNotFound
+		case http.StatusServiceUnavailable:
+			return false, ErrLameDuck
+		case http.StatusTooManyRequests:
+			return false, ErrQuotaExceeded
+		default:
+			*retriedErrs = append(*retriedErrs, fmt.Errorf("status %s, status code %v", resp.Status, resp.StatusCode))
+			return false, nil
+		}
+	}
+
+	return &res, retry(work)
+}
+
+func (c *Client) claimExpired(rtype, dest string, expire time.Duration) (*common.Resource, error) {
+	values := url.Values{}
+	values.Set("type", rtype)
+	values.Set("owner", c.owner)
+	values.Set("dest", dest)
+	if expire > 0 {
+		values.Set("expire", expire.String())
+	}
+
+	res := common.Resource{}
+
+	work := func(retriedErrs *[]error) (bool, error) {
+		resp, err := c.httpPost("/claimexpired", values, "", nil)
+		if err != nil {
+			*retriedErrs = append(*retriedErrs, err)
+			return false, nil
+		}
+		defer resp.Body.Close()
+
+		switch resp.StatusCode {
+		case http.StatusOK:
+			if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+				return false, err
+			}
+			if res.Name == "" {
+				return false, fmt.Errorf("unable to parse resource")
+			}
+			return true, nil
+		case http.StatusNotFound:
+			return false, ErrNotFound
+		case http.StatusServiceUnavailable:
+			return false, ErrLameDuck
+		default:
+			*retriedErrs = append(*retriedErrs, fmt.Errorf("status %s, status code %v", resp.Status, resp.StatusCode))
+			return false, nil
+		}
+	}
+
+	return &res, retry(work)
+}
+
+func (c *Client) confirm(name string) (*common.Resource, error) {
+	values := url.Values{}
+	values.Set("name", name)
+	values.Set("owner", c.owner)
+
+	res := common.Resource{}
+
+	work := func(retriedErrs *[]error) (bool, error) {
+		resp, err := c.httpPost("/confirm", values, "", nil)
+		if err != nil {
+			*retriedErrs = append(*retriedErrs, err)
+			return false, nil
+		}
+		defer resp.Body.Close()
+
+		switch resp.StatusCode {
+		case http.StatusOK:
+			if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+				return false, err
+			}
+			return true, nil
+		case http.StatusGone:
+			return false, ErrHoldExpired
+		default:
+			*retriedErrs = append(*retriedErrs, fmt.Errorf("status %s, status code %v confirming %s", resp.Status, resp.StatusCode, name))
+			return false, nil
+		}
+	}
+
+	return &res, retry(work)
+}
+
+func (c *Client) acquireByState(state, dest string, names []string, requestID string) ([]common.Resource, error) {
 	values := url.Values{}
 	values.Set("state", state)
 	values.Set("dest", dest)
 	values.Set("names", strings.Join(names, ","))
 	values.Set("owner", c.owner)
+	if requestID != "" {
+		values.Set("request_id", requestID)
+	}
 	var resources []common.Resource
 
 	work := func(retriedErrs *[]error) (bool, error) {
@@ -453,6 +1189,70 @@ func (c *Client) acquireByState(state, dest string, names []string) ([]common.Re
 			return false, ErrAlreadyInUse
 		case http.StatusNotFound:
 			return false, ErrNotFound
+		case http.StatusServiceUnavailable:
+			return false, ErrLameDuck
+		case http.StatusForbidden:
+			return false, ErrTransitionDenied
+		case http.StatusUnprocessableEntity:
+			return false, ErrTransitionNotAllowed
+		default:
+			*retriedErrs = append(*retriedErrs, fmt.Errorf("status %s, status code %v", resp.Status, resp.StatusCode))
+			return false, nil
+		}
+	}
+
+	return resources, retry(work)
+}
+
+func (c *Client) acquireBatch(needs common.ResourceNeeds, state, dest, requestID string) ([]common.Resource, error) {
+	var types []string
+	for rtype, count := range needs {
+		types = append(types, fmt.Sprintf("%s:%d", rtype, count))
+	}
+	sort.Strings(types)
+	values := url.Values{}
+	values.Set("types", strings.Join(types, ","))
+	values.Set("state", state)
+	values.Set("dest", dest)
+	values.Set("owner", c.owner)
+	if requestID != "" {
+		values.Set("request_id", requestID)
+	}
+	var resources []common.Resource
+
+	work := func(retriedErrs *[]error) (bool, error) {
+		resp, err := c.httpPost("/acquirebatch", values, "", nil)
+		if err != nil {
+			*retriedErrs = append(*retriedErrs, err)
+			return false, nil
+		}
+		defer resp.Body.Close()
+
+		switch resp.StatusCode {
+		case http.StatusOK:
+			if err := json.NewDecoder(resp.Body).Decode(&resources); err != nil {
+				return false, err
+			}
+			return true, nil
+		case http.StatusUnauthorized:
+			return false, ErrAlreadyInUse
+		case http.StatusNotFound:
+			return false, ErrNotFound
+		case http.StatusServiceUnavailable:
+			return false, ErrLameDuck
+		case http.StatusLocked:
+			return false, ErrCleanupPaused
+		case http.StatusForbidden:
+			if apiError(resp).Code == common.ErrorApprovalDenied {
+				return false, ErrApprovalDenied
+			}
+			return false, ErrTransitionDenied
+		case http.StatusAccepted:
+			return false, ErrApprovalPending
+		case http.StatusUnprocessableEntity:
+			return false, ErrTransitionNotAllowed
+		case http.StatusTooManyRequests:
+			return false, ErrQuotaExceeded
 		default:
 			*retriedErrs = append(*retriedErrs, fmt.Errorf("status %s, status code %v", resp.Status, resp.StatusCode))
 			return false, nil
@@ -464,10 +1264,17 @@ func (c *Client) acquireByState(state, dest string, names []string) ([]common.Re
 
 // Release a lease for a resource and set its state to the destination state
 func (c *Client) Release(name, dest string) error {
+	return c.release(name, dest, 0)
+}
+
+func (c *Client) release(name, dest string, cleanupDuration time.Duration) error {
 	values := url.Values{}
 	values.Set("name", name)
 	values.Set("dest", dest)
 	values.Set("owner", c.owner)
+	if cleanupDuration > 0 {
+		values.Set("cleanup_duration", cleanupDuration.String())
+	}
 
 	work := func(retriedErrs *[]error) (bool, error) {
 		resp, err := c.httpPost("/release", values, "", nil)
@@ -477,6 +1284,12 @@ func (c *Client) Release(name, dest string) error {
 		}
 		defer resp.Body.Close()
 
+		if resp.StatusCode == http.StatusForbidden {
+			return false, ErrTransitionDenied
+		}
+		if resp.StatusCode == http.StatusUnprocessableEntity {
+			return false, ErrTransitionNotAllowed
+		}
 		if resp.StatusCode != http.StatusOK {
 			*retriedErrs = append(*retriedErrs, fmt.Errorf("status %s, statusCode %v releasing %s", resp.Status, resp.StatusCode, name))
 			return false, nil
@@ -487,8 +1300,43 @@ func (c *Client) Release(name, dest string) error {
 	return retry(work)
 }
 
+// AddNote attaches a note about the resource called name, e.g. for oncall
+// handoffs. Boskos records the caller as the author of the note, so the
+// client must be configured with credentials.
+func (c *Client) AddNote(name, text string) error {
+	values := url.Values{}
+	values.Set("name", name)
+	values.Set("text", text)
+
+	work := func(retriedErrs *[]error) (bool, error) {
+		resp, err := c.httpPost("/notes", values, "", nil)
+		if err != nil {
+			*retriedErrs = append(*retriedErrs, err)
+			return false, nil
+		}
+		defer resp.Body.Close()
+
+		switch resp.StatusCode {
+		case http.StatusOK:
+			return true, nil
+		case http.StatusUnauthorized:
+			return false, fmt.Errorf("status %s adding a note to %s: notes require credentials", resp.Status, name)
+		case http.StatusNotFound:
+			return false, ErrNotFound
+		}
+		*retriedErrs = append(*retriedErrs, fmt.Errorf("status %s, statusCode %v adding a note to %s", resp.Status, resp.StatusCode, name))
+		return false, nil
+	}
+
+	return retry(work)
+}
+
 // Update a resource on the server, setting the state and user data
 func (c *Client) Update(name, state string, userData *common.UserData) error {
+	return c.update(name, state, userData, nil)
+}
+
+func (c *Client) update(name, state string, userData *common.UserData, progress *common.Progress) error {
 	var bodyData *bytes.Buffer
 	if userData != nil {
 		bodyData = new(bytes.Buffer)
@@ -501,6 +1349,15 @@ func (c *Client) Update(name, state string, userData *common.UserData) error {
 	values.Set("name", name)
 	values.Set("owner", c.owner)
 	values.Set("state", state)
+	if progress != nil {
+		values.Set("phase", progress.Phase)
+		if progress.Percent > 0 {
+			values.Set("progress", strconv.Itoa(progress.Percent))
+		}
+		if progress.Message != "" {
+			values.Set("message", progress.Message)
+		}
+	}
 
 	work := func(retriedErrs *[]error) (bool, error) {
 		// As the body is an io.Reader and hence its content
@@ -516,6 +1373,9 @@ func (c *Client) Update(name, state string, userData *common.UserData) error {
 		}
 		defer resp.Body.Close()
 
+		if resp.StatusCode == http.StatusRequestEntityTooLarge {
+			return false, ErrUserDataTooLarge
+		}
 		if resp.StatusCode != http.StatusOK {
 			*retriedErrs = append(*retriedErrs, fmt.Errorf("status %s, status code %v updating %s", resp.Status, resp.StatusCode, name))
 			return false, nil
@@ -588,9 +1448,30 @@ func (c *Client) metric(rtype string) (common.Metric, error) {
 	return metric, retry(work)
 }
 
+// apiPath returns the path of action in the latest version of the API the
+// server serves.
+func (c *Client) apiPath(action string) string {
+	if atomic.LoadInt32(&c.v2API) == 1 {
+		return "/v2" + action
+	}
+	return action
+}
+
+// apiError returns the APIError of resp if the server responded with one, or
+// an empty one otherwise.
+func apiError(resp *http.Response) common.APIError {
+	var apiErr common.APIError
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(resp.Body).Decode(&apiErr); err != nil {
+			logrus.WithError(err).Debug("Failed to decode API error")
+		}
+	}
+	return apiErr
+}
+
 func (c *Client) httpGet(action string, values url.Values) (*http.Response, error) {
 	u, _ := url.ParseRequestURI(c.url)
-	u.Path = action
+	u.Path = c.apiPath(action)
 	u.RawQuery = values.Encode()
 	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
 	if err != nil {
@@ -599,12 +1480,12 @@ func (c *Client) httpGet(action string, values url.Values) (*http.Response, erro
 	if c.username != "" && c.getPassword != nil {
 		req.SetBasicAuth(c.username, string(c.getPassword()))
 	}
-	return c.http.Do(req)
+	return c.do(req)
 }
 
 func (c *Client) httpPost(action string, values url.Values, contentType string, body io.Reader) (*http.Response, error) {
 	u, _ := url.ParseRequestURI(c.url)
-	u.Path = action
+	u.Path = c.apiPath(action)
 	u.RawQuery = values.Encode()
 	req, err := http.NewRequest(http.MethodPost, u.String(), body)
 	if err != nil {
@@ -616,7 +1497,44 @@ func (c *Client) httpPost(action string, values url.Values, contentType string,
 	if contentType != "" {
 		req.Header.Set("Content-Type", contentType)
 	}
-	return c.http.Do(req)
+	return c.do(req)
+}
+
+// do sends req, and logs the deprecations flagged by the server once per
+// client, so consumers relying on deprecated behavior learn about it.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	if c.tenant != "" {
+		req.Header.Set(common.TenantHeader, c.tenant)
+	}
+	if c.getToken != nil {
+		req.Header.Set("Authorization", "Bearer "+string(bytes.TrimSpace(c.getToken())))
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return resp, err
+	}
+	// Older servers only serve the unversioned API, which stays available.
+	var v2API int32
+	if resp.Header.Get(common.APIVersionHeader) == common.APIVersion {
+		v2API = 1
+	}
+	atomic.StoreInt32(&c.v2API, v2API)
+	warnings := resp.Header.Values("Warning")
+	for idx, id := range resp.Header.Values(common.DeprecationHeader) {
+		// The client switched to the v2 API above on its own.
+		if id == common.UnversionedAPIDeprecation {
+			continue
+		}
+		if _, logged := c.deprecations.LoadOrStore(id, struct{}{}); logged {
+			continue
+		}
+		log := logrus.WithField("deprecation", id)
+		if idx < len(warnings) {
+			log = log.WithField("warning", warnings[idx])
+		}
+		log.Warning("Boskos reported reliance on deprecated behavior")
+	}
+	return resp, nil
 }
 
 // DialerWithRetry is a composite version of the net.Dialer that retries
@@ -684,11 +1602,7 @@ func isDialErrorRetriable(err error) bool {
 	if !isSysErr {
 		return false
 	}
-	switch sysErr.Err {
-	case syscall.ECONNREFUSED, syscall.ECONNRESET:
-		return true
-	}
-	return false
+	return isConnectionRefusedOrReset(sysErr.Err)
 }
 
 // workFunc describes retrieable work. It should
@@ -17,6 +17,7 @@ limitations under the License.
 package client
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
@@ -101,6 +102,214 @@ func TestAcquire(t *testing.T) {
 	}
 }
 
+func TestHealthAdvisory(t *testing.T) {
+	var testcases = []struct {
+		name   string
+		header string
+		expect *common.HealthAdvisory
+	}{
+		{
+			name: "healthy type",
+		},
+		{
+			name:   "degraded type",
+			header: `{"type":"t","conditions":[{"reason":"cleanup-paused","message":"paused"}]}`,
+			expect: &common.HealthAdvisory{Type: "t", Conditions: []common.HealthCondition{{Reason: common.HealthCleanupPaused, Message: "paused"}}},
+		},
+		{
+			name:   "advisory for another type",
+			header: `{"type":"other","conditions":[{"reason":"low-free","message":"few"}]}`,
+		},
+	}
+
+	for _, tc := range testcases {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if tc.header != "" {
+				w.Header().Set(common.HealthAdvisoryHeader, tc.header)
+			}
+			http.Error(w, "", http.StatusNotFound)
+		}))
+		defer ts.Close()
+
+		c, err := NewClient("user", ts.URL, "", "")
+		if err != nil {
+			t.Fatalf("failed to create the Boskos client")
+		}
+		if _, err := c.Acquire("t", "s", "d"); err != ErrNotFound {
+			t.Errorf("Test %v, got error %v, expect %v", tc.name, err, ErrNotFound)
+		}
+		if advisory := c.HealthAdvisory("t"); !reflect.DeepEqual(advisory, tc.expect) {
+			t.Errorf("Test %v, got advisory %+v, expect %+v", tc.name, advisory, tc.expect)
+		}
+	}
+}
+
+func TestAcquireWaitLongPolls(t *testing.T) {
+	var waits []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		waits = append(waits, r.URL.Query().Get("wait"))
+		if len(waits) == 1 {
+			// Like a server without long polls, which fails right away.
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, FakeRes)
+	}))
+	defer ts.Close()
+
+	c, err := NewClient("user", ts.URL, "", "")
+	if err != nil {
+		t.Fatalf("failed to create the Boskos client")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	res, err := c.AcquireWait(ctx, "t", "s", "d")
+	if err != nil {
+		t.Fatalf("failed to acquire: %v", err)
+	}
+	if res.Name != "res" {
+		t.Errorf("got resource name %v, expect res", res.Name)
+	}
+	if len(waits) != 2 {
+		t.Fatalf("expected 2 attempts, got %d", len(waits))
+	}
+	for _, wait := range waits {
+		if d, err := time.ParseDuration(wait); err != nil || d <= 0 || d > longPollTimeout {
+			t.Errorf("expected a long poll of at most %v, got %q", longPollTimeout, wait)
+		}
+	}
+}
+
+func TestLoadAdvice(t *testing.T) {
+	var testcases = []struct {
+		name       string
+		retryAfter string
+		header     string
+		expect     *common.LoadAdvice
+		expectMin  time.Duration
+		expectMax  time.Duration
+	}{
+		{
+			name:      "no advice",
+			expectMin: defaultRetryDelay,
+			expectMax: defaultRetryDelay + defaultRetryDelay/10,
+		},
+		{
+			name:       "advised retry",
+			retryAfter: "20",
+			header:     `{"type":"t","state":"s","pressure":1,"total":4,"queue_length":8,"retry_after_seconds":20}`,
+			expect:     &common.LoadAdvice{Type: "t", State: "s", Pressure: 1, Total: 4, QueueLength: 8, RetryAfterSeconds: 20},
+			expectMin:  20 * time.Second,
+			expectMax:  22 * time.Second,
+		},
+		{
+			name:       "invalid retry after",
+			retryAfter: "soon",
+			expectMin:  defaultRetryDelay,
+			expectMax:  defaultRetryDelay + defaultRetryDelay/10,
+		},
+	}
+
+	for _, tc := range testcases {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if tc.retryAfter != "" {
+				w.Header().Set("Retry-After", tc.retryAfter)
+			}
+			if tc.header != "" {
+				w.Header().Set(common.LoadAdviceHeader, tc.header)
+			}
+			http.Error(w, "", http.StatusNotFound)
+		}))
+		defer ts.Close()
+
+		c, err := NewClient("user", ts.URL, "", "")
+		if err != nil {
+			t.Fatalf("failed to create the Boskos client")
+		}
+		if _, err := c.Acquire("t", "s", "d"); err != ErrNotFound {
+			t.Errorf("Test %v, got error %v, expect %v", tc.name, err, ErrNotFound)
+		}
+		if advice := c.LoadAdvice("t"); !reflect.DeepEqual(advice, tc.expect) {
+			t.Errorf("Test %v, got advice %+v, expect %+v", tc.name, advice, tc.expect)
+		}
+		if delay := c.retryDelay("t"); delay < tc.expectMin || delay > tc.expectMax {
+			t.Errorf("Test %v, got retry delay %v, expect between %v and %v", tc.name, delay, tc.expectMin, tc.expectMax)
+		}
+	}
+}
+
+func TestTenant(t *testing.T) {
+	var testcases = []struct {
+		name   string
+		tenant string
+		expect error
+	}{
+		{
+			name:   "tenant of the type",
+			tenant: "team-a",
+		},
+		{
+			name:   "another tenant",
+			tenant: "team-b",
+			expect: ErrTenantMismatch,
+		},
+	}
+
+	for _, tc := range testcases {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if tenant := r.Header.Get(common.TenantHeader); tenant != "team-a" {
+				w.Header().Set(common.TenantHeader, "team-a")
+				http.Error(w, "", http.StatusForbidden)
+				return
+			}
+			fmt.Fprint(w, `{"type":"t","name":"res","state":"d","tenant":"team-a"}`)
+		}))
+		defer ts.Close()
+
+		c, err := NewClient("user", ts.URL, "", "")
+		if err != nil {
+			t.Fatalf("failed to create the Boskos client")
+		}
+		c.SetTenant(tc.tenant)
+		if _, err := c.Acquire("t", "s", "d"); err != tc.expect {
+			t.Errorf("Test %v, got error %v, expect %v", tc.name, err, tc.expect)
+		}
+	}
+}
+
+func TestV2API(t *testing.T) {
+	var paths []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Header().Set(common.APIVersionHeader, common.APIVersion)
+		if r.URL.Path == "/v2/acquire" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"code":"ResourceTypeNotFound","message":"no such type"}`)
+			return
+		}
+		http.Error(w, "", http.StatusNotFound)
+	}))
+	defer ts.Close()
+
+	c, err := NewClient("user", ts.URL, "", "")
+	if err != nil {
+		t.Fatalf("failed to create the Boskos client")
+	}
+	// The first request learns that the server serves the v2 API, which tells
+	// unknown types from exhausted ones.
+	if _, err := c.Acquire("t", "s", "d"); err != ErrNotFound {
+		t.Errorf("expected %v over the unversioned API, got %v", ErrNotFound, err)
+	}
+	if _, err := c.Acquire("t", "s", "d"); err != ErrTypeNotFound {
+		t.Errorf("expected %v over the v2 API, got %v", ErrTypeNotFound, err)
+	}
+	if expected := []string{"/acquire", "/v2/acquire"}; !reflect.DeepEqual(paths, expected) {
+		t.Errorf("expected requests to %v, got %v", expected, paths)
+	}
+}
+
 func TestRelease(t *testing.T) {
 	var testcases = []struct {
 		name      string
@@ -0,0 +1,36 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import "syscall"
+
+// Winsock reports refused connections with its own error codes rather than
+// the POSIX ones of the syscall package.
+const (
+	wsaeconnrefused syscall.Errno = 10061
+	wsaeconnreset   syscall.Errno = 10054
+)
+
+// isConnectionRefusedOrReset tells whether err is a refused or reset
+// connection.
+func isConnectionRefusedOrReset(err error) bool {
+	switch err {
+	case wsaeconnrefused, wsaeconnreset, syscall.ECONNREFUSED, syscall.ECONNRESET:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,461 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package fake provides a deterministic in-memory boskos client, so consumers
+// can unit-test their integration with boskos without a live server.
+package fake
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/boskos/client"
+	"sigs.k8s.io/boskos/common"
+)
+
+// DefaultPollInterval is how often the Wait methods retry by default.
+const DefaultPollInterval = 10 * time.Millisecond
+
+// Pool is an in-memory set of resources shared by fake clients. Resources are
+// handed out in the order they were added.
+type Pool struct {
+	// Now is the clock of the pool, used for last updates and resets.
+	// Defaults to time.Now.
+	Now func() time.Time
+
+	lock      sync.Mutex
+	resources []*common.Resource
+}
+
+// NewPool creates a pool holding resources.
+func NewPool(resources ...common.Resource) *Pool {
+	p := &Pool{Now: time.Now}
+	p.Add(resources...)
+	return p
+}
+
+// Add adds resources to the pool.
+func (p *Pool) Add(resources ...common.Resource) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for _, res := range resources {
+		res := copyResource(res)
+		p.resources = append(p.resources, &res)
+	}
+}
+
+// Resources returns a copy of the resources of the pool.
+func (p *Pool) Resources() []common.Resource {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	resources := make([]common.Resource, 0, len(p.resources))
+	for _, res := range p.resources {
+		resources = append(resources, copyResource(*res))
+	}
+	return resources
+}
+
+// Client returns a fake client acquiring resources of the pool for owner.
+func (p *Pool) Client(owner string) *Client {
+	return &Client{
+		pool:         p,
+		owner:        owner,
+		Sleep:        time.Sleep,
+		PollInterval: DefaultPollInterval,
+		failures:     map[string][]error{},
+		latencies:    map[string]time.Duration{},
+	}
+}
+
+func (p *Pool) get(name string) *common.Resource {
+	for _, res := range p.resources {
+		if res.Name == name {
+			return res
+		}
+	}
+	return nil
+}
+
+func copyResource(res common.Resource) common.Resource {
+	if res.UserData != nil {
+		res.UserData = common.UserDataFromMap(res.UserData.ToMap())
+	}
+	return res
+}
+
+// Call is a method called on a fake client.
+type Call struct {
+	Method string
+	Args   []interface{}
+}
+
+// Client is a fake boskos client. Failures and latencies can be scripted per
+// method, named after the methods of client.Interface.
+type Client struct {
+	// Sleep simulates latencies. Defaults to time.Sleep.
+	Sleep func(time.Duration)
+	// PollInterval is how often the Wait methods retry.
+	PollInterval time.Duration
+
+	pool  *Pool
+	owner string
+
+	lock      sync.Mutex
+	failures  map[string][]error
+	latencies map[string]time.Duration
+	calls     []Call
+}
+
+var _ client.Interface = &Client{}
+
+// FailNext makes the next calls to method return errs, one per call, without
+// doing anything else.
+func (c *Client) FailNext(method string, errs ...error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.failures[method] = append(c.failures[method], errs...)
+}
+
+// SetLatency makes every call to method sleep for latency first.
+func (c *Client) SetLatency(method string, latency time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.latencies[method] = latency
+}
+
+// Calls returns the calls made to the client, in order.
+func (c *Client) Calls() []Call {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return append([]Call(nil), c.calls...)
+}
+
+// call records a call, simulates its latency and returns its scripted failure.
+func (c *Client) call(method string, args ...interface{}) error {
+	c.lock.Lock()
+	c.calls = append(c.calls, Call{Method: method, Args: args})
+	latency := c.latencies[method]
+	var err error
+	if errs := c.failures[method]; len(errs) > 0 {
+		err, c.failures[method] = errs[0], errs[1:]
+	}
+	c.lock.Unlock()
+	if latency > 0 {
+		c.Sleep(latency)
+	}
+	return err
+}
+
+// Acquire implements client.Interface.
+func (c *Client) Acquire(rtype, state, dest string) (*common.Resource, error) {
+	if err := c.call("Acquire", rtype, state, dest); err != nil {
+		return nil, err
+	}
+	return c.acquire(rtype, state, dest)
+}
+
+// AcquireWithPriority implements client.Interface. Requests are not ranked.
+func (c *Client) AcquireWithPriority(rtype, state, dest, requestID string) (*common.Resource, error) {
+	if err := c.call("AcquireWithPriority", rtype, state, dest, requestID); err != nil {
+		return nil, err
+	}
+	return c.acquire(rtype, state, dest)
+}
+
+// AcquireWait implements client.Interface.
+func (c *Client) AcquireWait(ctx context.Context, rtype, state, dest string) (*common.Resource, error) {
+	if ctx == nil {
+		return nil, client.ErrContextRequired
+	}
+	if err := c.call("AcquireWait", rtype, state, dest); err != nil {
+		return nil, err
+	}
+	var res *common.Resource
+	err := c.wait(ctx, func() (err error) {
+		res, err = c.acquire(rtype, state, dest)
+		return err
+	})
+	return res, err
+}
+
+func (c *Client) acquire(rtype, state, dest string) (*common.Resource, error) {
+	p := c.pool
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for _, res := range p.resources {
+		if res.Type == rtype && res.State == state && res.Owner == "" {
+			res.Owner = c.owner
+			res.State = dest
+			res.LastUpdate = p.Now()
+			acquired := copyResource(*res)
+			return &acquired, nil
+		}
+	}
+	return nil, client.ErrNotFound
+}
+
+// AcquireByState implements client.Interface. Either all the named resources
+// are acquired, or none.
+func (c *Client) AcquireByState(state, dest string, names []string) ([]common.Resource, error) {
+	if err := c.call("AcquireByState", state, dest, names); err != nil {
+		return nil, err
+	}
+	return c.acquireByState(state, dest, names)
+}
+
+// AcquireByStateWait implements client.Interface.
+func (c *Client) AcquireByStateWait(ctx context.Context, state, dest string, names []string) ([]common.Resource, error) {
+	if ctx == nil {
+		return nil, client.ErrContextRequired
+	}
+	if err := c.call("AcquireByStateWait", state, dest, names); err != nil {
+		return nil, err
+	}
+	var resources []common.Resource
+	err := c.wait(ctx, func() (err error) {
+		resources, err = c.acquireByState(state, dest, names)
+		return err
+	})
+	return resources, err
+}
+
+func (c *Client) acquireByState(state, dest string, names []string) ([]common.Resource, error) {
+	p := c.pool
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for _, name := range names {
+		if res := p.get(name); res == nil || res.State != state || res.Owner != "" {
+			return nil, client.ErrNotFound
+		}
+	}
+	var resources []common.Resource
+	for _, name := range names {
+		res := p.get(name)
+		res.Owner = c.owner
+		res.State = dest
+		res.LastUpdate = p.Now()
+		resources = append(resources, copyResource(*res))
+	}
+	return resources, nil
+}
+
+// wait retries work until it stops returning client.ErrNotFound or ctx is done.
+func (c *Client) wait(ctx context.Context, work func() error) error {
+	for {
+		err := work()
+		if err != client.ErrNotFound {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(c.PollInterval):
+		}
+	}
+}
+
+// Release implements client.Interface.
+func (c *Client) Release(name, dest string) error {
+	if err := c.call("Release", name, dest); err != nil {
+		return err
+	}
+	return c.release(name, dest)
+}
+
+// ReleaseOne implements client.Interface.
+func (c *Client) ReleaseOne(name, dest string) error {
+	if err := c.call("ReleaseOne", name, dest); err != nil {
+		return err
+	}
+	return c.release(name, dest)
+}
+
+// ReleaseAll implements client.Interface.
+func (c *Client) ReleaseAll(dest string) error {
+	if err := c.call("ReleaseAll", dest); err != nil {
+		return err
+	}
+	names := c.owned()
+	if len(names) == 0 {
+		return fmt.Errorf("no holding resource")
+	}
+	for _, name := range names {
+		if err := c.release(name, dest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Client) release(name, dest string) error {
+	p := c.pool
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	res := p.get(name)
+	if res == nil {
+		return fmt.Errorf("no resource name %v", name)
+	}
+	if res.Owner != c.owner {
+		return fmt.Errorf("owner mismatch request by %s, currently owned by %s", c.owner, res.Owner)
+	}
+	res.Owner = ""
+	res.State = dest
+	res.LastUpdate = p.Now()
+	return nil
+}
+
+// owned returns the names of the resources held by the client.
+func (c *Client) owned() []string {
+	p := c.pool
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	var names []string
+	for _, res := range p.resources {
+		if res.Owner == c.owner {
+			names = append(names, res.Name)
+		}
+	}
+	return names
+}
+
+// Update implements client.Interface.
+func (c *Client) Update(name, state string, userData *common.UserData) error {
+	if err := c.call("Update", name, state, userData); err != nil {
+		return err
+	}
+	return c.update(name, state, userData)
+}
+
+// UpdateOne implements client.Interface.
+func (c *Client) UpdateOne(name, state string, userData *common.UserData) error {
+	if err := c.call("UpdateOne", name, state, userData); err != nil {
+		return err
+	}
+	return c.update(name, state, userData)
+}
+
+// UpdateAll implements client.Interface.
+func (c *Client) UpdateAll(state string) error {
+	if err := c.call("UpdateAll", state); err != nil {
+		return err
+	}
+	names := c.owned()
+	if len(names) == 0 {
+		return fmt.Errorf("no holding resource")
+	}
+	for _, name := range names {
+		if err := c.update(name, state, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SyncAll implements client.Interface.
+func (c *Client) SyncAll() error {
+	if err := c.call("SyncAll"); err != nil {
+		return err
+	}
+	p := c.pool
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for _, res := range p.resources {
+		if res.Owner == c.owner {
+			res.LastUpdate = p.Now()
+		}
+	}
+	return nil
+}
+
+func (c *Client) update(name, state string, userData *common.UserData) error {
+	p := c.pool
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	res := p.get(name)
+	if res == nil {
+		return fmt.Errorf("no resource name %v", name)
+	}
+	if res.Owner != c.owner {
+		return fmt.Errorf("owner mismatch request by %s, currently owned by %s", c.owner, res.Owner)
+	}
+	if res.State != state {
+		return fmt.Errorf("state mismatch - expected %v, current %v", state, res.State)
+	}
+	if userData != nil {
+		if res.UserData == nil {
+			res.UserData = &common.UserData{}
+		}
+		res.UserData.Update(userData)
+	}
+	res.LastUpdate = p.Now()
+	return nil
+}
+
+// Reset implements client.Interface.
+func (c *Client) Reset(rtype, state string, expire time.Duration, dest string) (map[string]string, error) {
+	if err := c.call("Reset", rtype, state, expire, dest); err != nil {
+		return nil, err
+	}
+	p := c.pool
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	reset := map[string]string{}
+	for _, res := range p.resources {
+		if res.Type != rtype || res.State != state || res.Owner == "" || p.Now().Sub(res.LastUpdate) < expire {
+			continue
+		}
+		reset[res.Name] = res.Owner
+		res.Owner = ""
+		res.State = dest
+	}
+	return reset, nil
+}
+
+// Metric implements client.Interface.
+func (c *Client) Metric(rtype string) (common.Metric, error) {
+	if err := c.call("Metric", rtype); err != nil {
+		return common.Metric{}, err
+	}
+	p := c.pool
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	metric := common.NewMetric(rtype)
+	for _, res := range p.resources {
+		if res.Type == rtype {
+			metric.Current[res.State]++
+			metric.Owners[res.Owner]++
+		}
+	}
+	if len(metric.Current) == 0 {
+		return metric, client.ErrNotFound
+	}
+	return metric, nil
+}
+
+// HasResource implements client.Interface.
+func (c *Client) HasResource() bool {
+	return len(c.owned()) > 0
+}
+
+// Owned returns the names of the resources held by the client, sorted.
+func (c *Client) Owned() []string {
+	names := c.owned()
+	sort.Strings(names)
+	return names
+}
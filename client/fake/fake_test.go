@@ -0,0 +1,137 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"sigs.k8s.io/boskos/client"
+	"sigs.k8s.io/boskos/common"
+)
+
+func TestAcquireAndRelease(t *testing.T) {
+	pool := NewPool(
+		common.NewResource("res-1", "t", common.Free, "", time.Time{}),
+		common.NewResource("res-2", "t", common.Free, "", time.Time{}),
+	)
+	alice, bob := pool.Client("alice"), pool.Client("bob")
+
+	for _, expected := range []string{"res-1", "res-2"} {
+		res, err := alice.Acquire("t", common.Free, common.Busy)
+		if err != nil {
+			t.Fatalf("failed to acquire: %v", err)
+		}
+		if res.Name != expected || res.Owner != "alice" || res.State != common.Busy {
+			t.Errorf("expected to acquire %s, got %+v", expected, res)
+		}
+	}
+	if _, err := bob.Acquire("t", common.Free, common.Busy); err != client.ErrNotFound {
+		t.Errorf("expected %v, got %v", client.ErrNotFound, err)
+	}
+	if err := bob.Release("res-1", common.Dirty); err == nil {
+		t.Error("expected releasing a resource of another owner to fail")
+	}
+	if !alice.HasResource() || bob.HasResource() {
+		t.Errorf("expected only alice to hold resources, got %v and %v", alice.Owned(), bob.Owned())
+	}
+	if err := alice.ReleaseAll(common.Dirty); err != nil {
+		t.Fatalf("failed to release all: %v", err)
+	}
+	metric, err := alice.Metric("t")
+	if err != nil {
+		t.Fatalf("failed to get metric: %v", err)
+	}
+	if expected := map[string]int{common.Dirty: 2}; !reflect.DeepEqual(metric.Current, expected) {
+		t.Errorf("expected states %v, got %v", expected, metric.Current)
+	}
+}
+
+func TestScriptedFailuresAndLatencies(t *testing.T) {
+	pool := NewPool(common.NewResource("res", "t", common.Free, "", time.Time{}))
+	c := pool.Client("owner")
+	var slept []time.Duration
+	c.Sleep = func(d time.Duration) { slept = append(slept, d) }
+	broken := errors.New("broken")
+	c.FailNext("Acquire", broken)
+	c.SetLatency("Acquire", time.Second)
+
+	if _, err := c.Acquire("t", common.Free, common.Busy); err != broken {
+		t.Errorf("expected the scripted failure, got %v", err)
+	}
+	if _, err := c.Acquire("t", common.Free, common.Busy); err != nil {
+		t.Errorf("expected the failure to be consumed, got %v", err)
+	}
+	if expected := []time.Duration{time.Second, time.Second}; !reflect.DeepEqual(slept, expected) {
+		t.Errorf("expected latencies %v, got %v", expected, slept)
+	}
+	if calls := c.Calls(); len(calls) != 2 || calls[0].Method != "Acquire" {
+		t.Errorf("expected two recorded calls to Acquire, got %v", calls)
+	}
+}
+
+func TestAcquireByStateWait(t *testing.T) {
+	pool := NewPool(
+		common.NewResource("res-1", "t", common.Free, "", time.Time{}),
+		common.NewResource("res-2", "t", common.Busy, "other", time.Time{}),
+	)
+	c := pool.Client("owner")
+	c.PollInterval = time.Millisecond
+
+	if _, err := c.AcquireByState(common.Free, common.Busy, []string{"res-1", "res-2"}); err != client.ErrNotFound {
+		t.Fatalf("expected %v, got %v", client.ErrNotFound, err)
+	}
+	if owned := c.Owned(); len(owned) != 0 {
+		t.Fatalf("expected nothing to be acquired, got %v", owned)
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		if err := pool.Client("other").Release("res-2", common.Free); err != nil {
+			t.Errorf("failed to release: %v", err)
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	resources, err := c.AcquireByStateWait(ctx, common.Free, common.Busy, []string{"res-1", "res-2"})
+	if err != nil {
+		t.Fatalf("failed to acquire: %v", err)
+	}
+	if len(resources) != 2 {
+		t.Errorf("expected both resources, got %v", resources)
+	}
+}
+
+func TestReset(t *testing.T) {
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	pool := NewPool(
+		common.NewResource("stale", "t", common.Busy, "gone", now.Add(-time.Hour)),
+		common.NewResource("fresh", "t", common.Busy, "alive", now),
+	)
+	pool.Now = func() time.Time { return now }
+
+	reset, err := pool.Client("reaper").Reset("t", common.Busy, 30*time.Minute, common.Dirty)
+	if err != nil {
+		t.Fatalf("failed to reset: %v", err)
+	}
+	if expected := map[string]string{"stale": "gone"}; !reflect.DeepEqual(reset, expected) {
+		t.Errorf("expected %v to be reset, got %v", expected, reset)
+	}
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+// ErrInvalidImport is returned by ImportResources along with the summary
+// listing the invalid resources, none of which were imported.
+var ErrInvalidImport = errors.New("invalid resources to import")
+
+// ImportResources creates resources of the static types of the config outside
+// of it, skipping the ones which already exist. Nothing is created on a dry
+// run, which only validates the resources.
+func (c *Client) ImportResources(resources []common.ImportedResource, dryRun bool) (*common.ImportSummary, error) {
+	body, err := json.Marshal(resources)
+	if err != nil {
+		return nil, err
+	}
+	values := url.Values{}
+	values.Set("dry_run", strconv.FormatBool(dryRun))
+
+	var summary common.ImportSummary
+	work := func(retriedErrs *[]error) (bool, error) {
+		resp, err := c.httpPost("/import", values, "application/json", bytes.NewReader(body))
+		if err != nil {
+			*retriedErrs = append(*retriedErrs, err)
+			return false, nil
+		}
+		defer resp.Body.Close()
+
+		switch resp.StatusCode {
+		case http.StatusOK:
+			if err := json.NewDecoder(resp.Body).Decode(&summary); err != nil {
+				return false, err
+			}
+			return true, nil
+		case http.StatusBadRequest:
+			if err := json.NewDecoder(resp.Body).Decode(&summary); err != nil {
+				return false, fmt.Errorf("status %s importing resources", resp.Status)
+			}
+			return false, ErrInvalidImport
+		default:
+			*retriedErrs = append(*retriedErrs, fmt.Errorf("status %s, status code %v importing resources", resp.Status, resp.StatusCode))
+			return false, nil
+		}
+	}
+
+	if err := retry(work); err != nil {
+		if err == ErrInvalidImport {
+			return &summary, err
+		}
+		return nil, err
+	}
+	return &summary, nil
+}
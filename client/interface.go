@@ -0,0 +1,47 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"time"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+// Interface is the lease API of the boskos client. Consumers depending on it
+// instead of *Client can unit-test their integration with the fake client of
+// the sigs.k8s.io/boskos/client/fake package.
+type Interface interface {
+	Acquire(rtype, state, dest string) (*common.Resource, error)
+	AcquireWithPriority(rtype, state, dest, requestID string) (*common.Resource, error)
+	AcquireWait(ctx context.Context, rtype, state, dest string) (*common.Resource, error)
+	AcquireByState(state, dest string, names []string) ([]common.Resource, error)
+	AcquireByStateWait(ctx context.Context, state, dest string, names []string) ([]common.Resource, error)
+	Release(name, dest string) error
+	ReleaseOne(name, dest string) error
+	ReleaseAll(dest string) error
+	Update(name, state string, userData *common.UserData) error
+	UpdateOne(name, state string, userData *common.UserData) error
+	UpdateAll(state string) error
+	SyncAll() error
+	Reset(rtype, state string, expire time.Duration, dest string) (map[string]string, error)
+	Metric(rtype string) (common.Metric, error)
+	HasResource() bool
+}
+
+var _ Interface = &Client{}
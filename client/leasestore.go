@@ -0,0 +1,106 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/storage"
+)
+
+// SetLeaseFile makes the client record the resources it holds in leaseFile,
+// so that a consumer process restarted with the same owner and lease file
+// re-attaches to the resources of its previous run instead of leaking them
+// until the reaper takes them back. The resources recorded by the previous
+// run are re-attached if boskos confirms they are still held by the owner, in
+// the same state, which also heartbeats them. The others are forgotten. The
+// re-attached resources are returned, and heartbeated by SyncAll and released
+// by ReleaseAll like the resources acquired since. It must be called before
+// the client is used.
+func (c *Client) SetLeaseFile(leaseFile string) ([]common.Resource, error) {
+	leases, err := storage.NewFileStorage(leaseFile)
+	if err != nil {
+		return nil, err
+	}
+	recorded, err := leases.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var attached []common.Resource
+	for _, r := range recorded {
+		held, err := c.reattach(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to re-attach resource %s: %w", r.Name, err)
+		}
+		if !held {
+			logrus.WithFields(logrus.Fields{"name": r.Name, "state": r.State}).Warning("Resource of the lease file is no longer held, forgetting it")
+			if err := leases.Delete(r.Name); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		attached = append(attached, r)
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.storage = leases
+	return attached, nil
+}
+
+// reattach heartbeats r, returning whether it is still held by the owner of
+// the client in its recorded state.
+func (c *Client) reattach(r common.Resource) (bool, error) {
+	values := url.Values{}
+	values.Set("name", r.Name)
+	values.Set("owner", c.owner)
+	values.Set("state", r.State)
+
+	var held bool
+	work := func(retriedErrs *[]error) (bool, error) {
+		resp, err := c.httpPost("/update", values, "", nil)
+		if err != nil {
+			*retriedErrs = append(*retriedErrs, err)
+			return false, nil
+		}
+		defer resp.Body.Close()
+
+		switch resp.StatusCode {
+		case http.StatusOK:
+			held = true
+			return true, nil
+		case http.StatusUnauthorized, http.StatusNotFound, http.StatusConflict:
+			// Reaped and acquired by another owner, deleted, or moved out of
+			// the recorded state, e.g. by the reaper.
+			return true, nil
+		default:
+			*retriedErrs = append(*retriedErrs, fmt.Errorf("status %s, status code %v updating %s", resp.Status, resp.StatusCode, r.Name))
+			return false, nil
+		}
+	}
+
+	if err := retry(work); err != nil {
+		return false, err
+	}
+	return held, nil
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/storage"
+)
+
+func TestSetLeaseFile(t *testing.T) {
+	var heartbeats []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/update" || r.URL.Query().Get("owner") != "user" {
+			t.Errorf("unexpected request %v", r.URL)
+		}
+		name := r.URL.Query().Get("name")
+		heartbeats = append(heartbeats, name)
+		if name == "reaped" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer ts.Close()
+
+	leaseFile := filepath.Join(t.TempDir(), "leases.json")
+	previous, err := storage.NewFileStorage(leaseFile)
+	if err != nil {
+		t.Fatalf("failed to create the lease file: %v", err)
+	}
+	held := common.Resource{Name: "held", Type: "t", State: common.Busy, Owner: "user"}
+	for _, r := range []common.Resource{held, {Name: "reaped", Type: "t", State: common.Busy, Owner: "user"}} {
+		if err := previous.Add(r); err != nil {
+			t.Fatalf("failed to record %s: %v", r.Name, err)
+		}
+	}
+
+	c, err := NewClient("user", ts.URL, "", "")
+	if err != nil {
+		t.Fatalf("failed to create the Boskos client")
+	}
+	attached, err := c.SetLeaseFile(leaseFile)
+	if err != nil {
+		t.Fatalf("failed to set the lease file: %v", err)
+	}
+	if !reflect.DeepEqual(attached, []common.Resource{held}) {
+		t.Errorf("expected the held resource to be re-attached, got %v", attached)
+	}
+	if len(heartbeats) != 2 {
+		t.Errorf("expected both recorded resources to be checked, got %v", heartbeats)
+	}
+
+	if err := c.SyncAll(); err != nil {
+		t.Errorf("failed to heartbeat the re-attached resource: %v", err)
+	}
+	if heartbeats[len(heartbeats)-1] != "held" {
+		t.Errorf("expected the re-attached resource to be heartbeated, got %v", heartbeats)
+	}
+
+	recorded, err := storage.NewFileStorage(leaseFile)
+	if err != nil {
+		t.Fatalf("failed to reload the lease file: %v", err)
+	}
+	if resources, _ := recorded.List(); !reflect.DeepEqual(resources, []common.Resource{held}) {
+		t.Errorf("expected the reaped resource to be forgotten, got %v", resources)
+	}
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+var (
+	// ErrLockHeld is returned by AcquireLock when another owner holds the lock.
+	ErrLockHeld = errors.New("lock held by another owner")
+	// ErrLockLost is returned by RunWithLock when the lock could not be
+	// renewed while the function was running.
+	ErrLockLost = errors.New("lock lost")
+)
+
+// AcquireLock takes the named lock for the client owner until ttl elapses, or
+// renews it if the owner already holds it. ErrLockHeld is returned if another
+// owner holds the lock. Locks are meant for cleanup components and other tools
+// that must not run more than one instance at a time, see RunWithLock.
+func (c *Client) AcquireLock(name string, ttl time.Duration) (*common.Lock, error) {
+	values := url.Values{}
+	values.Set("name", name)
+	values.Set("owner", c.owner)
+	if ttl > 0 {
+		values.Set("ttl", ttl.String())
+	}
+
+	var lock common.Lock
+	work := func(retriedErrs *[]error) (bool, error) {
+		resp, err := c.httpPost("/lock", values, "", nil)
+		if err != nil {
+			*retriedErrs = append(*retriedErrs, err)
+			return false, nil
+		}
+		defer resp.Body.Close()
+
+		switch resp.StatusCode {
+		case http.StatusOK:
+			if err := json.NewDecoder(resp.Body).Decode(&lock); err != nil {
+				return false, err
+			}
+			return true, nil
+		case http.StatusConflict:
+			return false, ErrLockHeld
+		default:
+			*retriedErrs = append(*retriedErrs, fmt.Errorf("status %s, status code %v acquiring lock %s", resp.Status, resp.StatusCode, name))
+			return false, nil
+		}
+	}
+
+	if err := retry(work); err != nil {
+		return nil, err
+	}
+	return &lock, nil
+}
+
+// ReleaseLock releases the named lock held by the client owner.
+func (c *Client) ReleaseLock(name string) error {
+	values := url.Values{}
+	values.Set("name", name)
+	values.Set("owner", c.owner)
+
+	work := func(retriedErrs *[]error) (bool, error) {
+		resp, err := c.httpPost("/unlock", values, "", nil)
+		if err != nil {
+			*retriedErrs = append(*retriedErrs, err)
+			return false, nil
+		}
+		defer resp.Body.Close()
+
+		switch resp.StatusCode {
+		case http.StatusOK:
+			return true, nil
+		case http.StatusUnauthorized:
+			return false, ErrLockHeld
+		default:
+			*retriedErrs = append(*retriedErrs, fmt.Errorf("status %s, status code %v releasing lock %s", resp.Status, resp.StatusCode, name))
+			return false, nil
+		}
+	}
+
+	return retry(work)
+}
+
+// RunWithLock blocks until the named lock is acquired or ctx is done, then
+// runs fn while renewing the lock every third of ttl. The context passed to fn
+// is cancelled if a renewal fails, in which case ErrLockLost is returned once
+// fn returns. The lock is released when fn returns.
+func (c *Client) RunWithLock(ctx context.Context, name string, ttl time.Duration, fn func(context.Context) error) error {
+	if ctx == nil {
+		return ErrContextRequired
+	}
+	if ttl <= 0 {
+		return fmt.Errorf("invalid ttl %v for lock %s: must be positive", ttl, name)
+	}
+	for {
+		_, err := c.AcquireLock(name, ttl)
+		if err == nil {
+			break
+		}
+		if err != ErrLockHeld {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(3 * time.Second):
+		}
+	}
+
+	lockCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var lost bool
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-lockCtx.Done():
+				return
+			case <-ticker.C:
+				if _, err := c.AcquireLock(name, ttl); err != nil {
+					logrus.WithError(err).Errorf("failed to renew lock %s", name)
+					lost = true
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	err := fn(lockCtx)
+	cancel()
+	// A renewal in flight must not take the lock again once released.
+	wg.Wait()
+	if releaseErr := c.ReleaseLock(name); releaseErr != nil {
+		logrus.WithError(releaseErr).Warningf("failed to release lock %s", name)
+	}
+	if lost {
+		return ErrLockLost
+	}
+	return err
+}
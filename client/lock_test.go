@@ -0,0 +1,122 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRunWithLock(t *testing.T) {
+	// Don't actually sleep in the tests
+	oldSleepFunc := SleepFunc
+	SleepFunc = func(_ time.Duration) {}
+	defer func() { SleepFunc = oldSleepFunc }()
+
+	testCases := []struct {
+		name string
+		// held is whether the lock is held by another owner.
+		held bool
+		// renewals is how many renewals succeed before the lock is lost, or
+		// -1 if it is never lost.
+		renewals   int
+		expectRun  bool
+		expectErr  error
+		expectFree bool
+	}{
+		{
+			name:       "lock held by another owner",
+			held:       true,
+			expectErr:  ErrLockHeld,
+			expectFree: false,
+		},
+		{
+			name:       "lock free",
+			renewals:   -1,
+			expectRun:  true,
+			expectFree: true,
+		},
+		{
+			name:       "lock lost",
+			renewals:   1,
+			expectRun:  true,
+			expectErr:  ErrLockLost,
+			expectFree: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var lock sync.Mutex
+			var acquired, released bool
+			var renewals int
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				lock.Lock()
+				defer lock.Unlock()
+				switch r.URL.Path {
+				case "/lock":
+					if tc.held || (acquired && tc.renewals >= 0 && renewals >= tc.renewals) {
+						http.Error(w, "held", http.StatusConflict)
+						return
+					}
+					if acquired {
+						renewals++
+					}
+					acquired = true
+					w.Write([]byte(`{"name":"l","owner":"user","expires":"2021-01-01T00:00:00Z"}`))
+				case "/unlock":
+					released = true
+				}
+			}))
+			defer ts.Close()
+
+			c, err := NewClient("user", ts.URL, "", "")
+			if err != nil {
+				t.Fatalf("failed to create the Boskos client")
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			if tc.held {
+				// Do not wait for the lock to be released.
+				cancel()
+			}
+			defer cancel()
+
+			var ran bool
+			err = c.RunWithLock(ctx, "l", 30*time.Millisecond, func(ctx context.Context) error {
+				ran = true
+				if tc.renewals < 0 {
+					time.Sleep(50 * time.Millisecond)
+					return nil
+				}
+				<-ctx.Done()
+				return ctx.Err()
+			})
+			if err != tc.expectErr {
+				t.Errorf("expected error %v, got %v", tc.expectErr, err)
+			}
+			if ran != tc.expectRun {
+				t.Errorf("expected the function to run: %t, got %t", tc.expectRun, ran)
+			}
+			if released != tc.expectFree {
+				t.Errorf("expected the lock to be released: %t, got %t", tc.expectFree, released)
+			}
+		})
+	}
+}
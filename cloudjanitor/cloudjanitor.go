@@ -0,0 +1,157 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package cloudjanitor runs the sweepers of the cloud providers as
+// subcommands of a single binary, sharing the flags which behave the same
+// for every provider: the TTL, dry runs, exclusions and the report of the
+// swept resources.
+package cloudjanitor
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultTTL is how long resources live before being swept by default.
+const DefaultTTL = 24 * time.Hour
+
+// Options are the flags shared by all the providers.
+type Options struct {
+	// TTL is how long resources live before being swept. 0 sweeps all the
+	// resources which are not protected.
+	TTL time.Duration
+	// DryRun only reports the resources which would be swept.
+	DryRun bool
+	// ExclusionsFile, if set, is a YAML list of exclusions protecting
+	// resources from the sweep, see resources.ParseExclusions.
+	ExclusionsFile string
+	// ReportPath, if set, is where the Report of the sweep is written, or
+	// stdout if -.
+	ReportPath string
+	LogLevel   string
+}
+
+// AddFlags registers the shared flags in fs.
+func (o *Options) AddFlags(fs *flag.FlagSet) {
+	fs.DurationVar(&o.TTL, "ttl", DefaultTTL, "Maximum time before attempting to delete a resource. Set to 0s to nuke all non-default resources.")
+	fs.BoolVar(&o.DryRun, "dry-run", false, "If set, don't delete any resources, only log and report what would be done")
+	fs.StringVar(&o.ExclusionsFile, "exclusions-file", "", "If set, never delete the resources protected by the exclusions in this YAML file")
+	fs.StringVar(&o.ReportPath, "report", "", "If set, write a JSON report of the swept resources to this file, or to stdout if -")
+	fs.StringVar(&o.LogLevel, "log-level", "info", fmt.Sprintf("Log level is one of %v.", logrus.AllLevels))
+}
+
+// Provider sweeps the resources of a cloud provider.
+type Provider interface {
+	// Name is the subcommand running the provider, e.g. aws.
+	Name() string
+	// AddFlags registers the flags specific to the provider in fs.
+	AddFlags(fs *flag.FlagSet)
+	// Sweep deletes the resources which outlived opts.TTL, recording them in
+	// report.
+	Sweep(ctx context.Context, opts Options, report *Report) error
+}
+
+// Report lists the resources swept by a provider.
+type Report struct {
+	Provider string    `json:"provider"`
+	DryRun   bool      `json:"dry_run"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	// Swept are the resources deleted, or which would be deleted on a dry
+	// run, as identified by the provider, e.g. by ARN.
+	Swept []string `json:"swept"`
+	// Error is set if the sweep failed, in which case Swept may be partial.
+	Error string `json:"error,omitempty"`
+}
+
+// Run runs the provider named by the first of args, parsing the rest as its
+// flags, and returns the exit code of the binary.
+func Run(ctx context.Context, args []string, providers ...Provider) int {
+	byName := map[string]Provider{}
+	var names []string
+	for _, p := range providers {
+		byName[p.Name()] = p
+		names = append(names, p.Name())
+	}
+	sort.Strings(names)
+	usage := fmt.Sprintf("usage: cloud-janitor <%s> [flags]", strings.Join(names, "|"))
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+	provider, ok := byName[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown provider %q\n%s\n", args[0], usage)
+		return 2
+	}
+
+	fs := flag.NewFlagSet(provider.Name(), flag.ContinueOnError)
+	opts := Options{}
+	opts.AddFlags(fs)
+	provider.AddFlags(fs)
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	level, err := logrus.ParseLevel(opts.LogLevel)
+	if err != nil {
+		logrus.WithError(err).Error("invalid log level specified")
+		return 2
+	}
+	logrus.SetLevel(level)
+
+	report := &Report{Provider: provider.Name(), DryRun: opts.DryRun, Started: time.Now(), Swept: []string{}}
+	sweepErr := provider.Sweep(ctx, opts, report)
+	report.Finished = time.Now()
+	sort.Strings(report.Swept)
+	if sweepErr != nil {
+		report.Error = sweepErr.Error()
+		logrus.WithError(sweepErr).Errorf("Failed to sweep the %s resources", provider.Name())
+	} else {
+		logrus.Infof("swept %d %s resources", len(report.Swept), provider.Name())
+	}
+	if opts.ReportPath != "" {
+		if err := writeReport(report, opts.ReportPath); err != nil {
+			logrus.WithError(err).Error("Failed to write the report")
+			return 1
+		}
+	}
+	if sweepErr != nil {
+		return 1
+	}
+	return 0
+}
+
+func writeReport(report *Report, path string) error {
+	b, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	if path == "-" {
+		_, err := os.Stdout.Write(b)
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0644)
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudjanitor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type fakeProvider struct {
+	name    string
+	project string
+	opts    *Options
+	swept   []string
+	err     error
+}
+
+func (p *fakeProvider) Name() string {
+	return p.name
+}
+
+func (p *fakeProvider) AddFlags(fs *flag.FlagSet) {
+	fs.StringVar(&p.project, "project", "", "project to sweep")
+}
+
+func (p *fakeProvider) Sweep(_ context.Context, opts Options, report *Report) error {
+	p.opts = &opts
+	report.Swept = append(report.Swept, p.swept...)
+	return p.err
+}
+
+func TestRun(t *testing.T) {
+	testCases := []struct {
+		name         string
+		args         []string
+		err          error
+		expectCode   int
+		expectOpts   *Options
+		expectReport *Report
+	}{
+		{
+			name:       "shared and provider flags",
+			args:       []string{"fake", "--ttl=2h", "--dry-run", "--exclusions-file=exclusions.yaml", "--project=p"},
+			expectOpts: &Options{TTL: 2 * time.Hour, DryRun: true, ExclusionsFile: "exclusions.yaml", LogLevel: "info"},
+		},
+		{
+			name:         "report",
+			args:         []string{"fake", "--report=REPORT"},
+			expectOpts:   &Options{TTL: DefaultTTL, ReportPath: "REPORT", LogLevel: "info"},
+			expectReport: &Report{Provider: "fake", Swept: []string{"a", "b"}},
+		},
+		{
+			name:         "failed sweep",
+			args:         []string{"fake", "--report=REPORT"},
+			err:          errors.New("no credentials"),
+			expectCode:   1,
+			expectOpts:   &Options{TTL: DefaultTTL, ReportPath: "REPORT", LogLevel: "info"},
+			expectReport: &Report{Provider: "fake", Swept: []string{"a", "b"}, Error: "no credentials"},
+		},
+		{
+			name:       "no provider",
+			expectCode: 2,
+		},
+		{
+			name:       "unknown provider",
+			args:       []string{"azure"},
+			expectCode: 2,
+		},
+		{
+			name:       "unknown flag",
+			args:       []string{"fake", "--region=us-east-1"},
+			expectCode: 2,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			reportPath := filepath.Join(t.TempDir(), "report.json")
+			for idx, arg := range tc.args {
+				if arg == "--report=REPORT" {
+					tc.args[idx] = "--report=" + reportPath
+				}
+			}
+			if tc.expectOpts != nil && tc.expectOpts.ReportPath != "" {
+				tc.expectOpts.ReportPath = reportPath
+			}
+			p := &fakeProvider{name: "fake", swept: []string{"b", "a"}, err: tc.err}
+			if code := Run(context.Background(), tc.args, p); code != tc.expectCode {
+				t.Errorf("expected exit code %d, got %d", tc.expectCode, code)
+			}
+			if !reflect.DeepEqual(tc.expectOpts, p.opts) {
+				t.Errorf("expected options %+v, got %+v", tc.expectOpts, p.opts)
+			}
+			if tc.expectReport == nil {
+				return
+			}
+			b, err := ioutil.ReadFile(reportPath)
+			if err != nil {
+				t.Fatalf("failed to read the report: %v", err)
+			}
+			var report Report
+			if err := json.Unmarshal(b, &report); err != nil {
+				t.Fatalf("failed to unmarshal the report: %v", err)
+			}
+			report.Started, report.Finished = time.Time{}, time.Time{}
+			if !reflect.DeepEqual(*tc.expectReport, report) {
+				t.Errorf("expected report %+v, got %+v", *tc.expectReport, report)
+			}
+		})
+	}
+}
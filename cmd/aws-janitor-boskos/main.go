@@ -40,6 +40,7 @@ import (
 	"sigs.k8s.io/boskos/client"
 	"sigs.k8s.io/boskos/common"
 	awsboskos "sigs.k8s.io/boskos/common/aws"
+	"sigs.k8s.io/boskos/common/logging"
 )
 
 var (
@@ -54,13 +55,16 @@ var (
 	logLevel           = flag.String("log-level", "info", fmt.Sprintf("Log level is one of %v.", logrus.AllLevels))
 	dryRun             = flag.Bool("dry-run", false, "If set, don't delete any resources, only log what would be done")
 	ttlTagKey          = flag.String("ttl-tag-key", "", "If set, allow resources to use a tag with this key to override TTL")
+	exclusionsFile     = flag.String("exclusions-file", "", "If set, never delete the resources protected by the exclusions in this YAML file, which is reloaded when it changes")
 
 	excludeTags common.CommaSeparatedStrings
 	includeTags common.CommaSeparatedStrings
 	excludeTM   resources.TagMatcher
 	includeTM   resources.TagMatcher
+	exclusions  *resources.Exclusions
 
 	instrumentationOptions prowflagutil.InstrumentationOptions
+	loggingOptions         logging.Options
 
 	cleaningTimeHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
 		Name:        "aws_janitor_boskos_cleaning_time_seconds",
@@ -91,7 +95,7 @@ func init() {
 
 func main() {
 	logrusutil.ComponentInit()
-	for _, o := range []flagutil.OptionGroup{&instrumentationOptions} {
+	for _, o := range []flagutil.OptionGroup{&instrumentationOptions, &loggingOptions} {
 		o.AddFlags(flag.CommandLine)
 	}
 	flag.Parse()
@@ -102,11 +106,12 @@ func main() {
 	}
 	logrus.SetLevel(level)
 
-	for _, o := range []flagutil.OptionGroup{&instrumentationOptions} {
+	for _, o := range []flagutil.OptionGroup{&instrumentationOptions, &loggingOptions} {
 		if err := o.Validate(false); err != nil {
 			logrus.Fatalf("Invalid options: %v", err)
 		}
 	}
+	loggingOptions.Configure(level)
 	prowmetrics.ExposeMetrics("aws-janitor-boskos", config.PushGateway{}, instrumentationOptions.MetricsPort)
 
 	if d, err := time.ParseDuration(*sweepSleep); err != nil {
@@ -129,6 +134,12 @@ func main() {
 		logrus.Fatalf("Error parsing --include-tags: %v", err)
 	}
 
+	if *exclusionsFile != "" {
+		if exclusions, err = resources.LoadExclusions(*exclusionsFile); err != nil {
+			logrus.Fatalf("Error loading --exclusions-file: %v", err)
+		}
+	}
+
 	boskos, err := client.NewClient("AWSJanitor", *boskosURL, *username, *passwordFile)
 	if err != nil {
 		logrus.WithError(err).Fatal("unable to create a Boskos client")
@@ -154,7 +165,7 @@ func run(boskos *client.Client) error {
 					collectMetric(startProcess, res.Name, "failed-clean")
 					return errors.Wrapf(err, "Couldn't clean resource %q", res.Name)
 				}
-				if err := boskos.ReleaseOne(res.Name, common.Free); err != nil {
+				if err := boskos.ReleaseCleaned(res.Name, common.Free, time.Since(startProcess)); err != nil {
 					collectMetric(startProcess, res.Name, "failed-release")
 					return errors.Wrapf(err, "Failed to release resoures %q", res.Name)
 				}
@@ -186,6 +197,7 @@ func cleanResource(res *common.Resource) error {
 		ExcludeTags: excludeTM,
 		IncludeTags: includeTM,
 		TTLTagKey:   *ttlTagKey,
+		Exclusions:  exclusions,
 	}
 
 	logrus.WithField("name", res.Name).Info("beginning cleaning")
@@ -0,0 +1,98 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"sigs.k8s.io/boskos/aws-janitor/account"
+	"sigs.k8s.io/boskos/aws-janitor/regions"
+	"sigs.k8s.io/boskos/aws-janitor/resources"
+	"sigs.k8s.io/boskos/common"
+)
+
+// runInventory implements the inventory subcommand, which lists everything the
+// janitor can see without marking or deleting anything, and returns the exit
+// code.
+func runInventory(args []string) int {
+	fs := flag.NewFlagSet("inventory", flag.ExitOnError)
+	region := fs.String("region", "", "The region to list (otherwise defaults to all regions)")
+	output := fs.String("output", "csv", "Output format, one of json or csv.")
+	match := fs.String("match", "", "If set, only list the resources whose ARN, resource key or ID matches this regular expression")
+	exclusions := fs.String("exclusions-file", "", "If set, flag the resources protected by the exclusions in this YAML file")
+	skipExcluded := fs.Bool("skip-excluded", false, "If set with -exclusions-file, leave out the resources protected by an exclusion")
+	var onlyTypes, onlyResources common.CommaSeparatedStrings
+	fs.Var(&onlyTypes, "only-type",
+		fmt.Sprintf("If set, only list resources of these types. Given as a comma-separated list of types among %v.", resources.TypeNames()))
+	fs.Var(&onlyResources, "only-resource",
+		"If set, only list these resources. Given as a comma-separated list of ARNs or IDs.")
+	fs.Parse(args)
+
+	onlyTypeSet, err := resources.ParseOnlyTypes(onlyTypes)
+	if err != nil {
+		logrus.Errorf("Error parsing --only-type: %v", err)
+		return 2
+	}
+	filter := resources.InventoryFilter{SkipExcluded: *skipExcluded}
+	if *match != "" {
+		if filter.Match, err = regexp.Compile(*match); err != nil {
+			logrus.Errorf("Error parsing --match: %v", err)
+			return 2
+		}
+	}
+	exclusionList, err := loadExclusions(*exclusions)
+	if err != nil {
+		logrus.Errorf("Error loading --exclusions-file: %v", err)
+		return 2
+	}
+
+	sess := session.Must(session.NewSessionWithOptions(session.Options{Config: aws.Config{MaxRetries: aws.Int(100)}}))
+	acct, err := account.GetAccount(sess, regions.Default)
+	if err != nil {
+		logrus.Errorf("Failed retrieving account: %v", err)
+		return 2
+	}
+	regionList, err := regions.ParseRegion(sess, *region)
+	if err != nil {
+		logrus.Errorf("Error parsing region: %v", err)
+		return 2
+	}
+
+	opts := resources.Options{
+		Session:       sess,
+		Account:       acct,
+		DryRun:        true,
+		OnlyTypes:     onlyTypeSet,
+		OnlyResources: sets.NewString(onlyResources...),
+		Exclusions:    exclusionList,
+	}
+	items := resources.Inventory(opts, regionList, regions.Default, filter)
+	if err := resources.WriteInventory(os.Stdout, items, *output); err != nil {
+		logrus.Errorf("Error writing the inventory: %v", err)
+		return 2
+	}
+	return 0
+}
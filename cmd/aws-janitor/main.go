@@ -17,10 +17,12 @@ limitations under the License.
 package main
 
 import (
+	"bufio"
 	"flag"
 	"fmt"
 	"os"
 	"runtime"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -30,6 +32,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus/push"
 	"github.com/sirupsen/logrus"
 
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/test-infra/prow/logrusutil"
 
 	"sigs.k8s.io/boskos/aws-janitor/account"
@@ -41,16 +44,17 @@ import (
 
 var (
 	maxTTL      = flag.Duration("ttl", 24*time.Hour, "Maximum time before attempting to delete a resource. Set to 0s to nuke all non-default resources.")
-	region      = flag.String("region", "", "The region to clean (otherwise defaults to all regions)")
-	path        = flag.String("path", "", "S3 path for mark data (required when -all=false)")
-	cleanAll    = flag.Bool("all", false, "Clean all resources (ignores -path)")
+	cleanAll    = flag.Bool("all", false, "Clean all resources (ignores -path, except to never sweep its bucket)")
 	logLevel    = flag.String("log-level", "info", fmt.Sprintf("Log level is one of %v.", logrus.AllLevels))
 	dryRun      = flag.Bool("dry-run", false, "If set, don't delete any resources, only log what would be done")
-	ttlTagKey   = flag.String("ttl-tag-key", "", "If set, allow resources to use a tag with this key to override TTL")
 	pushGateway = flag.String("push-gateway", "", "If specified, push prometheus metrics to this endpoint.")
+	writePlan   = flag.String("write-plan", "", "If set, don't delete any resources, only write the list of resources that would be deleted to this file for review")
+	applyPlan   = flag.String("apply-plan", "", "If set, only delete the resources listed in this plan file, as written by -write-plan")
+	exclusions  = flag.String("exclusions-file", "", "If set, never delete the resources protected by the exclusions in this YAML file, which is reloaded when it changes")
+	confirm     = flag.Bool("confirm", false, "If set with -apply-plan, list the planned resources and ask for confirmation before deleting them")
 
-	excludeTags common.CommaSeparatedStrings
-	includeTags common.CommaSeparatedStrings
+	janitorFlags  resources.Flags
+	onlyResources common.CommaSeparatedStrings
 
 	sweepCount int
 
@@ -67,14 +71,16 @@ var (
 )
 
 func init() {
-	flag.Var(&excludeTags, "exclude-tags",
-		"Resources with any of these tags will not be managed by the janitor. Given as a comma-separated list of tags in key[=value] format; excluding the value will match any tag with that key. Keys can be repeated.")
-	flag.Var(&includeTags, "include-tags",
-		"Resources must include all of these tags in order to be managed by the janitor. Given as a comma-separated list of tags in key[=value] format; excluding the value will match any tag with that key. Keys can be repeated.")
+	janitorFlags.AddFlags(flag.CommandLine)
+	flag.Var(&onlyResources, "only-resource",
+		"If set, only sweep these resources, e.g. to delete a single stuck resource. Given as a comma-separated list of ARNs or IDs. Combine with --ttl=0s to delete them regardless of their age.")
 }
 
 func main() {
 	logrusutil.ComponentInit()
+	if len(os.Args) > 1 && os.Args[1] == "inventory" {
+		os.Exit(runInventory(os.Args[2:]))
+	}
 	flag.Parse()
 
 	level, err := logrus.ParseLevel(*logLevel)
@@ -114,32 +120,65 @@ func main() {
 	}
 	logrus.Debugf("account: %s", acct)
 
-	excludeTM, err := resources.TagMatcherForTags(excludeTags)
+	opts, err := janitorFlags.Options(sess, acct)
 	if err != nil {
-		logrus.Errorf("Error parsing --exclude-tags: %v", err)
+		logrus.Errorf("Invalid flags: %v", err)
 		runtime.Goexit()
 	}
-	includeTM, err := resources.TagMatcherForTags(includeTags)
-	if err != nil {
-		logrus.Errorf("Error parsing --include-tags: %v", err)
+
+	if (*writePlan != "" || *applyPlan != "") && *cleanAll {
+		logrus.Error("-write-plan and -apply-plan cannot be used with -all")
+		runtime.Goexit()
+	}
+	if *writePlan != "" && *applyPlan != "" {
+		logrus.Error("-write-plan and -apply-plan are mutually exclusive")
+		runtime.Goexit()
+	}
+
+	if opts.Exclusions, err = loadExclusions(*exclusions); err != nil {
+		logrus.Errorf("Error loading --exclusions-file: %v", err)
 		runtime.Goexit()
 	}
+	opts.DryRun = *dryRun
+	opts.OnlyResources = sets.NewString(onlyResources...)
+	if *writePlan != "" {
+		opts.DryRun = true
+	}
+	if *applyPlan != "" {
+		plan, err := resources.ReadPlan(*applyPlan)
+		if err != nil {
+			logrus.Errorf("Error reading -apply-plan: %v", err)
+			runtime.Goexit()
+		}
+		if plan.Account != acct {
+			logrus.Errorf("Plan %s was made for account %s, not %s", *applyPlan, plan.Account, acct)
+			runtime.Goexit()
+		}
+		if *confirm && !confirmPlan(plan) {
+			logrus.Info("Plan not confirmed, nothing deleted")
+			exitCode = 0
+			runtime.Goexit()
+		}
+		opts.Planned = plan.Keys()
+	}
 
-	opts := resources.Options{
-		Session:     sess,
-		Account:     acct,
-		DryRun:      *dryRun,
-		ExcludeTags: excludeTM,
-		IncludeTags: includeTM,
-		TTLTagKey:   *ttlTagKey,
+	if janitorFlags.Path != "" {
+		s3p, err := s3path.GetPath(opts.Session, janitorFlags.Path)
+		if err != nil {
+			logrus.Errorf("-path %q isn't a valid S3 path: %v", janitorFlags.Path, err)
+			runtime.Goexit()
+		}
+		// The mark data must survive the sweep of the S3 buckets, even when
+		// cleaning all resources.
+		opts.KeepBuckets = sets.NewString(s3p.Bucket)
 	}
 
 	if *cleanAll {
-		if err := resources.CleanAll(opts, *region); err != nil {
+		if err := resources.CleanAll(opts, janitorFlags.Region); err != nil {
 			logrus.Errorf("Error cleaning all resources: %v", err)
 			runtime.Goexit()
 		}
-	} else if err := markAndSweep(opts, *region); err != nil {
+	} else if err := markAndSweep(opts, janitorFlags.Region); err != nil {
 		logrus.Errorf("Error marking and sweeping resources: %v", err)
 		runtime.Goexit()
 	}
@@ -148,9 +187,9 @@ func main() {
 }
 
 func markAndSweep(opts resources.Options, region string) error {
-	s3p, err := s3path.GetPath(opts.Session, *path)
+	s3p, err := s3path.GetPath(opts.Session, janitorFlags.Path)
 	if err != nil {
-		return errors.Wrapf(err, "-path %q isn't a valid S3 path", *path)
+		return errors.Wrapf(err, "-path %q isn't a valid S3 path", janitorFlags.Path)
 	}
 
 	regionList, err := regions.ParseRegion(opts.Session, region)
@@ -161,28 +200,19 @@ func markAndSweep(opts resources.Options, region string) error {
 
 	res, err := resources.LoadSet(opts.Session, s3p, *maxTTL)
 	if err != nil {
-		return errors.Wrapf(err, "Error loading %q", *path)
+		return errors.Wrapf(err, "Error loading %q", janitorFlags.Path)
 	}
 
-	for _, region := range regionList {
-		opts.Region = region
-		for _, typ := range resources.RegionalTypeList {
-			if err := typ.MarkAndSweep(opts, res); err != nil {
-				return errors.Wrapf(err, "Error sweeping %T", typ)
-			}
-		}
+	if sweepCount, err = resources.MarkSweepAndSave(opts, regionList, res, s3p); err != nil {
+		return err
 	}
 
-	opts.Region = regions.Default
-	for _, typ := range resources.GlobalTypeList {
-		if err := typ.MarkAndSweep(opts, res); err != nil {
-			return errors.Wrapf(err, "Error sweeping %T", typ)
+	if *writePlan != "" {
+		plan := resources.NewPlan(opts.Account, res)
+		if err := plan.WritePlan(*writePlan); err != nil {
+			return errors.Wrapf(err, "Error writing plan %q", *writePlan)
 		}
-	}
-
-	sweepCount = res.MarkComplete()
-	if err := res.Save(opts.Session, s3p); err != nil {
-		return errors.Wrapf(err, "Error saving %q", *path)
+		logrus.Infof("wrote a plan to delete %d resources to %s", len(plan.Resources), *writePlan)
 	}
 
 	logrus.Infof("swept %d resources", sweepCount)
@@ -190,6 +220,29 @@ func markAndSweep(opts resources.Options, region string) error {
 	return nil
 }
 
+// loadExclusions loads the exclusions file at path, if any.
+func loadExclusions(path string) (*resources.Exclusions, error) {
+	if path == "" {
+		return nil, nil
+	}
+	return resources.LoadExclusions(path)
+}
+
+// confirmPlan lists the resources in plan and asks whether to delete them.
+func confirmPlan(plan *resources.Plan) bool {
+	fmt.Printf("Plan made on %v for account %s will delete %d resources:\n", plan.Created.Format(time.RFC3339), plan.Account, len(plan.Resources))
+	for _, key := range plan.Resources {
+		fmt.Printf("  %s\n", key)
+	}
+	fmt.Print("Delete these resources? Only 'yes' will be accepted: ")
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		logrus.WithError(err).Error("Failed to read confirmation")
+		return false
+	}
+	return strings.TrimSpace(answer) == "yes"
+}
+
 func pushMetricBeforeExit(pusher *push.Pusher, startTime time.Time, exitCode int) {
 	// Set the status of the job
 	status := "failed"
@@ -203,7 +256,7 @@ func pushMetricBeforeExit(pusher *push.Pusher, startTime time.Time, exitCode int
 		job = "mark_and_sweep"
 
 		sweepCounter.
-			With(prometheus.Labels{"type": job, "status": status, "region": *region}).
+			With(prometheus.Labels{"type": job, "status": status, "region": janitorFlags.Region}).
 			Add(float64(sweepCount))
 	} else {
 		job = "clean_all"
@@ -211,7 +264,7 @@ func pushMetricBeforeExit(pusher *push.Pusher, startTime time.Time, exitCode int
 
 	duration := time.Since(startTime).Seconds()
 	cleaningTimeHistogram.
-		With(prometheus.Labels{"type": job, "status": status, "region": *region}).
+		With(prometheus.Labels{"type": job, "status": status, "region": janitorFlags.Region}).
 		Observe(duration)
 
 	if err := pusher.Add(); err != nil {
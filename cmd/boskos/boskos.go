@@ -18,17 +18,31 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"flag"
 	"fmt"
 	"net/http"
+	"os"
+	"os/signal"
 	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
+	// The drivers of the SQL storages register under the names of their
+	// dialects.
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
+	"google.golang.org/grpc/keepalive"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/workqueue"
 	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/event"
@@ -48,26 +62,99 @@ import (
 	"k8s.io/test-infra/prow/pjutil/pprof"
 
 	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/common/logging"
+	"sigs.k8s.io/boskos/configsource"
 	"sigs.k8s.io/boskos/crds"
 	"sigs.k8s.io/boskos/handlers"
+	"sigs.k8s.io/boskos/hydrator"
 	"sigs.k8s.io/boskos/metrics"
 	"sigs.k8s.io/boskos/ranch"
+	"sigs.k8s.io/boskos/ranch/etcd"
+	"sigs.k8s.io/boskos/ranch/sqlbackend"
+	"sigs.k8s.io/boskos/rotator"
+	"sigs.k8s.io/boskos/server"
+	"sigs.k8s.io/boskos/tracing"
 )
 
 const (
 	defaultDynamicResourceUpdatePeriod = 10 * time.Minute
-	defaultRequestTTL                  = 30 * time.Second
-	defaultRequestGCPeriod             = time.Minute
+	defaultRequestTTL                  = server.DefaultRequestTTL
+	defaultConfigSyncDebounce          = 10 * time.Second
+	defaultConfigSyncPeriod            = time.Minute
+	defaultConfigPollPeriod            = time.Minute
 )
 
 var (
-	configPath = flag.String("config", "config.yaml", "Path to init resource file")
+	configPath = flag.String("config", "config.yaml", "Path to init resource file, or its s3:// or gs:// URL to poll it from object storage")
 	_          = flag.Duration("dynamic-resource-update-period", defaultDynamicResourceUpdatePeriod,
 		"Legacy flag that does nothing but is kept for compatibility reasons")
-	requestTTL = flag.Duration("request-ttl", defaultRequestTTL, "request TTL before losing priority in the queue")
+	requestTTL = flag.Duration("request-ttl", defaultRequestTTL, "request TTL before losing priority in the queue, unless requests.ttl is set in the config")
 	logLevel   = flag.String("log-level", "info", fmt.Sprintf("Log level is one of %v.", logrus.AllLevels))
 	namespace  = flag.String("namespace", corev1.NamespaceDefault, "namespace to install on")
 	port       = flag.Int("port", 8080, "Port to serve on")
+	grpcPort   = flag.Int("grpc-port", 0, "If set, port to serve the gRPC API on, for clients avoiding the overhead of HTTP and JSON")
+	lameDuck   = flag.Bool("lame-duck", false, "Start in lame-duck mode, serving existing leases but granting no new ones until disabled through /lameduck")
+	readOnly   = flag.Bool("read-only", false, "Start in read-only mode, rejecting every change of the resources while serving listings and metrics until disabled through /readonly")
+
+	requestStaleAfter  = flag.Duration("request-stale-after", 0, "Expire queued requests not renewed for this long, even before the request TTL, unless their owner updated one of its resources since. Disabled if zero")
+	priorityAging      = flag.Duration("priority-aging-period", ranch.DefaultPriorityAgingPeriod, "How long a queued request waits for its priority to be raised by one, so low priority requests are not starved. Negative disables aging")
+	maxPriorityBoost   = flag.Int("max-priority-boost", ranch.DefaultMaxPriorityBoost, "How much the priority of the requests of an owner is raised at most after its resources were reset or claimed by others, or its requests failed on errors of boskos. Negative disables boosts")
+	configSyncDebounce = flag.Duration("config-sync-debounce", defaultConfigSyncDebounce, "Coalesce the resource updates triggering a config sync within this window, so heavy acquire and release traffic does not keep the config sync busy")
+
+	grpcKeepaliveTime     = flag.Duration("grpc-keepalive-time", 0, "If set, ping idle gRPC connections this often to keep them alive, e.g. below the idle timeout of a load balancer")
+	grpcKeepaliveTimeout  = flag.Duration("grpc-keepalive-timeout", 0, "If set, close gRPC connections whose pings are not acknowledged within this long")
+	grpcKeepaliveMinTime  = flag.Duration("grpc-keepalive-min-time", 0, "If set, close gRPC connections of clients pinging more often than this")
+	grpcKeepaliveNoStream = flag.Bool("grpc-keepalive-permit-without-stream", false, "Allow gRPC clients to ping connections without calls in flight")
+
+	gcloudPath = flag.String("gcloud-path", "gcloud", "Path to the gcloud binary used to rotate service account keys of resources with the gcp-sa-key credential rotator")
+
+	metricsCardinalityConfig = flag.String("metrics-cardinality-config", "", "If set, path to a config of the label dimensions and top-N truncation of the exported metrics")
+	metricsByOwner           = flag.Bool("metrics-by-owner", false, "Break the boskos_resources metric down by owner with an owner label, bounded with the top-n of the owner dimension in --metrics-cardinality-config")
+
+	authConfig               = flag.String("auth-config", "", "If set, path to a config of the identities calling boskos and their tenants. Owner metadata of other tenants is then hidden from listings")
+	authTokenFile            = flag.String("auth-token-file", "", "If set, path to a file of bearer tokens authenticating the callers of boskos, a line of token,name per token. Anonymous callers may then no longer acquire, release or reset resources")
+	authTokenReview          = flag.Bool("auth-token-review", false, "Authenticate bearer tokens, e.g. of service accounts, with TokenReviews of the Kubernetes cluster. Anonymous callers may then no longer acquire, release or reset resources")
+	authTokenReviewAudiences = flag.String("auth-token-review-audiences", "", "If set, comma-separated audiences the tokens reviewed with --auth-token-review must be issued for")
+	authTokenSecret          = flag.String("auth-token-secret", "", "If set, name of a Secret in --namespace persisting the scoped tokens minted under /admin/tokens, so they survive restarts and are shared by the replicas")
+
+	leaderElect             = flag.Bool("leader-elect", false, "Elect a leader among the replicas of boskos with a Lease of the Kubernetes cluster, requires --storage=crd. Only the leader changes the resources, syncs the config and collects requests, while the other replicas serve listings and reject changes")
+	leaderElectionID        = flag.String("leader-election-id", "boskos", "Name of the Lease the replicas elect their leader with, with --leader-elect")
+	leaderElectionNamespace = flag.String("leader-election-namespace", "", "Namespace of the Lease of --leader-elect, defaults to --namespace")
+	stateConfigMapPrefix    = flag.String("state-configmap-prefix", "", "If set, prefix of the names of the ConfigMaps in --namespace persisting the locks and the open cleanup breakers, so they survive restarts and the failovers of the leader. Defaults to boskos-state with --leader-elect")
+	followerReady           = flag.Bool("follower-ready", false, "With --leader-elect, also report the followers as ready, so services route listings to them. Followers reject changes, so only the leader is ready by default")
+
+	readReplicaKubeconfigs = flag.String("read-replica-kubeconfigs", "", "Comma-separated absolute paths to the kubeconfigs of clusters the resources are replicated to, serving reads like metrics while the primary cluster is unavailable")
+
+	storageType      = flag.String("storage", "crd", "Where the resources are stored: crd for custom resources of the Kubernetes cluster, etcd, postgres or mysql")
+	storageDSN       = flag.String("storage-dsn", "", "Data source name of the database storing the resources with --storage=postgres or --storage=mysql, in the format of the database driver")
+	etcdEndpoints    = flag.String("etcd-endpoints", "", "If set, comma-separated client URLs of an etcd cluster storing the resources instead of the Kubernetes cluster, so boskos can run outside of a cluster. Implies --storage=etcd")
+	etcdPrefix       = flag.String("etcd-prefix", etcd.DefaultPrefix, "Prefix of the etcd keys of the resources, so several boskos instances can share an etcd cluster")
+	configSyncPeriod = flag.Duration("config-sync-period", defaultConfigSyncPeriod, "How often the config is synced when the resources are not stored in the Kubernetes cluster, which also picks up changes of the config file, since no controller watches the resources")
+	configPollPeriod = flag.Duration("config-poll-period", defaultConfigPollPeriod, "How often the ETag of a config at an s3:// or gs:// URL is checked, syncing the config when it changed")
+
+	eventArchive     = flag.String("event-archive", "", "If set, where the events of the resources are archived for /events: memory for the latest --event-archive-size events, postgres or mysql")
+	eventArchiveDSN  = flag.String("event-archive-dsn", "", "Data source name of the database archiving the events with --event-archive=postgres or --event-archive=mysql, in the format of the database driver")
+	eventArchiveSize = flag.Int("event-archive-size", 10000, "How many events are kept with --event-archive=memory")
+	eventRetention   = flag.Duration("event-retention", 0, "If set, how long the archived events are kept")
+
+	slaReportDir    = flag.String("sla-report-dir", "", "If set, directory the daily and weekly SLA reports of the resource types are written to every --sla-report-period")
+	slaReportPeriod = flag.Duration("sla-report-period", server.DefaultSLAReportPeriod, "How often the SLA reports are written to --sla-report-dir")
+
+	typeShardConfig = flag.String("type-shard-config", "", "If set, path to a config splitting the resource types among several boskos instances. Requests for the types of other instances are forwarded to them")
+	typeShardName   = flag.String("type-shard-name", "", "Name of this instance in --type-shard-config, defaults to the hostname")
+
+	auditLog = flag.String("audit-log", "", "If set, path to a file every acquire, release, update and reset of the resources is appended to as a line of JSON, or - for the standard output")
+
+	userDataMaxValueSize  = flag.Int("user-data-max-value-size", 0, "If set, the largest size in bytes a key of user data may be updated to")
+	userDataCompressAbove = flag.Int("user-data-compress-above", 0, "If set, the size in bytes above which the values of user data are stored gzipped")
+	userDataOverflow      = flag.String("user-data-overflow", "", "If set, where the values of user data larger than --user-data-overflow-above are stored instead of the resources: secret or configmap, in the namespace of boskos")
+	userDataOverflowAbove = flag.Int("user-data-overflow-above", ranch.DefaultUserDataOverflowAbove, "The size in bytes, once compressed, above which the values of user data overflow with --user-data-overflow")
+
+	hydrationConfig = flag.String("hydration-config", "", "If set, path to a config of cloud inventories to seed resources from when the storage is empty")
+
+	schedulerWebhookURL      = flag.String("scheduler-webhook-url", "", "If set, URL of an external service filtering and scoring the resources handed out on acquire")
+	schedulerWebhookTimeout  = flag.Duration("scheduler-webhook-timeout", 5*time.Second, "Timeout for calls to the scheduler webhook")
+	schedulerWebhookFailOpen = flag.Bool("scheduler-webhook-fail-open", false, "Hand out resources as if there was no scheduler webhook when it fails, instead of failing acquire requests")
 
 	httpRequestDuration = prowmetrics.HttpRequestDuration("boskos", 0.005, 1200)
 	httpResponseSize    = prowmetrics.HttpResponseSize("boskos", 128, 65536)
@@ -75,6 +162,8 @@ var (
 
 	kubeClientOptions      crds.KubernetesClientOptions
 	instrumentationOptions prowflagutil.InstrumentationOptions
+	loggingOptions         logging.Options
+	tracingOptions         tracing.Options
 )
 
 func init() {
@@ -84,7 +173,7 @@ func init() {
 
 func main() {
 	logrusutil.ComponentInit()
-	for _, o := range []flagutil.OptionGroup{&kubeClientOptions, &instrumentationOptions} {
+	for _, o := range []flagutil.OptionGroup{&kubeClientOptions, &instrumentationOptions, &loggingOptions, &tracingOptions} {
 		o.AddFlags(flag.CommandLine)
 	}
 	flag.Parse()
@@ -94,11 +183,23 @@ func main() {
 		logrus.WithError(err).Fatal("invalid log level specified")
 	}
 	logrus.SetLevel(level)
-	for _, o := range []flagutil.OptionGroup{&kubeClientOptions, &instrumentationOptions} {
+	for _, o := range []flagutil.OptionGroup{&kubeClientOptions, &instrumentationOptions, &loggingOptions, &tracingOptions} {
 		if err := o.Validate(false); err != nil {
 			logrus.Fatalf("Invalid options: %v", err)
 		}
 	}
+	loggingOptions.Configure(level)
+	shutdownTracing, err := tracingOptions.Setup(interrupts.Context())
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to set up tracing")
+	}
+	interrupts.OnInterrupt(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), server.DefaultShutdownTimeout)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logrus.WithError(err).Error("Failed to flush the traces")
+		}
+	})
 
 	// collect data on mutex holders and blocking profiles
 	runtime.SetBlockProfileRate(1)
@@ -112,28 +213,279 @@ func main() {
 	// main server with the main mux until we're ready
 	health := pjutil.NewHealthOnPort(instrumentationOptions.HealthPort)
 
-	mgr, err := kubeClientOptions.Manager(*namespace, &crds.ResourceObject{}, &crds.DRLCObject{})
-	if err != nil {
-		logrus.WithError(err).Fatal("Failed to get mgr")
+	// The resources are stored either in etcd, in a database or as custom
+	// resources of the cluster of the manager.
+	var mgr manager.Manager
+	var backend ranch.Backend
+	if *etcdEndpoints != "" {
+		*storageType = "etcd"
+	}
+	switch *storageType {
+	case "crd":
+		if *leaderElect {
+			kubeClientOptions.LeaderElectionID = *leaderElectionID
+			kubeClientOptions.LeaderElectionNamespace = *leaderElectionNamespace
+			if kubeClientOptions.LeaderElectionNamespace == "" {
+				kubeClientOptions.LeaderElectionNamespace = *namespace
+			}
+		}
+		if mgr, err = kubeClientOptions.Manager(*namespace, &crds.ResourceObject{}, &crds.DRLCObject{}); err != nil {
+			logrus.WithError(err).Fatal("Failed to get mgr")
+		}
+	case "etcd":
+		if backend, err = etcd.NewBackend(etcd.Options{Endpoints: strings.Split(*etcdEndpoints, ","), Prefix: *etcdPrefix}); err != nil {
+			logrus.WithError(err).Fatal("Failed to set up etcd backend")
+		}
+	case string(sqlbackend.Postgres), string(sqlbackend.MySQL):
+		db, err := sql.Open(*storageType, *storageDSN)
+		if err != nil {
+			logrus.WithError(err).Fatal("Failed to open database")
+		}
+		if backend, err = sqlbackend.NewBackend(interrupts.Context(), db, sqlbackend.Dialect(*storageType)); err != nil {
+			logrus.WithError(err).Fatal("Failed to set up SQL backend")
+		}
+	default:
+		logrus.Fatalf("Unknown storage %q, must be one of crd, etcd, postgres or mysql", *storageType)
+	}
+	if *leaderElect && mgr == nil {
+		logrus.Fatal("--leader-elect requires --storage=crd")
 	}
 
-	storage := ranch.NewStorage(interrupts.Context(), mgr.GetClient(), *namespace)
+	// A config in object storage is fetched once before syncing, then polled.
+	var configSource *configsource.Source
+	if configsource.IsURL(*configPath) {
+		if configSource, err = configsource.NewSource(interrupts.Context(), *configPath); err != nil {
+			logrus.WithError(err).Fatal("Failed to set up config source")
+		}
+		if _, err := configSource.Fetch(interrupts.Context()); err != nil {
+			logrus.WithError(err).Fatal("Failed to fetch config")
+		}
+	}
 
-	r, err := ranch.NewRanch(*configPath, storage, *requestTTL)
-	if err != nil {
-		logrus.WithError(err).Fatalf("failed to create ranch! Config: %v", *configPath)
+	hydrateStorage := func() {
+		if *hydrationConfig == "" {
+			return
+		}
+		storage := ranch.NewStorageWithBackend(interrupts.Context(), backend)
+		if mgr != nil {
+			storage = ranch.NewStorage(interrupts.Context(), mgr.GetClient(), *namespace)
+		}
+		if err := hydrate(storage, configSource); err != nil {
+			logrus.WithError(err).Fatal("Failed to hydrate storage")
+		}
+	}
+	// With leader election, only the leader hydrates the storage, before it
+	// takes over the changes of the resources.
+	var elected chan struct{}
+	if *leaderElect {
+		elected = make(chan struct{})
+		go func() {
+			<-mgr.Elected()
+			hydrateStorage()
+			close(elected)
+		}()
+	} else {
+		hydrateStorage()
 	}
 
-	boskos := &http.Server{
-		Handler: traceHandler(handlers.NewBoskosHandler(r)),
-		Addr:    fmt.Sprintf(":%d", *port),
+	opts := server.Options{
+		ConfigPath:          *configPath,
+		Backend:             backend,
+		Namespace:           *namespace,
+		Addr:                fmt.Sprintf(":%d", *port),
+		RequestTTL:          *requestTTL,
+		RequestStaleAfter:   *requestStaleAfter,
+		PriorityAgingPeriod: *priorityAging,
+		MaxPriorityBoost:    *maxPriorityBoost,
+		LameDuck:            *lameDuck,
+		ReadOnly:            *readOnly,
+		CredentialRotators: map[string]ranch.CredentialRotator{
+			common.StaticRotator:               rotator.Static{},
+			common.AWSAccessKeyRotator:         rotator.NewAWSAccessKey(),
+			common.GCPServiceAccountKeyRotator: rotator.NewGCPServiceAccountKey(*gcloudPath),
+		},
+		Middleware: func(h http.Handler) http.Handler {
+			return traceHandler(tracing.Middleware(handlers.NewBoskosSimplifier())(h))
+		},
+		EventRetention:  *eventRetention,
+		Elected:         elected,
+		SLAReportDir:    *slaReportDir,
+		SLAReportPeriod: *slaReportPeriod,
+		UserData: ranch.UserDataOptions{
+			MaxValueSize:  *userDataMaxValueSize,
+			CompressAbove: *userDataCompressAbove,
+			OverflowAbove: *userDataOverflowAbove,
+		},
+	}
+	if configSource != nil {
+		opts.ConfigPath, opts.Config = "", configSource.Config()
+	}
+	if *grpcPort != 0 {
+		opts.GRPCAddr = fmt.Sprintf(":%d", *grpcPort)
+	}
+	if *grpcKeepaliveTime != 0 || *grpcKeepaliveTimeout != 0 {
+		opts.GRPCKeepalive = &keepalive.ServerParameters{Time: *grpcKeepaliveTime, Timeout: *grpcKeepaliveTimeout}
+	}
+	if *grpcKeepaliveMinTime != 0 || *grpcKeepaliveNoStream {
+		opts.GRPCKeepaliveEnforcement = &keepalive.EnforcementPolicy{MinTime: *grpcKeepaliveMinTime, PermitWithoutStream: *grpcKeepaliveNoStream}
+	}
+	if mgr != nil {
+		opts.Client = mgr.GetClient()
+		// Listings iterate over the informer of the cache rather than copying
+		// every resource out of it.
+		informer, err := mgr.GetCache().GetInformer(interrupts.Context(), &crds.ResourceObject{})
+		if err != nil {
+			logrus.WithError(err).Fatal("Failed to get the informer of the resources")
+		}
+		if resourceInformer, ok := informer.(ranch.ResourceInformer); ok {
+			opts.ResourceInformer = resourceInformer
+		}
+	} else {
+		opts.ConfigSyncPeriod = *configSyncPeriod
+	}
+	if *readReplicaKubeconfigs != "" {
+		for _, kubeConfig := range strings.Split(*readReplicaKubeconfigs, ",") {
+			replica, err := crds.ReadReplicaCache(kubeConfig, *namespace, &crds.ResourceObject{})
+			if err != nil {
+				// Replicas only improve availability, boskos works without them.
+				logrus.WithError(err).WithField("kubeconfig", kubeConfig).Error("Failed to set up read replica, skipping it")
+				continue
+			}
+			opts.ReadReplicas = append(opts.ReadReplicas, replica)
+		}
+	}
+	if *schedulerWebhookURL != "" {
+		opts.SchedulerPolicy = ranch.NewWebhookSchedulerPolicy(*schedulerWebhookURL, *schedulerWebhookTimeout, *schedulerWebhookFailOpen)
+	}
+	switch *eventArchive {
+	case "":
+	case "memory":
+		opts.EventArchive = ranch.NewMemoryEventArchive(*eventArchiveSize)
+	case string(sqlbackend.Postgres), string(sqlbackend.MySQL):
+		db, err := sql.Open(*eventArchive, *eventArchiveDSN)
+		if err != nil {
+			logrus.WithError(err).Fatal("Failed to open event archive database")
+		}
+		if opts.EventArchive, err = sqlbackend.NewEventArchive(interrupts.Context(), db, sqlbackend.Dialect(*eventArchive)); err != nil {
+			logrus.WithError(err).Fatal("Failed to set up SQL event archive")
+		}
+	default:
+		logrus.Fatalf("Unknown event archive %q, must be one of memory, postgres or mysql", *eventArchive)
+	}
+	switch *userDataOverflow {
+	case "":
+	case "secret", "configmap":
+		client, err := kubeClientOptions.Client()
+		if err != nil {
+			logrus.WithError(err).Fatal("Failed to create the client storing overflowing user data")
+		}
+		if *userDataOverflow == "secret" {
+			opts.UserData.Overflow = ranch.NewSecretUserDataOverflow(client, *namespace)
+		} else {
+			opts.UserData.Overflow = ranch.NewConfigMapUserDataOverflow(client, *namespace)
+		}
+	default:
+		logrus.Fatalf("Unknown user data overflow %q, must be one of secret or configmap", *userDataOverflow)
+	}
+	switch *auditLog {
+	case "":
+	case "-":
+		opts.AuditLog = ranch.NewJSONAuditLog(os.Stdout)
+	default:
+		if opts.AuditLog, err = ranch.OpenFileAuditLog(*auditLog); err != nil {
+			logrus.WithError(err).Fatal("Failed to open audit log")
+		}
+	}
+	if *typeShardConfig != "" {
+		name := *typeShardName
+		if name == "" {
+			if name, err = os.Hostname(); err != nil {
+				logrus.WithError(err).Fatal("Failed to get the hostname")
+			}
+		}
+		if opts.TypeShards, err = handlers.LoadTypeShardConfig(*typeShardConfig, name); err != nil {
+			logrus.WithError(err).Fatal("Failed to load type shard config")
+		}
+	}
+	if *authConfig != "" {
+		if opts.Authenticator, err = handlers.LoadAuthConfig(*authConfig); err != nil {
+			logrus.WithError(err).Fatal("Failed to load auth config")
+		}
+	}
+	if (*authTokenFile != "" || *authTokenReview) && opts.Authenticator == nil {
+		if opts.Authenticator, err = handlers.NewAuthenticator(&handlers.AuthConfig{}); err != nil {
+			logrus.WithError(err).Fatal("Failed to create authenticator")
+		}
+	}
+	if *authTokenFile != "" {
+		tokens, err := handlers.LoadTokenFile(*authTokenFile)
+		if err != nil {
+			logrus.WithError(err).Fatal("Failed to load auth token file")
+		}
+		opts.Authenticator.AddTokenAuthenticator(tokens)
+	}
+	if *authTokenReview {
+		cfg, err := kubeClientOptions.Cfg()
+		if err != nil {
+			logrus.WithError(err).Fatal("Failed to get the config of the Kubernetes cluster reviewing tokens")
+		}
+		clientset, err := kubernetes.NewForConfig(cfg)
+		if err != nil {
+			logrus.WithError(err).Fatal("Failed to create the client reviewing tokens")
+		}
+		var audiences []string
+		if *authTokenReviewAudiences != "" {
+			audiences = strings.Split(*authTokenReviewAudiences, ",")
+		}
+		opts.Authenticator.AddTokenAuthenticator(handlers.NewTokenReviewAuthenticator(clientset.AuthenticationV1().TokenReviews(), audiences...))
+	}
+	if *stateConfigMapPrefix == "" && *leaderElect {
+		*stateConfigMapPrefix = "boskos-state"
+	}
+	if *stateConfigMapPrefix != "" {
+		client, err := kubeClientOptions.Client()
+		if err != nil {
+			logrus.WithError(err).Fatal("Failed to create the client persisting the state")
+		}
+		opts.StatePersistence = ranch.NewConfigMapStatePersistence(client, *namespace, *stateConfigMapPrefix)
+	}
+	if *authTokenSecret != "" {
+		if opts.Authenticator == nil {
+			logrus.Fatal("--auth-token-secret requires --auth-config, whose admins mint the scoped tokens")
+		}
+		client, err := kubeClientOptions.Client()
+		if err != nil {
+			logrus.WithError(err).Fatal("Failed to create the client persisting the scoped tokens")
+		}
+		if err := opts.Authenticator.PersistTokens(interrupts.Context(), handlers.NewSecretTokenPersistence(client, *namespace, *authTokenSecret)); err != nil {
+			logrus.WithError(err).Fatal("Failed to persist the scoped tokens")
+		}
+	}
+	// Make sure config is not broken by syncing at least once. Also
+	// needed for in memory mode where the controller never gets triggered.
+	boskos, err := server.NewServer(opts)
+	if err != nil {
+		logrus.WithError(err).Fatalf("Failed to create server! Config: %v", *configPath)
+	}
+	r := boskos.Ranch()
+	if configSource != nil {
+		// Reloads fetch the config rather than applying the one last polled.
+		r.SetConfigReloader(func() error {
+			if _, err := configSource.Fetch(interrupts.Context()); err != nil {
+				return err
+			}
+			return boskos.SetConfig(configSource.Config())
+		})
+		interrupts.Run(func(ctx context.Context) {
+			configSource.Poll(ctx, *configPollPeriod, boskos.SetConfig)
+		})
 	}
 
 	// Viper defaults the configfile name to `config` and `SetConfigFile` only
 	// has an effect when the configfile name is not an empty string, so we
 	// just disable it entirely if there is no config.
 	configChangeEventChan := make(chan event.GenericEvent)
-	if *configPath != "" {
+	if *configPath != "" && configSource == nil && mgr != nil {
 		v := viper.New()
 		v.SetConfigFile(*configPath)
 		v.SetConfigType("yaml")
@@ -144,33 +496,119 @@ func main() {
 		})
 	}
 
-	syncConfig := func() error {
-		return r.SyncConfig(*configPath)
+	if mgr != nil {
+		if err := addConfigSyncReconcilerToManager(mgr, boskos.SyncConfig, configChangeEventChan, *configSyncDebounce); err != nil {
+			logrus.WithError(err).Fatal("Failed to set up config sync controller")
+		}
 	}
 
-	// Make sure config is not broken by syncing at least once. Also
-	// needed for in memory mode where the controller never gets triggered.
-	if err := syncConfig(); err != nil {
-		logrus.WithError(err).Fatal("Failed to sync config")
-	}
-	if err := addConfigSyncReconcilerToManager(mgr, syncConfig, configChangeEventChan); err != nil {
-		logrus.WithError(err).Fatal("Failed to set up config sync controller")
+	var cardinality *metrics.CardinalityConfig
+	if *metricsCardinalityConfig != "" {
+		if cardinality, err = metrics.LoadCardinalityConfig(*metricsCardinalityConfig); err != nil {
+			logrus.WithError(err).Fatal("Failed to load metrics cardinality config")
+		}
 	}
-
-	prometheus.MustRegister(metrics.NewResourcesCollector(r))
-	r.StartRequestGC(defaultRequestGCPeriod)
+	prometheus.MustRegister(metrics.NewResourcesCollector(r, cardinality, *metricsByOwner))
+	prometheus.MustRegister(metrics.NewQueueCollector(r, cardinality))
+	prometheus.MustRegister(metrics.NewCleanupBreakerCollector(r, cardinality))
+	prometheus.MustRegister(metrics.NewDynamicResourceErrorCollector(r, cardinality))
+	prometheus.MustRegister(metrics.NewDeprecatedUsageCollector(r, cardinality))
+	prometheus.MustRegister(metrics.NewConfigSyncCollector(r))
+	prometheus.MustRegister(metrics.NewStorageAbandonedCollector(r))
+	prometheus.MustRegister(metrics.NewTenantResourcesCollector(r))
 
 	logrus.Info("Start Service")
-	interrupts.ListenAndServe(boskos, 5*time.Second)
+	if err := boskos.Start(); err != nil {
+		logrus.WithError(err).Fatal("Failed to start server")
+	}
+	interrupts.OnInterrupt(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), server.DefaultShutdownTimeout)
+		defer cancel()
+		if err := boskos.Stop(ctx); err != nil {
+			logrus.WithError(err).Error("Failed to stop server gracefully")
+		}
+	})
+	interrupts.Run(func(ctx context.Context) {
+		reloadOnSIGHUP(ctx, r)
+	})
 
 	// signal to the world that we're ready
+	if *leaderElect && !*followerReady {
+		// Followers reject every change, so services route requests to the
+		// leader only.
+		go func() {
+			<-elected
+			health.ServeReady()
+		}()
+		return
+	}
 	health.ServeReady()
 }
 
+// hydrate seeds an empty storage from the cloud inventories of the hydration config.
+func hydrate(storage *ranch.Storage, configSource *configsource.Source) error {
+	hydration, err := hydrator.LoadConfig(*hydrationConfig)
+	if err != nil {
+		return fmt.Errorf("failed to load hydration config: %w", err)
+	}
+	var config *common.BoskosConfig
+	if configSource != nil {
+		config = configSource.Config()
+	} else if config, err = common.ParseConfig(*configPath); err != nil {
+		return err
+	}
+	return hydrator.Hydrate(interrupts.Context(), storage, config, hydration.BuildInventories())
+}
+
+// reloadOnSIGHUP forces a config sync on every SIGHUP, for when watching the
+// config file misses updates, like atomic symlink swaps.
+func reloadOnSIGHUP(ctx context.Context, r *ranch.Ranch) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	defer signal.Stop(signals)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+			if err := r.ReloadConfig(); err != nil {
+				logrus.WithError(err).Error("Config reload on SIGHUP failed")
+			}
+		}
+	}
+}
+
 type configSyncReconciler struct {
 	sync func() error
 }
 
+// configSyncs serializes the config syncs of the reconcilers sharing it. The
+// syncs on config changes take priority: the syncs on resource events are
+// skipped while one is waiting, as it syncs the whole config right after.
+type configSyncs struct {
+	sync func() error
+	lock sync.Mutex
+	// pending counts the syncs on config changes waiting for the lock.
+	pending int32
+}
+
+func (s *configSyncs) onConfigChange() error {
+	atomic.AddInt32(&s.pending, 1)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	atomic.AddInt32(&s.pending, -1)
+	return s.sync()
+}
+
+func (s *configSyncs) onResourceEvent() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if atomic.LoadInt32(&s.pending) > 0 {
+		return nil
+	}
+	return s.sync()
+}
+
 func (r *configSyncReconciler) Reconcile(_ context.Context, _ reconcile.Request) (reconcile.Result, error) {
 	// TODO(alvaroaleman): figure out how to use the context in the sync
 	err := r.sync()
@@ -180,19 +618,34 @@ func (r *configSyncReconciler) Reconcile(_ context.Context, _ reconcile.Request)
 	return reconcile.Result{}, err
 }
 
-func addConfigSyncReconcilerToManager(mgr manager.Manager, configSync func() error, configChangeEvent <-chan event.GenericEvent) error {
+// addConfigSyncReconcilerToManager syncs the config on config changes and on
+// resource events. Resource events are coalesced within debounce and queued
+// apart from config changes, so that heavy acquire and release traffic can
+// neither keep the config sync perpetually busy nor delay config changes
+// beyond the sync in progress.
+func addConfigSyncReconcilerToManager(mgr manager.Manager, configSync func() error, configChangeEvent <-chan event.GenericEvent, debounce time.Duration) error {
+	// We reconcile the whole config, hence this is not safe to run concurrently
+	syncs := &configSyncs{sync: configSync}
 	ctrl, err := controller.New("bokos_config_reconciler", mgr, controller.Options{
-		// We reconcile the whole config, hence this is not safe to run concurrently
 		MaxConcurrentReconciles: 1,
 		Reconciler: &configSyncReconciler{
-			sync: configSync,
+			sync: syncs.onConfigChange,
 		},
 	})
 	if err != nil {
 		return fmt.Errorf("failed to construct controller: %w", err)
 	}
+	resourceCtrl, err := controller.New("boskos_resource_reconciler", mgr, controller.Options{
+		MaxConcurrentReconciles: 1,
+		Reconciler: &configSyncReconciler{
+			sync: syncs.onResourceEvent,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to construct resource controller: %w", err)
+	}
 
-	if err := ctrl.Watch(&source.Kind{Type: &crds.ResourceObject{}}, constHandler(), resourceUpdatePredicate()); err != nil {
+	if err := resourceCtrl.Watch(&source.Kind{Type: &crds.ResourceObject{}}, debouncedHandler(debounce), resourceUpdatePredicate()); err != nil {
 		return fmt.Errorf("failed to watch boskos resources: %w", err)
 	}
 	if err := ctrl.Watch(&source.Kind{Type: &crds.DRLCObject{}}, constHandler()); err != nil {
@@ -212,6 +665,53 @@ func constHandler() handler.EventHandler {
 		})
 }
 
+// debouncedHandler enqueues a single request debounce after the first of a
+// burst of events, so that the burst triggers a single reconciliation.
+func debouncedHandler(debounce time.Duration) handler.EventHandler {
+	return newDebouncer(debounce, time.After).handler()
+}
+
+// debouncer coalesces the events received within its window.
+type debouncer struct {
+	debounce time.Duration
+	// after is time.After, unless faked by tests.
+	after func(time.Duration) <-chan time.Time
+
+	lock sync.Mutex
+	// pending is set from the first event of a window until its end.
+	pending bool
+}
+
+func newDebouncer(debounce time.Duration, after func(time.Duration) <-chan time.Time) *debouncer {
+	return &debouncer{debounce: debounce, after: after}
+}
+
+func (d *debouncer) enqueue(q workqueue.RateLimitingInterface) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.pending {
+		return
+	}
+	d.pending = true
+	windowEnd := d.after(d.debounce)
+	go func() {
+		<-windowEnd
+		d.lock.Lock()
+		d.pending = false
+		d.lock.Unlock()
+		q.Add(reconcile.Request{})
+	}()
+}
+
+func (d *debouncer) handler() handler.EventHandler {
+	return handler.Funcs{
+		CreateFunc:  func(_ event.CreateEvent, q workqueue.RateLimitingInterface) { d.enqueue(q) },
+		UpdateFunc:  func(_ event.UpdateEvent, q workqueue.RateLimitingInterface) { d.enqueue(q) },
+		DeleteFunc:  func(_ event.DeleteEvent, q workqueue.RateLimitingInterface) { d.enqueue(q) },
+		GenericFunc: func(_ event.GenericEvent, q workqueue.RateLimitingInterface) { d.enqueue(q) },
+	}
+}
+
 // resourceUpdatePredicate prevents the config reconciler from reacting to resource update events
 // except if:
 // * The new status is tombstone, because then we have to delete is
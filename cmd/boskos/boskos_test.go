@@ -0,0 +1,109 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	"sigs.k8s.io/boskos/crds"
+)
+
+func TestDebouncedHandler(t *testing.T) {
+	const burst = 50
+	// The windows end when the test says so.
+	var windows []chan time.Time
+	after := func(time.Duration) <-chan time.Time {
+		window := make(chan time.Time, 1)
+		windows = append(windows, window)
+		return window
+	}
+	q := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	defer q.ShutDown()
+	h := newDebouncer(10*time.Second, after).handler()
+
+	for window := 0; window < 2; window++ {
+		for i := 0; i < burst; i++ {
+			h.Update(event.UpdateEvent{ObjectOld: &crds.ResourceObject{}, ObjectNew: &crds.ResourceObject{}}, q)
+		}
+		if n := len(windows); n != window+1 {
+			t.Fatalf("expected a single window for a burst of %d events, got %d windows", burst, n-window)
+		}
+		if n := q.Len(); n != 0 {
+			t.Fatalf("expected no sync before the end of the window, got %d", n)
+		}
+		windows[window] <- time.Time{}
+		item, _ := q.Get()
+		if n := q.Len(); n != 0 {
+			t.Fatalf("expected a single sync for a burst of %d events, got %d", burst, n+1)
+		}
+		q.Done(item)
+		q.Forget(item)
+	}
+}
+
+func TestConfigSyncsPrioritizeConfigChanges(t *testing.T) {
+	var synced []string
+	inProgress, release := make(chan struct{}), make(chan struct{})
+	syncs := &configSyncs{sync: func() error {
+		if len(synced) == 0 {
+			close(inProgress)
+			<-release
+		}
+		synced = append(synced, "sync")
+		return nil
+	}}
+
+	// A sync on resource events is in progress when the config changes.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		syncs.onResourceEvent()
+	}()
+	<-inProgress
+	configChanged := make(chan struct{})
+	go func() {
+		defer close(configChanged)
+		syncs.onConfigChange()
+	}()
+	for {
+		if atomic.LoadInt32(&syncs.pending) == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	close(release)
+	<-done
+	<-configChanged
+	if len(synced) != 2 {
+		t.Fatalf("expected the sync in progress and the config change to sync, got %d syncs", len(synced))
+	}
+
+	// Resource events do not sync while a config change waits to.
+	atomic.StoreInt32(&syncs.pending, 1)
+	if err := syncs.onResourceEvent(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(synced) != 2 {
+		t.Errorf("expected resource events to be skipped while a config change waits, got %d syncs", len(synced))
+	}
+}
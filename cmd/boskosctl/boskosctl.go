@@ -20,10 +20,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"math/rand"
 	"os"
 	"os/signal"
 	"strconv"
+	"syscall"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -36,7 +38,9 @@ type options struct {
 	serverURL    string
 	username     string
 	passwordFile string
+	tokenFile    string
 	ownerName    string
+	tenant       string
 
 	c *client.Client
 
@@ -44,6 +48,7 @@ type options struct {
 	release   releaseOptions
 	metrics   metricsOptions
 	heartbeat heartbeatOptions
+	importing importOptions
 }
 
 func (o *options) initializeClient() error {
@@ -51,15 +56,40 @@ func (o *options) initializeClient() error {
 	if err != nil {
 		return err
 	}
+	c.SetTenant(o.tenant)
+	if o.tokenFile != "" {
+		if err := c.SetTokenFile(o.tokenFile); err != nil {
+			return err
+		}
+	}
 	o.c = c
 	return nil
 }
 
 type acquireOptions struct {
-	requestedType  string
-	requestedState string
-	targetState    string
-	timeout        time.Duration
+	requestedType   string
+	requestedState  string
+	targetState     string
+	timeout         time.Duration
+	leaseFile       string
+	releaseOnExit   string
+	heartbeatPeriod time.Duration
+	parentPID       int
+}
+
+// lease is the format of the lease file written by acquire --lease-file.
+type lease struct {
+	// Resource is the leased resource, as printed by acquire.
+	Resource common.Resource `json:"resource"`
+	// Server is the URL of the Boskos server the resource was leased from.
+	Server string `json:"server"`
+	// Owner is the owner of the lease.
+	Owner string `json:"owner"`
+	// AcquiredAt is when the resource was leased.
+	AcquiredAt time.Time `json:"acquiredAt"`
+	// ReleaseState is the state the resource is released to by boskosctl when
+	// --release-on-exit is set.
+	ReleaseState string `json:"releaseState,omitempty"`
 }
 
 type releaseOptions struct {
@@ -78,6 +108,11 @@ type heartbeatOptions struct {
 	retries      int
 }
 
+type importOptions struct {
+	file   string
+	dryRun bool
+}
+
 // for test mocking
 var exit func(int)
 var randId func() string
@@ -102,6 +137,8 @@ scripts with a simple interface.`,
 	root.PersistentFlags().StringVar(&options.serverURL, "server-url", "", "URL of the Boskos server")
 	root.PersistentFlags().StringVar(&options.username, "username", "", "Username used to access the Boskos server")
 	root.PersistentFlags().StringVar(&options.passwordFile, "password-file", "", "The path to password file used to access the Boskos server")
+	root.PersistentFlags().StringVar(&options.tokenFile, "token-file", "", "The path to a file holding a scoped token used to access the Boskos server instead of a username and password")
+	root.PersistentFlags().StringVar(&options.tenant, "tenant", "", "The tenant to acquire resources on behalf of, when the resource pools are split between tenants")
 	root.PersistentFlags().StringVar(&options.ownerName, "owner-name", "", "Name identifying the user of this client")
 	for _, flag := range []string{"server-url", "owner-name"} {
 		if err := root.MarkPersistentFlagRequired(flag); err != nil {
@@ -130,7 +167,12 @@ Examples:
   $ boskosctl acquire --type my-thing --state clean --target-state dirty
 
   # Acquire one new "my-thing" and mark it old when leasing, block until successfully leased
-  $ boskosctl acquire --type my-thing --state new --target-state old --timeout 30s`,
+  $ boskosctl acquire --type my-thing --state new --target-state old --timeout 30s
+
+  # Acquire one clean "my-thing" in the background, keep the lease alive and
+  # release it dirty once the calling script exits or boskosctl is terminated
+  $ boskosctl acquire --type my-thing --state clean --target-state busy \
+      --lease-file lease.json --release-on-exit dirty --parent-pid $$ &`,
 		Run: func(cmd *cobra.Command, args []string) {
 			if err := options.initializeClient(); err != nil {
 				fmt.Fprintf(cmd.ErrOrStderr(), "failed to initialize the Boskos client: %v\n", err)
@@ -163,7 +205,23 @@ Examples:
 				exit(1)
 				return
 			}
+			if options.acquire.leaseFile != "" {
+				if err := writeLease(options.acquire.leaseFile, lease{
+					Resource:     *resource,
+					Server:       options.serverURL,
+					Owner:        options.ownerName,
+					AcquiredAt:   time.Now(),
+					ReleaseState: options.acquire.releaseOnExit,
+				}); err != nil {
+					fmt.Fprintf(cmd.ErrOrStderr(), "failed to write lease file: %v\n", err)
+					exit(1)
+					return
+				}
+			}
 			fmt.Fprintln(cmd.OutOrStdout(), string(raw))
+			if options.acquire.releaseOnExit != "" {
+				holdLease(cmd, &options, resource)
+			}
 		},
 		Args: cobra.NoArgs,
 	}
@@ -177,6 +235,10 @@ Examples:
 		}
 	}
 	acquire.Flags().DurationVar(&options.acquire.timeout, "timeout", 0*time.Second, "If set, retry this long until the resource has been acquired")
+	acquire.Flags().StringVar(&options.acquire.leaseFile, "lease-file", "", "If set, write the lease of the acquired resource to this file in JSON")
+	acquire.Flags().StringVar(&options.acquire.releaseOnExit, "release-on-exit", "", "If set, keep running after acquiring to heartbeat the lease, and release the resource to this state when interrupted or terminated")
+	acquire.Flags().DurationVar(&options.acquire.heartbeatPeriod, "heartbeat-period", 30*time.Second, "With --release-on-exit, period to send heartbeats on")
+	acquire.Flags().IntVar(&options.acquire.parentPID, "parent-pid", 0, "With --release-on-exit, also release the resource once this process exits")
 	root.AddCommand(acquire)
 
 	release := &cobra.Command{
@@ -353,9 +415,154 @@ Examples:
 	heartbeat.Flags().IntVar(&options.heartbeat.retries, "retries", 10, "How many failed heartbeats to tolerate")
 	root.AddCommand(heartbeat)
 
+	importCmd := &cobra.Command{
+		Use:   "import",
+		Short: "Import existing resources",
+		Long: `Import existing resources, blocking.
+
+Resources of the static types of the Boskos config are created from a
+CSV or JSON file, for onboarding fleets which already exist. CSV files
+need a header with name and type columns, and an optional state column
+defaulting to the state of the type in the config; other columns are
+set as user data. JSON files hold a list of objects with name, type,
+state and userdata fields.
+
+All resources are validated before any is created: if one is invalid,
+nothing is imported. Resources which already exist are skipped. A
+summary of what was created is printed in JSON.
+
+Examples:
+
+  # Check what would be imported from "fleet.csv"
+  $ boskosctl import --file fleet.csv --dry-run
+
+  # Import the resources in "fleet.json"
+  $ boskosctl import --file fleet.json`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := options.initializeClient(); err != nil {
+				fmt.Fprintf(cmd.ErrOrStderr(), "failed to initialize the Boskos client: %v\n", err)
+				return
+			}
+			resources, err := readImportFile(options.importing.file)
+			if err != nil {
+				fmt.Fprintf(cmd.ErrOrStderr(), "failed to read resources to import: %v\n", err)
+				exit(1)
+				return
+			}
+
+			importAll := func(dryRun bool) (*common.ImportSummary, error) {
+				total := &common.ImportSummary{DryRun: dryRun}
+				for start := 0; start < len(resources); start += importBatchSize {
+					end := start + importBatchSize
+					if end > len(resources) {
+						end = len(resources)
+					}
+					summary, err := options.c.ImportResources(resources[start:end], dryRun)
+					if summary != nil {
+						mergeSummary(total, summary, start)
+					}
+					if err != nil {
+						return total, err
+					}
+				}
+				return total, nil
+			}
+
+			// validate every batch first, so that nothing is imported unless
+			// all resources are valid
+			summary, err := importAll(true)
+			if err == nil && !options.importing.dryRun {
+				summary, err = importAll(false)
+			}
+			if err != nil && err != client.ErrInvalidImport {
+				fmt.Fprintf(cmd.ErrOrStderr(), "failed to import resources: %v\n", err)
+				exit(1)
+				return
+			}
+			raw, marshalErr := json.Marshal(summary)
+			if marshalErr != nil {
+				fmt.Fprintf(cmd.ErrOrStderr(), "failed to marshal import summary: %v\n", marshalErr)
+				exit(1)
+				return
+			}
+			if err != nil {
+				fmt.Fprintf(cmd.ErrOrStderr(), "failed to import resources: %v: %s\n", err, string(raw))
+				exit(1)
+				return
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), string(raw))
+		},
+		Args: cobra.NoArgs,
+	}
+	importCmd.Flags().StringVar(&options.importing.file, "file", "", "CSV or JSON file with the resources to import")
+	for _, flag := range []string{"file"} {
+		if err := importCmd.MarkFlagRequired(flag); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	importCmd.Flags().BoolVar(&options.importing.dryRun, "dry-run", false, "Only validate the resources and print what would be imported")
+	root.AddCommand(importCmd)
+
 	return root
 }
 
+// writeLease writes l to path atomically, so scripts waiting for the file
+// never read a partial lease.
+func writeLease(path string, l lease) error {
+	raw, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, raw, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// holdLease sends heartbeats for resource until boskosctl is interrupted or
+// terminated, or the parent process exits, then releases the resource and
+// removes the lease file.
+func holdLease(cmd *cobra.Command, o *options, resource *common.Resource) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(sig)
+	tick := time.NewTicker(o.acquire.heartbeatPeriod)
+	defer tick.Stop()
+
+	wait := func() string {
+		for {
+			select {
+			case s := <-sig:
+				return fmt.Sprintf("received %v", s)
+			case <-tick.C:
+				if o.acquire.parentPID != 0 && !processAlive(o.acquire.parentPID) {
+					return fmt.Sprintf("parent process %d exited", o.acquire.parentPID)
+				}
+				if err := o.c.Update(resource.Name, resource.State, resource.UserData); err != nil {
+					// the reaper takes the lease back if heartbeats keep failing
+					fmt.Fprintf(cmd.ErrOrStderr(), "failed to send heartbeat for resource %q: %v\n", resource.Name, err)
+				}
+			}
+		}
+	}
+	reason := wait()
+
+	fmt.Fprintf(cmd.OutOrStdout(), "%s, releasing resource %q\n", reason, resource.Name)
+	if err := o.c.Release(resource.Name, o.acquire.releaseOnExit); err != nil {
+		fmt.Fprintf(cmd.ErrOrStderr(), "failed to release resource %q: %v\n", resource.Name, err)
+		exit(1)
+		return
+	}
+	if o.acquire.leaseFile != "" {
+		if err := os.Remove(o.acquire.leaseFile); err != nil {
+			fmt.Fprintf(cmd.ErrOrStderr(), "failed to remove lease file: %v\n", err)
+		}
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "released resource %q\n", resource.Name)
+}
+
 func main() {
 	exit = os.Exit
 	rand.Seed(time.Now().UTC().UnixNano())
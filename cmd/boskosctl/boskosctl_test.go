@@ -18,12 +18,15 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"reflect"
 	"testing"
 	"time"
@@ -85,16 +88,22 @@ Usage:
   boskosctl acquire [flags]
 
 Flags:
-  -h, --help                  help for acquire
-      --state string          State to acquire the resource in
-      --target-state string   Move resource to this state after acquiring
-      --timeout duration      If set, retry this long until the resource has been acquired
-      --type string           Type of resource to acquire
+      --heartbeat-period duration   With --release-on-exit, period to send heartbeats on (default 30s)
+  -h, --help                        help for acquire
+      --lease-file string           If set, write the lease of the acquired resource to this file in JSON
+      --parent-pid int              With --release-on-exit, also release the resource once this process exits
+      --release-on-exit string      If set, keep running after acquiring to heartbeat the lease, and release the resource to this state when interrupted or terminated
+      --state string                State to acquire the resource in
+      --target-state string         Move resource to this state after acquiring
+      --timeout duration            If set, retry this long until the resource has been acquired
+      --type string                 Type of resource to acquire
 
 Global Flags:
       --owner-name string      Name identifying the user of this client
       --password-file string   The path to password file used to access the Boskos server
       --server-url string      URL of the Boskos server
+      --tenant string          The tenant to acquire resources on behalf of, when the resource pools are split between tenants
+      --token-file string      The path to a file holding a scoped token used to access the Boskos server instead of a username and password
       --username string        Username used to access the Boskos server
 
 `,
@@ -220,6 +229,8 @@ Global Flags:
       --owner-name string      Name identifying the user of this client
       --password-file string   The path to password file used to access the Boskos server
       --server-url string      URL of the Boskos server
+      --tenant string          The tenant to acquire resources on behalf of, when the resource pools are split between tenants
+      --token-file string      The path to a file holding a scoped token used to access the Boskos server instead of a username and password
       --username string        Username used to access the Boskos server
 
 `,
@@ -276,6 +287,8 @@ Global Flags:
       --owner-name string      Name identifying the user of this client
       --password-file string   The path to password file used to access the Boskos server
       --server-url string      URL of the Boskos server
+      --tenant string          The tenant to acquire resources on behalf of, when the resource pools are split between tenants
+      --token-file string      The path to a file holding a scoped token used to access the Boskos server instead of a username and password
       --username string        Username used to access the Boskos server
 
 `,
@@ -345,6 +358,8 @@ Global Flags:
       --owner-name string      Name identifying the user of this client
       --password-file string   The path to password file used to access the Boskos server
       --server-url string      URL of the Boskos server
+      --tenant string          The tenant to acquire resources on behalf of, when the resource pools are split between tenants
+      --token-file string      The path to a file holding a scoped token used to access the Boskos server instead of a username and password
       --username string        Username used to access the Boskos server
 
 `,
@@ -481,7 +496,15 @@ failed to send heartbeat for resource "87527b0c-eac2-4f83-9a03-791b2239e093": st
 					t.Errorf("%s: request %d: incorrect path, expected %s, saw %s", testCase.name, i, expected, actual)
 				}
 
-				if expected, actual := testCase.expectedCalls[i].url.Query(), request.url.Query(); !reflect.DeepEqual(expected, actual) {
+				actualQuery := request.url.Query()
+				// Long polls wait for what is left of the timeout, which varies.
+				if wait := actualQuery.Get("wait"); wait != "" && testCase.expectedCalls[i].url.Query().Get("wait") == "" {
+					if _, err := time.ParseDuration(wait); err != nil {
+						t.Errorf("%s: request %d: invalid wait %q: %v", testCase.name, i, wait, err)
+					}
+					actualQuery.Del("wait")
+				}
+				if expected, actual := testCase.expectedCalls[i].url.Query(), actualQuery; !reflect.DeepEqual(expected, actual) {
 					t.Errorf("%s: request %d: incorrect query: %s", testCase.name, i, diff.ObjectReflectDiff(expected, actual))
 				}
 
@@ -501,3 +524,84 @@ failed to send heartbeat for resource "87527b0c-eac2-4f83-9a03-791b2239e093": st
 		})
 	}
 }
+
+func TestAcquireLeaseFile(t *testing.T) {
+	// a process that already exited stands in for the calling script
+	parent := exec.Command(os.Args[0], "-test.run=^$")
+	if err := parent.Run(); err != nil {
+		t.Fatalf("failed to run parent process: %v", err)
+	}
+
+	var testCases = []struct {
+		name          string
+		args          []string
+		expectedPaths []string
+		expectLease   bool
+	}{
+		{
+			name:          "lease file is written",
+			args:          []string{},
+			expectedPaths: []string{"/acquire"},
+			expectLease:   true,
+		},
+		{
+			name:          "resource is released and lease file removed once the parent exits",
+			args:          []string{"--release-on-exit=dirty", "--heartbeat-period=10ms", fmt.Sprintf("--parent-pid=%d", parent.Process.Pid)},
+			expectedPaths: []string{"/acquire", "/release"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "boskosctl")
+			if err != nil {
+				t.Fatalf("failed to create temp dir: %v", err)
+			}
+			defer os.RemoveAll(dir)
+			leaseFile := filepath.Join(dir, "lease.json")
+
+			var paths []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				paths = append(paths, r.URL.Path)
+				if r.URL.Path == "/acquire" {
+					w.Write([]byte(`{"type":"thing","name":"thing-1","state":"old","owner":"test","lastupdate":"2019-07-24T23:30:40.094116858Z","userdata":{}}`))
+				}
+			}))
+			defer server.Close()
+
+			exit = func(i int) {
+				t.Errorf("expected not to exit, got %d", i)
+			}
+			cmd := command()
+			var buf bytes.Buffer
+			cmd.SetOut(&buf)
+			cmd.SetErr(&buf)
+			args := []string{"acquire", "--state=new", "--type=thing", "--target-state=old", "--lease-file=" + leaseFile}
+			cmd.SetArgs(append(append(args, testCase.args...), fmt.Sprintf("--server-url=%s", server.URL), "--owner-name=test"))
+			if err := cmd.Execute(); err != nil {
+				t.Fatalf("expected no error but got one: %v", err)
+			}
+
+			if !reflect.DeepEqual(testCase.expectedPaths, paths) {
+				t.Errorf("expected calls to %v, saw %v", testCase.expectedPaths, paths)
+			}
+			raw, err := ioutil.ReadFile(leaseFile)
+			if !testCase.expectLease {
+				if !os.IsNotExist(err) {
+					t.Errorf("expected the lease file to be removed, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to read lease file: %v", err)
+			}
+			var l lease
+			if err := json.Unmarshal(raw, &l); err != nil {
+				t.Fatalf("failed to parse lease file: %v", err)
+			}
+			if l.Resource.Name != "thing-1" || l.Server != server.URL || l.Owner != "test" {
+				t.Errorf("got incorrect lease: %+v", l)
+			}
+		})
+	}
+}
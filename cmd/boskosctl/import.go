@@ -0,0 +1,103 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+// importBatchSize is the number of resources sent per /import request, which
+// the server bounds.
+const importBatchSize = 1000
+
+// readImportFile reads the resources to import from path. CSV files need a
+// header with name and type columns, and an optional state column; any other
+// column is set as user data. Any other file is read as a JSON list.
+func readImportFile(path string) ([]common.ImportedResource, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(filepath.Ext(path), ".csv") {
+		var resources []common.ImportedResource
+		if err := json.Unmarshal(raw, &resources); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+		}
+		return resources, nil
+	}
+
+	records, err := csv.NewReader(bytes.NewReader(raw)).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%s has no header", path)
+	}
+	header := records[0]
+	columns := map[string]int{}
+	for idx, column := range header {
+		columns[column] = idx
+	}
+	for _, column := range []string{"name", "type"} {
+		if _, ok := columns[column]; !ok {
+			return nil, fmt.Errorf("%s has no %s column", path, column)
+		}
+	}
+
+	var resources []common.ImportedResource
+	for _, record := range records[1:] {
+		var resource common.ImportedResource
+		for idx, value := range record {
+			switch header[idx] {
+			case "name":
+				resource.Name = value
+			case "type":
+				resource.Type = value
+			case "state":
+				resource.State = value
+			default:
+				if value == "" {
+					continue
+				}
+				if resource.UserData == nil {
+					resource.UserData = common.UserDataMap{}
+				}
+				resource.UserData[header[idx]] = value
+			}
+		}
+		resources = append(resources, resource)
+	}
+	return resources, nil
+}
+
+// mergeSummary adds the summary of the batch starting at offset to total.
+func mergeSummary(total, batch *common.ImportSummary, offset int) {
+	total.Created = append(total.Created, batch.Created...)
+	total.Existing = append(total.Existing, batch.Existing...)
+	for _, invalid := range batch.Invalid {
+		invalid.Index += offset
+		total.Invalid = append(total.Invalid, invalid)
+	}
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/diff"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+func TestReadImportFile(t *testing.T) {
+	testCases := []struct {
+		name      string
+		file      string
+		content   string
+		expected  []common.ImportedResource
+		expectErr bool
+	}{
+		{
+			name:    "csv with user data",
+			file:    "fleet.csv",
+			content: "name,type,state,region\nproject-1,gcp-project,,us-east1\nproject-2,gcp-project,dirty,\n",
+			expected: []common.ImportedResource{
+				{Name: "project-1", Type: "gcp-project", UserData: common.UserDataMap{"region": "us-east1"}},
+				{Name: "project-2", Type: "gcp-project", State: "dirty"},
+			},
+		},
+		{
+			name:      "csv without type column",
+			file:      "fleet.csv",
+			content:   "name,state\nproject-1,free\n",
+			expectErr: true,
+		},
+		{
+			name:    "json",
+			file:    "fleet.json",
+			content: `[{"name":"project-1","type":"gcp-project","userdata":{"region":"us-east1"}}]`,
+			expected: []common.ImportedResource{
+				{Name: "project-1", Type: "gcp-project", UserData: common.UserDataMap{"region": "us-east1"}},
+			},
+		},
+		{
+			name:      "invalid json",
+			file:      "fleet.json",
+			content:   `{"name":"project-1"}`,
+			expectErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "import")
+			if err != nil {
+				t.Fatalf("failed to create temp dir: %v", err)
+			}
+			defer os.RemoveAll(dir)
+			path := filepath.Join(dir, tc.file)
+			if err := ioutil.WriteFile(path, []byte(tc.content), 0644); err != nil {
+				t.Fatalf("failed to write file: %v", err)
+			}
+
+			resources, err := readImportFile(path)
+			if tc.expectErr != (err != nil) {
+				t.Fatalf("expected error %t, got %v", tc.expectErr, err)
+			}
+			if !reflect.DeepEqual(tc.expected, resources) {
+				t.Errorf("got incorrect resources: %s", diff.ObjectReflectDiff(tc.expected, resources))
+			}
+		})
+	}
+}
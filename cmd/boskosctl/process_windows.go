@@ -0,0 +1,37 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import "syscall"
+
+// stillActive is the exit code of processes that did not exit yet.
+const stillActive = 259
+
+// processAlive determines whether the process with the given pid still runs.
+// Windows cannot signal processes, so their exit code is queried instead.
+func processAlive(pid int) bool {
+	process, err := syscall.OpenProcess(syscall.PROCESS_QUERY_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return false
+	}
+	defer syscall.CloseHandle(process)
+	var code uint32
+	if err := syscall.GetExitCodeProcess(process, &code); err != nil {
+		return false
+	}
+	return code == stillActive
+}
@@ -39,6 +39,7 @@ import (
 	"sigs.k8s.io/boskos/cleaner"
 	cleanerv2 "sigs.k8s.io/boskos/cleaner/v2"
 	"sigs.k8s.io/boskos/client"
+	"sigs.k8s.io/boskos/common/logging"
 	"sigs.k8s.io/boskos/crds"
 	"sigs.k8s.io/boskos/ranch"
 )
@@ -52,6 +53,7 @@ const (
 var (
 	kubeClientOptions      crds.KubernetesClientOptions
 	instrumentationOptions prowflagutil.InstrumentationOptions
+	loggingOptions         logging.Options
 
 	boskosURL           string
 	username            string
@@ -74,7 +76,7 @@ func init() {
 
 func main() {
 	logrusutil.ComponentInit()
-	for _, o := range []flagutil.OptionGroup{&kubeClientOptions, &instrumentationOptions} {
+	for _, o := range []flagutil.OptionGroup{&kubeClientOptions, &instrumentationOptions, &loggingOptions} {
 		o.AddFlags(flag.CommandLine)
 	}
 	flag.Parse()
@@ -84,11 +86,12 @@ func main() {
 		logrus.WithError(err).Fatal("invalid log level specified")
 	}
 	logrus.SetLevel(level)
-	for _, o := range []flagutil.OptionGroup{&kubeClientOptions, &instrumentationOptions} {
+	for _, o := range []flagutil.OptionGroup{&kubeClientOptions, &instrumentationOptions, &loggingOptions} {
 		if err := o.Validate(false); err != nil {
 			logrus.Fatalf("Invalid options: %v", err)
 		}
 	}
+	loggingOptions.Configure(level)
 
 	client, err := client.NewClient(defaultOwner, boskosURL, username, passwordFile)
 	if err != nil {
@@ -0,0 +1,94 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"sigs.k8s.io/boskos/aws-janitor/account"
+	"sigs.k8s.io/boskos/aws-janitor/regions"
+	"sigs.k8s.io/boskos/aws-janitor/resources"
+	s3path "sigs.k8s.io/boskos/aws-janitor/s3"
+	"sigs.k8s.io/boskos/cloudjanitor"
+)
+
+// awsProvider marks and sweeps the resources of an AWS account like
+// aws-janitor does, with the same flags.
+type awsProvider struct {
+	flags resources.Flags
+}
+
+func (p *awsProvider) Name() string {
+	return "aws"
+}
+
+func (p *awsProvider) AddFlags(fs *flag.FlagSet) {
+	p.flags.AddFlags(fs)
+}
+
+func (p *awsProvider) Sweep(_ context.Context, opts cloudjanitor.Options, report *cloudjanitor.Report) error {
+	if p.flags.Path == "" {
+		return errors.New("--path must be set")
+	}
+
+	// Retry aggressively, as the API may be rate limited while cleaning up
+	// an account in a bad state.
+	sess := session.Must(session.NewSessionWithOptions(session.Options{Config: aws.Config{MaxRetries: aws.Int(100)}}))
+	acct, err := account.GetAccount(sess, regions.Default)
+	if err != nil {
+		return errors.Wrap(err, "failed retrieving account")
+	}
+	logrus.Debugf("account: %s", acct)
+
+	sweepOpts, err := p.flags.Options(sess, acct)
+	if err != nil {
+		return err
+	}
+	sweepOpts.DryRun = opts.DryRun
+	if opts.ExclusionsFile != "" {
+		if sweepOpts.Exclusions, err = resources.LoadExclusions(opts.ExclusionsFile); err != nil {
+			return errors.Wrap(err, "invalid --exclusions-file")
+		}
+	}
+
+	s3p, err := s3path.GetPath(sess, p.flags.Path)
+	if err != nil {
+		return errors.Wrapf(err, "--path %q isn't a valid S3 path", p.flags.Path)
+	}
+	// The mark data must survive the sweep of the S3 buckets.
+	sweepOpts.KeepBuckets = sets.NewString(s3p.Bucket)
+	regionList, err := regions.ParseRegion(sess, p.flags.Region)
+	if err != nil {
+		return err
+	}
+	logrus.Infof("Regions: %+v", regionList)
+	set, err := resources.LoadSet(sess, s3p, opts.TTL)
+	if err != nil {
+		return errors.Wrapf(err, "Error loading %q", p.flags.Path)
+	}
+
+	_, err = resources.MarkSweepAndSave(sweepOpts, regionList, set, s3p)
+	report.Swept = append(report.Swept, set.Swept()...)
+	return err
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+
+	"sigs.k8s.io/boskos/aws-janitor/resources"
+	"sigs.k8s.io/boskos/cloudjanitor"
+	"sigs.k8s.io/boskos/common"
+)
+
+// gcpProvider sweeps GCP projects with the GCP janitor script.
+type gcpProvider struct {
+	projects     common.CommaSeparatedStrings
+	onlyTypes    common.CommaSeparatedStrings
+	janitorPath  string
+	inventoryDir string
+	// run runs the janitor script with args, returning its combined output.
+	run func(ctx context.Context, path string, args ...string) ([]byte, error)
+}
+
+func (p *gcpProvider) Name() string {
+	return "gcp"
+}
+
+func (p *gcpProvider) AddFlags(fs *flag.FlagSet) {
+	fs.Var(&p.projects, "project", "Comma-separated list of the GCP projects to clean")
+	fs.Var(&p.onlyTypes, "only-type", "If set, only sweep resources of these comma-separated types, e.g. instances,clusters")
+	fs.StringVar(&p.janitorPath, "janitor-path", "/bin/gcp_janitor.py", "Path to the GCP janitor script")
+	fs.StringVar(&p.inventoryDir, "inventory-dir", "", "If set, keep the inventories of the swept resources in this directory, so that each run reports the new leaks and the resources which survived deletion")
+}
+
+func (p *gcpProvider) Sweep(ctx context.Context, opts cloudjanitor.Options, report *cloudjanitor.Report) error {
+	if len(p.projects) == 0 {
+		return errors.New("--project must be set")
+	}
+	var exclusions *resources.Exclusions
+	if opts.ExclusionsFile != "" {
+		var err error
+		if exclusions, err = resources.LoadExclusions(opts.ExclusionsFile); err != nil {
+			return fmt.Errorf("invalid --exclusions-file: %w", err)
+		}
+	}
+	inventoryDir := p.inventoryDir
+	if inventoryDir == "" {
+		// The inventories are how the script tells what it swept.
+		dir, err := ioutil.TempDir("", "cloud-janitor")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+		inventoryDir = dir
+	}
+	run := p.run
+	if run == nil {
+		run = runScript
+	}
+
+	args := []string{
+		"--hours=" + strconv.FormatFloat(opts.TTL.Hours(), 'f', -1, 64),
+		"--inventory_dir=" + inventoryDir,
+	}
+	if opts.DryRun {
+		args = append(args, "--dryrun")
+	}
+	if len(p.onlyTypes) > 0 {
+		args = append(args, "--only_type="+strings.Join(p.onlyTypes, ","))
+	}
+	for _, pattern := range exclusions.Patterns() {
+		args = append(args, "--exclude_pattern="+pattern)
+	}
+
+	var errs []error
+	for _, project := range p.projects {
+		logrus.Infof("executing janitor: %s --project=%s %s", p.janitorPath, project, strings.Join(args, " "))
+		out, err := run(ctx, p.janitorPath, append([]string{"--project=" + project}, args...)...)
+		if err != nil {
+			logrus.WithError(err).Errorf("failed to clean up project %s, error info: %s", project, string(out))
+			errs = append(errs, fmt.Errorf("project %s: %w", project, err))
+		} else {
+			logrus.Tracef("output from janitor: %s", string(out))
+		}
+		swept, err := readInventory(inventoryDir, project)
+		if err != nil {
+			logrus.WithError(err).Warningf("failed to read the inventory of project %s", project)
+			continue
+		}
+		for _, key := range swept {
+			report.Swept = append(report.Swept, project+"/"+key)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+func runScript(ctx context.Context, path string, args ...string) ([]byte, error) {
+	return exec.CommandContext(ctx, path, args...).CombinedOutput()
+}
+
+// readInventory returns the resources the GCP janitor deleted in project, or
+// would have deleted on a dry run, as saved in its inventory.
+func readInventory(dir, project string) ([]string, error) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, project+".json"))
+	if err != nil {
+		return nil, err
+	}
+	var inventory struct {
+		Resources []string `json:"resources"`
+	}
+	if err := json.Unmarshal(b, &inventory); err != nil {
+		return nil, err
+	}
+	return inventory.Resources, nil
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"sigs.k8s.io/boskos/cloudjanitor"
+)
+
+func TestGCPSweep(t *testing.T) {
+	exclusionsFile := filepath.Join(t.TempDir(), "exclusions.yaml")
+	if err := ioutil.WriteFile(exclusionsFile, []byte("- resource: shared-network\n- pattern: ^keep-"), 0644); err != nil {
+		t.Fatalf("failed to write exclusions: %v", err)
+	}
+
+	calls := map[string][]string{}
+	p := &gcpProvider{
+		projects:    []string{"project-1", "project-2"},
+		janitorPath: "gcp_janitor.py",
+		run: func(_ context.Context, path string, args ...string) ([]byte, error) {
+			project := strings.TrimPrefix(args[0], "--project=")
+			calls[project] = args[1:]
+			if project == "project-2" {
+				return []byte("quota exceeded"), errors.New("exit status 1")
+			}
+			var dir string
+			for _, arg := range args {
+				if strings.HasPrefix(arg, "--inventory_dir=") {
+					dir = strings.TrimPrefix(arg, "--inventory_dir=")
+				}
+			}
+			b, _ := json.Marshal(map[string][]string{"resources": {"compute/instances/zone/vm-1"}})
+			return nil, ioutil.WriteFile(filepath.Join(dir, project+".json"), b, 0644)
+		},
+	}
+	report := &cloudjanitor.Report{}
+	err := p.Sweep(context.Background(), cloudjanitor.Options{TTL: 90 * time.Minute, DryRun: true, ExclusionsFile: exclusionsFile}, report)
+	if err == nil || !strings.Contains(err.Error(), "project project-2") {
+		t.Errorf("expected the failure of project-2, got %v", err)
+	}
+	if expected := []string{"project-1/compute/instances/zone/vm-1"}; !reflect.DeepEqual(expected, report.Swept) {
+		t.Errorf("expected swept %v, got %v", expected, report.Swept)
+	}
+
+	args := calls["project-1"]
+	if len(args) < 2 {
+		t.Fatalf("unexpected arguments %v", args)
+	}
+	expected := []string{"--hours=1.5", args[1], "--dryrun", `--exclude_pattern=^shared-network$`, "--exclude_pattern=^keep-"}
+	if !reflect.DeepEqual(expected, args) {
+		t.Errorf("expected arguments %v, got %v", expected, args)
+	}
+}
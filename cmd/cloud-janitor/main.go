@@ -0,0 +1,40 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// cloud-janitor sweeps the leaked resources of a cloud provider, named by its
+// subcommand, with the same flags for every provider:
+//
+//	cloud-janitor aws --path=s3://bucket/janitor.json --ttl=24h --report=-
+//	cloud-janitor gcp --project=my-project --ttl=24h --dry-run
+package main
+
+import (
+	"context"
+	"os"
+
+	"k8s.io/test-infra/prow/logrusutil"
+
+	"sigs.k8s.io/boskos/cloudjanitor"
+	"sigs.k8s.io/boskos/janitor"
+)
+
+func main() {
+	logrusutil.ComponentInit()
+	ctx, cancel := janitor.SignalContext(context.Background())
+	code := cloudjanitor.Run(ctx, os.Args[1:], &awsProvider{}, &gcpProvider{})
+	cancel()
+	os.Exit(code)
+}
@@ -0,0 +1,33 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// janitorCommand runs the janitor at path. Windows ignores the shebang of
+// scripts, so python scripts are run by the python on the PATH.
+func janitorCommand(ctx context.Context, path string, args ...string) *exec.Cmd {
+	if strings.EqualFold(filepath.Ext(path), ".py") {
+		return exec.CommandContext(ctx, "python", append([]string{path}, args...)...)
+	}
+	return exec.CommandContext(ctx, path, args...)
+}
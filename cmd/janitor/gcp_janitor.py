@@ -21,6 +21,7 @@ import collections
 import datetime
 import json
 import os
+import re
 import subprocess
 import sys
 import threading
@@ -167,6 +168,10 @@ ZONES = [
     'us-west4-c',
 ]
 
+# Keys of the resources found to clean during this run, see inventory_key.
+INVENTORY = set()
+
+
 def log(message):
     """ print a message if --verbose is set. """
     if ARGS.verbose:
@@ -208,6 +213,12 @@ def validate_item(item, age, resource, clear_all):
     if resource.preserved_names and item['name'] in resource.preserved_names:
         return False
 
+    if ARGS.only_resource and item['name'] not in ARGS.only_resource:
+        return False
+
+    if excluded(item['name']):
+        return False
+
     if resource.managed:
         if 'isManaged' not in item:
             raise ValueError(resource.name, resource.managed)
@@ -301,6 +312,8 @@ def collect(project, age, resource, filt, clear_all):
 
         if validate_item(item, age, resource, clear_all):
             col[colname].append(item['name'])
+            INVENTORY.add(inventory_key(resource.group, resource.name, resource.subgroup,
+                                        colname, item['name']))
     return col
 
 def asyncCall(cmd, tolerate, name, errs, lock, hide_output):
@@ -415,6 +428,10 @@ def clean_gke_cluster(project, age, filt):
             log('cluster info: %r' % item)
             if 'name' not in item or 'createTime' not in item:
                 raise ValueError('name and createTime must be present: %r' % item)
+            if ARGS.only_resource and item['name'] not in ARGS.only_resource:
+                continue
+            if excluded(item['name']):
+                continue
             if not ('zone' in item or 'region' in item):
                 raise ValueError('either zone or region must be present: %r' % item)
 
@@ -428,6 +445,8 @@ def clean_gke_cluster(project, age, filt):
             if created < age:
                 log('Found stale gke cluster %r in %r, created time = %r' %
                     (item['name'], endpoint, item['createTime']))
+                INVENTORY.add(inventory_key('container', 'clusters', None,
+                                            item.get('zone', item.get('region')), item['name']))
                 delete = [
                     'gcloud', 'container', '-q', 'clusters', 'delete',
                     item['name'],
@@ -488,6 +507,71 @@ def api_enabled(project, api):
     return False
 
 
+def inventory_key(group, name, subgroup, condition, item):
+    """ Return the key identifying a resource across runs. """
+    return '/'.join(part for part in (group, name, subgroup, condition, item) if part)
+
+
+def inventory_path(project):
+    """ Return the path of the inventory of the given project per --inventory_dir. """
+    return os.path.join(ARGS.inventory_dir, '%s.json' % project)
+
+
+def load_inventory(project):
+    """ Return the inventory of the previous run on the project, or None if there is none. """
+    try:
+        with open(inventory_path(project)) as inventory:
+            return set(json.load(inventory)['resources'])
+    except IOError:
+        return None
+    except (ValueError, KeyError) as exc:
+        print('Ignoring invalid inventory of project %r: %r' % (project, exc), file=sys.stderr)
+        return None
+
+
+def save_inventory(project):
+    """ Save the inventory of this run on the project for the next run to compare with. """
+    if not os.path.isdir(ARGS.inventory_dir):
+        os.makedirs(ARGS.inventory_dir)
+    with open(inventory_path(project), 'w') as inventory:
+        json.dump({
+            'time': datetime.datetime.utcnow().isoformat(),
+            'dryrun': ARGS.dryrun,
+            'resources': sorted(INVENTORY),
+        }, inventory, indent=2)
+
+
+def report_inventory_diff(project, previous):
+    """ Print the resources found since the previous run, and the ones it did not delete.
+
+    Args:
+        project: The name of a gcp project.
+        previous: The inventory of the previous run, or None.
+    """
+    if previous is None:
+        print('[=== No previous inventory of project %r, found %d resources to clean ===]' %
+              (project, len(INVENTORY)))
+        return
+    new = sorted(INVENTORY - previous)
+    survived = sorted(INVENTORY & previous)
+    print('[=== Inventory diff of project %r: %d new, %d survived since the previous run ===]' %
+          (project, len(new), len(survived)))
+    for key in new:
+        print('  new: %s' % key)
+    for key in survived:
+        print('  survived: %s' % key)
+
+
+def excluded(name):
+    """ Return whether the resource of the given name is protected per --exclude_pattern. """
+    return any(re.search(pattern, name) for pattern in ARGS.exclude_pattern or [])
+
+
+def sweeps_type(name):
+    """ Return whether resources of the given type are swept per --only_type. """
+    return not ARGS.only_type or name in ARGS.only_type
+
+
 def main(project, days, hours, filt, rate_limit, service_account):
     """ Clean up resources from a gcp project based on it's creation time
 
@@ -513,16 +597,19 @@ def main(project, days, hours, filt, rate_limit, service_account):
 
     # try to clean a leaked GKE cluster first, rather than attempting to delete
     # its associated resources individually.
-    try:
-        err |= clean_gke_cluster(project, age, filt)
-    except ValueError:
-        err |= 1  # keep clean the other resource
-        print('Fail to clean up cluster from project %r' % project, file=sys.stderr)
+    if sweeps_type('clusters'):
+        try:
+            err |= clean_gke_cluster(project, age, filt)
+        except ValueError:
+            err |= 1  # keep clean the other resource
+            print('Fail to clean up cluster from project %r' % project, file=sys.stderr)
 
     for api, resources in RESOURCES_BY_API.items():
         if not api_enabled(project, api):
             continue
         for res in resources:
+            if not (sweeps_type(res.name) or (res.subgroup and sweeps_type(res.subgroup))):
+                continue
             log('Try to search for %r with condition %r, managed %r' % (
                 res.name, res.condition, res.managed))
             try:
@@ -534,6 +621,14 @@ def main(project, days, hours, filt, rate_limit, service_account):
                 print('Fail to list resource %r from project %r: %r' % (res.name, project, exc),
                       file=sys.stderr)
 
+    if ARGS.inventory_dir:
+        report_inventory_diff(project, load_inventory(project))
+        try:
+            save_inventory(project)
+        except (IOError, OSError) as exc:
+            print('Fail to save the inventory of project %r: %r' % (project, exc),
+                  file=sys.stderr)
+
     print('[=== Finish Janitor on project %r with status %r ===]' % (project, err))
     sys.exit(err)
 
@@ -563,6 +658,19 @@ if __name__ == '__main__':
     PARSER.add_argument(
         '--verbose', action='store_true',
         help='Get full janitor output log')
+    PARSER.add_argument(
+        '--only_type', type=lambda v: v.split(','),
+        help='Only clean these comma-separated resource types, e.g. instances,clusters')
+    PARSER.add_argument(
+        '--only_resource', type=lambda v: v.split(','),
+        help='Only clean the resources with these comma-separated names')
+    PARSER.add_argument(
+        '--exclude_pattern', action='append',
+        help='Never clean the resources whose name matches this regular expression, repeatable')
+    PARSER.add_argument(
+        '--inventory_dir',
+        help='Save the resources found to clean in this directory, and report the difference '
+             'with the previous run: the new leaks, and the resources which survived deletion')
     PARSER.add_argument(
         '--service_account',
         help='GCP service account',
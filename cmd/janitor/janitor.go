@@ -17,8 +17,9 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"fmt"
-	"os/exec"
+	"os"
 	"strings"
 	"time"
 
@@ -28,10 +29,10 @@ import (
 
 	"sigs.k8s.io/boskos/client"
 	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/janitor"
 )
 
 var (
-	bufferSize      = 1 // Maximum holding resources
 	rTypes          common.CommaSeparatedStrings
 	poolSize        int
 	updateFrequency time.Duration
@@ -40,6 +41,13 @@ var (
 	username        = flag.String("username", "", "Username used to access the Boskos server")
 	passwordFile    = flag.String("password-file", "", "The path to password file used to access the Boskos server")
 	logLevel        = flag.String("log-level", "info", fmt.Sprintf("Log level is one of %v.", logrus.AllLevels))
+	shardGroup      = flag.String("shard-group", "", "Shard group shared with the other janitor replicas, so that each of them cleans a disjoint set of resources.")
+	shardMember     = flag.String("shard-member", "", "Name of this replica in the shard group, defaults to the hostname.")
+	shardTTL        = flag.Duration("shard-ttl", time.Minute, "How long the shard of this replica is kept once it stops renewing its membership.")
+	lockName        = flag.String("lock", "", "Name of a boskos lock held while cleaning, so that only one janitor sharing the lock runs at a time.")
+	lockTTL         = flag.Duration("lock-ttl", time.Minute, "How long the lock is kept once this janitor stops renewing it.")
+	claimExpired    = flag.Bool("claim-expired", false, "Also clean the resources whose lease expired, claiming them from boskos once no dirty resource is left, so the reaper is not needed.")
+	claimStaleAfter = flag.Duration("claim-stale-after", 0, "With --claim-expired, also clean the busy, cleaning and leased resources not updated for this long, at least 30m unless authenticated as an admin. 0 only claims expired leases.")
 )
 
 func init() {
@@ -60,7 +68,18 @@ func main() {
 	}
 	logrus.SetLevel(level)
 
-	boskos, err := client.NewClient("Janitor", *boskosURL, *username, *passwordFile)
+	owner := "Janitor"
+	if *shardGroup != "" {
+		if *shardMember == "" {
+			if *shardMember, err = os.Hostname(); err != nil {
+				logrus.WithError(err).Fatal("unable to determine the shard member, set --shard-member")
+			}
+		}
+		// Members of a shard group are told apart by their owner.
+		owner = fmt.Sprintf("Janitor-%s", *shardMember)
+	}
+
+	boskos, err := client.NewClient(owner, *boskosURL, *username, *passwordFile)
 	if err != nil {
 		logrus.WithError(err).Fatal("unable to create a Boskos client")
 	}
@@ -70,24 +89,40 @@ func main() {
 		logrus.Fatal("--resource-type must not be empty!")
 	}
 
-	go func(boskos boskosClient) {
-		for range time.Tick(updateFrequency) {
-			if err := boskos.SyncAll(); err != nil {
-				logrus.WithError(err).Warn("SyncAll failed")
-			}
+	var c janitor.Client = boskos
+	if *shardGroup != "" {
+		if c, err = joinShardGroup(boskos, *shardGroup, *shardTTL); err != nil {
+			logrus.WithError(err).Fatal("unable to join the shard group")
 		}
-	}(boskos)
+	}
 
-	buffer := setup(boskos, poolSize, bufferSize, janitorClean, extraJanitorFlags)
+	runner, err := janitor.NewRunner(c, janitorClean(extraJanitorFlags), janitor.Options{
+		Types:           rTypes,
+		Parallelism:     poolSize,
+		HeartbeatPeriod: updateFrequency,
+		ClaimExpired:    *claimExpired,
+		ClaimStaleAfter: *claimStaleAfter,
+	})
+	if err != nil {
+		logrus.WithError(err).Fatal("unable to create the janitor")
+	}
+	ctx, cancel := janitor.SignalContext(context.Background())
+	defer cancel()
 
-	for {
-		run(boskos, buffer, rTypes)
-		time.Sleep(time.Minute)
+	if *lockName == "" {
+		runner.Run(ctx)
+		return
+	}
+	logrus.Infof("Waiting for lock %s", *lockName)
+	if err := boskos.RunWithLock(ctx, *lockName, *lockTTL, func(ctx context.Context) error {
+		logrus.Infof("Acquired lock %s", *lockName)
+		runner.Run(ctx)
+		return ctx.Err()
+	}); err != nil && ctx.Err() == nil {
+		logrus.WithError(err).Fatalf("stopped holding lock %s", *lockName)
 	}
 }
 
-type clean func(resource *common.Resource, extraFlags []string) error
-
 // TODO(amwat): remove this logic when we get rid of --project.
 
 func format(rtype string) string {
@@ -96,80 +131,52 @@ func format(rtype string) string {
 }
 
 // Clean by janitor script
-func janitorClean(resource *common.Resource, flags []string) error {
-	args := append([]string{fmt.Sprintf("--%s=%s", format(resource.Type), resource.Name)}, flags...)
-	logrus.Infof("executing janitor: %s %s", *janitorPath, strings.Join(args, " "))
-	cmd := exec.Command(*janitorPath, args...)
-	b, err := cmd.CombinedOutput()
-	if err != nil {
-		logrus.WithError(err).Infof("failed to clean up project %s, error info: %s", resource.Name, string(b))
-	} else {
-		logrus.Tracef("output from janitor: %s", string(b))
-		logrus.Infof("successfully cleaned up resource %s", resource.Name)
+func janitorClean(flags []string) janitor.CleanFunc {
+	return func(ctx context.Context, resource *common.Resource) error {
+		args := append([]string{fmt.Sprintf("--%s=%s", format(resource.Type), resource.Name)}, flags...)
+		logrus.Infof("executing janitor: %s %s", *janitorPath, strings.Join(args, " "))
+		cmd := janitorCommand(ctx, *janitorPath, args...)
+		b, err := cmd.CombinedOutput()
+		if err != nil {
+			logrus.WithError(err).Infof("failed to clean up project %s, error info: %s", resource.Name, string(b))
+		} else {
+			logrus.Tracef("output from janitor: %s", string(b))
+			logrus.Infof("successfully cleaned up resource %s", resource.Name)
+		}
+		return err
 	}
-	return err
 }
 
-type boskosClient interface {
-	Acquire(rtype string, state string, dest string) (*common.Resource, error)
-	ReleaseOne(name string, dest string) error
-	SyncAll() error
+// shardedClient only acquires the resources of the shard of its owner.
+type shardedClient struct {
+	*client.Client
+	group string
 }
 
-func setup(c boskosClient, janitorCount int, bufferSize int, cleanFunc clean, flags []string) chan *common.Resource {
-	buffer := make(chan *common.Resource, bufferSize)
-	for i := 0; i < janitorCount; i++ {
-		go janitor(c, buffer, cleanFunc, flags)
-	}
-	return buffer
+func (c *shardedClient) Acquire(rtype string, state string, dest string) (*common.Resource, error) {
+	return c.AcquireInShard(rtype, state, dest, c.group)
 }
 
-func run(c boskosClient, buffer chan<- *common.Resource, rtypes []string) int {
-	totalAcquire := 0
-	res := make(map[string]int)
-	for _, s := range rtypes {
-		res[s] = 0
+// joinShardGroup joins the shard group and keeps renewing the membership in
+// the background.
+func joinShardGroup(boskos *client.Client, group string, ttl time.Duration) (janitor.Client, error) {
+	assignment, err := boskos.JoinShardGroup(group, ttl)
+	if err != nil {
+		return nil, err
 	}
-
-	for {
-		for r := range res {
-			if resource, err := c.Acquire(r, common.Dirty, common.Cleaning); err != nil {
-				logrus.WithError(err).Infof("no available resource %s", r)
-				totalAcquire += res[r]
-				delete(res, r)
-			} else if resource == nil {
-				// To Sen: I don t understand why this would happen
-				logrus.Warning("received nil resource")
-				totalAcquire += res[r]
-				delete(res, r)
-			} else {
-				logrus.Infof("Acquired resources %s of type %s", resource.Name, resource.Type)
-				buffer <- resource // will block until buffer has a free slot
-				res[r]++
+	logrus.Infof("Joined shard group %s, cleaning shard %d of %d", group, assignment.Index, assignment.Count)
+	go func() {
+		for range time.Tick(ttl / 3) {
+			renewed, err := boskos.JoinShardGroup(group, ttl)
+			if err != nil {
+				logrus.WithError(err).Warn("failed to renew the shard group membership")
+				continue
 			}
+			if renewed.Index != assignment.Index || renewed.Count != assignment.Count {
+				logrus.Infof("Shards of group %s changed, cleaning shard %d of %d", group, renewed.Index, renewed.Count)
+			}
+			assignment = renewed
 		}
-
-		if len(res) == 0 {
-			break
-		}
-	}
-
-	return totalAcquire
-}
-
-// async janitor goroutine
-func janitor(c boskosClient, buffer <-chan *common.Resource, fn clean, flags []string) {
-	for {
-		resource := <-buffer
-
-		dest := common.Free
-		if err := fn(resource, flags); err != nil {
-			logrus.WithError(err).Debugf("%s failed!", *janitorPath)
-			dest = common.Dirty
-		}
-
-		if err := c.ReleaseOne(resource.Name, dest); err != nil {
-			logrus.WithError(err).Error("boskos release failed!")
-		}
-	}
+	}()
+	return &shardedClient{Client: boskos, group: group}, nil
 }
@@ -0,0 +1,96 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes"
+)
+
+// protectedNamespaces are never deleted, whatever the pattern.
+var protectedNamespaces = sets.NewString(
+	metav1.NamespaceDefault,
+	metav1.NamespaceSystem,
+	metav1.NamespacePublic,
+	corev1.NamespaceNodeLease,
+)
+
+// namespaceCleaner deletes the leaked namespaces of a shared cluster.
+type namespaceCleaner struct {
+	client  kubernetes.Interface
+	pattern *regexp.Regexp
+	// ttl is the age after which matching namespaces are deleted.
+	ttl time.Duration
+	// forceFinalizeAfter is how long matching namespaces may be terminating
+	// before their finalizers are removed. Zero disables forced finalization.
+	forceFinalizeAfter time.Duration
+	dryRun             bool
+	now                func() time.Time
+}
+
+// clean deletes the namespaces matching the pattern and older than the TTL,
+// and force finalizes those stuck terminating if enabled. It returns the names
+// of the namespaces it deleted and finalized.
+func (c *namespaceCleaner) clean(ctx context.Context) (deleted, finalized []string, err error) {
+	namespaces, err := c.client.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list namespaces: %w", err)
+	}
+	now := c.now()
+	for idx := range namespaces.Items {
+		ns := &namespaces.Items[idx]
+		if protectedNamespaces.Has(ns.Name) || !c.pattern.MatchString(ns.Name) {
+			continue
+		}
+		logger := logrus.WithFields(logrus.Fields{"namespace": ns.Name, "dry-run": c.dryRun})
+
+		if ns.DeletionTimestamp != nil {
+			if c.forceFinalizeAfter == 0 || now.Sub(ns.DeletionTimestamp.Time) < c.forceFinalizeAfter || len(ns.Spec.Finalizers) == 0 {
+				continue
+			}
+			logger.WithField("finalizers", ns.Spec.Finalizers).Info("Force finalizing namespace stuck terminating")
+			if !c.dryRun {
+				ns.Spec.Finalizers = nil
+				if _, err := c.client.CoreV1().Namespaces().Finalize(ctx, ns, metav1.UpdateOptions{}); err != nil {
+					return deleted, finalized, fmt.Errorf("failed to finalize namespace %s: %w", ns.Name, err)
+				}
+			}
+			finalized = append(finalized, ns.Name)
+			continue
+		}
+
+		if now.Sub(ns.CreationTimestamp.Time) < c.ttl {
+			continue
+		}
+		logger.WithField("age", now.Sub(ns.CreationTimestamp.Time)).Info("Deleting leaked namespace")
+		if !c.dryRun {
+			if err := c.client.CoreV1().Namespaces().Delete(ctx, ns.Name, metav1.DeleteOptions{}); err != nil {
+				return deleted, finalized, fmt.Errorf("failed to delete namespace %s: %w", ns.Name, err)
+			}
+		}
+		deleted = append(deleted, ns.Name)
+	}
+	return deleted, finalized, nil
+}
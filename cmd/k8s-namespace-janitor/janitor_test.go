@@ -0,0 +1,131 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func namespace(name string, age time.Duration, terminatingFor *time.Duration, now time.Time) *corev1.Namespace {
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:              name,
+		CreationTimestamp: metav1.NewTime(now.Add(-age)),
+	}}
+	if terminatingFor != nil {
+		deleted := metav1.NewTime(now.Add(-*terminatingFor))
+		ns.DeletionTimestamp = &deleted
+		ns.Spec.Finalizers = []corev1.FinalizerName{corev1.FinalizerKubernetes}
+	}
+	return ns
+}
+
+func TestNamespaceCleaner(t *testing.T) {
+	now := time.Date(2021, time.March, 1, 12, 0, 0, 0, time.UTC)
+	hour := time.Hour
+	testCases := []struct {
+		name               string
+		namespaces         []runtime.Object
+		forceFinalizeAfter time.Duration
+		dryRun             bool
+		expectDeleted      []string
+		expectFinalized    []string
+	}{
+		{
+			name: "old matching namespaces are deleted",
+			namespaces: []runtime.Object{
+				namespace("e2e-old", 2*time.Hour, nil, now),
+				namespace("e2e-new", time.Minute, nil, now),
+				namespace("prod", 2*time.Hour, nil, now),
+			},
+			expectDeleted: []string{"e2e-old"},
+		},
+		{
+			name: "protected namespaces are kept",
+			namespaces: []runtime.Object{
+				namespace("kube-system", 2*time.Hour, nil, now),
+			},
+		},
+		{
+			name: "stuck namespaces are left alone by default",
+			namespaces: []runtime.Object{
+				namespace("e2e-stuck", 3*time.Hour, &hour, now),
+			},
+		},
+		{
+			name: "stuck namespaces are force finalized",
+			namespaces: []runtime.Object{
+				namespace("e2e-stuck", 3*time.Hour, &hour, now),
+			},
+			forceFinalizeAfter: 30 * time.Minute,
+			expectFinalized:    []string{"e2e-stuck"},
+		},
+		{
+			name: "recently terminating namespaces are not force finalized",
+			namespaces: []runtime.Object{
+				namespace("e2e-stuck", 3*time.Hour, &hour, now),
+			},
+			forceFinalizeAfter: 2 * time.Hour,
+		},
+		{
+			name: "dry run reports without deleting",
+			namespaces: []runtime.Object{
+				namespace("e2e-old", 2*time.Hour, nil, now),
+			},
+			dryRun:        true,
+			expectDeleted: []string{"e2e-old"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset(tc.namespaces...)
+			cleaner := &namespaceCleaner{
+				client:             client,
+				pattern:            regexp.MustCompile(`^(e2e-.*|kube-system)$`),
+				ttl:                time.Hour,
+				forceFinalizeAfter: tc.forceFinalizeAfter,
+				dryRun:             tc.dryRun,
+				now:                func() time.Time { return now },
+			}
+			deleted, finalized, err := cleaner.clean(context.Background())
+			if err != nil {
+				t.Fatalf("failed to clean: %v", err)
+			}
+			if !reflect.DeepEqual(deleted, tc.expectDeleted) {
+				t.Errorf("expected %v to be deleted, got %v", tc.expectDeleted, deleted)
+			}
+			if !reflect.DeepEqual(finalized, tc.expectFinalized) {
+				t.Errorf("expected %v to be finalized, got %v", tc.expectFinalized, finalized)
+			}
+
+			for _, name := range tc.expectDeleted {
+				_, err := client.CoreV1().Namespaces().Get(context.Background(), name, metav1.GetOptions{})
+				if exists := err == nil; exists != tc.dryRun {
+					t.Errorf("expected namespace %s to exist %t, got %t", name, tc.dryRun, exists)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// k8s-namespace-janitor cleans the namespaces leaked in shared Kubernetes
+// clusters tracked by boskos. It acquires dirty resources of the cluster types,
+// deletes the namespaces matching a pattern that outlived their TTL using the
+// kubeconfig in the user data of the resource, and releases the resources free.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"k8s.io/test-infra/pkg/flagutil"
+	"k8s.io/test-infra/prow/config"
+	prowflagutil "k8s.io/test-infra/prow/flagutil"
+	"k8s.io/test-infra/prow/logrusutil"
+	prowmetrics "k8s.io/test-infra/prow/metrics"
+
+	"sigs.k8s.io/boskos/client"
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/common/logging"
+)
+
+// kubeconfigKey is the user data key holding the kubeconfig of the cluster.
+const kubeconfigKey = "kubeconfig"
+
+var (
+	boskosURL          = flag.String("boskos-url", "http://boskos", "Boskos URL")
+	rTypes             common.CommaSeparatedStrings
+	username           = flag.String("username", "", "Username used to access the Boskos server")
+	passwordFile       = flag.String("password-file", "", "The path to password file used to access the Boskos server")
+	namespacePattern   = flag.String("namespace-pattern", "", "Regular expression matching the names of the namespaces to clean up")
+	ttl                = flag.Duration("ttl", 24*time.Hour, "Age after which matching namespaces are deleted")
+	forceFinalizeAfter = flag.Duration("force-finalize-after", 0, "If set, remove the finalizers of matching namespaces stuck terminating for longer than this")
+	logLevel           = flag.String("log-level", "info", fmt.Sprintf("Log level is one of %v.", logrus.AllLevels))
+	dryRun             = flag.Bool("dry-run", false, "If set, don't delete or finalize any namespace, only log what would be done")
+
+	instrumentationOptions prowflagutil.InstrumentationOptions
+	loggingOptions         logging.Options
+)
+
+const (
+	sleepTime = time.Minute
+)
+
+func init() {
+	flag.Var(&rTypes, "resource-type", "comma-separated list of shared cluster resources whose namespaces need to be cleaned up")
+}
+
+func main() {
+	logrusutil.ComponentInit()
+	for _, o := range []flagutil.OptionGroup{&instrumentationOptions, &loggingOptions} {
+		o.AddFlags(flag.CommandLine)
+	}
+	flag.Parse()
+
+	level, err := logrus.ParseLevel(*logLevel)
+	if err != nil {
+		logrus.WithError(err).Fatal("invalid log level specified")
+	}
+	logrus.SetLevel(level)
+
+	for _, o := range []flagutil.OptionGroup{&instrumentationOptions, &loggingOptions} {
+		if err := o.Validate(false); err != nil {
+			logrus.Fatalf("Invalid options: %v", err)
+		}
+	}
+	loggingOptions.Configure(level)
+	prowmetrics.ExposeMetrics("k8s-namespace-janitor", config.PushGateway{}, instrumentationOptions.MetricsPort)
+
+	if len(rTypes) == 0 {
+		logrus.Info("--resource-type is empty! Setting it to default: k8s-shared-cluster")
+		rTypes = []string{"k8s-shared-cluster"}
+	}
+	if *namespacePattern == "" {
+		logrus.Fatal("--namespace-pattern must not be empty!")
+	}
+	pattern, err := regexp.Compile(*namespacePattern)
+	if err != nil {
+		logrus.WithError(err).Fatal("invalid --namespace-pattern")
+	}
+
+	boskos, err := client.NewClient("K8sNamespaceJanitor", *boskosURL, *username, *passwordFile)
+	if err != nil {
+		logrus.WithError(err).Fatal("unable to create a Boskos client")
+	}
+	if err := run(boskos, pattern); err != nil {
+		logrus.WithError(err).Error("Janitor failure")
+	}
+}
+
+func run(boskos *client.Client, pattern *regexp.Regexp) error {
+	for {
+		for _, resourceType := range rTypes {
+			res, err := boskos.Acquire(resourceType, common.Dirty, common.Cleaning)
+			if errors.Cause(err) == client.ErrNotFound {
+				logrus.Info("no resource acquired. Sleeping.")
+				time.Sleep(sleepTime)
+				continue
+			} else if err != nil {
+				return errors.Wrap(err, "Couldn't retrieve resources from Boskos")
+			}
+			logrus.WithField("name", res.Name).Info("Acquired resource")
+			start := time.Now()
+			if err := cleanResource(res, pattern); err != nil {
+				// Leave the resource dirty so it is cleaned again later.
+				logrus.WithError(err).WithField("name", res.Name).Error("Couldn't clean resource")
+				if err := boskos.ReleaseCleaned(res.Name, common.Dirty, time.Since(start)); err != nil {
+					return errors.Wrapf(err, "Failed to release resource %q", res.Name)
+				}
+				continue
+			}
+			if err := boskos.ReleaseCleaned(res.Name, common.Free, time.Since(start)); err != nil {
+				return errors.Wrapf(err, "Failed to release resource %q", res.Name)
+			}
+			logrus.WithField("name", res.Name).Info("Released resource")
+		}
+	}
+}
+
+func cleanResource(res *common.Resource, pattern *regexp.Regexp) error {
+	if res.UserData == nil {
+		return errors.Errorf("No user data in %q", res.Name)
+	}
+	kubeconfig, ok := res.UserData.Load(kubeconfigKey)
+	if !ok {
+		return errors.Errorf("No %s in the user data of %q", kubeconfigKey, res.Name)
+	}
+	restConfig, err := clientcmd.RESTConfigFromKubeConfig([]byte(kubeconfig.(string)))
+	if err != nil {
+		return errors.Wrapf(err, "Invalid kubeconfig of %q", res.Name)
+	}
+	kubeClient, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to create Kubernetes client for %q", res.Name)
+	}
+
+	cleaner := &namespaceCleaner{
+		client:             kubeClient,
+		pattern:            pattern,
+		ttl:                *ttl,
+		forceFinalizeAfter: *forceFinalizeAfter,
+		dryRun:             *dryRun,
+		now:                time.Now,
+	}
+	deleted, finalized, err := cleaner.clean(context.Background())
+	logrus.WithFields(logrus.Fields{"name": res.Name, "deleted": len(deleted), "finalized": len(finalized)}).Info("Finished cleaning")
+	return err
+}
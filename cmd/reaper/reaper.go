@@ -33,6 +33,7 @@ var (
 	passwordFile   = flag.String("password-file", "", "The path to password file used to access the Boskos server")
 	expiryDuration = flag.Duration("expire", 30*time.Minute, "The expiry time (in minutes) after which reaper will reset resources.")
 	targetState    = flag.String("target-state", common.Dirty, "The state to move resources to when reaped.")
+	tenant         = flag.String("tenant", "", "The tenant the resource types belong to, if any.")
 )
 
 func init() {
@@ -47,6 +48,7 @@ func main() {
 	if err != nil {
 		logrus.WithError(err).Fatal("unable to create a Boskos client")
 	}
+	boskos.SetTenant(*tenant)
 	logrus.Infof("Initialized boskos client!")
 
 	if len(rTypes) == 0 {
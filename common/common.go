@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"text/template"
 	"time"
 
 	"sigs.k8s.io/yaml"
@@ -36,6 +37,8 @@ const (
 	Dirty = "dirty"
 	// Free state defines a resource that is usable
 	Free = "free"
+	// Held state defines a resource reserved for an owner that has yet to confirm it
+	Held = "held"
 	// Leased state defines a resource being leased in order to make a new resource
 	Leased = "leased"
 	// ToBeDeleted is used for resources about to be deleted, they will be verified by a cleaner which mark them as tombstone
@@ -46,6 +49,16 @@ const (
 	Other = "other"
 )
 
+const (
+	// CoAcquiredResources is a UserData entry listing the resources co-acquired with a resource.
+	CoAcquiredResources = "coAcquiredResources"
+	// CoAcquiredBy is a UserData entry naming the resource a resource was co-acquired with.
+	CoAcquiredBy = "coAcquiredBy"
+	// ForceReleasedFrom is a UserData entry naming the owner a resource was
+	// force-released from by an admin.
+	ForceReleasedFrom = "forceReleasedFrom"
+)
+
 var (
 	// KnownStates is the set of all known states, excluding "other".
 	KnownStates = []string{
@@ -53,6 +66,7 @@ var (
 		Cleaning,
 		Dirty,
 		Free,
+		Held,
 		Leased,
 		ToBeDeleted,
 		Tombstone,
@@ -110,6 +124,30 @@ type Resource struct {
 	UserData *UserData `json:"userdata"`
 	// Used to clean up dynamic resources
 	ExpirationDate *time.Time `json:"expiration-date,omitempty"`
+	// Set while the resource is held, the hold lapses unless confirmed by then
+	HoldExpiration *time.Time `json:"hold-expiration,omitempty"`
+	// Set while the resource is leased for a limited time, it is released by then
+	LeaseExpiration *time.Time `json:"lease-expiration,omitempty"`
+	// Access holds the connection details rendered from the access templates
+	// of the type, set when the resource is handed to its owner
+	Access map[string]string `json:"access,omitempty"`
+	// Progress is the last progress the owner reported with its heartbeats
+	Progress *Progress `json:"progress,omitempty"`
+	// Tenant is the tenant owning the pool of the resource, if any
+	Tenant string `json:"tenant,omitempty"`
+}
+
+// Progress is what the job holding a resource is doing with it, as reported
+// along with its heartbeats.
+type Progress struct {
+	// Phase names the step the job is in, e.g. provisioning or testing.
+	Phase string `json:"phase"`
+	// Percent is the completion of the job, from 0 to 100.
+	Percent int `json:"percent,omitempty"`
+	// Message details the phase.
+	Message string `json:"message,omitempty"`
+	// Reported is when the progress was reported. It is set by boskos.
+	Reported time.Time `json:"reported,omitempty"`
 }
 
 // ResourceEntry is resource config format defined from config.yaml
@@ -122,15 +160,463 @@ type ResourceEntry struct {
 	LifeSpan *Duration     `json:"lifespan,omitempty"`
 	Config   ConfigType    `json:"config,omitempty"`
 	Needs    ResourceNeeds `json:"needs,omitempty"`
+	// MaxLifetime retires dynamic resources of this type once they are this
+	// old, whatever their state, so long-lived resources accumulating cruft
+	// are replaced by fresh ones. Resources in use are retired once released.
+	MaxLifetime *Duration `json:"max-lifetime,omitempty"`
+	// OwnerQuota limits how many resources of this type a single owner may hold.
+	OwnerQuota *OwnerQuota `json:"owner-quota,omitempty"`
+	// Requires lists the number of free resources of other types co-acquired
+	// with every resource of this type. Releasing the resource releases them too.
+	Requires ResourceNeeds `json:"requires,omitempty"`
+	// CleanupBreaker pauses the cleanup of this type when its janitor keeps failing.
+	CleanupBreaker *CleanupBreaker `json:"cleanup-breaker,omitempty"`
+	// TimeSlice shares the resources of this type in time slices of this
+	// length booked in advance, instead of leasing them for as long as needed.
+	TimeSlice *Duration `json:"time-slice,omitempty"`
+	// CredentialRotation replaces the credentials of the resources of this type
+	// after every lease, before they are handed out again.
+	CredentialRotation *CredentialRotation `json:"credential-rotation,omitempty"`
+	// TransitionWebhook is called before the state of a resource of this type
+	// changes, and may deny the change or amend the user data of the resource.
+	TransitionWebhook *TransitionWebhook `json:"transition-webhook,omitempty"`
+	// Approval, if set, makes the acquisitions of free resources of this type
+	// wait for an operator to approve them, e.g. for scarce physical hardware.
+	Approval *AcquisitionApproval `json:"approval,omitempty"`
+	// UserDataMigrations are applied once to the user data of every resource
+	// of this type when the config is synced, in increasing version order.
+	UserDataMigrations []UserDataMigration `json:"user-data-migrations,omitempty"`
+	// Access renders how to connect to a resource of this type into the
+	// access block of the responses handing the resource to its owner.
+	Access AccessTemplates `json:"access,omitempty"`
+	// HealthThresholds declares the type degraded when breached, which is
+	// advertised to clients in a HealthAdvisory.
+	HealthThresholds *HealthThresholds `json:"health-thresholds,omitempty"`
+	// Aliases are former names of this type which clients may still use, so
+	// that the type can be renamed without breaking them.
+	Aliases []TypeAlias `json:"aliases,omitempty"`
+	// States are the states clients may request for resources of this type,
+	// so typos are rejected instead of moving resources out of the pool.
+	// Any state is accepted if unset.
+	States []string `json:"states,omitempty"`
+	// StateAliases are former names of the states of this type, mapped to
+	// the state they were renamed to, which clients may still request so that
+	// states can be renamed without breaking them.
+	StateAliases map[string]string `json:"state-aliases,omitempty"`
+	// Transitions, if set, are the states resources of this type may move to
+	// from each state, e.g. only dirty to cleaning and cleaning to free or
+	// dirty. Changes of state not listed are rejected, which catches broken
+	// cleanup pipelines early. Any change of state is allowed if unset.
+	Transitions map[string][]string `json:"transitions,omitempty"`
+	// Fallback is the type acquired instead of this one by clients opting in
+	// when no resource of this type is available.
+	Fallback string `json:"fallback,omitempty"`
+	// Regions are the regions dynamic resources of this type are spread
+	// across. New resources go to the region with the most quota headroom
+	// reported by the janitors, see RegionUsage.
+	Regions []string `json:"regions,omitempty"`
+	// Flavors split the dynamic resources of this type into variants, e.g.
+	// machine sizes, each kept at its own counts, instead of a type per
+	// variant. Min-count and max-count must be unset, as they are the sums of
+	// those of the flavors.
+	Flavors []DynamicResourceFlavor `json:"flavors,omitempty"`
+	// Tenant is the tenant owning the pool of this type. Only requests on
+	// behalf of the tenant may acquire its resources. The pool is shared by
+	// all tenants if unset.
+	Tenant string `json:"tenant,omitempty"`
+	// Policy, if set, restricts who may acquire or reset the resources of
+	// this type.
+	Policy *TypePolicy `json:"policy,omitempty"`
+	// Ephemeral, if set, makes this type ephemeral: its resources do not
+	// exist ahead of time, but are created by the provisioner on acquire, and
+	// deleted once cleaned by a janitor after their release.
+	Ephemeral *EphemeralProvisioner `json:"ephemeral,omitempty"`
+	// InitialStates override State for the named resources when the config
+	// sync creates them, e.g. dirty for pre-existing assets a janitor must
+	// clean before their first use. Existing resources keep their state.
+	InitialStates map[string]string `json:"initial-states,omitempty"`
+}
+
+// EphemeralProvisioner creates the resources of an ephemeral type on acquire.
+// It is called with a ProvisionRequest as JSON, and must answer with a
+// ProvisionResponse as JSON.
+type EphemeralProvisioner struct {
+	// URL receives the ProvisionRequest as a JSON POST, unless Command is set.
+	URL string `json:"url,omitempty"`
+	// Command is run with the ProvisionRequest on its standard input, and
+	// must print the ProvisionResponse on its standard output.
+	Command []string `json:"command,omitempty"`
+	// MaxConcurrency bounds how many resources of the type exist at once,
+	// including those being created.
+	MaxConcurrency int `json:"max-concurrency"`
+	// Timeout bounds every creation. Defaults to DefaultProvisionTimeout.
+	Timeout *Duration `json:"timeout,omitempty"`
+}
+
+// DefaultProvisionTimeout is the timeout of the creations of ephemeral
+// resources whose provisioner does not set one.
+const DefaultProvisionTimeout = 5 * time.Minute
+
+// ProvisionRequest is sent to the provisioner of an ephemeral type to create
+// the resource Name for Owner.
+type ProvisionRequest struct {
+	Type  string `json:"type"`
+	Name  string `json:"name"`
+	Owner string `json:"owner"`
+}
+
+// ProvisionResponse is expected from the provisioners of ephemeral types.
+type ProvisionResponse struct {
+	// UserData is set on the created resource, e.g. how to connect to it.
+	UserData map[string]string `json:"user_data,omitempty"`
+}
+
+// TypePolicy declares who may act on the resources of a type. Its entries are
+// regular expressions matching the names of authenticated callers, e.g. of
+// service accounts, or the owners claimed by anonymous callers. Anyone may
+// act when the entries of an action are unset.
+type TypePolicy struct {
+	// Acquirers may acquire the resources of the type.
+	Acquirers []string `json:"acquirers,omitempty"`
+	// Resetters may reset the resources of the type.
+	Resetters []string `json:"resetters,omitempty"`
+}
+
+// TypeAlias is a former name of a resource type.
+type TypeAlias struct {
+	Name string `json:"name"`
+	// Rejected makes requests using the alias fail, once clients migrated.
+	Rejected bool `json:"rejected,omitempty"`
+}
+
+// OwnerQuota limits the number of resources of a type a single owner may hold
+// concurrently.
+type OwnerQuota struct {
+	// Soft is the number of resources an owner may always hold.
+	Soft int `json:"soft"`
+	// Burst is the number of resources an owner may hold on top of Soft as long
+	// as it has burst credits left.
+	Burst int `json:"burst,omitempty"`
+	// BurstCredit is the amount of resource time above Soft an owner may accrue.
+	// Every resource held above Soft consumes credits in real time, and credits
+	// refill in real time while the owner holds no more than Soft resources.
+	BurstCredit *Duration `json:"burst-credit,omitempty"`
+	// Owners overrides the quota of the named owners, e.g. to let a scale test
+	// hold more resources than the other jobs. They share the BurstCredit.
+	Owners map[string]OwnerQuotaLimits `json:"owners,omitempty"`
+}
+
+// OwnerQuotaLimits is the quota of a single owner.
+type OwnerQuotaLimits struct {
+	Soft  int `json:"soft"`
+	Burst int `json:"burst,omitempty"`
+}
+
+// CleanupBreaker trips when too many cleanups of a resource type fail, which
+// usually means its janitor is broken. While tripped, dirty resources of the
+// type are not handed out for cleaning anymore until the breaker is reset.
+type CleanupBreaker struct {
+	// MaxFailurePercent is the share of failed cleanups within Window above
+	// which the breaker trips.
+	MaxFailurePercent int `json:"max-failure-percent"`
+	// Window is the period over which cleanups are counted.
+	Window *Duration `json:"window"`
+	// MinCleanups is the number of cleanups needed within Window before the
+	// breaker may trip, so a couple of early failures do not trip it.
+	MinCleanups int `json:"min-cleanups,omitempty"`
+}
+
+// CleanupBreakerStatus describes the cleanup breaker of a resource type.
+type CleanupBreakerStatus struct {
+	Type string `json:"type"`
+	// Open is set while cleanups of the type are paused.
+	Open     bool       `json:"open"`
+	OpenedAt *time.Time `json:"opened_at,omitempty"`
+	// Cleanups and Failures are counted over the breaker window.
+	Cleanups int `json:"cleanups"`
+	Failures int `json:"failures"`
+}
+
+// DynamicResourceErrorCount counts the errors of a class updating the dynamic
+// resources of a type.
+type DynamicResourceErrorCount struct {
+	Type  string `json:"type"`
+	Class string `json:"class"`
+	Count int    `json:"count"`
+}
+
+// DeprecatedUsageCount counts the requests of an owner relying on a
+// deprecated behavior.
+type DeprecatedUsageCount struct {
+	Deprecation string `json:"deprecation"`
+	Owner       string `json:"owner"`
+	Count       int    `json:"count"`
+}
+
+// StorageOperationCount counts the calls of an operation to the storage
+// abandoned for a reason, like their request running past its deadline.
+type StorageOperationCount struct {
+	Operation string `json:"operation"`
+	Reason    string `json:"reason"`
+	Count     int    `json:"count"`
+}
+
+// ConfigSyncStatus is the health of the syncs of the resources with the
+// config.
+type ConfigSyncStatus struct {
+	// Syncs and Errors count the syncs and the failed ones.
+	Syncs  int `json:"syncs"`
+	Errors int `json:"errors"`
+	// LastSuccess is the end of the last successful sync, if any.
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	// LastDuration is how long the last sync took.
+	LastDuration time.Duration `json:"last_duration"`
+	// LastAdded and LastTombstoned count the resources the last sync added,
+	// and deleted or marked to be deleted.
+	LastAdded      int `json:"last_added"`
+	LastTombstoned int `json:"last_tombstoned"`
+	// Added and Tombstoned count them over all syncs.
+	Added      int `json:"added"`
+	Tombstoned int `json:"tombstoned"`
+}
+
+// Credential rotators.
+const (
+	// StaticRotator generates a random secret.
+	StaticRotator = "static"
+	// AWSAccessKeyRotator replaces the access key of the IAM user whose key is
+	// stored in the user data of the resource.
+	AWSAccessKeyRotator = "aws-access-key"
+	// GCPServiceAccountKeyRotator replaces the key of the service account whose
+	// JSON key file is stored in the user data of the resource.
+	GCPServiceAccountKeyRotator = "gcp-sa-key"
+
+	// DefaultCredentialsKey is the user data key holding the credentials
+	// replaced by the rotators storing a single value.
+	DefaultCredentialsKey = "credentials"
+)
+
+// CredentialRotators lists the known credential rotators.
+var CredentialRotators = []string{StaticRotator, AWSAccessKeyRotator, GCPServiceAccountKeyRotator}
+
+// CredentialRotation configures how the credentials of a resource type are
+// replaced, so a holder never receives credentials still known to the previous
+// holder.
+type CredentialRotation struct {
+	// Rotator is the name of the rotator issuing new credentials.
+	Rotator string `json:"rotator"`
+	// Key is the user data key holding the credentials for the static and
+	// gcp-sa-key rotators. Defaults to DefaultCredentialsKey.
+	Key string `json:"key,omitempty"`
+}
+
+// CredentialsKey returns the user data key holding the credentials.
+func (c *CredentialRotation) CredentialsKey() string {
+	if c.Key == "" {
+		return DefaultCredentialsKey
+	}
+	return c.Key
+}
+
+// TransitionWebhook is an external service admitting the state transitions of
+// a resource type, e.g. to keep resources from being released to free unless a
+// verification job passed.
+type TransitionWebhook struct {
+	// URL receives a TransitionReview as a JSON POST for every transition.
+	URL string `json:"url"`
+	// States limits the webhook to the transitions to these states. All
+	// transitions are reviewed if empty.
+	States []string `json:"states,omitempty"`
+	// StateAliases are former names of the states of this type, mapped to
+	// the state they were renamed to, which clients may still request so that
+	// states can be renamed without breaking them.
+	StateAliases map[string]string `json:"state-aliases,omitempty"`
+	// Timeout bounds every call to the webhook. Defaults to
+	// DefaultTransitionWebhookTimeout.
+	Timeout *Duration `json:"timeout,omitempty"`
+	// FailOpen admits the transitions the webhook fails to review, instead of
+	// denying them.
+	FailOpen bool `json:"fail-open,omitempty"`
+}
+
+// AcquisitionApproval gates the acquisitions of a resource type: acquire
+// requests wait for approval, which an operator grants or denies through
+// /admin/approve and /admin/deny, and are denied unless approved in time.
+type AcquisitionApproval struct {
+	// WebhookURL, if set, receives every ApprovalRequest pending approval as a
+	// JSON POST, e.g. to post it to a chat along with approval actions.
+	WebhookURL string `json:"webhook-url,omitempty"`
+	// Timeout is how long requests wait for approval before being denied, and
+	// how long approved requests may take to acquire a resource. Defaults to
+	// DefaultApprovalTimeout.
+	Timeout *Duration `json:"timeout,omitempty"`
+	// MaxPending bounds the requests waiting for approval at once, further
+	// requests are turned away until some are decided. Defaults to
+	// DefaultMaxPendingApprovals.
+	MaxPending int `json:"max-pending,omitempty"`
+}
+
+// DefaultApprovalTimeout is the approval timeout of the types not configuring
+// one.
+const DefaultApprovalTimeout = time.Hour
+
+// DefaultMaxPendingApprovals is the bound of the requests pending approval of
+// the types not configuring one.
+const DefaultMaxPendingApprovals = 100
+
+// Approval statuses.
+const (
+	ApprovalPending  = "pending"
+	ApprovalApproved = "approved"
+	ApprovalDenied   = "denied"
+)
+
+// ApprovalRequest is an acquire request of a type gated by an
+// AcquisitionApproval.
+type ApprovalRequest struct {
+	// ID identifies the request in /admin/approve and /admin/deny.
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	Owner     string    `json:"owner"`
+	RequestID string    `json:"request_id,omitempty"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+	// Expires is when the request is denied unless approved, or when an
+	// approved request is forgotten unless it acquired a resource.
+	Expires time.Time `json:"expires"`
+	// DecidedBy is the operator who approved or denied the request. It is
+	// unset for requests denied by the timeout.
+	DecidedBy string `json:"decided_by,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// User data migration operations.
+const (
+	// RenameUserData moves the value of Key to To.
+	RenameUserData = "rename"
+	// SetDefaultUserData sets Key to Value if unset.
+	SetDefaultUserData = "set-default"
+	// DropUserData deletes Key.
+	DropUserData = "drop"
+)
+
+// UserDataMigrationOps are the known user data migration operations.
+var UserDataMigrationOps = []string{RenameUserData, SetDefaultUserData, DropUserData}
+
+// UserDataMigration is a change of the format of the user data of a resource
+// type. Resources remember the version of the last migration applied to them,
+// so migrations already applied may be removed from the config.
+type UserDataMigration struct {
+	// Version orders the migrations of a type, and must be increasing.
+	Version int `json:"version"`
+	// Op is one of UserDataMigrationOps.
+	Op  string `json:"op"`
+	Key string `json:"key"`
+	// To is the new key of rename migrations.
+	To string `json:"to,omitempty"`
+	// Value is the default value of set-default migrations.
+	Value string `json:"value,omitempty"`
+}
+
+// Apply applies the migration to userData, which must not be nil.
+func (m *UserDataMigration) Apply(userData map[string]string) {
+	switch m.Op {
+	case RenameUserData:
+		if value, ok := userData[m.Key]; ok {
+			delete(userData, m.Key)
+			userData[m.To] = value
+		}
+	case SetDefaultUserData:
+		if _, ok := userData[m.Key]; !ok {
+			userData[m.Key] = m.Value
+		}
+	case DropUserData:
+		delete(userData, m.Key)
+	}
+}
+
+// DefaultTransitionWebhookTimeout is the timeout of transition webhooks not
+// configuring one.
+const DefaultTransitionWebhookTimeout = 5 * time.Second
+
+// Reviews returns whether transitions to state are reviewed by the webhook.
+func (w *TransitionWebhook) Reviews(state string) bool {
+	if len(w.States) == 0 {
+		return true
+	}
+	for _, s := range w.States {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
+
+// AccessTemplates maps connection details, e.g. an endpoint, a kubeconfig path
+// or a credentials reference, to the text/template rendering them from the
+// AccessData of a resource.
+type AccessTemplates map[string]string
+
+// AccessData is what access templates are rendered with.
+type AccessData struct {
+	Name     string
+	Type     string
+	UserData map[string]string
+}
+
+// Parse parses the access templates. Rendering a template that refers to user
+// data the resource does not have fails, rather than rendering an empty value.
+func (a AccessTemplates) Parse() (map[string]*template.Template, error) {
+	templates := map[string]*template.Template{}
+	for key, text := range a {
+		t, err := template.New(key).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return nil, err
+		}
+		templates[key] = t
+	}
+	return templates, nil
+}
+
+// TransitionReview is the body sent to transition webhooks.
+type TransitionReview struct {
+	// Resource is the resource before the transition.
+	Resource Resource `json:"resource"`
+	From     string   `json:"from"`
+	To       string   `json:"to"`
+	// Owner is the owner requesting the transition. It is empty for resets.
+	Owner string `json:"owner,omitempty"`
+}
+
+// TransitionReviewResponse is the body expected from transition webhooks.
+type TransitionReviewResponse struct {
+	Allowed bool `json:"allowed"`
+	// Reason explains why the transition is denied.
+	Reason string `json:"reason,omitempty"`
+	// UserData is merged into the user data of admitted resources. Keys with
+	// an empty value are deleted.
+	UserData map[string]string `json:"user_data,omitempty"`
 }
 
 func (re *ResourceEntry) IsDRLC() bool {
-	return len(re.Names) == 0
+	return len(re.Names) == 0 && re.Ephemeral == nil
 }
 
 // BoskosConfig defines config used by boskos server
 type BoskosConfig struct {
 	Resources []ResourceEntry `json:"resources,flow"`
+	// Requests tunes the queues of the acquire requests. Changes apply when
+	// the config is synced, without a restart.
+	Requests *RequestsConfig `json:"requests,omitempty"`
+}
+
+// RequestsConfig overrides the --request-ttl flag and the default period of
+// the GC of the requests.
+type RequestsConfig struct {
+	// TTL is how long a queued request keeps its rank without being renewed.
+	TTL *Duration `json:"ttl,omitempty"`
+	// GCPeriod is how often the expired requests are dropped from the queues.
+	GCPeriod *Duration `json:"gc-period,omitempty"`
 }
 
 // Metric contains analytics about a specific resource type
@@ -138,9 +624,436 @@ type Metric struct {
 	Type    string         `json:"type"`
 	Current map[string]int `json:"current"`
 	Owners  map[string]int `json:"owner"`
+	// ByOwner counts the resources by owner and state. It is only filled in
+	// when the breakdown by owner is requested, as it grows with the owners.
+	ByOwner map[string]map[string]int `json:"by_owner,omitempty"`
 	// TODO: implements state transition metrics
 }
 
+// TenantMetric contains analytics about the resources of a tenant
+type TenantMetric struct {
+	Tenant  string         `json:"tenant"`
+	Current map[string]int `json:"current"`
+}
+
+// TenantHeader is set on requests to the tenant they are made on behalf of,
+// and on the responses denying a request for a type of another tenant to the
+// tenant of the type.
+const TenantHeader = "Boskos-Tenant"
+
+// WaitEstimateExceeded is returned by /acquire when boskos estimates that the
+// requested resource will not be available within the max wait of the request.
+type WaitEstimateExceeded struct {
+	Type                 string  `json:"type"`
+	State                string  `json:"state"`
+	EstimatedWaitSeconds float64 `json:"estimated_wait_seconds"`
+	MaxWaitSeconds       float64 `json:"max_wait_seconds"`
+	Message              string  `json:"message"`
+}
+
+// APIVersionHeader is set on the responses of boskos to the latest version of
+// the HTTP API it serves, so clients can switch to it.
+const APIVersionHeader = "Boskos-API-Version"
+
+// APIVersion is the latest version of the HTTP API, served under /v2. It only
+// differs from the unversioned API by returning its errors as APIError.
+const APIVersion = "2"
+
+// Codes of the APIError returned for the errors of boskos. Other errors are
+// identified by their HTTP status text without spaces, e.g. MethodNotAllowed.
+const (
+	ErrorResourceNotFound     = "ResourceNotFound"
+	ErrorResourceTypeNotFound = "ResourceTypeNotFound"
+	ErrorOwnerMismatch        = "OwnerMismatch"
+	ErrorStateMismatch        = "StateMismatch"
+	ErrorQuotaExceeded        = "QuotaExceeded"
+	ErrorLameDuck             = "LameDuck"
+	ErrorReadOnly             = "ReadOnly"
+	ErrorNotLeader            = "NotLeader"
+	ErrorTenantMismatch       = "TenantMismatch"
+	ErrorTransitionDenied     = "TransitionDenied"
+	ErrorTransitionNotAllowed = "TransitionNotAllowed"
+	ErrorPolicyDenied         = "PolicyDenied"
+	ErrorApprovalPending      = "ApprovalPending"
+	ErrorApprovalDenied       = "ApprovalDenied"
+	ErrorApprovalBacklogFull  = "ApprovalBacklogFull"
+	ErrorUserDataTooLarge     = "UserDataTooLarge"
+	ErrorBadRequest           = "BadRequest"
+)
+
+// APIError is the body of the error responses of the v2 API.
+type APIError struct {
+	// Code identifies the error for machines, e.g. ResourceNotFound.
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// DeprecationHeader is set on responses to requests relying on deprecated
+// behavior, once per deprecation, to the ID of the deprecation. A standard
+// Warning header describing it is set along with it.
+const DeprecationHeader = "Boskos-Deprecation"
+
+// UnversionedAPIDeprecation is the ID of the deprecation flagging the requests
+// to the unversioned API.
+const UnversionedAPIDeprecation = "unversioned-api"
+
+// EstimatedWaitHeader is set on acquire responses for queued requests to the
+// estimated number of seconds until a resource becomes available.
+const EstimatedWaitHeader = "Boskos-Estimated-Wait-Seconds"
+
+// HealthAdvisoryHeader is set on acquire responses for degraded resource types
+// to the JSON encoding of the HealthAdvisory of the type.
+const HealthAdvisoryHeader = "Boskos-Health-Advisory"
+
+// ForwardedByHeader is set on the requests a boskos instance forwards to the
+// instance owning the requested resource type, to the name of the forwarding
+// instance. Forwarded requests are always served locally.
+const ForwardedByHeader = "Boskos-Forwarded-By"
+
+// ForwardedIdentityHeader is set on the requests a boskos instance forwards
+// to the identity of their caller, signed with the secret the instances
+// share, so that the owning instance recognizes callers it cannot
+// authenticate itself, like those of the scoped tokens of other instances.
+const ForwardedIdentityHeader = "Boskos-Forwarded-Identity"
+
+// LoadAdviceHeader is set on failed acquire responses to the JSON encoding of
+// the LoadAdvice of the requested type, along with a standard Retry-After
+// header, so clients back off while the type is exhausted.
+const LoadAdviceHeader = "Boskos-Load-Advice"
+
+// LoadAdvice describes the utilization of a resource type for the clients
+// which failed to acquire one.
+type LoadAdvice struct {
+	Type  string `json:"type"`
+	State string `json:"state"`
+	// Pressure is the fraction of the resources of the type which are not
+	// available in the state, from 0 to 1.
+	Pressure    float64 `json:"pressure"`
+	Available   int     `json:"available"`
+	Total       int     `json:"total"`
+	QueueLength int     `json:"queue_length"`
+	// RetryAfterSeconds is how long clients are advised to wait before
+	// retrying.
+	RetryAfterSeconds float64 `json:"retry_after_seconds"`
+}
+
+// QueuedRequest describes an acquire request waiting for a resource.
+type QueuedRequest struct {
+	Type      string    `json:"type"`
+	State     string    `json:"state"`
+	Selector  string    `json:"selector,omitempty"`
+	RequestID string    `json:"request_id"`
+	Owner     string    `json:"owner,omitempty"`
+	Priority  int       `json:"priority,omitempty"`
+	Rank      int       `json:"rank"`
+	CreatedAt time.Time `json:"created_at"`
+	// EstimatedWaitSeconds is unset if there is not enough release history
+	// for the type to tell.
+	EstimatedWaitSeconds *float64 `json:"estimated_wait_seconds,omitempty"`
+	// Health is set if the requested type is degraded.
+	Health *HealthAdvisory `json:"health,omitempty"`
+}
+
+// CleanupStats are rolling statistics of the cleanups of a resource, as
+// reported by its janitor. Durations only cover the successful cleanups.
+type CleanupStats struct {
+	Cleanups       int     `json:"cleanups"`
+	Failures       int     `json:"failures"`
+	LastSeconds    float64 `json:"last_seconds"`
+	AverageSeconds float64 `json:"average_seconds"`
+	MaxSeconds     float64 `json:"max_seconds"`
+	// LastCleanup is when the last cleanup, successful or not, ended.
+	LastCleanup time.Time `json:"last_cleanup"`
+}
+
+// ResourceDescription is a resource returned by /describe, along with the
+// statistics boskos keeps about it.
+type ResourceDescription struct {
+	Resource Resource `json:"resource"`
+	// Cleanup is unset until a janitor reports a cleanup of the resource.
+	Cleanup *CleanupStats `json:"cleanup,omitempty"`
+	// Notes are the notes of operators about the resource, oldest first.
+	Notes []Note `json:"notes,omitempty"`
+}
+
+// Note is a note of an operator about a resource, e.g. to hand over what is
+// known about a flaky resource.
+type Note struct {
+	Author string    `json:"author"`
+	Text   string    `json:"text"`
+	Time   time.Time `json:"time"`
+}
+
+// HealthThresholds are the bounds within which a resource type is healthy.
+// Zero values disable the respective threshold.
+type HealthThresholds struct {
+	// MinFree is the number of free resources below which the type is degraded.
+	MinFree int `json:"min-free,omitempty"`
+	// MaxQueued is the number of queued requests above which the type is degraded.
+	MaxQueued int `json:"max-queued,omitempty"`
+}
+
+const (
+	// HealthCleanupPaused is the reason of the advisory of types whose
+	// cleanup breaker is open.
+	HealthCleanupPaused = "cleanup-paused"
+	// HealthLowFree is the reason of the advisory of types with fewer free
+	// resources than their min-free threshold.
+	HealthLowFree = "low-free"
+	// HealthLongQueue is the reason of the advisory of types with more queued
+	// requests than their max-queued threshold.
+	HealthLongQueue = "long-queue"
+)
+
+// HealthAdvisory tells clients that a resource type is degraded, so they can
+// back off or pick an alternative type.
+type HealthAdvisory struct {
+	Type       string            `json:"type"`
+	Conditions []HealthCondition `json:"conditions"`
+}
+
+// HealthCondition is a reason why a resource type is degraded.
+type HealthCondition struct {
+	// Reason is one of HealthCleanupPaused, HealthLowFree or HealthLongQueue.
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+// HasReason tells whether the advisory has a condition with reason.
+func (h *HealthAdvisory) HasReason(reason string) bool {
+	for _, c := range h.Conditions {
+		if c.Reason == reason {
+			return true
+		}
+	}
+	return false
+}
+
+// Demand is upcoming demand for a resource type declared by a scheduler.
+type Demand struct {
+	Type  string `json:"type"`
+	Count int    `json:"count"`
+	// NeededAt is when the resources are expected to be acquired.
+	NeededAt time.Time `json:"needed_at"`
+	// Expires is when the demand stops being provisioned for.
+	Expires time.Time `json:"expires"`
+	// Acquired is how many of the resources were acquired since the demand
+	// was declared, which are no longer provisioned for on top of those in
+	// use.
+	Acquired int `json:"acquired,omitempty"`
+}
+
+// RegionUserDataKey is the user data key holding the region a dynamic
+// resource was placed in.
+const RegionUserDataKey = "region"
+
+// FlavorUserDataKey is the user data key holding the flavor of a dynamic
+// resource.
+const FlavorUserDataKey = "flavor"
+
+// RegionUsage is the quota usage of a resource type in a region, as reported
+// by a janitor.
+type RegionUsage struct {
+	Type   string `json:"type"`
+	Region string `json:"region"`
+	// Used is how much of the quota is used.
+	Used int `json:"used"`
+	// Limit is the quota of the region.
+	Limit int `json:"limit"`
+	// Placed is how many resources were placed in the region since the
+	// report, which the usage does not account for yet.
+	Placed int `json:"placed,omitempty"`
+	// Reported is when the usage was reported. It is set by boskos.
+	Reported time.Time `json:"reported,omitempty"`
+}
+
+// Booking is a time slice of a resource reserved for an owner.
+type Booking struct {
+	Name  string    `json:"name"`
+	Type  string    `json:"type"`
+	Owner string    `json:"owner"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// DemandDeclared is returned when declaring demand.
+type DemandDeclared struct {
+	// Created is the number of dynamic resources created for the demand.
+	Created int `json:"created"`
+}
+
+// LameDuckStatus tells whether boskos is draining and rejects new acquisitions.
+type LameDuckStatus struct {
+	Enabled bool `json:"enabled"`
+}
+
+// ReadOnlyStatus tells whether boskos rejects every change.
+type ReadOnlyStatus struct {
+	Enabled bool `json:"enabled"`
+	// Follower is set on the replicas which are not the leader, which are
+	// always read-only.
+	Follower bool `json:"follower,omitempty"`
+}
+
+// Kinds of resource events.
+const (
+	ResourceAdded   = "added"
+	ResourceChanged = "changed"
+	ResourceDeleted = "deleted"
+)
+
+// ResourceEvent is a change of the state of a resource streamed by /watch.
+type ResourceEvent struct {
+	// Kind is one of ResourceAdded, ResourceChanged or ResourceDeleted.
+	Kind string    `json:"kind"`
+	Name string    `json:"name"`
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	// State and Owner are those of the resource after the change, and are
+	// empty for deleted resources.
+	State string `json:"state,omitempty"`
+	Owner string `json:"owner,omitempty"`
+	// PreviousState is the state of a changed resource before the change.
+	PreviousState string `json:"previous_state,omitempty"`
+}
+
+// Holding is a period an owner, e.g. a job, held a resource for, computed from
+// the archived events of the resource.
+type Holding struct {
+	Name     string    `json:"name"`
+	Type     string    `json:"type"`
+	Owner    string    `json:"owner"`
+	Acquired time.Time `json:"acquired"`
+	// Released is unset while the owner still holds the resource.
+	Released *time.Time `json:"released,omitempty"`
+}
+
+// Actions recorded in the audit log.
+const (
+	AuditAcquire = "acquire"
+	AuditRelease = "release"
+	AuditUpdate  = "update"
+	AuditReset   = "reset"
+	// AuditForceRelease records an admin releasing or transferring a resource
+	// regardless of its owner.
+	AuditForceRelease = "force-release"
+	// AuditConfirm records an owner confirming its hold on a resource.
+	AuditConfirm = "confirm"
+	// AuditClaim records a janitor claiming a resource whose owner is gone.
+	AuditClaim = "claim"
+	// AuditImport records a resource created by an import.
+	AuditImport = "import"
+)
+
+// AuditEntry records a call changing a resource, e.g. to trace a leaked
+// resource back to the job which held it.
+type AuditEntry struct {
+	Time time.Time `json:"time"`
+	// Action is one of AuditAcquire, AuditRelease, AuditUpdate, AuditReset,
+	// AuditForceRelease, AuditConfirm, AuditClaim or AuditImport.
+	Action string `json:"action"`
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	// Owner is the owner making the call, or the owner whose lease was reset.
+	Owner         string `json:"owner"`
+	PreviousState string `json:"previous_state"`
+	State         string `json:"state"`
+	RequestID     string `json:"request_id,omitempty"`
+}
+
+// Windows of the SLA reports.
+const (
+	SLADaily  = "daily"
+	SLAWeekly = "weekly"
+)
+
+// SLAReport is the report of the service level indicators of the resource
+// types over a window, from Start to End.
+type SLAReport struct {
+	// Window is SLADaily or SLAWeekly.
+	Window string    `json:"window"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Types  []TypeSLA `json:"types"`
+}
+
+// TypeSLA are the service level indicators of a resource type.
+type TypeSLA struct {
+	Type string `json:"type"`
+	// Acquires is the number of acquired resources, and AcquireWaitSeconds how
+	// long their requests waited on average.
+	Acquires           int     `json:"acquires"`
+	AcquireWaitSeconds float64 `json:"acquire_wait_seconds"`
+	// Cleanups is the number of cleanups reported by janitors, and
+	// CleanupSeconds how long they took on average.
+	Cleanups       int     `json:"cleanups"`
+	CleanupSeconds float64 `json:"cleanup_seconds"`
+	// ExhaustedPercent is the percentage of the window no resource of the
+	// type was free.
+	ExhaustedPercent float64 `json:"exhausted_percent"`
+	// Leases is the number of released resources, and LeaseSeconds and
+	// MaxLeaseSeconds how long their owners held them on average and at most.
+	Leases          int     `json:"leases"`
+	LeaseSeconds    float64 `json:"lease_seconds"`
+	MaxLeaseSeconds float64 `json:"max_lease_seconds"`
+}
+
+// Lock is a named lock held by an owner until it expires, unless renewed.
+type Lock struct {
+	Name  string `json:"name"`
+	Owner string `json:"owner"`
+	// Tenant is the tenant the lock was taken on behalf of. Each tenant has
+	// its own locks.
+	Tenant  string    `json:"tenant,omitempty"`
+	Expires time.Time `json:"expires"`
+}
+
+// ImportedLabel marks the resources created by /import instead of listed in
+// the config. Config syncs keep them as long as their type is configured.
+const ImportedLabel = "boskos.k8s.io/imported"
+
+// EphemeralLabel marks the resources of ephemeral types, created on acquire
+// instead of listed in the config. Config syncs keep them as long as their
+// type is configured.
+const EphemeralLabel = "boskos.k8s.io/ephemeral"
+
+// ImportedResource is a resource to create with /import.
+type ImportedResource struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// State defaults to the state of the type in the config.
+	State    string      `json:"state,omitempty"`
+	UserData UserDataMap `json:"userdata,omitempty"`
+}
+
+// ImportError explains why an imported resource is invalid.
+type ImportError struct {
+	// Index is the position of the resource in the import.
+	Index int    `json:"index"`
+	Name  string `json:"name"`
+	Error string `json:"error"`
+}
+
+// ImportSummary is the outcome of an /import. Nothing is created if any of
+// the imported resources is invalid.
+type ImportSummary struct {
+	DryRun bool `json:"dry_run,omitempty"`
+	// Created are the resources created, or to create on a dry run.
+	Created []string `json:"created,omitempty"`
+	// Existing are the resources skipped because they already exist.
+	Existing []string      `json:"existing,omitempty"`
+	Invalid  []ImportError `json:"invalid,omitempty"`
+}
+
+// ShardAssignment is the shard of a member of a shard group. The member only
+// acquires the resources whose name hashes to Index out of Count shards.
+type ShardAssignment struct {
+	Group  string `json:"group"`
+	Member string `json:"member"`
+	Index  int    `json:"index"`
+	Count  int    `json:"count"`
+}
+
 // NewMetric returns a new Metric struct.
 func NewMetric(rtype string) Metric {
 	return Metric{
@@ -169,7 +1082,13 @@ func NewResource(name, rtype, state, owner string, t time.Time) Resource {
 func NewResourcesFromConfig(e ResourceEntry) []Resource {
 	var resources []Resource
 	for _, name := range e.Names {
-		resources = append(resources, NewResource(name, e.Type, e.State, "", time.Time{}))
+		state := e.State
+		if initial, ok := e.InitialStates[name]; ok {
+			state = initial
+		}
+		res := NewResource(name, e.Type, state, "", time.Time{})
+		res.Tenant = e.Tenant
+		resources = append(resources, res)
 	}
 	return resources
 }
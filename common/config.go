@@ -20,8 +20,13 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
 
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/validation"
 	"sigs.k8s.io/yaml"
 )
@@ -37,6 +42,10 @@ func ValidateConfig(config *BoskosConfig) error {
 	resourceTypes := map[string]bool{}
 	resourcesNeeds := map[string]int{}
 	actualResources := map[string]int{}
+	requiredTypes := map[string]int{}
+	aliases := map[string]int{}
+	fallbacks := map[string]int{}
+	tenants := map[string]string{}
 
 	var errs []error
 	for idx, e := range config.Resources {
@@ -51,20 +60,31 @@ func ValidateConfig(config *BoskosConfig) error {
 		names := e.Names
 		if e.IsDRLC() {
 			// Dynamic Resource
-			if e.MaxCount == 0 {
-				errs = append(errs, fmt.Errorf(".%d.max-count: must be >0", idx))
+			maxCount := e.MaxCount
+			if len(e.Flavors) > 0 {
+				if e.MinCount != 0 {
+					errs = append(errs, fmt.Errorf(".%d.min-count must be unset when the flavors property is set", idx))
+				}
+				if e.MaxCount != 0 {
+					errs = append(errs, fmt.Errorf(".%d.max-count must be unset when the flavors property is set", idx))
+				}
+				_, maxCount = FlavorCounts(e.Flavors)
+			} else {
+				if e.MaxCount == 0 {
+					errs = append(errs, fmt.Errorf(".%d.max-count: must be >0", idx))
+				}
+				if e.MinCount > e.MaxCount {
+					errs = append(errs, fmt.Errorf(".%d.min-count: must be <= .%d.max-count", idx, idx))
+				}
 			}
-			if e.MinCount > e.MaxCount {
-				errs = append(errs, fmt.Errorf(".%d.min-count: must be <= .%d.max-count", idx, idx))
-			}
-			for i := 0; i < e.MaxCount; i++ {
+			for i := 0; i < maxCount; i++ {
 				name := GenerateDynamicResourceName()
 				names = append(names, name)
 			}
 
 			// Updating resourceNeeds
 			for k, v := range e.Needs {
-				resourcesNeeds[k] += v * e.MaxCount
+				resourcesNeeds[k] += v * maxCount
 			}
 
 		} else {
@@ -75,6 +95,288 @@ func ValidateConfig(config *BoskosConfig) error {
 				errs = append(errs, fmt.Errorf(".%d.max-count must be unset when the names property is set", idx))
 			}
 		}
+		if q := e.OwnerQuota; q != nil {
+			if q.Soft < 0 {
+				errs = append(errs, fmt.Errorf(".%d.owner-quota.soft: must be >=0", idx))
+			}
+			if q.Burst < 0 {
+				errs = append(errs, fmt.Errorf(".%d.owner-quota.burst: must be >=0", idx))
+			}
+			hasCredit := q.BurstCredit != nil && q.BurstCredit.Duration != nil && *q.BurstCredit.Duration > 0
+			if q.Burst > 0 && !hasCredit {
+				errs = append(errs, fmt.Errorf(".%d.owner-quota.burst-credit: must be >0 when burst is set", idx))
+			}
+			for owner, limits := range q.Owners {
+				if limits.Soft < 0 {
+					errs = append(errs, fmt.Errorf(".%d.owner-quota.owners.%s.soft: must be >=0", idx, owner))
+				}
+				if limits.Burst < 0 {
+					errs = append(errs, fmt.Errorf(".%d.owner-quota.owners.%s.burst: must be >=0", idx, owner))
+				}
+				if limits.Burst > 0 && !hasCredit {
+					errs = append(errs, fmt.Errorf(".%d.owner-quota.burst-credit: must be >0 when the burst of owner %s is set", idx, owner))
+				}
+			}
+		}
+		if cb := e.CleanupBreaker; cb != nil {
+			if cb.MaxFailurePercent <= 0 || cb.MaxFailurePercent > 100 {
+				errs = append(errs, fmt.Errorf(".%d.cleanup-breaker.max-failure-percent: must be within ]0, 100]", idx))
+			}
+			if cb.Window == nil || cb.Window.Duration == nil || *cb.Window.Duration <= 0 {
+				errs = append(errs, fmt.Errorf(".%d.cleanup-breaker.window: must be >0", idx))
+			}
+			if cb.MinCleanups < 0 {
+				errs = append(errs, fmt.Errorf(".%d.cleanup-breaker.min-cleanups: must be >=0", idx))
+			}
+		}
+		if ts := e.TimeSlice; ts != nil {
+			if ts.Duration == nil || *ts.Duration <= 0 {
+				errs = append(errs, fmt.Errorf(".%d.time-slice: must be >0", idx))
+			}
+			if e.IsDRLC() {
+				errs = append(errs, fmt.Errorf(".%d.time-slice: only supported for static resources", idx))
+			}
+		}
+		if cr := e.CredentialRotation; cr != nil {
+			known := false
+			for _, rotator := range CredentialRotators {
+				known = known || cr.Rotator == rotator
+			}
+			if !known {
+				errs = append(errs, fmt.Errorf(".%d.credential-rotation.rotator: must be one of %v", idx, CredentialRotators))
+			}
+		}
+		if p := e.Ephemeral; p != nil {
+			if len(e.Names) > 0 {
+				errs = append(errs, fmt.Errorf(".%d.ephemeral: names must be unset for ephemeral resources", idx))
+			}
+			if p.MaxConcurrency <= 0 {
+				errs = append(errs, fmt.Errorf(".%d.ephemeral.max-concurrency: must be >0", idx))
+			}
+			if len(p.Command) == 0 {
+				if u, err := url.Parse(p.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+					errs = append(errs, fmt.Errorf(".%d.ephemeral.url: must be an http(s) URL unless the command is set", idx))
+				}
+			} else if p.URL != "" {
+				errs = append(errs, fmt.Errorf(".%d.ephemeral: only one of url and command may be set", idx))
+			}
+			if p.Timeout != nil && (p.Timeout.Duration == nil || *p.Timeout.Duration <= 0) {
+				errs = append(errs, fmt.Errorf(".%d.ephemeral.timeout: must be >0", idx))
+			}
+		}
+		if w := e.TransitionWebhook; w != nil {
+			if u, err := url.Parse(w.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				errs = append(errs, fmt.Errorf(".%d.transition-webhook.url: must be an http(s) URL", idx))
+			}
+			if w.Timeout != nil && (w.Timeout.Duration == nil || *w.Timeout.Duration <= 0) {
+				errs = append(errs, fmt.Errorf(".%d.transition-webhook.timeout: must be >0", idx))
+			}
+		}
+		if a := e.Approval; a != nil {
+			if a.WebhookURL != "" {
+				if u, err := url.Parse(a.WebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+					errs = append(errs, fmt.Errorf(".%d.approval.webhook-url: must be an http(s) URL", idx))
+				}
+			}
+			if a.Timeout != nil && (a.Timeout.Duration == nil || *a.Timeout.Duration <= 0) {
+				errs = append(errs, fmt.Errorf(".%d.approval.timeout: must be >0", idx))
+			}
+			if a.MaxPending < 0 {
+				errs = append(errs, fmt.Errorf(".%d.approval.max-pending: must be >=0", idx))
+			}
+		}
+		lastVersion := 0
+		for mIdx, m := range e.UserDataMigrations {
+			if m.Version <= lastVersion {
+				errs = append(errs, fmt.Errorf(".%d.user-data-migrations.%d.version: must be >0 and greater than the previous version", idx, mIdx))
+			}
+			lastVersion = m.Version
+			known := false
+			for _, op := range UserDataMigrationOps {
+				known = known || m.Op == op
+			}
+			if !known {
+				errs = append(errs, fmt.Errorf(".%d.user-data-migrations.%d.op: must be one of %v", idx, mIdx, UserDataMigrationOps))
+			}
+			if m.Key == "" {
+				errs = append(errs, fmt.Errorf(".%d.user-data-migrations.%d.key: must be set", idx, mIdx))
+			}
+			if m.Op == RenameUserData && (m.To == "" || m.To == m.Key) {
+				errs = append(errs, fmt.Errorf(".%d.user-data-migrations.%d.to: must be set to another key", idx, mIdx))
+			}
+			if m.Op == SetDefaultUserData && m.Value == "" {
+				errs = append(errs, fmt.Errorf(".%d.user-data-migrations.%d.value: must be set", idx, mIdx))
+			}
+		}
+		if h := e.HealthThresholds; h != nil {
+			if h.MinFree < 0 {
+				errs = append(errs, fmt.Errorf(".%d.health-thresholds.min-free: must be >=0", idx))
+			}
+			if h.MaxQueued < 0 {
+				errs = append(errs, fmt.Errorf(".%d.health-thresholds.max-queued: must be >=0", idx))
+			}
+		}
+		for key, text := range e.Access {
+			if key == "" {
+				errs = append(errs, fmt.Errorf(".%d.access: keys must not be empty", idx))
+			}
+			if _, err := (AccessTemplates{key: text}).Parse(); err != nil {
+				errs = append(errs, fmt.Errorf(".%d.access.%s: %v", idx, key, err))
+			}
+		}
+		if len(e.States) > 0 {
+			allowed := sets.NewString(e.States...)
+			if !allowed.Has(e.State) {
+				errs = append(errs, fmt.Errorf(".%d.states: must include the state %s of the resources", idx, e.State))
+			}
+			if allowed.Has("") {
+				errs = append(errs, fmt.Errorf(".%d.states: must not be empty", idx))
+			}
+		}
+		for _, alias := range sets.StringKeySet(e.StateAliases).List() {
+			state := e.StateAliases[alias]
+			if alias == "" || state == "" {
+				errs = append(errs, fmt.Errorf(".%d.state-aliases: states must not be empty", idx))
+				continue
+			}
+			if _, ok := e.StateAliases[state]; ok {
+				errs = append(errs, fmt.Errorf(".%d.state-aliases.%s: state %s must not be an alias itself", idx, alias, state))
+			}
+			if len(e.States) > 0 {
+				if sets.NewString(e.States...).Has(alias) {
+					errs = append(errs, fmt.Errorf(".%d.state-aliases.%s: must not be one of the states %v", idx, alias, e.States))
+				}
+				if !sets.NewString(e.States...).Has(state) {
+					errs = append(errs, fmt.Errorf(".%d.state-aliases.%s: state %s must be one of the states %v", idx, alias, state, e.States))
+				}
+			}
+		}
+		for _, from := range sets.StringKeySet(e.Transitions).List() {
+			if from == "" {
+				errs = append(errs, fmt.Errorf(".%d.transitions: states must not be empty", idx))
+				continue
+			}
+			if len(e.States) > 0 && !sets.NewString(e.States...).Has(from) {
+				errs = append(errs, fmt.Errorf(".%d.transitions.%s: must be one of the states %v", idx, from, e.States))
+			}
+			for _, to := range e.Transitions[from] {
+				if to == "" {
+					errs = append(errs, fmt.Errorf(".%d.transitions.%s: states must not be empty", idx, from))
+				} else if len(e.States) > 0 && !sets.NewString(e.States...).Has(to) {
+					errs = append(errs, fmt.Errorf(".%d.transitions.%s: state %s must be one of the states %v", idx, from, to, e.States))
+				}
+			}
+		}
+		if len(e.InitialStates) > 0 {
+			configured := sets.NewString(e.Names...)
+			for _, name := range sets.StringKeySet(e.InitialStates).List() {
+				state := e.InitialStates[name]
+				if !configured.Has(name) {
+					errs = append(errs, fmt.Errorf(".%d.initial-states.%s: must be one of the names", idx, name))
+				}
+				if state == "" {
+					errs = append(errs, fmt.Errorf(".%d.initial-states.%s: must not be empty", idx, name))
+				} else if len(e.States) > 0 && !sets.NewString(e.States...).Has(state) {
+					errs = append(errs, fmt.Errorf(".%d.initial-states.%s: must be one of the states %v", idx, name, e.States))
+				}
+			}
+		}
+		for aIdx, alias := range e.Aliases {
+			if alias.Name == "" {
+				errs = append(errs, fmt.Errorf(".%d.aliases.%d.name: must be set", idx, aIdx))
+				continue
+			}
+			if _, ok := aliases[alias.Name]; ok {
+				errs = append(errs, fmt.Errorf(".%d.aliases.%d(%s) is a duplicate", idx, aIdx, alias.Name))
+				continue
+			}
+			aliases[alias.Name] = idx
+		}
+		if e.Fallback != "" {
+			if e.Fallback == e.Type {
+				errs = append(errs, fmt.Errorf(".%d.fallback: must not be its own type", idx))
+			}
+			fallbacks[e.Fallback] = idx
+		}
+		if e.Tenant != "" {
+			if validationErrs := validation.IsDNS1123Label(e.Tenant); len(validationErrs) != 0 {
+				errs = append(errs, fmt.Errorf(".%d.tenant(%s) is invalid: %v", idx, e.Tenant, validationErrs))
+			}
+		}
+		tenants[e.Type] = e.Tenant
+		if e.Policy != nil {
+			for _, entries := range []struct {
+				field    string
+				patterns []string
+			}{
+				{"acquirers", e.Policy.Acquirers},
+				{"resetters", e.Policy.Resetters},
+			} {
+				for pIdx, pattern := range entries.patterns {
+					if _, err := regexp.Compile(pattern); err != nil {
+						errs = append(errs, fmt.Errorf(".%d.policy.%s.%d: %v", idx, entries.field, pIdx, err))
+					}
+				}
+			}
+		}
+		if e.MaxLifetime != nil {
+			if !e.IsDRLC() {
+				errs = append(errs, fmt.Errorf(".%d.max-lifetime: only supported for dynamic resources", idx))
+			} else if e.MaxLifetime.Duration == nil || *e.MaxLifetime.Duration <= 0 {
+				errs = append(errs, fmt.Errorf(".%d.max-lifetime: must be >0", idx))
+			}
+		}
+		if len(e.Regions) > 0 {
+			if !e.IsDRLC() {
+				errs = append(errs, fmt.Errorf(".%d.regions: only supported for dynamic resources", idx))
+			}
+			regions := sets.NewString()
+			for rIdx, region := range e.Regions {
+				if region == "" {
+					errs = append(errs, fmt.Errorf(".%d.regions.%d: must not be empty", idx, rIdx))
+				} else if regions.Has(region) {
+					errs = append(errs, fmt.Errorf(".%d.regions.%d(%s) is a duplicate", idx, rIdx, region))
+				}
+				regions.Insert(region)
+			}
+		}
+		if len(e.Flavors) > 0 {
+			if !e.IsDRLC() {
+				errs = append(errs, fmt.Errorf(".%d.flavors: only supported for dynamic resources", idx))
+			}
+			flavors := sets.NewString()
+			for fIdx, f := range e.Flavors {
+				if validationErrs := validation.IsValidLabelValue(f.Name); f.Name == "" || len(validationErrs) != 0 {
+					errs = append(errs, fmt.Errorf(".%d.flavors.%d.name(%s) is invalid: must be a non-empty label value", idx, fIdx, f.Name))
+				} else if flavors.Has(f.Name) {
+					errs = append(errs, fmt.Errorf(".%d.flavors.%d.name(%s) is a duplicate", idx, fIdx, f.Name))
+				}
+				flavors.Insert(f.Name)
+				if f.MaxCount <= 0 {
+					errs = append(errs, fmt.Errorf(".%d.flavors.%d.max-count: must be >0", idx, fIdx))
+				}
+				if f.MinCount < 0 || f.MinCount > f.MaxCount {
+					errs = append(errs, fmt.Errorf(".%d.flavors.%d.min-count: must be within [0, .%d.flavors.%d.max-count]", idx, fIdx, idx, fIdx))
+				}
+				for key, text := range f.UserData {
+					if key == "" || key == FlavorUserDataKey {
+						errs = append(errs, fmt.Errorf(".%d.flavors.%d.user-data: keys must not be empty or %s", idx, fIdx, FlavorUserDataKey))
+					}
+					if _, err := (AccessTemplates{key: text}).Parse(); err != nil {
+						errs = append(errs, fmt.Errorf(".%d.flavors.%d.user-data.%s: %v", idx, fIdx, key, err))
+					}
+				}
+			}
+		}
+		for rType, count := range e.Requires {
+			if rType == e.Type {
+				errs = append(errs, fmt.Errorf(".%d.requires.%s: must not require its own type", idx, rType))
+			}
+			if count <= 0 {
+				errs = append(errs, fmt.Errorf(".%d.requires.%s: must be >0", idx, rType))
+			}
+			requiredTypes[rType] = idx
+		}
 		actualResources[e.Type] += len(names)
 		for nameIdx, name := range names {
 			validationErrs := validation.IsDNS1123Subdomain(name)
@@ -90,6 +392,47 @@ func ValidateConfig(config *BoskosConfig) error {
 		}
 	}
 
+	for rType, idx := range requiredTypes {
+		if _, ok := actualResources[rType]; !ok {
+			errs = append(errs, fmt.Errorf(".%d.requires.%s: resource type does not exist", idx, rType))
+		}
+	}
+	// Requirements are co-acquired transitively, so they must not form cycles.
+	// Each cycle is reported once, by its smallest type.
+	requires := map[string]ResourceNeeds{}
+	for _, e := range config.Resources {
+		requires[e.Type] = e.Requires
+	}
+	for idx, e := range config.Resources {
+		if cycle := requirementCycle(requires, e.Type); cycle != nil && e.Type == sets.NewString(cycle...).List()[0] {
+			errs = append(errs, fmt.Errorf(".%d.requires: forms a cycle %s", idx, strings.Join(cycle, " -> ")))
+		}
+	}
+	for rType, idx := range fallbacks {
+		if _, ok := actualResources[rType]; !ok {
+			errs = append(errs, fmt.Errorf(".%d.fallback.%s: resource type does not exist", idx, rType))
+		}
+	}
+	// Resources acquired along with or instead of those of a tenant must be
+	// acquirable by the tenant.
+	for idx, e := range config.Resources {
+		if e.Tenant == "" {
+			continue
+		}
+		for rType := range e.Requires {
+			if tenant := tenants[rType]; tenant != "" && tenant != e.Tenant {
+				errs = append(errs, fmt.Errorf(".%d.requires.%s: belongs to tenant %s", idx, rType, tenant))
+			}
+		}
+		if tenant := tenants[e.Fallback]; e.Fallback != "" && tenant != "" && tenant != e.Tenant {
+			errs = append(errs, fmt.Errorf(".%d.fallback.%s: belongs to tenant %s", idx, e.Fallback, tenant))
+		}
+	}
+	for alias, idx := range aliases {
+		if _, ok := actualResources[alias]; ok {
+			errs = append(errs, fmt.Errorf(".%d.aliases: %s is an existing resource type", idx, alias))
+		}
+	}
 	for rType, needs := range resourcesNeeds {
 		actual, ok := actualResources[rType]
 		if !ok {
@@ -99,9 +442,44 @@ func ValidateConfig(config *BoskosConfig) error {
 			errs = append(errs, fmt.Errorf("not enough resource of type %s for provisioning", rType))
 		}
 	}
+	if r := config.Requests; r != nil {
+		if r.TTL != nil && (r.TTL.Duration == nil || *r.TTL.Duration <= 0) {
+			errs = append(errs, errors.New(".requests.ttl: must be >0"))
+		}
+		if r.GCPeriod != nil && (r.GCPeriod.Duration == nil || *r.GCPeriod.Duration <= 0) {
+			errs = append(errs, errors.New(".requests.gc-period: must be >0"))
+		}
+	}
 	return utilerrors.NewAggregate(errs)
 }
 
+// requirementCycle returns a cycle of requirements through rType, starting and
+// ending with it, or nil if there is none. Types requiring themselves are
+// reported on their own.
+func requirementCycle(requires map[string]ResourceNeeds, rType string) []string {
+	var visit func(path []string) []string
+	visit = func(path []string) []string {
+		last := path[len(path)-1]
+		for _, next := range sets.StringKeySet(requires[last]).List() {
+			if next == last {
+				continue
+			}
+			if next == rType {
+				return append(path, next)
+			}
+			if sets.NewString(path...).Has(next) {
+				// A cycle through other types, found from them.
+				continue
+			}
+			if cycle := visit(append(path, next)); cycle != nil {
+				return cycle
+			}
+		}
+		return nil
+	}
+	return visit([]string{rType})
+}
+
 // ParseConfig reads in configPath and returns a list of resource objects
 // on success.
 func ParseConfig(configPath string) (*BoskosConfig, error) {
@@ -109,10 +487,84 @@ func ParseConfig(configPath string) (*BoskosConfig, error) {
 	if err != nil {
 		return nil, err
 	}
+	return UnmarshalConfig(file)
+}
 
+// UnmarshalConfig parses a config read from elsewhere than a file. The name
+// ranges of the resources are expanded, see ExpandNames.
+func UnmarshalConfig(file []byte) (*BoskosConfig, error) {
 	var data BoskosConfig
 	if err := yaml.Unmarshal(file, &data); err != nil {
 		return nil, err
 	}
+	for idx := range data.Resources {
+		names, err := ExpandNames(data.Resources[idx].Names)
+		if err != nil {
+			return nil, fmt.Errorf(".%d.names.%w", idx, err)
+		}
+		data.Resources[idx].Names = names
+	}
 	return &data, nil
 }
+
+// MaxExpandedNames bounds how many names a single name range may expand to,
+// so a typo in a range does not create millions of resources.
+const MaxExpandedNames = 10000
+
+// nameRange matches the ranges of numbers in resource names, like {01..50}.
+var nameRange = regexp.MustCompile(`\{(\d+)\.\.(\d+)\}`)
+
+// ExpandNames expands the ranges of numbers in names, e.g. gce-project-{01..50}
+// to gce-project-01 through gce-project-50. Numbers are padded with zeros to the
+// width of the bounds if either starts with a zero. A name with several ranges
+// expands to all of their combinations.
+func ExpandNames(names []string) ([]string, error) {
+	var expanded []string
+	for idx, name := range names {
+		matches := nameRange.FindAllStringSubmatchIndex(name, -1)
+		if matches == nil {
+			expanded = append(expanded, name)
+			continue
+		}
+		combinations := []string{""}
+		last := 0
+		for _, m := range matches {
+			first, err := strconv.Atoi(name[m[2]:m[3]])
+			if err != nil {
+				return nil, fmt.Errorf("%d(%s): %v", idx, name, err)
+			}
+			end, err := strconv.Atoi(name[m[4]:m[5]])
+			if err != nil {
+				return nil, fmt.Errorf("%d(%s): %v", idx, name, err)
+			}
+			if first > end {
+				return nil, fmt.Errorf("%d(%s): range %s must not be decreasing", idx, name, name[m[0]:m[1]])
+			}
+			// The bounds are checked before multiplying, which would
+			// overflow with huge ranges.
+			if end-first >= MaxExpandedNames || len(combinations) > MaxExpandedNames/(end-first+1) {
+				return nil, fmt.Errorf("%d(%s): expands to more than %d names", idx, name, MaxExpandedNames)
+			}
+			format := "%d"
+			if lower, upper := name[m[2]:m[3]], name[m[4]:m[5]]; (len(lower) > 1 && lower[0] == '0') || (len(upper) > 1 && upper[0] == '0') {
+				width := len(lower)
+				if len(upper) > width {
+					width = len(upper)
+				}
+				format = fmt.Sprintf("%%0%dd", width)
+			}
+			prefix := name[last:m[0]]
+			var next []string
+			for _, c := range combinations {
+				for i := first; i <= end; i++ {
+					next = append(next, c+prefix+fmt.Sprintf(format, i))
+				}
+			}
+			combinations, last = next, m[1]
+		}
+		for _, c := range combinations {
+			expanded = append(expanded, c+name[last:])
+		}
+	}
+	return expanded, nil
+}
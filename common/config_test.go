@@ -18,6 +18,7 @@ package common
 
 import (
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 )
@@ -92,6 +93,328 @@ func TestValidateConfig(t *testing.T) {
 			}}},
 			expectedErrMsg: "[.0.min-count must be unset when the names property is set, .0.max-count must be unset when the names property is set]",
 		},
+		{
+			name: "Burst quota without credit",
+			in: &BoskosConfig{Resources: []ResourceEntry{{
+				State:      "free",
+				Type:       "some-type",
+				Names:      []string{"my-resource"},
+				OwnerQuota: &OwnerQuota{Soft: 1, Burst: 1},
+			}}},
+			expectedErrMsg: ".0.owner-quota.burst-credit: must be >0 when burst is set",
+		},
+		{
+			name: "Owner quota override with negative soft quota",
+			in: &BoskosConfig{Resources: []ResourceEntry{{
+				State:      "free",
+				Type:       "some-type",
+				Names:      []string{"my-resource"},
+				OwnerQuota: &OwnerQuota{Soft: 1, Owners: map[string]OwnerQuotaLimits{"scale-test": {Soft: -1}}},
+			}}},
+			expectedErrMsg: ".0.owner-quota.owners.scale-test.soft: must be >=0",
+		},
+		{
+			name: "Requires unknown type",
+			in: &BoskosConfig{Resources: []ResourceEntry{{
+				State:    "free",
+				Type:     "some-type",
+				Names:    []string{"my-resource"},
+				Requires: ResourceNeeds{"ip-block": 1},
+			}}},
+			expectedErrMsg: ".0.requires.ip-block: resource type does not exist",
+		},
+		{
+			name: "Requirements forming a cycle",
+			in: &BoskosConfig{Resources: []ResourceEntry{
+				{State: "free", Type: "network", Names: []string{"network-1"}, Requires: ResourceNeeds{"project": 1}},
+				{State: "free", Type: "cluster", Names: []string{"cluster-1"}, Requires: ResourceNeeds{"network": 1}},
+				{State: "free", Type: "project", Names: []string{"project-1"}, Requires: ResourceNeeds{"cluster": 1}},
+			}},
+			expectedErrMsg: ".1.requires: forms a cycle cluster -> network -> project -> cluster",
+		},
+		{
+			name: "Cleanup breaker without window",
+			in: &BoskosConfig{Resources: []ResourceEntry{{
+				State:          "free",
+				Type:           "some-type",
+				Names:          []string{"my-resource"},
+				CleanupBreaker: &CleanupBreaker{MaxFailurePercent: 50},
+			}}},
+			expectedErrMsg: ".0.cleanup-breaker.window: must be >0",
+		},
+		{
+			name: "Unknown credential rotator",
+			in: &BoskosConfig{Resources: []ResourceEntry{{
+				State:              "free",
+				Type:               "some-type",
+				Names:              []string{"my-resource"},
+				CredentialRotation: &CredentialRotation{Rotator: "vault"},
+			}}},
+			expectedErrMsg: ".0.credential-rotation.rotator: must be one of [static aws-access-key gcp-sa-key]",
+		},
+		{
+			name: "Transition webhook without URL",
+			in: &BoskosConfig{Resources: []ResourceEntry{{
+				State:             "free",
+				Type:              "some-type",
+				Names:             []string{"my-resource"},
+				TransitionWebhook: &TransitionWebhook{URL: "verifier/admit"},
+			}}},
+			expectedErrMsg: ".0.transition-webhook.url: must be an http(s) URL",
+		},
+		{
+			name: "Approval webhook without scheme",
+			in: &BoskosConfig{Resources: []ResourceEntry{{
+				State:    "free",
+				Type:     "some-type",
+				Names:    []string{"my-resource"},
+				Approval: &AcquisitionApproval{WebhookURL: "chat-bot/approvals"},
+			}}},
+			expectedErrMsg: ".0.approval.webhook-url: must be an http(s) URL",
+		},
+		{
+			name: "User data migrations out of order",
+			in: &BoskosConfig{Resources: []ResourceEntry{{
+				State: "free",
+				Type:  "some-type",
+				Names: []string{"my-resource"},
+				UserDataMigrations: []UserDataMigration{
+					{Version: 2, Op: DropUserData, Key: "legacy"},
+					{Version: 1, Op: SetDefaultUserData, Key: "region", Value: "us-east1"},
+				},
+			}}},
+			expectedErrMsg: ".0.user-data-migrations.1.version: must be >0 and greater than the previous version",
+		},
+		{
+			name: "Invalid access template",
+			in: &BoskosConfig{Resources: []ResourceEntry{{
+				State:  "free",
+				Type:   "some-type",
+				Names:  []string{"my-resource"},
+				Access: AccessTemplates{"endpoint": "https://{{.UserData.host"},
+			}}},
+			expectedErrMsg: ".0.access.endpoint: template: endpoint:1: unclosed action",
+		},
+		{
+			name: "Alias of an existing type",
+			in: &BoskosConfig{Resources: []ResourceEntry{
+				{
+					State:   "free",
+					Type:    "some-type",
+					Names:   []string{"my-resource"},
+					Aliases: []TypeAlias{{Name: "other-type"}},
+				},
+				{
+					State: "free",
+					Type:  "other-type",
+					Names: []string{"other-resource"},
+				},
+			}},
+			expectedErrMsg: ".0.aliases: other-type is an existing resource type",
+		},
+		{
+			name: "States without the initial state",
+			in: &BoskosConfig{Resources: []ResourceEntry{{
+				State:  "dirty",
+				Type:   "some-type",
+				Names:  []string{"my-resource"},
+				States: []string{"free", "busy"},
+			}}},
+			expectedErrMsg: ".0.states: must include the state dirty of the resources",
+		},
+		{
+			name: "Fallback to unknown type",
+			in: &BoskosConfig{Resources: []ResourceEntry{{
+				State:    "free",
+				Type:     "some-type",
+				Names:    []string{"my-resource"},
+				Fallback: "global-type",
+			}}},
+			expectedErrMsg: ".0.fallback.global-type: resource type does not exist",
+		},
+		{
+			name: "Duplicate region",
+			in: &BoskosConfig{Resources: []ResourceEntry{{
+				State:    "free",
+				Type:     "some-type",
+				MaxCount: 2,
+				Regions:  []string{"us-east-1", "us-east-1"},
+			}}},
+			expectedErrMsg: ".0.regions.1(us-east-1) is a duplicate",
+		},
+		{
+			name: "Regions of static resources",
+			in: &BoskosConfig{Resources: []ResourceEntry{{
+				State:   "free",
+				Type:    "some-type",
+				Names:   []string{"my-resource"},
+				Regions: []string{"us-east-1"},
+			}}},
+			expectedErrMsg: ".0.regions: only supported for dynamic resources",
+		},
+		{
+			name: "Flavors",
+			in: &BoskosConfig{Resources: []ResourceEntry{{
+				State: "free",
+				Type:  "some-type",
+				Flavors: []DynamicResourceFlavor{
+					{Name: "small", MinCount: 1, MaxCount: 4},
+					{Name: "large", MaxCount: 2, UserData: AccessTemplates{"machine-type": "n1-standard-16"}},
+				},
+			}}},
+		},
+		{
+			name: "Flavors with max count",
+			in: &BoskosConfig{Resources: []ResourceEntry{{
+				State:    "free",
+				Type:     "some-type",
+				MaxCount: 2,
+				Flavors:  []DynamicResourceFlavor{{Name: "small", MaxCount: 2}},
+			}}},
+			expectedErrMsg: ".0.max-count must be unset when the flavors property is set",
+		},
+		{
+			name: "Duplicate flavor",
+			in: &BoskosConfig{Resources: []ResourceEntry{{
+				State:   "free",
+				Type:    "some-type",
+				Flavors: []DynamicResourceFlavor{{Name: "small", MaxCount: 2}, {Name: "small", MaxCount: 1}},
+			}}},
+			expectedErrMsg: ".0.flavors.1.name(small) is a duplicate",
+		},
+		{
+			name: "Flavor min count above max count",
+			in: &BoskosConfig{Resources: []ResourceEntry{{
+				State:   "free",
+				Type:    "some-type",
+				Flavors: []DynamicResourceFlavor{{Name: "small", MinCount: 3, MaxCount: 2}},
+			}}},
+			expectedErrMsg: ".0.flavors.0.min-count: must be within [0, .0.flavors.0.max-count]",
+		},
+		{
+			name: "Flavor user data overriding the flavor",
+			in: &BoskosConfig{Resources: []ResourceEntry{{
+				State:   "free",
+				Type:    "some-type",
+				Flavors: []DynamicResourceFlavor{{Name: "small", MaxCount: 2, UserData: AccessTemplates{FlavorUserDataKey: "large"}}},
+			}}},
+			expectedErrMsg: ".0.flavors.0.user-data: keys must not be empty or flavor",
+		},
+		{
+			name: "Invalid tenant",
+			in: &BoskosConfig{Resources: []ResourceEntry{{
+				State:  "free",
+				Type:   "some-type",
+				Names:  []string{"my-resource"},
+				Tenant: "Team_A",
+			}}},
+			expectedErrMsg: ".0.tenant(Team_A) is invalid: [a lowercase RFC 1123 label must consist of lower case alphanumeric characters or '-', and must start and end with an alphanumeric character (e.g. 'my-name',  or '123-abc', regex used for validation is '[a-z0-9]([-a-z0-9]*[a-z0-9])?')]",
+		},
+		{
+			name: "Fallback to the type of another tenant",
+			in: &BoskosConfig{Resources: []ResourceEntry{
+				{
+					State:    "free",
+					Type:     "some-type",
+					Names:    []string{"my-resource"},
+					Fallback: "other-type",
+					Tenant:   "team-a",
+				},
+				{
+					State:  "free",
+					Type:   "other-type",
+					Names:  []string{"other-resource"},
+					Tenant: "team-b",
+				},
+			}},
+			expectedErrMsg: ".0.fallback.other-type: belongs to tenant team-b",
+		},
+		{
+			name: "Fallback of a tenant to a shared type",
+			in: &BoskosConfig{Resources: []ResourceEntry{
+				{
+					State:    "free",
+					Type:     "some-type",
+					Names:    []string{"my-resource"},
+					Fallback: "other-type",
+					Tenant:   "team-a",
+				},
+				{
+					State: "free",
+					Type:  "other-type",
+					Names: []string{"other-resource"},
+				},
+			}},
+		},
+		{
+			name: "Invalid policy",
+			in: &BoskosConfig{Resources: []ResourceEntry{{
+				State:  "free",
+				Type:   "some-type",
+				Names:  []string{"my-resource"},
+				Policy: &TypePolicy{Resetters: []string{"admin", "team-(a"}},
+			}}},
+			expectedErrMsg: ".0.policy.resetters.1: error parsing regexp: missing closing ): `team-(a`",
+		},
+		{
+			name: "Invalid requests config",
+			in: &BoskosConfig{
+				Resources: []ResourceEntry{{State: "free", Type: "some-type", Names: []string{"my-resource"}}},
+				Requests:  &RequestsConfig{TTL: &Duration{Duration: new(time.Duration)}, GCPeriod: &Duration{}},
+			},
+			expectedErrMsg: "[.requests.ttl: must be >0, .requests.gc-period: must be >0]",
+		},
+		{
+			name: "Initial states",
+			in: &BoskosConfig{Resources: []ResourceEntry{{
+				State:         "free",
+				Type:          "some-type",
+				Names:         []string{"my-resource", "other-resource"},
+				InitialStates: map[string]string{"other-resource": "dirty"},
+			}}},
+		},
+		{
+			name: "Invalid initial states",
+			in: &BoskosConfig{Resources: []ResourceEntry{{
+				State:         "free",
+				Type:          "some-type",
+				Names:         []string{"my-resource", "other-resource"},
+				States:        []string{"free", "dirty", "busy"},
+				InitialStates: map[string]string{"my-resource": "", "other-resource": "tainted", "unknown": "dirty"},
+			}}},
+			expectedErrMsg: "[.0.initial-states.my-resource: must not be empty, .0.initial-states.other-resource: must be one of the states [free dirty busy], .0.initial-states.unknown: must be one of the names]",
+		},
+		{
+			name: "Transitions",
+			in: &BoskosConfig{Resources: []ResourceEntry{{
+				State:       "free",
+				Type:        "some-type",
+				Names:       []string{"my-resource"},
+				Transitions: map[string][]string{"dirty": {"cleaning"}, "cleaning": {"free", "dirty"}},
+			}}},
+		},
+		{
+			name: "Invalid transitions",
+			in: &BoskosConfig{Resources: []ResourceEntry{{
+				State:       "free",
+				Type:        "some-type",
+				Names:       []string{"my-resource"},
+				States:      []string{"free", "dirty", "cleaning"},
+				Transitions: map[string][]string{"busy": {"dirty"}, "dirty": {"", "tainted"}},
+			}}},
+			expectedErrMsg: "[.0.transitions.busy: must be one of the states [free dirty cleaning], .0.transitions.dirty: states must not be empty, .0.transitions.dirty: state tainted must be one of the states [free dirty cleaning]]",
+		},
+		{
+			name: "Invalid state aliases",
+			in: &BoskosConfig{Resources: []ResourceEntry{{
+				State:        "free",
+				Type:         "some-type",
+				Names:        []string{"my-resource"},
+				States:       []string{"free", "dirty", "leased-out"},
+				StateAliases: map[string]string{"busy": "leased", "dirty": "free", "leased": "leased-out"},
+			}}},
+			expectedErrMsg: "[.0.state-aliases.busy: state leased must not be an alias itself, .0.state-aliases.busy: state leased must be one of the states [free dirty leased-out], .0.state-aliases.dirty: must not be one of the states [free dirty leased-out]]",
+		},
 	}
 
 	for _, tc := range testCases {
@@ -109,3 +432,87 @@ func TestValidateConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestExpandNames(t *testing.T) {
+	testCases := []struct {
+		name           string
+		in             []string
+		expected       []string
+		expectedErrMsg string
+	}{
+		{
+			name:     "no range",
+			in:       []string{"project", "other-project"},
+			expected: []string{"project", "other-project"},
+		},
+		{
+			name:     "padded range",
+			in:       []string{"project", "gce-project-{08..11}"},
+			expected: []string{"project", "gce-project-08", "gce-project-09", "gce-project-10", "gce-project-11"},
+		},
+		{
+			name:     "unpadded range",
+			in:       []string{"gce-project-{9..11}-east"},
+			expected: []string{"gce-project-9-east", "gce-project-10-east", "gce-project-11-east"},
+		},
+		{
+			name:     "several ranges",
+			in:       []string{"account-{1..2}-cluster-{1..2}"},
+			expected: []string{"account-1-cluster-1", "account-1-cluster-2", "account-2-cluster-1", "account-2-cluster-2"},
+		},
+		{
+			name:           "decreasing range",
+			in:             []string{"project", "project-{5..1}"},
+			expectedErrMsg: "1(project-{5..1}): range {5..1} must not be decreasing",
+		},
+		{
+			name:           "too many names",
+			in:             []string{"project-{1..100}-{1..101}"},
+			expectedErrMsg: "0(project-{1..100}-{1..101}): expands to more than 10000 names",
+		},
+		{
+			name:           "range overflowing its size",
+			in:             []string{"project-{0..9223372036854775807}"},
+			expectedErrMsg: "0(project-{0..9223372036854775807}): expands to more than 10000 names",
+		},
+		{
+			name:           "ranges overflowing their product",
+			in:             []string{"project-{1..5000}-{1..5000}-{1..5000}"},
+			expectedErrMsg: "0(project-{1..5000}-{1..5000}-{1..5000}): expands to more than 10000 names",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			names, err := ExpandNames(tc.in)
+			var errMsg string
+			if err != nil {
+				errMsg = err.Error()
+			}
+			if diff := cmp.Diff(tc.expectedErrMsg, errMsg); diff != "" {
+				t.Errorf("actual error doesn't match expected: %s", diff)
+			}
+			if diff := cmp.Diff(tc.expected, names); diff != "" {
+				t.Errorf("actual names don't match expected: %s", diff)
+			}
+		})
+	}
+}
+
+func TestUnmarshalConfigExpandsNames(t *testing.T) {
+	config, err := UnmarshalConfig([]byte(`
+resources:
+- type: gce-project
+  state: free
+  names: ["gce-project-{01..03}"]
+`))
+	if err != nil {
+		t.Fatalf("failed to unmarshal config: %v", err)
+	}
+	expected := []string{"gce-project-01", "gce-project-02", "gce-project-03"}
+	if diff := cmp.Diff(expected, config.Resources[0].Names); diff != "" {
+		t.Errorf("actual names don't match expected: %s", diff)
+	}
+	if _, err := UnmarshalConfig([]byte(`resources: [{type: t, names: ["p-{3..1}"]}]`)); err == nil || err.Error() != ".0.names.0(p-{3..1}): range {3..1} must not be decreasing" {
+		t.Errorf("expected a decreasing range error, got %v", err)
+	}
+}
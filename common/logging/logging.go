@@ -0,0 +1,244 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logging
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/test-infra/prow/version"
+)
+
+const (
+	// FormatJSON renders log entries as JSON objects, one per line.
+	FormatJSON = "json"
+	// FormatText renders log entries using the logrus text formatter.
+	FormatText = "text"
+)
+
+// Options are flag options used to configure the format, the per package
+// verbosity and the sampling of the standard logrus logger.
+// It implements the k8s.io/test-infra/pkg/flagutil.OptionGroup interface.
+type Options struct {
+	format           string
+	componentLevels  string
+	sampleInitial    int
+	sampleThereafter int
+	sampleInterval   time.Duration
+
+	levels map[string]logrus.Level
+}
+
+// AddFlags adds logging flags to existing FlagSet.
+func (o *Options) AddFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.format, "log-format", FormatJSON, fmt.Sprintf("Log format is one of %s or %s.", FormatJSON, FormatText))
+	fs.StringVar(&o.componentLevels, "log-component-levels", "", "Comma-separated list of package=level pairs overriding the log level for the given packages, e.g. ranch=debug,handlers=warn.")
+	fs.IntVar(&o.sampleInitial, "log-sample-initial", 0, "If set, only the first N identical messages per sampling interval are logged. Errors are never sampled.")
+	fs.IntVar(&o.sampleThereafter, "log-sample-thereafter", 0, "When sampling, additionally log every Nth identical message past --log-sample-initial. Zero drops all of them.")
+	fs.DurationVar(&o.sampleInterval, "log-sample-interval", time.Minute, "Window over which identical messages are counted for sampling.")
+}
+
+// Validate validates logging options.
+func (o *Options) Validate(_ bool) error {
+	switch o.format {
+	case FormatJSON, FormatText:
+	default:
+		return fmt.Errorf("invalid --log-format %q, must be one of %s or %s", o.format, FormatJSON, FormatText)
+	}
+	levels, err := ParseComponentLevels(o.componentLevels)
+	if err != nil {
+		return fmt.Errorf("invalid --log-component-levels: %w", err)
+	}
+	o.levels = levels
+	if o.sampleInitial < 0 || o.sampleThereafter < 0 {
+		return fmt.Errorf("--log-sample-initial and --log-sample-thereafter must not be negative")
+	}
+	if o.sampleInitial > 0 && o.sampleInterval <= 0 {
+		return fmt.Errorf("--log-sample-interval must be positive when sampling is enabled")
+	}
+	return nil
+}
+
+// Configure sets up the standard logrus logger according to the options.
+// Options must have been validated beforehand. level is used for every
+// package that does not have an override in --log-component-levels.
+func (o *Options) Configure(level logrus.Level) {
+	var wrapped logrus.Formatter = &logrus.JSONFormatter{}
+	if o.format == FormatText {
+		wrapped = &logrus.TextFormatter{FullTimestamp: true}
+	}
+	formatter := &Formatter{
+		WrappedFormatter: wrapped,
+		DefaultFields:    logrus.Fields{"component": version.Name},
+		DefaultLevel:     level,
+		ComponentLevels:  o.levels,
+	}
+	if o.sampleInitial > 0 {
+		formatter.Sampler = NewSampler(o.sampleInitial, o.sampleThereafter, o.sampleInterval)
+	}
+	logrus.SetFormatter(formatter)
+
+	// The logger level acts as a first filter, so it has to be at least as
+	// verbose as the most verbose package override.
+	maxLevel := level
+	for _, l := range o.levels {
+		if l > maxLevel {
+			maxLevel = l
+		}
+	}
+	logrus.SetLevel(maxLevel)
+	// Caller information is what allows attributing entries to packages.
+	logrus.SetReportCaller(len(o.levels) > 0)
+}
+
+// ParseComponentLevels parses a comma-separated list of package=level pairs.
+func ParseComponentLevels(value string) (map[string]logrus.Level, error) {
+	levels := map[string]logrus.Level{}
+	if value == "" {
+		return levels, nil
+	}
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("%q is not in package=level format", pair)
+		}
+		level, err := logrus.ParseLevel(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		levels[parts[0]] = level
+	}
+	return levels, nil
+}
+
+// Formatter wraps another formatter, adding default fields, dropping entries
+// that are more verbose than the level configured for the package that
+// emitted them and dropping entries rejected by the Sampler.
+type Formatter struct {
+	WrappedFormatter logrus.Formatter
+	DefaultFields    logrus.Fields
+	DefaultLevel     logrus.Level
+	// ComponentLevels maps the last element of a package path to the level
+	// used for entries emitted from within that package.
+	ComponentLevels map[string]logrus.Level
+	// Sampler is optional.
+	Sampler *Sampler
+}
+
+// Format implements the logrus.Formatter interface. Returning an empty
+// slice results in nothing being written for the entry.
+func (f *Formatter) Format(entry *logrus.Entry) ([]byte, error) {
+	if entry.Level > f.levelFor(entry) {
+		return nil, nil
+	}
+	if f.Sampler != nil && !f.Sampler.Allow(entry) {
+		return nil, nil
+	}
+
+	data := make(logrus.Fields, len(entry.Data)+len(f.DefaultFields))
+	for k, v := range f.DefaultFields {
+		data[k] = v
+	}
+	for k, v := range entry.Data {
+		data[k] = v
+	}
+	withDefaults := *entry
+	withDefaults.Data = data
+	return f.WrappedFormatter.Format(&withDefaults)
+}
+
+func (f *Formatter) levelFor(entry *logrus.Entry) logrus.Level {
+	if len(f.ComponentLevels) == 0 || !entry.HasCaller() {
+		return f.DefaultLevel
+	}
+	if level, ok := f.ComponentLevels[packageName(entry.Caller.Function)]; ok {
+		return level
+	}
+	return f.DefaultLevel
+}
+
+// packageName returns the last element of the package path of a fully
+// qualified function name, e.g. "ranch" for
+// "sigs.k8s.io/boskos/ranch.(*Ranch).Acquire".
+func packageName(function string) string {
+	name := function
+	if idx := strings.LastIndex(name, "/"); idx >= 0 {
+		name = name[idx+1:]
+	}
+	if idx := strings.Index(name, "."); idx >= 0 {
+		name = name[:idx]
+	}
+	return name
+}
+
+// Sampler limits how often identical messages are logged: within every
+// interval, the first initial occurrences of a message at a given level are
+// allowed, and after that only every thereafter-th one.
+// Entries at error level or more severe are always allowed.
+type Sampler struct {
+	initial    int
+	thereafter int
+	interval   time.Duration
+
+	lock        sync.Mutex
+	counts      map[sampleKey]int
+	windowStart time.Time
+	// For testing
+	now func() time.Time
+}
+
+type sampleKey struct {
+	level   logrus.Level
+	message string
+}
+
+// NewSampler creates a new Sampler.
+func NewSampler(initial, thereafter int, interval time.Duration) *Sampler {
+	return &Sampler{
+		initial:    initial,
+		thereafter: thereafter,
+		interval:   interval,
+		counts:     map[sampleKey]int{},
+		now:        time.Now,
+	}
+}
+
+// Allow returns whether the entry should be logged.
+func (s *Sampler) Allow(entry *logrus.Entry) bool {
+	if entry.Level <= logrus.ErrorLevel {
+		return true
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := s.now()
+	if now.Sub(s.windowStart) >= s.interval {
+		s.windowStart = now
+		s.counts = map[sampleKey]int{}
+	}
+	key := sampleKey{level: entry.Level, message: entry.Message}
+	s.counts[key]++
+	count := s.counts[key]
+	if count <= s.initial {
+		return true
+	}
+	return s.thereafter > 0 && (count-s.initial)%s.thereafter == 0
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logging
+
+import (
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestParseComponentLevels(t *testing.T) {
+	testCases := []struct {
+		name      string
+		value     string
+		expected  map[string]logrus.Level
+		expectErr bool
+	}{
+		{
+			name:     "empty",
+			expected: map[string]logrus.Level{},
+		},
+		{
+			name:     "multiple packages",
+			value:    "ranch=debug,handlers=warn",
+			expected: map[string]logrus.Level{"ranch": logrus.DebugLevel, "handlers": logrus.WarnLevel},
+		},
+		{
+			name:      "missing level",
+			value:     "ranch",
+			expectErr: true,
+		},
+		{
+			name:      "invalid level",
+			value:     "ranch=loud",
+			expectErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			levels, err := ParseComponentLevels(tc.value)
+			if (err != nil) != tc.expectErr {
+				t.Fatalf("expected error: %t, got %v", tc.expectErr, err)
+			}
+			if !tc.expectErr && !reflect.DeepEqual(levels, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, levels)
+			}
+		})
+	}
+}
+
+func TestFormatterComponentLevels(t *testing.T) {
+	f := &Formatter{
+		WrappedFormatter: &logrus.TextFormatter{DisableTimestamp: true},
+		DefaultLevel:     logrus.InfoLevel,
+		ComponentLevels:  map[string]logrus.Level{"ranch": logrus.DebugLevel},
+	}
+	entry := func(function string, level logrus.Level) *logrus.Entry {
+		return &logrus.Entry{
+			Logger:  logrus.New(),
+			Level:   level,
+			Message: "msg",
+			Data:    logrus.Fields{},
+			Caller:  &runtime.Frame{Function: function},
+		}
+	}
+	for _, tc := range []struct {
+		function string
+		level    logrus.Level
+		logged   bool
+	}{
+		{function: "sigs.k8s.io/boskos/ranch.(*Ranch).Acquire", level: logrus.DebugLevel, logged: true},
+		{function: "sigs.k8s.io/boskos/handlers.handleAcquire.func1", level: logrus.DebugLevel, logged: false},
+		{function: "sigs.k8s.io/boskos/handlers.handleAcquire.func1", level: logrus.InfoLevel, logged: true},
+	} {
+		e := entry(tc.function, tc.level)
+		e.Logger.ReportCaller = true
+		out, err := f.Format(e)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if logged := len(out) > 0; logged != tc.logged {
+			t.Errorf("%s at %s: expected logged to be %t", tc.function, tc.level, tc.logged)
+		}
+	}
+}
+
+func TestSampler(t *testing.T) {
+	now := time.Now()
+	s := NewSampler(2, 3, time.Minute)
+	s.now = func() time.Time { return now }
+
+	entry := &logrus.Entry{Level: logrus.InfoLevel, Message: "resource not found"}
+	var allowed []int
+	for i := 1; i <= 10; i++ {
+		if s.Allow(entry) {
+			allowed = append(allowed, i)
+		}
+	}
+	if expected := []int{1, 2, 5, 8}; !reflect.DeepEqual(allowed, expected) {
+		t.Errorf("expected occurrences %v to be logged, got %v", expected, allowed)
+	}
+
+	if !s.Allow(&logrus.Entry{Level: logrus.ErrorLevel, Message: "resource not found"}) {
+		t.Error("errors must never be sampled")
+	}
+
+	now = now.Add(time.Minute)
+	if !s.Allow(entry) {
+		t.Error("expected counts to be reset for a new interval")
+	}
+}
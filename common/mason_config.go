@@ -51,10 +51,39 @@ type DynamicResourceLifeCycle struct {
 	MaxCount int `json:"max-count"`
 	// Lifespan of a resource, time after which the resource should be reset.
 	LifeSpan *time.Duration `json:"lifespan,omitempty"`
+	// Maximum age of a resource, after which it is deleted and replaced.
+	MaxLifetime *time.Duration `json:"max-lifetime,omitempty"`
 	// Config information about how to create the object
 	Config ConfigType `json:"config,omitempty"`
 	// Needs define the resource needs to create the object
 	Needs ResourceNeeds `json:"needs,omitempty"`
+	// Flavors, if set, split the resources into flavors kept at their own
+	// counts. MinCount and MaxCount are then the sums of those of the flavors.
+	Flavors []DynamicResourceFlavor `json:"flavors,omitempty"`
+}
+
+// DynamicResourceFlavor is a variant of a dynamic resource type, e.g. a
+// machine size, with its own counts. The flavor of a resource is recorded in
+// its user data under FlavorUserDataKey, which acquire requests may select.
+type DynamicResourceFlavor struct {
+	Name string `json:"name"`
+	// Minimum number of resources of this flavor to be use as a buffer.
+	MinCount int `json:"min-count,omitempty"`
+	// Maximum number of resources of this flavor expected.
+	MaxCount int `json:"max-count"`
+	// UserData are added to the user data of the new resources of this
+	// flavor, rendered like access templates from the AccessData of the
+	// resource, e.g. "{{.UserData.region}}-large".
+	UserData AccessTemplates `json:"user-data,omitempty"`
+}
+
+// FlavorCounts returns the sums of the min and max counts of flavors.
+func FlavorCounts(flavors []DynamicResourceFlavor) (minCount, maxCount int) {
+	for _, f := range flavors {
+		minCount += f.MinCount
+		maxCount += f.MaxCount
+	}
+	return minCount, maxCount
 }
 
 // DRLCByName helps sorting ResourcesConfig by name
@@ -66,18 +95,27 @@ func (ut DRLCByName) Less(i, j int) bool { return ut[i].Type < ut[j].Type }
 
 // NewDynamicResourceLifeCycleFromConfig parse the a ResourceEntry into a DynamicResourceLifeCycle
 func NewDynamicResourceLifeCycleFromConfig(e ResourceEntry) DynamicResourceLifeCycle {
-	var dur *time.Duration
+	var dur, maxLifetime *time.Duration
 	if e.LifeSpan != nil {
 		dur = e.LifeSpan.Duration
 	}
+	if e.MaxLifetime != nil {
+		maxLifetime = e.MaxLifetime.Duration
+	}
+	minCount, maxCount := e.MinCount, e.MaxCount
+	if len(e.Flavors) > 0 {
+		minCount, maxCount = FlavorCounts(e.Flavors)
+	}
 	return DynamicResourceLifeCycle{
 		Type:         e.Type,
-		MaxCount:     e.MaxCount,
-		MinCount:     e.MinCount,
+		MaxCount:     maxCount,
+		MinCount:     minCount,
 		LifeSpan:     dur,
+		MaxLifetime:  maxLifetime,
 		InitialState: e.State,
 		Config:       e.Config,
 		Needs:        e.Needs,
+		Flavors:      e.Flavors,
 	}
 }
 
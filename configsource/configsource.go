@@ -0,0 +1,206 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package configsource reads the boskos config from an object storage bucket,
+// so installations without a ConfigMap or a shared filesystem can manage it
+// centrally.
+package configsource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	gcs "cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/sirupsen/logrus"
+
+	s3path "sigs.k8s.io/boskos/aws-janitor/s3"
+	"sigs.k8s.io/boskos/common"
+)
+
+// errNotModified is returned by a fetcher when the object still has the ETag
+// of the last fetch.
+var errNotModified = errors.New("not modified")
+
+// fetcher fetches an object of a bucket, unless its ETag is etag.
+type fetcher interface {
+	fetch(ctx context.Context, etag string) (data []byte, newETag string, err error)
+}
+
+// IsURL tells whether path is the URL of an object in an S3 or GCS bucket
+// rather than a local file.
+func IsURL(path string) bool {
+	return strings.HasPrefix(path, "s3://") || strings.HasPrefix(path, "gs://")
+}
+
+// Source is a config stored in an S3 or GCS bucket. It is safe for concurrent
+// use.
+type Source struct {
+	url     string
+	fetcher fetcher
+
+	lock   sync.Mutex
+	etag   string
+	config *common.BoskosConfig
+}
+
+// NewSource creates a Source for an s3:// or gs:// URL, with the default
+// credentials of the cloud.
+func NewSource(ctx context.Context, rawURL string) (*Source, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	key := strings.TrimPrefix(u.Path, "/")
+	if u.Host == "" || key == "" {
+		return nil, fmt.Errorf("invalid config URL %s: must name a bucket and an object", rawURL)
+	}
+	var f fetcher
+	switch u.Scheme {
+	case "s3":
+		sess, err := session.NewSessionWithOptions(session.Options{SharedConfigState: session.SharedConfigEnable})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create AWS session: %w", err)
+		}
+		path, err := s3path.GetPath(sess, rawURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to locate bucket of %s: %w", rawURL, err)
+		}
+		f = &s3Fetcher{client: s3.New(sess, aws.NewConfig().WithRegion(path.Region)), bucket: path.Bucket, key: key}
+	case "gs":
+		client, err := gcs.NewClient(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create GCS client: %w", err)
+		}
+		f = &gcsFetcher{object: client.Bucket(u.Host).Object(key)}
+	default:
+		return nil, fmt.Errorf("invalid config URL %s: scheme must be s3 or gs", rawURL)
+	}
+	return &Source{url: rawURL, fetcher: f}, nil
+}
+
+// Fetch returns the config if it changed since the last fetch, or nil if its
+// ETag is the same.
+func (s *Source) Fetch(ctx context.Context) (*common.BoskosConfig, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	data, etag, err := s.fetcher.fetch(ctx, s.etag)
+	if err == errNotModified {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch config from %s: %w", s.url, err)
+	}
+	config, err := common.UnmarshalConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config from %s: %w", s.url, err)
+	}
+	s.etag, s.config = etag, config
+	return config, nil
+}
+
+// Config returns the config of the last successful fetch, or nil.
+func (s *Source) Config() *common.BoskosConfig {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.config
+}
+
+// Sync fetches the config and hands it to sync if it changed.
+func (s *Source) Sync(ctx context.Context, sync func(*common.BoskosConfig) error) error {
+	config, err := s.Fetch(ctx)
+	if err != nil || config == nil {
+		return err
+	}
+	logrus.Infof("Config at %s changed, updating config.", s.url)
+	return sync(config)
+}
+
+// Poll syncs the config every period until ctx is done.
+func (s *Source) Poll(ctx context.Context, period time.Duration, sync func(*common.BoskosConfig) error) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Sync(ctx, sync); err != nil {
+				logrus.WithError(err).Error("Config sync from object storage failed")
+			}
+		}
+	}
+}
+
+type s3Fetcher struct {
+	client      *s3.S3
+	bucket, key string
+}
+
+func (f *s3Fetcher) fetch(ctx context.Context, etag string) ([]byte, string, error) {
+	input := &s3.GetObjectInput{Bucket: aws.String(f.bucket), Key: aws.String(f.key)}
+	if etag != "" {
+		input.IfNoneMatch = aws.String(etag)
+	}
+	out, err := f.client.GetObjectWithContext(ctx, input)
+	if err != nil {
+		if reqErr, ok := err.(awserr.RequestFailure); ok && reqErr.StatusCode() == http.StatusNotModified {
+			return nil, "", errNotModified
+		}
+		return nil, "", err
+	}
+	defer out.Body.Close()
+	data, err := ioutil.ReadAll(out.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, aws.StringValue(out.ETag), nil
+}
+
+type gcsFetcher struct {
+	object *gcs.ObjectHandle
+}
+
+func (f *gcsFetcher) fetch(ctx context.Context, etag string) ([]byte, string, error) {
+	attrs, err := f.object.Attrs(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	if attrs.Etag == etag {
+		return nil, "", errNotModified
+	}
+	// Read the generation the ETag belongs to, in case it is replaced meanwhile.
+	reader, err := f.object.Generation(attrs.Generation).NewReader(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	defer reader.Close()
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, attrs.Etag, nil
+}
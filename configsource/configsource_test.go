@@ -0,0 +1,110 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package configsource
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+type fakeFetcher struct {
+	data, etag string
+	err        error
+	fetches    int
+}
+
+func (f *fakeFetcher) fetch(_ context.Context, etag string) ([]byte, string, error) {
+	f.fetches++
+	if f.err != nil {
+		return nil, "", f.err
+	}
+	if etag == f.etag {
+		return nil, "", errNotModified
+	}
+	return []byte(f.data), f.etag, nil
+}
+
+func TestIsURL(t *testing.T) {
+	testCases := []struct {
+		path     string
+		expected bool
+	}{
+		{path: "s3://bucket/config.yaml", expected: true},
+		{path: "gs://bucket/config.yaml", expected: true},
+		{path: "config.yaml", expected: false},
+		{path: "/etc/config/s3://config.yaml", expected: false},
+	}
+	for _, tc := range testCases {
+		if got := IsURL(tc.path); got != tc.expected {
+			t.Errorf("%s: expected %t, got %t", tc.path, tc.expected, got)
+		}
+	}
+}
+
+func TestNewSourceInvalidURL(t *testing.T) {
+	for _, rawURL := range []string{"ftp://bucket/config.yaml", "gs://bucket", "s3:///config.yaml"} {
+		if _, err := NewSource(context.Background(), rawURL); err == nil {
+			t.Errorf("%s: expected an error", rawURL)
+		}
+	}
+}
+
+func TestSync(t *testing.T) {
+	f := &fakeFetcher{data: "resources:\n- type: t\n  state: free\n  names: [res]\n", etag: "v1"}
+	s := &Source{url: "gs://bucket/config.yaml", fetcher: f}
+	var synced []*common.BoskosConfig
+	sync := func(config *common.BoskosConfig) error {
+		synced = append(synced, config)
+		return nil
+	}
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if err := s.Sync(ctx, sync); err != nil {
+			t.Fatalf("failed to sync: %v", err)
+		}
+	}
+	if len(synced) != 1 || synced[0].Resources[0].Names[0] != "res" {
+		t.Fatalf("expected the config to be synced once, got %+v", synced)
+	}
+
+	f.data, f.etag = "resources: [", "v2"
+	if err := s.Sync(ctx, sync); err == nil {
+		t.Error("expected an invalid config to fail")
+	}
+	f.err = errors.New("unavailable")
+	if err := s.Sync(ctx, sync); err == nil {
+		t.Error("expected a failed fetch to fail")
+	}
+	if len(synced) != 1 || s.Config() != synced[0] {
+		t.Errorf("expected the last valid config to be kept, got %+v", s.Config())
+	}
+
+	f.data, f.err = "resources: []\n", nil
+	if err := s.Sync(ctx, sync); err != nil {
+		t.Fatalf("failed to sync: %v", err)
+	}
+	if len(synced) != 2 || len(synced[1].Resources) != 0 {
+		t.Errorf("expected the fixed config to be synced, got %+v", synced)
+	}
+	if f.fetches != 5 {
+		t.Errorf("expected a fetch per sync, got %d", f.fetches)
+	}
+}
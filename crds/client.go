@@ -30,6 +30,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
 	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/cache/informertest"
@@ -46,6 +47,12 @@ type KubernetesClientOptions struct {
 	inMemory           bool
 	kubeConfig         string
 	projectedTokenFile string
+
+	// LeaderElectionID, if set, makes the Manager elect a leader among the
+	// managers sharing the ID, with a Lease of that name in
+	// LeaderElectionNamespace. Only the leader runs the controllers.
+	LeaderElectionID        string
+	LeaderElectionNamespace string
 }
 
 // AddFlags adds kube client flags to existing FlagSet.
@@ -107,9 +114,15 @@ func (o *KubernetesClientOptions) Manager(namespace string, startCacheFor ...ctr
 	cfg.Burst = 200
 
 	mgr, err := manager.New(cfg, manager.Options{
-		LeaderElection:     false,
-		Namespace:          namespace,
-		MetricsBindAddress: "0",
+		LeaderElection:          o.LeaderElectionID != "",
+		LeaderElectionID:        o.LeaderElectionID,
+		LeaderElectionNamespace: o.LeaderElectionNamespace,
+		// Leases are renewed with the least load on the apiserver, and
+		// released on shutdown so another replica takes over right away.
+		LeaderElectionResourceLock:    resourcelock.LeasesResourceLock,
+		LeaderElectionReleaseOnCancel: true,
+		Namespace:                     namespace,
+		MetricsBindAddress:            "0",
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to construct manager: %v", err)
@@ -170,6 +183,46 @@ func (o *KubernetesClientOptions) Cfg() (*rest.Config, error) {
 	return cfg, nil
 }
 
+// ReadReplicaCache returns an informer cache of the cluster of kubeConfig,
+// serving reads when the primary cluster is unavailable. Namespace can be
+// empty in which case the cache will use all namespaces.
+// It blocks until the cache was synced for all types passed in startCacheFor.
+func ReadReplicaCache(kubeConfig, namespace string, startCacheFor ...ctrlruntimeclient.Object) (cache.Cache, error) {
+	cfg, err := clientcmd.BuildConfigFromFlags("", kubeConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to construct rest config: %v", err)
+	}
+	replica, err := cache.New(cfg, cache.Options{Namespace: namespace})
+	if err != nil {
+		return nil, fmt.Errorf("failed to construct cache: %v", err)
+	}
+
+	ctx := interrupts.Context()
+	for _, t := range startCacheFor {
+		if _, err := replica.GetInformer(ctx, t); err != nil {
+			return nil, fmt.Errorf("failed to get informer for type %T: %v", t, err)
+		}
+	}
+
+	interrupts.Run(func(ctx context.Context) {
+		// Unlike the manager, a failing replica must not take boskos down.
+		if err := replica.Start(ctx); err != nil {
+			logrus.WithError(err).WithField("kubeconfig", kubeConfig).Error("Read replica cache failed.")
+		}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	startSyncTime := time.Now()
+	if synced := replica.WaitForCacheSync(ctx); !synced {
+		return nil, errors.New("timeout waiting for cache sync")
+	}
+	logrus.WithFields(logrus.Fields{"kubeconfig": kubeConfig, "sync-duration": time.Since(startSyncTime).String()}).Info("Read replica cache synced")
+
+	return replica, nil
+}
+
 // +k8s:deepcopy-gen=false
 
 // Type defines a Custom Resource Definition (CRD) Type.
@@ -54,8 +54,12 @@ type DRLCSpec struct {
 	MaxCount     int                  `json:"max-count"`
 	MinCount     int                  `json:"min-count"`
 	LifeSpan     *time.Duration       `json:"lifespan,omitempty"`
+	MaxLifetime  *time.Duration       `json:"max-lifetime,omitempty"`
 	Config       common.ConfigType    `json:"config"`
 	Needs        common.ResourceNeeds `json:"needs"`
+	// Flavors, if set, are kept at their own counts, which MinCount and
+	// MaxCount are the sums of.
+	Flavors []common.DynamicResourceFlavor `json:"flavors,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -79,8 +83,10 @@ func (in *DRLCObject) ToDynamicResourceLifeCycle() common.DynamicResourceLifeCyc
 		MinCount:     in.Spec.MinCount,
 		MaxCount:     in.Spec.MaxCount,
 		LifeSpan:     in.Spec.LifeSpan,
+		MaxLifetime:  in.Spec.MaxLifetime,
 		Config:       in.Spec.Config,
 		Needs:        in.Spec.Needs,
+		Flavors:      in.Spec.Flavors,
 	}
 }
 
@@ -95,8 +101,10 @@ func FromDynamicResourceLifecycle(r common.DynamicResourceLifeCycle) *DRLCObject
 			MinCount:     r.MinCount,
 			MaxCount:     r.MaxCount,
 			LifeSpan:     r.LifeSpan,
+			MaxLifetime:  r.MaxLifetime,
 			Config:       r.Config,
 			Needs:        r.Needs,
+			Flavors:      r.Flavors,
 		},
 	}
 }
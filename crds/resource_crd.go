@@ -58,6 +58,8 @@ type ResourceObjectList struct {
 // ResourceSpec holds information that are not likely to change
 type ResourceSpec struct {
 	Type string `json:"type"`
+	// Tenant is the tenant owning the pool of the resource, if any.
+	Tenant string `json:"tenant,omitempty"`
 }
 
 // ResourceStatus holds information that are likely to change
@@ -67,20 +69,139 @@ type ResourceStatus struct {
 	LastUpdate     v1.Time           `json:"lastUpdate,omitempty"`
 	UserData       map[string]string `json:"userData,omitempty"`
 	ExpirationDate *v1.Time          `json:"expirationDate,omitempty"`
+	// Hold is set while the resource is reserved for its owner, pending confirmation.
+	Hold *HoldStatus `json:"hold,omitempty"`
+	// Bookings is the calendar of time slices of the resource, sorted by start.
+	Bookings []Booking `json:"bookings,omitempty"`
+	// CredentialsExposed is set once the credentials of the resource were
+	// handed out, until they are rotated.
+	CredentialsExposed bool `json:"credentialsExposed,omitempty"`
+	// UserDataVersion is the version of the last user data migration applied
+	// to the resource.
+	UserDataVersion int `json:"userDataVersion,omitempty"`
+	// Cleanup holds the statistics of the cleanups reported by janitors.
+	Cleanup *CleanupStatus `json:"cleanup,omitempty"`
+	// Notes are the notes of operators about the resource, oldest first.
+	Notes []Note `json:"notes,omitempty"`
+	// Progress is the last progress reported by the owner with its heartbeats.
+	Progress *ProgressStatus `json:"progress,omitempty"`
+	// Lease is set while the owner holds the resource for a limited time.
+	Lease *LeaseStatus `json:"lease,omitempty"`
+}
+
+// LeaseStatus describes a lease which expires whether or not its owner sends
+// heartbeats.
+type LeaseStatus struct {
+	Expiration v1.Time `json:"expiration"`
+}
+
+// ProgressStatus is the persisted representation of common.Progress.
+// It only applies to the lease of Owner.
+type ProgressStatus struct {
+	Owner    string  `json:"owner"`
+	Phase    string  `json:"phase"`
+	Percent  int     `json:"percent,omitempty"`
+	Message  string  `json:"message,omitempty"`
+	Reported v1.Time `json:"reported"`
+}
+
+// progress returns the common.Progress representation of the progress of the
+// lease of owner, or nil if owner did not report any.
+func (in *ProgressStatus) progress(owner string) *common.Progress {
+	if in == nil || owner == "" || in.Owner != owner {
+		return nil
+	}
+	return &common.Progress{Phase: in.Phase, Percent: in.Percent, Message: in.Message, Reported: in.Reported.Time}
+}
+
+// Note is a note of an operator about a resource.
+type Note struct {
+	Author string  `json:"author"`
+	Text   string  `json:"text"`
+	Time   v1.Time `json:"time"`
+}
+
+// ToNotes returns the common.Note representation of notes.
+func ToNotes(notes []Note) []common.Note {
+	var converted []common.Note
+	for _, note := range notes {
+		converted = append(converted, common.Note{Author: note.Author, Text: note.Text, Time: note.Time.Time})
+	}
+	return converted
+}
+
+// CleanupStatus is the persisted representation of common.CleanupStats.
+type CleanupStatus struct {
+	Cleanups       int     `json:"cleanups"`
+	Failures       int     `json:"failures,omitempty"`
+	LastSeconds    float64 `json:"lastSeconds,omitempty"`
+	AverageSeconds float64 `json:"averageSeconds,omitempty"`
+	MaxSeconds     float64 `json:"maxSeconds,omitempty"`
+	LastCleanup    v1.Time `json:"lastCleanup"`
+}
+
+// ToCleanupStats returns the common.CleanupStats representation of a
+// CleanupStatus, or nil if there is none.
+func (in *CleanupStatus) ToCleanupStats() *common.CleanupStats {
+	if in == nil {
+		return nil
+	}
+	return &common.CleanupStats{
+		Cleanups:       in.Cleanups,
+		Failures:       in.Failures,
+		LastSeconds:    in.LastSeconds,
+		AverageSeconds: in.AverageSeconds,
+		MaxSeconds:     in.MaxSeconds,
+		LastCleanup:    in.LastCleanup.Time,
+	}
+}
+
+// Booking is a time slice of a resource reserved for an owner.
+type Booking struct {
+	Owner string  `json:"owner"`
+	Start v1.Time `json:"start"`
+	End   v1.Time `json:"end"`
+}
+
+// HoldStatus describes a reservation that lapses unless confirmed in time.
+type HoldStatus struct {
+	Expiration v1.Time `json:"expiration"`
+	// OriginalState is the state the resource returns to if the hold lapses.
+	OriginalState string `json:"originalState"`
+	// Dest is the state the resource moves to once the hold is confirmed.
+	Dest string `json:"dest"`
 }
 
 // ToResource returns the common.Resource representation for
 // a ResourceObject
 func (in *ResourceObject) ToResource() common.Resource {
 	return common.Resource{
-		Name:           in.Name,
-		Type:           in.Spec.Type,
-		Owner:          in.Status.Owner,
-		State:          in.Status.State,
-		LastUpdate:     in.Status.LastUpdate.Time,
-		UserData:       common.UserDataFromMap(in.Status.UserData),
-		ExpirationDate: metaTimeToTime(in.Status.ExpirationDate),
+		Name:            in.Name,
+		Type:            in.Spec.Type,
+		Owner:           in.Status.Owner,
+		State:           in.Status.State,
+		LastUpdate:      in.Status.LastUpdate.Time,
+		UserData:        common.UserDataFromMap(in.Status.UserData),
+		ExpirationDate:  metaTimeToTime(in.Status.ExpirationDate),
+		HoldExpiration:  holdExpiration(in.Status.Hold),
+		Progress:        in.Status.Progress.progress(in.Status.Owner),
+		LeaseExpiration: leaseExpiration(in.Status.Lease),
+		Tenant:          in.Spec.Tenant,
+	}
+}
+
+func holdExpiration(in *HoldStatus) *time.Time {
+	if in == nil {
+		return nil
+	}
+	return &in.Expiration.Time
+}
+
+func leaseExpiration(in *LeaseStatus) *time.Time {
+	if in == nil {
+		return nil
 	}
+	return &in.Expiration.Time
 }
 
 func metaTimeToTime(in *v1.Time) *time.Time {
@@ -100,7 +221,8 @@ func FromResource(r common.Resource) *ResourceObject {
 			Name: r.Name,
 		},
 		Spec: ResourceSpec{
-			Type: r.Type,
+			Type:   r.Type,
+			Tenant: r.Tenant,
 		},
 		Status: ResourceStatus{
 			Owner:          r.Owner,
@@ -26,6 +26,39 @@ import (
 	timex "time"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Booking) DeepCopyInto(out *Booking) {
+	*out = *in
+	in.Start.DeepCopyInto(&out.Start)
+	in.End.DeepCopyInto(&out.End)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Booking.
+func (in *Booking) DeepCopy() *Booking {
+	if in == nil {
+		return nil
+	}
+	out := new(Booking)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CleanupStatus) DeepCopyInto(out *CleanupStatus) {
+	*out = *in
+	in.LastCleanup.DeepCopyInto(&out.LastCleanup)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CleanupStatus.
+func (in *CleanupStatus) DeepCopy() *CleanupStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CleanupStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DRLCObject) DeepCopyInto(out *DRLCObject) {
 	*out = *in
@@ -92,6 +125,11 @@ func (in *DRLCSpec) DeepCopyInto(out *DRLCSpec) {
 		*out = new(timex.Duration)
 		**out = **in
 	}
+	if in.MaxLifetime != nil {
+		in, out := &in.MaxLifetime, &out.MaxLifetime
+		*out = new(timex.Duration)
+		**out = **in
+	}
 	out.Config = in.Config
 	if in.Needs != nil {
 		in, out := &in.Needs, &out.Needs
@@ -100,6 +138,20 @@ func (in *DRLCSpec) DeepCopyInto(out *DRLCSpec) {
 			(*out)[key] = val
 		}
 	}
+	if in.Flavors != nil {
+		in, out := &in.Flavors, &out.Flavors
+		*out = make([]common.DynamicResourceFlavor, len(*in))
+		copy(*out, *in)
+		for i := range *in {
+			if (*in)[i].UserData != nil {
+				in, out := &(*in)[i].UserData, &(*out)[i].UserData
+				*out = make(common.AccessTemplates, len(*in))
+				for key, val := range *in {
+					(*out)[key] = val
+				}
+			}
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DRLCSpec.
@@ -112,6 +164,22 @@ func (in *DRLCSpec) DeepCopy() *DRLCSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HoldStatus) DeepCopyInto(out *HoldStatus) {
+	*out = *in
+	in.Expiration.DeepCopyInto(&out.Expiration)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HoldStatus.
+func (in *HoldStatus) DeepCopy() *HoldStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(HoldStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *KubernetesClientOptions) DeepCopyInto(out *KubernetesClientOptions) {
 	*out = *in
@@ -127,6 +195,54 @@ func (in *KubernetesClientOptions) DeepCopy() *KubernetesClientOptions {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LeaseStatus) DeepCopyInto(out *LeaseStatus) {
+	*out = *in
+	in.Expiration.DeepCopyInto(&out.Expiration)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LeaseStatus.
+func (in *LeaseStatus) DeepCopy() *LeaseStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(LeaseStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Note) DeepCopyInto(out *Note) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Note.
+func (in *Note) DeepCopy() *Note {
+	if in == nil {
+		return nil
+	}
+	out := new(Note)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProgressStatus) DeepCopyInto(out *ProgressStatus) {
+	*out = *in
+	in.Reported.DeepCopyInto(&out.Reported)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProgressStatus.
+func (in *ProgressStatus) DeepCopy() *ProgressStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ProgressStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ResourceObject) DeepCopyInto(out *ResourceObject) {
 	*out = *in
@@ -216,6 +332,40 @@ func (in *ResourceStatus) DeepCopyInto(out *ResourceStatus) {
 		in, out := &in.ExpirationDate, &out.ExpirationDate
 		*out = (*in).DeepCopy()
 	}
+	if in.Hold != nil {
+		in, out := &in.Hold, &out.Hold
+		*out = new(HoldStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Bookings != nil {
+		in, out := &in.Bookings, &out.Bookings
+		*out = make([]Booking, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Cleanup != nil {
+		in, out := &in.Cleanup, &out.Cleanup
+		*out = new(CleanupStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Notes != nil {
+		in, out := &in.Notes, &out.Notes
+		*out = make([]Note, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Progress != nil {
+		in, out := &in.Progress, &out.Progress
+		*out = new(ProgressStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Lease != nil {
+		in, out := &in.Lease, &out.Lease
+		*out = new(LeaseStatus)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResourceStatus.
@@ -81,6 +81,7 @@ GENERATED_GO_MARKERS = [
     "// Code generated by informer-gen. DO NOT EDIT.",
     "// Code generated by lister-gen. DO NOT EDIT.",
     "// Code generated by protoc-gen-go. DO NOT EDIT.",
+    "// Code generated by protoc-gen-go-grpc. DO NOT EDIT.",
 ]
 
 # given the file contents, return true if the file appears to be generated
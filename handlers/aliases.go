@@ -0,0 +1,73 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"sigs.k8s.io/boskos/ranch"
+)
+
+var typeAliasUsage = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "boskos_type_alias_usage_total",
+	Help: "Number of requests using a former name of a resource type, by alias, type and whether the alias is rejected.",
+}, []string{"alias", "type", "rejected"})
+
+func init() {
+	prometheus.MustRegister(typeAliasUsage)
+}
+
+// resolveType replaces rtype with the resource type it refers to. Requests
+// using an alias of a renamed type are counted and flagged as deprecated, or
+// fail with a TypeRenamed error once the alias is rejected.
+func resolveType(res http.ResponseWriter, req *http.Request, r *ranch.Ranch, owner string, rtype *string) error {
+	resolved, alias, err := r.ResolveType(*rtype)
+	if !alias {
+		return nil
+	}
+	typeAliasUsage.WithLabelValues(*rtype, resolved, strconv.FormatBool(err != nil)).Inc()
+	if err != nil {
+		return err
+	}
+	warnDeprecated(res, req, r, owner, deprecation{
+		id:      "type-alias",
+		message: fmt.Sprintf("resource type %s was renamed to %s, use the new name before the old one is rejected", *rtype, resolved),
+	})
+	*rtype = resolved
+	return nil
+}
+
+// resolveStates replaces the former names of the states of rtype among states
+// with the states they refer to. Requests using them are flagged as
+// deprecated.
+func resolveStates(res http.ResponseWriter, req *http.Request, r *ranch.Ranch, owner, rtype string, states ...*string) {
+	for _, state := range states {
+		resolved, alias := r.ResolveState(rtype, *state)
+		if !alias {
+			continue
+		}
+		warnDeprecated(res, req, r, owner, deprecation{
+			id:      "state-alias",
+			message: fmt.Sprintf("state %s of resource type %s was renamed to %s, use the new name before the old one is removed", *state, rtype, resolved),
+		})
+		*state = resolved
+	}
+}
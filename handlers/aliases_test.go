@@ -0,0 +1,74 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+func TestAcquireWithTypeAlias(t *testing.T) {
+	testCases := []struct {
+		name          string
+		rtype         string
+		expectCode    int
+		expectWarning bool
+	}{
+		{
+			name:       "new name",
+			rtype:      "new-type",
+			expectCode: http.StatusOK,
+		},
+		{
+			name:          "alias",
+			rtype:         "old-type",
+			expectCode:    http.StatusOK,
+			expectWarning: true,
+		},
+		{
+			name:       "rejected alias",
+			rtype:      "older-type",
+			expectCode: http.StatusGone,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := MakeTestRanch(nil)
+			if err := r.ApplyConfig(&common.BoskosConfig{Resources: []common.ResourceEntry{{
+				Type:    "new-type",
+				State:   common.Free,
+				Names:   []string{"res"},
+				Aliases: []common.TypeAlias{{Name: "old-type"}, {Name: "older-type", Rejected: true}},
+			}}}); err != nil {
+				t.Fatalf("failed to apply config: %v", err)
+			}
+			req := httptest.NewRequest(http.MethodPost, "/acquire?type="+tc.rtype+"&state=free&dest=busy&owner=merlin", nil)
+			rr := httptest.NewRecorder()
+			handleAcquire(r).ServeHTTP(rr, req)
+			if rr.Code != tc.expectCode {
+				t.Fatalf("expected code %d, got %d: %s", tc.expectCode, rr.Code, rr.Body.String())
+			}
+			deprecation := rr.Header().Get(common.DeprecationHeader)
+			if warned := deprecation == "type-alias"; warned != tc.expectWarning {
+				t.Errorf("expected warning %t, got deprecation header %q", tc.expectWarning, deprecation)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/ranch"
+)
+
+//  handleApprovals: Handler for /approvals
+//  Method: GET
+// 	URLParams:
+//		Optional: type=[string] : only list the approvals of this type
+//  Lists the acquire requests waiting for approval or recently decided. The
+//  owners the caller cannot see are redacted along with their request IDs.
+func handleApprovals(r *ranch.Ranch) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		logrus.WithField("handler", "handleApprovals").Infof("From %v", req.RemoteAddr)
+
+		if req.Method != http.MethodGet {
+			logrus.Warningf("[BadRequest]method %v, expect GET", req.Method)
+			http.Error(res, "/approvals only accepts GET", http.StatusMethodNotAllowed)
+			return
+		}
+
+		rtype := req.URL.Query().Get("type")
+		if err := validateIdentifiers(param{"type", rtype}); err != nil {
+			returnAndLogError(res, err, "Bad request")
+			return
+		}
+		if err := resolveType(res, req, r, "", &rtype); err != nil {
+			returnAndLogError(res, err, "Approvals failed")
+			return
+		}
+
+		js, err := json.Marshal(filterApprovals(callerIdentity(req), r.Approvals(rtype)))
+		if err != nil {
+			logrus.WithError(err).Error("Fail to marshal approvals")
+			http.Error(res, err.Error(), errorToStatus(err))
+			return
+		}
+		res.Header().Set("Content-Type", "application/json")
+		res.Write(js)
+	}
+}
+
+//  handleApprove: Handler for /admin/approve and /admin/deny
+//  Method: POST
+// 	URLParams:
+//		Required: id=[string] : id of the approval to decide
+//		Optional: reason=[string] : why the request was approved or denied
+//  The caller must be an authenticated admin. Returns the decided request.
+func handleApprove(approve bool) func(r *ranch.Ranch) http.HandlerFunc {
+	return func(r *ranch.Ranch) http.HandlerFunc {
+		return func(res http.ResponseWriter, req *http.Request) {
+			logrus.WithFields(logrus.Fields{"handler": "handleApprove", "approve": approve}).Infof("From %v", req.RemoteAddr)
+
+			if req.Method != http.MethodPost {
+				msg := fmt.Sprintf("Method %v, %s only accepts POST.", req.Method, req.URL.Path)
+				logrus.Warning(msg)
+				http.Error(res, msg, http.StatusMethodNotAllowed)
+				return
+			}
+			if requireAdmin(res, req) {
+				return
+			}
+
+			id := req.URL.Query().Get("id")
+			reason := req.URL.Query().Get("reason")
+			if id == "" {
+				returnAndLogError(res, badRequestError("id must be set in the request"), "Bad request")
+				return
+			}
+			if err := validateIdentifiers(param{"id", id}); err != nil {
+				returnAndLogError(res, err, "Bad request")
+				return
+			}
+			if err := validateFreeform(param{"reason", reason}); err != nil {
+				returnAndLogError(res, err, "Bad request")
+				return
+			}
+
+			request, err := r.DecideApproval(id, approve, callerIdentity(req).Name, reason)
+			if err != nil {
+				returnAndLogError(res, err, fmt.Sprintf("Approval failed: %v", id))
+				return
+			}
+			js, err := json.Marshal(request)
+			if err != nil {
+				logrus.WithError(err).Errorf("Fail to marshal approval %s", id)
+				http.Error(res, err.Error(), errorToStatus(err))
+				return
+			}
+			res.Header().Set("Content-Type", "application/json")
+			res.Write(js)
+		}
+	}
+}
+
+// filterApprovals redacts the requests of the owners the caller cannot see.
+func filterApprovals(identity *Identity, approvals []common.ApprovalRequest) []common.ApprovalRequest {
+	if identity == nil || identity.Admin {
+		return approvals
+	}
+	filtered := make([]common.ApprovalRequest, 0, len(approvals))
+	for _, approval := range approvals {
+		if !identity.CanSeeOwner(approval.Owner) {
+			approval.Owner = ""
+			approval.RequestID = ""
+		}
+		filtered = append(filtered, approval)
+	}
+	return filtered
+}
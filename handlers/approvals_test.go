@@ -0,0 +1,85 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+func TestApprovals(t *testing.T) {
+	r := MakeTestRanch(nil)
+	if err := r.ApplyConfig(&common.BoskosConfig{Resources: []common.ResourceEntry{
+		{Type: "rack", State: common.Free, Names: []string{"rack-1"}, Approval: &common.AcquisitionApproval{}},
+	}}); err != nil {
+		t.Fatalf("failed to apply config: %v", err)
+	}
+	handler := makeTestAuthenticator(t).Wrap(NewBoskosHandler(r))
+	call := func(method, path, username string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if username != "" {
+			req.SetBasicAuth(username, username+"-password")
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	acquire := "/acquire?type=rack&state=free&dest=busy&owner=team-b-ci&request_id=request-1"
+	if rr := call(http.MethodPost, acquire, "team-b-ci"); rr.Code != http.StatusAccepted {
+		t.Fatalf("expected the acquisition to wait for approval, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var approvals []common.ApprovalRequest
+	rr := call(http.MethodGet, "/approvals?type=rack", "team-a-ci")
+	if err := json.Unmarshal(rr.Body.Bytes(), &approvals); err != nil {
+		t.Fatalf("failed to unmarshal approvals: %v", err)
+	}
+	if len(approvals) != 1 || approvals[0].Owner != "" || approvals[0].Status != common.ApprovalPending {
+		t.Fatalf("expected the approval of another tenant to be redacted, got %+v", approvals)
+	}
+	id := approvals[0].ID
+
+	if rr := call(http.MethodPost, "/admin/approve?id="+id, "team-b-ci"); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected non-admins not to approve, got %d", rr.Code)
+	}
+	if rr := call(http.MethodPost, "/admin/deny?id=unknown", "admin"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected unknown approvals not to be found, got %d", rr.Code)
+	}
+	rr = call(http.MethodPost, "/admin/approve?id="+id+"&reason=release+testing", "admin")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected the approval to be granted, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var approval common.ApprovalRequest
+	if err := json.Unmarshal(rr.Body.Bytes(), &approval); err != nil {
+		t.Fatalf("failed to unmarshal approval: %v", err)
+	}
+	if approval.Status != common.ApprovalApproved || approval.DecidedBy != "admin" || approval.Reason != "release testing" {
+		t.Errorf("unexpected approval %+v", approval)
+	}
+	if rr := call(http.MethodPost, "/admin/deny?id="+id, "admin"); rr.Code != http.StatusConflict {
+		t.Errorf("expected decided approvals not to be decided again, got %d", rr.Code)
+	}
+
+	if rr := call(http.MethodPost, acquire, "team-b-ci"); rr.Code != http.StatusOK {
+		t.Errorf("expected the approved acquisition to succeed, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
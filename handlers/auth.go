@@ -0,0 +1,339 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/yaml"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+// AuthConfig declares the identities allowed to call boskos. Callers
+// authenticate with basic auth, as done by the boskos client when configured
+// with a username and a password file.
+type AuthConfig struct {
+	Identities []IdentityConfig `json:"identities"`
+	// Tenants maps tenant names to the owners belonging to them.
+	Tenants map[string]TenantConfig `json:"tenants,omitempty"`
+}
+
+// IdentityConfig is a caller of boskos.
+type IdentityConfig struct {
+	// Name is the basic auth username of the caller.
+	Name string `json:"name"`
+	// PasswordFile is the path to a file holding the password of the caller.
+	PasswordFile string `json:"password-file"`
+	// Tenant is the tenant the caller belongs to, if any.
+	Tenant string `json:"tenant,omitempty"`
+	// Admin callers see the owners of all tenants.
+	Admin bool `json:"admin,omitempty"`
+}
+
+// TenantConfig is a team sharing a boskos instance with others.
+type TenantConfig struct {
+	// Owners are regular expressions matching the owners of the tenant.
+	Owners []string `json:"owners"`
+}
+
+// Identity is an authenticated caller.
+type Identity struct {
+	Name   string
+	Tenant string
+	Admin  bool
+	owners []*regexp.Regexp
+	// scope restricts the callers of scoped tokens.
+	scope *TokenScope
+}
+
+// CanSeeOwner returns whether the owner metadata of leases by owner can be
+// shown to the caller: admins see every owner, other callers only see
+// themselves and the owners of their tenant. A nil Identity means that
+// authentication is disabled, in which case everything is visible.
+func (i *Identity) CanSeeOwner(owner string) bool {
+	if i == nil || i.Admin {
+		return true
+	}
+	if owner == "" {
+		return true
+	}
+	if i.Name != "" && owner == i.Name {
+		return true
+	}
+	for _, re := range i.owners {
+		if re.MatchString(owner) {
+			return true
+		}
+	}
+	return false
+}
+
+// forbiddenTenantError is returned when a caller acts on behalf of a tenant
+// it does not belong to.
+type forbiddenTenantError string
+
+func (e forbiddenTenantError) Error() string { return string(e) }
+
+// tenantFor returns the tenant a request of the caller naming tenant is made
+// on behalf of. Callers of a tenant act on its behalf unless told otherwise,
+// and only admins may act on behalf of another tenant. A nil Identity means
+// that authentication is disabled, in which case the tenant is trusted.
+func (i *Identity) tenantFor(tenant string) (string, error) {
+	if err := validateIdentifiers(param{"tenant", tenant}); err != nil {
+		return "", err
+	}
+	if i == nil || i.Admin {
+		return tenant, nil
+	}
+	if tenant == "" {
+		return i.Tenant, nil
+	}
+	if tenant != i.Tenant {
+		return "", forbiddenTenantError(fmt.Sprintf("%q may not act on behalf of tenant %s", i.Name, tenant))
+	}
+	return tenant, nil
+}
+
+type identityContextKey struct{}
+
+// callerIdentity returns the identity attached to the request by the
+// Authenticator, or nil if authentication is disabled.
+func callerIdentity(req *http.Request) *Identity {
+	return contextIdentity(req.Context())
+}
+
+// contextIdentity returns the identity attached to ctx by the Authenticator,
+// or nil if authentication is disabled.
+func contextIdentity(ctx context.Context) *Identity {
+	identity, _ := ctx.Value(identityContextKey{}).(*Identity)
+	return identity
+}
+
+type credentials struct {
+	identity *Identity
+	password []byte
+}
+
+// Authenticator authenticates the callers of the boskos API, with the basic
+// auth credentials of the identities of its config, with the scoped tokens
+// minted by their admins or with the bearer tokens of its TokenAuthenticators.
+type Authenticator struct {
+	credentials map[string]credentials
+	tenants     map[string][]*regexp.Regexp
+	tokens      *tokenStore
+	tokenMux    *http.ServeMux
+	bearers     []TokenAuthenticator
+	// shards verify the identities signed into the requests forwarded by
+	// other instances.
+	shards *TypeShards
+}
+
+// LoadAuthConfig reads an auth config file and the password files it refers to.
+func LoadAuthConfig(path string) (*Authenticator, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config := &AuthConfig{}
+	if err := yaml.Unmarshal(b, config); err != nil {
+		return nil, err
+	}
+	return NewAuthenticator(config)
+}
+
+// NewAuthenticator validates config and reads the password files it refers to.
+func NewAuthenticator(config *AuthConfig) (*Authenticator, error) {
+	tenants := map[string][]*regexp.Regexp{}
+	tenantNames := map[string]bool{}
+	for name, tenant := range config.Tenants {
+		tenantNames[name] = true
+		for idx, owner := range tenant.Owners {
+			re, err := regexp.Compile("^(?:" + owner + ")$")
+			if err != nil {
+				return nil, fmt.Errorf(".tenants.%s.owners.%d: %v", name, idx, err)
+			}
+			tenants[name] = append(tenants[name], re)
+		}
+	}
+	a := &Authenticator{credentials: map[string]credentials{}, tenants: tenants, tokens: newTokenStore(tenantNames), tokenMux: http.NewServeMux()}
+	a.tokenMux.HandleFunc("/admin/tokens", a.tokens.handleTokens)
+	a.tokenMux.HandleFunc("/admin/tokens/rotate", a.tokens.handleRotateToken)
+	a.tokenMux.HandleFunc("/admin/tokens/revoke", a.tokens.handleRevokeToken)
+	for idx, entry := range config.Identities {
+		if entry.Name == "" {
+			return nil, fmt.Errorf(".identities.%d.name: must be set", idx)
+		}
+		if _, exists := a.credentials[entry.Name]; exists {
+			return nil, fmt.Errorf(".identities.%d.name: duplicate identity %s", idx, entry.Name)
+		}
+		if entry.PasswordFile == "" {
+			return nil, fmt.Errorf(".identities.%d.password-file: must be set", idx)
+		}
+		if entry.Tenant != "" {
+			if _, ok := config.Tenants[entry.Tenant]; !ok {
+				return nil, fmt.Errorf(".identities.%d.tenant: unknown tenant %s", idx, entry.Tenant)
+			}
+		}
+		password, err := ioutil.ReadFile(entry.PasswordFile)
+		if err != nil {
+			return nil, fmt.Errorf(".identities.%d.password-file: %v", idx, err)
+		}
+		password = bytes.TrimSpace(password)
+		if len(password) == 0 {
+			return nil, fmt.Errorf(".identities.%d.password-file: %s is empty", idx, entry.PasswordFile)
+		}
+		a.credentials[entry.Name] = credentials{
+			identity: &Identity{Name: entry.Name, Tenant: entry.Tenant, Admin: entry.Admin, owners: tenants[entry.Tenant]},
+			password: password,
+		}
+	}
+	return a, nil
+}
+
+// authenticate returns the identity of the caller, an anonymous identity if
+// the request carries no credentials, or an error if they are invalid.
+func (a *Authenticator) authenticate(req *http.Request) (*Identity, error) {
+	if signed := req.Header.Get(common.ForwardedIdentityHeader); signed != "" && a.shards != nil {
+		identity, err := a.shards.verifyIdentity(signed)
+		if err != nil {
+			return nil, err
+		}
+		identity.owners = a.tenants[identity.Tenant]
+		return identity, nil
+	}
+	if secret, ok := bearerToken(req); ok {
+		return a.authenticateBearer(req.Context(), secret)
+	}
+	username, password, ok := req.BasicAuth()
+	if !ok {
+		return &Identity{}, nil
+	}
+	creds, exists := a.credentials[username]
+	if !exists || subtle.ConstantTimeCompare(creds.password, []byte(password)) != 1 {
+		return nil, fmt.Errorf("invalid credentials for %s", username)
+	}
+	return creds.identity, nil
+}
+
+// TrustTypeShards authenticates the requests forwarded by the other instances
+// of shards as the callers whose identity they signed, so that the callers
+// only the forwarding instance can authenticate, like those of its scoped
+// tokens, are recognized.
+func (a *Authenticator) TrustTypeShards(shards *TypeShards) {
+	a.shards = shards
+}
+
+// Wrap authenticates the requests to handler. Requests with invalid
+// credentials are rejected; anonymous requests are served, but see no owner
+// metadata, unless they change leases while bearer tokens are authenticated.
+// The scoped tokens are minted, rotated and revoked under /admin/tokens.
+func (a *Authenticator) Wrap(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		identity, err := a.authenticate(req)
+		if err != nil {
+			logrus.WithError(err).Warningf("Rejected request from %v", req.RemoteAddr)
+			res.Header().Set("WWW-Authenticate", `Basic realm="boskos"`)
+			http.Error(res, "invalid credentials", http.StatusUnauthorized)
+			return
+		}
+		if identity.Name == "" && a.requiresAuthentication(strings.TrimPrefix(strings.TrimPrefix(req.URL.Path, v2Prefix), "/")) {
+			msg := fmt.Sprintf("%s requires an authenticated caller.", req.URL.Path)
+			logrus.Warningf("Rejected anonymous request from %v: %s", req.RemoteAddr, msg)
+			res.Header().Set("WWW-Authenticate", `Bearer realm="boskos"`)
+			http.Error(res, msg, http.StatusUnauthorized)
+			return
+		}
+		req = req.WithContext(context.WithValue(req.Context(), identityContextKey{}, identity))
+		if req.URL.Path == "/admin/tokens" || strings.HasPrefix(req.URL.Path, "/admin/tokens/") {
+			a.tokenMux.ServeHTTP(res, req)
+			return
+		}
+		handler.ServeHTTP(res, req)
+	})
+}
+
+// filterMetric folds the owners the caller cannot see into common.Other.
+func filterMetric(identity *Identity, metric common.Metric) common.Metric {
+	if identity == nil || identity.Admin {
+		return metric
+	}
+	owners := map[string]int{}
+	for owner, count := range metric.Owners {
+		if !identity.CanSeeOwner(owner) {
+			owner = common.Other
+		}
+		owners[owner] += count
+	}
+	metric.Owners = owners
+	if metric.ByOwner != nil {
+		byOwner := map[string]map[string]int{}
+		for owner, states := range metric.ByOwner {
+			if !identity.CanSeeOwner(owner) {
+				owner = common.Other
+			}
+			if byOwner[owner] == nil {
+				byOwner[owner] = map[string]int{}
+			}
+			for state, count := range states {
+				byOwner[owner][state] += count
+			}
+		}
+		metric.ByOwner = byOwner
+	}
+	return metric
+}
+
+// filterQueue redacts the requests of the owners the caller cannot see, only
+// keeping their position in the queue.
+func filterQueue(identity *Identity, queue []common.QueuedRequest) []common.QueuedRequest {
+	if identity == nil || identity.Admin {
+		return queue
+	}
+	filtered := make([]common.QueuedRequest, 0, len(queue))
+	for _, queued := range queue {
+		if queued.Owner == "" || !identity.CanSeeOwner(queued.Owner) {
+			queued.Owner = ""
+			queued.RequestID = ""
+		}
+		filtered = append(filtered, queued)
+	}
+	return filtered
+}
+
+// filterBookings redacts the owners of the bookings the caller cannot see.
+func filterBookings(identity *Identity, bookings []common.Booking) []common.Booking {
+	if identity == nil || identity.Admin {
+		return bookings
+	}
+	filtered := make([]common.Booking, 0, len(bookings))
+	for _, booking := range bookings {
+		if !identity.CanSeeOwner(booking.Owner) {
+			booking.Owner = ""
+		}
+		filtered = append(filtered, booking)
+	}
+	return filtered
+}
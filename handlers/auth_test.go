@@ -0,0 +1,278 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+func makeTestAuthenticator(t *testing.T) *Authenticator {
+	dir := t.TempDir()
+	config := &AuthConfig{Tenants: map[string]TenantConfig{"team-a": {Owners: []string{"team-a-.*"}}}}
+	for _, identity := range []IdentityConfig{
+		{Name: "team-a-ci", Tenant: "team-a"},
+		{Name: "team-b-ci"},
+		{Name: "admin", Admin: true},
+	} {
+		identity.PasswordFile = filepath.Join(dir, identity.Name)
+		if err := ioutil.WriteFile(identity.PasswordFile, []byte(identity.Name+"-password\n"), 0600); err != nil {
+			t.Fatalf("failed to write password file: %v", err)
+		}
+		config.Identities = append(config.Identities, identity)
+	}
+	a, err := NewAuthenticator(config)
+	if err != nil {
+		t.Fatalf("failed to create authenticator: %v", err)
+	}
+	return a
+}
+
+func TestAuthenticatedListings(t *testing.T) {
+	resources := []runtime.Object{
+		newResource("res-1", "t", common.Busy, "team-a-job", fakeNow),
+		newResource("res-2", "t", common.Busy, "team-b-ci", fakeNow),
+		newResource("res-3", "t", common.Busy, "team-c-job", fakeNow),
+	}
+	testCases := []struct {
+		name         string
+		username     string
+		password     string
+		expectCode   int
+		expectOwners map[string]int
+		expectQueue  []string
+	}{
+		{
+			name:         "tenant member sees its tenant",
+			username:     "team-a-ci",
+			password:     "team-a-ci-password",
+			expectCode:   http.StatusOK,
+			expectOwners: map[string]int{"team-a-job": 1, common.Other: 2},
+			expectQueue:  []string{"team-a-job", ""},
+		},
+		{
+			name:         "identity without tenant sees itself",
+			username:     "team-b-ci",
+			password:     "team-b-ci-password",
+			expectCode:   http.StatusOK,
+			expectOwners: map[string]int{"team-b-ci": 1, common.Other: 2},
+			expectQueue:  []string{"", ""},
+		},
+		{
+			name:         "admin sees everything",
+			username:     "admin",
+			password:     "admin-password",
+			expectCode:   http.StatusOK,
+			expectOwners: map[string]int{"team-a-job": 1, "team-b-ci": 1, "team-c-job": 1},
+			expectQueue:  []string{"team-a-job", "team-c-job"},
+		},
+		{
+			name:         "anonymous caller sees no owner",
+			expectCode:   http.StatusOK,
+			expectOwners: map[string]int{common.Other: 3},
+			expectQueue:  []string{"", ""},
+		},
+		{
+			name:       "wrong password is rejected",
+			username:   "admin",
+			password:   "team-a-ci-password",
+			expectCode: http.StatusUnauthorized,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := makeTestRanchWithTTL(resources, time.Hour)
+			for _, owner := range []string{"team-a-job", "team-c-job"} {
+				if _, _, err := r.Acquire("t", common.Free, common.Busy, owner, owner+"-request"); err == nil {
+					t.Fatalf("expected the request of %s to be queued", owner)
+				}
+			}
+			handler := makeTestAuthenticator(t).Wrap(NewBoskosHandler(r))
+
+			get := func(path string, into interface{}) {
+				req := httptest.NewRequest(http.MethodGet, path, nil)
+				if tc.username != "" {
+					req.SetBasicAuth(tc.username, tc.password)
+				}
+				rr := httptest.NewRecorder()
+				handler.ServeHTTP(rr, req)
+				if rr.Code != tc.expectCode {
+					t.Fatalf("%s: expected code %d, got %d: %s", path, tc.expectCode, rr.Code, rr.Body.String())
+				}
+				if rr.Code != http.StatusOK {
+					return
+				}
+				if err := json.Unmarshal(rr.Body.Bytes(), into); err != nil {
+					t.Fatalf("%s: failed to unmarshal body: %v", path, err)
+				}
+			}
+
+			var metric common.Metric
+			get("/metric?type=t", &metric)
+			if tc.expectCode != http.StatusOK {
+				return
+			}
+			if !reflect.DeepEqual(metric.Owners, tc.expectOwners) {
+				t.Errorf("expected owners %v, got %v", tc.expectOwners, metric.Owners)
+			}
+
+			var byOwner common.Metric
+			get("/metric?type=t&by_owner=true", &byOwner)
+			expectByOwner := map[string]map[string]int{}
+			for owner, count := range tc.expectOwners {
+				expectByOwner[owner] = map[string]int{common.Busy: count}
+			}
+			if !reflect.DeepEqual(byOwner.ByOwner, expectByOwner) {
+				t.Errorf("expected counts by owner %v, got %v", expectByOwner, byOwner.ByOwner)
+			}
+
+			var queue []common.QueuedRequest
+			get("/queue?type=t", &queue)
+			var owners []string
+			for _, queued := range queue {
+				if (queued.Owner == "") != (queued.RequestID == "") {
+					t.Errorf("expected the owner and request id to be redacted together, got %+v", queued)
+				}
+				owners = append(owners, queued.Owner)
+			}
+			if !reflect.DeepEqual(owners, tc.expectQueue) {
+				t.Errorf("expected queued owners %v, got %v", tc.expectQueue, owners)
+			}
+		})
+	}
+}
+
+func TestNewAuthenticatorValidation(t *testing.T) {
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	if err := ioutil.WriteFile(passwordFile, []byte("secret"), 0600); err != nil {
+		t.Fatalf("failed to write password file: %v", err)
+	}
+	testCases := []struct {
+		name   string
+		config AuthConfig
+	}{
+		{
+			name:   "missing name",
+			config: AuthConfig{Identities: []IdentityConfig{{PasswordFile: passwordFile}}},
+		},
+		{
+			name:   "missing password file",
+			config: AuthConfig{Identities: []IdentityConfig{{Name: "ci", PasswordFile: "/does/not/exist"}}},
+		},
+		{
+			name:   "unknown tenant",
+			config: AuthConfig{Identities: []IdentityConfig{{Name: "ci", PasswordFile: passwordFile, Tenant: "team"}}},
+		},
+		{
+			name:   "invalid owner pattern",
+			config: AuthConfig{Tenants: map[string]TenantConfig{"team": {Owners: []string{"("}}}},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := NewAuthenticator(&tc.config); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestAuthenticatedTenants(t *testing.T) {
+	testCases := []struct {
+		name         string
+		username     string
+		tenant       string
+		expectCode   int
+		expectTenant string
+	}{
+		{
+			name:       "tenant member acquires for its tenant",
+			username:   "team-a-ci",
+			expectCode: http.StatusOK,
+		},
+		{
+			name:       "tenant member cannot act for another tenant",
+			username:   "team-a-ci",
+			tenant:     "team-b",
+			expectCode: http.StatusForbidden,
+		},
+		{
+			name:         "identity without tenant cannot acquire for a tenant",
+			username:     "team-b-ci",
+			expectCode:   http.StatusForbidden,
+			expectTenant: "team-a",
+		},
+		{
+			name:       "admin acts for any tenant",
+			username:   "admin",
+			tenant:     "team-a",
+			expectCode: http.StatusOK,
+		},
+		{
+			name:       "anonymous caller cannot act for a tenant",
+			tenant:     "team-a",
+			expectCode: http.StatusForbidden,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := MakeTestRanch(nil)
+			if err := r.ApplyConfig(&common.BoskosConfig{Resources: []common.ResourceEntry{
+				{Type: "t", State: common.Free, Names: []string{"res"}, Tenant: "team-a"},
+			}}); err != nil {
+				t.Fatalf("failed to apply config: %v", err)
+			}
+			handler := makeTestAuthenticator(t).Wrap(NewBoskosHandler(r))
+
+			req := httptest.NewRequest(http.MethodPost, "/acquire?type=t&state=free&dest=busy&owner=o", nil)
+			if tc.username != "" {
+				req.SetBasicAuth(tc.username, tc.username+"-password")
+			}
+			if tc.tenant != "" {
+				req.Header.Set(common.TenantHeader, tc.tenant)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			if rr.Code != tc.expectCode {
+				t.Fatalf("expected code %d, got %d: %s", tc.expectCode, rr.Code, rr.Body.String())
+			}
+			if tenant := rr.Header().Get(common.TenantHeader); tenant != tc.expectTenant {
+				t.Errorf("expected tenant header %q, got %q", tc.expectTenant, tenant)
+			}
+			if rr.Code != http.StatusOK {
+				return
+			}
+			var res common.Resource
+			if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+				t.Fatalf("failed to unmarshal body: %v", err)
+			}
+			if res.Tenant != "team-a" {
+				t.Errorf("expected a resource of team-a, got %+v", res)
+			}
+		})
+	}
+}
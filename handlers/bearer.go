@@ -0,0 +1,191 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	authenticationv1client "k8s.io/client-go/kubernetes/typed/authentication/v1"
+)
+
+// authenticatedEndpoints are the endpoints rejecting anonymous callers once
+// bearer tokens authenticate them, as they take resources away from their
+// owners or change them.
+var authenticatedEndpoints = sets.NewString(
+	"acquire", "acquirebystate", "acquirebatch", "release", "reset",
+	"claimexpired", "hold", "confirm", "update", "lock", "unlock", "book",
+	"cancelbooking", "reserve", "import", "demand", "shards",
+)
+
+// tokenReviewCacheTTL is how long a successful review of a token is trusted,
+// so polling clients don't review their token on every call.
+const tokenReviewCacheTTL = time.Minute
+
+// TokenAuthenticator authenticates the bearer tokens of callers, other than
+// the scoped tokens minted by boskos.
+type TokenAuthenticator interface {
+	// AuthenticateToken returns the name of the caller holding token, or
+	// false if the token is unknown.
+	AuthenticateToken(ctx context.Context, token string) (string, bool, error)
+}
+
+// staticTokens maps the hashes of tokens to the names of their callers.
+type staticTokens map[[sha256.Size]byte]string
+
+// LoadTokenFile reads a file of static tokens in the CSV format of the static
+// token files of Kubernetes: a line per token, followed by the name of its
+// caller. Further columns are ignored.
+func LoadTokenFile(path string) (TokenAuthenticator, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	tokens := staticTokens{}
+	for idx, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		// The token and the name never hold commas, unlike the quoted
+		// groups which may follow them.
+		fields := strings.SplitN(line, ",", 3)
+		if len(fields) < 2 || strings.TrimSpace(fields[0]) == "" || strings.TrimSpace(fields[1]) == "" {
+			return nil, fmt.Errorf("%s:%d: must hold a token and the name of its caller", path, idx+1)
+		}
+		hash := sha256.Sum256([]byte(strings.TrimSpace(fields[0])))
+		if _, exists := tokens[hash]; exists {
+			return nil, fmt.Errorf("%s:%d: duplicate token", path, idx+1)
+		}
+		tokens[hash] = strings.TrimSpace(fields[1])
+	}
+	return tokens, nil
+}
+
+func (t staticTokens) AuthenticateToken(_ context.Context, token string) (string, bool, error) {
+	name, ok := t[sha256.Sum256([]byte(token))]
+	return name, ok, nil
+}
+
+// tokenReviewer authenticates the tokens of service accounts and of any
+// other caller known to a Kubernetes cluster with TokenReviews.
+type tokenReviewer struct {
+	client    authenticationv1client.TokenReviewInterface
+	audiences []string
+	now       func() time.Time
+
+	lock   sync.Mutex
+	cached map[[sha256.Size]byte]reviewedToken
+}
+
+type reviewedToken struct {
+	name   string
+	expiry time.Time
+}
+
+// NewTokenReviewAuthenticator returns a TokenAuthenticator creating
+// TokenReviews with client, e.g. so jobs authenticate with the tokens of
+// their service accounts. If audiences are set, tokens must be issued for
+// one of them.
+func NewTokenReviewAuthenticator(client authenticationv1client.TokenReviewInterface, audiences ...string) TokenAuthenticator {
+	return &tokenReviewer{client: client, audiences: audiences, now: time.Now, cached: map[[sha256.Size]byte]reviewedToken{}}
+}
+
+func (t *tokenReviewer) AuthenticateToken(ctx context.Context, token string) (string, bool, error) {
+	hash := sha256.Sum256([]byte(token))
+	now := t.now()
+	t.lock.Lock()
+	reviewed, ok := t.cached[hash]
+	t.lock.Unlock()
+	if ok && now.Before(reviewed.expiry) {
+		return reviewed.name, true, nil
+	}
+
+	review, err := t.client.Create(ctx, &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: token, Audiences: t.audiences},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return "", false, fmt.Errorf("failed to review token: %w", err)
+	}
+	if !review.Status.Authenticated {
+		return "", false, nil
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for key, cached := range t.cached {
+		if !now.Before(cached.expiry) {
+			delete(t.cached, key)
+		}
+	}
+	t.cached[hash] = reviewedToken{name: review.Status.User.Username, expiry: now.Add(tokenReviewCacheTTL)}
+	return review.Status.User.Username, true, nil
+}
+
+// AddTokenAuthenticator authenticates the callers of bearer tokens unknown to
+// boskos with t. Callers are given the tenant of the identity of the config
+// bearing their name, if any. Once a TokenAuthenticator is added, anonymous
+// callers may no longer acquire, release, reset or change resources.
+func (a *Authenticator) AddTokenAuthenticator(t TokenAuthenticator) {
+	a.bearers = append(a.bearers, t)
+}
+
+// authenticateBearer returns the identity of the caller of a bearer token.
+func (a *Authenticator) authenticateBearer(ctx context.Context, secret string) (*Identity, error) {
+	token, err := a.tokens.lookup(ctx, secret)
+	if err == nil {
+		scope := token.Scope
+		return &Identity{Name: token.Name, Tenant: token.Tenant, owners: a.tenants[token.Tenant], scope: &scope}, nil
+	}
+	// A failing authenticator does not reject the tokens known to the
+	// next ones.
+	var reviewErr error
+	for _, bearer := range a.bearers {
+		name, ok, bearerErr := bearer.AuthenticateToken(ctx, secret)
+		if bearerErr != nil {
+			if reviewErr == nil {
+				reviewErr = bearerErr
+			}
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if creds, exists := a.credentials[name]; exists {
+			return creds.identity, nil
+		}
+		return &Identity{Name: name}, nil
+	}
+	if reviewErr != nil {
+		return nil, reviewErr
+	}
+	return nil, err
+}
+
+// requiresAuthentication tells whether anonymous callers are rejected from
+// endpoint, named like the verbs of scoped tokens.
+func (a *Authenticator) requiresAuthentication(endpoint string) bool {
+	return len(a.bearers) > 0 && authenticatedEndpoints.Has(endpoint)
+}
@@ -0,0 +1,253 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+func TestBearerTokens(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "tokens.csv")
+	if err := ioutil.WriteFile(tokenFile, []byte("# static tokens\nteam-a-token,team-a-ci,1001\njob-token,job,1002,\"ci,e2e\"\n"), 0600); err != nil {
+		t.Fatalf("failed to write token file: %v", err)
+	}
+	tokens, err := LoadTokenFile(tokenFile)
+	if err != nil {
+		t.Fatalf("failed to load token file: %v", err)
+	}
+
+	testCases := []struct {
+		name       string
+		method     string
+		url        string
+		token      string
+		basicAuth  bool
+		expectCode int
+	}{
+		{
+			name:       "anonymous callers cannot acquire",
+			method:     http.MethodPost,
+			url:        "/acquire?type=t&state=free&dest=busy&owner=o",
+			expectCode: http.StatusUnauthorized,
+		},
+		{
+			name:       "anonymous callers cannot release through v2",
+			method:     http.MethodPost,
+			url:        "/v2/release?name=res&dest=dirty&owner=o",
+			expectCode: http.StatusUnauthorized,
+		},
+		{
+			name:       "anonymous callers cannot reset",
+			method:     http.MethodPost,
+			url:        "/reset?type=t&state=busy&expire=1m&dest=dirty",
+			expectCode: http.StatusUnauthorized,
+		},
+		{
+			name:       "anonymous callers cannot claim",
+			method:     http.MethodPost,
+			url:        "/claimexpired?type=t&dest=cleaning&owner=o",
+			expectCode: http.StatusUnauthorized,
+		},
+		{
+			name:       "anonymous callers cannot update",
+			method:     http.MethodPost,
+			url:        "/update?name=res&state=free&owner=o",
+			expectCode: http.StatusUnauthorized,
+		},
+		{
+			name:       "callers other than admins cannot enter lame-duck mode",
+			method:     http.MethodPost,
+			url:        "/lameduck?enabled=true",
+			token:      "job-token",
+			expectCode: http.StatusUnauthorized,
+		},
+		{
+			name:       "callers other than admins cannot join shard groups",
+			method:     http.MethodPost,
+			url:        "/shards?group=g&owner=o",
+			token:      "job-token",
+			expectCode: http.StatusUnauthorized,
+		},
+		{
+			name:       "anonymous callers still list",
+			method:     http.MethodGet,
+			url:        "/metric?type=t",
+			expectCode: http.StatusOK,
+		},
+		{
+			name:       "static token acquires",
+			method:     http.MethodPost,
+			url:        "/acquire?type=t&state=free&dest=busy&owner=o",
+			token:      "job-token",
+			expectCode: http.StatusOK,
+		},
+		{
+			name:       "basic auth acquires",
+			method:     http.MethodPost,
+			url:        "/acquire?type=t&state=free&dest=busy&owner=o",
+			basicAuth:  true,
+			expectCode: http.StatusOK,
+		},
+		{
+			name:       "unknown token is rejected",
+			method:     http.MethodGet,
+			url:        "/metric?type=t",
+			token:      "stolen-token",
+			expectCode: http.StatusUnauthorized,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			a := makeTestAuthenticator(t)
+			a.AddTokenAuthenticator(tokens)
+			handler := a.Wrap(NewBoskosHandler(MakeTestRanch([]runtime.Object{
+				newResource("res", "t", common.Free, "", fakeNow),
+			})))
+
+			req := httptest.NewRequest(tc.method, tc.url, nil)
+			if tc.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+			if tc.basicAuth {
+				req.SetBasicAuth("team-b-ci", "team-b-ci-password")
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			if rr.Code != tc.expectCode {
+				t.Errorf("expected code %d, got %d: %s", tc.expectCode, rr.Code, rr.Body.String())
+			}
+		})
+	}
+
+	// Tokens of the identities of the config get their tenant, even if an
+	// authenticator before the one knowing the token fails.
+	a := makeTestAuthenticator(t)
+	a.AddTokenAuthenticator(failingAuthenticator{})
+	a.AddTokenAuthenticator(tokens)
+	identity, err := a.authenticateBearer(context.Background(), "team-a-token")
+	if err != nil {
+		t.Fatalf("failed to authenticate token: %v", err)
+	}
+	if identity.Name != "team-a-ci" || identity.Tenant != "team-a" {
+		t.Errorf("expected the identity of team-a-ci, got %+v", identity)
+	}
+}
+
+func TestBearerTokensRejectAnonymousChanges(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "tokens.csv")
+	if err := ioutil.WriteFile(tokenFile, []byte("job-token,job\n"), 0600); err != nil {
+		t.Fatalf("failed to write token file: %v", err)
+	}
+	tokens, err := LoadTokenFile(tokenFile)
+	if err != nil {
+		t.Fatalf("failed to load token file: %v", err)
+	}
+	a := makeTestAuthenticator(t)
+	a.AddTokenAuthenticator(tokens)
+	handler := a.Wrap(NewBoskosHandler(MakeTestRanch([]runtime.Object{
+		newResource("res", "t", common.Busy, "o", fakeNow),
+	})))
+
+	for _, url := range []string{
+		"/cancelbooking?name=res&owner=o",
+		"/unlock?name=l&owner=o",
+		"/demand?type=t&count=1000",
+		"/shards?group=g&owner=o",
+		"/v2/cancelbooking?name=res&owner=o",
+	} {
+		t.Run(url, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, url, nil))
+			if rr.Code != http.StatusUnauthorized {
+				t.Errorf("expected code %d, got %d: %s", http.StatusUnauthorized, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+// failingAuthenticator fails to authenticate any token.
+type failingAuthenticator struct{}
+
+func (failingAuthenticator) AuthenticateToken(context.Context, string) (string, bool, error) {
+	return "", false, errors.New("token review unavailable")
+}
+
+func TestLoadTokenFileValidation(t *testing.T) {
+	for name, content := range map[string]string{
+		"missing name":    "token\n",
+		"empty token":     ",name\n",
+		"duplicate token": "token,a\ntoken,b\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			tokenFile := filepath.Join(t.TempDir(), "tokens.csv")
+			if err := ioutil.WriteFile(tokenFile, []byte(content), 0600); err != nil {
+				t.Fatalf("failed to write token file: %v", err)
+			}
+			if _, err := LoadTokenFile(tokenFile); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestTokenReviewAuthenticator(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	reviews := 0
+	client.PrependReactor("create", "tokenreviews", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		reviews++
+		review := action.(clienttesting.CreateAction).GetObject().(*authenticationv1.TokenReview)
+		if review.Spec.Token == "sa-token" && len(review.Spec.Audiences) == 1 && review.Spec.Audiences[0] == "boskos" {
+			review.Status.Authenticated = true
+			review.Status.User.Username = "system:serviceaccount:test-pods:default"
+		}
+		return true, review, nil
+	})
+	now := time.Now()
+	reviewer := NewTokenReviewAuthenticator(client.AuthenticationV1().TokenReviews(), "boskos").(*tokenReviewer)
+	reviewer.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		name, ok, err := reviewer.AuthenticateToken(context.Background(), "sa-token")
+		if err != nil || !ok || name != "system:serviceaccount:test-pods:default" {
+			t.Fatalf("expected the service account, got %q, %t: %v", name, ok, err)
+		}
+	}
+	if reviews != 1 {
+		t.Errorf("expected the review to be cached, got %d reviews", reviews)
+	}
+	now = now.Add(tokenReviewCacheTTL)
+	if _, ok, _ := reviewer.AuthenticateToken(context.Background(), "sa-token"); !ok || reviews != 2 {
+		t.Errorf("expected the token to be reviewed again once cached for %v, got %d reviews", tokenReviewCacheTTL, reviews)
+	}
+	if _, ok, err := reviewer.AuthenticateToken(context.Background(), "other-token"); ok || err != nil {
+		t.Errorf("expected an unknown token, got %t: %v", ok, err)
+	}
+}
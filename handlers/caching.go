@@ -0,0 +1,93 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// minGzipSize is the size below which responses are not worth compressing.
+const minGzipSize = 1024
+
+// writeCacheableJSON writes a JSON response to a read-only request with an
+// ETag, answering with a 304 when the client already has the same body, and
+// compressing it for clients accepting gzip. This keeps dashboards polling
+// boskos from transferring unchanged responses over and over again.
+func writeCacheableJSON(res http.ResponseWriter, req *http.Request, body []byte) {
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	res.Header().Set("ETag", etag)
+	res.Header().Set("Vary", "Accept-Encoding")
+	if etagMatches(req.Header.Get("If-None-Match"), etag) {
+		res.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	if len(body) < minGzipSize || !acceptsGzip(req.Header.Get("Accept-Encoding")) {
+		res.Write(body)
+		return
+	}
+	res.Header().Set("Content-Encoding", "gzip")
+	gz := gzip.NewWriter(res)
+	if _, err := gz.Write(body); err != nil {
+		logrus.WithError(err).Warning("Failed to write compressed response")
+		return
+	}
+	if err := gz.Close(); err != nil {
+		logrus.WithError(err).Warning("Failed to write compressed response")
+	}
+}
+
+// etagMatches returns whether an If-None-Match header matches etag, using the
+// weak comparison required for If-None-Match.
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptsGzip returns whether an Accept-Encoding header allows gzip.
+func acceptsGzip(acceptEncoding string) bool {
+	for _, coding := range strings.Split(acceptEncoding, ",") {
+		parts := strings.Split(coding, ";")
+		if strings.TrimSpace(parts[0]) != "gzip" {
+			continue
+		}
+		for _, param := range parts[1:] {
+			kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+			if len(kv) == 2 && kv[0] == "q" {
+				if q, err := strconv.ParseFloat(kv[1], 64); err == nil && q == 0 {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	return false
+}
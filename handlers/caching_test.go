@@ -0,0 +1,136 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+func TestWriteCacheableJSON(t *testing.T) {
+	large := append(append([]byte(`"`), bytes.Repeat([]byte("a"), minGzipSize)...), '"')
+	testCases := []struct {
+		name           string
+		body           []byte
+		ifNoneMatch    string
+		acceptEncoding string
+		expectCode     int
+		expectGzip     bool
+	}{
+		{
+			name:       "plain",
+			body:       []byte(`{}`),
+			expectCode: http.StatusOK,
+		},
+		{
+			name:           "small bodies are not compressed",
+			body:           []byte(`{}`),
+			acceptEncoding: "gzip",
+			expectCode:     http.StatusOK,
+		},
+		{
+			name:           "large bodies are compressed",
+			body:           large,
+			acceptEncoding: "deflate, gzip;q=0.5",
+			expectCode:     http.StatusOK,
+			expectGzip:     true,
+		},
+		{
+			name:           "gzip refused",
+			body:           large,
+			acceptEncoding: "gzip;q=0",
+			expectCode:     http.StatusOK,
+		},
+		{
+			name:        "stale etag",
+			body:        []byte(`{}`),
+			ifNoneMatch: `"stale"`,
+			expectCode:  http.StatusOK,
+		},
+		{
+			name:        "wildcard",
+			body:        []byte(`{}`),
+			ifNoneMatch: "*",
+			expectCode:  http.StatusNotModified,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/metric", nil)
+			req.Header.Set("If-None-Match", tc.ifNoneMatch)
+			req.Header.Set("Accept-Encoding", tc.acceptEncoding)
+			rr := httptest.NewRecorder()
+			writeCacheableJSON(rr, req, tc.body)
+			if rr.Code != tc.expectCode {
+				t.Fatalf("expected code %d, got %d", tc.expectCode, rr.Code)
+			}
+			if rr.Header().Get("ETag") == "" {
+				t.Error("expected an ETag")
+			}
+			if tc.expectCode != http.StatusOK {
+				if rr.Body.Len() != 0 {
+					t.Errorf("expected no body, got %q", rr.Body.String())
+				}
+				return
+			}
+			body := rr.Body.Bytes()
+			if gzipped := rr.Header().Get("Content-Encoding") == "gzip"; gzipped != tc.expectGzip {
+				t.Fatalf("expected gzip %t, got %t", tc.expectGzip, gzipped)
+			}
+			if tc.expectGzip {
+				gz, err := gzip.NewReader(rr.Body)
+				if err != nil {
+					t.Fatalf("failed to read compressed body: %v", err)
+				}
+				if body, err = ioutil.ReadAll(gz); err != nil {
+					t.Fatalf("failed to read compressed body: %v", err)
+				}
+			}
+			if !bytes.Equal(body, tc.body) {
+				t.Errorf("expected body %q, got %q", tc.body, body)
+			}
+		})
+	}
+}
+
+func TestMetricNotModified(t *testing.T) {
+	resources := []runtime.Object{newResource("res", "t", common.Busy, "owner", fakeNow)}
+	handler := NewBoskosHandler(MakeTestRanch(resources))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metric?type=t", nil))
+	etag := rr.Header().Get("ETag")
+	if rr.Code != http.StatusOK || etag == "" {
+		t.Fatalf("expected a response with an ETag, got %d with ETag %q", rr.Code, etag)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/metric?type=t", nil)
+	req.Header.Set("If-None-Match", etag)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotModified {
+		t.Errorf("expected %d for an unchanged metric, got %d", http.StatusNotModified, rr.Code)
+	}
+}
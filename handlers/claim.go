@@ -0,0 +1,119 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/boskos/ranch"
+)
+
+// minClaimExpire is the default expiry of the reaper, the shortest expire
+// the callers other than admins may claim stale resources with.
+const minClaimExpire = 30 * time.Minute
+
+//  handleClaimExpired: Handler for /claimexpired
+//  Method: POST
+// 	URLParams:
+//		Required: type=[string]  : type of the resource to claim
+//		Required: dest=[string] : destination state of the claimed resource
+//		Required: owner=[string] : new owner of the resource
+//		Optional: expire=[duration] : also claim the busy, cleaning and leased resources not updated for this long, at least 30m unless admin
+//  Hands a resource whose lease expired, or which went stale, to owner.
+func handleClaimExpired(r *ranch.Ranch) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		logrus.WithField("handler", "handleClaimExpired").Infof("From %v", req.RemoteAddr)
+
+		if req.Method != http.MethodPost {
+			msg := fmt.Sprintf("Method %v, /claimexpired only accepts POST.", req.Method)
+			logrus.Warning(msg)
+			http.Error(res, msg, http.StatusMethodNotAllowed)
+			return
+		}
+
+		rtype := req.URL.Query().Get("type")
+		dest := req.URL.Query().Get("dest")
+		owner := req.URL.Query().Get("owner")
+		if rtype == "" || dest == "" || owner == "" {
+			bre := badRequestError(fmt.Sprintf("Type: %v, dest: %v, owner: %v, all of them must be set in the request.", rtype, dest, owner))
+			returnAndLogError(res, bre, "Bad request")
+			return
+		}
+		if err := validateIdentifiers(param{"type", rtype}, param{"dest", dest}); err != nil {
+			returnAndLogError(res, err, "Bad request")
+			return
+		}
+		if err := validateFreeform(param{"owner", owner}); err != nil {
+			returnAndLogError(res, err, "Bad request")
+			return
+		}
+		var expire time.Duration
+		if v := req.URL.Query().Get("expire"); v != "" {
+			var err error
+			if expire, err = time.ParseDuration(v); err != nil {
+				returnAndLogError(res, badRequestError(fmt.Sprintf("invalid expire %q: %v", v, err)), "Bad request")
+				return
+			}
+			if err := validateExpire(expire); err != nil {
+				returnAndLogError(res, err, "Bad request")
+				return
+			}
+			// Claiming resources sooner than the reaper would reset them
+			// takes them away from owners which are merely slow.
+			if expire < minClaimExpire && requireAdmin(res, req) {
+				return
+			}
+		}
+
+		if err := resolveType(res, req, r, owner, &rtype); err != nil {
+			returnAndLogError(res, err, "Claim failed")
+			return
+		}
+
+		resolveStates(res, req, r, owner, rtype, &dest)
+		if err := validateStates(r, rtype, param{"dest", dest}); err != nil {
+			returnAndLogError(res, err, "Bad request")
+			return
+		}
+
+		if err := authorizePolicy(r, "acquire", callerIdentity(req), owner, req.RemoteAddr, rtype); err != nil {
+			returnAndLogError(res, err, "Forbidden")
+			return
+		}
+
+		resource, previousOwner, err := r.ClaimExpired(rtype, dest, owner, expire)
+		if err != nil {
+			returnAndLogError(res, err, "Claim failed")
+			return
+		}
+
+		resJSON, err := json.Marshal(toLeasedResource(r, resource))
+		if err != nil {
+			logrus.WithError(err).Errorf("json.Marshal failed: %v", resource)
+			http.Error(res, err.Error(), errorToStatus(err))
+			return
+		}
+		logrus.Infof("Resource of %s claimed: %v", previousOwner, string(resJSON))
+		res.Header().Set("Content-Type", "application/json")
+		res.Write(resJSON)
+	}
+}
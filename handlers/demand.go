@@ -0,0 +1,129 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/ranch"
+)
+
+const (
+	// defaultDemandDuration is how long declared demand is provisioned for
+	// once it is due, when /demand is called without a duration.
+	defaultDemandDuration = 15 * time.Minute
+	// maxDemandCount bounds a single demand declaration.
+	maxDemandCount = 1000
+	// maxDemandHorizon bounds how far ahead demand may be declared and for how long.
+	maxDemandHorizon = 24 * time.Hour
+)
+
+// parseDemandDuration parses an optional duration parameter within [0, maxDemandHorizon].
+func parseDemandDuration(req *http.Request, name string, defaultValue time.Duration) (time.Duration, error) {
+	v := req.URL.Query().Get(name)
+	if v == "" {
+		return defaultValue, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 || d > maxDemandHorizon {
+		return 0, badRequestError(fmt.Sprintf("invalid %s %q: must be a duration between 0 and %v", name, v, maxDemandHorizon))
+	}
+	return d, nil
+}
+
+//  handleDemand: Handler for /demand
+//  Method: GET, POST
+// 	URLParams:
+//		Required for POST: type=[string] : type of the resources needed
+//		Required for POST: count=[int] : number of resources needed
+//		Optional for POST: in=[duration] : how soon the resources are needed
+//		Optional for POST: duration=[duration] : how long the resources are needed for once due
+func handleDemand(r *ranch.Ranch) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		logrus.WithField("handler", "handleDemand").Infof("From %v", req.RemoteAddr)
+
+		switch req.Method {
+		case http.MethodGet:
+			js, err := json.Marshal(r.Demand())
+			if err != nil {
+				logrus.WithError(err).Error("Fail to marshal demand")
+				http.Error(res, err.Error(), errorToStatus(err))
+				return
+			}
+			res.Header().Set("Content-Type", "application/json")
+			res.Write(js)
+			return
+		case http.MethodPost:
+		default:
+			msg := fmt.Sprintf("Method %v, /demand only accepts GET and POST.", req.Method)
+			logrus.Warning(msg)
+			http.Error(res, msg, http.StatusMethodNotAllowed)
+			return
+		}
+
+		rtype := req.URL.Query().Get("type")
+		if rtype == "" {
+			returnAndLogError(res, badRequestError("type must be set in the request."), "Bad request")
+			return
+		}
+		if err := validateIdentifiers(param{"type", rtype}); err != nil {
+			returnAndLogError(res, err, "Bad request")
+			return
+		}
+		if err := resolveType(res, req, r, "", &rtype); err != nil {
+			returnAndLogError(res, err, "Demand failed")
+			return
+		}
+		count, err := strconv.Atoi(req.URL.Query().Get("count"))
+		if err != nil || count <= 0 || count > maxDemandCount {
+			returnAndLogError(res, badRequestError(fmt.Sprintf("invalid count %q: must be an integer between 1 and %d", req.URL.Query().Get("count"), maxDemandCount)), "Bad request")
+			return
+		}
+		in, err := parseDemandDuration(req, "in", 0)
+		if err != nil {
+			returnAndLogError(res, err, "Bad request")
+			return
+		}
+		duration, err := parseDemandDuration(req, "duration", defaultDemandDuration)
+		if err != nil {
+			returnAndLogError(res, err, "Bad request")
+			return
+		}
+
+		created, err := r.DeclareDemand(rtype, count, in, duration)
+		if err != nil {
+			returnAndLogError(res, err, "Declare demand failed")
+			return
+		}
+
+		js, err := json.Marshal(common.DemandDeclared{Created: created})
+		if err != nil {
+			logrus.WithError(err).Error("Fail to marshal demand")
+			http.Error(res, err.Error(), errorToStatus(err))
+			return
+		}
+		res.Header().Set("Content-Type", "application/json")
+		res.Write(js)
+	}
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/crds"
+	"sigs.k8s.io/boskos/ranch"
+)
+
+// deprecation is a client behavior that is still supported but will be
+// removed, or that works against the way boskos is meant to be used.
+type deprecation struct {
+	// id is the stable identifier of the deprecation sent to clients.
+	id      string
+	message string
+}
+
+// missingHeartbeatThreshold is how long a leased resource may go without
+// updates before its release is flagged as missing heartbeats. It is well
+// below the default expiry of the reaper, which resets such resources.
+const missingHeartbeatThreshold = 10 * time.Minute
+
+var (
+	deprecatedMissingHeartbeat = deprecation{
+		id:      "missing-heartbeat",
+		message: fmt.Sprintf("resource released without being updated for over %v, send heartbeats with /update while holding a lease or the reaper will reset it", missingHeartbeatThreshold),
+	}
+	deprecatedUnversionedAPI = deprecation{
+		id:      common.UnversionedAPIDeprecation,
+		message: fmt.Sprintf("the unversioned API returns errors as plain text, call the endpoints under %s instead", v2Prefix),
+	}
+)
+
+// missedHeartbeats tells whether the release of resource to dest by its owner
+// comes after it went without updates for too long. Janitors releasing the
+// resources they cleaned are exempt, as they do not hold leases.
+func missedHeartbeats(r *ranch.Ranch, resource *crds.ResourceObject, dest string) bool {
+	if resource.Status.LastUpdate.IsZero() {
+		return false
+	}
+	if resource.Status.State == common.Cleaning && (dest == common.Free || dest == common.Dirty) {
+		return false
+	}
+	return r.Now().Sub(resource.Status.LastUpdate.Time) > missingHeartbeatThreshold
+}
+
+// withUnversionedAPIWarning flags the requests to h, served by the unversioned
+// API, as deprecated.
+func withUnversionedAPIWarning(r *ranch.Ranch, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		warnDeprecated(res, req, r, req.URL.Query().Get("owner"), deprecatedUnversionedAPI)
+		h.ServeHTTP(res, req)
+	})
+}
+
+// warnDeprecated flags the response to a request of owner relying on the
+// deprecated behavior d, and counts it.
+func warnDeprecated(res http.ResponseWriter, req *http.Request, r *ranch.Ranch, owner string, d deprecation) {
+	// 299 is the "Miscellaneous persistent warning" code of RFC 7234.
+	res.Header().Add("Warning", fmt.Sprintf("299 boskos %s", strconv.Quote(d.message)))
+	res.Header().Add(common.DeprecationHeader, d.id)
+	r.ObserveDeprecatedUsage(d.id, owner)
+	logrus.WithFields(logrus.Fields{
+		"deprecation": d.id,
+		"owner":       owner,
+		"from":        req.RemoteAddr,
+		"user-agent":  req.UserAgent(),
+		"path":        req.URL.Path,
+	}).Info("Request relies on deprecated behavior")
+}
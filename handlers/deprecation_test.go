@@ -0,0 +1,168 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+func TestReleaseMissingHeartbeat(t *testing.T) {
+	now := fakeNow.Time
+	testCases := []struct {
+		name          string
+		state         string
+		owner         string
+		dest          string
+		lastUpdate    time.Time
+		expectWarning bool
+	}{
+		{
+			name:       "recent heartbeat",
+			state:      common.Busy,
+			owner:      "merlin",
+			dest:       common.Dirty,
+			lastUpdate: now,
+		},
+		{
+			name:          "missing heartbeat",
+			state:         common.Busy,
+			owner:         "merlin",
+			dest:          common.Dirty,
+			lastUpdate:    now.Add(-time.Hour),
+			expectWarning: true,
+		},
+		{
+			name:       "janitor releasing a cleaned resource",
+			state:      common.Cleaning,
+			owner:      "janitor",
+			dest:       common.Free,
+			lastUpdate: now.Add(-time.Hour),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := MakeTestRanch([]runtime.Object{newResource("res", "t", tc.state, tc.owner, metav1.NewTime(tc.lastUpdate))})
+			// The heartbeats are measured with the clock of the ranch, not the wall clock.
+			r.SetClock(func() metav1.Time { return fakeNow })
+			req := httptest.NewRequest(http.MethodPost, "/release?name=res&dest="+tc.dest+"&owner="+tc.owner, nil)
+			rr := httptest.NewRecorder()
+			handleRelease(r).ServeHTTP(rr, req)
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+			}
+			deprecation := rr.Header().Get(common.DeprecationHeader)
+			if warned := deprecation == deprecatedMissingHeartbeat.id; warned != tc.expectWarning {
+				t.Errorf("expected warning %t, got deprecation header %q", tc.expectWarning, deprecation)
+			}
+			if tc.expectWarning && rr.Header().Get("Warning") == "" {
+				t.Error("expected a Warning header")
+			}
+		})
+	}
+}
+
+func TestUnversionedAPIWarning(t *testing.T) {
+	testCases := []struct {
+		name          string
+		path          string
+		expectWarning bool
+	}{
+		{
+			name: "v2 API",
+			path: "/v2/metric?type=t",
+		},
+		{
+			name:          "unversioned API",
+			path:          "/metric?type=t",
+			expectWarning: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := MakeTestRanch([]runtime.Object{newResource("res", "t", common.Free, "", fakeNow)})
+			rr := httptest.NewRecorder()
+			NewBoskosHandler(r).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+			}
+			deprecation := rr.Header().Get(common.DeprecationHeader)
+			if warned := deprecation == common.UnversionedAPIDeprecation; warned != tc.expectWarning {
+				t.Errorf("expected warning %t, got deprecation header %q", tc.expectWarning, deprecation)
+			}
+			if counted := len(r.DeprecatedUsage()) > 0; counted != tc.expectWarning {
+				t.Errorf("expected usage to be counted %t, got %v", tc.expectWarning, r.DeprecatedUsage())
+			}
+		})
+	}
+}
+
+func TestAcquireWithStateAlias(t *testing.T) {
+	testCases := []struct {
+		name          string
+		dest          string
+		expectWarning bool
+	}{
+		{
+			name: "new name",
+			dest: "leased-out",
+		},
+		{
+			name:          "alias",
+			dest:          common.Busy,
+			expectWarning: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := MakeTestRanch(nil)
+			if err := r.ApplyConfig(&common.BoskosConfig{Resources: []common.ResourceEntry{{
+				Type:         "t",
+				State:        common.Free,
+				Names:        []string{"res"},
+				States:       []string{common.Free, common.Dirty, "leased-out"},
+				StateAliases: map[string]string{common.Busy: "leased-out"},
+			}}}); err != nil {
+				t.Fatalf("failed to apply config: %v", err)
+			}
+			req := httptest.NewRequest(http.MethodPost, "/acquire?type=t&state=free&dest="+tc.dest+"&owner=merlin", nil)
+			rr := httptest.NewRecorder()
+			handleAcquire(r).ServeHTTP(rr, req)
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+			}
+			deprecation := rr.Header().Get(common.DeprecationHeader)
+			if warned := deprecation == "state-alias"; warned != tc.expectWarning {
+				t.Errorf("expected warning %t, got deprecation header %q", tc.expectWarning, deprecation)
+			}
+			resource, err := r.Storage.GetResource("res")
+			if err != nil {
+				t.Fatalf("failed to get resource: %v", err)
+			}
+			if resource.Status.State != "leased-out" {
+				t.Errorf("expected the resource to be leased-out, got %s", resource.Status.State)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/ranch"
+)
+
+var cleanupDurationSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "boskos_cleanup_duration_seconds",
+	Help:    "Histogram of the time in seconds janitors report cleaning a resource took, by type and whether the cleanup succeeded.",
+	Buckets: []float64{10, 30, 60, 300, 600, 1200, 1800, 3600, 7200},
+}, []string{"type", "succeeded"})
+
+func init() {
+	prometheus.MustRegister(cleanupDurationSeconds)
+}
+
+func observeCleanupDuration(rtype, dest string, took time.Duration) {
+	succeeded := "true"
+	if dest == common.Dirty {
+		succeeded = "false"
+	}
+	cleanupDurationSeconds.WithLabelValues(rtype, succeeded).Observe(took.Seconds())
+}
+
+//  handleDescribe: Handler for /describe
+//  Method: GET
+// 	URLParams:
+//		Required: name=[string] : name of the resource to describe, or
+//		Required: type=[string] : type of the resources to describe, slowest to clean first
+func handleDescribe(r *ranch.Ranch) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		logrus.WithField("handler", "handleDescribe").Infof("From %v", req.RemoteAddr)
+
+		if req.Method != http.MethodGet {
+			msg := fmt.Sprintf("Method %v, /describe only accepts GET.", req.Method)
+			logrus.Warning(msg)
+			http.Error(res, msg, http.StatusMethodNotAllowed)
+			return
+		}
+
+		name := req.URL.Query().Get("name")
+		rtype := req.URL.Query().Get("type")
+		if (name == "") == (rtype == "") {
+			returnAndLogError(res, badRequestError(fmt.Sprintf("Name: %v, type: %v, exactly one of them must be set in the request.", name, rtype)), "Bad request")
+			return
+		}
+
+		var description interface{}
+		var err error
+		if name != "" {
+			if err := validateIdentifiers(param{"name", name}); err != nil {
+				returnAndLogError(res, err, "Bad request")
+				return
+			}
+			description, err = r.Describe(name)
+		} else {
+			if err := validateIdentifiers(param{"type", rtype}); err != nil {
+				returnAndLogError(res, err, "Bad request")
+				return
+			}
+			description, err = r.DescribeType(rtype)
+		}
+		if err != nil {
+			returnAndLogError(res, err, "Describe failed")
+			return
+		}
+
+		js, err := json.Marshal(description)
+		if err != nil {
+			logrus.WithError(err).Error("Fail to marshal description")
+			http.Error(res, err.Error(), errorToStatus(err))
+			return
+		}
+		res.Header().Set("Content-Type", "application/json")
+		res.Write(js)
+	}
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/ranch"
+)
+
+const (
+	defaultEventsLimit = 100
+	maxEventsLimit     = 1000
+)
+
+//  handleEvents: Handler for /events
+//  Method: GET
+// 	URLParams:
+//		Optional: name=[string] : name of the resource whose events to return
+//		Optional: type=[string] : type of the resources whose events to return
+//		Optional: since=[RFC3339 time] : oldest time of the events
+//		Optional: until=[RFC3339 time] : time the events must predate
+//		Optional: limit=[int] : most events to return, 100 by default and 1000 at most
+//  Returns the archived events of the resources oldest first, as a JSON list.
+//  Owners the caller cannot see are redacted.
+func handleEvents(r *ranch.Ranch) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		logrus.WithField("handler", "handleEvents").Infof("From %v", req.RemoteAddr)
+
+		if req.Method != http.MethodGet {
+			msg := fmt.Sprintf("Method %v, /events only accepts GET.", req.Method)
+			logrus.Warning(msg)
+			http.Error(res, msg, http.StatusMethodNotAllowed)
+			return
+		}
+		query := ranch.EventQuery{
+			Name:  req.URL.Query().Get("name"),
+			Type:  req.URL.Query().Get("type"),
+			Limit: defaultEventsLimit,
+		}
+		if err := validateIdentifiers(param{"name", query.Name}, param{"type", query.Type}); err != nil {
+			returnAndLogError(res, err, "Bad request")
+			return
+		}
+		if query.Type != "" {
+			if err := resolveType(res, req, r, "", &query.Type); err != nil {
+				returnAndLogError(res, err, "Bad request")
+				return
+			}
+		}
+		for _, bound := range []struct {
+			name  string
+			value *time.Time
+		}{
+			{"since", &query.Since},
+			{"until", &query.Until},
+		} {
+			v := req.URL.Query().Get(bound.name)
+			if v == "" {
+				continue
+			}
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				returnAndLogError(res, badRequestError(fmt.Sprintf("invalid %s %q: must be an RFC3339 time", bound.name, v)), "Bad request")
+				return
+			}
+			*bound.value = t
+		}
+		if v := req.URL.Query().Get("limit"); v != "" {
+			limit, err := strconv.Atoi(v)
+			if err != nil || limit <= 0 || limit > maxEventsLimit {
+				returnAndLogError(res, badRequestError(fmt.Sprintf("invalid limit %q: must be an integer between 1 and %d", v, maxEventsLimit)), "Bad request")
+				return
+			}
+			query.Limit = limit
+		}
+
+		events, err := r.Events(query)
+		if err != nil {
+			returnAndLogError(res, err, "Querying the events failed")
+			return
+		}
+		identity := callerIdentity(req)
+		for i := range events {
+			if !identity.CanSeeOwner(events[i].Owner) {
+				events[i].Owner = common.Other
+			}
+		}
+		if events == nil {
+			events = []common.ResourceEvent{}
+		}
+		js, err := json.Marshal(events)
+		if err != nil {
+			logrus.WithError(err).Error("Fail to marshal events")
+			http.Error(res, err.Error(), errorToStatus(err))
+			return
+		}
+		res.Header().Set("Content-Type", "application/json")
+		res.Write(js)
+	}
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/boskos/ranch"
+)
+
+//  handleForceRelease: Handler for /force-release
+//  Method: POST
+// 	URLParams:
+//		Required: name=[string] : name of the resource to release
+//		Optional: owner=[string] : owner to transfer the resource to, the ownership is cleared if unset
+//		Optional: dest=[string] : dest state, dirty by default when clearing the ownership and
+//		                          the current state when transferring it
+//  The caller must be an authenticated admin. Releases the resource regardless
+//  of its current owner, which is recorded in its user data, and returns it.
+func handleForceRelease(r *ranch.Ranch) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		logrus.WithField("handler", "handleForceRelease").Infof("From %v", req.RemoteAddr)
+
+		if req.Method != http.MethodPost {
+			msg := fmt.Sprintf("Method %v, %s only accepts POST.", req.Method, req.URL.Path)
+			logrus.Warning(msg)
+			http.Error(res, msg, http.StatusMethodNotAllowed)
+			return
+		}
+		if requireAdmin(res, req) {
+			return
+		}
+
+		name := req.URL.Query().Get("name")
+		dest := req.URL.Query().Get("dest")
+		owner := req.URL.Query().Get("owner")
+		if name == "" {
+			returnAndLogError(res, badRequestError("name must be set in the request"), "Bad request")
+			return
+		}
+		if err := validateIdentifiers(param{"name", name}, param{"dest", dest}); err != nil {
+			returnAndLogError(res, err, "Bad request")
+			return
+		}
+		if err := validateFreeform(param{"owner", owner}); err != nil {
+			returnAndLogError(res, err, "Bad request")
+			return
+		}
+		if dest != "" {
+			// Errors are left to ForceRelease to report.
+			if resource, _ := r.Storage.GetResource(name); resource != nil {
+				resolveStates(res, req, r, owner, resource.Spec.Type, &dest)
+				if err := validateStates(r, resource.Spec.Type, param{"dest", dest}); err != nil {
+					returnAndLogError(res, err, "Bad request")
+					return
+				}
+			}
+		}
+
+		resource, err := r.ForceRelease(name, dest, owner)
+		if err != nil {
+			returnAndLogError(res, err, fmt.Sprintf("Force release failed: %v", name))
+			return
+		}
+		js, err := json.Marshal(resource.ToResource())
+		if err != nil {
+			logrus.WithError(err).Errorf("Fail to marshal resource %s", name)
+			http.Error(res, err.Error(), errorToStatus(err))
+			return
+		}
+		res.Header().Set("Content-Type", "application/json")
+		res.Write(js)
+	}
+}
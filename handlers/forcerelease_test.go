@@ -0,0 +1,130 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+func TestForceRelease(t *testing.T) {
+	testCases := []struct {
+		name        string
+		username    string
+		password    string
+		method      string
+		query       string
+		expectCode  int
+		expectState string
+		expectOwner string
+	}{
+		{
+			name:        "admin clears the owner",
+			username:    "admin",
+			password:    "admin-password",
+			method:      http.MethodPost,
+			query:       "name=res",
+			expectCode:  http.StatusOK,
+			expectState: common.Dirty,
+		},
+		{
+			name:        "admin transfers the owner",
+			username:    "admin",
+			password:    "admin-password",
+			method:      http.MethodPost,
+			query:       "name=res&owner=operator",
+			expectCode:  http.StatusOK,
+			expectState: common.Busy,
+			expectOwner: "operator",
+		},
+		{
+			name:        "non-admin caller is rejected",
+			username:    "team-b-ci",
+			password:    "team-b-ci-password",
+			method:      http.MethodPost,
+			query:       "name=res",
+			expectCode:  http.StatusUnauthorized,
+			expectState: common.Busy,
+			expectOwner: "dead-job",
+		},
+		{
+			name:        "GET is not allowed",
+			username:    "admin",
+			password:    "admin-password",
+			method:      http.MethodGet,
+			query:       "name=res",
+			expectCode:  http.StatusMethodNotAllowed,
+			expectState: common.Busy,
+			expectOwner: "dead-job",
+		},
+		{
+			name:        "missing name",
+			username:    "admin",
+			password:    "admin-password",
+			method:      http.MethodPost,
+			expectCode:  http.StatusBadRequest,
+			expectState: common.Busy,
+			expectOwner: "dead-job",
+		},
+		{
+			name:        "unknown resource",
+			username:    "admin",
+			password:    "admin-password",
+			method:      http.MethodPost,
+			query:       "name=missing",
+			expectCode:  http.StatusNotFound,
+			expectState: common.Busy,
+			expectOwner: "dead-job",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := MakeTestRanch([]runtime.Object{newResource("res", "t", common.Busy, "dead-job", fakeNow)})
+			handler := makeTestAuthenticator(t).Wrap(NewBoskosHandler(r))
+
+			req := httptest.NewRequest(tc.method, "/force-release?"+tc.query, nil)
+			req.SetBasicAuth(tc.username, tc.password)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			if rr.Code != tc.expectCode {
+				t.Fatalf("expected code %d, got %d: %s", tc.expectCode, rr.Code, rr.Body.String())
+			}
+			if tc.expectCode == http.StatusOK {
+				var resource common.Resource
+				if err := json.Unmarshal(rr.Body.Bytes(), &resource); err != nil {
+					t.Fatalf("failed to unmarshal response: %v", err)
+				}
+				if resource.UserData.ToMap()[common.ForceReleasedFrom] != "dead-job" {
+					t.Errorf("expected the previous owner in the user data, got %v", resource.UserData.ToMap())
+				}
+			}
+			stored, err := r.Storage.GetResource("res")
+			if err != nil {
+				t.Fatalf("failed to get resource: %v", err)
+			}
+			if stored.Status.State != tc.expectState || stored.Status.Owner != tc.expectOwner {
+				t.Errorf("expected %s owned by %q, got %s owned by %q", tc.expectState, tc.expectOwner, stored.Status.State, stored.Status.Owner)
+			}
+		})
+	}
+}
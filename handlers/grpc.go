@@ -0,0 +1,290 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"sigs.k8s.io/boskos/boskospb"
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/crds"
+	"sigs.k8s.io/boskos/ranch"
+)
+
+// grpcCodes maps the HTTP status of the errors to gRPC codes, so both APIs
+// report the errors alike.
+var grpcCodes = map[int]codes.Code{
+	// Acquisitions pending approval are retried like those of exhausted
+	// pools.
+	http.StatusAccepted:              codes.NotFound,
+	http.StatusBadRequest:            codes.InvalidArgument,
+	http.StatusUnauthorized:          codes.PermissionDenied,
+	http.StatusForbidden:             codes.PermissionDenied,
+	http.StatusNotFound:              codes.NotFound,
+	http.StatusConflict:              codes.FailedPrecondition,
+	http.StatusGone:                  codes.FailedPrecondition,
+	http.StatusPreconditionFailed:    codes.FailedPrecondition,
+	http.StatusRequestEntityTooLarge: codes.InvalidArgument,
+	http.StatusLocked:                codes.FailedPrecondition,
+	http.StatusTooManyRequests:       codes.ResourceExhausted,
+	http.StatusServiceUnavailable:    codes.Unavailable,
+}
+
+// errorToCode returns the gRPC code of err.
+func errorToCode(err error) codes.Code {
+	if code, ok := grpcCodes[errorToStatus(err)]; ok {
+		return code
+	}
+	return codes.Internal
+}
+
+func grpcError(err error, msg string) error {
+	logrus.WithError(err).Warning(msg)
+	return status.Error(errorToCode(err), err.Error())
+}
+
+type grpcServer struct {
+	boskospb.UnimplementedBoskosServer
+	ranch *ranch.Ranch
+}
+
+// NewBoskosGRPCServer serves the acquire, release, update, reset and metric
+// operations of the boskos API over gRPC.
+func NewBoskosGRPCServer(r *ranch.Ranch) boskospb.BoskosServer {
+	return &grpcServer{ranch: r}
+}
+
+// resolveType resolves a renamed type to its new name.
+func (s *grpcServer) resolveType(rtype string) (string, error) {
+	resolved, alias, err := s.ranch.ResolveType(rtype)
+	if alias {
+		typeAliasUsage.WithLabelValues(rtype, resolved, strconv.FormatBool(err != nil)).Inc()
+	}
+	return resolved, err
+}
+
+func (s *grpcServer) Acquire(ctx context.Context, req *boskospb.AcquireRequest) (*boskospb.Resource, error) {
+	if req.Type == "" || req.State == "" || req.Dest == "" || req.Owner == "" {
+		return nil, grpcError(badRequestError(fmt.Sprintf("Type: %v, state: %v, dest: %v, owner: %v, all of them must be set in the request.", req.Type, req.State, req.Dest, req.Owner)), "Bad request")
+	}
+	if err := validateIdentifiers(param{"type", req.Type}, param{"state", req.State}, param{"dest", req.Dest}); err != nil {
+		return nil, grpcError(err, "Bad request")
+	}
+	if err := validateFreeform(param{"owner", req.Owner}, param{"request_id", req.RequestId}); err != nil {
+		return nil, grpcError(err, "Bad request")
+	}
+	rtype, err := s.resolveType(req.Type)
+	if err != nil {
+		return nil, grpcError(err, "Acquire failed")
+	}
+	if err := validateStates(s.ranch, rtype, param{"state", req.State}, param{"dest", req.Dest}); err != nil {
+		return nil, grpcError(err, "Bad request")
+	}
+	if err := contextIdentity(ctx).authorize("acquire", rtype); err != nil {
+		return nil, grpcError(err, "Forbidden")
+	}
+	if err := authorizePolicy(s.ranch, "acquire", contextIdentity(ctx), req.Owner, peerAddress(ctx), rtype); err != nil {
+		return nil, grpcError(err, "Forbidden")
+	}
+
+	tenant, err := contextIdentity(ctx).tenantFor(contextTenant(ctx))
+	if err != nil {
+		return nil, grpcError(err, "Bad tenant")
+	}
+
+	resource, createdTime, err := s.ranch.WithContext(ctx).ForTenant(tenant).Acquire(rtype, req.State, req.Dest, req.Owner, req.RequestId)
+	if err != nil {
+		return nil, grpcError(err, "Acquire failed")
+	}
+	logrus.Infof("Resource leased over gRPC: %v", resource.Name)
+	acquireDurationSeconds.WithLabelValues(rtype, req.State, req.Dest, strconv.FormatBool(req.RequestId != "")).Observe(time.Since(createdTime.Time).Seconds())
+	return toPBResource(resource), nil
+}
+
+func (s *grpcServer) Release(ctx context.Context, req *boskospb.ReleaseRequest) (*boskospb.ReleaseResponse, error) {
+	if req.Name == "" || req.Dest == "" || req.Owner == "" {
+		return nil, grpcError(badRequestError(fmt.Sprintf("Name: %v, dest: %v, owner: %v, all of them must be set in the request.", req.Name, req.Dest, req.Owner)), "Bad request")
+	}
+	if err := validateIdentifiers(param{"name", req.Name}, param{"dest", req.Dest}); err != nil {
+		return nil, grpcError(err, "Bad request")
+	}
+	if err := validateFreeform(param{"owner", req.Owner}); err != nil {
+		return nil, grpcError(err, "Bad request")
+	}
+	r := s.ranch.WithContext(ctx)
+	// Errors are left to Release to report.
+	var types []string
+	if resource, _ := r.Storage.GetResource(req.Name); resource != nil {
+		if err := validateStates(s.ranch, resource.Spec.Type, param{"dest", req.Dest}); err != nil {
+			return nil, grpcError(err, "Bad request")
+		}
+		types = append(types, resource.Spec.Type)
+	}
+	if err := contextIdentity(ctx).authorize("release", types...); err != nil {
+		return nil, grpcError(err, "Forbidden")
+	}
+
+	if err := r.Release(req.Name, req.Dest, req.Owner); err != nil {
+		return nil, grpcError(err, fmt.Sprintf("Done failed: %v - %v (from %v)", req.Name, req.Dest, req.Owner))
+	}
+	return &boskospb.ReleaseResponse{}, nil
+}
+
+func (s *grpcServer) Update(ctx context.Context, req *boskospb.UpdateRequest) (*boskospb.UpdateResponse, error) {
+	if req.Name == "" || req.Owner == "" || req.State == "" {
+		return nil, grpcError(badRequestError(fmt.Sprintf("Name: %v, owner: %v, state : %v, all of them must be set in the request.", req.Name, req.Owner, req.State)), "Bad request")
+	}
+	if err := validateIdentifiers(param{"name", req.Name}, param{"state", req.State}); err != nil {
+		return nil, grpcError(err, "Bad request")
+	}
+	if err := validateFreeform(param{"owner", req.Owner}); err != nil {
+		return nil, grpcError(err, "Bad request")
+	}
+	r := s.ranch.WithContext(ctx)
+	var types []string
+	if resource, _ := r.Storage.GetResource(req.Name); resource != nil {
+		types = append(types, resource.Spec.Type)
+	}
+	if err := contextIdentity(ctx).authorize("update", types...); err != nil {
+		return nil, grpcError(err, "Forbidden")
+	}
+
+	if err := r.Update(req.Name, req.Owner, req.State, common.UserDataFromMap(req.UserData)); err != nil {
+		return nil, grpcError(err, fmt.Sprintf("Update failed: %v - %v (%v)", req.Name, req.State, req.Owner))
+	}
+	return &boskospb.UpdateResponse{}, nil
+}
+
+func (s *grpcServer) Reset(ctx context.Context, req *boskospb.ResetRequest) (*boskospb.ResetResponse, error) {
+	if req.Type == "" || req.State == "" || req.Dest == "" {
+		return nil, grpcError(badRequestError(fmt.Sprintf("Type: %v, state: %v, dest: %v, all of them must be set in the request.", req.Type, req.State, req.Dest)), "Bad request")
+	}
+	if err := validateIdentifiers(param{"type", req.Type}, param{"state", req.State}, param{"dest", req.Dest}); err != nil {
+		return nil, grpcError(err, "Bad request")
+	}
+	if err := validateStates(s.ranch, req.Type, param{"state", req.State}, param{"dest", req.Dest}); err != nil {
+		return nil, grpcError(err, "Bad request")
+	}
+	expire := time.Duration(req.ExpireSeconds) * time.Second
+	if err := validateExpire(expire); err != nil {
+		return nil, grpcError(err, "Bad request")
+	}
+	if err := contextIdentity(ctx).authorize("reset", req.Type); err != nil {
+		return nil, grpcError(err, "Forbidden")
+	}
+	if err := authorizePolicy(s.ranch, "reset", contextIdentity(ctx), "", peerAddress(ctx), req.Type); err != nil {
+		return nil, grpcError(err, "Forbidden")
+	}
+
+	tenant, err := contextIdentity(ctx).tenantFor(contextTenant(ctx))
+	if err != nil {
+		return nil, grpcError(err, "Bad tenant")
+	}
+
+	owners, err := s.ranch.WithContext(ctx).ForTenant(tenant).Reset(req.Type, req.State, expire, req.Dest)
+	if err != nil {
+		return nil, grpcError(err, "could not reset states")
+	}
+	return &boskospb.ResetResponse{Owners: owners}, nil
+}
+
+func (s *grpcServer) Metric(ctx context.Context, req *boskospb.MetricRequest) (*boskospb.MetricResponse, error) {
+	if req.Type == "" {
+		return nil, grpcError(badRequestError("Type must be set in the request."), "Bad request")
+	}
+	if err := validateIdentifiers(param{"type", req.Type}); err != nil {
+		return nil, grpcError(err, "Bad request")
+	}
+	rtype, err := s.resolveType(req.Type)
+	if err != nil {
+		return nil, grpcError(err, "Metric failed")
+	}
+	if err := contextIdentity(ctx).authorize("metric", rtype); err != nil {
+		return nil, grpcError(err, "Forbidden")
+	}
+
+	metric, err := s.ranch.WithContext(ctx).Metric(rtype)
+	if err != nil {
+		return nil, grpcError(err, fmt.Sprintf("Metric for %s failed", rtype))
+	}
+	metric = filterMetric(contextIdentity(ctx), metric)
+	return &boskospb.MetricResponse{Type: metric.Type, Current: toPBCounts(metric.Current), Owners: toPBCounts(metric.Owners)}, nil
+}
+
+// contextTenant returns the tenant named by the metadata of a call, like the
+// tenant header of HTTP requests.
+func contextTenant(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(common.TenantHeader); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func toPBResource(res *crds.ResourceObject) *boskospb.Resource {
+	return &boskospb.Resource{
+		Name:              res.Name,
+		Type:              res.Spec.Type,
+		State:             res.Status.State,
+		Owner:             res.Status.Owner,
+		LastUpdateSeconds: res.Status.LastUpdate.Unix(),
+		UserData:          res.Status.UserData,
+	}
+}
+
+func toPBCounts(counts map[string]int) map[string]int64 {
+	pb := make(map[string]int64, len(counts))
+	for k, v := range counts {
+		pb[k] = int64(v)
+	}
+	return pb
+}
+
+// UnaryServerInterceptor authenticates the calls to the gRPC API with the
+// basic auth credentials or the bearer token of their authorization metadata,
+// like Wrap does for HTTP requests.
+func (a *Authenticator) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		header := http.Header{"Authorization": md.Get("authorization")}
+		if signed := md.Get(common.ForwardedIdentityHeader); len(signed) > 0 {
+			header.Set(common.ForwardedIdentityHeader, signed[0])
+		}
+		identity, err := a.authenticate(&http.Request{Header: header})
+		if err != nil {
+			logrus.WithError(err).Warningf("Rejected call to %s", info.FullMethod)
+			return nil, status.Error(codes.Unauthenticated, "invalid credentials")
+		}
+		if identity.Name == "" && a.requiresAuthentication(strings.ToLower(path.Base(info.FullMethod))) {
+			logrus.Warningf("Rejected anonymous call to %s", info.FullMethod)
+			return nil, status.Errorf(codes.Unauthenticated, "%s requires an authenticated caller", info.FullMethod)
+		}
+		return handler(context.WithValue(ctx, identityContextKey{}, identity), req)
+	}
+}
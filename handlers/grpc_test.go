@@ -0,0 +1,108 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"sigs.k8s.io/boskos/boskospb"
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/ranch"
+)
+
+func TestErrorToCode(t *testing.T) {
+	testCases := []struct {
+		err      error
+		expected codes.Code
+	}{
+		{err: &ranch.OwnerNotMatch{}, expected: codes.PermissionDenied},
+		{err: &ranch.ResourceNotFound{}, expected: codes.NotFound},
+		{err: &ranch.StateNotMatch{}, expected: codes.FailedPrecondition},
+		{err: &ranch.QuotaExceeded{}, expected: codes.ResourceExhausted},
+		{err: &ranch.ReadOnly{}, expected: codes.Unavailable},
+		{err: badRequestError("bad"), expected: codes.InvalidArgument},
+		{err: fmt.Errorf("unexpected"), expected: codes.Internal},
+	}
+	for _, tc := range testCases {
+		if got := errorToCode(tc.err); got != tc.expected {
+			t.Errorf("%T: expected code %v, got %v", tc.err, tc.expected, got)
+		}
+	}
+}
+
+func TestGRPCServer(t *testing.T) {
+	r := MakeTestRanch([]runtime.Object{
+		newResource("res", "t", common.Free, "", fakeNow),
+		newResource("stale", "t", common.Busy, "owner", metav1.NewTime(fakeNow.Add(-time.Hour))),
+	})
+	// Resets measure staleness on the clock the resources are updated with.
+	r.SetClock(func() metav1.Time { return fakeNow })
+	s := NewBoskosGRPCServer(r)
+	ctx := context.Background()
+
+	if _, err := s.Acquire(ctx, &boskospb.AcquireRequest{Type: "t", State: common.Free, Dest: common.Busy}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected an acquire without owner to be invalid, got %v", err)
+	}
+	res, err := s.Acquire(ctx, &boskospb.AcquireRequest{Type: "t", State: common.Free, Dest: common.Busy, Owner: "owner"})
+	if err != nil {
+		t.Fatalf("failed to acquire: %v", err)
+	}
+	if res.Name != "res" || res.State != common.Busy || res.Owner != "owner" {
+		t.Errorf("expected res to be leased by owner, got %+v", res)
+	}
+	if _, err := s.Acquire(ctx, &boskospb.AcquireRequest{Type: "t", State: common.Free, Dest: common.Busy, Owner: "owner"}); status.Code(err) != codes.NotFound {
+		t.Errorf("expected no free resource to be found, got %v", err)
+	}
+
+	if _, err := s.Update(ctx, &boskospb.UpdateRequest{Name: "res", Owner: "owner", State: common.Busy, UserData: map[string]string{"key": "value"}}); err != nil {
+		t.Fatalf("failed to update: %v", err)
+	}
+	if _, err := s.Release(ctx, &boskospb.ReleaseRequest{Name: "res", Dest: common.Dirty, Owner: "other"}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("expected a release by another owner to be denied, got %v", err)
+	}
+
+	metric, err := s.Metric(ctx, &boskospb.MetricRequest{Type: "t"})
+	if err != nil {
+		t.Fatalf("failed to get metric: %v", err)
+	}
+	if metric.Current[common.Busy] != 2 || metric.Owners["owner"] != 2 {
+		t.Errorf("expected two busy resources of owner, got %+v", metric)
+	}
+
+	reset, err := s.Reset(ctx, &boskospb.ResetRequest{Type: "t", State: common.Busy, ExpireSeconds: 600, Dest: common.Dirty})
+	if err != nil {
+		t.Fatalf("failed to reset: %v", err)
+	}
+	if len(reset.Owners) != 1 || reset.Owners["stale"] != "owner" {
+		t.Errorf("expected only stale to be reset, got %v", reset.Owners)
+	}
+	resource, err := r.Storage.GetResource("res")
+	if err != nil {
+		t.Fatalf("failed to get resource: %v", err)
+	}
+	if resource.Status.UserData["key"] != "value" {
+		t.Errorf("expected res to have its user data updated, got %v", resource.Status.UserData)
+	}
+}
@@ -20,16 +20,21 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"io"
+	"math"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
 	"k8s.io/test-infra/prow/simplifypath"
 	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/crds"
 	"sigs.k8s.io/boskos/ranch"
 )
 
@@ -43,26 +48,111 @@ func NewBoskosSimplifier() simplifypath.Simplifier {
 	return simplifypath.NewSimplifier(l("", // shadow element mimicing the root
 		l("acquire"),
 		l("acquirebystate"),
+		l("acquirebatch"),
 		l("release"),
 		l("reset"),
 		l("update"),
 		l("metric"),
+		l("queue"),
+		l("hold"),
+		l("confirm"),
+		l("claimexpired"),
+		l("lameduck"),
+		l("cleanupbreaker"),
+		l("demand"),
+		l("regionusage"),
+		l("book"),
+		l("reserve"),
+		l("calendar"),
+		l("cancelbooking"),
+		l("shards"),
+		l("lock"),
+		l("unlock"),
+		l("import"),
+		l("describe"),
+		l("notes"),
+		l("readonly"),
+		l("watch"),
+		l("events"),
+		l("holdings"),
+		l("slareport"),
+		l("approvals"),
+		l("force-release"),
+		l("admin", l("reload"), l("approve"), l("deny")),
 	))
 }
 
 //NewBoskosHandler constructs the boskos handler.
 func NewBoskosHandler(r *ranch.Ranch) *http.ServeMux {
 	mux := http.NewServeMux()
-	mux.Handle("/", handleDefault(r))
-	mux.Handle("/acquire", handleAcquire(r))
-	mux.Handle("/acquirebystate", handleAcquireByState(r))
-	mux.Handle("/release", handleRelease(r))
-	mux.Handle("/reset", handleReset(r))
-	mux.Handle("/update", handleUpdate(r))
-	mux.Handle("/metric", handleMetric(r))
+	// Every endpoint but the toggle of the read-only mode is frozen by it.
+	// Scoped tokens may only call the endpoints named by their verbs. Each
+	// endpoint is also served under /v2, returning its errors as JSON, and the
+	// requests to the unversioned endpoints are flagged as deprecated.
+	serve := func(pattern string, h http.Handler) {
+		mux.Handle(pattern, withAPIVersion(withUnversionedAPIWarning(r, h)))
+		mux.Handle(v2Prefix+pattern, withAPIVersion(withStructuredErrors(h)))
+	}
+	handle := func(pattern string, newHandler func(*ranch.Ranch) http.HandlerFunc) {
+		serve(pattern, rejectWritesInReadOnly(r, withScope(r, strings.TrimPrefix(pattern, "/"), withRequestContext(r, newHandler))))
+	}
+	handle("/", handleDefault)
+	handle("/acquire", handleAcquire)
+	handle("/acquirebystate", handleAcquireByState)
+	handle("/acquirebatch", handleAcquireBatch)
+	handle("/release", handleRelease)
+	handle("/reset", handleReset)
+	handle("/update", handleUpdate)
+	handle("/metric", handleMetric)
+	handle("/queue", handleQueue)
+	handle("/hold", handleHold)
+	handle("/confirm", handleConfirm)
+	handle("/claimexpired", handleClaimExpired)
+	handle("/lameduck", handleLameDuck)
+	handle("/cleanupbreaker", handleCleanupBreaker)
+	handle("/demand", handleDemand)
+	handle("/regionusage", handleRegionUsage)
+	handle("/book", handleBook)
+	handle("/reserve", handleReserve)
+	handle("/calendar", handleCalendar)
+	handle("/cancelbooking", handleCancelBooking)
+	handle("/shards", handleShards)
+	handle("/lock", handleLock)
+	handle("/unlock", handleUnlock)
+	handle("/import", handleImport)
+	handle("/describe", handleDescribe)
+	handle("/notes", handleNotes)
+	handle("/watch", handleWatch)
+	handle("/events", handleEvents)
+	handle("/holdings", handleHoldings)
+	handle("/slareport", handleSLAReport)
+	handle("/admin/reload", handleReload)
+	handle("/force-release", handleForceRelease)
+	handle("/approvals", handleApprovals)
+	handle("/admin/approve", handleApprove(true))
+	handle("/admin/deny", handleApprove(false))
+	serve("/readonly", withScope(r, "readonly", withRequestContext(r, handleReadOnly)))
 	return mux
 }
 
+// withRequestContext serves each request with a view of r making the calls to
+// the storage with the context of the request, so they are abandoned once the
+// client gives up on it, and acquiring on behalf of the tenant of the request.
+func withRequestContext(r *ranch.Ranch, newHandler func(*ranch.Ranch) http.HandlerFunc) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		tenant, err := callerIdentity(req).tenantFor(req.Header.Get(common.TenantHeader))
+		if err != nil {
+			returnAndLogError(res, err, "Bad tenant")
+			return
+		}
+		newHandler(r.WithContext(req.Context()).ForTenant(tenant)).ServeHTTP(res, req)
+	}
+}
+
+// lameDuckRetryAfter is how long clients are asked to wait before retrying
+// an acquisition rejected in lame-duck mode.
+const lameDuckRetryAfter = 30 * time.Second
+
 type badRequestError string
 
 func (bre badRequestError) Error() string { return string(bre) }
@@ -80,9 +170,105 @@ func errorToStatus(err error) int {
 		return http.StatusNotFound
 	case *ranch.StateNotMatch:
 		return http.StatusConflict
+	case *ranch.QuotaExceeded:
+		return http.StatusTooManyRequests
+	case *ranch.WaitEstimateExceeded:
+		return http.StatusPreconditionFailed
+	case *ranch.HoldExpired:
+		return http.StatusGone
+	case *ranch.LameDuck:
+		return http.StatusServiceUnavailable
+	case *ranch.ReadOnly:
+		return http.StatusServiceUnavailable
+	case *ranch.NotLeader:
+		return http.StatusServiceUnavailable
+	case *ranch.CleanupPaused:
+		return http.StatusLocked
+	case *ranch.TimeSliced:
+		return http.StatusBadRequest
+	case *ranch.BookingNotFound:
+		return http.StatusNotFound
+	case *ranch.TransitionDenied:
+		return http.StatusForbidden
+	case *ranch.TransitionNotAllowed:
+		return http.StatusUnprocessableEntity
+	case *ranch.ApprovalPending:
+		return http.StatusAccepted
+	case *ranch.ApprovalDenied:
+		return http.StatusForbidden
+	case *ranch.ApprovalBacklogFull:
+		return http.StatusTooManyRequests
+	case *ranch.ApprovalNotFound:
+		return http.StatusNotFound
+	case *ranch.ApprovalNotPending:
+		return http.StatusConflict
+	case *ranch.ShardNotAssigned:
+		return http.StatusConflict
+	case *ranch.LockHeld:
+		return http.StatusConflict
+	case *ranch.TypeRenamed:
+		return http.StatusGone
+	case *ranch.RegionNotFound:
+		return http.StatusNotFound
+	case *ranch.TenantMismatch:
+		return http.StatusForbidden
+	case *ranch.PolicyDenied:
+		return http.StatusForbidden
+	case *ranch.UserDataTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case *ranch.UnknownSLAWindow:
+		return http.StatusBadRequest
+	case *ranch.EventArchiveDisabled:
+		return http.StatusNotFound
+	case forbiddenTenantError:
+		return http.StatusForbidden
+	case forbiddenScopeError:
+		return http.StatusForbidden
+	case tokenNotFoundError:
+		return http.StatusNotFound
 	case badRequestError:
 		return http.StatusBadRequest
+	case requestEntityTooLargeError:
+		return http.StatusRequestEntityTooLarge
+	}
+}
+
+// setHealthAdvisory sets the health advisory header if rType is degraded.
+func setHealthAdvisory(res http.ResponseWriter, r *ranch.Ranch, rType string) {
+	advisory := r.Health(rType)
+	if advisory == nil {
+		return
+	}
+	js, err := json.Marshal(advisory)
+	if err != nil {
+		logrus.WithError(err).Error("Fail to marshal health advisory")
+		return
+	}
+	res.Header().Set(common.HealthAdvisoryHeader, string(js))
+}
+
+// setLoadAdvice sets the load advice of rType in state on a failed acquire
+// response, along with the Retry-After header clients back off by.
+func setLoadAdvice(res http.ResponseWriter, r *ranch.Ranch, rType, state string) {
+	advice := r.LoadAdvice(rType, state)
+	if advice == nil {
+		return
+	}
+	js, err := json.Marshal(advice)
+	if err != nil {
+		logrus.WithError(err).Error("Fail to marshal load advice")
+		return
 	}
+	res.Header().Set(common.LoadAdviceHeader, string(js))
+	res.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(advice.RetryAfterSeconds))))
+}
+
+// toLeasedResource converts a resource handed to its owner for the API, with
+// the access details of its type.
+func toLeasedResource(r *ranch.Ranch, resource *crds.ResourceObject) common.Resource {
+	apiResource := resource.ToResource()
+	apiResource.Access = r.Access(resource)
+	return apiResource
 }
 
 //  handleDefault: Handler for /, always pass with 200
@@ -103,10 +289,15 @@ var (
 		"dest",
 		"has_request_id",
 	})
+	fallbackAcquisitions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "boskos_fallback_acquisitions_total",
+		Help: "Number of resources of a fallback type acquired because the requested type was exhausted, by requested and fallback type.",
+	}, []string{"type", "fallback"})
 )
 
 func init() {
 	prometheus.MustRegister(acquireDurationSeconds)
+	prometheus.MustRegister(fallbackAcquisitions)
 }
 
 //  handleAcquire: Handler for /acquire
@@ -116,6 +307,15 @@ func init() {
 //		Required: state=[string] : current state of the requested resource
 //		Required: dest=[string] : destination state of the requested resource
 //		Required: owner=[string] : requester of the resource
+//		Optional: request_id=[string] : request id to keep the priority rank
+//		Optional: max_wait=[duration] : fail fast if the estimated wait is longer
+//		Optional: shard_group=[string] : only consider the resources of the shard of owner in the group
+//		Optional: fallback=[bool] : acquire a resource of the fallback type of the type once it is exhausted
+//		Optional: priority=[int] : requests of a higher priority are served first, defaults to 0
+//		Optional: lease=[duration] : release the resource to dirty once the lease expires, even without a release
+//		Optional: selector=[string] : only consider the resources whose user data match the label selector, e.g. region=us-east-1,size=large
+//		Optional: flavor=[string] : only consider the resources of this flavor of the type
+//		Optional: wait=[duration] : hold the request open for up to this long until a resource is available, at most 5m
 func handleAcquire(r *ranch.Ranch) http.HandlerFunc {
 	return func(res http.ResponseWriter, req *http.Request) {
 		logrus.WithField("handler", "handleStart").Infof("From %v", req.RemoteAddr)
@@ -133,21 +333,175 @@ func handleAcquire(r *ranch.Ranch) http.HandlerFunc {
 		dest := req.URL.Query().Get("dest")
 		owner := req.URL.Query().Get("owner")
 		requestID := req.URL.Query().Get("request_id")
+		shardGroup := req.URL.Query().Get("shard_group")
 		if rtype == "" || state == "" || dest == "" || owner == "" {
 			bre := badRequestError(fmt.Sprintf("Type: %v, state: %v, dest: %v, owner: %v, all of them must be set in the request.", rtype, state, dest, owner))
 			returnAndLogError(res, bre, "Bad request")
 			return
 		}
+		if err := validateIdentifiers(param{"type", rtype}, param{"state", state}, param{"dest", dest}); err != nil {
+			returnAndLogError(res, err, "Bad request")
+			return
+		}
+		if err := validateFreeform(param{"owner", owner}, param{"request_id", requestID}); err != nil {
+			returnAndLogError(res, err, "Bad request")
+			return
+		}
+		if shardGroup != "" {
+			if err := validateIdentifiers(param{"shard_group", shardGroup}); err != nil {
+				returnAndLogError(res, err, "Bad request")
+				return
+			}
+			if requestID != "" || req.URL.Query().Get("max_wait") != "" || req.URL.Query().Get("priority") != "" {
+				returnAndLogError(res, badRequestError("shard_group cannot be combined with request_id, max_wait or priority: sharded requests are not queued."), "Bad request")
+				return
+			}
+		}
+		var fallback bool
+		if v := req.URL.Query().Get("fallback"); v != "" {
+			var err error
+			if fallback, err = strconv.ParseBool(v); err != nil {
+				returnAndLogError(res, badRequestError(fmt.Sprintf("invalid fallback %q: must be a boolean", v)), "Bad request")
+				return
+			}
+			if fallback && shardGroup != "" {
+				returnAndLogError(res, badRequestError("shard_group cannot be combined with fallback: shards only split a single type."), "Bad request")
+				return
+			}
+		}
+		var priority int
+		if v := req.URL.Query().Get("priority"); v != "" {
+			var err error
+			if priority, err = strconv.Atoi(v); err != nil {
+				returnAndLogError(res, badRequestError(fmt.Sprintf("invalid priority %q: must be an integer", v)), "Bad request")
+				return
+			}
+		}
+		var maxWait time.Duration
+		if v := req.URL.Query().Get("max_wait"); v != "" {
+			var err error
+			if maxWait, err = time.ParseDuration(v); err != nil || maxWait <= 0 {
+				returnAndLogError(res, badRequestError(fmt.Sprintf("invalid max_wait %q: must be a positive duration", v)), "Bad request")
+				return
+			}
+		}
+		var selector labels.Selector
+		if v := req.URL.Query().Get("selector"); v != "" {
+			var err error
+			if selector, err = labels.Parse(v); err != nil {
+				returnAndLogError(res, badRequestError(fmt.Sprintf("invalid selector %q: %v", v, err)), "Bad request")
+				return
+			}
+			if shardGroup != "" || fallback {
+				returnAndLogError(res, badRequestError("selector cannot be combined with shard_group or fallback."), "Bad request")
+				return
+			}
+		}
+		flavor := req.URL.Query().Get("flavor")
+		if flavor != "" {
+			if err := validateIdentifiers(param{"flavor", flavor}); err != nil {
+				returnAndLogError(res, err, "Bad request")
+				return
+			}
+			if shardGroup != "" || fallback {
+				returnAndLogError(res, badRequestError("flavor cannot be combined with shard_group or fallback."), "Bad request")
+				return
+			}
+			requirement, err := labels.NewRequirement(common.FlavorUserDataKey, selection.Equals, []string{flavor})
+			if err != nil {
+				returnAndLogError(res, badRequestError(fmt.Sprintf("invalid flavor %q: %v", flavor, err)), "Bad request")
+				return
+			}
+			if selector == nil {
+				selector = labels.NewSelector()
+			}
+			selector = selector.Add(*requirement)
+		}
+		var wait time.Duration
+		if v := req.URL.Query().Get("wait"); v != "" {
+			var err error
+			if wait, err = time.ParseDuration(v); err != nil || wait <= 0 {
+				returnAndLogError(res, badRequestError(fmt.Sprintf("invalid wait %q: must be a positive duration", v)), "Bad request")
+				return
+			}
+			if shardGroup != "" || fallback {
+				returnAndLogError(res, badRequestError("wait cannot be combined with shard_group or fallback."), "Bad request")
+				return
+			}
+		}
+		var lease time.Duration
+		if v := req.URL.Query().Get("lease"); v != "" {
+			var err error
+			if lease, err = time.ParseDuration(v); err != nil || lease <= 0 {
+				returnAndLogError(res, badRequestError(fmt.Sprintf("invalid lease %q: must be a positive duration", v)), "Bad request")
+				return
+			}
+			if shardGroup != "" {
+				returnAndLogError(res, badRequestError("shard_group cannot be combined with lease: shards are for janitors, which release what they clean."), "Bad request")
+				return
+			}
+		}
+
+		if err := resolveType(res, req, r, owner, &rtype); err != nil {
+			returnAndLogError(res, err, "Acquire failed")
+			return
+		}
+
+		resolveStates(res, req, r, owner, rtype, &state, &dest)
+		if err := validateStates(r, rtype, param{"state", state}, param{"dest", dest}); err != nil {
+			returnAndLogError(res, err, "Bad request")
+			return
+		}
+		if err := validateFlavor(r, rtype, selector, flavor != ""); err != nil {
+			returnAndLogError(res, err, "Bad request")
+			return
+		}
+		if err := authorizePolicy(r, "acquire", callerIdentity(req), owner, req.RemoteAddr, rtype); err != nil {
+			returnAndLogError(res, err, "Forbidden")
+			return
+		}
 
 		logrus.Infof("Request for a %v %v from %v, dest %v", state, rtype, owner, dest)
 
-		resource, createdTime, err := r.Acquire(rtype, state, dest, owner, requestID)
+		var resource *crds.ResourceObject
+		var createdTime metav1.Time
+		var err error
+		if shardGroup != "" {
+			resource, createdTime, err = r.AcquireInShard(rtype, state, dest, owner, shardGroup)
+		} else if fallback {
+			resource, createdTime, err = r.AcquireWithFallback(rtype, state, dest, owner, requestID, priority, maxWait, lease)
+			if err == nil && resource.Spec.Type != rtype {
+				fallbackAcquisitions.WithLabelValues(rtype, resource.Spec.Type).Inc()
+			}
+		} else if wait > 0 {
+			resource, createdTime, err = r.AcquireWait(req.Context(), rtype, state, dest, owner, requestID, selector, priority, maxWait, lease, wait)
+		} else if selector != nil {
+			resource, createdTime, err = r.AcquireWithSelector(rtype, state, dest, owner, requestID, selector, priority, maxWait, lease)
+		} else {
+			resource, createdTime, err = r.AcquireWithLease(rtype, state, dest, owner, requestID, priority, maxWait, lease)
+		}
+		setHealthAdvisory(res, r, rtype)
 		if err != nil {
+			if wait, ok := err.(*ranch.WaitEstimateExceeded); ok {
+				logrus.WithError(err).Debug("Acquire failed fast")
+				res.Header().Set("Content-Type", "application/json")
+				res.WriteHeader(errorToStatus(err))
+				if err := json.NewEncoder(res).Encode(wait.ToWaitEstimate()); err != nil {
+					logrus.WithError(err).Error("failed to write response")
+				}
+				return
+			}
+			if notFound, ok := err.(*ranch.ResourceNotFound); ok {
+				if estimate, ok := notFound.EstimatedWait(); ok {
+					res.Header().Set(common.EstimatedWaitHeader, strconv.FormatFloat(estimate.Seconds(), 'f', 0, 64))
+				}
+				setLoadAdvice(res, r, rtype, state)
+			}
 			returnAndLogError(res, err, "Acquire failed")
 			return
 		}
 
-		resJSON, err := json.Marshal(resource.ToResource())
+		resJSON, err := json.Marshal(toLeasedResource(r, resource))
 		if err != nil {
 			logrus.WithError(err).Errorf("json.Marshal failed: %v, resource will be released", resource)
 			http.Error(res, err.Error(), errorToStatus(err))
@@ -174,6 +528,7 @@ func handleAcquire(r *ranch.Ranch) http.HandlerFunc {
 //		Required: dest=[string]  : destination state of the requested resource
 //		Required: owner=[string] : requester of the resource
 //		Required: names=[string] : expected resources names
+//		Optional: request_id=[string] : request id to wait in line for the same names
 func handleAcquireByState(r *ranch.Ranch) http.HandlerFunc {
 	return func(res http.ResponseWriter, req *http.Request) {
 		logrus.WithField("handler", "handleStart").Infof("From %v", req.RemoteAddr)
@@ -190,6 +545,7 @@ func handleAcquireByState(r *ranch.Ranch) http.HandlerFunc {
 		dest := req.URL.Query().Get("dest")
 		owner := req.URL.Query().Get("owner")
 		names := req.URL.Query().Get("names")
+		requestID := req.URL.Query().Get("request_id")
 		if state == "" || dest == "" || owner == "" || names == "" {
 			msg := fmt.Sprintf(
 				"state: %v, dest: %v, owner: %v, names: %v - all of them must be set in the request.",
@@ -199,10 +555,37 @@ func handleAcquireByState(r *ranch.Ranch) http.HandlerFunc {
 			return
 		}
 		rNames := strings.Split(names, ",")
+		if len(rNames) > maxNamesPerRequest {
+			returnAndLogError(res, badRequestError(fmt.Sprintf("no more than %d names may be requested at once", maxNamesPerRequest)), "Bad request")
+			return
+		}
+		params := []param{{"state", state}, {"dest", dest}}
+		for _, name := range rNames {
+			params = append(params, param{"names", name})
+		}
+		if err := validateIdentifiers(params...); err != nil {
+			returnAndLogError(res, err, "Bad request")
+			return
+		}
+		if err := validateFreeform(param{"owner", owner}, param{"request_id", requestID}); err != nil {
+			returnAndLogError(res, err, "Bad request")
+			return
+		}
+		// Errors are left to AcquireByState to report.
+		var types []string
+		for _, name := range rNames {
+			if resource, _ := r.Storage.GetResource(name); resource != nil {
+				types = append(types, resource.Spec.Type)
+			}
+		}
+		if err := authorizePolicy(r, "acquire", callerIdentity(req), owner, req.RemoteAddr, types...); err != nil {
+			returnAndLogError(res, err, "Forbidden")
+			return
+		}
 		logrus.Infof("Request resources %s at state %v from %v, to state %v",
 			strings.Join(rNames, ", "), state, owner, dest)
 
-		resources, err := r.AcquireByState(state, dest, owner, rNames)
+		resources, err := r.AcquireByStateWithPriority(state, dest, owner, rNames, requestID)
 
 		if err != nil {
 			returnAndLogError(res, err, "AcquireByState")
@@ -211,7 +594,7 @@ func handleAcquireByState(r *ranch.Ranch) http.HandlerFunc {
 
 		var apiResources []common.Resource
 		for _, resource := range resources {
-			apiResources = append(apiResources, resource.ToResource())
+			apiResources = append(apiResources, toLeasedResource(r, resource))
 		}
 
 		resBytes := new(bytes.Buffer)
@@ -232,12 +615,127 @@ func handleAcquireByState(r *ranch.Ranch) http.HandlerFunc {
 	}
 }
 
+//  handleAcquireBatch: Handler for /acquirebatch
+//  Method: POST
+// 	URLParams:
+//		Required: types=[string] : comma separated types to acquire, each optionally followed by :count, e.g. gcp-project:2,aws-account
+//		Required: state=[string] : current state of the requested resources
+//		Required: dest=[string]  : destination state of the requested resources
+//		Required: owner=[string] : requester of the resources
+//		Optional: request_id=[string] : request id to wait in line for every type
+func handleAcquireBatch(r *ranch.Ranch) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		logrus.WithField("handler", "handleAcquireBatch").Infof("From %v", req.RemoteAddr)
+
+		if req.Method != http.MethodPost {
+			msg := fmt.Sprintf("Method %v, /acquirebatch only accepts POST.", req.Method)
+			logrus.Warning(msg)
+			http.Error(res, msg, http.StatusMethodNotAllowed)
+			return
+		}
+
+		types := req.URL.Query().Get("types")
+		state := req.URL.Query().Get("state")
+		dest := req.URL.Query().Get("dest")
+		owner := req.URL.Query().Get("owner")
+		requestID := req.URL.Query().Get("request_id")
+		if types == "" || state == "" || dest == "" || owner == "" {
+			returnAndLogError(res, badRequestError(fmt.Sprintf(
+				"types: %v, state: %v, dest: %v, owner: %v - all of them must be set in the request.",
+				types, state, dest, owner)), "Bad request")
+			return
+		}
+		needs, err := parseResourceNeeds(types)
+		if err != nil {
+			returnAndLogError(res, err, "Bad request")
+			return
+		}
+		params := []param{{"state", state}, {"dest", dest}}
+		total := 0
+		for rtype, count := range needs {
+			params = append(params, param{"types", rtype})
+			total += count
+		}
+		if total > maxNamesPerRequest {
+			returnAndLogError(res, badRequestError(fmt.Sprintf("no more than %d resources may be requested at once", maxNamesPerRequest)), "Bad request")
+			return
+		}
+		if err := validateIdentifiers(params...); err != nil {
+			returnAndLogError(res, err, "Bad request")
+			return
+		}
+		if err := validateFreeform(param{"owner", owner}, param{"request_id", requestID}); err != nil {
+			returnAndLogError(res, err, "Bad request")
+			return
+		}
+		var rTypes []string
+		for rtype := range needs {
+			rTypes = append(rTypes, rtype)
+		}
+		sort.Strings(rTypes)
+		if err := authorizePolicy(r, "acquire", callerIdentity(req), owner, req.RemoteAddr, rTypes...); err != nil {
+			returnAndLogError(res, err, "Forbidden")
+			return
+		}
+		logrus.Infof("Request a batch of resources %s at state %v from %v, to state %v", types, state, owner, dest)
+
+		resources, err := r.AcquireBatch(needs, state, dest, owner, requestID)
+		if err != nil {
+			returnAndLogError(res, err, "AcquireBatch")
+			return
+		}
+
+		var apiResources []common.Resource
+		for _, resource := range resources {
+			apiResources = append(apiResources, toLeasedResource(r, resource))
+		}
+		resBytes := new(bytes.Buffer)
+		if err := json.NewEncoder(resBytes).Encode(apiResources); err != nil {
+			logrus.WithError(err).Errorf("json.Marshal failed: %v, resources will be released", apiResources)
+			http.Error(res, err.Error(), errorToStatus(err))
+			for _, resource := range resources {
+				if err := r.Release(resource.Name, state, owner); err != nil {
+					logrus.WithError(err).Warningf("unable to release resource %s", resource.Name)
+				}
+			}
+			return
+		}
+		logrus.Infof("Resources leased: %v", resBytes.String())
+		fmt.Fprint(res, resBytes.String())
+	}
+}
+
+// parseResourceNeeds parses a comma separated list of types, each optionally
+// followed by :count.
+func parseResourceNeeds(types string) (common.ResourceNeeds, error) {
+	needs := common.ResourceNeeds{}
+	for _, need := range strings.Split(types, ",") {
+		rtype, count := need, 1
+		if idx := strings.LastIndex(need, ":"); idx >= 0 {
+			var err error
+			rtype = need[:idx]
+			if count, err = strconv.Atoi(need[idx+1:]); err != nil || count < 1 {
+				return nil, badRequestError(fmt.Sprintf("invalid count in %q, must be a positive integer", need))
+			}
+		}
+		if rtype == "" {
+			return nil, badRequestError(fmt.Sprintf("invalid type in %q", types))
+		}
+		if _, ok := needs[rtype]; ok {
+			return nil, badRequestError(fmt.Sprintf("type %s requested more than once", rtype))
+		}
+		needs[rtype] = count
+	}
+	return needs, nil
+}
+
 //  handleRelease: Handler for /release
 //  Method: POST
 //	URL Params:
 //		Required: name=[string]  : name of finished resource
 //		Required: owner=[string] : owner of the resource
 //		Required: dest=[string]  : dest state
+//		Optional: cleanup_duration=[duration] : how long the cleanup of the resource took, reported by janitors
 func handleRelease(r *ranch.Ranch) http.HandlerFunc {
 	return func(res http.ResponseWriter, req *http.Request) {
 		logrus.WithField("handler", "handleDone").Infof("From %v", req.RemoteAddr)
@@ -258,11 +756,48 @@ func handleRelease(r *ranch.Ranch) http.HandlerFunc {
 			http.Error(res, msg, http.StatusBadRequest)
 			return
 		}
+		if err := validateIdentifiers(param{"name", name}, param{"dest", dest}); err != nil {
+			returnAndLogError(res, err, "Bad request")
+			return
+		}
+		if err := validateFreeform(param{"owner", owner}); err != nil {
+			returnAndLogError(res, err, "Bad request")
+			return
+		}
+		var cleanupDuration time.Duration
+		if v := req.URL.Query().Get("cleanup_duration"); v != "" {
+			var err error
+			if cleanupDuration, err = time.ParseDuration(v); err != nil || cleanupDuration <= 0 {
+				returnAndLogError(res, badRequestError(fmt.Sprintf("invalid cleanup_duration %q: must be a positive duration", v)), "Bad request")
+				return
+			}
+		}
 
-		if err := r.Release(name, dest, owner); err != nil {
+		// Errors are left to Release to report.
+		resource, _ := r.Storage.GetResource(name)
+		if resource != nil {
+			resolveStates(res, req, r, owner, resource.Spec.Type, &dest)
+			if err := validateStates(r, resource.Spec.Type, param{"dest", dest}); err != nil {
+				returnAndLogError(res, err, "Bad request")
+				return
+			}
+		}
+		var err error
+		if cleanupDuration > 0 {
+			err = r.ReleaseCleaned(name, dest, owner, cleanupDuration)
+		} else {
+			err = r.Release(name, dest, owner)
+		}
+		if err != nil {
 			returnAndLogError(res, err, fmt.Sprintf("Done failed: %v - %v (from %v)", name, dest, owner))
 			return
 		}
+		if cleanupDuration > 0 && resource != nil && resource.Status.State == common.Cleaning {
+			observeCleanupDuration(resource.Spec.Type, dest, cleanupDuration)
+		}
+		if resource != nil && missedHeartbeats(r, resource, dest) {
+			warnDeprecated(res, req, r, owner, deprecatedMissingHeartbeat)
+		}
 
 		logrus.Infof("Done with resource %v, set to state %v", name, dest)
 	}
@@ -300,12 +835,31 @@ func handleReset(r *ranch.Ranch) http.HandlerFunc {
 			return
 		}
 
+		if err := validateIdentifiers(param{"type", rtype}, param{"state", state}, param{"dest", dest}); err != nil {
+			returnAndLogError(res, err, "Bad request")
+			return
+		}
+
+		resolveStates(res, req, r, "", rtype, &state, &dest)
+		if err := validateStates(r, rtype, param{"state", state}, param{"dest", dest}); err != nil {
+			returnAndLogError(res, err, "Bad request")
+			return
+		}
+
 		expire, err := time.ParseDuration(expireStr)
 		if err != nil {
 			logrus.WithError(err).Debugf("Invalid expiration: %v", expireStr)
 			http.Error(res, err.Error(), http.StatusBadRequest)
 			return
 		}
+		if err := validateExpire(expire); err != nil {
+			returnAndLogError(res, err, "Bad request")
+			return
+		}
+		if err := authorizePolicy(r, "reset", callerIdentity(req), "", req.RemoteAddr, rtype); err != nil {
+			returnAndLogError(res, err, "Forbidden")
+			return
+		}
 
 		rmap, err := r.Reset(rtype, state, expire, dest)
 		if err != nil {
@@ -330,6 +884,9 @@ func handleReset(r *ranch.Ranch) http.HandlerFunc {
 //		Required: owner=[string]             : owner of the resource
 //		Required: state=[string]             : current state of the resource
 //		Optional: userData=[common.UserData] : user data id to update
+//		Optional: phase=[string]             : phase of the job holding the resource
+//		Optional: progress=[int]             : completion of the job in percent, requires phase
+//		Optional: message=[string]           : details of the phase, requires phase
 func handleUpdate(r *ranch.Ranch) http.HandlerFunc {
 	return func(res http.ResponseWriter, req *http.Request) {
 		logrus.WithField("handler", "handleUpdate").Infof("From %v", req.RemoteAddr)
@@ -352,21 +909,36 @@ func handleUpdate(r *ranch.Ranch) http.HandlerFunc {
 			return
 		}
 
+		if err := validateIdentifiers(param{"name", name}, param{"state", state}); err != nil {
+			returnAndLogError(res, err, "Bad request")
+			return
+		}
+		if err := validateFreeform(param{"owner", owner}); err != nil {
+			returnAndLogError(res, err, "Bad request")
+			return
+		}
+		progress, err := parseProgress(req)
+		if err != nil {
+			returnAndLogError(res, err, "Bad request")
+			return
+		}
+
 		var userData common.UserData
 
-		if req.Body != nil {
-			err := json.NewDecoder(req.Body).Decode(&userData)
-			switch {
-			case err == io.EOF:
-				// empty body
-			case err != nil:
-				logrus.WithError(err).Warning("Unable to read from response body")
+		body, err := readJSONBody(req)
+		if err != nil {
+			returnAndLogError(res, err, "Bad request")
+			return
+		}
+		if body != nil {
+			if err := json.Unmarshal(body, &userData); err != nil {
+				logrus.WithError(err).Warning("Unable to read from request body")
 				http.Error(res, err.Error(), http.StatusBadRequest)
 				return
 			}
 		}
 
-		if err := r.Update(name, owner, state, &userData); err != nil {
+		if err := r.UpdateWithProgress(name, owner, state, &userData, progress); err != nil {
 			returnAndLogError(res, err, fmt.Sprintf("Update failed: %v - %v (%v)", name, state, owner))
 			return
 		}
@@ -375,6 +947,31 @@ func handleUpdate(r *ranch.Ranch) http.HandlerFunc {
 	}
 }
 
+// parseProgress parses the progress reported along with a heartbeat, or
+// returns nil if there is none.
+func parseProgress(req *http.Request) (*common.Progress, error) {
+	phase := req.URL.Query().Get("phase")
+	percent := req.URL.Query().Get("progress")
+	message := req.URL.Query().Get("message")
+	if phase == "" {
+		if percent != "" || message != "" {
+			return nil, badRequestError("progress and message must be reported along with a phase")
+		}
+		return nil, nil
+	}
+	if err := validateFreeform(param{"phase", phase}, param{"message", message}); err != nil {
+		return nil, err
+	}
+	progress := &common.Progress{Phase: phase, Message: message}
+	if percent != "" {
+		var err error
+		if progress.Percent, err = strconv.Atoi(percent); err != nil || progress.Percent < 0 || progress.Percent > 100 {
+			return nil, badRequestError(fmt.Sprintf("invalid progress %q, must be a percentage from 0 to 100", percent))
+		}
+	}
+	return progress, nil
+}
+
 //  handleMetric: Handler for /metric
 //  Method: GET
 func handleMetric(r *ranch.Ranch) http.HandlerFunc {
@@ -394,21 +991,169 @@ func handleMetric(r *ranch.Ranch) http.HandlerFunc {
 			http.Error(res, msg, http.StatusBadRequest)
 			return
 		}
+		if err := validateIdentifiers(param{"type", rtype}); err != nil {
+			returnAndLogError(res, err, "Bad request")
+			return
+		}
+
+		if err := resolveType(res, req, r, "", &rtype); err != nil {
+			returnAndLogError(res, err, "Metric failed")
+			return
+		}
 
-		metric, err := r.Metric(rtype)
+		var byOwner bool
+		if v := req.URL.Query().Get("by_owner"); v != "" {
+			var err error
+			if byOwner, err = strconv.ParseBool(v); err != nil {
+				returnAndLogError(res, badRequestError(fmt.Sprintf("invalid by_owner %q: must be a boolean", v)), "Bad request")
+				return
+			}
+		}
+
+		metricFunc := r.Metric
+		if byOwner {
+			metricFunc = r.MetricByOwner
+		}
+		metric, err := metricFunc(rtype)
 		if err != nil {
 			logrus.WithError(err).Errorf("Metric for %s failed", rtype)
 			http.Error(res, err.Error(), errorToStatus(err))
 			return
 		}
 
-		js, err := json.Marshal(metric)
+		js, err := json.Marshal(filterMetric(callerIdentity(req), metric))
 		if err != nil {
 			logrus.WithError(err).Error("Fail to marshal metric")
 			http.Error(res, err.Error(), errorToStatus(err))
 			return
 		}
 
+		writeCacheableJSON(res, req, js)
+	}
+}
+
+//  handleQueue: Handler for /queue
+//  Method: GET
+// 	URLParams:
+//		Optional: type=[string] : only list requests for this resource type
+func handleQueue(r *ranch.Ranch) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		logrus.WithField("handler", "handleQueue").Infof("From %v", req.RemoteAddr)
+
+		if req.Method != http.MethodGet {
+			logrus.Warningf("[BadRequest]method %v, expect GET", req.Method)
+			http.Error(res, "/queue only accepts GET", http.StatusMethodNotAllowed)
+			return
+		}
+
+		rtype := req.URL.Query().Get("type")
+		if err := validateIdentifiers(param{"type", rtype}); err != nil {
+			returnAndLogError(res, err, "Bad request")
+			return
+		}
+
+		if err := resolveType(res, req, r, "", &rtype); err != nil {
+			returnAndLogError(res, err, "Queue failed")
+			return
+		}
+
+		queue, err := r.Queue(rtype)
+		if err != nil {
+			returnAndLogError(res, err, "Queue failed")
+			return
+		}
+
+		js, err := json.Marshal(filterQueue(callerIdentity(req), queue))
+		if err != nil {
+			logrus.WithError(err).Error("Fail to marshal queue")
+			http.Error(res, err.Error(), errorToStatus(err))
+			return
+		}
+
+		writeCacheableJSON(res, req, js)
+	}
+}
+
+//  handleLameDuck: Handler for /lameduck
+//  Method: GET, POST
+// 	URLParams:
+//		Required for POST: enabled=[bool] : whether to stop granting new leases
+//	POST requires an authenticated admin.
+func handleLameDuck(r *ranch.Ranch) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		logrus.WithField("handler", "handleLameDuck").Infof("From %v", req.RemoteAddr)
+
+		switch req.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			if requireAdmin(res, req) {
+				return
+			}
+			enabled, err := strconv.ParseBool(req.URL.Query().Get("enabled"))
+			if err != nil {
+				returnAndLogError(res, badRequestError(fmt.Sprintf("invalid enabled %q: must be a boolean", req.URL.Query().Get("enabled"))), "Bad request")
+				return
+			}
+			r.SetLameDuck(enabled)
+		default:
+			msg := fmt.Sprintf("Method %v, /lameduck only accepts GET and POST.", req.Method)
+			logrus.Warning(msg)
+			http.Error(res, msg, http.StatusMethodNotAllowed)
+			return
+		}
+
+		js, err := json.Marshal(common.LameDuckStatus{Enabled: r.LameDuckMode()})
+		if err != nil {
+			logrus.WithError(err).Error("Fail to marshal lame-duck status")
+			http.Error(res, err.Error(), errorToStatus(err))
+			return
+		}
+		res.Header().Set("Content-Type", "application/json")
+		res.Write(js)
+	}
+}
+
+//  handleCleanupBreaker: Handler for /cleanupbreaker
+//  Method: GET, POST
+// 	URLParams:
+//		Required for POST: type=[string] : type of the resources whose cleanup breaker to reset
+//	POST requires an authenticated admin.
+func handleCleanupBreaker(r *ranch.Ranch) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		logrus.WithField("handler", "handleCleanupBreaker").Infof("From %v", req.RemoteAddr)
+
+		switch req.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			if requireAdmin(res, req) {
+				return
+			}
+			rtype := req.URL.Query().Get("type")
+			if rtype == "" {
+				returnAndLogError(res, badRequestError("type must be set in the request."), "Bad request")
+				return
+			}
+			if err := validateIdentifiers(param{"type", rtype}); err != nil {
+				returnAndLogError(res, err, "Bad request")
+				return
+			}
+			if err := r.ResetCleanupBreaker(rtype); err != nil {
+				returnAndLogError(res, err, "Reset cleanup breaker failed")
+				return
+			}
+		default:
+			msg := fmt.Sprintf("Method %v, /cleanupbreaker only accepts GET and POST.", req.Method)
+			logrus.Warning(msg)
+			http.Error(res, msg, http.StatusMethodNotAllowed)
+			return
+		}
+
+		js, err := json.Marshal(r.CleanupBreakers())
+		if err != nil {
+			logrus.WithError(err).Error("Fail to marshal cleanup breakers")
+			http.Error(res, err.Error(), errorToStatus(err))
+			return
+		}
 		res.Header().Set("Content-Type", "application/json")
 		res.Write(js)
 	}
@@ -417,7 +1162,18 @@ func handleMetric(r *ranch.Ranch) http.HandlerFunc {
 func returnAndLogError(res http.ResponseWriter, err error, logMsg string) {
 	log := logrus.WithError(err)
 	httpStatus := errorToStatus(err)
-	if httpStatus > 499 {
+	if w, ok := res.(*structuredErrorWriter); ok {
+		w.code = errorToAPICode(err)
+	}
+	if _, ok := err.(*ranch.LameDuck); ok {
+		// Draining is expected, clients should come back once it is over.
+		res.Header().Set("Retry-After", strconv.Itoa(int(lameDuckRetryAfter.Seconds())))
+		log.Debug(logMsg)
+	} else if mismatch, ok := err.(*ranch.TenantMismatch); ok {
+		// Tells clients the request was denied for its tenant, not its transition.
+		res.Header().Set(common.TenantHeader, mismatch.Tenant())
+		log.Debug(logMsg)
+	} else if httpStatus > 499 {
 		log.Error(logMsg)
 	} else {
 		log.Debug(logMsg)
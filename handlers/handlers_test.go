@@ -65,13 +65,19 @@ var (
 )
 
 func MakeTestRanch(resources []runtime.Object) *ranch.Ranch {
+	return makeTestRanchWithTTL(resources, testTTL)
+}
+
+// makeTestRanchWithTTL is MakeTestRanch for tests inspecting queued requests,
+// which must outlive the test.
+func makeTestRanchWithTTL(resources []runtime.Object, requestTTL time.Duration) *ranch.Ranch {
 	const ns = "test"
 	for _, obj := range resources {
 		obj.(metav1.Object).SetNamespace(ns)
 	}
 	client := &onceConflictingClient{Client: fakectrlruntimeclient.NewFakeClient(resources...)}
 	s := ranch.NewTestingStorage(client, ns, func() metav1.Time { return fakeNow })
-	r, _ := ranch.NewRanch("", s, testTTL)
+	r, _ := ranch.NewRanch("", s, requestTTL)
 	return r
 }
 
@@ -177,6 +183,80 @@ func TestAcquire(t *testing.T) {
 			code:   http.StatusNotFound,
 			method: http.MethodPost,
 		},
+		{
+			name:   "reject invalid selector",
+			path:   "?type=t&state=s&dest=d&owner=o&selector=region%3D%3D%3D",
+			code:   http.StatusBadRequest,
+			method: http.MethodPost,
+		},
+		{
+			name:   "reject invalid wait",
+			path:   "?type=t&state=s&dest=d&owner=o&wait=-1s",
+			code:   http.StatusBadRequest,
+			method: http.MethodPost,
+		},
+		{
+			name:   "unknown type is not waited for",
+			path:   "?type=t&state=s&dest=d&owner=o&wait=10ms",
+			code:   http.StatusNotFound,
+			method: http.MethodPost,
+		},
+		{
+			name:   "reject selector with fallback",
+			path:   "?type=t&state=s&dest=d&owner=o&selector=region%3Dus-east-1&fallback=true",
+			code:   http.StatusBadRequest,
+			method: http.MethodPost,
+		},
+		{
+			name: "no match selector",
+			resources: []runtime.Object{&crds.ResourceObject{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "res",
+				},
+				Spec: crds.ResourceSpec{
+					Type: "t",
+				},
+				Status: crds.ResourceStatus{
+					State:    "s",
+					UserData: map[string]string{"region": "us-west-1"},
+				},
+			}},
+			path:   "?type=t&state=s&dest=d&owner=o&selector=region%3Dus-east-1",
+			code:   http.StatusNotFound,
+			method: http.MethodPost,
+		},
+		{
+			name: "reject flavor of type without flavors",
+			resources: []runtime.Object{&crds.ResourceObject{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "res",
+				},
+				Spec: crds.ResourceSpec{
+					Type: "t",
+				},
+				Status: crds.ResourceStatus{
+					State: "s",
+				},
+			}},
+			path:   "?type=t&state=s&dest=d&owner=o&flavor=large",
+			code:   http.StatusBadRequest,
+			method: http.MethodPost,
+		},
+		{
+			name: "reject unknown flavor",
+			resources: []runtime.Object{&crds.DRLCObject{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "t",
+				},
+				Spec: crds.DRLCSpec{
+					MaxCount: 1,
+					Flavors:  []common.DynamicResourceFlavor{{Name: "small", MaxCount: 1}},
+				},
+			}},
+			path:   "?type=t&state=s&dest=d&owner=o&selector=flavor%3Dlarge",
+			code:   http.StatusBadRequest,
+			method: http.MethodPost,
+		},
 		{
 			name: "ok",
 			resources: []runtime.Object{&crds.ResourceObject{
@@ -796,6 +876,50 @@ func TestGetMetric(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "by owner",
+			resources: []runtime.Object{&crds.ResourceObject{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "res",
+				},
+				Spec: crds.ResourceSpec{
+					Type: "t",
+				},
+				Status: crds.ResourceStatus{
+					State: "s",
+					Owner: "merlin",
+				},
+			}},
+			path:   "?type=t&by_owner=true",
+			code:   http.StatusOK,
+			method: http.MethodGet,
+			expect: common.Metric{
+				Type: "t",
+				Current: map[string]int{
+					"s": 1,
+				},
+				Owners: map[string]int{
+					"merlin": 1,
+				},
+				ByOwner: map[string]map[string]int{
+					"merlin": {"s": 1},
+				},
+			},
+		},
+		{
+			name: "invalid by owner",
+			resources: []runtime.Object{&crds.ResourceObject{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "res",
+				},
+				Spec: crds.ResourceSpec{
+					Type: "t",
+				},
+			}},
+			path:   "?type=t&by_owner=maybe",
+			code:   http.StatusBadRequest,
+			method: http.MethodGet,
+		},
 	}
 
 	for _, tc := range testcases {
@@ -883,3 +1007,44 @@ func (occ *onceConflictingClient) Update(ctx context.Context, obj ctrlruntimecli
 	}
 	return occ.Client.Update(ctx, obj, opts...)
 }
+
+func TestParseResourceNeeds(t *testing.T) {
+	testCases := []struct {
+		name      string
+		types     string
+		expected  common.ResourceNeeds
+		expectErr bool
+	}{
+		{
+			name:     "counts default to one",
+			types:    "gcp-project,aws-account:2",
+			expected: common.ResourceNeeds{"gcp-project": 1, "aws-account": 2},
+		},
+		{
+			name:      "invalid count",
+			types:     "gcp-project:0",
+			expectErr: true,
+		},
+		{
+			name:      "empty type",
+			types:     "gcp-project,",
+			expectErr: true,
+		},
+		{
+			name:      "duplicate type",
+			types:     "gcp-project,gcp-project:2",
+			expectErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			needs, err := parseResourceNeeds(tc.types)
+			if tc.expectErr != (err != nil) {
+				t.Fatalf("expected error %t, got %v", tc.expectErr, err)
+			}
+			if !reflect.DeepEqual(tc.expected, needs) {
+				t.Errorf("expected needs %v, got %v", tc.expected, needs)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/boskos/ranch"
+)
+
+const (
+	// defaultHoldTTL is used when /hold is called without a ttl.
+	defaultHoldTTL = time.Minute
+	// maxHoldTTL bounds holds, which are meant to be short-lived.
+	maxHoldTTL = time.Hour
+)
+
+//  handleHold: Handler for /hold
+//  Method: POST
+// 	URLParams:
+//		Required: type=[string]  : type of requested resource
+//		Required: state=[string] : current state of the requested resource
+//		Required: dest=[string] : destination state of the resource once confirmed
+//		Required: owner=[string] : requester of the resource
+//		Optional: request_id=[string] : request id to keep the priority rank
+//		Optional: ttl=[duration] : how long the hold lasts unless confirmed
+func handleHold(r *ranch.Ranch) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		logrus.WithField("handler", "handleHold").Infof("From %v", req.RemoteAddr)
+
+		if req.Method != http.MethodPost {
+			msg := fmt.Sprintf("Method %v, /hold only accepts POST.", req.Method)
+			logrus.Warning(msg)
+			http.Error(res, msg, http.StatusMethodNotAllowed)
+			return
+		}
+
+		rtype := req.URL.Query().Get("type")
+		state := req.URL.Query().Get("state")
+		dest := req.URL.Query().Get("dest")
+		owner := req.URL.Query().Get("owner")
+		requestID := req.URL.Query().Get("request_id")
+		if rtype == "" || state == "" || dest == "" || owner == "" {
+			bre := badRequestError(fmt.Sprintf("Type: %v, state: %v, dest: %v, owner: %v, all of them must be set in the request.", rtype, state, dest, owner))
+			returnAndLogError(res, bre, "Bad request")
+			return
+		}
+		if err := validateIdentifiers(param{"type", rtype}, param{"state", state}, param{"dest", dest}); err != nil {
+			returnAndLogError(res, err, "Bad request")
+			return
+		}
+		if err := validateFreeform(param{"owner", owner}, param{"request_id", requestID}); err != nil {
+			returnAndLogError(res, err, "Bad request")
+			return
+		}
+		ttl := defaultHoldTTL
+		if v := req.URL.Query().Get("ttl"); v != "" {
+			var err error
+			if ttl, err = time.ParseDuration(v); err != nil || ttl <= 0 || ttl > maxHoldTTL {
+				returnAndLogError(res, badRequestError(fmt.Sprintf("invalid ttl %q: must be positive and no longer than %v", v, maxHoldTTL)), "Bad request")
+				return
+			}
+		}
+
+		if err := resolveType(res, req, r, owner, &rtype); err != nil {
+			returnAndLogError(res, err, "Hold failed")
+			return
+		}
+
+		resolveStates(res, req, r, owner, rtype, &state, &dest)
+		if err := validateStates(r, rtype, param{"state", state}, param{"dest", dest}); err != nil {
+			returnAndLogError(res, err, "Bad request")
+			return
+		}
+
+		if err := authorizePolicy(r, "acquire", callerIdentity(req), owner, req.RemoteAddr, rtype); err != nil {
+			returnAndLogError(res, err, "Forbidden")
+			return
+		}
+
+		logrus.Infof("Hold request for a %v %v from %v, dest %v, ttl %v", state, rtype, owner, dest, ttl)
+
+		resource, _, err := r.Hold(rtype, state, dest, owner, requestID, ttl)
+		if err != nil {
+			returnAndLogError(res, err, "Hold failed")
+			return
+		}
+
+		resJSON, err := json.Marshal(resource.ToResource())
+		if err != nil {
+			logrus.WithError(err).Errorf("json.Marshal failed: %v, resource will be released", resource)
+			http.Error(res, err.Error(), errorToStatus(err))
+			if err := r.Release(resource.Name, state, owner); err != nil {
+				logrus.WithError(err).Warningf("unable to release resource %s", resource.Name)
+			}
+			return
+		}
+		logrus.Infof("Resource held: %v", string(resJSON))
+		res.Header().Set("Content-Type", "application/json")
+		res.Write(resJSON)
+	}
+}
+
+//  handleConfirm: Handler for /confirm
+//  Method: POST
+// 	URLParams:
+//		Required: name=[string]  : name of the held resource
+//		Required: owner=[string] : owner of the hold
+func handleConfirm(r *ranch.Ranch) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		logrus.WithField("handler", "handleConfirm").Infof("From %v", req.RemoteAddr)
+
+		if req.Method != http.MethodPost {
+			msg := fmt.Sprintf("Method %v, /confirm only accepts POST.", req.Method)
+			logrus.Warning(msg)
+			http.Error(res, msg, http.StatusMethodNotAllowed)
+			return
+		}
+
+		name := req.URL.Query().Get("name")
+		owner := req.URL.Query().Get("owner")
+		if name == "" || owner == "" {
+			returnAndLogError(res, badRequestError(fmt.Sprintf("Name: %v, owner: %v, all of them must be set in the request.", name, owner)), "Bad request")
+			return
+		}
+		if err := validateIdentifiers(param{"name", name}); err != nil {
+			returnAndLogError(res, err, "Bad request")
+			return
+		}
+		if err := validateFreeform(param{"owner", owner}); err != nil {
+			returnAndLogError(res, err, "Bad request")
+			return
+		}
+
+		resource, err := r.Confirm(name, owner)
+		if err != nil {
+			returnAndLogError(res, err, fmt.Sprintf("Confirm failed: %v (from %v)", name, owner))
+			return
+		}
+
+		resJSON, err := json.Marshal(toLeasedResource(r, resource))
+		if err != nil {
+			logrus.WithError(err).Error("Fail to marshal resource")
+			http.Error(res, err.Error(), errorToStatus(err))
+			return
+		}
+		logrus.Infof("Confirmed hold on resource %v", name)
+		res.Header().Set("Content-Type", "application/json")
+		res.Write(resJSON)
+	}
+}
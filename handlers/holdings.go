@@ -0,0 +1,111 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/ranch"
+)
+
+//  handleHoldings: Handler for /holdings
+//  Method: GET
+// 	URLParams:
+//		Required: owner=[string] : owner, e.g. job or build ID, whose holdings to return, or
+//		Required: name=[string] : name of the resource whose holdings to return
+//		Optional: since=[RFC3339 time] : oldest time of the events the holdings are computed from
+//		Optional: until=[RFC3339 time] : time the events must predate
+//  Returns the periods the resources were held for as a JSON list, sorted by
+//  acquisition time. Owners the caller cannot see are redacted.
+func handleHoldings(r *ranch.Ranch) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		logrus.WithField("handler", "handleHoldings").Infof("From %v", req.RemoteAddr)
+
+		if req.Method != http.MethodGet {
+			msg := fmt.Sprintf("Method %v, /holdings only accepts GET.", req.Method)
+			logrus.Warning(msg)
+			http.Error(res, msg, http.StatusMethodNotAllowed)
+			return
+		}
+		query := ranch.HoldingQuery{
+			Owner: req.URL.Query().Get("owner"),
+			Name:  req.URL.Query().Get("name"),
+		}
+		if (query.Owner == "") == (query.Name == "") {
+			returnAndLogError(res, badRequestError("exactly one of owner and name must be set"), "Bad request")
+			return
+		}
+		if err := validateFreeform(param{"owner", query.Owner}); err != nil {
+			returnAndLogError(res, err, "Bad request")
+			return
+		}
+		if err := validateIdentifiers(param{"name", query.Name}); err != nil {
+			returnAndLogError(res, err, "Bad request")
+			return
+		}
+		for _, bound := range []struct {
+			name  string
+			value *time.Time
+		}{
+			{"since", &query.Since},
+			{"until", &query.Until},
+		} {
+			v := req.URL.Query().Get(bound.name)
+			if v == "" {
+				continue
+			}
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				returnAndLogError(res, badRequestError(fmt.Sprintf("invalid %s %q: must be an RFC3339 time", bound.name, v)), "Bad request")
+				return
+			}
+			*bound.value = t
+		}
+
+		found, err := r.Holdings(query)
+		if err != nil {
+			returnAndLogError(res, err, "Querying the holdings failed")
+			return
+		}
+		identity := callerIdentity(req)
+		holdings := []common.Holding{}
+		for _, holding := range found {
+			if !identity.CanSeeOwner(holding.Owner) {
+				// Callers cannot list the resources of owners they cannot see.
+				if query.Owner != "" {
+					continue
+				}
+				holding.Owner = common.Other
+			}
+			holdings = append(holdings, holding)
+		}
+		js, err := json.Marshal(holdings)
+		if err != nil {
+			logrus.WithError(err).Error("Fail to marshal holdings")
+			http.Error(res, err.Error(), errorToStatus(err))
+			return
+		}
+		res.Header().Set("Content-Type", "application/json")
+		res.Write(js)
+	}
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/ranch"
+)
+
+func TestHoldings(t *testing.T) {
+	base := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	released := base.Add(2 * time.Minute)
+	events := []common.ResourceEvent{
+		{Kind: common.ResourceChanged, Name: "res", Type: "t", Time: base, State: common.Busy, Owner: "job"},
+		{Kind: common.ResourceChanged, Name: "other", Type: "t", Time: base.Add(time.Minute), State: common.Busy, Owner: "other-job"},
+		{Kind: common.ResourceChanged, Name: "res", Type: "t", Time: released, State: common.Dirty, PreviousState: common.Busy},
+	}
+	disabled := NewBoskosHandler(MakeTestRanch(nil))
+	r := MakeTestRanch(nil)
+	archive := ranch.NewMemoryEventArchive(10)
+	for _, event := range events {
+		if err := archive.Record(context.Background(), event); err != nil {
+			t.Fatalf("failed to record event: %v", err)
+		}
+	}
+	r.SetEventArchive(archive)
+	handler := NewBoskosHandler(r)
+
+	testCases := []struct {
+		name     string
+		handler  http.Handler
+		url      string
+		code     int
+		expected []common.Holding
+	}{
+		{
+			name:    "not archived",
+			handler: disabled,
+			url:     "/holdings?owner=job",
+			code:    http.StatusNotFound,
+		},
+		{
+			name:     "holdings of an owner",
+			handler:  handler,
+			url:      "/holdings?owner=job",
+			code:     http.StatusOK,
+			expected: []common.Holding{{Name: "res", Type: "t", Owner: "job", Acquired: base, Released: &released}},
+		},
+		{
+			name:     "holdings of a resource",
+			handler:  handler,
+			url:      "/holdings?name=other",
+			code:     http.StatusOK,
+			expected: []common.Holding{{Name: "other", Type: "t", Owner: "other-job", Acquired: base.Add(time.Minute)}},
+		},
+		{
+			name:     "no holdings",
+			handler:  handler,
+			url:      "/holdings?owner=missing",
+			code:     http.StatusOK,
+			expected: []common.Holding{},
+		},
+		{
+			name:    "neither owner nor name",
+			handler: handler,
+			url:     "/holdings",
+			code:    http.StatusBadRequest,
+		},
+		{
+			name:    "both owner and name",
+			handler: handler,
+			url:     "/holdings?owner=job&name=res",
+			code:    http.StatusBadRequest,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			tc.handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tc.url, nil))
+			if rr.Code != tc.code {
+				t.Fatalf("expected %d, got %d: %s", tc.code, rr.Code, rr.Body.String())
+			}
+			if tc.code != http.StatusOK {
+				return
+			}
+			var got []common.Holding
+			if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+				t.Fatalf("failed to decode holdings: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("expected holdings %+v, got %+v", tc.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/ranch"
+)
+
+//  handleImport: Handler for /import
+//  Method: POST
+//  Body: a JSON list of common.ImportedResource
+// 	URLParams:
+//		Optional: dry_run=[bool] : only validate the resources
+func handleImport(r *ranch.Ranch) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		logrus.WithField("handler", "handleImport").Infof("From %v", req.RemoteAddr)
+
+		if req.Method != http.MethodPost {
+			msg := fmt.Sprintf("Method %v, /import only accepts POST.", req.Method)
+			logrus.Warning(msg)
+			http.Error(res, msg, http.StatusMethodNotAllowed)
+			return
+		}
+
+		var dryRun bool
+		if v := req.URL.Query().Get("dry_run"); v != "" {
+			var err error
+			if dryRun, err = strconv.ParseBool(v); err != nil {
+				returnAndLogError(res, badRequestError(fmt.Sprintf("invalid dry_run %q: must be a boolean", v)), "Bad request")
+				return
+			}
+		}
+		body, err := readJSONBody(req)
+		if err != nil {
+			returnAndLogError(res, err, "Bad request")
+			return
+		}
+		var resources []common.ImportedResource
+		if body == nil || json.Unmarshal(body, &resources) != nil {
+			returnAndLogError(res, badRequestError("the body must be a JSON list of resources"), "Bad request")
+			return
+		}
+		if len(resources) > maxNamesPerRequest {
+			returnAndLogError(res, badRequestError(fmt.Sprintf("at most %d resources may be imported at once", maxNamesPerRequest)), "Bad request")
+			return
+		}
+
+		summary, err := r.ImportResources(resources, dryRun)
+		if err != nil && summary == nil {
+			returnAndLogError(res, err, "Import failed")
+			return
+		}
+		status := http.StatusOK
+		if err != nil {
+			logrus.WithError(err).Error("Import failed part way")
+			status = errorToStatus(err)
+		} else if len(summary.Invalid) > 0 {
+			status = http.StatusBadRequest
+		}
+		res.Header().Set("Content-Type", "application/json")
+		res.WriteHeader(status)
+		if err := json.NewEncoder(res).Encode(summary); err != nil {
+			logrus.WithError(err).Error("failed to write response")
+		}
+	}
+}
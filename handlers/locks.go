@@ -0,0 +1,144 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/boskos/ranch"
+)
+
+const (
+	// defaultLockTTL is used when /lock is called without a ttl.
+	defaultLockTTL = time.Minute
+	// maxLockTTL bounds locks, so that the lock of a holder that went away
+	// is released in a timely manner.
+	maxLockTTL = time.Hour
+)
+
+//  handleLock: Handler for /lock
+//  Method: GET, POST
+// 	URLParams:
+//		Required for POST: name=[string] : name of the lock
+//		Required for POST: owner=[string] : requester of the lock
+//		Optional for POST: ttl=[duration] : how long the lock is held unless renewed
+func handleLock(r *ranch.Ranch) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		logrus.WithField("handler", "handleLock").Infof("From %v", req.RemoteAddr)
+
+		switch req.Method {
+		case http.MethodGet:
+			js, err := json.Marshal(r.Locks())
+			if err != nil {
+				logrus.WithError(err).Error("Fail to marshal locks")
+				http.Error(res, err.Error(), errorToStatus(err))
+				return
+			}
+			res.Header().Set("Content-Type", "application/json")
+			res.Write(js)
+			return
+		case http.MethodPost:
+		default:
+			msg := fmt.Sprintf("Method %v, /lock only accepts GET and POST.", req.Method)
+			logrus.Warning(msg)
+			http.Error(res, msg, http.StatusMethodNotAllowed)
+			return
+		}
+
+		name := req.URL.Query().Get("name")
+		owner := req.URL.Query().Get("owner")
+		if name == "" || owner == "" {
+			returnAndLogError(res, badRequestError(fmt.Sprintf("Name: %v, owner: %v, all of them must be set in the request.", name, owner)), "Bad request")
+			return
+		}
+		if err := validateIdentifiers(param{"name", name}); err != nil {
+			returnAndLogError(res, err, "Bad request")
+			return
+		}
+		if err := validateFreeform(param{"owner", owner}); err != nil {
+			returnAndLogError(res, err, "Bad request")
+			return
+		}
+		ttl := defaultLockTTL
+		if v := req.URL.Query().Get("ttl"); v != "" {
+			var err error
+			if ttl, err = time.ParseDuration(v); err != nil || ttl <= 0 || ttl > maxLockTTL {
+				returnAndLogError(res, badRequestError(fmt.Sprintf("invalid ttl %q: must be positive and no longer than %v", v, maxLockTTL)), "Bad request")
+				return
+			}
+		}
+
+		lock, err := r.AcquireLock(name, owner, ttl)
+		if err != nil {
+			returnAndLogError(res, err, "Lock failed")
+			return
+		}
+
+		js, err := json.Marshal(lock)
+		if err != nil {
+			logrus.WithError(err).Error("Fail to marshal lock")
+			http.Error(res, err.Error(), errorToStatus(err))
+			return
+		}
+		res.Header().Set("Content-Type", "application/json")
+		res.Write(js)
+	}
+}
+
+//  handleUnlock: Handler for /unlock
+//  Method: POST
+// 	URLParams:
+//		Required: name=[string] : name of the lock
+//		Required: owner=[string] : holder of the lock
+func handleUnlock(r *ranch.Ranch) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		logrus.WithField("handler", "handleUnlock").Infof("From %v", req.RemoteAddr)
+
+		if req.Method != http.MethodPost {
+			msg := fmt.Sprintf("Method %v, /unlock only accepts POST.", req.Method)
+			logrus.Warning(msg)
+			http.Error(res, msg, http.StatusMethodNotAllowed)
+			return
+		}
+
+		name := req.URL.Query().Get("name")
+		owner := req.URL.Query().Get("owner")
+		if name == "" || owner == "" {
+			returnAndLogError(res, badRequestError(fmt.Sprintf("Name: %v, owner: %v, all of them must be set in the request.", name, owner)), "Bad request")
+			return
+		}
+		if err := validateIdentifiers(param{"name", name}); err != nil {
+			returnAndLogError(res, err, "Bad request")
+			return
+		}
+		if err := validateFreeform(param{"owner", owner}); err != nil {
+			returnAndLogError(res, err, "Bad request")
+			return
+		}
+
+		if err := r.ReleaseLock(name, owner); err != nil {
+			returnAndLogError(res, err, fmt.Sprintf("Unlock failed: %v (from %v)", name, owner))
+			return
+		}
+		logrus.Infof("Released lock %v", name)
+	}
+}
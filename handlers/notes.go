@@ -0,0 +1,76 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/boskos/ranch"
+)
+
+//  handleNotes: Handler for /notes
+//  Method: POST
+//  The caller must be authenticated, it is recorded as the author of the note.
+// 	URLParams:
+//		Required: name=[string] : name of the resource to attach the note to
+//		Required: text=[string] : text of the note
+func handleNotes(r *ranch.Ranch) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		logrus.WithField("handler", "handleNotes").Infof("From %v", req.RemoteAddr)
+
+		if req.Method != http.MethodPost {
+			msg := fmt.Sprintf("Method %v, /notes only accepts POST.", req.Method)
+			logrus.Warning(msg)
+			http.Error(res, msg, http.StatusMethodNotAllowed)
+			return
+		}
+
+		// Notes are only trusted in handoffs if their author is known.
+		identity := callerIdentity(req)
+		if identity == nil || identity.Name == "" {
+			msg := "/notes requires an authenticated caller."
+			logrus.Warning(msg)
+			res.Header().Set("WWW-Authenticate", `Basic realm="boskos"`)
+			http.Error(res, msg, http.StatusUnauthorized)
+			return
+		}
+
+		name := req.URL.Query().Get("name")
+		text := req.URL.Query().Get("text")
+		if name == "" || text == "" {
+			returnAndLogError(res, badRequestError(fmt.Sprintf("Name: %v, text: %v, all of them must be set in the request.", name, text)), "Bad request")
+			return
+		}
+		if err := validateIdentifiers(param{"name", name}); err != nil {
+			returnAndLogError(res, err, "Bad request")
+			return
+		}
+		if err := validateFreeform(param{"text", text}); err != nil {
+			returnAndLogError(res, err, "Bad request")
+			return
+		}
+
+		if err := r.AddNote(name, identity.Name, text); err != nil {
+			returnAndLogError(res, err, fmt.Sprintf("Adding a note failed: %v (from %v)", name, identity.Name))
+			return
+		}
+		logrus.Infof("Added a note of %v to resource %v", identity.Name, name)
+	}
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+func TestNotes(t *testing.T) {
+	testCases := []struct {
+		name        string
+		username    string
+		password    string
+		resource    string
+		text        string
+		expectCode  int
+		expectNotes int
+	}{
+		{
+			name:        "authenticated caller adds a note",
+			username:    "admin",
+			password:    "admin-password",
+			resource:    "res",
+			text:        "flaky quota, see the handoff doc",
+			expectCode:  http.StatusOK,
+			expectNotes: 1,
+		},
+		{
+			name:       "anonymous caller is rejected",
+			resource:   "res",
+			text:       "drive-by note",
+			expectCode: http.StatusUnauthorized,
+		},
+		{
+			name:       "missing text",
+			username:   "admin",
+			password:   "admin-password",
+			resource:   "res",
+			expectCode: http.StatusBadRequest,
+		},
+		{
+			name:       "unknown resource",
+			username:   "admin",
+			password:   "admin-password",
+			resource:   "unknown",
+			text:       "note",
+			expectCode: http.StatusNotFound,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := MakeTestRanch([]runtime.Object{newResource("res", "t", common.Free, "", fakeNow)})
+			handler := makeTestAuthenticator(t).Wrap(NewBoskosHandler(r))
+
+			values := url.Values{"name": {tc.resource}, "text": {tc.text}}
+			req := httptest.NewRequest(http.MethodPost, "/notes?"+values.Encode(), nil)
+			if tc.username != "" {
+				req.SetBasicAuth(tc.username, tc.password)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			if rr.Code != tc.expectCode {
+				t.Fatalf("expected code %d, got %d: %s", tc.expectCode, rr.Code, rr.Body.String())
+			}
+
+			rr = httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/describe?name=res", nil))
+			var description common.ResourceDescription
+			if err := json.Unmarshal(rr.Body.Bytes(), &description); err != nil {
+				t.Fatalf("failed to unmarshal description: %v", err)
+			}
+			if len(description.Notes) != tc.expectNotes {
+				t.Fatalf("expected %d notes, got %+v", tc.expectNotes, description.Notes)
+			}
+			for _, note := range description.Notes {
+				if note.Author != tc.username || note.Text != tc.text {
+					t.Errorf("expected a note of %s with text %q, got %+v", tc.username, tc.text, note)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/peer"
+
+	"sigs.k8s.io/boskos/ranch"
+)
+
+var policyDenials = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "boskos_policy_denials_total",
+	Help: "Number of calls denied by the policy of a resource type, by action and type.",
+}, []string{"action", "type"})
+
+func init() {
+	prometheus.MustRegister(policyDenials)
+}
+
+// policyPrincipal returns the name the policies of the types match a caller
+// by: its name if it is authenticated, or else the owner it claims.
+func policyPrincipal(identity *Identity, owner string) string {
+	if identity != nil && identity.Name != "" {
+		return identity.Name
+	}
+	return owner
+}
+
+// authorizePolicy returns an error unless the policies of types allow the
+// caller to take action, acquire or reset, on their resources. Denials are
+// audited.
+func authorizePolicy(r *ranch.Ranch, action string, identity *Identity, owner, remote string, types ...string) error {
+	check := r.MayAcquire
+	if action == "reset" {
+		check = r.MayReset
+	}
+	principal := policyPrincipal(identity, owner)
+	for _, rType := range types {
+		if err := check(rType, principal); err != nil {
+			policyDenials.WithLabelValues(action, rType).Inc()
+			logrus.WithFields(logrus.Fields{
+				"audit":         "denied",
+				"action":        action,
+				"type":          rType,
+				"principal":     principal,
+				"authenticated": identity != nil && identity.Name != "",
+				"remote":        remote,
+			}).Warning("Denied by the policy of the resource type.")
+			return err
+		}
+	}
+	return nil
+}
+
+// peerAddress returns the address of the caller of a gRPC call, if known.
+func peerAddress(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok {
+		return p.Addr.String()
+	}
+	return ""
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+func TestPolicies(t *testing.T) {
+	testCases := []struct {
+		name       string
+		url        string
+		username   string
+		expectCode int
+	}{
+		{
+			name:       "anonymous caller acquires as a matching owner",
+			url:        "/acquire?type=t&state=free&dest=busy&owner=team-a-job",
+			expectCode: http.StatusOK,
+		},
+		{
+			name:       "anonymous caller cannot acquire as another owner",
+			url:        "/acquire?type=t&state=free&dest=busy&owner=team-b-job",
+			expectCode: http.StatusForbidden,
+		},
+		{
+			name:       "authenticated caller is matched by its name rather than the owner",
+			url:        "/acquire?type=t&state=free&dest=busy&owner=team-a-job",
+			username:   "team-b-ci",
+			expectCode: http.StatusForbidden,
+		},
+		{
+			name:       "batches are checked for every type",
+			url:        "/acquirebatch?types=t,u&state=free&dest=busy&owner=team-b-job",
+			expectCode: http.StatusForbidden,
+		},
+		{
+			name:       "named resources are checked for their type",
+			url:        "/acquirebystate?names=res&state=free&dest=busy&owner=team-b-job",
+			expectCode: http.StatusForbidden,
+		},
+		{
+			name:       "holds are checked like acquisitions",
+			url:        "/hold?type=t&state=free&dest=busy&owner=team-b-job",
+			expectCode: http.StatusForbidden,
+		},
+		{
+			name:       "claims are checked like acquisitions",
+			url:        "/claimexpired?type=t&dest=cleaning&owner=team-b-job",
+			expectCode: http.StatusForbidden,
+		},
+		{
+			name:       "claims sooner than the reaper need an admin",
+			url:        "/claimexpired?type=u&dest=cleaning&owner=janitor&expire=1m",
+			expectCode: http.StatusUnauthorized,
+		},
+		{
+			name:       "admins claim sooner than the reaper",
+			url:        "/claimexpired?type=u&dest=cleaning&owner=janitor&expire=1m",
+			username:   "admin",
+			expectCode: http.StatusNotFound,
+		},
+		{
+			name:       "resetter resets",
+			url:        "/reset?type=t&state=busy&expire=1m&dest=dirty",
+			username:   "admin",
+			expectCode: http.StatusOK,
+		},
+		{
+			name:       "anonymous caller cannot reset",
+			url:        "/reset?type=t&state=busy&expire=1m&dest=dirty",
+			expectCode: http.StatusForbidden,
+		},
+		{
+			name:       "types without policy are open",
+			url:        "/reset?type=u&state=busy&expire=1m&dest=dirty",
+			expectCode: http.StatusOK,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := MakeTestRanch(nil)
+			if err := r.ApplyConfig(&common.BoskosConfig{Resources: []common.ResourceEntry{
+				{Type: "t", State: common.Free, Names: []string{"res"}, Policy: &common.TypePolicy{
+					Acquirers: []string{"team-a-.*"},
+					Resetters: []string{"admin"},
+				}},
+				{Type: "u", State: common.Free, Names: []string{"other"}},
+			}}); err != nil {
+				t.Fatalf("failed to apply config: %v", err)
+			}
+			handler := makeTestAuthenticator(t).Wrap(NewBoskosHandler(r))
+
+			req := httptest.NewRequest(http.MethodPost, tc.url, nil)
+			if tc.username != "" {
+				req.SetBasicAuth(tc.username, tc.username+"-password")
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			if rr.Code != tc.expectCode {
+				t.Errorf("expected code %d, got %d: %s", tc.expectCode, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
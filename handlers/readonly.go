@@ -0,0 +1,82 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/ranch"
+)
+
+// rejectWritesInReadOnly rejects the requests of h which are not reads while
+// the ranch is in read-only mode, before h partially handles them.
+func rejectWritesInReadOnly(r *ranch.Ranch, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			if err := r.WriteError(); err != nil {
+				returnAndLogError(res, err, fmt.Sprintf("Rejected %s %s", req.Method, req.URL.Path))
+				return
+			}
+		}
+		h.ServeHTTP(res, req)
+	})
+}
+
+//  handleReadOnly: Handler for /readonly
+//  Method: GET, POST
+// 	URLParams:
+//		Required for POST: enabled=[bool] : whether to reject every change
+//	POST requires an authenticated admin.
+func handleReadOnly(r *ranch.Ranch) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		logrus.WithField("handler", "handleReadOnly").Infof("From %v", req.RemoteAddr)
+
+		switch req.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			if requireAdmin(res, req) {
+				return
+			}
+			enabled, err := strconv.ParseBool(req.URL.Query().Get("enabled"))
+			if err != nil {
+				returnAndLogError(res, badRequestError(fmt.Sprintf("invalid enabled %q: must be a boolean", req.URL.Query().Get("enabled"))), "Bad request")
+				return
+			}
+			r.SetReadOnly(enabled)
+		default:
+			msg := fmt.Sprintf("Method %v, /readonly only accepts GET and POST.", req.Method)
+			logrus.Warning(msg)
+			http.Error(res, msg, http.StatusMethodNotAllowed)
+			return
+		}
+
+		js, err := json.Marshal(common.ReadOnlyStatus{Enabled: r.ReadOnlyMode(), Follower: r.Follower()})
+		if err != nil {
+			logrus.WithError(err).Error("Fail to marshal read-only status")
+			http.Error(res, err.Error(), errorToStatus(err))
+			return
+		}
+		res.Header().Set("Content-Type", "application/json")
+		res.Write(js)
+	}
+}
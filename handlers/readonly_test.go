@@ -0,0 +1,78 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+func TestReadOnly(t *testing.T) {
+	r := MakeTestRanch([]runtime.Object{newResource("res", "t", common.Busy, "owner", fakeNow)})
+	handler := makeTestAuthenticator(t).Wrap(NewBoskosHandler(r))
+	serveAs := func(username, method, target string) int {
+		req := httptest.NewRequest(method, target, nil)
+		if username != "" {
+			req.SetBasicAuth(username, username+"-password")
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+	serve := func(method, target string) int {
+		return serveAs("", method, target)
+	}
+
+	for _, username := range []string{"", "team-b-ci"} {
+		if code := serveAs(username, http.MethodPost, "/readonly?enabled=true"); code != http.StatusUnauthorized || r.ReadOnlyMode() {
+			t.Errorf("expected %q not to toggle read-only mode, got %d", username, code)
+		}
+	}
+	if code := serveAs("", http.MethodGet, "/readonly"); code != http.StatusOK {
+		t.Errorf("expected anyone to get the read-only mode, got %d", code)
+	}
+	if code := serveAs("admin", http.MethodPost, "/readonly?enabled=true"); code != http.StatusOK || !r.ReadOnlyMode() {
+		t.Fatalf("expected read-only mode to be enabled, got %d", code)
+	}
+	for _, target := range []string{"/release?name=res&dest=dirty&owner=owner", "/acquire?type=t&state=free&dest=busy&owner=other", "/lameduck?enabled=true"} {
+		if code := serve(http.MethodPost, target); code != http.StatusServiceUnavailable {
+			t.Errorf("expected POST %s to be rejected with %d, got %d", target, http.StatusServiceUnavailable, code)
+		}
+	}
+	if code := serve(http.MethodGet, "/metric?type=t"); code != http.StatusOK {
+		t.Errorf("expected listings to be served, got %d", code)
+	}
+	res, err := r.Storage.GetResource("res")
+	if err != nil {
+		t.Fatalf("failed to get resource: %v", err)
+	}
+	if res.Status.Owner != "owner" || res.Status.State != common.Busy {
+		t.Errorf("expected the resource to be unchanged, got %+v", res.Status)
+	}
+
+	if code := serveAs("admin", http.MethodPost, "/readonly?enabled=false"); code != http.StatusOK || r.ReadOnlyMode() {
+		t.Fatalf("expected read-only mode to be disabled, got %d", code)
+	}
+	if code := serve(http.MethodPost, "/release?name=res&dest=dirty&owner=owner"); code != http.StatusOK {
+		t.Errorf("expected release to succeed once out of read-only mode, got %d", code)
+	}
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/boskos/ranch"
+)
+
+// parseQuotaCount parses a non-negative integer parameter.
+func parseQuotaCount(req *http.Request, name string) (int, error) {
+	v := req.URL.Query().Get(name)
+	count, err := strconv.Atoi(v)
+	if err != nil || count < 0 {
+		return 0, badRequestError(fmt.Sprintf("invalid %s %q: must be a non-negative integer", name, v))
+	}
+	return count, nil
+}
+
+//  handleRegionUsage: Handler for /regionusage
+//  Method: GET, POST
+// 	URLParams:
+//		Required for POST: type=[string] : type of the resources
+//		Required for POST: region=[string] : region the usage is reported for
+//		Required for POST: used=[int] : how much of the quota of the region is used
+//		Required for POST: limit=[int] : quota of the region
+func handleRegionUsage(r *ranch.Ranch) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		logrus.WithField("handler", "handleRegionUsage").Infof("From %v", req.RemoteAddr)
+
+		switch req.Method {
+		case http.MethodGet:
+			js, err := json.Marshal(r.RegionUsage())
+			if err != nil {
+				logrus.WithError(err).Error("Fail to marshal region usage")
+				http.Error(res, err.Error(), errorToStatus(err))
+				return
+			}
+			res.Header().Set("Content-Type", "application/json")
+			res.Write(js)
+			return
+		case http.MethodPost:
+		default:
+			msg := fmt.Sprintf("Method %v, /regionusage only accepts GET and POST.", req.Method)
+			logrus.Warning(msg)
+			http.Error(res, msg, http.StatusMethodNotAllowed)
+			return
+		}
+
+		rtype := req.URL.Query().Get("type")
+		region := req.URL.Query().Get("region")
+		if rtype == "" || region == "" {
+			returnAndLogError(res, badRequestError("type and region must be set in the request."), "Bad request")
+			return
+		}
+		if err := validateIdentifiers(param{"type", rtype}, param{"region", region}); err != nil {
+			returnAndLogError(res, err, "Bad request")
+			return
+		}
+		if err := resolveType(res, req, r, "", &rtype); err != nil {
+			returnAndLogError(res, err, "Report region usage failed")
+			return
+		}
+		used, err := parseQuotaCount(req, "used")
+		if err != nil {
+			returnAndLogError(res, err, "Bad request")
+			return
+		}
+		limit, err := parseQuotaCount(req, "limit")
+		if err != nil {
+			returnAndLogError(res, err, "Bad request")
+			return
+		}
+
+		if err := r.ReportRegionUsage(rtype, region, used, limit); err != nil {
+			returnAndLogError(res, err, "Report region usage failed")
+			return
+		}
+	}
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/boskos/ranch"
+)
+
+//  handleReload: Handler for /admin/reload
+//  Method: POST
+//  The caller must be an authenticated admin. Forces a sync of the config and
+//  returns the status of the config syncs.
+func handleReload(r *ranch.Ranch) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		logrus.WithField("handler", "handleReload").Infof("From %v", req.RemoteAddr)
+
+		if req.Method != http.MethodPost {
+			msg := fmt.Sprintf("Method %v, /admin/reload only accepts POST.", req.Method)
+			logrus.Warning(msg)
+			http.Error(res, msg, http.StatusMethodNotAllowed)
+			return
+		}
+
+		identity := callerIdentity(req)
+		if identity == nil || !identity.Admin {
+			msg := "/admin/reload requires an authenticated admin."
+			logrus.Warning(msg)
+			res.Header().Set("WWW-Authenticate", `Basic realm="boskos"`)
+			http.Error(res, msg, http.StatusUnauthorized)
+			return
+		}
+
+		if err := r.ReloadConfig(); err != nil {
+			returnAndLogError(res, err, "Reload failed")
+			return
+		}
+		js, err := json.Marshal(r.ConfigSyncStatus())
+		if err != nil {
+			logrus.WithError(err).Error("Fail to marshal config sync status")
+			http.Error(res, err.Error(), errorToStatus(err))
+			return
+		}
+		res.Header().Set("Content-Type", "application/json")
+		res.Write(js)
+	}
+}
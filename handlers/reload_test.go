@@ -0,0 +1,97 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReload(t *testing.T) {
+	testCases := []struct {
+		name         string
+		username     string
+		password     string
+		method       string
+		reloadErr    error
+		expectCode   int
+		expectReload bool
+	}{
+		{
+			name:         "admin reloads",
+			username:     "admin",
+			password:     "admin-password",
+			method:       http.MethodPost,
+			expectCode:   http.StatusOK,
+			expectReload: true,
+		},
+		{
+			name:       "non-admin caller is rejected",
+			username:   "team-b-ci",
+			password:   "team-b-ci-password",
+			method:     http.MethodPost,
+			expectCode: http.StatusUnauthorized,
+		},
+		{
+			name:       "anonymous caller is rejected",
+			method:     http.MethodPost,
+			expectCode: http.StatusUnauthorized,
+		},
+		{
+			name:       "GET is not allowed",
+			username:   "admin",
+			password:   "admin-password",
+			method:     http.MethodGet,
+			expectCode: http.StatusMethodNotAllowed,
+		},
+		{
+			name:         "failed reload",
+			username:     "admin",
+			password:     "admin-password",
+			method:       http.MethodPost,
+			reloadErr:    errors.New("broken config"),
+			expectCode:   http.StatusInternalServerError,
+			expectReload: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := MakeTestRanch(nil)
+			reloaded := false
+			r.SetConfigReloader(func() error {
+				reloaded = true
+				return tc.reloadErr
+			})
+			handler := makeTestAuthenticator(t).Wrap(NewBoskosHandler(r))
+
+			req := httptest.NewRequest(tc.method, "/admin/reload", nil)
+			if tc.username != "" {
+				req.SetBasicAuth(tc.username, tc.password)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			if rr.Code != tc.expectCode {
+				t.Errorf("expected code %d, got %d: %s", tc.expectCode, rr.Code, rr.Body.String())
+			}
+			if reloaded != tc.expectReload {
+				t.Errorf("expected reload to be %t, got %t", tc.expectReload, reloaded)
+			}
+		})
+	}
+}
@@ -24,6 +24,7 @@ import (
 	"net/http/httptest"
 	"reflect"
 	"sort"
+	"strings"
 	"testing"
 
 	"github.com/go-test/deep"
@@ -58,16 +59,23 @@ func (tmw *testMuxWrapper) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if err := compareWithFixture(fmt.Sprintf("%s-request-%d", tmw.t.Name(), tmw.requstCount), requestBody); err != nil {
 		tmw.t.Errorf("data differs from fixture: %v", err)
 	}
-	tmw.ServeMux.ServeHTTP(&bodyLoggingHTTPWriter{t: tmw.t, ResponseWriter: w}, r)
+	// The client switches to the v2 API once it learns the server serves
+	// it, whose responses differ.
+	fixture := tmw.t.Name() + "-response"
+	if strings.HasPrefix(r.URL.Path, v2Prefix+"/") {
+		fixture = tmw.t.Name() + "-v2-response"
+	}
+	tmw.ServeMux.ServeHTTP(&bodyLoggingHTTPWriter{t: tmw.t, fixture: fixture, ResponseWriter: w}, r)
 }
 
 type bodyLoggingHTTPWriter struct {
-	t *testing.T
+	t       *testing.T
+	fixture string
 	http.ResponseWriter
 }
 
 func (blhw *bodyLoggingHTTPWriter) Write(data []byte) (int, error) {
-	if err := compareWithFixture(blhw.t.Name()+"-response", data); err != nil {
+	if err := compareWithFixture(blhw.fixture, data); err != nil {
 		blhw.t.Errorf("data differs from fixture: %v", err)
 	}
 	return blhw.ResponseWriter.Write(data)
@@ -0,0 +1,94 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/boskos/ranch"
+)
+
+const (
+	// defaultShardTTL is used when /shards is called without a ttl.
+	defaultShardTTL = time.Minute
+	// maxShardTTL bounds memberships, so that the shards of a replica that
+	// went away are reassigned in a timely manner.
+	maxShardTTL = time.Hour
+)
+
+//  handleShards: Handler for /shards
+//  Method: POST
+// 	URLParams:
+//		Required: group=[string] : shard group to join
+//		Required: owner=[string] : member joining the group
+//		Optional: ttl=[duration] : how long the membership lasts unless renewed
+//	Requires an authenticated admin.
+func handleShards(r *ranch.Ranch) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		logrus.WithField("handler", "handleShards").Infof("From %v", req.RemoteAddr)
+
+		if req.Method != http.MethodPost {
+			msg := fmt.Sprintf("Method %v, /shards only accepts POST.", req.Method)
+			logrus.Warning(msg)
+			http.Error(res, msg, http.StatusMethodNotAllowed)
+			return
+		}
+		if requireAdmin(res, req) {
+			return
+		}
+
+		group := req.URL.Query().Get("group")
+		owner := req.URL.Query().Get("owner")
+		if group == "" || owner == "" {
+			returnAndLogError(res, badRequestError(fmt.Sprintf("Group: %v, owner: %v, all of them must be set in the request.", group, owner)), "Bad request")
+			return
+		}
+		if err := validateIdentifiers(param{"group", group}); err != nil {
+			returnAndLogError(res, err, "Bad request")
+			return
+		}
+		if err := validateFreeform(param{"owner", owner}); err != nil {
+			returnAndLogError(res, err, "Bad request")
+			return
+		}
+		ttl := defaultShardTTL
+		if v := req.URL.Query().Get("ttl"); v != "" {
+			var err error
+			if ttl, err = time.ParseDuration(v); err != nil || ttl <= 0 || ttl > maxShardTTL {
+				returnAndLogError(res, badRequestError(fmt.Sprintf("invalid ttl %q: must be positive and no longer than %v", v, maxShardTTL)), "Bad request")
+				return
+			}
+		}
+
+		assignment := r.JoinShardGroup(group, owner, ttl)
+		logrus.Debugf("%s holds shard %d of %d in group %s", owner, assignment.Index, assignment.Count, group)
+
+		js, err := json.Marshal(assignment)
+		if err != nil {
+			logrus.WithError(err).Error("Fail to marshal shard assignment")
+			http.Error(res, err.Error(), errorToStatus(err))
+			return
+		}
+		res.Header().Set("Content-Type", "application/json")
+		res.Write(js)
+	}
+}
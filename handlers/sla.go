@@ -0,0 +1,63 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/ranch"
+)
+
+//  handleSLAReport: Handler for /slareport
+//  Method: GET
+// 	URLParams:
+//		Optional: window=[string] : daily (default) or weekly
+//  Returns the service level indicators of the resource types over the window.
+func handleSLAReport(r *ranch.Ranch) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		logrus.WithField("handler", "handleSLAReport").Infof("From %v", req.RemoteAddr)
+
+		if req.Method != http.MethodGet {
+			msg := fmt.Sprintf("Method %v, /slareport only accepts GET.", req.Method)
+			logrus.Warning(msg)
+			http.Error(res, msg, http.StatusMethodNotAllowed)
+			return
+		}
+		window := req.URL.Query().Get("window")
+		if window == "" {
+			window = common.SLADaily
+		}
+		report, err := r.SLAReport(window)
+		if err != nil {
+			returnAndLogError(res, err, "Bad request")
+			return
+		}
+		js, err := json.Marshal(report)
+		if err != nil {
+			logrus.WithError(err).Error("Fail to marshal SLA report")
+			http.Error(res, err.Error(), errorToStatus(err))
+			return
+		}
+		res.Header().Set("Content-Type", "application/json")
+		res.Write(js)
+	}
+}
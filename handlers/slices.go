@@ -0,0 +1,267 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/boskos/ranch"
+)
+
+// maxSlicesPerBooking bounds a single booking of time slices.
+const maxSlicesPerBooking = 24
+
+//  handleBook: Handler for /book
+//  Method: POST
+// 	URLParams:
+//		Required: type=[string] : type of the time-sliced resource
+//		Required: owner=[string] : owner of the booking
+//		Optional: slices=[int] : number of consecutive slices to book, defaults to 1
+//		Optional: not_before=[RFC3339 time] : earliest start of the booking, defaults to now
+func handleBook(r *ranch.Ranch) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		logrus.WithField("handler", "handleBook").Infof("From %v", req.RemoteAddr)
+
+		if req.Method != http.MethodPost {
+			msg := fmt.Sprintf("Method %v, /book only accepts POST.", req.Method)
+			logrus.Warning(msg)
+			http.Error(res, msg, http.StatusMethodNotAllowed)
+			return
+		}
+
+		rtype := req.URL.Query().Get("type")
+		owner := req.URL.Query().Get("owner")
+		if rtype == "" || owner == "" {
+			returnAndLogError(res, badRequestError(fmt.Sprintf("Type: %v, owner: %v, all of them must be set in the request.", rtype, owner)), "Bad request")
+			return
+		}
+		if err := validateIdentifiers(param{"type", rtype}); err != nil {
+			returnAndLogError(res, err, "Bad request")
+			return
+		}
+		if err := validateFreeform(param{"owner", owner}); err != nil {
+			returnAndLogError(res, err, "Bad request")
+			return
+		}
+		if err := resolveType(res, req, r, owner, &rtype); err != nil {
+			returnAndLogError(res, err, "Booking failed")
+			return
+		}
+		slices := 1
+		if v := req.URL.Query().Get("slices"); v != "" {
+			var err error
+			if slices, err = strconv.Atoi(v); err != nil || slices <= 0 || slices > maxSlicesPerBooking {
+				returnAndLogError(res, badRequestError(fmt.Sprintf("invalid slices %q: must be an integer between 1 and %d", v, maxSlicesPerBooking)), "Bad request")
+				return
+			}
+		}
+		var notBefore time.Time
+		if v := req.URL.Query().Get("not_before"); v != "" {
+			var err error
+			if notBefore, err = time.Parse(time.RFC3339, v); err != nil {
+				returnAndLogError(res, badRequestError(fmt.Sprintf("invalid not_before %q: must be an RFC3339 time", v)), "Bad request")
+				return
+			}
+		}
+
+		booking, err := r.Book(rtype, owner, slices, notBefore)
+		if err != nil {
+			returnAndLogError(res, err, "Book failed")
+			return
+		}
+
+		js, err := json.Marshal(booking)
+		if err != nil {
+			logrus.WithError(err).Error("Fail to marshal booking")
+			http.Error(res, err.Error(), errorToStatus(err))
+			return
+		}
+		res.Header().Set("Content-Type", "application/json")
+		res.Write(js)
+	}
+}
+
+//  handleReserve: Handler for /reserve
+//  Method: POST
+// 	URLParams:
+//		Required: type=[string] : type of the resource to reserve
+//		Required: owner=[string] : owner of the reservation
+//		Required: end=[RFC3339 time] : end of the reservation
+//		Optional: start=[RFC3339 time] : start of the reservation, defaults to now
+func handleReserve(r *ranch.Ranch) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		logrus.WithField("handler", "handleReserve").Infof("From %v", req.RemoteAddr)
+
+		if req.Method != http.MethodPost {
+			msg := fmt.Sprintf("Method %v, /reserve only accepts POST.", req.Method)
+			logrus.Warning(msg)
+			http.Error(res, msg, http.StatusMethodNotAllowed)
+			return
+		}
+
+		rtype := req.URL.Query().Get("type")
+		owner := req.URL.Query().Get("owner")
+		endParam := req.URL.Query().Get("end")
+		if rtype == "" || owner == "" || endParam == "" {
+			returnAndLogError(res, badRequestError(fmt.Sprintf("Type: %v, owner: %v, end: %v, all of them must be set in the request.", rtype, owner, endParam)), "Bad request")
+			return
+		}
+		if err := validateIdentifiers(param{"type", rtype}); err != nil {
+			returnAndLogError(res, err, "Bad request")
+			return
+		}
+		if err := validateFreeform(param{"owner", owner}); err != nil {
+			returnAndLogError(res, err, "Bad request")
+			return
+		}
+		if err := resolveType(res, req, r, owner, &rtype); err != nil {
+			returnAndLogError(res, err, "Reservation failed")
+			return
+		}
+		end, err := time.Parse(time.RFC3339, endParam)
+		if err != nil {
+			returnAndLogError(res, badRequestError(fmt.Sprintf("invalid end %q: must be an RFC3339 time", endParam)), "Bad request")
+			return
+		}
+		start := time.Now()
+		if v := req.URL.Query().Get("start"); v != "" {
+			if start, err = time.Parse(time.RFC3339, v); err != nil {
+				returnAndLogError(res, badRequestError(fmt.Sprintf("invalid start %q: must be an RFC3339 time", v)), "Bad request")
+				return
+			}
+		}
+		if !end.After(start) || end.Sub(start) > ranch.MaxReservationLength {
+			returnAndLogError(res, badRequestError(fmt.Sprintf("invalid end %q: must be after the start, by no more than %v", endParam, ranch.MaxReservationLength)), "Bad request")
+			return
+		}
+		if time.Until(start) > ranch.MaxBookingHorizon {
+			returnAndLogError(res, badRequestError(fmt.Sprintf("invalid start: must be within %v", ranch.MaxBookingHorizon)), "Bad request")
+			return
+		}
+
+		booking, err := r.Reserve(rtype, owner, start, end)
+		if err != nil {
+			returnAndLogError(res, err, "Reserve failed")
+			return
+		}
+
+		js, err := json.Marshal(booking)
+		if err != nil {
+			logrus.WithError(err).Error("Fail to marshal booking")
+			http.Error(res, err.Error(), errorToStatus(err))
+			return
+		}
+		res.Header().Set("Content-Type", "application/json")
+		res.Write(js)
+	}
+}
+
+//  handleCalendar: Handler for /calendar
+//  Method: GET
+// 	URLParams:
+//		Optional: type=[string] : only list the bookings of resources of this type
+func handleCalendar(r *ranch.Ranch) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		logrus.WithField("handler", "handleCalendar").Infof("From %v", req.RemoteAddr)
+
+		if req.Method != http.MethodGet {
+			msg := fmt.Sprintf("Method %v, /calendar only accepts GET.", req.Method)
+			logrus.Warning(msg)
+			http.Error(res, msg, http.StatusMethodNotAllowed)
+			return
+		}
+
+		rtype := req.URL.Query().Get("type")
+		if rtype != "" {
+			if err := validateIdentifiers(param{"type", rtype}); err != nil {
+				returnAndLogError(res, err, "Bad request")
+				return
+			}
+		}
+
+		if err := resolveType(res, req, r, "", &rtype); err != nil {
+			returnAndLogError(res, err, "Calendar failed")
+			return
+		}
+
+		bookings, err := r.Calendar(rtype)
+		if err != nil {
+			returnAndLogError(res, err, "Calendar failed")
+			return
+		}
+
+		js, err := json.Marshal(filterBookings(callerIdentity(req), bookings))
+		if err != nil {
+			logrus.WithError(err).Error("Fail to marshal calendar")
+			http.Error(res, err.Error(), errorToStatus(err))
+			return
+		}
+		writeCacheableJSON(res, req, js)
+	}
+}
+
+//  handleCancelBooking: Handler for /cancelbooking
+//  Method: POST
+// 	URLParams:
+//		Required: name=[string] : name of the booked resource
+//		Required: owner=[string] : owner of the booking
+//		Required: start=[RFC3339 time] : start of the booking
+func handleCancelBooking(r *ranch.Ranch) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		logrus.WithField("handler", "handleCancelBooking").Infof("From %v", req.RemoteAddr)
+
+		if req.Method != http.MethodPost {
+			msg := fmt.Sprintf("Method %v, /cancelbooking only accepts POST.", req.Method)
+			logrus.Warning(msg)
+			http.Error(res, msg, http.StatusMethodNotAllowed)
+			return
+		}
+
+		name := req.URL.Query().Get("name")
+		owner := req.URL.Query().Get("owner")
+		startParam := req.URL.Query().Get("start")
+		if name == "" || owner == "" || startParam == "" {
+			returnAndLogError(res, badRequestError(fmt.Sprintf("Name: %v, owner: %v, start: %v, all of them must be set in the request.", name, owner, startParam)), "Bad request")
+			return
+		}
+		if err := validateIdentifiers(param{"name", name}); err != nil {
+			returnAndLogError(res, err, "Bad request")
+			return
+		}
+		if err := validateFreeform(param{"owner", owner}); err != nil {
+			returnAndLogError(res, err, "Bad request")
+			return
+		}
+		start, err := time.Parse(time.RFC3339, startParam)
+		if err != nil {
+			returnAndLogError(res, badRequestError(fmt.Sprintf("invalid start %q: must be an RFC3339 time", startParam)), "Bad request")
+			return
+		}
+
+		if err := r.CancelBooking(name, owner, start); err != nil {
+			returnAndLogError(res, err, fmt.Sprintf("Cancel booking failed: %v (from %v)", name, owner))
+			return
+		}
+		logrus.Infof("Cancelled booking of %v on resource %v starting at %v", owner, name, start)
+	}
+}
@@ -0,0 +1,628 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/util/retry"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	"sigs.k8s.io/boskos/ranch"
+)
+
+const (
+	// defaultTokenTTL is how long scoped tokens are valid for unless told
+	// otherwise.
+	defaultTokenTTL = time.Hour
+	// maxTokenTTL bounds the lifetime of scoped tokens, which are meant for
+	// short-lived callers like CI jobs.
+	maxTokenTTL = 7 * 24 * time.Hour
+	// tokenReloadPeriod is how often persisted tokens are reloaded, so the
+	// tokens minted, rotated and revoked by other replicas take effect.
+	tokenReloadPeriod = 10 * time.Second
+	// tokenMissReloadPeriod is how often unknown tokens reload the persisted
+	// tokens at most, so tokens just minted by other replicas are known.
+	tokenMissReloadPeriod = time.Second
+	// tokensKey is the key of the persisted tokens in their Secret, as JSON.
+	tokensKey = "tokens"
+)
+
+// TokenScope restricts what the caller of a scoped token may do.
+type TokenScope struct {
+	// Verbs are the endpoints the caller may call, e.g. acquire or release.
+	Verbs []string `json:"verbs"`
+	// Types are the resource types the caller may act on, all if empty.
+	Types []string `json:"types,omitempty"`
+}
+
+// ScopedToken is a bearer token minted by an admin for a short-lived caller.
+type ScopedToken struct {
+	ID string `json:"id"`
+	// Name and Tenant are the identity the caller of the token acts as.
+	Name   string     `json:"name"`
+	Tenant string     `json:"tenant,omitempty"`
+	Scope  TokenScope `json:"scope"`
+	Expiry time.Time  `json:"expiry"`
+	// Token is the secret of the token, only returned when it is minted or
+	// rotated.
+	Token string `json:"token,omitempty"`
+}
+
+// tokenNotFoundError is returned for the ids of unknown or expired tokens.
+type tokenNotFoundError string
+
+func (e tokenNotFoundError) Error() string { return fmt.Sprintf("no token %s", string(e)) }
+
+type storedToken struct {
+	ScopedToken
+	ttl  time.Duration
+	hash [sha256.Size]byte
+}
+
+// PersistedToken is a scoped token as persisted, with the hash of its secret
+// in place of the secret.
+type PersistedToken struct {
+	ScopedToken
+	TTL  time.Duration `json:"ttl"`
+	Hash string        `json:"hash"`
+}
+
+// TokenPersistence stores the scoped tokens, so that they survive restarts
+// and are shared by the replicas of boskos.
+type TokenPersistence interface {
+	// LoadTokens returns the persisted tokens and their version.
+	LoadTokens(ctx context.Context) ([]PersistedToken, string, error)
+	// SaveTokens replaces the tokens persisted at version, and returns a
+	// conflict error of the Kubernetes API if they changed since.
+	SaveTokens(ctx context.Context, tokens []PersistedToken, version string) error
+}
+
+// tokenStore holds the scoped tokens. Only their hashes are kept. Unless they
+// are persisted, they don't survive restarts and each replica has its own.
+type tokenStore struct {
+	lock    sync.Mutex
+	now     func() time.Time
+	byID    map[string]*storedToken
+	byHash  map[[sha256.Size]byte]*storedToken
+	tenants map[string]bool
+	// persistence, if set, holds the tokens, which were last loaded from it
+	// at loaded.
+	persistence TokenPersistence
+	loaded      time.Time
+}
+
+func newTokenStore(tenants map[string]bool) *tokenStore {
+	return &tokenStore{
+		now:     time.Now,
+		byID:    map[string]*storedToken{},
+		byHash:  map[[sha256.Size]byte]*storedToken{},
+		tenants: tenants,
+	}
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// prune forgets the expired tokens. The caller must hold the lock.
+func (s *tokenStore) prune() {
+	now := s.now()
+	for id, token := range s.byID {
+		if !now.Before(token.Expiry) {
+			delete(s.byID, id)
+			delete(s.byHash, token.hash)
+		}
+	}
+}
+
+// replace replaces the tokens with persisted ones. The caller must hold the
+// lock.
+func (s *tokenStore) replace(tokens []PersistedToken) {
+	s.byID = map[string]*storedToken{}
+	s.byHash = map[[sha256.Size]byte]*storedToken{}
+	for _, persisted := range tokens {
+		b, err := hex.DecodeString(persisted.Hash)
+		if err != nil || len(b) != sha256.Size {
+			logrus.Warningf("Ignoring persisted token %s with an invalid hash", persisted.ID)
+			continue
+		}
+		token := &storedToken{ScopedToken: persisted.ScopedToken, ttl: persisted.TTL}
+		copy(token.hash[:], b)
+		s.byID[token.ID] = token
+		s.byHash[token.hash] = token
+	}
+}
+
+// reload reloads the persisted tokens if they were loaded more than period
+// ago. The caller must hold the lock.
+func (s *tokenStore) reload(ctx context.Context, period time.Duration) {
+	if s.persistence == nil || s.now().Sub(s.loaded) < period {
+		return
+	}
+	tokens, _, err := s.persistence.LoadTokens(ctx)
+	if err != nil {
+		logrus.WithError(err).Warning("Failed to reload the scoped tokens, keeping the ones loaded before")
+		return
+	}
+	s.replace(tokens)
+	s.loaded = s.now()
+}
+
+// change applies fn to the tokens, and persists them if they are persisted,
+// on top of the latest persisted tokens. The caller must hold the lock.
+func (s *tokenStore) change(ctx context.Context, fn func() error) error {
+	if s.persistence == nil {
+		return fn()
+	}
+	err := retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		tokens, version, err := s.persistence.LoadTokens(ctx)
+		if err != nil {
+			return err
+		}
+		s.replace(tokens)
+		if err := fn(); err != nil {
+			return err
+		}
+		persisted := make([]PersistedToken, 0, len(s.byID))
+		for _, token := range s.byID {
+			persisted = append(persisted, PersistedToken{ScopedToken: token.ScopedToken, TTL: token.ttl, Hash: hex.EncodeToString(token.hash[:])})
+		}
+		sort.Slice(persisted, func(i, j int) bool { return persisted[i].ID < persisted[j].ID })
+		return s.persistence.SaveTokens(ctx, persisted, version)
+	})
+	// The tokens in memory may not be the persisted ones anymore.
+	s.loaded = time.Time{}
+	if err == nil {
+		s.loaded = s.now()
+	}
+	return err
+}
+
+// issue sets a new secret for token, valid for its ttl from now. The caller
+// must hold the lock.
+func (s *tokenStore) issue(token *storedToken) (ScopedToken, error) {
+	secret, err := randomHex(32)
+	if err != nil {
+		return ScopedToken{}, err
+	}
+	delete(s.byHash, token.hash)
+	token.hash = sha256.Sum256([]byte(secret))
+	token.Expiry = s.now().Add(token.ttl)
+	s.byHash[token.hash] = token
+	issued := token.ScopedToken
+	issued.Token = secret
+	return issued, nil
+}
+
+func (s *tokenStore) mint(ctx context.Context, name, tenant string, scope TokenScope, ttl time.Duration) (ScopedToken, error) {
+	if tenant != "" && !s.tenants[tenant] {
+		return ScopedToken{}, badRequestError(fmt.Sprintf("unknown tenant %s", tenant))
+	}
+	id, err := randomHex(8)
+	if err != nil {
+		return ScopedToken{}, err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var issued ScopedToken
+	err = s.change(ctx, func() error {
+		s.prune()
+		token := &storedToken{ScopedToken: ScopedToken{ID: id, Name: name, Tenant: tenant, Scope: scope}, ttl: ttl}
+		s.byID[id] = token
+		issued, err = s.issue(token)
+		return err
+	})
+	return issued, err
+}
+
+// rotate replaces the secret of the token id, invalidating the previous one.
+func (s *tokenStore) rotate(ctx context.Context, id string) (ScopedToken, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var issued ScopedToken
+	err := s.change(ctx, func() error {
+		s.prune()
+		token, ok := s.byID[id]
+		if !ok {
+			return tokenNotFoundError(id)
+		}
+		var err error
+		issued, err = s.issue(token)
+		return err
+	})
+	return issued, err
+}
+
+func (s *tokenStore) revoke(ctx context.Context, id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.change(ctx, func() error {
+		s.prune()
+		token, ok := s.byID[id]
+		if !ok {
+			return tokenNotFoundError(id)
+		}
+		delete(s.byID, id)
+		delete(s.byHash, token.hash)
+		return nil
+	})
+}
+
+// list returns the valid tokens, without their secrets.
+func (s *tokenStore) list(ctx context.Context) []ScopedToken {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.reload(ctx, tokenReloadPeriod)
+	s.prune()
+	tokens := make([]ScopedToken, 0, len(s.byID))
+	for _, token := range s.byID {
+		tokens = append(tokens, token.ScopedToken)
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].ID < tokens[j].ID })
+	return tokens
+}
+
+// lookup returns the token of secret, or an error if it is unknown or expired.
+func (s *tokenStore) lookup(ctx context.Context, secret string) (ScopedToken, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.reload(ctx, tokenReloadPeriod)
+	hash := sha256.Sum256([]byte(secret))
+	token, ok := s.byHash[hash]
+	if !ok {
+		s.reload(ctx, tokenMissReloadPeriod)
+		token, ok = s.byHash[hash]
+	}
+	if !ok {
+		return ScopedToken{}, fmt.Errorf("unknown token")
+	}
+	if !s.now().Before(token.Expiry) {
+		return ScopedToken{}, fmt.Errorf("token %s of %s expired at %v", token.ID, token.Name, token.Expiry)
+	}
+	return token.ScopedToken, nil
+}
+
+// bearerToken returns the bearer token of req, if any.
+func bearerToken(req *http.Request) (string, bool) {
+	auth := req.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return "", false
+	}
+	return strings.TrimPrefix(auth, "Bearer "), true
+}
+
+// forbiddenScopeError is returned when the caller of a scoped token goes
+// beyond its scope.
+type forbiddenScopeError string
+
+func (e forbiddenScopeError) Error() string { return string(e) }
+
+// authorize returns an error unless the caller may call verb on resources of
+// types. Only the callers of scoped tokens are restricted; those scoped to
+// types may only make calls naming resources of these types.
+func (i *Identity) authorize(verb string, types ...string) error {
+	if i == nil || i.scope == nil {
+		return nil
+	}
+	if !sets.NewString(i.scope.Verbs...).Has(verb) {
+		return forbiddenScopeError(fmt.Sprintf("the token of %q may not call %s", i.Name, verb))
+	}
+	if len(i.scope.Types) == 0 {
+		return nil
+	}
+	allowed := sets.NewString(i.scope.Types...)
+	if len(types) == 0 {
+		return forbiddenScopeError(fmt.Sprintf("the token of %q may only act on resources of types %s", i.Name, strings.Join(i.scope.Types, ",")))
+	}
+	for _, rType := range types {
+		if !allowed.Has(rType) {
+			return forbiddenScopeError(fmt.Sprintf("the token of %q may not act on resources of type %s", i.Name, rType))
+		}
+	}
+	return nil
+}
+
+// requestTypes returns the types of the resources a request acts on, as named
+// by its type or types parameters or by the resource it names. Invalid
+// parameters are left to the handlers to report.
+func requestTypes(r *ranch.Ranch, req *http.Request) []string {
+	query := req.URL.Query()
+	var types []string
+	if v := query.Get("type"); v != "" {
+		types = append(types, strings.Split(v, ",")...)
+	}
+	if v := query.Get("types"); v != "" {
+		if needs, err := parseResourceNeeds(v); err == nil {
+			for rType := range needs {
+				types = append(types, rType)
+			}
+		}
+	}
+	if name := query.Get("name"); name != "" {
+		if res, err := r.Storage.GetResource(name); err == nil {
+			types = append(types, res.Spec.Type)
+		}
+	}
+	for i := range types {
+		if resolved, _, err := r.ResolveType(types[i]); err == nil {
+			types[i] = resolved
+		}
+	}
+	return types
+}
+
+// withScope rejects the requests to verb going beyond the scope of the token
+// of the caller.
+func withScope(r *ranch.Ranch, verb string, handler http.Handler) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		identity := callerIdentity(req)
+		if identity != nil && identity.scope != nil {
+			if err := identity.authorize(verb, requestTypes(r, req)...); err != nil {
+				returnAndLogError(res, err, "Forbidden")
+				return
+			}
+		}
+		handler.ServeHTTP(res, req)
+	}
+}
+
+// requireAdmin rejects the request unless the caller is an authenticated
+// admin, returning whether it was rejected.
+func requireAdmin(res http.ResponseWriter, req *http.Request) bool {
+	if identity := callerIdentity(req); identity != nil && identity.Admin {
+		return false
+	}
+	msg := fmt.Sprintf("%s requires an authenticated admin.", req.URL.Path)
+	logrus.Warning(msg)
+	res.Header().Set("WWW-Authenticate", `Basic realm="boskos"`)
+	http.Error(res, msg, http.StatusUnauthorized)
+	return true
+}
+
+func writeTokens(res http.ResponseWriter, v interface{}) {
+	js, err := json.Marshal(v)
+	if err != nil {
+		logrus.WithError(err).Error("Fail to marshal tokens")
+		http.Error(res, err.Error(), errorToStatus(err))
+		return
+	}
+	res.Header().Set("Content-Type", "application/json")
+	res.Write(js)
+}
+
+func splitList(v string) []string {
+	if v == "" {
+		return nil
+	}
+	return strings.Split(v, ",")
+}
+
+//  handleTokens: Handler for /admin/tokens
+//  Method: GET, POST
+//  The caller must be an authenticated admin. GET lists the valid scoped
+//  tokens, without their secrets. POST mints a scoped token:
+// 	URLParams:
+//		Required: name=[string]  : the name the caller of the token acts as
+//		Required: verbs=[string] : comma-separated endpoints the token may call, e.g. acquire,release
+//		Optional: types=[string] : comma-separated types the token may act on, all if empty
+//		Optional: tenant=[string] : the tenant the caller of the token belongs to
+//		Optional: ttl=[duration] : how long the token is valid for, an hour by default
+func (s *tokenStore) handleTokens(res http.ResponseWriter, req *http.Request) {
+	logrus.WithField("handler", "handleTokens").Infof("From %v", req.RemoteAddr)
+
+	if req.Method != http.MethodGet && req.Method != http.MethodPost {
+		msg := fmt.Sprintf("Method %v, /admin/tokens only accepts GET and POST.", req.Method)
+		logrus.Warning(msg)
+		http.Error(res, msg, http.StatusMethodNotAllowed)
+		return
+	}
+	if requireAdmin(res, req) {
+		return
+	}
+	if req.Method == http.MethodGet {
+		writeTokens(res, s.list(req.Context()))
+		return
+	}
+
+	name := req.URL.Query().Get("name")
+	tenant := req.URL.Query().Get("tenant")
+	scope := TokenScope{
+		Verbs: splitList(req.URL.Query().Get("verbs")),
+		Types: splitList(req.URL.Query().Get("types")),
+	}
+	if name == "" || len(scope.Verbs) == 0 {
+		returnAndLogError(res, badRequestError(fmt.Sprintf("Name: %v, verbs: %v, all of them must be set in the request.", name, scope.Verbs)), "Bad request")
+		return
+	}
+	if err := validateFreeform(param{"name", name}); err != nil {
+		returnAndLogError(res, err, "Bad request")
+		return
+	}
+	params := []param{{"tenant", tenant}}
+	for _, verb := range scope.Verbs {
+		params = append(params, param{"verbs", verb})
+	}
+	for _, rType := range scope.Types {
+		params = append(params, param{"types", rType})
+	}
+	if err := validateIdentifiers(params...); err != nil {
+		returnAndLogError(res, err, "Bad request")
+		return
+	}
+	ttl := defaultTokenTTL
+	if v := req.URL.Query().Get("ttl"); v != "" {
+		var err error
+		if ttl, err = time.ParseDuration(v); err != nil || ttl <= 0 || ttl > maxTokenTTL {
+			returnAndLogError(res, badRequestError(fmt.Sprintf("invalid ttl %q: must be positive and no longer than %v", v, maxTokenTTL)), "Bad request")
+			return
+		}
+	}
+
+	token, err := s.mint(req.Context(), name, tenant, scope, ttl)
+	if err != nil {
+		returnAndLogError(res, err, "Mint failed")
+		return
+	}
+	logrus.Infof("Minted token %s for %s, scoped to %+v, expiring at %v", token.ID, name, scope, token.Expiry)
+	writeTokens(res, token)
+}
+
+//  handleRotateToken: Handler for /admin/tokens/rotate
+//  Method: POST
+// 	URLParams:
+//		Required: id=[string] : the id of the token to rotate
+//  The caller must be an authenticated admin. Replaces the secret of the
+//  token, invalidating the previous one, and renews its expiry.
+func (s *tokenStore) handleRotateToken(res http.ResponseWriter, req *http.Request) {
+	logrus.WithField("handler", "handleRotateToken").Infof("From %v", req.RemoteAddr)
+
+	if req.Method != http.MethodPost {
+		msg := fmt.Sprintf("Method %v, /admin/tokens/rotate only accepts POST.", req.Method)
+		logrus.Warning(msg)
+		http.Error(res, msg, http.StatusMethodNotAllowed)
+		return
+	}
+	if requireAdmin(res, req) {
+		return
+	}
+	id := req.URL.Query().Get("id")
+	if id == "" {
+		returnAndLogError(res, badRequestError("id must be set in the request."), "Bad request")
+		return
+	}
+	token, err := s.rotate(req.Context(), id)
+	if err != nil {
+		returnAndLogError(res, err, "Rotate failed")
+		return
+	}
+	logrus.Infof("Rotated token %s of %s, expiring at %v", token.ID, token.Name, token.Expiry)
+	writeTokens(res, token)
+}
+
+//  handleRevokeToken: Handler for /admin/tokens/revoke
+//  Method: POST
+// 	URLParams:
+//		Required: id=[string] : the id of the token to revoke
+//  The caller must be an authenticated admin.
+func (s *tokenStore) handleRevokeToken(res http.ResponseWriter, req *http.Request) {
+	logrus.WithField("handler", "handleRevokeToken").Infof("From %v", req.RemoteAddr)
+
+	if req.Method != http.MethodPost {
+		msg := fmt.Sprintf("Method %v, /admin/tokens/revoke only accepts POST.", req.Method)
+		logrus.Warning(msg)
+		http.Error(res, msg, http.StatusMethodNotAllowed)
+		return
+	}
+	if requireAdmin(res, req) {
+		return
+	}
+	id := req.URL.Query().Get("id")
+	if id == "" {
+		returnAndLogError(res, badRequestError("id must be set in the request."), "Bad request")
+		return
+	}
+	if err := s.revoke(req.Context(), id); err != nil {
+		returnAndLogError(res, err, "Revoke failed")
+		return
+	}
+	logrus.Infof("Revoked token %s", id)
+}
+
+// PersistTokens persists the scoped tokens with persistence, which they are
+// loaded from right away.
+func (a *Authenticator) PersistTokens(ctx context.Context, persistence TokenPersistence) error {
+	tokens, _, err := persistence.LoadTokens(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load the scoped tokens: %w", err)
+	}
+	a.tokens.lock.Lock()
+	defer a.tokens.lock.Unlock()
+	a.tokens.persistence = persistence
+	a.tokens.replace(tokens)
+	a.tokens.loaded = a.tokens.now()
+	return nil
+}
+
+// secretTokenPersistence persists the scoped tokens in a Secret.
+type secretTokenPersistence struct {
+	client ctrlruntimeclient.Client
+	key    types.NamespacedName
+}
+
+// NewSecretTokenPersistence returns a TokenPersistence storing the scoped
+// tokens in the Secret name of namespace, which is created when the first
+// token is minted.
+func NewSecretTokenPersistence(client ctrlruntimeclient.Client, namespace, name string) TokenPersistence {
+	return &secretTokenPersistence{client: client, key: types.NamespacedName{Namespace: namespace, Name: name}}
+}
+
+func (p *secretTokenPersistence) LoadTokens(ctx context.Context) ([]PersistedToken, string, error) {
+	secret := &corev1.Secret{}
+	if err := p.client.Get(ctx, p.key, secret); err != nil {
+		if kerrors.IsNotFound(err) {
+			return nil, "", nil
+		}
+		return nil, "", err
+	}
+	var tokens []PersistedToken
+	if raw := secret.Data[tokensKey]; len(raw) > 0 {
+		if err := json.Unmarshal(raw, &tokens); err != nil {
+			return nil, "", fmt.Errorf("invalid tokens in secret %s: %w", p.key, err)
+		}
+	}
+	return tokens, secret.ResourceVersion, nil
+}
+
+func (p *secretTokenPersistence) SaveTokens(ctx context.Context, tokens []PersistedToken, version string) error {
+	raw, err := json.Marshal(tokens)
+	if err != nil {
+		return err
+	}
+	secret := &corev1.Secret{Data: map[string][]byte{tokensKey: raw}}
+	secret.Namespace, secret.Name = p.key.Namespace, p.key.Name
+	if version == "" {
+		err := p.client.Create(ctx, secret)
+		if kerrors.IsAlreadyExists(err) {
+			// Another replica created it meanwhile.
+			return kerrors.NewConflict(schema.GroupResource{Resource: "secrets"}, p.key.Name, err)
+		}
+		return err
+	}
+	secret.ResourceVersion = version
+	return p.client.Update(ctx, secret)
+}
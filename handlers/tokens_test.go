@@ -0,0 +1,204 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	fakectrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+func TestScopedTokens(t *testing.T) {
+	r := MakeTestRanch([]runtime.Object{
+		newResource("t-1", "t", common.Busy, "job", fakeNow),
+		newResource("t-2", "t", common.Free, "", fakeNow),
+		newResource("t-3", "t", common.Free, "", fakeNow),
+		newResource("u-1", "u", common.Free, "", fakeNow),
+	})
+	a := makeTestAuthenticator(t)
+	now := time.Now()
+	a.tokens.now = func() time.Time { return now }
+	handler := a.Wrap(NewBoskosHandler(r))
+
+	call := func(method, path string, auth func(*http.Request)) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if auth != nil {
+			auth(req)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+	asAdmin := func(req *http.Request) { req.SetBasicAuth("admin", "admin-password") }
+	withToken := func(secret string) func(*http.Request) {
+		return func(req *http.Request) { req.Header.Set("Authorization", "Bearer "+secret) }
+	}
+	decode := func(rr *httptest.ResponseRecorder) ScopedToken {
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+		var token ScopedToken
+		if err := json.Unmarshal(rr.Body.Bytes(), &token); err != nil {
+			t.Fatalf("failed to unmarshal token: %v", err)
+		}
+		return token
+	}
+
+	if rr := call(http.MethodPost, "/admin/tokens?name=job&verbs=acquire", func(req *http.Request) {
+		req.SetBasicAuth("team-a-ci", "team-a-ci-password")
+	}); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected non-admins not to mint tokens, got %d", rr.Code)
+	}
+	if rr := call(http.MethodPost, "/admin/tokens?name=job&verbs=acquire&ttl=720h", asAdmin); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected a ttl beyond the max to be rejected, got %d", rr.Code)
+	}
+
+	token := decode(call(http.MethodPost, "/admin/tokens?name=job&verbs=acquire,release&types=t&ttl=10m", asAdmin))
+	if token.Token == "" || token.Scope.Verbs[1] != "release" || !token.Expiry.Equal(now.Add(10*time.Minute)) {
+		t.Fatalf("unexpected token %+v", token)
+	}
+
+	testCases := []struct {
+		name       string
+		method     string
+		path       string
+		expectCode int
+	}{
+		{
+			name:       "acquire of a type in scope",
+			method:     http.MethodPost,
+			path:       "/acquire?type=t&state=free&dest=busy&owner=job",
+			expectCode: http.StatusOK,
+		},
+		{
+			name:       "acquire of a type out of scope",
+			method:     http.MethodPost,
+			path:       "/acquire?type=u&state=free&dest=busy&owner=job",
+			expectCode: http.StatusForbidden,
+		},
+		{
+			name:       "release of a resource of a type in scope",
+			method:     http.MethodPost,
+			path:       "/release?name=t-1&dest=dirty&owner=job",
+			expectCode: http.StatusOK,
+		},
+		{
+			name:       "verb out of scope",
+			method:     http.MethodPost,
+			path:       "/reset?type=t&state=busy&expire=1h&dest=dirty",
+			expectCode: http.StatusForbidden,
+		},
+		{
+			name:       "batch of a type out of scope",
+			method:     http.MethodPost,
+			path:       "/acquirebatch?types=u:1&state=free&dest=busy&owner=job",
+			expectCode: http.StatusForbidden,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if rr := call(tc.method, tc.path, withToken(token.Token)); rr.Code != tc.expectCode {
+				t.Errorf("expected code %d, got %d: %s", tc.expectCode, rr.Code, rr.Body.String())
+			}
+		})
+	}
+
+	rotated := decode(call(http.MethodPost, "/admin/tokens/rotate?id="+token.ID, asAdmin))
+	if rotated.ID != token.ID || rotated.Token == token.Token {
+		t.Fatalf("expected the secret of the token to change, got %+v", rotated)
+	}
+	if rr := call(http.MethodGet, "/metric?type=t", withToken(token.Token)); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected the rotated out secret to be rejected, got %d", rr.Code)
+	}
+	if rr := call(http.MethodPost, "/acquire?type=t&state=free&dest=busy&owner=job", withToken(rotated.Token)); rr.Code != http.StatusOK {
+		t.Errorf("expected the rotated secret to be accepted, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var listed []ScopedToken
+	if err := json.Unmarshal(call(http.MethodGet, "/admin/tokens", asAdmin).Body.Bytes(), &listed); err != nil {
+		t.Fatalf("failed to unmarshal tokens: %v", err)
+	}
+	if len(listed) != 1 || listed[0].ID != token.ID || listed[0].Token != "" {
+		t.Errorf("expected the token to be listed without its secret, got %+v", listed)
+	}
+
+	now = now.Add(time.Hour)
+	if rr := call(http.MethodGet, "/metric?type=t", withToken(rotated.Token)); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected the expired token to be rejected, got %d", rr.Code)
+	}
+	if rr := call(http.MethodPost, "/admin/tokens/revoke?id="+token.ID, asAdmin); rr.Code != http.StatusNotFound {
+		t.Errorf("expected the expired token to be gone, got %d", rr.Code)
+	}
+}
+
+func TestPersistedTokens(t *testing.T) {
+	ctx := context.Background()
+	persistence := NewSecretTokenPersistence(fakectrlruntimeclient.NewFakeClient(), "boskos", "boskos-tokens")
+	now := time.Now()
+	replicas := []*Authenticator{makeTestAuthenticator(t), makeTestAuthenticator(t)}
+	for _, a := range replicas {
+		a.tokens.now = func() time.Time { return now }
+		if err := a.PersistTokens(ctx, persistence); err != nil {
+			t.Fatalf("failed to persist tokens: %v", err)
+		}
+	}
+	first, second := replicas[0].tokens, replicas[1].tokens
+
+	minted, err := first.mint(ctx, "job", "", TokenScope{Verbs: []string{"acquire"}}, time.Hour)
+	if err != nil {
+		t.Fatalf("failed to mint token: %v", err)
+	}
+	other, err := second.mint(ctx, "other-job", "", TokenScope{Verbs: []string{"release"}}, time.Hour)
+	if err != nil {
+		t.Fatalf("failed to mint token: %v", err)
+	}
+	// Unknown tokens are looked up in the persisted ones.
+	now = now.Add(tokenMissReloadPeriod)
+	if token, err := second.lookup(ctx, minted.Token); err != nil || token.Name != "job" {
+		t.Errorf("expected the token minted by another replica to be known, got %+v, %v", token, err)
+	}
+	// Known tokens are reloaded periodically.
+	now = now.Add(tokenReloadPeriod)
+	if list := first.list(ctx); len(list) != 2 {
+		t.Errorf("expected the tokens of both replicas to be persisted, got %+v", list)
+	}
+
+	if err := second.revoke(ctx, minted.ID); err != nil {
+		t.Fatalf("failed to revoke token: %v", err)
+	}
+	now = now.Add(tokenReloadPeriod)
+	if _, err := first.lookup(ctx, minted.Token); err == nil {
+		t.Error("expected the token revoked by another replica to be rejected")
+	}
+
+	// Restarted replicas know the persisted tokens.
+	restarted := makeTestAuthenticator(t)
+	if err := restarted.PersistTokens(ctx, persistence); err != nil {
+		t.Fatalf("failed to persist tokens: %v", err)
+	}
+	if token, err := restarted.tokens.lookup(ctx, other.Token); err != nil || token.Name != "other-job" {
+		t.Errorf("expected the persisted token to survive the restart, got %+v, %v", token, err)
+	}
+}
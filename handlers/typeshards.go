@@ -0,0 +1,603 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/yaml"
+
+	"sigs.k8s.io/boskos/boskospb"
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/ranch"
+)
+
+const (
+	// locationTTL is how long the instance a resource was found on is
+	// remembered, as resources move when the types are assigned anew.
+	locationTTL = 10 * time.Minute
+	// forwardedIdentityTTL bounds how long the identity signed into a
+	// forwarded request is accepted for.
+	forwardedIdentityTTL = time.Minute
+)
+
+// TypeShardConfig splits the resource types among several boskos instances,
+// each storing and serving only the resources of its types, so boskos scales
+// beyond the write throughput of a single storage.
+type TypeShardConfig struct {
+	Instances []TypeShardInstance `json:"instances"`
+	// Assignments map resource types to the name of the instance owning them.
+	// The other types are assigned to an instance by their hash.
+	Assignments map[string]string `json:"assignments,omitempty"`
+	// SecretFile is the path to a file holding a secret shared by the
+	// instances, with which they sign the identity of the callers of the
+	// requests they forward. Without it, the owning instance authenticates the
+	// credentials of the callers itself, and rejects the scoped tokens minted
+	// by other instances.
+	SecretFile string `json:"secret-file,omitempty"`
+}
+
+// TypeShardInstance is a boskos instance owning some of the resource types.
+type TypeShardInstance struct {
+	Name string `json:"name"`
+	// URL is the URL the other instances forward the requests to.
+	URL string `json:"url"`
+	// GRPCAddress is the host:port the other instances forward the gRPC calls
+	// to. The gRPC calls for the types of instances without one are rejected.
+	GRPCAddress string `json:"grpc-address,omitempty"`
+}
+
+// location is the instance a resource which is not local was found on.
+type location struct {
+	instance string
+	expiry   time.Time
+}
+
+// TypeShards routes the requests for resource types owned by other boskos
+// instances to them.
+type TypeShards struct {
+	self        string
+	names       []string
+	urls        map[string]*url.URL
+	grpcAddrs   map[string]string
+	proxies     map[string]*httputil.ReverseProxy
+	assignments map[string]string
+	client      *http.Client
+	secret      []byte
+	now         func() time.Time
+
+	lock sync.Mutex
+	// located are the instances resources which are not local were found on,
+	// by name.
+	located map[string]location
+	// conns are the gRPC connections to the other instances, by name.
+	conns map[string]*grpc.ClientConn
+}
+
+// LoadTypeShardConfig reads a type shard config file for the instance self.
+func LoadTypeShardConfig(path, self string) (*TypeShards, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config := &TypeShardConfig{}
+	if err := yaml.Unmarshal(b, config); err != nil {
+		return nil, err
+	}
+	return NewTypeShards(config, self)
+}
+
+// NewTypeShards validates config and returns the routes of the instance self,
+// which must be one of its instances.
+func NewTypeShards(config *TypeShardConfig, self string) (*TypeShards, error) {
+	t := &TypeShards{
+		self:        self,
+		urls:        map[string]*url.URL{},
+		proxies:     map[string]*httputil.ReverseProxy{},
+		grpcAddrs:   map[string]string{},
+		assignments: config.Assignments,
+		client:      &http.Client{},
+		now:         time.Now,
+		located:     map[string]location{},
+		conns:       map[string]*grpc.ClientConn{},
+	}
+	for idx, instance := range config.Instances {
+		if instance.Name == "" {
+			return nil, fmt.Errorf(".instances.%d.name: must be set", idx)
+		}
+		if _, exists := t.urls[instance.Name]; exists {
+			return nil, fmt.Errorf(".instances.%d.name: duplicate instance %s", idx, instance.Name)
+		}
+		u, err := url.Parse(instance.URL)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf(".instances.%d.url: invalid URL %q", idx, instance.URL)
+		}
+		t.names = append(t.names, instance.Name)
+		t.urls[instance.Name] = u
+		if instance.GRPCAddress != "" {
+			t.grpcAddrs[instance.Name] = instance.GRPCAddress
+		}
+		proxy := httputil.NewSingleHostReverseProxy(u)
+		// Flush right away, so /watch streams through the proxy.
+		proxy.FlushInterval = -1
+		t.proxies[instance.Name] = proxy
+	}
+	if _, ok := t.urls[self]; !ok {
+		return nil, fmt.Errorf("instance %q is not in .instances", self)
+	}
+	for rType, name := range config.Assignments {
+		if _, ok := t.urls[name]; !ok {
+			return nil, fmt.Errorf(".assignments.%s: unknown instance %q", rType, name)
+		}
+	}
+	if config.SecretFile != "" {
+		secret, err := ioutil.ReadFile(config.SecretFile)
+		if err != nil {
+			return nil, fmt.Errorf(".secret-file: %v", err)
+		}
+		if t.secret = bytes.TrimSpace(secret); len(t.secret) == 0 {
+			return nil, fmt.Errorf(".secret-file: %s is empty", config.SecretFile)
+		}
+	}
+	sort.Strings(t.names)
+	return t, nil
+}
+
+// Owner returns the name of the instance owning rType.
+func (t *TypeShards) Owner(rType string) string {
+	if name, ok := t.assignments[rType]; ok {
+		return name
+	}
+	h := fnv.New32a()
+	h.Write([]byte(rType))
+	return t.names[h.Sum32()%uint32(len(t.names))]
+}
+
+// Owns returns whether the instance owns rType.
+func (t *TypeShards) Owns(rType string) bool {
+	return t.Owner(rType) == t.self
+}
+
+// Wrap serves the requests for resource types owned by other instances by
+// forwarding them to their owner. Requests naming resources which are not
+// stored by r are forwarded to the instance found to store them. Other
+// requests, and those forwarded by other instances, are served by h.
+func (t *TypeShards) Wrap(r *ranch.Ranch, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.Header.Get(common.ForwardedByHeader) != "" {
+			h.ServeHTTP(res, req)
+			return
+		}
+		query := req.URL.Query()
+		if types := requestShardTypes(query); len(types) > 0 {
+			if owner, ok := t.ownerOfAll(types); ok && owner != t.self {
+				t.forward(owner, res, req)
+				return
+			}
+			h.ServeHTTP(res, req)
+			return
+		}
+		var names []string
+		for _, key := range []string{"name", "names"} {
+			if v := query.Get(key); v != "" {
+				names = append(names, strings.Split(v, ",")...)
+			}
+		}
+		names, err := t.remoteNames(r.WithContext(req.Context()), names)
+		if err != nil {
+			returnAndLogError(res, err, "Failed to locate resources")
+			return
+		}
+		if len(names) == 0 {
+			h.ServeHTTP(res, req)
+			return
+		}
+		if owner, ok := t.locatedAll(names); ok {
+			t.forward(owner, res, req)
+			return
+		}
+		t.locate(names, h, res, req)
+	})
+}
+
+// requestShardTypes returns the types named by the type or types parameters
+// of a request, like /acquirebatch. Invalid parameters are left to the
+// handlers to report.
+func requestShardTypes(query url.Values) []string {
+	var types []string
+	if v := query.Get("type"); v != "" {
+		types = append(types, strings.Split(v, ",")...)
+	}
+	if v := query.Get("types"); v != "" {
+		if needs, err := parseResourceNeeds(v); err == nil {
+			for rType := range needs {
+				types = append(types, rType)
+			}
+		}
+	}
+	return types
+}
+
+// remoteNames returns the names of the resources which are not stored by r.
+// Failures to tell whether r stores a resource are returned, rather than
+// forwarding its requests to the other instances.
+func (t *TypeShards) remoteNames(r *ranch.Ranch, names []string) ([]string, error) {
+	var remote []string
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if _, err := r.Storage.GetResource(name); err != nil {
+			if !kerrors.IsNotFound(err) {
+				return nil, err
+			}
+			remote = append(remote, name)
+		}
+	}
+	return remote, nil
+}
+
+// locatedAll returns the instance all of the resources named were found on
+// lately. The second return value is false if some were not found, or on
+// several instances.
+func (t *TypeShards) locatedAll(names []string) (string, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	var owner string
+	for _, name := range names {
+		loc, ok := t.located[name]
+		if !ok || !t.now().Before(loc.expiry) || (owner != "" && loc.instance != owner) {
+			return "", false
+		}
+		owner = loc.instance
+	}
+	return owner, true
+}
+
+// remember records that the resources named were found on instance.
+func (t *TypeShards) remember(names []string, instance string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	expiry := t.now().Add(locationTTL)
+	for name, loc := range t.located {
+		if !t.now().Before(loc.expiry) {
+			delete(t.located, name)
+		}
+	}
+	for _, name := range names {
+		t.located[name] = location{instance: instance, expiry: expiry}
+	}
+}
+
+// ownerOfAll returns the instance owning all of types. The second return
+// value is false if they are owned by several instances.
+func (t *TypeShards) ownerOfAll(types []string) (string, bool) {
+	var owner string
+	for _, rType := range types {
+		o := t.Owner(strings.TrimSpace(rType))
+		if owner != "" && o != owner {
+			return "", false
+		}
+		owner = o
+	}
+	return owner, true
+}
+
+// setForwardedHeaders marks header as forwarded by the instance, on behalf of
+// the identity of the caller.
+func (t *TypeShards) setForwardedHeaders(header http.Header, identity *Identity) {
+	header.Set(common.ForwardedByHeader, t.self)
+	header.Del(common.ForwardedIdentityHeader)
+	if signed, ok := t.signIdentity(identity); ok {
+		header.Set(common.ForwardedIdentityHeader, signed)
+	}
+}
+
+func (t *TypeShards) forward(owner string, res http.ResponseWriter, req *http.Request) {
+	logrus.WithFields(logrus.Fields{"path": req.URL.Path, "instance": owner}).Debug("Forwarding request")
+	t.setForwardedHeaders(req.Header, callerIdentity(req))
+	t.proxies[owner].ServeHTTP(res, req)
+}
+
+// locate asks the other instances at once for the resources named by req,
+// and serves the answer of the one which does not answer that they are not
+// found, preferring successful answers. The instance is remembered only if it
+// succeeded, as other answers, like failed authentications, do not tell where
+// the resources are. The answer of h is served if no instance stores them.
+func (t *TypeShards) locate(names []string, h http.Handler, res http.ResponseWriter, req *http.Request) {
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		returnAndLogError(res, badRequestError(fmt.Sprintf("failed to read the request: %v", err)), "Bad request")
+		return
+	}
+	header := req.Header.Clone()
+	t.setForwardedHeaders(header, callerIdentity(req))
+	responses := make([]*http.Response, len(t.names))
+	var wg sync.WaitGroup
+	for idx, instance := range t.names {
+		if instance == t.self {
+			continue
+		}
+		u := *t.urls[instance]
+		u.Path = strings.TrimSuffix(u.Path, "/") + req.URL.Path
+		u.RawQuery = req.URL.RawQuery
+		forwarded, err := http.NewRequestWithContext(req.Context(), req.Method, u.String(), bytes.NewReader(body))
+		if err != nil {
+			logrus.WithError(err).Error("Failed to create forwarded request")
+			continue
+		}
+		forwarded.Header = header.Clone()
+		wg.Add(1)
+		go func(idx int, instance string) {
+			defer wg.Done()
+			resp, err := t.client.Do(forwarded)
+			if err != nil {
+				logrus.WithError(err).WithField("instance", instance).Warning("Failed to forward request")
+				return
+			}
+			responses[idx] = resp
+		}(idx, instance)
+	}
+	wg.Wait()
+
+	chosen := -1
+	for idx, resp := range responses {
+		if resp == nil || resp.StatusCode == http.StatusNotFound {
+			continue
+		}
+		if chosen < 0 || (!succeeded(responses[chosen].StatusCode) && succeeded(resp.StatusCode)) {
+			chosen = idx
+		}
+	}
+	for idx, resp := range responses {
+		if resp != nil && idx != chosen {
+			resp.Body.Close()
+		}
+	}
+	if chosen < 0 {
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		h.ServeHTTP(res, req)
+		return
+	}
+	instance, resp := t.names[chosen], responses[chosen]
+	defer resp.Body.Close()
+	if succeeded(resp.StatusCode) {
+		t.remember(names, instance)
+	}
+	for key, values := range resp.Header {
+		res.Header()[key] = values
+	}
+	res.WriteHeader(resp.StatusCode)
+	if _, err := io.Copy(res, resp.Body); err != nil {
+		logrus.WithError(err).WithField("instance", instance).Warning("Failed to copy forwarded response")
+	}
+}
+
+func succeeded(code int) bool {
+	return code >= 200 && code < 300
+}
+
+// forwardedIdentityClaims are the identity of the caller of a forwarded
+// request, as signed by the forwarding instance.
+type forwardedIdentityClaims struct {
+	Name   string      `json:"name"`
+	Tenant string      `json:"tenant,omitempty"`
+	Admin  bool        `json:"admin,omitempty"`
+	Scope  *TokenScope `json:"scope,omitempty"`
+	Expiry int64       `json:"expiry"`
+}
+
+func (t *TypeShards) sign(payload string) string {
+	mac := hmac.New(sha256.New, t.secret)
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signIdentity returns identity signed with the secret of the instances. The
+// second return value is false if there is no secret or no authenticated
+// caller, in which case the owning instance authenticates the caller itself.
+func (t *TypeShards) signIdentity(identity *Identity) (string, bool) {
+	if len(t.secret) == 0 || identity == nil || identity.Name == "" {
+		return "", false
+	}
+	claims, err := json.Marshal(forwardedIdentityClaims{
+		Name:   identity.Name,
+		Tenant: identity.Tenant,
+		Admin:  identity.Admin,
+		Scope:  identity.scope,
+		Expiry: t.now().Add(forwardedIdentityTTL).Unix(),
+	})
+	if err != nil {
+		logrus.WithError(err).Error("Failed to marshal the forwarded identity")
+		return "", false
+	}
+	payload := base64.RawURLEncoding.EncodeToString(claims)
+	return payload + "." + t.sign(payload), true
+}
+
+// verifyIdentity returns the identity signed by another instance, or an error
+// if its signature is invalid or it expired.
+func (t *TypeShards) verifyIdentity(signed string) (*Identity, error) {
+	if len(t.secret) == 0 {
+		return nil, fmt.Errorf("no secret to verify the forwarded identity with")
+	}
+	idx := strings.LastIndex(signed, ".")
+	if idx < 0 || !hmac.Equal([]byte(signed[idx+1:]), []byte(t.sign(signed[:idx]))) {
+		return nil, fmt.Errorf("invalid signature of the forwarded identity")
+	}
+	b, err := base64.RawURLEncoding.DecodeString(signed[:idx])
+	if err != nil {
+		return nil, fmt.Errorf("invalid forwarded identity: %v", err)
+	}
+	claims := forwardedIdentityClaims{}
+	if err := json.Unmarshal(b, &claims); err != nil {
+		return nil, fmt.Errorf("invalid forwarded identity: %v", err)
+	}
+	if !t.now().Before(time.Unix(claims.Expiry, 0)) {
+		return nil, fmt.Errorf("the forwarded identity of %s expired", claims.Name)
+	}
+	return &Identity{Name: claims.Name, Tenant: claims.Tenant, Admin: claims.Admin, scope: claims.Scope}, nil
+}
+
+// UnaryServerInterceptor forwards the gRPC calls for resource types owned by
+// other instances to their owner, like Wrap does for HTTP requests. It must
+// run after the interceptor authenticating the calls.
+func (t *TypeShards) UnaryServerInterceptor(r *ranch.Ranch) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		if len(md.Get(common.ForwardedByHeader)) > 0 {
+			return handler(ctx, req)
+		}
+		var rType, name string
+		var newReply func() interface{}
+		switch req := req.(type) {
+		case *boskospb.AcquireRequest:
+			rType, newReply = req.Type, func() interface{} { return &boskospb.Resource{} }
+		case *boskospb.ResetRequest:
+			rType, newReply = req.Type, func() interface{} { return &boskospb.ResetResponse{} }
+		case *boskospb.MetricRequest:
+			rType, newReply = req.Type, func() interface{} { return &boskospb.MetricResponse{} }
+		case *boskospb.ReleaseRequest:
+			name, newReply = req.Name, func() interface{} { return &boskospb.ReleaseResponse{} }
+		case *boskospb.UpdateRequest:
+			name, newReply = req.Name, func() interface{} { return &boskospb.UpdateResponse{} }
+		default:
+			return handler(ctx, req)
+		}
+		outgoing := metadata.MD{}
+		for _, key := range []string{"authorization", common.TenantHeader} {
+			if values := md.Get(key); len(values) > 0 {
+				outgoing.Set(key, values...)
+			}
+		}
+		outgoing.Set(common.ForwardedByHeader, t.self)
+		if signed, ok := t.signIdentity(contextIdentity(ctx)); ok {
+			outgoing.Set(common.ForwardedIdentityHeader, signed)
+		}
+		forwardCtx := metadata.NewOutgoingContext(ctx, outgoing)
+
+		if rType != "" {
+			if owner := t.Owner(rType); owner != t.self {
+				return t.invoke(forwardCtx, owner, info.FullMethod, req, newReply())
+			}
+			return handler(ctx, req)
+		}
+		names, err := t.remoteNames(r.WithContext(ctx), []string{name})
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to locate resource %s: %v", name, err)
+		}
+		if len(names) == 0 {
+			return handler(ctx, req)
+		}
+		if owner, ok := t.locatedAll(names); ok {
+			return t.invoke(forwardCtx, owner, info.FullMethod, req, newReply())
+		}
+		return t.locateCall(forwardCtx, names, info.FullMethod, req, newReply, func() (interface{}, error) { return handler(ctx, req) })
+	}
+}
+
+// invoke forwards the gRPC call to method to the instance owner.
+func (t *TypeShards) invoke(ctx context.Context, owner, method string, req, reply interface{}) (interface{}, error) {
+	conn, err := t.conn(owner)
+	if err != nil {
+		return nil, err
+	}
+	logrus.WithFields(logrus.Fields{"method": method, "instance": owner}).Debug("Forwarding call")
+	if err := conn.Invoke(ctx, method, req, reply); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// conn returns the gRPC connection to the instance name, dialing it first.
+func (t *TypeShards) conn(name string) (*grpc.ClientConn, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if conn, ok := t.conns[name]; ok {
+		return conn, nil
+	}
+	addr, ok := t.grpcAddrs[name]
+	if !ok {
+		return nil, status.Errorf(codes.FailedPrecondition, "the resources are served by instance %s, which has no gRPC address", name)
+	}
+	conn, err := grpc.Dial(addr, grpc.WithInsecure())
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "failed to dial instance %s: %v", name, err)
+	}
+	t.conns[name] = conn
+	return conn, nil
+}
+
+// locateCall asks the other instances with a gRPC address at once for the
+// resources named by the call, like locate. serve serves the call locally if
+// no instance stores them.
+func (t *TypeShards) locateCall(ctx context.Context, names []string, method string, req interface{}, newReply func() interface{}, serve func() (interface{}, error)) (interface{}, error) {
+	replies := make([]interface{}, len(t.names))
+	errs := make([]error, len(t.names))
+	var wg sync.WaitGroup
+	for idx, instance := range t.names {
+		if _, ok := t.grpcAddrs[instance]; !ok || instance == t.self {
+			errs[idx] = status.Error(codes.NotFound, "not asked")
+			continue
+		}
+		wg.Add(1)
+		go func(idx int, instance string) {
+			defer wg.Done()
+			replies[idx], errs[idx] = t.invoke(ctx, instance, method, req, newReply())
+		}(idx, instance)
+	}
+	wg.Wait()
+
+	chosen := -1
+	for idx, err := range errs {
+		if status.Code(err) == codes.NotFound {
+			continue
+		}
+		if chosen < 0 || (errs[chosen] != nil && err == nil) {
+			chosen = idx
+		}
+	}
+	if chosen < 0 {
+		return serve()
+	}
+	if errs[chosen] != nil {
+		return nil, errs[chosen]
+	}
+	t.remember(names, t.names[chosen])
+	return replies[chosen], nil
+}
@@ -0,0 +1,323 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	fakectrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"sigs.k8s.io/boskos/boskospb"
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/ranch"
+)
+
+func TestNewTypeShards(t *testing.T) {
+	instances := []TypeShardInstance{{Name: "a", URL: "http://a:8080"}, {Name: "b", URL: "http://b:8080"}}
+	testCases := []struct {
+		name   string
+		config TypeShardConfig
+		self   string
+		valid  bool
+	}{
+		{
+			name:   "valid",
+			config: TypeShardConfig{Instances: instances, Assignments: map[string]string{"t": "b"}},
+			self:   "a",
+			valid:  true,
+		},
+		{
+			name:   "self not an instance",
+			config: TypeShardConfig{Instances: instances},
+			self:   "c",
+		},
+		{
+			name:   "assigned to an unknown instance",
+			config: TypeShardConfig{Instances: instances, Assignments: map[string]string{"t": "c"}},
+			self:   "a",
+		},
+		{
+			name:   "duplicate instance",
+			config: TypeShardConfig{Instances: append(instances, TypeShardInstance{Name: "a", URL: "http://c:8080"})},
+			self:   "a",
+		},
+		{
+			name:   "invalid URL",
+			config: TypeShardConfig{Instances: []TypeShardInstance{{Name: "a", URL: "a:8080"}}},
+			self:   "a",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			shards, err := NewTypeShards(&tc.config, tc.self)
+			if valid := err == nil; valid != tc.valid {
+				t.Fatalf("expected valid %t, got error %v", tc.valid, err)
+			}
+			if !tc.valid {
+				return
+			}
+			if owner := shards.Owner("t"); owner != "b" {
+				t.Errorf("expected the assigned type to be owned by b, got %s", owner)
+			}
+			if owner := shards.Owner("other"); owner != shards.Owner("other") {
+				t.Errorf("expected the hash assignment to be stable")
+			}
+		})
+	}
+}
+
+func TestTypeShardsForward(t *testing.T) {
+	ranchA := MakeTestRanch([]runtime.Object{newResource("res-a", "ta", common.Free, "", fakeNow)})
+	ranchB := MakeTestRanch([]runtime.Object{
+		newResource("res-b", "tb", common.Free, "", fakeNow),
+		newResource("res-b2", "tb", common.Free, "", fakeNow),
+		newResource("res-b3", "tb", common.Free, "", fakeNow),
+	})
+	var handlerA, handlerB http.Handler
+	serverA := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { handlerA.ServeHTTP(w, r) }))
+	defer serverA.Close()
+	serverB := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { handlerB.ServeHTTP(w, r) }))
+	defer serverB.Close()
+	config := &TypeShardConfig{
+		Instances:   []TypeShardInstance{{Name: "a", URL: serverA.URL}, {Name: "b", URL: serverB.URL}},
+		Assignments: map[string]string{"ta": "a", "tb": "b"},
+	}
+	shardsA, err := NewTypeShards(config, "a")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	shardsB, err := NewTypeShards(config, "b")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	handlerA = shardsA.Wrap(ranchA, NewBoskosHandler(ranchA))
+	handlerB = shardsB.Wrap(ranchB, NewBoskosHandler(ranchB))
+
+	post := func(target string) int {
+		resp, err := http.Post(serverA.URL+target, "", nil)
+		if err != nil {
+			t.Fatalf("failed to post %s: %v", target, err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := post("/acquire?type=tb&state=free&dest=busy&owner=owner"); code != http.StatusOK {
+		t.Fatalf("expected the acquire to be forwarded, got %d", code)
+	}
+	if res, err := ranchB.Storage.GetResource("res-b"); err != nil || res.Status.Owner != "owner" {
+		t.Fatalf("expected res-b to be acquired on b, got %+v, %v", res, err)
+	}
+	if code := post("/release?name=res-b&dest=dirty&owner=owner"); code != http.StatusOK {
+		t.Fatalf("expected the release to be forwarded, got %d", code)
+	}
+	if res, err := ranchB.Storage.GetResource("res-b"); err != nil || res.Status.State != common.Dirty {
+		t.Fatalf("expected res-b to be released on b, got %+v, %v", res, err)
+	}
+	if located := shardsA.located["res-b"]; located.instance != "b" {
+		t.Errorf("expected res-b to be located on b, got %q", located.instance)
+	}
+	if code := post("/acquirebatch?types=tb:1&state=free&dest=busy&owner=batch"); code != http.StatusOK {
+		t.Fatalf("expected the batch acquire to be forwarded, got %d", code)
+	}
+	if code := post("/acquirebystate?names=res-b3&state=free&dest=busy&owner=owner"); code != http.StatusOK {
+		t.Fatalf("expected the acquire by state to be forwarded, got %d", code)
+	}
+	if res, err := ranchB.Storage.GetResource("res-b3"); err != nil || res.Status.Owner != "owner" {
+		t.Fatalf("expected res-b3 to be acquired on b, got %+v, %v", res, err)
+	}
+	// The failed release of another owner leaves the location unknown.
+	if code := post("/release?name=res-b2&dest=dirty&owner=other"); code == http.StatusOK || code == http.StatusNotFound {
+		t.Fatalf("expected the release of another owner to fail on b, got %d", code)
+	}
+	if _, ok := shardsA.located["res-b2"]; ok {
+		t.Error("expected a failed answer not to locate res-b2")
+	}
+	shardsA.now = func() time.Time { return time.Now().Add(locationTTL) }
+	if _, ok := shardsA.locatedAll([]string{"res-b"}); ok {
+		t.Error("expected the location of res-b to expire")
+	}
+	if code := post("/acquire?type=ta&state=free&dest=busy&owner=owner"); code != http.StatusOK {
+		t.Fatalf("expected the acquire to be served locally, got %d", code)
+	}
+	if code := post("/release?name=missing&dest=dirty&owner=owner"); code != http.StatusNotFound {
+		t.Errorf("expected a missing resource to be not found, got %d", code)
+	}
+}
+
+// unavailableGetClient fails every get with a storage error.
+type unavailableGetClient struct {
+	ctrlruntimeclient.Client
+}
+
+func (c *unavailableGetClient) Get(ctx context.Context, key ctrlruntimeclient.ObjectKey, obj ctrlruntimeclient.Object) error {
+	return errors.New("storage unavailable")
+}
+
+func TestTypeShardsLocalStorageFailure(t *testing.T) {
+	client := &unavailableGetClient{Client: fakectrlruntimeclient.NewFakeClient()}
+	r, _ := ranch.NewRanch("", ranch.NewTestingStorage(client, "test", func() metav1.Time { return fakeNow }), testTTL)
+	var forwarded int
+	serverB := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { forwarded++ }))
+	defer serverB.Close()
+	shards, err := NewTypeShards(&TypeShardConfig{
+		Instances: []TypeShardInstance{{Name: "a", URL: "http://a:8080"}, {Name: "b", URL: serverB.URL}},
+	}, "a")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	shards.Wrap(r, NewBoskosHandler(r)).ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/release?name=res&dest=dirty&owner=owner", nil))
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("expected the storage failure to be returned, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if forwarded != 0 {
+		t.Errorf("expected no request to be forwarded, got %d", forwarded)
+	}
+}
+
+func TestTypeShardsForwardScopedToken(t *testing.T) {
+	ranchA := MakeTestRanch(nil)
+	ranchB := MakeTestRanch([]runtime.Object{newResource("res-b", "tb", common.Free, "", fakeNow)})
+	var handlerA, handlerB http.Handler
+	serverA := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { handlerA.ServeHTTP(w, r) }))
+	defer serverA.Close()
+	serverB := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { handlerB.ServeHTTP(w, r) }))
+	defer serverB.Close()
+	secretFile := filepath.Join(t.TempDir(), "secret")
+	if err := ioutil.WriteFile(secretFile, []byte("secret\n"), 0600); err != nil {
+		t.Fatalf("failed to write secret file: %v", err)
+	}
+	config := &TypeShardConfig{
+		Instances:   []TypeShardInstance{{Name: "a", URL: serverA.URL}, {Name: "b", URL: serverB.URL}},
+		Assignments: map[string]string{"tb": "b"},
+		SecretFile:  secretFile,
+	}
+	shardsA, err := NewTypeShards(config, "a")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	shardsB, err := NewTypeShards(config, "b")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	authA, authB := makeTestAuthenticator(t), makeTestAuthenticator(t)
+	authA.TrustTypeShards(shardsA)
+	authB.TrustTypeShards(shardsB)
+	handlerA = authA.Wrap(shardsA.Wrap(ranchA, NewBoskosHandler(ranchA)))
+	handlerB = authB.Wrap(shardsB.Wrap(ranchB, NewBoskosHandler(ranchB)))
+
+	token, err := authA.tokens.mint(context.Background(), "team-a-job", "", TokenScope{Verbs: []string{"acquire"}}, time.Hour)
+	if err != nil {
+		t.Fatalf("failed to mint token: %v", err)
+	}
+	post := func(url string, header http.Header) int {
+		req, err := http.NewRequest(http.MethodPost, url, nil)
+		if err != nil {
+			t.Fatalf("failed to create request: %v", err)
+		}
+		req.Header = header
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("failed to post %s: %v", url, err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	bearer := http.Header{"Authorization": []string{"Bearer " + token.Token}}
+	if code := post(serverB.URL+"/acquire?type=tb&state=free&dest=busy&owner=team-a-job", bearer); code != http.StatusUnauthorized {
+		t.Errorf("expected b not to know the token of a, got %d", code)
+	}
+	forged := http.Header{common.ForwardedByHeader: []string{"a"}, common.ForwardedIdentityHeader: []string{"e30.forged"}}
+	if code := post(serverB.URL+"/acquire?type=tb&state=free&dest=busy&owner=team-a-job", forged); code != http.StatusUnauthorized {
+		t.Errorf("expected a forged identity to be rejected, got %d", code)
+	}
+	if code := post(serverA.URL+"/acquire?type=tb&state=free&dest=busy&owner=team-a-job", bearer); code != http.StatusOK {
+		t.Fatalf("expected the acquire with the token of a to be forwarded on its behalf, got %d", code)
+	}
+	if res, err := ranchB.Storage.GetResource("res-b"); err != nil || res.Status.Owner != "team-a-job" {
+		t.Fatalf("expected res-b to be acquired on b, got %+v, %v", res, err)
+	}
+}
+
+func TestTypeShardsForwardGRPC(t *testing.T) {
+	ranchA := MakeTestRanch([]runtime.Object{newResource("res-a", "ta", common.Free, "", fakeNow)})
+	ranchB := MakeTestRanch([]runtime.Object{newResource("res-b", "tb", common.Free, "", fakeNow)})
+	listenerA, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	listenerB, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	config := &TypeShardConfig{
+		Instances: []TypeShardInstance{
+			{Name: "a", URL: "http://a:8080", GRPCAddress: listenerA.Addr().String()},
+			{Name: "b", URL: "http://b:8080", GRPCAddress: listenerB.Addr().String()},
+		},
+		Assignments: map[string]string{"ta": "a", "tb": "b"},
+	}
+	for _, tc := range []struct {
+		name     string
+		r        *ranch.Ranch
+		listener net.Listener
+	}{{"a", ranchA, listenerA}, {"b", ranchB, listenerB}} {
+		shards, err := NewTypeShards(config, tc.name)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		server := grpc.NewServer(grpc.ChainUnaryInterceptor(shards.UnaryServerInterceptor(tc.r)))
+		boskospb.RegisterBoskosServer(server, NewBoskosGRPCServer(tc.r))
+		go server.Serve(tc.listener)
+		defer server.Stop()
+	}
+	conn, err := grpc.Dial(listenerA.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer conn.Close()
+	client := boskospb.NewBoskosClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	res, err := client.Acquire(ctx, &boskospb.AcquireRequest{Type: "tb", State: common.Free, Dest: common.Busy, Owner: "owner"})
+	if err != nil || res.Name != "res-b" {
+		t.Fatalf("expected the acquire to be forwarded to b, got %+v, %v", res, err)
+	}
+	if _, err := client.Release(ctx, &boskospb.ReleaseRequest{Name: "res-b", Dest: common.Dirty, Owner: "owner"}); err != nil {
+		t.Fatalf("expected the release to be forwarded to b, got %v", err)
+	}
+	if stored, err := ranchB.Storage.GetResource("res-b"); err != nil || stored.Status.State != common.Dirty {
+		t.Fatalf("expected res-b to be released on b, got %+v, %v", stored, err)
+	}
+	if res, err := client.Acquire(ctx, &boskospb.AcquireRequest{Type: "ta", State: common.Free, Dest: common.Busy, Owner: "owner"}); err != nil || res.Name != "res-a" {
+		t.Errorf("expected the acquire to be served by a, got %+v, %v", res, err)
+	}
+}
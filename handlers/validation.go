@@ -0,0 +1,172 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"k8s.io/apimachinery/pkg/labels"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/ranch"
+)
+
+const (
+	// maxRequestBodyBytes bounds request bodies, which only ever carry user data.
+	maxRequestBodyBytes = 1 << 20
+	// maxIdentifierLength matches the maximum length of a DNS-1123 subdomain,
+	// which is what resource names are validated against in the config.
+	maxIdentifierLength = 253
+	// maxFreeformLength bounds owners and request IDs.
+	maxFreeformLength = 1024
+	// maxNamesPerRequest bounds the number of resources acquired by state at once.
+	maxNamesPerRequest = 1000
+	// maxExpireDuration is the longest expiration accepted by /reset.
+	maxExpireDuration = 30 * 24 * time.Hour
+)
+
+// requestEntityTooLargeError is returned when a request body exceeds maxRequestBodyBytes.
+type requestEntityTooLargeError string
+
+func (e requestEntityTooLargeError) Error() string { return string(e) }
+
+// param is a named query parameter value to validate.
+type param struct {
+	name, value string
+}
+
+// validateIdentifiers ensures resource types, names and states only consist of
+// letters, digits, '-', '_' and '.', so typos and garbage are caught at the API
+// boundary rather than ending up in storage.
+func validateIdentifiers(params ...param) error {
+	for _, p := range params {
+		if len(p.value) > maxIdentifierLength {
+			return badRequestError(fmt.Sprintf("invalid %s: must be no more than %d characters", p.name, maxIdentifierLength))
+		}
+		for _, c := range p.value {
+			if c > unicode.MaxASCII || !(unicode.IsLetter(c) || unicode.IsDigit(c) || c == '-' || c == '_' || c == '.') {
+				return badRequestError(fmt.Sprintf("invalid %s %q: must only contain letters, digits, '-', '_' and '.'", p.name, p.value))
+			}
+		}
+	}
+	return nil
+}
+
+// validateFreeform ensures owners and request IDs are printable UTF-8 of sane length.
+func validateFreeform(params ...param) error {
+	for _, p := range params {
+		if len(p.value) > maxFreeformLength {
+			return badRequestError(fmt.Sprintf("invalid %s: must be no more than %d bytes", p.name, maxFreeformLength))
+		}
+		if !utf8.ValidString(p.value) {
+			return badRequestError(fmt.Sprintf("invalid %s: must be valid UTF-8", p.name))
+		}
+		for _, c := range p.value {
+			if !unicode.IsPrint(c) {
+				return badRequestError(fmt.Sprintf("invalid %s %q: must not contain control characters", p.name, p.value))
+			}
+		}
+	}
+	return nil
+}
+
+// validateStates ensures states requested for resources of type rtype are
+// among the states configured for the type, if any, so that typos like
+// "drity" fail at the API boundary instead of moving resources out of the pool.
+func validateStates(r *ranch.Ranch, rtype string, params ...param) error {
+	allowed, ok := r.AllowedStates(rtype)
+	if !ok {
+		return nil
+	}
+	for _, p := range params {
+		known := false
+		for _, state := range allowed {
+			known = known || p.value == state
+		}
+		if !known {
+			return badRequestError(fmt.Sprintf("invalid %s %q for resource type %s: must be one of %v", p.name, p.value, rtype, allowed))
+		}
+	}
+	return nil
+}
+
+// validateFlavor rejects selectors requiring a flavor rtype does not have.
+// Types without flavors may have a flavor in their user data all the same,
+// so they are only rejected if the flavor was requested explicitly.
+func validateFlavor(r *ranch.Ranch, rtype string, selector labels.Selector, explicit bool) error {
+	if selector == nil {
+		return nil
+	}
+	flavor, ok := selector.RequiresExactMatch(common.FlavorUserDataKey)
+	if !ok {
+		return nil
+	}
+	flavors, ok := r.Flavors(rtype)
+	if !ok {
+		if explicit {
+			return badRequestError(fmt.Sprintf("invalid flavor %q: resource type %s has no flavors", flavor, rtype))
+		}
+		return nil
+	}
+	for _, f := range flavors {
+		if f == flavor {
+			return nil
+		}
+	}
+	return badRequestError(fmt.Sprintf("invalid flavor %q for resource type %s: must be one of %v", flavor, rtype, flavors))
+}
+
+// validateExpire rejects negative, zero and absurdly long expiration durations.
+func validateExpire(expire time.Duration) error {
+	if expire <= 0 || expire > maxExpireDuration {
+		return badRequestError(fmt.Sprintf("invalid expire %v: must be positive and no longer than %v", expire, maxExpireDuration))
+	}
+	return nil
+}
+
+// readJSONBody reads a size limited request body. A non-empty body must be
+// valid UTF-8 and sent with a JSON content type.
+func readJSONBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(req.Body, maxRequestBodyBytes+1))
+	if err != nil {
+		return nil, badRequestError(fmt.Sprintf("unable to read request body: %v", err))
+	}
+	if len(body) > maxRequestBodyBytes {
+		return nil, requestEntityTooLargeError(fmt.Sprintf("request body must be no more than %d bytes", maxRequestBodyBytes))
+	}
+	if len(body) == 0 {
+		return nil, nil
+	}
+	mediaType, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		return nil, badRequestError(fmt.Sprintf("invalid Content-Type %q: must be application/json", req.Header.Get("Content-Type")))
+	}
+	if !utf8.Valid(body) {
+		return nil, badRequestError("request body must be valid UTF-8")
+	}
+	return body, nil
+}
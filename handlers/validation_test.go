@@ -0,0 +1,165 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+func TestValidateParams(t *testing.T) {
+	testCases := []struct {
+		name  string
+		err   error
+		valid bool
+	}{
+		{name: "valid identifiers", err: validateIdentifiers(param{"type", "gce-project"}, param{"state", "toBeDeleted"}), valid: true},
+		{name: "identifier with space", err: validateIdentifiers(param{"state", "dirty "})},
+		{name: "identifier with slash", err: validateIdentifiers(param{"name", "../etc"})},
+		{name: "non ascii identifier", err: validateIdentifiers(param{"state", "frée"})},
+		{name: "too long identifier", err: validateIdentifiers(param{"name", strings.Repeat("a", maxIdentifierLength+1)})},
+		{name: "valid owner", err: validateFreeform(param{"owner", "pull-kubernetes-e2e/1234 (retry)"}), valid: true},
+		{name: "owner with newline", err: validateFreeform(param{"owner", "job\nfake log line"})},
+		{name: "owner with invalid utf-8", err: validateFreeform(param{"owner", "\xff"})},
+		{name: "valid expire", err: validateExpire(30 * time.Minute), valid: true},
+		{name: "negative expire", err: validateExpire(-time.Minute)},
+		{name: "absurd expire", err: validateExpire(100 * 365 * 24 * time.Hour)},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if (tc.err == nil) != tc.valid {
+				t.Fatalf("expected valid: %t, got error %v", tc.valid, tc.err)
+			}
+			if tc.err != nil && errorToStatus(tc.err) != http.StatusBadRequest {
+				t.Errorf("expected status %d, got %d", http.StatusBadRequest, errorToStatus(tc.err))
+			}
+		})
+	}
+}
+
+func TestUpdateBodyHardening(t *testing.T) {
+	testCases := []struct {
+		name        string
+		body        []byte
+		contentType string
+		code        int
+	}{
+		{
+			name:        "valid body",
+			body:        []byte(`{"key":"value"}`),
+			contentType: "application/json; charset=utf-8",
+			code:        http.StatusOK,
+		},
+		{
+			name:        "missing content type",
+			body:        []byte(`{"key":"value"}`),
+			contentType: "",
+			code:        http.StatusBadRequest,
+		},
+		{
+			name:        "invalid utf-8",
+			body:        []byte("{\"key\":\"\xff\"}"),
+			contentType: "application/json",
+			code:        http.StatusBadRequest,
+		},
+		{
+			name:        "too large",
+			body:        append(append([]byte(`{"key":"`), bytes.Repeat([]byte("a"), maxRequestBodyBytes)...), []byte(`"}`)...),
+			contentType: "application/json",
+			code:        http.StatusRequestEntityTooLarge,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := MakeTestRanch(nil)
+			if err := r.Storage.AddResource(newResource("res", "t", "s", "merlin", fakeNow)); err != nil {
+				t.Fatalf("failed to add resource: %v", err)
+			}
+			req := httptest.NewRequest(http.MethodPost, "/update?name=res&state=s&owner=merlin", bytes.NewReader(tc.body))
+			if tc.contentType != "" {
+				req.Header.Set("Content-Type", tc.contentType)
+			}
+			rr := httptest.NewRecorder()
+			handleUpdate(r).ServeHTTP(rr, req)
+			if rr.Code != tc.code {
+				t.Errorf("expected code %d, got %d: %s", tc.code, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestValidateStates(t *testing.T) {
+	r := MakeTestRanch(nil)
+	if err := r.ApplyConfig(&common.BoskosConfig{Resources: []common.ResourceEntry{
+		{Type: "strict", State: common.Dirty, Names: []string{"strict-1"}, States: []string{common.Busy, common.Dirty, common.Free}},
+		{Type: "lax", State: common.Dirty, Names: []string{"lax-1"}},
+	}}); err != nil {
+		t.Fatalf("failed to apply config: %v", err)
+	}
+	testCases := []struct {
+		name       string
+		path       string
+		handler    http.HandlerFunc
+		expectCode int
+		expectBody string
+	}{
+		{
+			name:       "acquire with allowed states",
+			path:       "/acquire?type=strict&state=dirty&dest=busy&owner=merlin",
+			handler:    handleAcquire(r),
+			expectCode: http.StatusOK,
+		},
+		{
+			name:       "acquire with a typo",
+			path:       "/acquire?type=strict&state=drity&dest=busy&owner=merlin",
+			handler:    handleAcquire(r),
+			expectCode: http.StatusBadRequest,
+			expectBody: "must be one of [busy dirty free]",
+		},
+		{
+			name:       "type without allowed states",
+			path:       "/acquire?type=lax&state=dirty&dest=custom&owner=merlin",
+			handler:    handleAcquire(r),
+			expectCode: http.StatusOK,
+		},
+		{
+			name:       "release with a typo",
+			path:       "/release?name=strict-1&dest=drity&owner=merlin",
+			handler:    handleRelease(r),
+			expectCode: http.StatusBadRequest,
+			expectBody: "must be one of [busy dirty free]",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			tc.handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, tc.path, nil))
+			if rr.Code != tc.expectCode {
+				t.Fatalf("expected code %d, got %d: %s", tc.expectCode, rr.Code, rr.Body.String())
+			}
+			if !strings.Contains(rr.Body.String(), tc.expectBody) {
+				t.Errorf("expected body to contain %q, got %q", tc.expectBody, rr.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/ranch"
+)
+
+// v2Prefix is the prefix of the endpoints of the v2 API.
+const v2Prefix = "/v2"
+
+// errorToAPICode returns the code of the APIError of err, or an empty string
+// to identify it by its HTTP status.
+func errorToAPICode(err error) string {
+	switch err.(type) {
+	case *ranch.ResourceNotFound:
+		return common.ErrorResourceNotFound
+	case *ranch.ResourceTypeNotFound:
+		return common.ErrorResourceTypeNotFound
+	case *ranch.OwnerNotMatch:
+		return common.ErrorOwnerMismatch
+	case *ranch.StateNotMatch:
+		return common.ErrorStateMismatch
+	case *ranch.QuotaExceeded:
+		return common.ErrorQuotaExceeded
+	case *ranch.LameDuck:
+		return common.ErrorLameDuck
+	case *ranch.ReadOnly:
+		return common.ErrorReadOnly
+	case *ranch.NotLeader:
+		return common.ErrorNotLeader
+	case *ranch.TenantMismatch:
+		return common.ErrorTenantMismatch
+	case *ranch.TransitionDenied:
+		return common.ErrorTransitionDenied
+	case *ranch.TransitionNotAllowed:
+		return common.ErrorTransitionNotAllowed
+	case *ranch.PolicyDenied:
+		return common.ErrorPolicyDenied
+	case *ranch.ApprovalPending:
+		return common.ErrorApprovalPending
+	case *ranch.ApprovalDenied:
+		return common.ErrorApprovalDenied
+	case *ranch.ApprovalBacklogFull:
+		return common.ErrorApprovalBacklogFull
+	case *ranch.UserDataTooLarge:
+		return common.ErrorUserDataTooLarge
+	case badRequestError, *ranch.UnknownSLAWindow:
+		return common.ErrorBadRequest
+	default:
+		return ""
+	}
+}
+
+// structuredErrorWriter turns the plain text errors written by the handlers
+// into APIErrors. Errors already written as JSON, like WaitEstimateExceeded,
+// are left alone.
+type structuredErrorWriter struct {
+	http.ResponseWriter
+	// code is set by returnAndLogError to the code of the error.
+	code    string
+	status  int
+	message bytes.Buffer
+}
+
+func (w *structuredErrorWriter) WriteHeader(status int) {
+	if status >= http.StatusBadRequest && strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		w.status = status
+		return
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *structuredErrorWriter) Write(b []byte) (int, error) {
+	if w.status != 0 {
+		return w.message.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush lets streaming handlers like handleWatch flush through the writer.
+func (w *structuredErrorWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok && w.status == 0 {
+		flusher.Flush()
+	}
+}
+
+// finish writes the buffered error, if any, as an APIError.
+func (w *structuredErrorWriter) finish() {
+	if w.status == 0 {
+		return
+	}
+	code := w.code
+	if code == "" {
+		code = strings.ReplaceAll(http.StatusText(w.status), " ", "")
+	}
+	js, err := json.Marshal(common.APIError{Code: code, Message: strings.TrimSpace(w.message.String())})
+	if err != nil {
+		logrus.WithError(err).Error("Fail to marshal API error")
+		w.ResponseWriter.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.ResponseWriter.WriteHeader(w.status)
+	w.ResponseWriter.Write(js)
+}
+
+// withStructuredErrors serves the errors of h as APIErrors.
+func withStructuredErrors(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		w := &structuredErrorWriter{ResponseWriter: res}
+		h.ServeHTTP(w, req)
+		w.finish()
+	})
+}
+
+// withAPIVersion tells the clients of h the latest version of the API.
+func withAPIVersion(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set(common.APIVersionHeader, common.APIVersion)
+		h.ServeHTTP(res, req)
+	})
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+func TestV2StructuredErrors(t *testing.T) {
+	handler := NewBoskosHandler(MakeTestRanch([]runtime.Object{
+		newResource("res", "t", common.Busy, "owner", fakeNow),
+	}))
+	testCases := []struct {
+		name       string
+		method     string
+		path       string
+		expectCode int
+		expectErr  string
+	}{
+		{
+			name:       "unknown type",
+			method:     http.MethodPost,
+			path:       "/v2/acquire?type=u&state=free&dest=busy&owner=o",
+			expectCode: http.StatusNotFound,
+			expectErr:  common.ErrorResourceTypeNotFound,
+		},
+		{
+			name:       "no free resource",
+			method:     http.MethodPost,
+			path:       "/v2/acquire?type=t&state=free&dest=busy&owner=o",
+			expectCode: http.StatusNotFound,
+			expectErr:  common.ErrorResourceNotFound,
+		},
+		{
+			name:       "another owner",
+			method:     http.MethodPost,
+			path:       "/v2/release?name=res&dest=dirty&owner=o",
+			expectCode: http.StatusUnauthorized,
+			expectErr:  common.ErrorOwnerMismatch,
+		},
+		{
+			name:       "missing parameters",
+			method:     http.MethodPost,
+			path:       "/v2/acquire?type=t",
+			expectCode: http.StatusBadRequest,
+			expectErr:  common.ErrorBadRequest,
+		},
+		{
+			name:       "error not written by returnAndLogError",
+			method:     http.MethodGet,
+			path:       "/v2/acquire?type=t&state=free&dest=busy&owner=o",
+			expectCode: http.StatusMethodNotAllowed,
+			expectErr:  "MethodNotAllowed",
+		},
+		{
+			name:       "unversioned API",
+			method:     http.MethodPost,
+			path:       "/acquire?type=u&state=free&dest=busy&owner=o",
+			expectCode: http.StatusNotFound,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(tc.method, tc.path, nil))
+			if rr.Code != tc.expectCode {
+				t.Fatalf("expected code %d, got %d: %s", tc.expectCode, rr.Code, rr.Body.String())
+			}
+			if version := rr.Header().Get(common.APIVersionHeader); version != common.APIVersion {
+				t.Errorf("expected API version %s, got %q", common.APIVersion, version)
+			}
+			if tc.expectErr == "" {
+				if contentType := rr.Header().Get("Content-Type"); contentType != "text/plain; charset=utf-8" {
+					t.Errorf("expected a plain text error, got %s", contentType)
+				}
+				return
+			}
+			var apiErr common.APIError
+			if err := json.Unmarshal(rr.Body.Bytes(), &apiErr); err != nil {
+				t.Fatalf("failed to unmarshal error %q: %v", rr.Body.String(), err)
+			}
+			if apiErr.Code != tc.expectErr || apiErr.Message == "" {
+				t.Errorf("expected error %s with a message, got %+v", tc.expectErr, apiErr)
+			}
+		})
+	}
+}
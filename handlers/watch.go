@@ -0,0 +1,106 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/ranch"
+)
+
+// watchKeepAlivePeriod is how often an idle stream gets a comment, so proxies
+// don't time it out.
+var watchKeepAlivePeriod = 30 * time.Second
+
+//  handleWatch: Handler for /watch
+//  Method: GET
+// 	URLParams:
+//		Optional: type=[string] : comma-separated types of the resources to watch, all if empty
+//  Streams the changes of the states of the resources as server-sent events,
+//  until the client disconnects. Owners the caller cannot see are redacted.
+func handleWatch(r *ranch.Ranch) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		logrus.WithField("handler", "handleWatch").Infof("From %v", req.RemoteAddr)
+
+		if req.Method != http.MethodGet {
+			msg := fmt.Sprintf("Method %v, /watch only accepts GET.", req.Method)
+			logrus.Warning(msg)
+			http.Error(res, msg, http.StatusMethodNotAllowed)
+			return
+		}
+		var types []string
+		if v := req.URL.Query().Get("type"); v != "" {
+			types = strings.Split(v, ",")
+		}
+		for i := range types {
+			if err := validateIdentifiers(param{"type", types[i]}); err != nil {
+				returnAndLogError(res, err, "Bad request")
+				return
+			}
+			if err := resolveType(res, req, r, "", &types[i]); err != nil {
+				returnAndLogError(res, err, "Bad request")
+				return
+			}
+		}
+
+		identity := callerIdentity(req)
+		events, stop := r.Watch(types...)
+		defer stop()
+		res.Header().Set("Content-Type", "text/event-stream")
+		res.Header().Set("Cache-Control", "no-cache")
+		res.WriteHeader(http.StatusOK)
+		flush := func() {
+			if flusher, ok := res.(http.Flusher); ok {
+				flusher.Flush()
+			}
+		}
+		flush()
+
+		keepAlive := time.NewTicker(watchKeepAlivePeriod)
+		defer keepAlive.Stop()
+		for {
+			select {
+			case <-req.Context().Done():
+				return
+			case <-keepAlive.C:
+				fmt.Fprint(res, ": keep-alive\n\n")
+			case event, ok := <-events:
+				if !ok {
+					// Dropped for lagging behind, the client must reconnect.
+					return
+				}
+				if !identity.CanSeeOwner(event.Owner) {
+					event.Owner = common.Other
+				}
+				js, err := json.Marshal(event)
+				if err != nil {
+					logrus.WithError(err).Error("Fail to marshal resource event")
+					return
+				}
+				fmt.Fprintf(res, "event: %s\ndata: %s\n\n", event.Kind, js)
+			}
+			flush()
+		}
+	}
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+func TestWatch(t *testing.T) {
+	r := MakeTestRanch([]runtime.Object{
+		newResource("res", "t", common.Busy, "owner", fakeNow),
+		newResource("other", "u", common.Busy, "owner", fakeNow),
+	})
+	server := httptest.NewServer(NewBoskosHandler(r))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/watch?type=t")
+	if err != nil {
+		t.Fatalf("failed to watch: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("expected an event stream, got %d with %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	if err := r.Release("other", common.Dirty, "owner"); err != nil {
+		t.Fatalf("failed to release: %v", err)
+	}
+	if err := r.Release("res", common.Dirty, "owner"); err != nil {
+		t.Fatalf("failed to release: %v", err)
+	}
+
+	lines := bufio.NewReader(resp.Body)
+	var kind string
+	for {
+		line, err := lines.ReadString('\n')
+		if err != nil {
+			t.Fatalf("failed to read the event stream: %v", err)
+		}
+		if strings.HasPrefix(line, "event: ") {
+			kind = strings.TrimSpace(strings.TrimPrefix(line, "event: "))
+		}
+		if strings.HasPrefix(line, "data: ") {
+			var event common.ResourceEvent
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event); err != nil {
+				t.Fatalf("failed to decode event %q: %v", line, err)
+			}
+			if kind != common.ResourceChanged || event.Name != "res" || event.State != common.Dirty || event.PreviousState != common.Busy {
+				t.Errorf("expected the release of res, got %s %+v", kind, event)
+			}
+			return
+		}
+	}
+}
+
+func TestWatchRejectsInvalidTypes(t *testing.T) {
+	handler := NewBoskosHandler(MakeTestRanch(nil))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/watch?type=t,in%20valid", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
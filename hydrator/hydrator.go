@@ -0,0 +1,214 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package hydrator seeds an empty boskos store from the resources that
+// already exist in the cloud, easing the migration of an existing fleet.
+package hydrator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/crds"
+)
+
+const defaultCommandTimeout = 5 * time.Minute
+
+// Item is a resource discovered in a cloud inventory.
+type Item struct {
+	Name string `json:"name"`
+	// InUse is set if probing found the resource to be in use, e.g. because
+	// it still holds clusters or VMs. Such resources are seeded as dirty so
+	// they get cleaned up before being handed out.
+	InUse    bool              `json:"in-use,omitempty"`
+	UserData map[string]string `json:"user-data,omitempty"`
+}
+
+// Inventory lists the existing resources of a type.
+type Inventory interface {
+	Type() string
+	List(ctx context.Context) ([]Item, error)
+}
+
+// Config configures the inventories to hydrate from.
+type Config struct {
+	Inventories []InventoryConfig `json:"inventories"`
+}
+
+// InventoryConfig configures a CommandInventory.
+type InventoryConfig struct {
+	// Type is the boskos resource type of the listed resources.
+	Type string `json:"type"`
+	// Command lists the resources as a JSON array of Items on stdout, e.g. by
+	// wrapping `gcloud projects list` or `aws organizations list-accounts`.
+	Command []string `json:"command"`
+	// Timeout defaults to 5m.
+	Timeout *common.Duration `json:"timeout,omitempty"`
+}
+
+// LoadConfig reads and validates a hydration config file.
+func LoadConfig(path string) (*Config, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config := &Config{}
+	if err := yaml.Unmarshal(b, config); err != nil {
+		return nil, err
+	}
+	for i, inv := range config.Inventories {
+		if inv.Type == "" {
+			return nil, fmt.Errorf(".inventories.%d.type: must be set", i)
+		}
+		if len(inv.Command) == 0 {
+			return nil, fmt.Errorf(".inventories.%d.command: must be set", i)
+		}
+	}
+	return config, nil
+}
+
+// BuildInventories creates the inventories of the config.
+func (c *Config) BuildInventories() []Inventory {
+	var inventories []Inventory
+	for _, inv := range c.Inventories {
+		timeout := defaultCommandTimeout
+		if inv.Timeout != nil && inv.Timeout.Duration != nil {
+			timeout = *inv.Timeout.Duration
+		}
+		inventories = append(inventories, &CommandInventory{rType: inv.Type, command: inv.Command, timeout: timeout})
+	}
+	return inventories
+}
+
+// CommandInventory lists resources by running an external command.
+type CommandInventory struct {
+	rType   string
+	command []string
+	timeout time.Duration
+}
+
+// Type implements Inventory.
+func (c *CommandInventory) Type() string { return c.rType }
+
+// List implements Inventory.
+func (c *CommandInventory) List(ctx context.Context) ([]Item, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, c.command[0], c.command[1:]...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to run %v: %w, stderr: %s", c.command, err, stderr.String())
+	}
+	var items []Item
+	if err := json.Unmarshal(stdout.Bytes(), &items); err != nil {
+		return nil, fmt.Errorf("failed to parse the output of %v: %w", c.command, err)
+	}
+	return items, nil
+}
+
+type hydratorStorage interface {
+	GetResources() (*crds.ResourceObjectList, error)
+	AddResource(resource *crds.ResourceObject) error
+}
+
+// Hydrate seeds the storage from the inventories if it holds no resources yet.
+// Only discovered resources known to the config are seeded: static resources
+// listed by name and the resources of a dynamic type up to its max-count,
+// which boskos then adopts. Resources in use are seeded as dirty, others as
+// free for static types and in the initial state of dynamic ones. Config
+// resources not found in the inventory are left to the regular config sync.
+// Resources of a dynamic type beyond its max-count are left alone, resources
+// in use first, as the config sync would otherwise delete the surplus.
+func Hydrate(ctx context.Context, s hydratorStorage, config *common.BoskosConfig, inventories []Inventory) error {
+	existing, err := s.GetResources()
+	if err != nil {
+		return err
+	}
+	if len(existing.Items) > 0 {
+		logrus.Info("Storage already holds resources, skipping hydration")
+		return nil
+	}
+
+	staticNames := map[string]string{}
+	dynamicEntries := map[string]common.ResourceEntry{}
+	for _, entry := range config.Resources {
+		if entry.IsDRLC() {
+			dynamicEntries[entry.Type] = entry
+			continue
+		}
+		for _, name := range entry.Names {
+			staticNames[name] = entry.Type
+		}
+	}
+
+	now := metav1.Now()
+	for _, inv := range inventories {
+		logger := logrus.WithField("type", inv.Type())
+		items, err := inv.List(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list inventory of type %s: %w", inv.Type(), err)
+		}
+		dynamic, isDynamic := dynamicEntries[inv.Type()]
+		if isDynamic {
+			// The resources in use are adopted before idle ones.
+			sort.SliceStable(items, func(i, j int) bool { return items[i].InUse && !items[j].InUse })
+		}
+		var seeded int
+		for idx, item := range items {
+			state := common.Free
+			if isDynamic {
+				if seeded == dynamic.MaxCount {
+					var skipped []string
+					for _, item := range items[idx:] {
+						skipped = append(skipped, item.Name)
+					}
+					logger.WithField("skipped", skipped).Errorf("Discovered more resources than the max-count of %d, leaving the rest alone", dynamic.MaxCount)
+					break
+				}
+				state = dynamic.State
+			} else if staticNames[item.Name] != inv.Type() {
+				logger.WithField("name", item.Name).Warning("Discovered resource is not in the config, skipping")
+				continue
+			}
+			if item.InUse {
+				state = common.Dirty
+			}
+			res := crds.NewResource(item.Name, inv.Type(), state, "", now)
+			for k, v := range item.UserData {
+				res.Status.UserData[k] = v
+			}
+			if err := s.AddResource(res); err != nil {
+				return fmt.Errorf("failed to add resource %s: %w", item.Name, err)
+			}
+			seeded++
+		}
+		logger.Infof("Hydrated %d of %d discovered resources", seeded, len(items))
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hydrator
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/crds"
+)
+
+type fakeInventory struct {
+	rType string
+	items []Item
+}
+
+func (f *fakeInventory) Type() string                           { return f.rType }
+func (f *fakeInventory) List(_ context.Context) ([]Item, error) { return f.items, nil }
+
+type fakeStorage struct {
+	resources []crds.ResourceObject
+}
+
+func (f *fakeStorage) GetResources() (*crds.ResourceObjectList, error) {
+	return &crds.ResourceObjectList{Items: f.resources}, nil
+}
+
+func (f *fakeStorage) AddResource(resource *crds.ResourceObject) error {
+	f.resources = append(f.resources, *resource)
+	return nil
+}
+
+func TestHydrate(t *testing.T) {
+	config := &common.BoskosConfig{Resources: []common.ResourceEntry{
+		{Type: "project", State: common.Dirty, Names: []string{"project-1", "project-2"}},
+		{Type: "cluster", State: "pending", MinCount: 1, MaxCount: 5},
+	}}
+	inventories := []Inventory{
+		&fakeInventory{rType: "project", items: []Item{
+			{Name: "project-1"},
+			{Name: "project-2", InUse: true},
+			{Name: "project-unknown"},
+		}},
+		&fakeInventory{rType: "cluster", items: []Item{
+			{Name: "cluster-1", UserData: map[string]string{"region": "us-east1"}},
+		}},
+	}
+
+	testCases := []struct {
+		name     string
+		existing []crds.ResourceObject
+		expected map[string]string
+	}{
+		{
+			name: "empty storage",
+			expected: map[string]string{
+				"project-1": common.Free,
+				"project-2": common.Dirty,
+				"cluster-1": "pending",
+			},
+		},
+		{
+			name:     "storage with resources",
+			existing: []crds.ResourceObject{*crds.NewResource("project-1", "project", common.Busy, "someone", metav1.Time{})},
+			expected: map[string]string{"project-1": common.Busy},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &fakeStorage{resources: tc.existing}
+			if err := Hydrate(context.Background(), s, config, inventories); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			states := map[string]string{}
+			for _, res := range s.resources {
+				states[res.Name] = res.Status.State
+			}
+			if !reflect.DeepEqual(states, tc.expected) {
+				t.Errorf("expected states %v, got %v", tc.expected, states)
+			}
+		})
+	}
+}
+
+func TestHydrateBeyondMaxCount(t *testing.T) {
+	config := &common.BoskosConfig{Resources: []common.ResourceEntry{
+		{Type: "cluster", State: common.Free, MinCount: 1, MaxCount: 2},
+	}}
+	inventories := []Inventory{
+		&fakeInventory{rType: "cluster", items: []Item{
+			{Name: "cluster-1"},
+			{Name: "cluster-2"},
+			{Name: "cluster-3", InUse: true},
+		}},
+	}
+	s := &fakeStorage{}
+	if err := Hydrate(context.Background(), s, config, inventories); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	states := map[string]string{}
+	for _, res := range s.resources {
+		states[res.Name] = res.Status.State
+	}
+	expected := map[string]string{"cluster-3": common.Dirty, "cluster-1": common.Free}
+	if !reflect.DeepEqual(states, expected) {
+		t.Errorf("expected states %v, got %v", expected, states)
+	}
+}
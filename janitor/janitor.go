@@ -0,0 +1,273 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package janitor runs the loop of the janitors of boskos: it acquires dirty
+// resources, cleans them in parallel with a callback and releases them free,
+// or dirty again if cleaning failed, while heartbeating the resources it owns.
+// Custom janitors only implement the cleanup of a resource.
+package janitor
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+// Defaults of the Options.
+const (
+	DefaultParallelism     = 20
+	DefaultHeartbeatPeriod = 5 * time.Minute
+	DefaultPollPeriod      = time.Minute
+)
+
+// bufferSize is how many acquired resources wait for a free cleaner, so that
+// the janitor never holds many more resources than it cleans.
+const bufferSize = 1
+
+var (
+	cleanups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "boskos_janitor_cleanups_total",
+		Help: "Number of cleanups of resources by type and result, success or failure.",
+	}, []string{"type", "result"})
+	cleanupDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "boskos_janitor_cleanup_duration_seconds",
+		Help:    "Duration of the cleanups of resources by type.",
+		Buckets: prometheus.ExponentialBuckets(1, 1.4, 30),
+	}, []string{"type"})
+)
+
+func init() {
+	prometheus.MustRegister(cleanups)
+	prometheus.MustRegister(cleanupDuration)
+}
+
+// Client is the part of the boskos client used by a Runner, implemented by
+// *client.Client.
+type Client interface {
+	Acquire(rtype string, state string, dest string) (*common.Resource, error)
+	ClaimExpired(rtype string, dest string, expire time.Duration) (*common.Resource, error)
+	ReleaseCleaned(name string, dest string, cleanupDuration time.Duration) error
+	SyncAll() error
+}
+
+// CleanFunc cleans a resource. The resource is released free if it returns
+// nil, and dirty otherwise. ctx is canceled once the Runner stops, so long
+// cleanups should give up then.
+type CleanFunc func(ctx context.Context, resource *common.Resource) error
+
+// Options configure a Runner.
+type Options struct {
+	// Types are the types of the resources to clean.
+	Types []string
+	// Parallelism is how many resources are cleaned at once. Defaults to
+	// DefaultParallelism.
+	Parallelism int
+	// HeartbeatPeriod is how often the resources being cleaned are updated,
+	// so boskos does not reap them. Defaults to DefaultHeartbeatPeriod.
+	HeartbeatPeriod time.Duration
+	// PollPeriod is how long the Runner waits for resources to get dirty
+	// once none is left to clean. Defaults to DefaultPollPeriod.
+	PollPeriod time.Duration
+	// ClaimExpired also cleans the resources whose lease expired, claiming
+	// them once no dirty resource is left, so the reaper is not needed.
+	ClaimExpired bool
+	// ClaimStaleAfter, with ClaimExpired, also cleans the busy, cleaning and
+	// leased resources not updated for that long.
+	ClaimStaleAfter time.Duration
+}
+
+// Runner cleans the dirty resources of boskos with a CleanFunc.
+type Runner struct {
+	client Client
+	clean  CleanFunc
+	opts   Options
+	buffer chan *common.Resource
+}
+
+// NewRunner returns a Runner cleaning the resources acquired with c.
+func NewRunner(c Client, clean CleanFunc, opts Options) (*Runner, error) {
+	if len(opts.Types) == 0 {
+		return nil, errors.New("the types of the resources to clean must be set")
+	}
+	if opts.Parallelism <= 0 {
+		opts.Parallelism = DefaultParallelism
+	}
+	if opts.HeartbeatPeriod <= 0 {
+		opts.HeartbeatPeriod = DefaultHeartbeatPeriod
+	}
+	if opts.PollPeriod <= 0 {
+		opts.PollPeriod = DefaultPollPeriod
+	}
+	return &Runner{client: c, clean: clean, opts: opts, buffer: make(chan *common.Resource, bufferSize)}, nil
+}
+
+// Run cleans resources until ctx is done. It then waits for the cleanups in
+// flight, whose context is canceled, and releases the resources it acquired.
+func (r *Runner) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < r.opts.Parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.cleaner(ctx)
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		r.heartbeat(ctx)
+	}()
+
+	for {
+		r.round(ctx)
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			r.drain()
+			return
+		case <-time.After(r.opts.PollPeriod):
+		}
+	}
+}
+
+// drain releases the resources acquired but never picked up by a cleaner,
+// leaving them dirty.
+func (r *Runner) drain() {
+	for {
+		select {
+		case resource := <-r.buffer:
+			r.release(resource, common.Dirty, 0)
+		default:
+			return
+		}
+	}
+}
+
+func (r *Runner) heartbeat(ctx context.Context) {
+	ticker := time.NewTicker(r.opts.HeartbeatPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.client.SyncAll(); err != nil {
+				logrus.WithError(err).Warn("SyncAll failed")
+			}
+		}
+	}
+}
+
+// acquire acquires a dirty resource of rtype to clean, or one whose owner is
+// gone if there is none and claiming is enabled.
+func (r *Runner) acquire(rtype string) (*common.Resource, error) {
+	resource, err := r.client.Acquire(rtype, common.Dirty, common.Cleaning)
+	if err == nil || !r.opts.ClaimExpired {
+		return resource, err
+	}
+	if claimed, claimErr := r.client.ClaimExpired(rtype, common.Cleaning, r.opts.ClaimStaleAfter); claimErr == nil {
+		logrus.Infof("Claimed resource %s of type %s left behind by its owner", claimed.Name, claimed.Type)
+		return claimed, nil
+	}
+	return nil, err
+}
+
+// round hands the resources of every type to the cleaners until none is left
+// to clean or ctx is done, and returns how many it acquired.
+func (r *Runner) round(ctx context.Context) int {
+	acquired := 0
+	remaining := sets.NewString(r.opts.Types...)
+	for remaining.Len() > 0 {
+		for _, rtype := range remaining.List() {
+			if ctx.Err() != nil {
+				return acquired
+			}
+			resource, err := r.acquire(rtype)
+			if err != nil {
+				logrus.WithError(err).Infof("no available resource %s", rtype)
+				remaining.Delete(rtype)
+				continue
+			}
+			if resource == nil {
+				logrus.Warning("received nil resource")
+				remaining.Delete(rtype)
+				continue
+			}
+			logrus.Infof("Acquired resources %s of type %s", resource.Name, resource.Type)
+			select {
+			case r.buffer <- resource: // will block until buffer has a free slot
+				acquired++
+			case <-ctx.Done():
+				r.release(resource, common.Dirty, 0)
+				return acquired
+			}
+		}
+	}
+	return acquired
+}
+
+func (r *Runner) cleaner(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case resource := <-r.buffer:
+			dest, result := common.Free, "success"
+			start := time.Now()
+			if err := r.clean(ctx, resource); err != nil {
+				logrus.WithError(err).Infof("failed to clean up resource %s", resource.Name)
+				dest, result = common.Dirty, "failure"
+			}
+			cleanups.WithLabelValues(resource.Type, result).Inc()
+			cleanupDuration.WithLabelValues(resource.Type).Observe(time.Since(start).Seconds())
+			r.release(resource, dest, time.Since(start))
+		}
+	}
+}
+
+func (r *Runner) release(resource *common.Resource, dest string, duration time.Duration) {
+	if err := r.client.ReleaseCleaned(resource.Name, dest, duration); err != nil {
+		logrus.WithError(err).WithField("name", resource.Name).Error("boskos release failed!")
+	}
+}
+
+// SignalContext returns a context canceled once the process is interrupted or
+// terminated, so that a Runner stops gracefully.
+func SignalContext(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		defer signal.Stop(signals)
+		select {
+		case sig := <-signals:
+			logrus.WithField("signal", sig).Info("Stopping the janitor")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
@@ -14,9 +14,10 @@ See the License for the specific language governing permissions and
 limitations under the License.
 */
 
-package main
+package janitor
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"math/rand"
@@ -66,7 +67,12 @@ func (fb *fakeBoskos) Acquire(rtype string, state string, dest string) (*common.
 	return nil, fmt.Errorf("could not find resource of type %s", rtype)
 }
 
-func (fb *fakeBoskos) ReleaseOne(name string, dest string) error {
+// ClaimExpired claims the busy resources, as if their owners were gone.
+func (fb *fakeBoskos) ClaimExpired(rtype string, dest string, _ time.Duration) (*common.Resource, error) {
+	return fb.Acquire(rtype, common.Busy, dest)
+}
+
+func (fb *fakeBoskos) ReleaseCleaned(name string, dest string, _ time.Duration) error {
 	fb.lock.Lock()
 	defer fb.lock.Unlock()
 
@@ -102,10 +108,25 @@ func waitTimeout(wg *sync.WaitGroup, timeout time.Duration) bool {
 	}
 }
 
+// startCleaners starts the cleaners of a runner of fb, without acquiring.
+func startCleaners(t *testing.T, fb *fakeBoskos, clean CleanFunc, opts Options) *Runner {
+	opts.Types = []string{"t"}
+	r, err := NewRunner(fb, clean, opts)
+	if err != nil {
+		t.Fatalf("failed to create runner: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	for i := 0; i < r.opts.Parallelism; i++ {
+		go r.cleaner(ctx)
+	}
+	return r
+}
+
 func TestNormal(t *testing.T) {
 	var totalClean int32
 
-	fakeClean := func(resource *common.Resource, extraFlags []string) error {
+	fakeClean := func(context.Context, *common.Resource) error {
 		atomic.AddInt32(&totalClean, 1)
 		return nil
 	}
@@ -113,8 +134,8 @@ func TestNormal(t *testing.T) {
 	types := []string{"a", "b", "c", "d"}
 	fb := createFakeBoskos(1000, types)
 
-	buffer := setup(fb, poolSize, bufferSize, fakeClean, nil)
-	totalAcquire := run(fb, buffer, []string{"t"})
+	r := startCleaners(t, fb, fakeClean, Options{})
+	totalAcquire := r.round(context.Background())
 
 	if totalAcquire != len(fb.resources) {
 		t.Errorf("expect to acquire all resources(%d) from fake boskos, got %d", len(fb.resources), totalAcquire)
@@ -139,7 +160,7 @@ func FakeRun(fb *fakeBoskos, buffer chan<- *common.Resource, res string) (int, e
 	timeout := time.NewTimer(5 * time.Second).C
 
 	totalClean := 0
-	maxAcquire := poolSize + bufferSize + 1
+	maxAcquire := DefaultParallelism + bufferSize + 1
 
 	for {
 		select {
@@ -170,18 +191,96 @@ func FakeRun(fb *fakeBoskos, buffer chan<- *common.Resource, res string) (int, e
 func TestMalfunctionJanitor(t *testing.T) {
 
 	stuck := make(chan string, 1)
-	fakeClean := func(resource *common.Resource, extraFlags []string) error {
+	fakeClean := func(context.Context, *common.Resource) error {
 		<-stuck
 		return nil
 	}
 
 	fb := createFakeBoskos(200, []string{"t"})
 
-	buffer := setup(fb, poolSize, bufferSize, fakeClean, nil)
+	r := startCleaners(t, fb, fakeClean, Options{})
 
-	if totalClean, err := FakeRun(fb, buffer, "t"); err != nil {
+	if totalClean, err := FakeRun(fb, r.buffer, "t"); err != nil {
 		t.Fatalf("run failed unexpectedly : %v", err)
-	} else if totalClean != poolSize+1 {
-		t.Errorf("expect to clean %d from fake boskos, got %d", poolSize+1, totalClean)
+	} else if totalClean != DefaultParallelism+1 {
+		t.Errorf("expect to clean %d from fake boskos, got %d", DefaultParallelism+1, totalClean)
+	}
+}
+
+func TestClaimExpired(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		claim    bool
+		expected int
+	}{
+		{
+			name:     "only dirty resources without claiming",
+			expected: 50,
+		},
+		{
+			name:     "expired resources claimed",
+			claim:    true,
+			expected: 100,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fb := createFakeBoskos(100, []string{"t"})
+			for i := 0; i < 50; i++ {
+				fb.resources[i].State = common.Busy
+			}
+
+			r := startCleaners(t, fb, func(context.Context, *common.Resource) error { return nil }, Options{ClaimExpired: tc.claim})
+			if totalAcquire := r.round(context.Background()); totalAcquire != tc.expected {
+				t.Errorf("expected to acquire %d resources, got %d", tc.expected, totalAcquire)
+			}
+			if waitTimeout(&fb.wg, time.Second) {
+				t.Fatal("expect janitor to finish!")
+			}
+		})
+	}
+}
+
+func TestRunStopsGracefully(t *testing.T) {
+	fb := createFakeBoskos(10, []string{"t"})
+	ctx, cancel := context.WithCancel(context.Background())
+	cleaning := make(chan struct{}, 10)
+	r, err := NewRunner(fb, func(ctx context.Context, _ *common.Resource) error {
+		cleaning <- struct{}{}
+		<-ctx.Done()
+		return ctx.Err()
+	}, Options{Types: []string{"t"}, Parallelism: 2})
+	if err != nil {
+		t.Fatalf("failed to create runner: %v", err)
+	}
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		r.Run(ctx)
+	}()
+	for i := 0; i < 2; i++ {
+		<-cleaning
+	}
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the runner to stop")
+	}
+
+	// The interrupted cleanups and the resource waiting for a cleaner are
+	// released dirty, the others were never acquired.
+	if waitTimeout(&fb.wg, time.Second) {
+		t.Fatal("expected every acquired resource to be released")
+	}
+	for _, res := range fb.resources {
+		if res.State != common.Dirty {
+			t.Errorf("expected resource %s to be dirty, got %s", res.Name, res.State)
+		}
+	}
+}
+
+func TestNewRunnerRequiresTypes(t *testing.T) {
+	if _, err := NewRunner(createFakeBoskos(1, []string{"t"}), nil, Options{}); err == nil {
+		t.Error("expected an error without types")
 	}
 }
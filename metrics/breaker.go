@@ -0,0 +1,71 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"sigs.k8s.io/boskos/ranch"
+)
+
+var breakerLabels = []string{TypeLabel}
+
+type breakerCollector struct {
+	open        *prometheus.Desc
+	failures    *prometheus.Desc
+	cleanups    *prometheus.Desc
+	ranch       *ranch.Ranch
+	cardinality *CardinalityConfig
+}
+
+// NewCleanupBreakerCollector returns a collector which exports whether the
+// cleanup breaker of each resource type is open, so paused cleanups can be
+// alerted on, along with the cleanups counted over the breaker window.
+func NewCleanupBreakerCollector(ranch *ranch.Ranch, cardinality *CardinalityConfig) prometheus.Collector {
+	return breakerCollector{
+		open:        cardinality.newDesc("boskos_cleanup_breaker_open", "Whether the cleanup of dirty resources is paused after too many failures by resource type.", breakerLabels),
+		failures:    cardinality.newDesc("boskos_cleanup_breaker_failures", "Number of failed cleanups within the breaker window by resource type.", breakerLabels),
+		cleanups:    cardinality.newDesc("boskos_cleanup_breaker_cleanups", "Number of cleanups within the breaker window by resource type.", breakerLabels),
+		ranch:       ranch,
+		cardinality: cardinality,
+	}
+}
+
+func (bc breakerCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- bc.open
+	ch <- bc.failures
+	ch <- bc.cleanups
+}
+
+func (bc breakerCollector) Collect(ch chan<- prometheus.Metric) {
+	var open, failures, cleanups []sample
+	for _, status := range bc.ranch.CleanupBreakers() {
+		s := sample{labelValues: []string{status.Type}}
+		if status.Open {
+			s.value = 1
+		}
+		open = append(open, s)
+		s.value = float64(status.Failures)
+		failures = append(failures, s)
+		s.value = float64(status.Cleanups)
+		cleanups = append(cleanups, s)
+	}
+	// Folded types are reported open if any of them is.
+	bc.cardinality.emit(ch, bc.open, breakerLabels, open, maximum)
+	bc.cardinality.emit(ch, bc.failures, breakerLabels, failures, sum)
+	bc.cardinality.emit(ch, bc.cleanups, breakerLabels, cleanups, sum)
+}
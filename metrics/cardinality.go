@@ -0,0 +1,251 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/yaml"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+// Label dimensions the cardinality of which can be controlled.
+const (
+	TypeLabel   = "type"
+	StateLabel  = "state"
+	OwnerLabel  = "owner"
+	TenantLabel = "tenant"
+)
+
+var cardinalityLabels = sets.NewString(TypeLabel, StateLabel, OwnerLabel, TenantLabel)
+
+// CardinalityConfig controls the label dimensions exported by the boskos
+// collectors, so large deployments can bound the number of series while small
+// ones keep full detail. A nil CardinalityConfig exports everything.
+type CardinalityConfig struct {
+	// DropLabels are the label dimensions not to export. Series only differing
+	// by a dropped label are summed up.
+	DropLabels []string `json:"drop-labels,omitempty"`
+	// TopN limits how many values of a label dimension are exported. Only the
+	// values with the largest totals are kept, the others are summed up in the
+	// "other" value.
+	TopN map[string]int `json:"top-n,omitempty"`
+}
+
+// LoadCardinalityConfig reads and validates a metrics cardinality config file.
+func LoadCardinalityConfig(path string) (*CardinalityConfig, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config := &CardinalityConfig{}
+	if err := yaml.Unmarshal(b, config); err != nil {
+		return nil, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Validate checks that the config only refers to known label dimensions.
+func (c *CardinalityConfig) Validate() error {
+	for idx, label := range c.DropLabels {
+		if !cardinalityLabels.Has(label) {
+			return fmt.Errorf(".drop-labels.%d: unknown label %q, must be one of %v", idx, label, cardinalityLabels.List())
+		}
+	}
+	for label, n := range c.TopN {
+		if !cardinalityLabels.Has(label) {
+			return fmt.Errorf(".top-n.%s: unknown label, must be one of %v", label, cardinalityLabels.List())
+		}
+		if n <= 0 {
+			return fmt.Errorf(".top-n.%s: must be >0", label)
+		}
+	}
+	return nil
+}
+
+// labels returns the labels to export out of all the labels of a series.
+func (c *CardinalityConfig) labels(all []string) []string {
+	if c == nil {
+		return all
+	}
+	dropped := sets.NewString(c.DropLabels...)
+	var kept []string
+	for _, label := range all {
+		if !dropped.Has(label) {
+			kept = append(kept, label)
+		}
+	}
+	return kept
+}
+
+// newDesc is prometheus.NewDesc for the labels exported by the config.
+func (c *CardinalityConfig) newDesc(name, help string, labels []string) *prometheus.Desc {
+	return prometheus.NewDesc(name, help, c.labels(labels), nil)
+}
+
+// sample is a value along with the values of all its labels.
+type sample struct {
+	labelValues []string
+	value       float64
+}
+
+// sum and maximum combine the values of samples ending up with the same label values.
+func sum(a, b float64) float64 { return a + b }
+
+func maximum(a, b float64) float64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// reduce applies the top-n limits and drops the dropped labels of samples,
+// combining the samples that end up with the same label values.
+func (c *CardinalityConfig) reduce(labels []string, samples []sample, combine func(a, b float64) float64) []sample {
+	if c == nil {
+		return samples
+	}
+	for idx, label := range labels {
+		if n, ok := c.TopN[label]; ok {
+			truncate(samples, idx, n)
+		}
+	}
+
+	dropped := sets.NewString(c.DropLabels...)
+	combinedSamples := map[string]*sample{}
+	var keys []string
+	for _, s := range samples {
+		var values []string
+		for idx, label := range labels {
+			if !dropped.Has(label) {
+				values = append(values, s.labelValues[idx])
+			}
+		}
+		key := strings.Join(values, "\x00")
+		if combined, ok := combinedSamples[key]; ok {
+			combined.value = combine(combined.value, s.value)
+			continue
+		}
+		combinedSamples[key] = &sample{labelValues: values, value: s.value}
+		keys = append(keys, key)
+	}
+	reduced := make([]sample, 0, len(keys))
+	for _, key := range keys {
+		reduced = append(reduced, *combinedSamples[key])
+	}
+	return reduced
+}
+
+// truncate replaces the values of the label at idx that are not among the n
+// values with the largest totals by "other".
+func truncate(samples []sample, idx, n int) {
+	totals := map[string]float64{}
+	for _, s := range samples {
+		totals[s.labelValues[idx]] += s.value
+	}
+	if len(totals) <= n {
+		return
+	}
+	values := make([]string, 0, len(totals))
+	for value := range totals {
+		values = append(values, value)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if totals[values[i]] != totals[values[j]] {
+			return totals[values[i]] > totals[values[j]]
+		}
+		return values[i] < values[j]
+	})
+	top := sets.NewString(values[:n]...)
+	for i := range samples {
+		if !top.Has(samples[i].labelValues[idx]) {
+			values := append([]string(nil), samples[i].labelValues...)
+			values[idx] = common.Other
+			samples[i].labelValues = values
+		}
+	}
+}
+
+// emit sends the reduced samples as gauges of desc.
+func (c *CardinalityConfig) emit(ch chan<- prometheus.Metric, desc *prometheus.Desc, labels []string, samples []sample, combine func(a, b float64) float64) {
+	for _, s := range c.reduce(labels, samples, combine) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, s.value, s.labelValues...)
+	}
+}
+
+// histogram is a histogram along with the values of all its labels.
+type histogram struct {
+	labelValues []string
+	count       uint64
+	sum         float64
+	buckets     map[float64]uint64
+}
+
+// emitHistograms sends the histograms as const histograms of desc, applying
+// the top-n limits by number of observations and dropping the dropped labels
+// like emit, merging the histograms that end up with the same label values.
+func (c *CardinalityConfig) emitHistograms(ch chan<- prometheus.Metric, desc *prometheus.Desc, labels []string, histograms []histogram) {
+	samples := make([]sample, 0, len(histograms))
+	for _, h := range histograms {
+		samples = append(samples, sample{labelValues: h.labelValues, value: float64(h.count)})
+	}
+	dropped := sets.NewString()
+	if c != nil {
+		for idx, label := range labels {
+			if n, ok := c.TopN[label]; ok {
+				truncate(samples, idx, n)
+			}
+		}
+		dropped.Insert(c.DropLabels...)
+	}
+
+	merged := map[string]*histogram{}
+	var keys []string
+	for i, s := range samples {
+		var values []string
+		for idx, label := range labels {
+			if !dropped.Has(label) {
+				values = append(values, s.labelValues[idx])
+			}
+		}
+		key := strings.Join(values, "\x00")
+		m, ok := merged[key]
+		if !ok {
+			m = &histogram{labelValues: values, buckets: map[float64]uint64{}}
+			merged[key] = m
+			keys = append(keys, key)
+		}
+		m.count += histograms[i].count
+		m.sum += histograms[i].sum
+		for bound, count := range histograms[i].buckets {
+			m.buckets[bound] += count
+		}
+	}
+	for _, key := range keys {
+		m := merged[key]
+		ch <- prometheus.MustNewConstHistogram(desc, m.count, m.sum, m.buckets, m.labelValues...)
+	}
+}
@@ -0,0 +1,173 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCardinalityReduce(t *testing.T) {
+	labels := []string{TypeLabel, StateLabel}
+	samples := []sample{
+		{labelValues: []string{"a", "free"}, value: 5},
+		{labelValues: []string{"a", "busy"}, value: 5},
+		{labelValues: []string{"b", "free"}, value: 3},
+		{labelValues: []string{"c", "free"}, value: 1},
+		{labelValues: []string{"d", "busy"}, value: 1},
+	}
+	testCases := []struct {
+		name     string
+		config   *CardinalityConfig
+		combine  func(a, b float64) float64
+		expected map[string]float64
+	}{
+		{
+			name:    "no config",
+			combine: sum,
+			expected: map[string]float64{
+				"a,free": 5, "a,busy": 5, "b,free": 3, "c,free": 1, "d,busy": 1,
+			},
+		},
+		{
+			name:     "drop state",
+			config:   &CardinalityConfig{DropLabels: []string{StateLabel}},
+			combine:  sum,
+			expected: map[string]float64{"a": 10, "b": 3, "c": 1, "d": 1},
+		},
+		{
+			name:    "top types",
+			config:  &CardinalityConfig{TopN: map[string]int{TypeLabel: 2}},
+			combine: sum,
+			expected: map[string]float64{
+				"a,free": 5, "a,busy": 5, "b,free": 3, "other,free": 1, "other,busy": 1,
+			},
+		},
+		{
+			name:     "top types without state",
+			config:   &CardinalityConfig{DropLabels: []string{StateLabel}, TopN: map[string]int{TypeLabel: 1}},
+			combine:  maximum,
+			expected: map[string]float64{"a": 5, "other": 3},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			input := append([]sample(nil), samples...)
+			if desc := tc.config.newDesc("test", "test", labels); desc == nil {
+				t.Fatal("expected a desc")
+			}
+			got := map[string]float64{}
+			for _, s := range tc.config.reduce(labels, input, tc.combine) {
+				got[strings.Join(s.labelValues, ",")] = s.value
+			}
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestCardinalityConfigValidate(t *testing.T) {
+	testCases := []struct {
+		name      string
+		config    CardinalityConfig
+		expectErr bool
+	}{
+		{
+			name:   "valid",
+			config: CardinalityConfig{DropLabels: []string{OwnerLabel}, TopN: map[string]int{TypeLabel: 10}},
+		},
+		{
+			name:      "unknown label",
+			config:    CardinalityConfig{DropLabels: []string{"region"}},
+			expectErr: true,
+		},
+		{
+			name:      "non-positive top-n",
+			config:    CardinalityConfig{TopN: map[string]int{TypeLabel: 0}},
+			expectErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.config.Validate(); (err != nil) != tc.expectErr {
+				t.Errorf("expected error %t, got %v", tc.expectErr, err)
+			}
+		})
+	}
+}
+
+type histogramCollector struct {
+	config     *CardinalityConfig
+	histograms []histogram
+}
+
+func (c histogramCollector) desc() *prometheus.Desc {
+	return c.config.newDesc("test_seconds", "Test histogram.", []string{TypeLabel})
+}
+
+func (c histogramCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc()
+}
+
+func (c histogramCollector) Collect(ch chan<- prometheus.Metric) {
+	c.config.emitHistograms(ch, c.desc(), []string{TypeLabel}, c.histograms)
+}
+
+func TestCardinalityEmitHistograms(t *testing.T) {
+	histograms := []histogram{
+		{labelValues: []string{"a"}, count: 3, sum: 12, buckets: map[float64]uint64{5: 2, 10: 3}},
+		{labelValues: []string{"b"}, count: 2, sum: 30, buckets: map[float64]uint64{5: 0, 10: 1}},
+		{labelValues: []string{"c"}, count: 1, sum: 4, buckets: map[float64]uint64{5: 1, 10: 1}},
+	}
+	collector := histogramCollector{config: &CardinalityConfig{TopN: map[string]int{TypeLabel: 1}}, histograms: histograms}
+	expected := `
+# HELP test_seconds Test histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{type="a",le="5"} 2
+test_seconds_bucket{type="a",le="10"} 3
+test_seconds_bucket{type="a",le="+Inf"} 3
+test_seconds_sum{type="a"} 12
+test_seconds_count{type="a"} 3
+test_seconds_bucket{type="other",le="5"} 1
+test_seconds_bucket{type="other",le="10"} 2
+test_seconds_bucket{type="other",le="+Inf"} 3
+test_seconds_sum{type="other"} 34
+test_seconds_count{type="other"} 3
+`
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(expected)); err != nil {
+		t.Errorf("unexpected top-n histograms: %v", err)
+	}
+
+	collector.config = &CardinalityConfig{DropLabels: []string{TypeLabel}}
+	expected = `
+# HELP test_seconds Test histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{le="5"} 3
+test_seconds_bucket{le="10"} 5
+test_seconds_bucket{le="+Inf"} 6
+test_seconds_sum 46
+test_seconds_count 6
+`
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(expected)); err != nil {
+		t.Errorf("unexpected merged histograms: %v", err)
+	}
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"sigs.k8s.io/boskos/ranch"
+)
+
+type configSyncCollector struct {
+	syncs          *prometheus.Desc
+	errors         *prometheus.Desc
+	lastSuccess    *prometheus.Desc
+	duration       *prometheus.Desc
+	lastResources  *prometheus.Desc
+	resourcesTotal *prometheus.Desc
+	ranch          *ranch.Ranch
+}
+
+// NewConfigSyncCollector returns a collector which exports the health of the
+// syncs of the resources with the config, so a config file broken after
+// startup can be alerted on.
+func NewConfigSyncCollector(ranch *ranch.Ranch) prometheus.Collector {
+	return configSyncCollector{
+		syncs:          prometheus.NewDesc("boskos_config_syncs_total", "Number of syncs of the resources with the config.", nil, nil),
+		errors:         prometheus.NewDesc("boskos_config_sync_errors_total", "Number of failed syncs of the resources with the config, including unparsable configs.", nil, nil),
+		lastSuccess:    prometheus.NewDesc("boskos_config_sync_last_success_timestamp_seconds", "Unix time of the end of the last successful config sync.", nil, nil),
+		duration:       prometheus.NewDesc("boskos_config_sync_duration_seconds", "Duration in seconds of the last config sync.", nil, nil),
+		lastResources:  prometheus.NewDesc("boskos_config_sync_resources", "Number of resources the last config sync added or tombstoned, by action.", []string{"action"}, nil),
+		resourcesTotal: prometheus.NewDesc("boskos_config_sync_resources_total", "Number of resources the config syncs added or tombstoned, by action.", []string{"action"}, nil),
+		ranch:          ranch,
+	}
+}
+
+func (cc configSyncCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cc.syncs
+	ch <- cc.errors
+	ch <- cc.lastSuccess
+	ch <- cc.duration
+	ch <- cc.lastResources
+	ch <- cc.resourcesTotal
+}
+
+func (cc configSyncCollector) Collect(ch chan<- prometheus.Metric) {
+	status := cc.ranch.ConfigSyncStatus()
+	ch <- prometheus.MustNewConstMetric(cc.syncs, prometheus.CounterValue, float64(status.Syncs))
+	ch <- prometheus.MustNewConstMetric(cc.errors, prometheus.CounterValue, float64(status.Errors))
+	if status.LastSuccess != nil {
+		ch <- prometheus.MustNewConstMetric(cc.lastSuccess, prometheus.GaugeValue, float64(status.LastSuccess.Unix()))
+	}
+	if status.Syncs > 0 {
+		ch <- prometheus.MustNewConstMetric(cc.duration, prometheus.GaugeValue, status.LastDuration.Seconds())
+	}
+	ch <- prometheus.MustNewConstMetric(cc.lastResources, prometheus.GaugeValue, float64(status.LastAdded), "added")
+	ch <- prometheus.MustNewConstMetric(cc.lastResources, prometheus.GaugeValue, float64(status.LastTombstoned), "tombstoned")
+	ch <- prometheus.MustNewConstMetric(cc.resourcesTotal, prometheus.CounterValue, float64(status.Added), "added")
+	ch <- prometheus.MustNewConstMetric(cc.resourcesTotal, prometheus.CounterValue, float64(status.Tombstoned), "tombstoned")
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"sigs.k8s.io/boskos/ranch"
+)
+
+var deprecatedUsageLabels = []string{"deprecation", OwnerLabel}
+
+type deprecatedUsageCollector struct {
+	usage       *prometheus.Desc
+	ranch       *ranch.Ranch
+	cardinality *CardinalityConfig
+}
+
+// NewDeprecatedUsageCollector returns a collector which exports the requests
+// relying on deprecated client behavior by deprecation and owner, so the
+// consumers to update can be found. The owners are bounded by the cardinality
+// config like those of the other metrics.
+func NewDeprecatedUsageCollector(ranch *ranch.Ranch, cardinality *CardinalityConfig) prometheus.Collector {
+	return deprecatedUsageCollector{
+		usage:       cardinality.newDesc("boskos_deprecated_usage_total", "Number of requests relying on deprecated client behavior by deprecation and owner.", deprecatedUsageLabels),
+		ranch:       ranch,
+		cardinality: cardinality,
+	}
+}
+
+func (dc deprecatedUsageCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- dc.usage
+}
+
+func (dc deprecatedUsageCollector) Collect(ch chan<- prometheus.Metric) {
+	var usage []sample
+	for _, count := range dc.ranch.DeprecatedUsage() {
+		usage = append(usage, sample{labelValues: []string{count.Deprecation, count.Owner}, value: float64(count.Count)})
+	}
+	for _, s := range dc.cardinality.reduce(deprecatedUsageLabels, usage, sum) {
+		ch <- prometheus.MustNewConstMetric(dc.usage, prometheus.CounterValue, s.value, s.labelValues...)
+	}
+}
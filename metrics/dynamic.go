@@ -0,0 +1,56 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"sigs.k8s.io/boskos/ranch"
+)
+
+var dynamicErrorLabels = []string{TypeLabel, "class"}
+
+type dynamicErrorCollector struct {
+	errors      *prometheus.Desc
+	ranch       *ranch.Ranch
+	cardinality *CardinalityConfig
+}
+
+// NewDynamicResourceErrorCollector returns a collector which exports the
+// errors updating dynamic resources by resource type and class of error, so
+// types whose lifecycle management is failing can be alerted on.
+func NewDynamicResourceErrorCollector(ranch *ranch.Ranch, cardinality *CardinalityConfig) prometheus.Collector {
+	return dynamicErrorCollector{
+		errors:      cardinality.newDesc("boskos_dynamic_resource_update_errors_total", "Number of errors updating dynamic resources by resource type and class of error.", dynamicErrorLabels),
+		ranch:       ranch,
+		cardinality: cardinality,
+	}
+}
+
+func (dc dynamicErrorCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- dc.errors
+}
+
+func (dc dynamicErrorCollector) Collect(ch chan<- prometheus.Metric) {
+	var errors []sample
+	for _, count := range dc.ranch.DynamicResourceErrors() {
+		errors = append(errors, sample{labelValues: []string{count.Type, count.Class}, value: float64(count.Count)})
+	}
+	for _, s := range dc.cardinality.reduce(dynamicErrorLabels, errors, sum) {
+		ch <- prometheus.MustNewConstMetric(dc.errors, prometheus.CounterValue, s.value, s.labelValues...)
+	}
+}
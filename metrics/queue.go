@@ -0,0 +1,93 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/boskos/ranch"
+)
+
+type queueCollector struct {
+	queuedRequests  *prometheus.Desc
+	estimatedWait   *prometheus.Desc
+	expiredRequests *prometheus.Desc
+	queueWait       *prometheus.Desc
+	ranch           *ranch.Ranch
+	cardinality     *CardinalityConfig
+}
+
+// NewQueueCollector returns a collector which exports the number of queued
+// acquire requests and the estimated wait of the last one in line, segmented
+// by resource type and state as allowed by the cardinality config, along with
+// the requests expired by reason and the histogram of the time the granted
+// requests spent in the queue by resource type.
+func NewQueueCollector(ranch *ranch.Ranch, cardinality *CardinalityConfig) prometheus.Collector {
+	return queueCollector{
+		queuedRequests:  cardinality.newDesc("boskos_queued_requests", "Number of acquire requests waiting for a resource by resource type and state.", ResourcesMetricLabels),
+		estimatedWait:   cardinality.newDesc("boskos_estimated_wait_seconds", "Estimated wait in seconds of the last queued acquire request by resource type and state.", ResourcesMetricLabels),
+		expiredRequests: prometheus.NewDesc("boskos_expired_requests_total", "Number of acquire requests expired by reason, ttl for requests not renewed within the request TTL and stale for requests of clients which stopped renewing and heartbeating.", []string{"reason"}, nil),
+		queueWait:       cardinality.newDesc("boskos_queue_wait_seconds", "Histogram of the time in seconds acquire requests with a request ID spent in the queue, from their first attempt to the grant of a resource, by resource type.", []string{TypeLabel}),
+		ranch:           ranch,
+		cardinality:     cardinality,
+	}
+}
+
+func (qc queueCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- qc.queuedRequests
+	ch <- qc.estimatedWait
+	ch <- qc.expiredRequests
+	ch <- qc.queueWait
+}
+
+func (qc queueCollector) Collect(ch chan<- prometheus.Metric) {
+	for reason, count := range qc.ranch.ExpiredRequests() {
+		ch <- prometheus.MustNewConstMetric(qc.expiredRequests, prometheus.CounterValue, float64(count), reason)
+	}
+	var histograms []histogram
+	for _, h := range qc.ranch.QueueWaits() {
+		histograms = append(histograms, histogram{labelValues: []string{h.Type}, count: h.Count, sum: h.Sum, buckets: h.Buckets})
+	}
+	qc.cardinality.emitHistograms(ch, qc.queueWait, []string{TypeLabel}, histograms)
+
+	queue, err := qc.ranch.Queue("")
+	if err != nil {
+		logrus.WithError(err).Error("failed to get queue")
+		return
+	}
+	type key struct{ rtype, state string }
+	counts := map[key]int{}
+	estimates := map[key]float64{}
+	for _, req := range queue {
+		k := key{rtype: req.Type, state: req.State}
+		counts[k]++
+		// The queue is sorted by rank, so the last estimate is the longest.
+		if req.EstimatedWaitSeconds != nil {
+			estimates[k] = *req.EstimatedWaitSeconds
+		}
+	}
+	var countSamples, estimateSamples []sample
+	for k, count := range counts {
+		countSamples = append(countSamples, sample{labelValues: []string{k.rtype, k.state}, value: float64(count)})
+	}
+	for k, estimate := range estimates {
+		estimateSamples = append(estimateSamples, sample{labelValues: []string{k.rtype, k.state}, value: estimate})
+	}
+	qc.cardinality.emit(ch, qc.queuedRequests, ResourcesMetricLabels, countSamples, sum)
+	qc.cardinality.emit(ch, qc.estimatedWait, ResourcesMetricLabels, estimateSamples, maximum)
+}
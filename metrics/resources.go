@@ -35,19 +35,31 @@ const (
 var (
 	// ResourcesMetricLabels is the list of labels used for the Prometheus metric used to monitor Boskos resources.
 	ResourcesMetricLabels = []string{"type", "state"}
+	// ResourcesByOwnerMetricLabels is the list of labels used for the Prometheus
+	// metric used to monitor Boskos resources when broken down by owner.
+	ResourcesByOwnerMetricLabels = []string{"type", "state", "owner"}
 )
 
 type resourcesCollector struct {
 	boskosResources *prometheus.Desc
 	ranch           *ranch.Ranch
+	cardinality     *CardinalityConfig
+	byOwner         bool
 }
 
 // NewResourcesCollector returns a collector which exports the current counts of
-// Boskos resources, segmented by resource type and state.
-func NewResourcesCollector(ranch *ranch.Ranch) prometheus.Collector {
+// Boskos resources, segmented by resource type and state, and by owner if
+// byOwner is set, as allowed by the cardinality config.
+func NewResourcesCollector(ranch *ranch.Ranch, cardinality *CardinalityConfig, byOwner bool) prometheus.Collector {
+	labels := ResourcesMetricLabels
+	if byOwner {
+		labels = ResourcesByOwnerMetricLabels
+	}
 	return resourcesCollector{
-		boskosResources: prometheus.NewDesc(ResourcesMetricName, ResourcesMetricDescription, ResourcesMetricLabels, nil),
+		boskosResources: cardinality.newDesc(ResourcesMetricName, ResourcesMetricDescription, labels),
 		ranch:           ranch,
+		cardinality:     cardinality,
+		byOwner:         byOwner,
 	}
 }
 
@@ -56,13 +68,31 @@ func (rc resourcesCollector) Describe(ch chan<- *prometheus.Desc) {
 }
 
 func (rc resourcesCollector) Collect(ch chan<- prometheus.Metric) {
+	if rc.byOwner {
+		rc.collectByOwner(ch)
+		return
+	}
 	metrics, err := rc.ranch.AllMetrics()
 	if err != nil {
 		logrus.WithError(err).Error("failed to get metrics")
 	}
+	var samples []sample
 	NormalizeResourceMetrics(metrics, common.KnownStates, func(rtype, state string, count float64) {
-		ch <- prometheus.MustNewConstMetric(rc.boskosResources, prometheus.GaugeValue, count, rtype, state)
+		samples = append(samples, sample{labelValues: []string{rtype, state}, value: count})
+	})
+	rc.cardinality.emit(ch, rc.boskosResources, ResourcesMetricLabels, samples, sum)
+}
+
+func (rc resourcesCollector) collectByOwner(ch chan<- prometheus.Metric) {
+	metrics, err := rc.ranch.AllMetricsByOwner()
+	if err != nil {
+		logrus.WithError(err).Error("failed to get metrics")
+	}
+	var samples []sample
+	NormalizeResourceOwnerMetrics(metrics, common.KnownStates, func(rtype, state, owner string, count float64) {
+		samples = append(samples, sample{labelValues: []string{rtype, state, owner}, value: count})
 	})
+	rc.cardinality.emit(ch, rc.boskosResources, ResourcesByOwnerMetricLabels, samples, sum)
 }
 
 // NormalizeResourceMetrics "normalizes" the list of provided Metrics by
@@ -88,3 +118,35 @@ func NormalizeResourceMetrics(metrics []common.Metric, states []string, updateFu
 		}
 	}
 }
+
+// NormalizeResourceOwnerMetrics is NormalizeResourceMetrics for the counts of
+// the Metrics by owner. Only the resources without owner have some count for
+// every state in states, so that the series of each type and state exist
+// without one series per owner and state.
+func NormalizeResourceOwnerMetrics(metrics []common.Metric, states []string, updateFunc func(rtype, state, owner string, count float64)) {
+	knownStates := sets.NewString(states...)
+	for _, metric := range metrics {
+		countsByOwner := map[string]map[string]float64{"": {}}
+		for _, state := range states {
+			countsByOwner[""][state] = 0
+		}
+		for owner, currents := range metric.ByOwner {
+			counts, ok := countsByOwner[owner]
+			if !ok {
+				counts = map[string]float64{}
+				countsByOwner[owner] = counts
+			}
+			for state, value := range currents {
+				if !knownStates.Has(state) {
+					state = common.Other
+				}
+				counts[state] += float64(value)
+			}
+		}
+		for owner, counts := range countsByOwner {
+			for state, count := range counts {
+				updateFunc(metric.Type, state, owner, count)
+			}
+		}
+	}
+}
@@ -142,3 +142,53 @@ func TestNormalizeResourceMetrics(t *testing.T) {
 		}
 	}
 }
+
+func TestNormalizeResourceOwnerMetrics(t *testing.T) {
+	type update struct {
+		rtype string
+		state string
+		owner string
+		count float64
+	}
+	resourceMetrics := []common.Metric{
+		{
+			Type: "foo-project",
+			ByOwner: map[string]map[string]int{
+				"":       {"free": 3},
+				"job-a":  {"busy": 2, "leased": 1},
+				"job-b":  {"busy": 1},
+				"janitr": {"cleaning": 4},
+			},
+		},
+		{
+			Type: "bar-project",
+		},
+	}
+	expectedUpdates := []update{
+		{"bar-project", "busy", "", 0},
+		{"bar-project", "free", "", 0},
+		{"foo-project", "busy", "", 0},
+		{"foo-project", "free", "", 3},
+		{"foo-project", "other", "janitr", 4}, // cleaning
+		{"foo-project", "busy", "job-a", 2},
+		{"foo-project", "other", "job-a", 1}, // leased
+		{"foo-project", "busy", "job-b", 1},
+	}
+
+	updates := []update{}
+	metrics.NormalizeResourceOwnerMetrics(resourceMetrics, []string{"free", "busy"}, func(rtype, state, owner string, count float64) {
+		updates = append(updates, update{rtype, state, owner, count})
+	})
+	sort.Slice(updates, func(i, j int) bool {
+		if updates[i].rtype != updates[j].rtype {
+			return updates[i].rtype < updates[j].rtype
+		}
+		if updates[i].owner != updates[j].owner {
+			return updates[i].owner < updates[j].owner
+		}
+		return updates[i].state < updates[j].state
+	})
+	if !reflect.DeepEqual(expectedUpdates, updates) {
+		t.Errorf("expected %v, got %v", expectedUpdates, updates)
+	}
+}
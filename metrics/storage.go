@@ -0,0 +1,48 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"sigs.k8s.io/boskos/ranch"
+)
+
+type storageAbandonedCollector struct {
+	abandoned *prometheus.Desc
+	ranch     *ranch.Ranch
+}
+
+// NewStorageAbandonedCollector returns a collector which exports the calls to
+// the storage abandoned with the context of their request, e.g. as a client
+// gave up on it before its deadline.
+func NewStorageAbandonedCollector(ranch *ranch.Ranch) prometheus.Collector {
+	return storageAbandonedCollector{
+		abandoned: prometheus.NewDesc("boskos_storage_operations_abandoned_total", "Number of calls to the storage abandoned with their request, by operation and reason.", []string{"operation", "reason"}, nil),
+		ranch:     ranch,
+	}
+}
+
+func (sc storageAbandonedCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- sc.abandoned
+}
+
+func (sc storageAbandonedCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, count := range sc.ranch.AbandonedStorageOperations() {
+		ch <- prometheus.MustNewConstMetric(sc.abandoned, prometheus.CounterValue, float64(count.Count), count.Operation, count.Reason)
+	}
+}
@@ -0,0 +1,58 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/ranch"
+)
+
+type tenantResourcesCollector struct {
+	resources *prometheus.Desc
+	ranch     *ranch.Ranch
+}
+
+// NewTenantResourcesCollector returns a collector which exports the current
+// counts of the resources of each tenant by state, so every team sharing
+// boskos can watch its own pools.
+func NewTenantResourcesCollector(ranch *ranch.Ranch) prometheus.Collector {
+	return tenantResourcesCollector{
+		resources: prometheus.NewDesc("boskos_tenant_resources", "Number of resources recorded in Boskos by tenant and state.", []string{"tenant", "state"}, nil),
+		ranch:     ranch,
+	}
+}
+
+func (tc tenantResourcesCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- tc.resources
+}
+
+func (tc tenantResourcesCollector) Collect(ch chan<- prometheus.Metric) {
+	tenants, err := tc.ranch.TenantMetrics()
+	if err != nil {
+		logrus.WithError(err).Error("failed to get tenant metrics")
+	}
+	metrics := make([]common.Metric, 0, len(tenants))
+	for _, tenant := range tenants {
+		metrics = append(metrics, common.Metric{Type: tenant.Tenant, Current: tenant.Current})
+	}
+	NormalizeResourceMetrics(metrics, common.KnownStates, func(tenant, state string, count float64) {
+		ch <- prometheus.MustNewConstMetric(tc.resources, prometheus.GaugeValue, count, tenant, state)
+	})
+}
@@ -0,0 +1,164 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/crds"
+)
+
+// Reasons the calls to the backend are abandoned for.
+const (
+	// AbandonedDeadlineExceeded calls ran past the deadline of their request.
+	AbandonedDeadlineExceeded = "deadline_exceeded"
+	// AbandonedCanceled calls were canceled, e.g. as the client disconnected.
+	AbandonedCanceled = "canceled"
+)
+
+// WithContext returns a view of the ranch making the calls to the storage
+// with ctx, so a client that has given up on a request does not leave the
+// ranch calling the storage on its behalf. The view shares everything else
+// with r.
+func (r *Ranch) WithContext(ctx context.Context) *Ranch {
+	view := *r
+	view.Storage = r.Storage.WithContext(ctx)
+	return &view
+}
+
+// rollbackTimeout bounds the rollbacks of the operations which failed midway.
+const rollbackTimeout = 30 * time.Second
+
+// detached returns a view of the ranch making the calls to the storage with a
+// context of their own, bounded by rollbackTimeout, for the rollbacks which
+// must complete even if the request they undo was abandoned. The calls are
+// still traced as part of the request.
+func (r *Ranch) detached() (*Ranch, context.CancelFunc) {
+	ctx := trace.ContextWithSpan(context.Background(), trace.SpanFromContext(r.Storage.ctx))
+	ctx, cancel := context.WithTimeout(ctx, rollbackTimeout)
+	return r.WithContext(ctx), cancel
+}
+
+type abandonedOperationKey struct {
+	operation, reason string
+}
+
+// abandonedOperationCounter counts the calls to the backend abandoned with
+// their context by operation and reason.
+type abandonedOperationCounter struct {
+	lock   sync.Mutex
+	counts map[abandonedOperationKey]int
+}
+
+func newAbandonedOperationCounter() *abandonedOperationCounter {
+	return &abandonedOperationCounter{counts: map[abandonedOperationKey]int{}}
+}
+
+// observe counts operation if it failed with the end of ctx, and returns err.
+func (a *abandonedOperationCounter) observe(ctx context.Context, operation string, err error) error {
+	if err == nil || ctx.Err() == nil {
+		return err
+	}
+	reason := AbandonedCanceled
+	if ctx.Err() == context.DeadlineExceeded {
+		reason = AbandonedDeadlineExceeded
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.counts[abandonedOperationKey{operation: operation, reason: reason}]++
+	return err
+}
+
+func (a *abandonedOperationCounter) get() []common.StorageOperationCount {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	var counts []common.StorageOperationCount
+	for key, count := range a.counts {
+		counts = append(counts, common.StorageOperationCount{Operation: key.operation, Reason: key.reason, Count: count})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Operation != counts[j].Operation {
+			return counts[i].Operation < counts[j].Operation
+		}
+		return counts[i].Reason < counts[j].Reason
+	})
+	return counts
+}
+
+// AbandonedStorageOperations returns the counts of the calls to the storage
+// abandoned with the context of their request, by operation and reason,
+// sorted by operation and reason.
+func (r *Ranch) AbandonedStorageOperations() []common.StorageOperationCount {
+	return r.Storage.abandoned.get()
+}
+
+// abandonCountingBackend counts the calls to Backend abandoned with their
+// context.
+type abandonCountingBackend struct {
+	Backend
+	counter *abandonedOperationCounter
+}
+
+func (b *abandonCountingBackend) CreateResource(ctx context.Context, resource *crds.ResourceObject) error {
+	return b.counter.observe(ctx, "create_resource", b.Backend.CreateResource(ctx, resource))
+}
+
+func (b *abandonCountingBackend) GetResource(ctx context.Context, name string) (*crds.ResourceObject, error) {
+	res, err := b.Backend.GetResource(ctx, name)
+	return res, b.counter.observe(ctx, "get_resource", err)
+}
+
+func (b *abandonCountingBackend) ListResources(ctx context.Context) (*crds.ResourceObjectList, error) {
+	list, err := b.Backend.ListResources(ctx)
+	return list, b.counter.observe(ctx, "list_resources", err)
+}
+
+func (b *abandonCountingBackend) UpdateResource(ctx context.Context, resource *crds.ResourceObject) error {
+	return b.counter.observe(ctx, "update_resource", b.Backend.UpdateResource(ctx, resource))
+}
+
+func (b *abandonCountingBackend) DeleteResource(ctx context.Context, name string) error {
+	return b.counter.observe(ctx, "delete_resource", b.Backend.DeleteResource(ctx, name))
+}
+
+func (b *abandonCountingBackend) CreateDynamicResourceLifeCycle(ctx context.Context, drlc *crds.DRLCObject) error {
+	return b.counter.observe(ctx, "create_dynamic_resource_lifecycle", b.Backend.CreateDynamicResourceLifeCycle(ctx, drlc))
+}
+
+func (b *abandonCountingBackend) GetDynamicResourceLifeCycle(ctx context.Context, name string) (*crds.DRLCObject, error) {
+	drlc, err := b.Backend.GetDynamicResourceLifeCycle(ctx, name)
+	return drlc, b.counter.observe(ctx, "get_dynamic_resource_lifecycle", err)
+}
+
+func (b *abandonCountingBackend) ListDynamicResourceLifeCycles(ctx context.Context) (*crds.DRLCObjectList, error) {
+	list, err := b.Backend.ListDynamicResourceLifeCycles(ctx)
+	return list, b.counter.observe(ctx, "list_dynamic_resource_lifecycles", err)
+}
+
+func (b *abandonCountingBackend) UpdateDynamicResourceLifeCycle(ctx context.Context, drlc *crds.DRLCObject) error {
+	return b.counter.observe(ctx, "update_dynamic_resource_lifecycle", b.Backend.UpdateDynamicResourceLifeCycle(ctx, drlc))
+}
+
+func (b *abandonCountingBackend) DeleteDynamicResourceLifeCycle(ctx context.Context, name string) error {
+	return b.counter.observe(ctx, "delete_dynamic_resource_lifecycle", b.Backend.DeleteDynamicResourceLifeCycle(ctx, name))
+}
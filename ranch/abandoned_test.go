@@ -0,0 +1,99 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	fakectrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/crds"
+)
+
+// contextAwareClient fails the calls made with a done context, like a client
+// talking to an apiserver would.
+type contextAwareClient struct {
+	ctrlruntimeclient.Client
+}
+
+func (c *contextAwareClient) Get(ctx context.Context, key ctrlruntimeclient.ObjectKey, obj ctrlruntimeclient.Object) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.Client.Get(ctx, key, obj)
+}
+
+func TestWithContextAbandonsStorageCalls(t *testing.T) {
+	res := newResource("res", "t", common.Busy, "owner", startTime)
+	res.SetNamespace(testNS)
+	client := &contextAwareClient{Client: fakectrlruntimeclient.NewFakeClient(res)}
+	r, _ := NewRanch("", NewStorage(context.Background(), client, testNS), testTTL)
+
+	expired, cancelExpired := context.WithDeadline(context.Background(), time.Unix(0, 0))
+	defer cancelExpired()
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, ctx := range []context.Context{expired, canceled, canceled} {
+		if err := r.WithContext(ctx).Release("res", common.Dirty, "owner"); err == nil {
+			t.Error("expected the release to fail with a done context")
+		}
+	}
+
+	expected := []common.StorageOperationCount{
+		{Operation: "get_resource", Reason: AbandonedCanceled, Count: 2},
+		{Operation: "get_resource", Reason: AbandonedDeadlineExceeded, Count: 1},
+	}
+	if got := r.AbandonedStorageOperations(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected abandoned operations %v, got %v", expected, got)
+	}
+
+	// The ranch itself keeps its own context.
+	if err := r.Release("res", common.Dirty, "owner"); err != nil {
+		t.Errorf("failed to release: %v", err)
+	}
+	if got := r.AbandonedStorageOperations(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected abandoned operations %v, got %v", expected, got)
+	}
+}
+
+func TestRollbackOutlivesAbandonedRequest(t *testing.T) {
+	res := newResource("res", "t", common.Busy, "owner", startTime)
+	res.SetNamespace(testNS)
+	client := &contextAwareClient{Client: fakectrlruntimeclient.NewFakeClient(res)}
+	r, _ := NewRanch("", NewStorage(context.Background(), client, testNS), testTTL)
+	acquired, err := r.Storage.GetResource("res")
+	if err != nil {
+		t.Fatalf("failed to get resource: %v", err)
+	}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	r.WithContext(canceled).rollbackBatch([]*crds.ResourceObject{acquired}, "owner", common.Free)
+
+	rolledBack, err := r.Storage.GetResource("res")
+	if err != nil {
+		t.Fatalf("failed to get resource: %v", err)
+	}
+	if rolledBack.Status.Owner != "" || rolledBack.Status.State != common.Free {
+		t.Errorf("expected the resource to be rolled back to free, got %s owned by %q", rolledBack.Status.State, rolledBack.Status.Owner)
+	}
+}
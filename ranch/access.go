@@ -0,0 +1,94 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/crds"
+)
+
+// accessManager holds the parsed access templates of each resource type.
+type accessManager struct {
+	lock      sync.RWMutex
+	templates map[string]map[string]*template.Template
+}
+
+func newAccessManager() *accessManager {
+	return &accessManager{templates: map[string]map[string]*template.Template{}}
+}
+
+func (a *accessManager) set(config *common.BoskosConfig) {
+	templates := map[string]map[string]*template.Template{}
+	for _, entry := range config.Resources {
+		if len(entry.Access) == 0 {
+			continue
+		}
+		parsed, err := entry.Access.Parse()
+		if err != nil {
+			// Not expected, the config was validated.
+			logrus.WithError(err).Errorf("invalid access templates for type %s", entry.Type)
+			continue
+		}
+		templates[entry.Type] = parsed
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.templates = templates
+}
+
+func (a *accessManager) get(rType string) map[string]*template.Template {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	return a.templates[rType]
+}
+
+// Access renders the access templates of the type of res, telling its owner
+// how to connect to it. Details that fail to render, e.g. because the user
+// data they refer to is not set yet, are left out.
+func (r *Ranch) Access(res *crds.ResourceObject) map[string]string {
+	templates := r.access.get(res.Spec.Type)
+	if len(templates) == 0 {
+		return nil
+	}
+	data := common.AccessData{Name: res.Name, Type: res.Spec.Type, UserData: res.Status.UserData}
+	if data.UserData == nil {
+		data.UserData = map[string]string{}
+	}
+	var failed []string
+	access := map[string]string{}
+	for key, t := range templates {
+		var rendered strings.Builder
+		if err := t.Execute(&rendered, data); err != nil {
+			logrus.WithError(err).Debugf("failed to render access detail %s of resource %s", key, res.Name)
+			failed = append(failed, key)
+			continue
+		}
+		access[key] = rendered.String()
+	}
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		logrus.Warningf("access details %v of resource %s could not be rendered", failed, res.Name)
+	}
+	return access
+}
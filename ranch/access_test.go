@@ -0,0 +1,76 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"reflect"
+	"testing"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+func TestAccess(t *testing.T) {
+	templates := common.AccessTemplates{
+		"endpoint":    "https://{{.UserData.host}}:443",
+		"kubeconfig":  "/etc/kubeconfigs/{{.Type}}/{{.Name}}",
+		"credentials": "projects/{{.Name}}/secrets/{{.UserData.secret}}",
+	}
+	testCases := []struct {
+		name     string
+		rType    string
+		userData map[string]string
+		expected map[string]string
+	}{
+		{
+			name:     "all user data set",
+			rType:    "cluster",
+			userData: map[string]string{"host": "10.0.0.1", "secret": "admin"},
+			expected: map[string]string{
+				"endpoint":    "https://10.0.0.1:443",
+				"kubeconfig":  "/etc/kubeconfigs/cluster/res",
+				"credentials": "projects/res/secrets/admin",
+			},
+		},
+		{
+			name:     "missing user data",
+			rType:    "cluster",
+			userData: map[string]string{"host": "10.0.0.1"},
+			expected: map[string]string{
+				"endpoint":   "https://10.0.0.1:443",
+				"kubeconfig": "/etc/kubeconfigs/cluster/res",
+			},
+		},
+		{
+			name:  "type without templates",
+			rType: "project",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := makeTestRanch(nil)
+			r.access.set(&common.BoskosConfig{Resources: []common.ResourceEntry{
+				{Type: "cluster", Access: templates},
+			}})
+			res := newResource("res", tc.rType, common.Busy, "owner", startTime)
+			res.Status.UserData = tc.userData
+
+			if access := r.Access(res); !reflect.DeepEqual(access, tc.expected) {
+				t.Errorf("expected access %v, got %v", tc.expected, access)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"fmt"
+	"sync"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+// TypeRenamed will be returned if a rejected alias of a resource type is used.
+type TypeRenamed struct {
+	alias, rType string
+}
+
+func (t TypeRenamed) Error() string {
+	return fmt.Sprintf("resource type %s was renamed to %s", t.alias, t.rType)
+}
+
+// typeAlias is the type an alias resolves to.
+type typeAlias struct {
+	rType    string
+	rejected bool
+}
+
+// aliasManager holds the former names of the resource types.
+type aliasManager struct {
+	lock    sync.RWMutex
+	aliases map[string]typeAlias
+}
+
+func newAliasManager() *aliasManager {
+	return &aliasManager{aliases: map[string]typeAlias{}}
+}
+
+func (a *aliasManager) set(config *common.BoskosConfig) {
+	aliases := map[string]typeAlias{}
+	for _, entry := range config.Resources {
+		for _, alias := range entry.Aliases {
+			aliases[alias.Name] = typeAlias{rType: entry.Type, rejected: alias.Rejected}
+		}
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.aliases = aliases
+}
+
+func (a *aliasManager) get(name string) (typeAlias, bool) {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	alias, ok := a.aliases[name]
+	return alias, ok
+}
+
+// ResolveType returns the resource type name refers to, which is name itself
+// unless it is an alias, and whether name is an alias.
+// Out: TypeRenamed error along with the type if name is a rejected alias.
+func (r *Ranch) ResolveType(name string) (string, bool, error) {
+	alias, ok := r.aliases.get(name)
+	if !ok {
+		return name, false, nil
+	}
+	if alias.rejected {
+		return alias.rType, true, &TypeRenamed{alias: name, rType: alias.rType}
+	}
+	return alias.rType, true, nil
+}
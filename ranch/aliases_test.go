@@ -0,0 +1,68 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"testing"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+func TestResolveType(t *testing.T) {
+	testCases := []struct {
+		name        string
+		in          string
+		expected    string
+		expectAlias bool
+		expectErr   error
+	}{
+		{
+			name:     "type",
+			in:       "gce-project",
+			expected: "gce-project",
+		},
+		{
+			name:        "alias",
+			in:          "gcp-project",
+			expected:    "gce-project",
+			expectAlias: true,
+		},
+		{
+			name:        "rejected alias",
+			in:          "project",
+			expected:    "gce-project",
+			expectAlias: true,
+			expectErr:   &TypeRenamed{alias: "project", rType: "gce-project"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := makeTestRanch(nil)
+			r.aliases.set(&common.BoskosConfig{Resources: []common.ResourceEntry{{
+				Type:    "gce-project",
+				Aliases: []common.TypeAlias{{Name: "gcp-project"}, {Name: "project", Rejected: true}},
+			}}})
+			rType, alias, err := r.ResolveType(tc.in)
+			if !AreErrorsEqual(err, tc.expectErr) {
+				t.Fatalf("expected error %v, got %v", tc.expectErr, err)
+			}
+			if rType != tc.expected || alias != tc.expectAlias {
+				t.Errorf("expected %q (alias %t), got %q (alias %t)", tc.expected, tc.expectAlias, rType, alias)
+			}
+		})
+	}
+}
@@ -0,0 +1,350 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+// ApprovalPending will be returned if an acquire request of a type gated by
+// an approval waits for an operator to approve it.
+type ApprovalPending struct {
+	id, rType string
+}
+
+func (a ApprovalPending) Error() string {
+	return fmt.Sprintf("acquisition of type %s is pending approval %s", a.rType, a.id)
+}
+
+// ApprovalDenied will be returned if an acquire request of a type gated by an
+// approval was denied, or not approved in time.
+type ApprovalDenied struct {
+	id, rType, reason string
+}
+
+func (a ApprovalDenied) Error() string {
+	msg := fmt.Sprintf("acquisition of type %s denied by approval %s", a.rType, a.id)
+	if a.reason != "" {
+		msg += ": " + a.reason
+	}
+	return msg
+}
+
+// ApprovalNotFound will be returned if an approval to decide does not exist.
+type ApprovalNotFound struct {
+	id string
+}
+
+func (a ApprovalNotFound) Error() string {
+	return fmt.Sprintf("approval %s not found", a.id)
+}
+
+// ApprovalNotPending will be returned when deciding an approval which was
+// already decided.
+type ApprovalNotPending struct {
+	id, status string
+}
+
+func (a ApprovalNotPending) Error() string {
+	return fmt.Sprintf("approval %s is not pending but %s", a.id, a.status)
+}
+
+// ApprovalBacklogFull will be returned instead of a new ApprovalPending if
+// too many acquire requests of a type already wait for approval.
+type ApprovalBacklogFull struct {
+	rType string
+	max   int
+}
+
+func (a ApprovalBacklogFull) Error() string {
+	return fmt.Sprintf("%d acquisitions of type %s already pending approval", a.max, a.rType)
+}
+
+// approvalTimedOut is the reason of the requests denied by the timeout.
+const approvalTimedOut = "not approved in time"
+
+// approvalNotifyTimeout bounds the calls to the approval webhooks.
+const approvalNotifyTimeout = 5 * time.Second
+
+// approvalKey identifies the acquire requests across the polls of a client.
+type approvalKey struct {
+	rType, owner, requestID string
+}
+
+// approvalManager holds the approval gates of the types and the requests
+// waiting for them.
+type approvalManager struct {
+	lock      sync.Mutex
+	approvals map[string]common.AcquisitionApproval
+	requests  map[approvalKey]*common.ApprovalRequest
+	byID      map[string]approvalKey
+	client    *http.Client
+}
+
+func newApprovalManager() *approvalManager {
+	return &approvalManager{
+		approvals: map[string]common.AcquisitionApproval{},
+		requests:  map[approvalKey]*common.ApprovalRequest{},
+		byID:      map[string]approvalKey{},
+		client:    &http.Client{Timeout: approvalNotifyTimeout},
+	}
+}
+
+func (m *approvalManager) set(config *common.BoskosConfig) {
+	approvals := map[string]common.AcquisitionApproval{}
+	for _, entry := range config.Resources {
+		if entry.Approval != nil {
+			approvals[entry.Type] = *entry.Approval
+		}
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.approvals = approvals
+	// Requests of types no longer gated would never be decided.
+	for key, request := range m.requests {
+		if _, ok := approvals[key.rType]; !ok {
+			m.forget(key, request)
+		}
+	}
+}
+
+func timeoutOf(approval common.AcquisitionApproval) time.Duration {
+	if approval.Timeout != nil && approval.Timeout.Duration != nil {
+		return *approval.Timeout.Duration
+	}
+	return common.DefaultApprovalTimeout
+}
+
+func maxPendingOf(approval common.AcquisitionApproval) int {
+	if approval.MaxPending > 0 {
+		return approval.MaxPending
+	}
+	return common.DefaultMaxPendingApprovals
+}
+
+func (m *approvalManager) forget(key approvalKey, request *common.ApprovalRequest) {
+	delete(m.requests, key)
+	delete(m.byID, request.ID)
+}
+
+// expire denies the pending requests not approved in time and forgets the
+// decided requests once expired. It must be called with the lock held.
+func (m *approvalManager) expire(now time.Time) {
+	for key, request := range m.requests {
+		if now.Before(request.Expires) {
+			continue
+		}
+		if request.Status != common.ApprovalPending {
+			m.forget(key, request)
+			continue
+		}
+		request.Status = common.ApprovalDenied
+		request.Reason = approvalTimedOut
+		// Denied requests are kept for another timeout so their clients
+		// learn about the denial.
+		request.Expires = now.Add(timeoutOf(m.approvals[key.rType]))
+	}
+}
+
+// check returns nil if the acquire request of owner for rType may proceed,
+// or the ApprovalPending, ApprovalDenied or ApprovalBacklogFull error to
+// return. A new request pending approval is returned along with the webhook
+// to notify of it, if any.
+func (m *approvalManager) check(rType, owner, requestID string, now time.Time) (*common.ApprovalRequest, string, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	approval, ok := m.approvals[rType]
+	if !ok {
+		return nil, "", nil
+	}
+	m.expire(now)
+	key := approvalKey{rType: rType, owner: owner, requestID: requestID}
+	request, ok := m.requests[key]
+	if !ok {
+		pending := 0
+		for key, request := range m.requests {
+			if key.rType == rType && request.Status == common.ApprovalPending {
+				pending++
+			}
+		}
+		if max := maxPendingOf(approval); pending >= max {
+			return nil, "", &ApprovalBacklogFull{rType: rType, max: max}
+		}
+		request = &common.ApprovalRequest{
+			ID:        uuid.New().String(),
+			Type:      rType,
+			Owner:     owner,
+			RequestID: requestID,
+			Status:    common.ApprovalPending,
+			CreatedAt: now,
+			Expires:   now.Add(timeoutOf(approval)),
+		}
+		m.requests[key] = request
+		m.byID[request.ID] = key
+		created := *request
+		return &created, approval.WebhookURL, &ApprovalPending{id: request.ID, rType: rType}
+	}
+	switch request.Status {
+	case common.ApprovalApproved:
+		return nil, "", nil
+	case common.ApprovalDenied:
+		return nil, "", &ApprovalDenied{id: request.ID, rType: rType, reason: request.Reason}
+	default:
+		return nil, "", &ApprovalPending{id: request.ID, rType: rType}
+	}
+}
+
+// complete forgets the approval of a request which acquired a resource, so
+// that the next acquisition needs another approval.
+func (m *approvalManager) complete(rType, owner, requestID string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	key := approvalKey{rType: rType, owner: owner, requestID: requestID}
+	if request, ok := m.requests[key]; ok {
+		m.forget(key, request)
+	}
+}
+
+func (m *approvalManager) decide(id string, approve bool, by, reason string, now time.Time) (*common.ApprovalRequest, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.expire(now)
+	key, ok := m.byID[id]
+	if !ok {
+		return nil, &ApprovalNotFound{id: id}
+	}
+	request := m.requests[key]
+	if request.Status != common.ApprovalPending {
+		return nil, &ApprovalNotPending{id: id, status: request.Status}
+	}
+	request.Status = common.ApprovalDenied
+	if approve {
+		request.Status = common.ApprovalApproved
+	}
+	request.DecidedBy = by
+	request.Reason = reason
+	request.Expires = now.Add(timeoutOf(m.approvals[key.rType]))
+	decided := *request
+	return &decided, nil
+}
+
+func (m *approvalManager) list(rType string, now time.Time) []common.ApprovalRequest {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.expire(now)
+	requests := []common.ApprovalRequest{}
+	for key, request := range m.requests {
+		if rType == "" || key.rType == rType {
+			requests = append(requests, *request)
+		}
+	}
+	sort.Slice(requests, func(i, j int) bool {
+		if !requests[i].CreatedAt.Equal(requests[j].CreatedAt) {
+			return requests[i].CreatedAt.Before(requests[j].CreatedAt)
+		}
+		return requests[i].ID < requests[j].ID
+	})
+	return requests
+}
+
+// notify posts a new request pending approval to webhookURL.
+func (m *approvalManager) notify(webhookURL string, request common.ApprovalRequest) error {
+	b, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), approvalNotifyTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("approval webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("approval webhook returned status %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// isJanitorTransition is true if moving a resource from state to dest is the
+// work of a janitor, i.e. cleaning a resource which is not free.
+func isJanitorTransition(state, dest string) bool {
+	return dest == common.Cleaning && state != common.Free
+}
+
+// admitApproval gates the acquisitions of the types configuring an approval,
+// except the ones of janitors. Requests are told apart by owner and request
+// ID, so clients polling with the same request ID wait for the same approval.
+func (r *Ranch) admitApproval(rType, state, dest, owner, requestID string) error {
+	if isJanitorTransition(state, dest) {
+		return nil
+	}
+	created, webhookURL, err := r.approvals.check(rType, owner, requestID, r.now().Time)
+	if created != nil {
+		logrus.WithFields(logrus.Fields{"type": rType, "owner": owner, "approval": created.ID}).Info("Acquisition pending approval")
+		if webhookURL != "" {
+			// Operators are notified in the background, so acquire requests
+			// are not held up by the webhook.
+			go func() {
+				if err := r.approvals.notify(webhookURL, *created); err != nil {
+					logrus.WithError(err).Warningf("Failed to notify approval webhook of approval %s", created.ID)
+				}
+			}()
+		}
+	}
+	return err
+}
+
+// DecideApproval approves or denies the acquire request pending approval id
+// on behalf of the operator by. Approved requests acquire a resource the next
+// time their client polls.
+// Out: The decided request on success, or
+//      ApprovalNotFound if there is no such request, or
+//      ApprovalNotPending if the request was already decided.
+func (r *Ranch) DecideApproval(id string, approve bool, by, reason string) (*common.ApprovalRequest, error) {
+	request, err := r.approvals.decide(id, approve, by, reason, r.now().Time)
+	if err != nil {
+		return nil, err
+	}
+	logrus.WithFields(logrus.Fields{"approval": id, "type": request.Type, "owner": request.Owner, "by": by}).Infof("Acquisition %s", request.Status)
+	return request, nil
+}
+
+// Approvals lists the acquire requests of rType waiting for approval or
+// recently decided, oldest first. An empty rType lists all types.
+func (r *Ranch) Approvals(rType string) []common.ApprovalRequest {
+	return r.approvals.list(rType, r.now().Time)
+}
@@ -0,0 +1,175 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+func TestApprovals(t *testing.T) {
+	notified := make(chan common.ApprovalRequest, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var request common.ApprovalRequest
+		if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+			t.Errorf("failed to decode notification: %v", err)
+		}
+		notified <- request
+	}))
+	defer server.Close()
+
+	now := fakeNow
+	r := makeTestRanch(nil)
+	r.SetClock(func() metav1.Time { return now })
+	timeout := time.Hour
+	if err := r.ApplyConfig(&common.BoskosConfig{Resources: []common.ResourceEntry{
+		{Type: "rack", State: common.Free, Names: []string{"rack-1", "rack-2"}, Approval: &common.AcquisitionApproval{
+			WebhookURL: server.URL,
+			Timeout:    &common.Duration{Duration: &timeout},
+		}},
+		{Type: "vm", State: common.Free, Names: []string{"vm-1"}},
+	}}); err != nil {
+		t.Fatalf("failed to apply config: %v", err)
+	}
+
+	if _, _, err := r.Acquire("vm", common.Free, common.Busy, "job", "vm-request"); err != nil {
+		t.Errorf("expected types without approval to be acquired, got %v", err)
+	}
+
+	_, _, err := r.Acquire("rack", common.Free, common.Busy, "job", "request-1")
+	pending, ok := err.(*ApprovalPending)
+	if !ok {
+		t.Fatalf("expected the acquisition to wait for approval, got %v", err)
+	}
+	select {
+	case request := <-notified:
+		if request.ID != pending.id || request.Owner != "job" || request.Status != common.ApprovalPending {
+			t.Errorf("unexpected notification %+v", request)
+		}
+	case <-time.After(wait.ForeverTestTimeout):
+		t.Fatal("expected the webhook to be notified")
+	}
+	if _, _, err := r.Acquire("rack", common.Free, common.Busy, "job", "request-1"); !AreErrorsEqual(err, pending) {
+		t.Errorf("expected polls to wait for the same approval %v, got %v", pending, err)
+	}
+	if approvals := r.Approvals("rack"); len(approvals) != 1 || approvals[0].ID != pending.id {
+		t.Errorf("expected the pending approval to be listed, got %v", approvals)
+	}
+
+	if _, err := r.DecideApproval("unknown", true, "sre", ""); !AreErrorsEqual(err, &ApprovalNotFound{id: "unknown"}) {
+		t.Errorf("expected unknown approvals not to be found, got %v", err)
+	}
+	if request, err := r.DecideApproval(pending.id, true, "sre", "rack booked for the release"); err != nil || request.Status != common.ApprovalApproved || request.DecidedBy != "sre" {
+		t.Fatalf("expected the approval to be granted, got %+v, %v", request, err)
+	}
+	if _, err := r.DecideApproval(pending.id, false, "sre", ""); !AreErrorsEqual(err, &ApprovalNotPending{id: pending.id, status: common.ApprovalApproved}) {
+		t.Errorf("expected decided approvals not to be decided again, got %v", err)
+	}
+	res, _, err := r.Acquire("rack", common.Free, common.Busy, "job", "request-1")
+	if err != nil {
+		t.Fatalf("expected the approved acquisition to succeed, got %v", err)
+	}
+	if approvals := r.Approvals("rack"); len(approvals) != 0 {
+		t.Errorf("expected the served approval to be forgotten, got %v", approvals)
+	}
+	if err := r.Release(res.Name, common.Dirty, "job"); err != nil {
+		t.Fatalf("failed to release: %v", err)
+	}
+	if _, _, err := r.Acquire("rack", common.Dirty, common.Cleaning, "janitor", ""); err != nil {
+		t.Errorf("expected janitors not to wait for approval, got %v", err)
+	}
+
+	_, _, err = r.Acquire("rack", common.Free, common.Busy, "job", "request-2")
+	denied, ok := err.(*ApprovalPending)
+	if !ok {
+		t.Fatalf("expected the acquisition to wait for approval, got %v", err)
+	}
+	<-notified
+	if _, err := r.DecideApproval(denied.id, false, "sre", "rack reserved"); err != nil {
+		t.Fatalf("failed to deny: %v", err)
+	}
+	if _, _, err := r.Acquire("rack", common.Free, common.Busy, "job", "request-2"); !AreErrorsEqual(err, &ApprovalDenied{id: denied.id, rType: "rack", reason: "rack reserved"}) {
+		t.Errorf("expected the acquisition to be denied, got %v", err)
+	}
+
+	_, _, err = r.Acquire("rack", common.Free, common.Busy, "job", "request-3")
+	expired, ok := err.(*ApprovalPending)
+	if !ok {
+		t.Fatalf("expected the acquisition to wait for approval, got %v", err)
+	}
+	<-notified
+	now = metav1.NewTime(now.Add(timeout))
+	if _, _, err := r.Acquire("rack", common.Free, common.Busy, "job", "request-3"); !AreErrorsEqual(err, &ApprovalDenied{id: expired.id, rType: "rack", reason: approvalTimedOut}) {
+		t.Errorf("expected the acquisition to be denied once timed out, got %v", err)
+	}
+	now = metav1.NewTime(now.Add(timeout))
+	if approvals := r.Approvals(""); len(approvals) != 0 {
+		t.Errorf("expected the denied approvals to be forgotten, got %v", approvals)
+	}
+}
+
+func TestApprovalsOfOtherAcquisitions(t *testing.T) {
+	now := fakeNow
+	r := makeTestRanch(nil)
+	r.SetClock(func() metav1.Time { return now })
+	if err := r.ApplyConfig(&common.BoskosConfig{Resources: []common.ResourceEntry{
+		{Type: "rack", State: common.Free, Names: []string{"rack-1", "rack-2", "rack-3"}, Approval: &common.AcquisitionApproval{MaxPending: 1}},
+	}}); err != nil {
+		t.Fatalf("failed to apply config: %v", err)
+	}
+
+	_, err := r.AcquireByStateWithPriority(common.Free, common.Busy, "job", []string{"rack-1"}, "by-state")
+	pending, ok := err.(*ApprovalPending)
+	if !ok {
+		t.Fatalf("expected the acquisition by state to wait for approval, got %v", err)
+	}
+	if _, err := r.DecideApproval(pending.id, true, "sre", ""); err != nil {
+		t.Fatalf("failed to approve: %v", err)
+	}
+	if _, err := r.AcquireByStateWithPriority(common.Free, common.Busy, "job", []string{"rack-1"}, "by-state"); err != nil {
+		t.Fatalf("expected the approved acquisition by state to succeed, got %v", err)
+	}
+
+	if _, _, err := r.Acquire("rack", common.Free, common.Cleaning, "job", "to-cleaning"); !isApprovalPending(err) {
+		t.Errorf("expected acquiring free resources to clean them to wait for approval, got %v", err)
+	}
+	if _, _, err := r.Acquire("rack", common.Free, common.Busy, "job", "over-backlog"); !AreErrorsEqual(err, &ApprovalBacklogFull{rType: "rack", max: 1}) {
+		t.Errorf("expected the requests over the backlog to be turned away, got %v", err)
+	}
+
+	// The pending request times out and rack-1 goes stale.
+	now = metav1.NewTime(now.Add(2 * common.DefaultApprovalTimeout))
+	if _, _, err := r.ClaimExpired("rack", common.Busy, "thief", time.Minute); !isApprovalPending(err) {
+		t.Errorf("expected claims to wait for approval, got %v", err)
+	}
+	if _, _, err := r.ClaimExpired("rack", common.Cleaning, "janitor", time.Minute); err != nil {
+		t.Errorf("expected janitors to claim without approval, got %v", err)
+	}
+}
+
+func isApprovalPending(err error) bool {
+	_, ok := err.(*ApprovalPending)
+	return ok
+}
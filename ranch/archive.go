@@ -0,0 +1,187 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+// EventArchive stores the events of the resources durably, so they can be
+// queried long after the live stream of Watch went by, e.g. to find who held
+// a resource when a job broke it.
+type EventArchive interface {
+	// Record stores an event.
+	Record(ctx context.Context, event common.ResourceEvent) error
+	// Query returns the stored events matching query, oldest first.
+	Query(ctx context.Context, query EventQuery) ([]common.ResourceEvent, error)
+	// Prune deletes the events older than before and returns how many it
+	// deleted.
+	Prune(ctx context.Context, before time.Time) (int, error)
+}
+
+// EventQuery selects archived events. Empty fields match every event.
+type EventQuery struct {
+	Name string
+	Type string
+	// Since and Until bound the time of the events, Since inclusive and
+	// Until exclusive.
+	Since time.Time
+	Until time.Time
+	// Limit, if positive, is the most events returned.
+	Limit int
+}
+
+// matches tells whether event is selected by the query.
+func (q EventQuery) matches(event common.ResourceEvent) bool {
+	return (q.Name == "" || event.Name == q.Name) &&
+		(q.Type == "" || event.Type == q.Type) &&
+		!event.Time.Before(q.Since) &&
+		(q.Until.IsZero() || event.Time.Before(q.Until))
+}
+
+// EventArchiveDisabled will be returned by queries of the events when no
+// archive is set.
+type EventArchiveDisabled struct{}
+
+func (EventArchiveDisabled) Error() string {
+	return "the events of the resources are not archived"
+}
+
+// memoryEventArchive keeps the latest events in a ring buffer.
+type memoryEventArchive struct {
+	lock   sync.Mutex
+	events []common.ResourceEvent
+	// next is the index the next event is stored at once the buffer is full.
+	next int
+}
+
+// NewMemoryEventArchive returns an EventArchive keeping the latest size
+// events in memory. They are lost on restarts, so it suits tests and
+// installations content with a short history.
+func NewMemoryEventArchive(size int) EventArchive {
+	if size <= 0 {
+		size = 1
+	}
+	return &memoryEventArchive{events: make([]common.ResourceEvent, 0, size)}
+}
+
+func (a *memoryEventArchive) Record(_ context.Context, event common.ResourceEvent) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if len(a.events) < cap(a.events) {
+		a.events = append(a.events, event)
+		return nil
+	}
+	a.events[a.next] = event
+	a.next = (a.next + 1) % len(a.events)
+	return nil
+}
+
+// ordered returns the events oldest first. The caller must hold the lock.
+func (a *memoryEventArchive) ordered() []common.ResourceEvent {
+	return append(append([]common.ResourceEvent{}, a.events[a.next:]...), a.events[:a.next]...)
+}
+
+func (a *memoryEventArchive) Query(_ context.Context, query EventQuery) ([]common.ResourceEvent, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	var events []common.ResourceEvent
+	for _, event := range a.ordered() {
+		if query.Limit > 0 && len(events) == query.Limit {
+			break
+		}
+		if query.matches(event) {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (a *memoryEventArchive) Prune(_ context.Context, before time.Time) (int, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	kept := make([]common.ResourceEvent, 0, cap(a.events))
+	for _, event := range a.ordered() {
+		if !event.Time.Before(before) {
+			kept = append(kept, event)
+		}
+	}
+	pruned := len(a.events) - len(kept)
+	a.events, a.next = kept, 0
+	return pruned, nil
+}
+
+// SetEventArchive sets the archive the events of the resources are recorded
+// in by ArchiveEvents. It must be called before the ranch starts serving
+// requests.
+func (r *Ranch) SetEventArchive(archive EventArchive) {
+	r.archive = archive
+}
+
+// ArchiveEvents records the events of the resources in the archive until ctx
+// is done. Events are lost while the archive lags too far behind the changes
+// of the resources, as those are never blocked by it.
+func (r *Ranch) ArchiveEvents(ctx context.Context) {
+	if r.archive == nil {
+		return
+	}
+	for r.archiveEvents(ctx) {
+		logrus.Warning("The event archive lagged behind the resource events, some were not archived.")
+	}
+}
+
+// archiveEvents records the events of a watch until ctx is done, when it
+// returns false, or the watch is dropped.
+func (r *Ranch) archiveEvents(ctx context.Context) bool {
+	events, stop := r.Watch()
+	defer stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case event, ok := <-events:
+			if !ok {
+				return true
+			}
+			if err := r.archive.Record(ctx, event); err != nil {
+				logrus.WithError(err).WithField("name", event.Name).Warning("Failed to archive resource event.")
+			}
+		}
+	}
+}
+
+// Events returns the archived events matching query, oldest first.
+func (r *Ranch) Events(query EventQuery) ([]common.ResourceEvent, error) {
+	if r.archive == nil {
+		return nil, &EventArchiveDisabled{}
+	}
+	return r.archive.Query(r.Storage.ctx, query)
+}
+
+// PruneEvents deletes the archived events older than retention.
+func (r *Ranch) PruneEvents(retention time.Duration) (int, error) {
+	if r.archive == nil {
+		return 0, &EventArchiveDisabled{}
+	}
+	return r.archive.Prune(r.Storage.ctx, r.now().Add(-retention))
+}
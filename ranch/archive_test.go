@@ -0,0 +1,143 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+func TestMemoryEventArchive(t *testing.T) {
+	base := startTime.Time
+	events := []common.ResourceEvent{
+		{Kind: common.ResourceAdded, Name: "dropped", Type: "t", Time: base},
+		{Kind: common.ResourceChanged, Name: "a", Type: "t", Time: base.Add(time.Minute), State: common.Busy},
+		{Kind: common.ResourceChanged, Name: "b", Type: "u", Time: base.Add(2 * time.Minute), State: common.Busy},
+		{Kind: common.ResourceChanged, Name: "a", Type: "t", Time: base.Add(3 * time.Minute), State: common.Dirty},
+	}
+	archive := NewMemoryEventArchive(3)
+	for _, event := range events {
+		if err := archive.Record(context.Background(), event); err != nil {
+			t.Fatalf("failed to record event: %v", err)
+		}
+	}
+
+	testCases := []struct {
+		name     string
+		query    EventQuery
+		expected []common.ResourceEvent
+	}{
+		{
+			name:     "the oldest events are dropped once full",
+			expected: events[1:],
+		},
+		{
+			name:     "by name",
+			query:    EventQuery{Name: "a"},
+			expected: []common.ResourceEvent{events[1], events[3]},
+		},
+		{
+			name:     "by type",
+			query:    EventQuery{Type: "u"},
+			expected: []common.ResourceEvent{events[2]},
+		},
+		{
+			name:     "by time range",
+			query:    EventQuery{Since: base.Add(2 * time.Minute), Until: base.Add(3 * time.Minute)},
+			expected: []common.ResourceEvent{events[2]},
+		},
+		{
+			name:     "limited",
+			query:    EventQuery{Limit: 1},
+			expected: []common.ResourceEvent{events[1]},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := archive.Query(context.Background(), tc.query)
+			if err != nil {
+				t.Fatalf("failed to query events: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("expected events %+v, got %+v", tc.expected, got)
+			}
+		})
+	}
+
+	pruned, err := archive.Prune(context.Background(), base.Add(2*time.Minute))
+	if err != nil {
+		t.Fatalf("failed to prune events: %v", err)
+	}
+	if pruned != 1 {
+		t.Errorf("expected 1 pruned event, got %d", pruned)
+	}
+	got, _ := archive.Query(context.Background(), EventQuery{})
+	if !reflect.DeepEqual(got, events[2:]) {
+		t.Errorf("expected events %+v once pruned, got %+v", events[2:], got)
+	}
+}
+
+func TestArchiveEvents(t *testing.T) {
+	r := makeTestRanch([]runtime.Object{
+		newResource("res", "t", common.Busy, "owner", startTime),
+	})
+	if _, err := r.Events(EventQuery{}); err == nil {
+		t.Error("expected an error without an archive")
+	}
+	r.SetEventArchive(NewMemoryEventArchive(10))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.ArchiveEvents(ctx)
+	if err := wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		return r.Storage.watchers.watched(), nil
+	}); err != nil {
+		t.Fatal("the archive never watched the resources")
+	}
+
+	if err := r.Release("res", common.Dirty, "owner"); err != nil {
+		t.Fatalf("failed to release: %v", err)
+	}
+	expected := []common.ResourceEvent{
+		{Kind: common.ResourceChanged, Name: "res", Type: "t", Time: fakeNow.Time, State: common.Dirty, PreviousState: common.Busy},
+	}
+	var events []common.ResourceEvent
+	if err := wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		var err error
+		events, err = r.Events(EventQuery{Name: "res"})
+		return len(events) > 0, err
+	}); err != nil {
+		t.Fatalf("the release was never archived: %v", err)
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("expected events %+v, got %+v", expected, events)
+	}
+
+	// Events are kept for the retention, relative to the clock of the ranch.
+	if pruned, err := r.PruneEvents(time.Hour); err != nil || pruned != 0 {
+		t.Errorf("expected nothing pruned within the retention, got %d: %v", pruned, err)
+	}
+	if pruned, err := r.PruneEvents(-time.Second); err != nil || pruned != 1 {
+		t.Errorf("expected the event pruned past the retention, got %d: %v", pruned, err)
+	}
+}
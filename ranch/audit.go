@@ -0,0 +1,109 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/crds"
+)
+
+// AuditLog records the calls changing the resources, so leaked resources can
+// be traced back to the jobs which held them.
+type AuditLog interface {
+	// Record stores an entry.
+	Record(entry common.AuditEntry) error
+}
+
+// jsonAuditLog writes the entries as JSON lines.
+type jsonAuditLog struct {
+	lock sync.Mutex
+	w    io.Writer
+}
+
+// NewJSONAuditLog returns an AuditLog writing each entry to w as a line of
+// JSON.
+func NewJSONAuditLog(w io.Writer) AuditLog {
+	return &jsonAuditLog{w: w}
+}
+
+func (l *jsonAuditLog) Record(entry common.AuditEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	_, err = l.w.Write(append(line, '\n'))
+	return err
+}
+
+// FileAuditLog is an AuditLog appending JSON lines to a file.
+type FileAuditLog struct {
+	jsonAuditLog
+	file *os.File
+}
+
+// OpenFileAuditLog opens the file at path, creating it if needed, to append
+// the entries to.
+func OpenFileAuditLog(path string) (*FileAuditLog, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileAuditLog{jsonAuditLog: jsonAuditLog{w: file}, file: file}, nil
+}
+
+// Close closes the file.
+func (l *FileAuditLog) Close() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.file.Close()
+}
+
+// SetAuditLog sets the log the calls changing the resources are recorded in.
+// It must be called before the ranch starts serving requests.
+func (r *Ranch) SetAuditLog(log AuditLog) {
+	r.auditLog = log
+}
+
+// audit records the call changing res from previousState, if an audit log is
+// set. Failing to record never fails the call, which already took effect.
+func (r *Ranch) audit(action string, res *crds.ResourceObject, owner, previousState, requestID string) {
+	if r.auditLog == nil {
+		return
+	}
+	entry := common.AuditEntry{
+		Time:          r.now().Time,
+		Action:        action,
+		Name:          res.Name,
+		Type:          res.Spec.Type,
+		Owner:         owner,
+		PreviousState: previousState,
+		State:         res.Status.State,
+		RequestID:     requestID,
+	}
+	if err := r.auditLog.Record(entry); err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{"action": action, "resource": res.Name}).Error("Failed to record audit entry")
+	}
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+func TestAuditLog(t *testing.T) {
+	r := makeTestRanch([]runtime.Object{
+		newResource("res", "t", common.Free, "", startTime),
+		newResource("stale", "t", common.Busy, "leaker", startTime),
+	})
+	var buf bytes.Buffer
+	r.SetAuditLog(NewJSONAuditLog(&buf))
+
+	if _, _, err := r.Acquire("t", common.Free, common.Busy, "job", "request"); err != nil {
+		t.Fatalf("failed to acquire: %v", err)
+	}
+	if err := r.Update("res", "job", common.Busy, nil); err != nil {
+		t.Fatalf("failed to update: %v", err)
+	}
+	if err := r.Release("res", common.Dirty, "job"); err != nil {
+		t.Fatalf("failed to release: %v", err)
+	}
+	if _, err := r.Reset("t", common.Busy, 0, common.Dirty); err != nil {
+		t.Fatalf("failed to reset: %v", err)
+	}
+	// Failed calls are not recorded.
+	if err := r.Release("res", common.Free, "job"); err == nil {
+		t.Fatal("expected releasing a released resource to fail")
+	}
+
+	entries := readAuditEntries(t, &buf)
+	expected := []common.AuditEntry{
+		{Time: fakeNow.Time, Action: common.AuditAcquire, Name: "res", Type: "t", Owner: "job", PreviousState: common.Free, State: common.Busy, RequestID: "request"},
+		{Time: fakeNow.Time, Action: common.AuditUpdate, Name: "res", Type: "t", Owner: "job", PreviousState: common.Busy, State: common.Busy},
+		{Time: fakeNow.Time, Action: common.AuditRelease, Name: "res", Type: "t", Owner: "job", PreviousState: common.Busy, State: common.Dirty},
+		{Time: fakeNow.Time, Action: common.AuditReset, Name: "stale", Type: "t", Owner: "leaker", PreviousState: common.Busy, State: common.Dirty},
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("expected %d entries, got %+v", len(expected), entries)
+	}
+	for i := range expected {
+		// Times lose their monotonic reading and location in JSON.
+		if !entries[i].Time.Equal(expected[i].Time) {
+			t.Errorf("entry %d: expected time %v, got %v", i, expected[i].Time, entries[i].Time)
+		}
+		entries[i].Time = expected[i].Time
+		if !reflect.DeepEqual(entries[i], expected[i]) {
+			t.Errorf("entry %d: expected %+v, got %+v", i, expected[i], entries[i])
+		}
+	}
+}
+
+func TestAuditLogOfOtherCalls(t *testing.T) {
+	r := makeTestRanch([]runtime.Object{
+		newResource("batched", "u", common.Free, "", startTime),
+		newResource("held", "t", common.Free, "", startTime),
+		newResource("stale", "v", common.Busy, "gone", startTime),
+	})
+	r.imports.set(&common.BoskosConfig{Resources: []common.ResourceEntry{{Type: "project", State: common.Dirty, Names: []string{"configured"}}}})
+	var buf bytes.Buffer
+	r.SetAuditLog(NewJSONAuditLog(&buf))
+
+	if _, err := r.AcquireBatch(common.ResourceNeeds{"u": 1}, common.Free, common.Busy, "job", "batch"); err != nil {
+		t.Fatalf("failed to acquire batch: %v", err)
+	}
+	if _, _, err := r.Hold("t", common.Free, common.Busy, "job", "hold", time.Hour); err != nil {
+		t.Fatalf("failed to hold: %v", err)
+	}
+	if _, err := r.Confirm("held", "job"); err != nil {
+		t.Fatalf("failed to confirm: %v", err)
+	}
+	r.now = func() metav1.Time { return metav1.NewTime(fakeNow.Add(2 * time.Hour)) }
+	if _, _, err := r.ClaimExpired("v", common.Cleaning, "janitor", time.Hour); err != nil {
+		t.Fatalf("failed to claim: %v", err)
+	}
+	if _, err := r.ImportResources([]common.ImportedResource{{Name: "imported", Type: "project"}}, false); err != nil {
+		t.Fatalf("failed to import: %v", err)
+	}
+
+	entries := readAuditEntries(t, &buf)
+	expected := []common.AuditEntry{
+		{Action: common.AuditAcquire, Name: "batched", Type: "u", Owner: "job", PreviousState: common.Free, State: common.Busy, RequestID: "batch"},
+		{Action: common.AuditAcquire, Name: "held", Type: "t", Owner: "job", PreviousState: common.Free, State: common.Held, RequestID: "hold"},
+		{Action: common.AuditConfirm, Name: "held", Type: "t", Owner: "job", PreviousState: common.Held, State: common.Busy},
+		{Action: common.AuditClaim, Name: "stale", Type: "v", Owner: "janitor", PreviousState: common.Busy, State: common.Cleaning},
+		{Action: common.AuditImport, Name: "imported", Type: "project", State: common.Dirty},
+	}
+	for i := range entries {
+		entries[i].Time = time.Time{}
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected entries %+v, got %+v", expected, entries)
+	}
+}
+
+func readAuditEntries(t *testing.T, buf *bytes.Buffer) []common.AuditEntry {
+	var entries []common.AuditEntry
+	lines := bufio.NewScanner(buf)
+	for lines.Scan() {
+		var entry common.AuditEntry
+		if err := json.Unmarshal(lines.Bytes(), &entry); err != nil {
+			t.Fatalf("failed to decode entry %q: %v", lines.Text(), err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
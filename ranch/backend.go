@@ -0,0 +1,126 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	"sigs.k8s.io/boskos/crds"
+)
+
+// Backend persists the resources and DynamicResourceLifeCycles of a Storage.
+// Implementations must return the API errors of k8s.io/apimachinery, e.g. a
+// conflict when the resource version of an updated object is not the stored
+// one, as the ranch retries or gives up depending on them.
+type Backend interface {
+	CreateResource(ctx context.Context, resource *crds.ResourceObject) error
+	GetResource(ctx context.Context, name string) (*crds.ResourceObject, error)
+	ListResources(ctx context.Context) (*crds.ResourceObjectList, error)
+	UpdateResource(ctx context.Context, resource *crds.ResourceObject) error
+	DeleteResource(ctx context.Context, name string) error
+
+	CreateDynamicResourceLifeCycle(ctx context.Context, drlc *crds.DRLCObject) error
+	GetDynamicResourceLifeCycle(ctx context.Context, name string) (*crds.DRLCObject, error)
+	ListDynamicResourceLifeCycles(ctx context.Context) (*crds.DRLCObjectList, error)
+	UpdateDynamicResourceLifeCycle(ctx context.Context, drlc *crds.DRLCObject) error
+	DeleteDynamicResourceLifeCycle(ctx context.Context, name string) error
+}
+
+// crdBackend stores the resources and DynamicResourceLifeCycles as custom
+// resources of a Kubernetes cluster.
+type crdBackend struct {
+	client    ctrlruntimeclient.Client
+	namespace string
+}
+
+// NewCRDBackend returns a Backend storing custom resources in namespace
+// through client.
+func NewCRDBackend(client ctrlruntimeclient.Client, namespace string) Backend {
+	return &crdBackend{client: client, namespace: namespace}
+}
+
+func (b *crdBackend) key(name string) types.NamespacedName {
+	return types.NamespacedName{Namespace: b.namespace, Name: name}
+}
+
+func (b *crdBackend) meta(name string) metav1.ObjectMeta {
+	return metav1.ObjectMeta{Name: name, Namespace: b.namespace}
+}
+
+func (b *crdBackend) CreateResource(ctx context.Context, resource *crds.ResourceObject) error {
+	resource.Namespace = b.namespace
+	return b.client.Create(ctx, resource)
+}
+
+func (b *crdBackend) GetResource(ctx context.Context, name string) (*crds.ResourceObject, error) {
+	o := &crds.ResourceObject{}
+	if err := b.client.Get(ctx, b.key(name), o); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+func (b *crdBackend) ListResources(ctx context.Context) (*crds.ResourceObjectList, error) {
+	resourceList := &crds.ResourceObjectList{}
+	if err := b.client.List(ctx, resourceList, ctrlruntimeclient.InNamespace(b.namespace)); err != nil {
+		return nil, err
+	}
+	return resourceList, nil
+}
+
+func (b *crdBackend) UpdateResource(ctx context.Context, resource *crds.ResourceObject) error {
+	resource.Namespace = b.namespace
+	return b.client.Update(ctx, resource)
+}
+
+func (b *crdBackend) DeleteResource(ctx context.Context, name string) error {
+	return b.client.Delete(ctx, &crds.ResourceObject{ObjectMeta: b.meta(name)})
+}
+
+func (b *crdBackend) CreateDynamicResourceLifeCycle(ctx context.Context, drlc *crds.DRLCObject) error {
+	drlc.Namespace = b.namespace
+	return b.client.Create(ctx, drlc)
+}
+
+func (b *crdBackend) GetDynamicResourceLifeCycle(ctx context.Context, name string) (*crds.DRLCObject, error) {
+	drlc := &crds.DRLCObject{}
+	if err := b.client.Get(ctx, b.key(name), drlc); err != nil {
+		return nil, err
+	}
+	return drlc, nil
+}
+
+func (b *crdBackend) ListDynamicResourceLifeCycles(ctx context.Context) (*crds.DRLCObjectList, error) {
+	drlcList := &crds.DRLCObjectList{}
+	if err := b.client.List(ctx, drlcList, ctrlruntimeclient.InNamespace(b.namespace)); err != nil {
+		return nil, err
+	}
+	return drlcList, nil
+}
+
+func (b *crdBackend) UpdateDynamicResourceLifeCycle(ctx context.Context, drlc *crds.DRLCObject) error {
+	drlc.Namespace = b.namespace
+	return b.client.Update(ctx, drlc)
+}
+
+func (b *crdBackend) DeleteDynamicResourceLifeCycle(ctx context.Context, name string) error {
+	return b.client.Delete(ctx, &crds.DRLCObject{ObjectMeta: b.meta(name)})
+}
@@ -0,0 +1,250 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/util/retry"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/crds"
+)
+
+// AcquireBatch checks out resources of several types at once: either all of
+// needs is acquired, or nothing is. Requests with a requestID wait in line in
+// the queue of every requested type, like for Acquire.
+// In: needs - number of resources to acquire by type
+//     state - current state of the requested resources
+//     dest - destination state of the requested resources
+//     owner - requester of the resources
+//     requestID - request ID to get a priority in the queues
+// Out: The acquired resources on success, or
+//      ResourceNotFound error for the first type without enough resources, or
+//      ResourceTypeNotFound error if there is no resource of a requested type.
+func (r *Ranch) AcquireBatch(needs common.ResourceNeeds, state, dest, owner, requestID string) ([]*crds.ResourceObject, error) {
+	var types []string
+	for rType, count := range needs {
+		if count < 1 {
+			return nil, fmt.Errorf("must request at least one resource of type %s", rType)
+		}
+		types = append(types, rType)
+	}
+	if len(types) == 0 {
+		return nil, fmt.Errorf("must provide the types of expected resources")
+	}
+	sort.Strings(types)
+	for _, rType := range types {
+		if err := r.admitTenant(rType); err != nil {
+			return nil, err
+		}
+	}
+	// Every gated type of the batch is submitted for approval at once.
+	var approvalErr error
+	for _, rType := range types {
+		if err := r.admitApproval(rType, state, dest, owner, requestID); err != nil && approvalErr == nil {
+			approvalErr = err
+		}
+	}
+	if approvalErr != nil {
+		return nil, approvalErr
+	}
+	logger := logrus.WithFields(logrus.Fields{
+		"types":      types,
+		"state":      state,
+		"dest":       dest,
+		"owner":      owner,
+		"identifier": requestID,
+	})
+
+	var acquired []*crds.ResourceObject
+	held := map[string]int{}
+	if err := retryOnConflict(retry.DefaultBackoff, func() error {
+		acquired = nil
+		resources, err := r.Storage.GetResources()
+		if err != nil {
+			logger.WithError(err).Errorf("could not get resources")
+			return &ResourceNotFound{name: types[0]}
+		}
+
+		ranks := map[string]int{}
+		for _, rType := range types {
+			// The quota must hold all the resources of the batch.
+			held[rType] = countOwned(resources.Items, rType, owner)
+			if err := r.quotas.check(rType, owner, held[rType]+needs[rType]-1, r.now().Time); err != nil {
+				return err
+			}
+			if _, ok := r.slices.get(rType); ok && state == common.Free {
+				return &TimeSliced{rType: rType}
+			}
+			if state == common.Dirty && r.breakers.isOpen(rType) {
+				return &CleanupPaused{rType: rType}
+			}
+			ranks[rType], _ = r.requestMgr.GetPriorityRankForOwner(acquireRequestPriorityKey{rType: rType, state: state}, requestID, owner, r.boosts.get(owner, r.now().Time))
+		}
+		if r.LameDuckMode() {
+			return &LameDuck{}
+		}
+
+		// Every type is checked before anything is updated, so that a batch
+		// which cannot be served does not touch any resource.
+		var batch []crds.ResourceObject
+		for _, rType := range types {
+			var candidates []crds.ResourceObject
+			typeCount := 0
+			for idx := range resources.Items {
+				res := resources.Items[idx]
+				if rType != res.Spec.Type {
+					continue
+				}
+				typeCount++
+				if state != res.Status.State || res.Status.Owner != "" || res.Status.CredentialsExposed {
+					continue
+				}
+				candidates = append(candidates, res)
+			}
+			if typeCount == 0 {
+				return &ResourceTypeNotFound{rType: rType}
+			}
+			// The requests ahead in line are served first.
+			ahead := ranks[rType] - 1
+			if len(candidates) < ahead+needs[rType] {
+				return &ResourceNotFound{name: rType}
+			}
+			if r.scheduler != nil {
+				request := SchedulingRequest{Type: rType, State: state, Dest: dest, Owner: owner, RequestID: requestID}
+				if candidates, err = schedule(r.scheduler, request, candidates); err != nil {
+					logger.WithError(err).Error("Scheduler policy failed")
+					return err
+				}
+			}
+			batch = append(batch, candidates[ahead:ahead+needs[rType]]...)
+		}
+
+		taken := sets.NewString()
+		for _, res := range batch {
+			taken.Insert(res.Name)
+		}
+		for idx := range batch {
+			res := batch[idx]
+			if err := r.admitTransition(&res, dest, owner); err != nil {
+				r.rollbackBatch(acquired, owner, state)
+				return err
+			}
+			var coAcquired []string
+			if deps := r.deps.get(res.Spec.Type); len(deps) > 0 {
+				// Resources taken by the batch are not co-acquired again.
+				if coAcquired, err = r.coAcquire(deps, &res, resources.Items, owner, dest, taken); err != nil {
+					r.rollbackBatch(acquired, owner, state)
+					return err
+				}
+				names, err := json.Marshal(common.LeasedResources(coAcquired))
+				if err != nil {
+					r.releaseCoAcquired(coAcquired, owner, common.Free)
+					r.rollbackBatch(acquired, owner, state)
+					return err
+				}
+				if res.Status.UserData == nil {
+					res.Status.UserData = map[string]string{}
+				}
+				res.Status.UserData[common.CoAcquiredResources] = string(names)
+			}
+			res.Status.Owner = owner
+			res.Status.State = dest
+			r.rotations.expose(&res)
+			updatedRes, err := r.Storage.UpdateResource(&res)
+			if err != nil {
+				r.releaseCoAcquired(coAcquired, owner, common.Free)
+				r.rollbackBatch(acquired, owner, state)
+				return err
+			}
+			acquired = append(acquired, updatedRes)
+		}
+		return nil
+	}); err != nil {
+		switch err.(type) {
+		case *ResourceNotFound, *QuotaExceeded, *LameDuck, *CleanupPaused, *TimeSliced, *TransitionDenied:
+			// Like for Acquire, these are a normal part of operation.
+		default:
+			logger.WithError(err).Error("AcquireBatch failed")
+			// Failures of boskos itself, like of the storage, are not the
+			// fault of the owner, which will retry.
+			if _, ok := err.(*ResourceTypeNotFound); !ok {
+				r.boosts.raise(owner, "error", r.now().Time)
+			}
+		}
+		return nil, err
+	}
+
+	for _, rType := range types {
+		r.approvals.complete(rType, owner, requestID)
+		createdTime := r.now()
+		if requestID != "" {
+			key := acquireRequestPriorityKey{rType: rType, state: state}
+			if requestedAt, err := r.requestMgr.GetCreatedAt(key, requestID); err == nil {
+				createdTime = requestedAt
+				r.queueWaits.observe(rType, r.now().Sub(createdTime.Time))
+			}
+			r.requestMgr.Delete(key, requestID)
+		}
+		for _, res := range acquired {
+			if res.Spec.Type == rType {
+				r.audit(common.AuditAcquire, res, owner, state, requestID)
+				r.sla.observeAcquire(res.Name, rType, r.now().Sub(createdTime.Time), r.now().Time)
+				r.Storage.demand.observeAcquire(rType, r.now().Time)
+			}
+		}
+		r.quotas.observe(rType, owner, held[rType]+needs[rType], r.now().Time)
+	}
+	r.boosts.clear(owner)
+	logger.Infof("Acquired a batch of %d resources.", len(acquired))
+	return acquired, nil
+}
+
+// rollbackBatch hands the resources of a batch which could not be acquired as
+// a whole back in state, along with the resources co-acquired with them. The
+// resources were never handed out, so neither quotas nor churn record them.
+// Failures are only logged: the resources are eventually reset by the reaper.
+// The rollback goes on even if the request of the batch was abandoned.
+func (r *Ranch) rollbackBatch(acquired []*crds.ResourceObject, owner, state string) {
+	r, cancel := r.detached()
+	defer cancel()
+	for _, res := range acquired {
+		r.releaseCoAcquired(coAcquiredResources(res), owner, common.Free)
+		if err := retryOnConflict(retry.DefaultBackoff, func() error {
+			current, err := r.Storage.GetResource(res.Name)
+			if err != nil {
+				return err
+			}
+			if current.Status.Owner != owner {
+				return &OwnerNotMatch{request: owner, owner: current.Status.Owner}
+			}
+			current.Status.Owner = ""
+			current.Status.State = state
+			current.Status.CredentialsExposed = false
+			delete(current.Status.UserData, common.CoAcquiredResources)
+			_, err = r.Storage.UpdateResource(current)
+			return err
+		}); err != nil {
+			logrus.WithError(err).Errorf("failed to roll back resource %s", res.Name)
+		}
+	}
+}
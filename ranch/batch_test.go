@@ -0,0 +1,160 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+// failingUpdateClient fails every update of the resource called name.
+type failingUpdateClient struct {
+	ctrlruntimeclient.Client
+	name string
+}
+
+func (fc *failingUpdateClient) Update(ctx context.Context, obj ctrlruntimeclient.Object, opts ...ctrlruntimeclient.UpdateOption) error {
+	if obj.GetName() == fc.name {
+		return errors.New("update failed")
+	}
+	return fc.Client.Update(ctx, obj, opts...)
+}
+
+func TestAcquireBatch(t *testing.T) {
+	testCases := []struct {
+		name         string
+		resources    []runtime.Object
+		needs        common.ResourceNeeds
+		queuedAhead  string
+		failUpdate   string
+		expectErr    error
+		expectNames  []string
+		expectOwners map[string]string
+	}{
+		{
+			name: "all types available",
+			resources: []runtime.Object{
+				newResource("a-1", "a", common.Free, "", startTime),
+				newResource("b-1", "b", common.Free, "", startTime),
+				newResource("b-2", "b", common.Free, "", startTime),
+				newResource("b-3", "b", common.Busy, "other", startTime),
+			},
+			needs:        common.ResourceNeeds{"a": 1, "b": 2},
+			expectNames:  []string{"a-1", "b-1", "b-2"},
+			expectOwners: map[string]string{"a-1": "owner", "b-1": "owner", "b-2": "owner", "b-3": "other"},
+		},
+		{
+			name: "one type short",
+			resources: []runtime.Object{
+				newResource("a-1", "a", common.Free, "", startTime),
+				newResource("b-1", "b", common.Free, "", startTime),
+			},
+			needs:        common.ResourceNeeds{"a": 1, "b": 2},
+			expectErr:    &ResourceNotFound{name: "b"},
+			expectOwners: map[string]string{"a-1": "", "b-1": ""},
+		},
+		{
+			name: "unknown type",
+			resources: []runtime.Object{
+				newResource("a-1", "a", common.Free, "", startTime),
+			},
+			needs:        common.ResourceNeeds{"a": 1, "c": 1},
+			expectErr:    &ResourceTypeNotFound{rType: "c"},
+			expectOwners: map[string]string{"a-1": ""},
+		},
+		{
+			name: "request ahead in line",
+			resources: []runtime.Object{
+				newResource("a-1", "a", common.Free, "", startTime),
+				newResource("b-1", "b", common.Free, "", startTime),
+			},
+			needs:        common.ResourceNeeds{"a": 1, "b": 1},
+			queuedAhead:  "b",
+			expectErr:    &ResourceNotFound{name: "b"},
+			expectOwners: map[string]string{"a-1": "", "b-1": ""},
+		},
+		{
+			name: "failed update is rolled back",
+			resources: []runtime.Object{
+				newResource("a-1", "a", common.Free, "", startTime),
+				newResource("b-1", "b", common.Free, "", startTime),
+			},
+			needs:        common.ResourceNeeds{"a": 1, "b": 1},
+			failUpdate:   "b-1",
+			expectErr:    errors.New("failed to update resources b-1: update failed"),
+			expectOwners: map[string]string{"a-1": "", "b-1": ""},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := makeTestRanch(tc.resources)
+			if tc.failUpdate != "" {
+				backend := r.Storage.backend.(*abandonCountingBackend).Backend.(*tracingBackend).Backend.(*crdBackend)
+				backend.client = &failingUpdateClient{Client: backend.client, name: tc.failUpdate}
+			}
+			if tc.queuedAhead != "" {
+				r.requestMgr.GetRank(acquireRequestPriorityKey{rType: tc.queuedAhead, state: common.Free}, "ahead")
+			}
+
+			acquired, err := r.AcquireBatch(tc.needs, common.Free, common.Busy, "owner", "request")
+			if tc.expectErr == nil && err != nil {
+				t.Fatalf("failed to acquire: %v", err)
+			}
+			if tc.expectErr != nil && (err == nil || err.Error() != tc.expectErr.Error()) {
+				t.Fatalf("expected error %v, got %v", tc.expectErr, err)
+			}
+			var names []string
+			for _, res := range acquired {
+				names = append(names, res.Name)
+			}
+			sort.Strings(names)
+			if !reflect.DeepEqual(tc.expectNames, names) {
+				t.Errorf("expected resources %v, got %v", tc.expectNames, names)
+			}
+
+			resources, err := r.Storage.GetResources()
+			if err != nil {
+				t.Fatalf("failed to get resources: %v", err)
+			}
+			owners := map[string]string{}
+			for _, res := range resources.Items {
+				owners[res.Name] = res.Status.Owner
+				if res.Status.Owner == "" && res.Status.State != common.Free {
+					t.Errorf("expected free resource %s to stay free, got %s", res.Name, res.Status.State)
+				}
+			}
+			if !reflect.DeepEqual(tc.expectOwners, owners) {
+				t.Errorf("expected owners %v, got %v", tc.expectOwners, owners)
+			}
+			if tc.expectErr == nil {
+				for rType := range tc.needs {
+					if rank, _ := r.requestMgr.GetRank(acquireRequestPriorityKey{rType: rType, state: common.Free}, ""); rank != 1 {
+						t.Errorf("expected the request to leave the queue of type %s, got rank %d for the next one", rType, rank)
+					}
+				}
+			}
+		})
+	}
+}
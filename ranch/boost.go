@@ -0,0 +1,115 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultMaxPriorityBoost is how much the priority of the requests of an
+	// owner is raised at most after its resources were taken from it or its
+	// requests failed on errors of boskos.
+	DefaultMaxPriorityBoost = 3
+	// priorityBoostTTL is how long a boost lasts after it was last raised,
+	// so owners which do not retry are forgotten.
+	priorityBoostTTL = time.Hour
+)
+
+// priorityBoost is the boost of the priority of the requests of an owner.
+type priorityBoost struct {
+	boost   int
+	expires time.Time
+}
+
+// boostTracker raises the priority of the requests of the owners whose
+// resources were reset or claimed by others, or whose requests failed on
+// errors of boskos, so unlucky jobs are not sent to the back of the line
+// again when they retry. A boost lasts until the owner acquires a resource.
+type boostTracker struct {
+	lock   sync.Mutex
+	max    int
+	owners map[string]priorityBoost
+}
+
+func newBoostTracker() *boostTracker {
+	return &boostTracker{max: DefaultMaxPriorityBoost, owners: map[string]priorityBoost{}}
+}
+
+func (b *boostTracker) setMax(max int) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.max = max
+}
+
+// raise raises the boost of owner by one, up to the max boost.
+func (b *boostTracker) raise(owner, reason string, now time.Time) {
+	if owner == "" {
+		return
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.max <= 0 {
+		return
+	}
+	boost := b.owners[owner]
+	if now.After(boost.expires) {
+		boost.boost = 0
+	}
+	if boost.boost < b.max {
+		boost.boost++
+	}
+	boost.expires = now.Add(priorityBoostTTL)
+	b.owners[owner] = boost
+	logrus.WithFields(logrus.Fields{"owner": owner, "reason": reason, "boost": boost.boost}).Info("Boosted the priority of the requests of owner")
+}
+
+// get returns the boost of owner.
+func (b *boostTracker) get(owner string, now time.Time) int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	boost, ok := b.owners[owner]
+	if !ok {
+		return 0
+	}
+	if now.After(boost.expires) {
+		delete(b.owners, owner)
+		return 0
+	}
+	if boost.boost > b.max {
+		return b.max
+	}
+	return boost.boost
+}
+
+// clear drops the boost of owner, once it acquired a resource.
+func (b *boostTracker) clear(owner string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	delete(b.owners, owner)
+}
+
+// SetMaxPriorityBoost sets how much the priority of the requests of an owner
+// is raised at most, by one every time its resources are reset or claimed by
+// others or its requests fail on errors of boskos. A zero or negative max
+// disables boosts.
+func (r *Ranch) SetMaxPriorityBoost(max int) {
+	r.boosts.setMax(max)
+}
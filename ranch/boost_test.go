@@ -0,0 +1,73 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+func TestBoostTracker(t *testing.T) {
+	now := time.Now()
+	b := newBoostTracker()
+	b.setMax(2)
+	for i := 0; i < 3; i++ {
+		b.raise("owner", "reset", now)
+	}
+	if boost := b.get("owner", now); boost != 2 {
+		t.Errorf("expected the boost to be capped at 2, got %d", boost)
+	}
+	if boost := b.get("owner", now.Add(priorityBoostTTL+time.Second)); boost != 0 {
+		t.Errorf("expected the boost to expire, got %d", boost)
+	}
+	b.raise("owner", "reset", now)
+	b.clear("owner")
+	if boost := b.get("owner", now); boost != 0 {
+		t.Errorf("expected the boost to be cleared, got %d", boost)
+	}
+	b.setMax(0)
+	b.raise("owner", "reset", now)
+	if boost := b.get("owner", now); boost != 0 {
+		t.Errorf("expected boosts to be disabled, got %d", boost)
+	}
+}
+
+func TestResetBoostsPriority(t *testing.T) {
+	r := makeTestRanch([]runtime.Object{
+		newResource("res", "t", common.Busy, "victim", startTime),
+	})
+	if _, _, err := r.Acquire("t", common.Free, common.Busy, "other", "other-request"); err == nil {
+		t.Fatal("expected the request of other to be queued")
+	}
+	if _, err := r.Reset("t", common.Busy, 0, common.Free); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	res, _, err := r.Acquire("t", common.Free, common.Busy, "victim", "victim-request")
+	if err != nil {
+		t.Fatalf("expected the boosted request of victim to be served first, got %v", err)
+	}
+	if res.Name != "res" {
+		t.Errorf("expected res to be acquired, got %s", res.Name)
+	}
+	if boost := r.boosts.get("victim", fakeNow.Time); boost != 0 {
+		t.Errorf("expected the boost to be cleared once victim acquired a resource, got %d", boost)
+	}
+}
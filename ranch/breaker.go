@@ -0,0 +1,282 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+// CleanupPaused will be returned if dirty resources of a type are not handed
+// out for cleaning because the cleanup breaker of the type is open.
+type CleanupPaused struct {
+	rType string
+}
+
+func (c CleanupPaused) Error() string {
+	return fmt.Sprintf("cleanup of resource type %s is paused after too many failures, reset the cleanup breaker once the janitor is fixed", c.rType)
+}
+
+// breakersStateKey is the key of the open breakers in the StatePersistence,
+// which holds when each of them opened by type.
+const breakersStateKey = "breakers"
+
+// cleanupBreaker is the in memory representation of common.CleanupBreaker.
+type cleanupBreaker struct {
+	maxFailurePercent int
+	minCleanups       int
+	window            time.Duration
+}
+
+type cleanupOutcome struct {
+	at     time.Time
+	failed bool
+}
+
+type breakerState struct {
+	outcomes []cleanupOutcome
+	// openedAt is set once the breaker trips. The breaker stays open until it is
+	// reset, as cleanups would keep failing until the janitor gets fixed.
+	openedAt *time.Time
+}
+
+// breakerManager tracks the outcome of cleanups, i.e. of releases from the
+// cleaning state to either free or dirty, and trips the breaker of a type when
+// too many of them fail.
+type breakerManager struct {
+	lock     sync.Mutex
+	breakers map[string]cleanupBreaker
+	states   map[string]*breakerState
+}
+
+func newBreakerManager() *breakerManager {
+	return &breakerManager{
+		breakers: map[string]cleanupBreaker{},
+		states:   map[string]*breakerState{},
+	}
+}
+
+// set replaces the configured breakers. Types that are still configured keep
+// their state, so a config sync does not close an open breaker.
+func (b *breakerManager) set(config *common.BoskosConfig) {
+	breakers := map[string]cleanupBreaker{}
+	for _, entry := range config.Resources {
+		if entry.CleanupBreaker == nil || entry.CleanupBreaker.Window == nil || entry.CleanupBreaker.Window.Duration == nil {
+			continue
+		}
+		breakers[entry.Type] = cleanupBreaker{
+			maxFailurePercent: entry.CleanupBreaker.MaxFailurePercent,
+			minCleanups:       entry.CleanupBreaker.MinCleanups,
+			window:            *entry.CleanupBreaker.Window.Duration,
+		}
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.breakers = breakers
+	for rType := range b.states {
+		if _, ok := breakers[rType]; !ok {
+			delete(b.states, rType)
+		}
+	}
+}
+
+// prune drops the outcomes that fell out of the window. Must be called with
+// the lock held.
+func (s *breakerState) prune(window time.Duration, now time.Time) {
+	idx := 0
+	for idx < len(s.outcomes) && now.Sub(s.outcomes[idx].at) > window {
+		idx++
+	}
+	s.outcomes = s.outcomes[idx:]
+}
+
+func (s *breakerState) failures() int {
+	var failures int
+	for _, outcome := range s.outcomes {
+		if outcome.failed {
+			failures++
+		}
+	}
+	return failures
+}
+
+// observe records the outcome of a cleanup of rType and trips its breaker if
+// too many cleanups failed within the window. It returns whether the breaker
+// tripped.
+func (b *breakerManager) observe(rType string, failed bool, now time.Time) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	breaker, ok := b.breakers[rType]
+	if !ok {
+		return false
+	}
+	state, ok := b.states[rType]
+	if !ok {
+		state = &breakerState{}
+		b.states[rType] = state
+	}
+	state.outcomes = append(state.outcomes, cleanupOutcome{at: now, failed: failed})
+	state.prune(breaker.window, now)
+	if state.openedAt != nil {
+		return false
+	}
+	cleanups, failures := len(state.outcomes), state.failures()
+	if cleanups < breaker.minCleanups || failures*100 <= breaker.maxFailurePercent*cleanups {
+		return false
+	}
+	state.openedAt = &now
+	logrus.WithFields(logrus.Fields{
+		"type":     rType,
+		"cleanups": cleanups,
+		"failures": failures,
+		"window":   breaker.window,
+	}).Error("Too many cleanups failed, pausing the cleanup of the resource type until its cleanup breaker is reset")
+	return true
+}
+
+// restore opens the breakers of the configured types opened at the times of
+// opened, and closes the others, as persisted by the previous leader.
+func (b *breakerManager) restore(opened map[string]time.Time) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for rType := range b.breakers {
+		openedAt, ok := opened[rType]
+		state, exists := b.states[rType]
+		switch {
+		case ok && !exists:
+			b.states[rType] = &breakerState{openedAt: &openedAt}
+		case ok:
+			state.openedAt = &openedAt
+		case exists:
+			state.openedAt = nil
+		}
+	}
+}
+
+func (b *breakerManager) isOpen(rType string) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	state, ok := b.states[rType]
+	return ok && state.openedAt != nil
+}
+
+// reset closes the breaker of rType and forgets its cleanups. It returns false
+// if rType has no breaker.
+func (b *breakerManager) reset(rType string) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if _, ok := b.breakers[rType]; !ok {
+		return false
+	}
+	delete(b.states, rType)
+	return true
+}
+
+func (b *breakerManager) statuses(now time.Time) []common.CleanupBreakerStatus {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	var statuses []common.CleanupBreakerStatus
+	for rType, breaker := range b.breakers {
+		status := common.CleanupBreakerStatus{Type: rType}
+		if state, ok := b.states[rType]; ok {
+			state.prune(breaker.window, now)
+			status.Open = state.openedAt != nil
+			status.OpenedAt = state.openedAt
+			status.Cleanups = len(state.outcomes)
+			status.Failures = state.failures()
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Type < statuses[j].Type })
+	return statuses
+}
+
+// persistBreaker persists that the breaker of rType opened at openedAt, or
+// that it is closed if openedAt is nil, if the ranch persists its state.
+func (r *Ranch) persistBreaker(rType string, openedAt *time.Time) error {
+	if r.persistence == nil {
+		return nil
+	}
+	var opened map[string]time.Time
+	return changeState(r.Storage.ctx, r.persistence, breakersStateKey, &opened, func() error {
+		if openedAt == nil {
+			delete(opened, rType)
+			return nil
+		}
+		if opened == nil {
+			opened = map[string]time.Time{}
+		}
+		opened[rType] = *openedAt
+		return nil
+	})
+}
+
+// observeCleanup records the outcome of a cleanup of rType, and persists the
+// breaker of the type if it trips.
+func (r *Ranch) observeCleanup(rType string, failed bool) {
+	now := r.now().Time
+	if !r.breakers.observe(rType, failed, now) {
+		return
+	}
+	if err := r.persistBreaker(rType, &now); err != nil {
+		logrus.WithError(err).WithField("type", rType).Error("Failed to persist the open cleanup breaker, it closes on the next restart or failover")
+	}
+}
+
+// RestoreCleanupBreakers opens the cleanup breakers persisted as open, and
+// closes the others, so that they survive restarts and the failovers of the
+// leader. It is a no-op unless the ranch persists its state, and must be
+// called once the config is synced.
+func (r *Ranch) RestoreCleanupBreakers() error {
+	if r.persistence == nil {
+		return nil
+	}
+	var opened map[string]time.Time
+	if _, err := loadState(r.Storage.ctx, r.persistence, breakersStateKey, &opened); err != nil {
+		return err
+	}
+	r.breakers.restore(opened)
+	return nil
+}
+
+// CleanupBreakers returns the status of the cleanup breakers of all the
+// resource types that have one, sorted by type.
+func (r *Ranch) CleanupBreakers() []common.CleanupBreakerStatus {
+	return r.breakers.statuses(r.now().Time)
+}
+
+// ResetCleanupBreaker closes the cleanup breaker of rType, resuming the
+// cleanup of its dirty resources.
+// Out: nil on success, or
+//      ResourceTypeNotFound error if rType has no cleanup breaker.
+func (r *Ranch) ResetCleanupBreaker(rType string) error {
+	if !r.breakers.reset(rType) {
+		return &ResourceTypeNotFound{rType: rType}
+	}
+	if err := r.persistBreaker(rType, nil); err != nil {
+		return fmt.Errorf("failed to persist the reset of the cleanup breaker of %s: %w", rType, err)
+	}
+	logrus.WithField("type", rType).Info("Reset cleanup breaker")
+	return nil
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	fakectrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+func breakerConfig(rType string, maxFailurePercent, minCleanups int, window time.Duration) *common.BoskosConfig {
+	return &common.BoskosConfig{Resources: []common.ResourceEntry{{
+		Type: rType,
+		CleanupBreaker: &common.CleanupBreaker{
+			MaxFailurePercent: maxFailurePercent,
+			MinCleanups:       minCleanups,
+			Window:            &common.Duration{Duration: &window},
+		},
+	}}}
+}
+
+func TestBreakerManager(t *testing.T) {
+	testCases := []struct {
+		name       string
+		outcomes   []bool
+		spacing    time.Duration
+		expectOpen bool
+	}{
+		{
+			name:     "too few cleanups",
+			outcomes: []bool{true, true},
+		},
+		{
+			name:     "failures below threshold",
+			outcomes: []bool{true, false, false, false},
+		},
+		{
+			name:       "failures above threshold",
+			outcomes:   []bool{true, false, true, true},
+			expectOpen: true,
+		},
+		{
+			name:     "failures spread beyond the window",
+			outcomes: []bool{true, true, true, true},
+			spacing:  40 * time.Minute,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			b := newBreakerManager()
+			b.set(breakerConfig("t", 50, 3, time.Hour))
+			now := startTime.Time
+			for _, failed := range tc.outcomes {
+				b.observe("t", failed, now)
+				now = now.Add(tc.spacing)
+			}
+			if open := b.isOpen("t"); open != tc.expectOpen {
+				t.Errorf("expected open to be %t, got %t", tc.expectOpen, open)
+			}
+		})
+	}
+}
+
+func TestCleanupBreaker(t *testing.T) {
+	r := makeTestRanch([]runtime.Object{
+		newResource("res-1", "t", common.Cleaning, "janitor", startTime),
+		newResource("res-2", "t", common.Dirty, "", startTime),
+	})
+	r.breakers.set(breakerConfig("t", 50, 1, time.Hour))
+
+	if err := r.Release("res-1", common.Dirty, "janitor"); err != nil {
+		t.Fatalf("failed to release: %v", err)
+	}
+	if _, _, err := r.Acquire("t", common.Dirty, common.Cleaning, "janitor", ""); !AreErrorsEqual(err, &CleanupPaused{rType: "t"}) {
+		t.Fatalf("expected the cleanup to be paused, got %v", err)
+	}
+	statuses := r.CleanupBreakers()
+	if len(statuses) != 1 || !statuses[0].Open || statuses[0].Failures != 1 {
+		t.Errorf("expected an open breaker with one failure, got %+v", statuses)
+	}
+
+	if err := r.ResetCleanupBreaker("other"); !AreErrorsEqual(err, &ResourceTypeNotFound{rType: "other"}) {
+		t.Errorf("expected resetting an unknown breaker to fail, got %v", err)
+	}
+	if err := r.ResetCleanupBreaker("t"); err != nil {
+		t.Fatalf("failed to reset: %v", err)
+	}
+	if _, _, err := r.Acquire("t", common.Dirty, common.Cleaning, "janitor", ""); err != nil {
+		t.Errorf("expected the cleanup to resume, got %v", err)
+	}
+}
+
+func TestCleanupBreakerPersisted(t *testing.T) {
+	persistence := NewConfigMapStatePersistence(fakectrlruntimeclient.NewFakeClient(), testNS, "boskos-state")
+	leader := makeTestRanch([]runtime.Object{
+		newResource("res-1", "t", common.Cleaning, "janitor", startTime),
+	})
+	leader.SetStatePersistence(persistence)
+	leader.breakers.set(breakerConfig("t", 50, 1, time.Hour))
+	if err := leader.Release("res-1", common.Dirty, "janitor"); err != nil {
+		t.Fatalf("failed to release: %v", err)
+	}
+
+	// The next leader, e.g. after a failover, keeps the breaker open.
+	successor := makeTestRanch([]runtime.Object{
+		newResource("res-2", "t", common.Dirty, "", startTime),
+	})
+	successor.SetStatePersistence(persistence)
+	successor.breakers.set(breakerConfig("t", 50, 1, time.Hour))
+	if err := successor.RestoreCleanupBreakers(); err != nil {
+		t.Fatalf("failed to restore the breakers: %v", err)
+	}
+	if _, _, err := successor.Acquire("t", common.Dirty, common.Cleaning, "janitor", ""); !AreErrorsEqual(err, &CleanupPaused{rType: "t"}) {
+		t.Fatalf("expected the cleanup to stay paused, got %v", err)
+	}
+
+	if err := successor.ResetCleanupBreaker("t"); err != nil {
+		t.Fatalf("failed to reset: %v", err)
+	}
+	if err := leader.RestoreCleanupBreakers(); err != nil {
+		t.Fatalf("failed to restore the breakers: %v", err)
+	}
+	if leader.breakers.isOpen("t") {
+		t.Error("expected the reset to close the breaker of the next leader too")
+	}
+}
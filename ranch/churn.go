@@ -0,0 +1,124 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+const (
+	// churnSmoothing is the weight of the latest interval in the moving average.
+	churnSmoothing = 0.2
+	// minChurnSamples is the number of observed intervals required before
+	// wait estimates are trusted.
+	minChurnSamples = 3
+)
+
+// WaitEstimateExceeded will be returned if the estimated wait for a resource exceeds the max wait of the request.
+type WaitEstimateExceeded struct {
+	rType    string
+	state    string
+	estimate time.Duration
+	maxWait  time.Duration
+}
+
+func (w WaitEstimateExceeded) Error() string {
+	return fmt.Sprintf("estimated wait of %v for a %s resource in state %s exceeds max wait of %v", w.estimate, w.rType, w.state, w.maxWait)
+}
+
+// ToWaitEstimate converts the error to the structured body returned to clients.
+func (w WaitEstimateExceeded) ToWaitEstimate() common.WaitEstimateExceeded {
+	return common.WaitEstimateExceeded{
+		Type:                 w.rType,
+		State:                w.state,
+		EstimatedWaitSeconds: w.estimate.Seconds(),
+		MaxWaitSeconds:       w.maxWait.Seconds(),
+		Message:              w.Error(),
+	}
+}
+
+// churn is the release history of a resource type into a state.
+type churn struct {
+	lastRelease time.Time
+	// interval is the moving average of the time between two releases.
+	interval time.Duration
+	samples  int
+}
+
+// churnKey names the releases of a resource type into a state. A lease cycle
+// releases a resource twice, e.g. as dirty by its user and as free by its
+// janitor, and only the releases into the state a request waits for retire
+// it.
+type churnKey struct {
+	rType, state string
+}
+
+// churnTracker keeps track of how often resources of each type are released
+// into each state, which is what allows estimating how long queued requests
+// will wait.
+type churnTracker struct {
+	lock  sync.Mutex
+	types map[churnKey]*churn
+}
+
+func newChurnTracker() *churnTracker {
+	return &churnTracker{types: map[churnKey]*churn{}}
+}
+
+// observeRelease records that a resource of rType was released into state at
+// now.
+func (c *churnTracker) observeRelease(rType, state string, now time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	key := churnKey{rType: rType, state: state}
+	ch, ok := c.types[key]
+	if !ok {
+		c.types[key] = &churn{lastRelease: now}
+		return
+	}
+	interval := now.Sub(ch.lastRelease)
+	if interval < 0 {
+		return
+	}
+	if ch.samples == 0 {
+		ch.interval = interval
+	} else {
+		ch.interval = time.Duration(churnSmoothing*float64(interval) + (1-churnSmoothing)*float64(ch.interval))
+	}
+	ch.samples++
+	ch.lastRelease = now
+}
+
+// estimateWait estimates how long it takes until releases of rType into
+// state retire waiting requests ahead of and including the caller. The second
+// return value is false if there is not enough history to tell.
+func (c *churnTracker) estimateWait(rType, state string, waiting int) (time.Duration, bool) {
+	if waiting <= 0 {
+		return 0, true
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	ch, ok := c.types[churnKey{rType: rType, state: state}]
+	if !ok || ch.samples < minChurnSamples {
+		return 0, false
+	}
+	return time.Duration(waiting) * ch.interval, true
+}
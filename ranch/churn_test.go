@@ -0,0 +1,179 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+func TestChurnTracker(t *testing.T) {
+	testCases := []struct {
+		name     string
+		releases []time.Duration
+		waiting  int
+		expected time.Duration
+		ok       bool
+	}{
+		{
+			name:    "no history",
+			waiting: 1,
+		},
+		{
+			name:     "not enough history",
+			releases: []time.Duration{0, time.Minute, 2 * time.Minute},
+			waiting:  1,
+		},
+		{
+			name:     "steady churn",
+			releases: []time.Duration{0, time.Minute, 2 * time.Minute, 3 * time.Minute},
+			waiting:  3,
+			expected: 3 * time.Minute,
+			ok:       true,
+		},
+		{
+			name:    "nothing to wait for",
+			waiting: 0,
+			ok:      true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newChurnTracker()
+			start := time.Now()
+			for _, offset := range tc.releases {
+				c.observeRelease("t", common.Free, start.Add(offset))
+			}
+			estimate, ok := c.estimateWait("t", common.Free, tc.waiting)
+			if ok != tc.ok || estimate != tc.expected {
+				t.Errorf("expected (%v, %t), got (%v, %t)", tc.expected, tc.ok, estimate, ok)
+			}
+		})
+	}
+}
+
+func TestChurnTrackerByState(t *testing.T) {
+	c := newChurnTracker()
+	start := time.Now()
+	// Each lease cycle releases the resource as dirty, then as free once
+	// cleaned, which must not halve the interval of the free releases.
+	for i := 0; i <= minChurnSamples; i++ {
+		cycle := start.Add(time.Duration(i) * 10 * time.Minute)
+		c.observeRelease("t", common.Dirty, cycle)
+		c.observeRelease("t", common.Free, cycle.Add(5*time.Minute))
+	}
+	if estimate, ok := c.estimateWait("t", common.Free, 1); !ok || estimate != 10*time.Minute {
+		t.Errorf("expected an estimate of %v, got (%v, %t)", 10*time.Minute, estimate, ok)
+	}
+	if _, ok := c.estimateWait("t", common.Cleaning, 1); ok {
+		t.Error("expected no estimate without releases into the state")
+	}
+}
+
+func TestAcquireWithMaxWait(t *testing.T) {
+	r := makeTestRanch([]runtime.Object{
+		newResource("res", "t", "busy", "someone", startTime),
+	})
+	// The queued requests must not expire with the wall clock in the middle
+	// of the test.
+	r.SetClock(func() metav1.Time { return fakeNow })
+	now := fakeNow.Time
+	for i := 0; i <= minChurnSamples; i++ {
+		r.churn.observeRelease("t", common.Free, now.Add(time.Duration(i-minChurnSamples)*time.Minute))
+	}
+
+	if _, _, err := r.AcquireWithMaxWait("t", "free", "busy", "first", "first", 90*time.Second); err == nil {
+		t.Fatal("expected an error")
+	} else if _, ok := err.(*ResourceNotFound); !ok {
+		t.Fatalf("expected the first request to be queued, got %v", err)
+	}
+
+	_, _, err := r.AcquireWithMaxWait("t", "free", "busy", "second", "second", 90*time.Second)
+	if _, ok := err.(*WaitEstimateExceeded); !ok {
+		t.Fatalf("expected the second request to fail fast, got %v", err)
+	}
+	if rank, _ := r.requestMgr.GetRank(acquireRequestPriorityKey{rType: "t", state: "free"}, ""); rank != 2 {
+		t.Errorf("expected the failed request to leave the queue, got rank %d for a new request", rank)
+	}
+}
+
+func TestQueue(t *testing.T) {
+	r := makeTestRanch([]runtime.Object{
+		newResource("res-1", "t", "busy", "someone", startTime),
+		newResource("res-2", "t", "free", "", startTime),
+		newResource("res-3", "other", "busy", "someone", startTime),
+	})
+	// The queued requests must not expire with the wall clock in the middle
+	// of the test.
+	r.SetClock(func() metav1.Time { return fakeNow })
+	now := fakeNow.Time
+	for i := 0; i <= minChurnSamples; i++ {
+		r.churn.observeRelease("t", common.Free, now.Add(time.Duration(i-minChurnSamples)*time.Minute))
+		// Releases into other states do not shorten the wait for free ones.
+		r.churn.observeRelease("t", common.Dirty, now.Add(time.Duration(i-minChurnSamples)*time.Minute-30*time.Second))
+	}
+	// Lease out the only free resource so that the following requests are queued.
+	if _, _, err := r.Acquire("t", "free", "busy", "someone", ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, id := range []string{"first", "second"} {
+		_, _, err := r.Acquire("t", "free", "busy", id, id)
+		notFound, ok := err.(*ResourceNotFound)
+		if !ok {
+			t.Fatalf("expected request %s to be queued, got %v", id, err)
+		}
+		if _, ok := notFound.EstimatedWait(); !ok {
+			t.Errorf("expected an estimated wait for request %s", id)
+		}
+	}
+	r.Acquire("other", "free", "busy", "third", "third")
+
+	queue, err := r.Queue("t")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(queue) != 2 {
+		t.Fatalf("expected 2 queued requests, got %v", queue)
+	}
+	for i, expected := range []struct {
+		id   string
+		wait float64
+	}{{"first", 60}, {"second", 120}} {
+		if queue[i].RequestID != expected.id || queue[i].Rank != i+1 {
+			t.Errorf("expected %s at rank %d, got %s at rank %d", expected.id, i+1, queue[i].RequestID, queue[i].Rank)
+		}
+		if queue[i].Owner != expected.id {
+			t.Errorf("expected request %s to be owned by %s, got %q", expected.id, expected.id, queue[i].Owner)
+		}
+		if queue[i].EstimatedWaitSeconds == nil || *queue[i].EstimatedWaitSeconds != expected.wait {
+			t.Errorf("expected %s to wait %vs, got %v", expected.id, expected.wait, queue[i].EstimatedWaitSeconds)
+		}
+	}
+
+	all, err := r.Queue("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(all) != 3 || all[0].Type != "other" || all[0].EstimatedWaitSeconds != nil {
+		t.Errorf("expected requests of all types without estimate for other, got %v", all)
+	}
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/util/retry"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/crds"
+)
+
+// claimableStates are the states whose resources are left behind when their
+// owner is gone, those the reaper resets.
+var claimableStates = sets.NewString(common.Busy, common.Cleaning, common.Leased)
+
+// ClaimExpired hands a resource of rType whose owner is gone directly to
+// owner in dest, e.g. to a janitor in the cleaning state, so the resource is
+// recycled without the reaper releasing it to dirty first. The owner of a
+// resource is gone if its lease expired or, with a positive expire, if the
+// resource was not updated for expire while busy, cleaning or leased.
+// In: rtype - type of the resource to claim
+//     dest - destination state of the claimed resource
+//     owner - new owner of the resource
+//     expire - how long a resource must not have been updated to be claimed
+// Out: The claimed resource and its previous owner on success, or
+//      ResourceNotFound error if no resource of rType expired.
+func (r *Ranch) ClaimExpired(rType, dest, owner string, expire time.Duration) (*crds.ResourceObject, string, error) {
+	if err := r.admitTenant(rType); err != nil {
+		return nil, "", err
+	}
+	// Claimed resources are never free, so only claims to clean them are
+	// janitor transitions.
+	if err := r.admitApproval(rType, "", dest, owner, ""); err != nil {
+		return nil, "", err
+	}
+	var claimed *crds.ResourceObject
+	var previousOwner string
+	if err := retryOnConflict(retry.DefaultBackoff, func() error {
+		resources, err := r.Storage.GetResources()
+		if err != nil {
+			logrus.WithError(err).Errorf("could not get resources")
+			return &ResourceNotFound{name: rType}
+		}
+		now := r.now()
+		for idx := range resources.Items {
+			res := resources.Items[idx]
+			if res.Spec.Type != rType || res.Status.Owner == "" {
+				continue
+			}
+			leaseExpired := res.Status.Lease != nil && now.After(res.Status.Lease.Expiration.Time)
+			stale := expire > 0 && claimableStates.Has(res.Status.State) && now.Sub(res.Status.LastUpdate.Time) >= expire
+			if !leaseExpired && !stale {
+				continue
+			}
+			if err := r.admitTransition(&res, dest, owner); err != nil {
+				logrus.WithError(err).Warningf("Not claiming resource %s", res.Name)
+				continue
+			}
+
+			previousOwner = res.Status.Owner
+			previousState := res.Status.State
+			coAcquired := coAcquiredResources(&res)
+			delete(res.Status.UserData, common.CoAcquiredResources)
+			res.Status.Owner = owner
+			res.Status.State = dest
+			res.Status.Hold = nil
+			res.Status.Progress = nil
+			res.Status.Lease = nil
+			if claimed, err = r.Storage.UpdateResource(&res); err != nil {
+				return err
+			}
+			r.audit(common.AuditClaim, claimed, owner, previousState, "")
+			r.sla.observeLeaseEnd(res.Name, rType, now.Time)
+			r.sla.observeAcquire(res.Name, rType, 0, now.Time)
+			r.boosts.raise(previousOwner, "claimed", now.Time)
+			// The claimer keeps the resource, so it retires no waiting
+			// request.
+			r.quotas.observeRelease(rType, previousOwner, now.Time)
+			// The resources co-acquired with this one are left behind too.
+			r.releaseCoAcquired(coAcquired, previousOwner, common.Dirty)
+			logrus.Infof("Resource %s of %s claimed by %s", res.Name, previousOwner, owner)
+			return nil
+		}
+		return &ResourceNotFound{name: rType}
+	}); err != nil {
+		if _, ok := err.(*ResourceNotFound); !ok {
+			logrus.WithError(err).Error("Claim failed")
+		}
+		return nil, "", err
+	}
+	r.approvals.complete(rType, owner, "")
+	return claimed, previousOwner, nil
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+func TestClaimExpired(t *testing.T) {
+	testCases := []struct {
+		name        string
+		state       string
+		lease       time.Duration
+		elapsed     time.Duration
+		expire      time.Duration
+		expectErr   error
+		expectOwner string
+	}{
+		{
+			name:        "lease expired",
+			state:       common.Busy,
+			lease:       time.Hour,
+			elapsed:     2 * time.Hour,
+			expectOwner: "owner",
+		},
+		{
+			name:      "lease not expired",
+			state:     common.Busy,
+			lease:     time.Hour,
+			elapsed:   30 * time.Minute,
+			expectErr: &ResourceNotFound{name: "t"},
+		},
+		{
+			name:        "stale busy resource",
+			state:       common.Busy,
+			elapsed:     2 * time.Hour,
+			expire:      time.Hour,
+			expectOwner: "owner",
+		},
+		{
+			name:      "busy resource updated recently",
+			state:     common.Busy,
+			elapsed:   30 * time.Minute,
+			expire:    time.Hour,
+			expectErr: &ResourceNotFound{name: "t"},
+		},
+		{
+			name:      "stale busy resource without expire",
+			state:     common.Busy,
+			elapsed:   2 * time.Hour,
+			expectErr: &ResourceNotFound{name: "t"},
+		},
+		{
+			name:      "stale resource in another state",
+			state:     "tainted",
+			elapsed:   2 * time.Hour,
+			expire:    time.Hour,
+			expectErr: &ResourceNotFound{name: "t"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := makeTestRanch([]runtime.Object{
+				newResource("res", "t", common.Free, "", startTime),
+				newResource("free", "t", common.Free, "", startTime),
+			})
+			if _, _, err := r.AcquireWithLease("t", common.Free, tc.state, "owner", "", 0, 0, tc.lease); err != nil {
+				t.Fatalf("failed to acquire: %v", err)
+			}
+
+			r.now = func() metav1.Time { return metav1.NewTime(fakeNow.Add(tc.elapsed)) }
+			res, previousOwner, err := r.ClaimExpired("t", common.Cleaning, "janitor", tc.expire)
+			if !AreErrorsEqual(err, tc.expectErr) {
+				t.Fatalf("expected error %v, got %v", tc.expectErr, err)
+			}
+			if previousOwner != tc.expectOwner {
+				t.Errorf("expected previous owner %q, got %q", tc.expectOwner, previousOwner)
+			}
+			if err != nil {
+				return
+			}
+			if res.Status.State != common.Cleaning || res.Status.Owner != "janitor" || res.Status.Lease != nil {
+				t.Errorf("expected the resource cleaning by janitor without lease, got %+v", res.Status)
+			}
+		})
+	}
+}
+
+func TestClaimExpiredReleasesCoAcquired(t *testing.T) {
+	res := newResource("res", "t", common.Busy, "owner", startTime)
+	res.Status.UserData = map[string]string{common.CoAcquiredResources: `["dep"]`}
+	r := makeTestRanch([]runtime.Object{
+		res,
+		newResource("dep", "u", common.Busy, "owner", startTime),
+	})
+
+	r.now = func() metav1.Time { return metav1.NewTime(fakeNow.Add(2 * time.Hour)) }
+	claimed, _, err := r.ClaimExpired("t", common.Cleaning, "janitor", time.Hour)
+	if err != nil {
+		t.Fatalf("failed to claim: %v", err)
+	}
+	if _, ok := claimed.Status.UserData[common.CoAcquiredResources]; ok {
+		t.Errorf("expected the co-acquired resources to be dropped, got %v", claimed.Status.UserData)
+	}
+	dep, err := r.Storage.GetResource("dep")
+	if err != nil {
+		t.Fatalf("failed to get resource: %v", err)
+	}
+	if dep.Status.State != common.Dirty || dep.Status.Owner != "" {
+		t.Errorf("expected dep dirty without owner, got %s and %q", dep.Status.State, dep.Status.Owner)
+	}
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/crds"
+)
+
+// cleanupAverageWeight is the weight of the latest cleanup in the moving
+// average of the cleanup durations of a resource, so that the average follows
+// resources which become slower to clean over time.
+const cleanupAverageWeight = 0.2
+
+// observeCleanup records a cleanup that took the given duration and ended at
+// now in the cleanup statistics of status.
+func observeCleanup(status *crds.ResourceStatus, took time.Duration, failed bool, now metav1.Time) {
+	if status.Cleanup == nil {
+		status.Cleanup = &crds.CleanupStatus{}
+	}
+	stats := status.Cleanup
+	stats.Cleanups++
+	stats.LastCleanup = now
+	if failed {
+		stats.Failures++
+		return
+	}
+	seconds := took.Seconds()
+	if stats.Cleanups-stats.Failures == 1 {
+		stats.AverageSeconds = seconds
+	} else {
+		stats.AverageSeconds += cleanupAverageWeight * (seconds - stats.AverageSeconds)
+	}
+	stats.LastSeconds = seconds
+	if seconds > stats.MaxSeconds {
+		stats.MaxSeconds = seconds
+	}
+}
+
+// ReleaseCleaned is like Release, for janitors releasing a resource they
+// cleaned, which took cleanupDuration. Releasing the resource to the dirty
+// state records a failed cleanup.
+func (r *Ranch) ReleaseCleaned(name, dest, owner string, cleanupDuration time.Duration) error {
+	return r.release(name, dest, owner, cleanupDuration)
+}
+
+func describe(res *crds.ResourceObject) common.ResourceDescription {
+	return common.ResourceDescription{
+		Resource: res.ToResource(),
+		Cleanup:  res.Status.Cleanup.ToCleanupStats(),
+		Notes:    crds.ToNotes(res.Status.Notes),
+	}
+}
+
+// Describe returns the resource called name along with its statistics and
+// notes.
+// Out: The description of the resource on success, or
+//      ResourceNotFound error if target named resource does not exist.
+func (r *Ranch) Describe(name string) (*common.ResourceDescription, error) {
+	res, err := r.Storage.GetResource(name)
+	if err != nil {
+		logrus.WithError(err).Errorf("could not find resource %s to describe", name)
+		return nil, &ResourceNotFound{name: name}
+	}
+	description := describe(res)
+	return &description, nil
+}
+
+// DescribeType returns the resources of rType along with their statistics,
+// the slowest to clean first. Resources without cleanup statistics come last.
+// Out: The descriptions on success, or
+//      ResourceTypeNotFound error if there is no resource of rType.
+func (r *Ranch) DescribeType(rType string) ([]common.ResourceDescription, error) {
+	resources, err := r.Storage.GetResourcesForRead()
+	if err != nil {
+		logrus.WithError(err).Error("cannot get resources")
+		return nil, err
+	}
+	var descriptions []common.ResourceDescription
+	for idx := range resources.Items {
+		if resources.Items[idx].Spec.Type == rType {
+			descriptions = append(descriptions, describe(&resources.Items[idx]))
+		}
+	}
+	if len(descriptions) == 0 {
+		return nil, &ResourceTypeNotFound{rType: rType}
+	}
+	sort.SliceStable(descriptions, func(i, j int) bool {
+		a, b := descriptions[i].Cleanup, descriptions[j].Cleanup
+		if a == nil || b == nil {
+			return b == nil && a != nil
+		}
+		return a.AverageSeconds > b.AverageSeconds
+	})
+	return descriptions, nil
+}
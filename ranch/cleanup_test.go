@@ -0,0 +1,130 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/diff"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+func TestReleaseCleaned(t *testing.T) {
+	testCases := []struct {
+		name        string
+		state       string
+		cleanups    []time.Duration
+		dests       []string
+		expectStats *common.CleanupStats
+	}{
+		{
+			name:     "successful cleanups",
+			state:    common.Cleaning,
+			cleanups: []time.Duration{10 * time.Minute, 20 * time.Minute},
+			dests:    []string{common.Free, common.Free},
+			expectStats: &common.CleanupStats{
+				Cleanups:       2,
+				LastSeconds:    1200,
+				AverageSeconds: 720,
+				MaxSeconds:     1200,
+				LastCleanup:    fakeNow.Time,
+			},
+		},
+		{
+			name:     "failed cleanup",
+			state:    common.Cleaning,
+			cleanups: []time.Duration{10 * time.Minute, time.Minute},
+			dests:    []string{common.Free, common.Dirty},
+			expectStats: &common.CleanupStats{
+				Cleanups:       2,
+				Failures:       1,
+				LastSeconds:    600,
+				AverageSeconds: 600,
+				MaxSeconds:     600,
+				LastCleanup:    fakeNow.Time,
+			},
+		},
+		{
+			name:     "not being cleaned",
+			state:    common.Busy,
+			cleanups: []time.Duration{10 * time.Minute},
+			dests:    []string{common.Free},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := makeTestRanch([]runtime.Object{newResource("res", "t", tc.state, "janitor", startTime)})
+			for idx, took := range tc.cleanups {
+				if idx > 0 {
+					if _, _, err := r.Acquire("t", tc.dests[idx-1], tc.state, "janitor", ""); err != nil {
+						t.Fatalf("failed to acquire: %v", err)
+					}
+				}
+				if err := r.ReleaseCleaned("res", tc.dests[idx], "janitor", took); err != nil {
+					t.Fatalf("failed to release: %v", err)
+				}
+			}
+
+			description, err := r.Describe("res")
+			if err != nil {
+				t.Fatalf("failed to describe: %v", err)
+			}
+			// Times lose their location in storage.
+			if tc.expectStats != nil && description.Cleanup != nil && description.Cleanup.LastCleanup.Equal(tc.expectStats.LastCleanup) {
+				description.Cleanup.LastCleanup = tc.expectStats.LastCleanup
+			}
+			if !reflect.DeepEqual(tc.expectStats, description.Cleanup) {
+				t.Errorf("got incorrect cleanup stats: %s", diff.ObjectReflectDiff(tc.expectStats, description.Cleanup))
+			}
+		})
+	}
+}
+
+func TestDescribeType(t *testing.T) {
+	r := makeTestRanch([]runtime.Object{
+		newResource("never-cleaned", "t", common.Free, "", startTime),
+		newResource("fast", "t", common.Cleaning, "janitor", startTime),
+		newResource("slow", "t", common.Cleaning, "janitor", startTime),
+		newResource("other", "other", common.Free, "", startTime),
+	})
+	if err := r.ReleaseCleaned("fast", common.Free, "janitor", time.Minute); err != nil {
+		t.Fatalf("failed to release: %v", err)
+	}
+	if err := r.ReleaseCleaned("slow", common.Free, "janitor", time.Hour); err != nil {
+		t.Fatalf("failed to release: %v", err)
+	}
+
+	descriptions, err := r.DescribeType("t")
+	if err != nil {
+		t.Fatalf("failed to describe: %v", err)
+	}
+	var names []string
+	for _, description := range descriptions {
+		names = append(names, description.Resource.Name)
+	}
+	if expected := []string{"slow", "fast", "never-cleaned"}; !reflect.DeepEqual(expected, names) {
+		t.Errorf("expected the resources slowest to clean first %v, got %v", expected, names)
+	}
+
+	if _, err := r.DescribeType("unknown"); !AreErrorsEqual(err, &ResourceTypeNotFound{rType: "unknown"}) {
+		t.Errorf("expected a ResourceTypeNotFound error, got %v", err)
+	}
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"sync"
+	"time"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+// configSyncTracker records the outcome of the config syncs, so a broken
+// config file, only fatal at startup, can be alerted on while boskos runs.
+type configSyncTracker struct {
+	lock   sync.Mutex
+	status common.ConfigSyncStatus
+	// syncing counts the running syncs, whose changes are counted in added
+	// and tombstoned.
+	syncing           int
+	added, tombstoned int
+}
+
+func newConfigSyncTracker() *configSyncTracker {
+	return &configSyncTracker{}
+}
+
+// start records the start of a sync and returns its start time.
+func (t *configSyncTracker) start() time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.syncing == 0 {
+		t.added, t.tombstoned = 0, 0
+	}
+	t.syncing++
+	return time.Now()
+}
+
+// observe counts the resources added and tombstoned, if a sync is running.
+func (t *configSyncTracker) observe(added, tombstoned int) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.syncing > 0 {
+		t.added += added
+		t.tombstoned += tombstoned
+	}
+}
+
+// finish records the outcome of the sync started at started. Syncs rejected
+// in read-only mode are not syncs.
+func (t *configSyncTracker) finish(started time.Time, err error, now time.Time) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.syncing--
+	if _, readOnly := err.(*ReadOnly); readOnly {
+		return
+	}
+	t.status.Syncs++
+	t.status.LastDuration = time.Since(started)
+	t.status.LastAdded, t.status.LastTombstoned = t.added, t.tombstoned
+	t.status.Added += t.added
+	t.status.Tombstoned += t.tombstoned
+	t.added, t.tombstoned = 0, 0
+	if err != nil {
+		t.status.Errors++
+		return
+	}
+	t.status.LastSuccess = &now
+}
+
+func (t *configSyncTracker) get() common.ConfigSyncStatus {
+	if t == nil {
+		return common.ConfigSyncStatus{}
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	status := t.status
+	if status.LastSuccess != nil {
+		lastSuccess := *status.LastSuccess
+		status.LastSuccess = &lastSuccess
+	}
+	return status
+}
+
+// ConfigSyncStatus returns the health of the config syncs.
+func (r *Ranch) ConfigSyncStatus() common.ConfigSyncStatus {
+	return r.Storage.configSyncs.get()
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"path/filepath"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+func TestConfigSyncStatus(t *testing.T) {
+	r := makeTestRanch([]runtime.Object{
+		newResource("old", "t", common.Free, "", startTime),
+	})
+
+	config := &common.BoskosConfig{Resources: []common.ResourceEntry{{Type: "t", State: common.Free, Names: []string{"new-1", "new-2"}}}}
+	if err := r.ApplyConfig(config); err != nil {
+		t.Fatalf("failed to apply config: %v", err)
+	}
+	status := r.ConfigSyncStatus()
+	if status.Syncs != 1 || status.Errors != 0 {
+		t.Errorf("expected one successful sync, got %+v", status)
+	}
+	if status.LastSuccess == nil || !status.LastSuccess.Equal(fakeNow.Time) {
+		t.Errorf("expected the last success at %v, got %v", fakeNow.Time, status.LastSuccess)
+	}
+	if status.LastAdded != 2 || status.LastTombstoned != 1 {
+		t.Errorf("expected 2 added and 1 tombstoned resources, got %d and %d", status.LastAdded, status.LastTombstoned)
+	}
+
+	if err := r.SyncConfig(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Fatal("expected syncing a missing config to fail")
+	}
+	if err := r.ApplyConfig(config); err != nil {
+		t.Fatalf("failed to apply config: %v", err)
+	}
+	status = r.ConfigSyncStatus()
+	if status.Syncs != 3 || status.Errors != 1 {
+		t.Errorf("expected 3 syncs with one error, got %+v", status)
+	}
+	if status.LastAdded != 0 || status.LastTombstoned != 0 {
+		t.Errorf("expected the unchanged config to change no resources, got %d added and %d tombstoned", status.LastAdded, status.LastTombstoned)
+	}
+	if status.Added != 2 || status.Tombstoned != 1 {
+		t.Errorf("expected 2 added and 1 tombstoned resources over all syncs, got %d and %d", status.Added, status.Tombstoned)
+	}
+
+	r.SetReadOnly(true)
+	r.ApplyConfig(config)
+	if got := r.ConfigSyncStatus().Syncs; got != 3 {
+		t.Errorf("expected syncs rejected in read-only mode not to count, got %d syncs", got)
+	}
+}
@@ -0,0 +1,236 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/crds"
+)
+
+// demand is capacity declared ahead of time for a resource type.
+type demand struct {
+	count int
+	// neededAt is when the resources are expected to be acquired.
+	neededAt time.Time
+	// expires is when the demand stops being provisioned for.
+	expires time.Time
+	// acquired is how many resources were acquired since the demand was
+	// declared, which are in use rather than wanted anymore.
+	acquired int
+}
+
+// demandTracker holds the upcoming demand declared by schedulers, so dynamic
+// resources can be created before the acquire requests come in.
+type demandTracker struct {
+	lock    sync.Mutex
+	demands map[string][]demand
+}
+
+func newDemandTracker() *demandTracker {
+	return &demandTracker{demands: map[string][]demand{}}
+}
+
+func (d *demandTracker) declare(rType string, dem demand) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.demands[rType] = append(d.demands[rType], dem)
+}
+
+// active returns the demands of rType that did not expire yet, sorted by when
+// they are needed. Must be called with the lock held.
+func (d *demandTracker) active(rType string, now time.Time) []demand {
+	var active []demand
+	for _, dem := range d.demands[rType] {
+		if now.Before(dem.expires) {
+			active = append(active, dem)
+		}
+	}
+	if len(active) == 0 {
+		delete(d.demands, rType)
+		return nil
+	}
+	sort.SliceStable(active, func(i, j int) bool { return active[i].neededAt.Before(active[j].neededAt) })
+	d.demands[rType] = active
+	return active
+}
+
+// wanted returns how many resources of rType should be ready on top of those
+// in use to cover the active demand not acquired yet.
+func (d *demandTracker) wanted(rType string, now time.Time) int {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	var wanted int
+	for _, dem := range d.active(rType, now) {
+		wanted += dem.count - dem.acquired
+	}
+	return wanted
+}
+
+// observeAcquire records that a resource of rType was acquired, satisfying
+// the active demand needed the soonest which was not acquired in full yet.
+func (d *demandTracker) observeAcquire(rType string, now time.Time) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	active := d.active(rType, now)
+	for idx := range active {
+		if active[idx].acquired < active[idx].count {
+			active[idx].acquired++
+			return
+		}
+	}
+}
+
+func (d *demandTracker) list(now time.Time) []common.Demand {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	var types []string
+	for rType := range d.demands {
+		types = append(types, rType)
+	}
+	sort.Strings(types)
+	var demands []common.Demand
+	for _, rType := range types {
+		for _, dem := range d.active(rType, now) {
+			demands = append(demands, common.Demand{Type: rType, Count: dem.count, NeededAt: dem.neededAt, Expires: dem.expires, Acquired: dem.acquired})
+		}
+	}
+	return demands
+}
+
+// minCount returns how many active dynamic resources of the lifecycle should
+// exist given the declared demand: enough for the demand not acquired yet on
+// top of the resources in use, within MinCount and MaxCount.
+func (s *Storage) minCount(lifecycle *crds.DRLCObject, resources []crds.ResourceObject) int {
+	minCount := lifecycle.Spec.MinCount
+	if s.demand == nil {
+		return minCount
+	}
+	wanted := s.demand.wanted(lifecycle.Name, s.now().Time)
+	if wanted == 0 {
+		return minCount
+	}
+	var inUse int
+	for _, r := range resources {
+		if r.Status.Owner != "" {
+			inUse++
+		}
+	}
+	if target := inUse + wanted; target > minCount {
+		minCount = target
+	}
+	if minCount > lifecycle.Spec.MaxCount {
+		minCount = lifecycle.Spec.MaxCount
+	}
+	return minCount
+}
+
+// flavorMinCounts returns the min count of each flavor of lifecycle given the
+// resources of each flavor. The declared demand is handed to the flavors in
+// order, like the resources created for acquires without a flavor, each flavor
+// taking what fits below its MaxCount.
+func (s *Storage) flavorMinCounts(lifecycle *crds.DRLCObject, byFlavor map[string][]crds.ResourceObject) map[string]int {
+	var wanted int
+	if s.demand != nil {
+		wanted = s.demand.wanted(lifecycle.Name, s.now().Time)
+	}
+	minCounts := map[string]int{}
+	for _, flavor := range lifecycle.Spec.Flavors {
+		minCount := flavor.MinCount
+		if wanted > 0 {
+			var inUse int
+			for _, r := range byFlavor[flavor.Name] {
+				if r.Status.Owner != "" {
+					inUse++
+				}
+			}
+			taken := flavor.MaxCount - inUse
+			if taken > wanted {
+				taken = wanted
+			}
+			if taken > 0 {
+				wanted -= taken
+				if target := inUse + taken; target > minCount {
+					minCount = target
+				}
+			}
+		}
+		minCounts[flavor.Name] = minCount
+	}
+	return minCounts
+}
+
+// provisionDemand creates the dynamic resources of rType needed for the
+// declared demand, and returns how many were created.
+func (s *Storage) provisionDemand(rType string) (int, error) {
+	s.resourcesLock.Lock()
+	defer s.resourcesLock.Unlock()
+
+	lifecycle, err := s.GetDynamicResourceLifeCycle(rType)
+	if err != nil {
+		return 0, err
+	}
+	resources, err := s.GetResources()
+	if err != nil {
+		return 0, err
+	}
+	var existing []crds.ResourceObject
+	for _, r := range resources.Items {
+		if r.Spec.Type == rType {
+			existing = append(existing, r)
+		}
+	}
+	// Only add resources here, deletions are left to UpdateAllDynamicResources
+	// which knows about the static resources.
+	toAdd, _ := s.updateDynamicResources(lifecycle, existing)
+	if err := s.persistResources(toAdd, nil, true); err != nil {
+		return 0, err
+	}
+	return len(toAdd), nil
+}
+
+// DeclareDemand records that count resources of rType are expected to be
+// acquired in about in, and are needed until expires. Resources of dynamic
+// types are created right away, within the MaxCount of the type, so they have
+// time to be made ready before the requests come in.
+// Out: the number of resources created on success, or
+//      ResourceTypeNotFound error if rType is not a dynamic resource type.
+func (r *Ranch) DeclareDemand(rType string, count int, in, expires time.Duration) (int, error) {
+	if _, err := r.Storage.GetDynamicResourceLifeCycle(rType); err != nil {
+		return 0, &ResourceTypeNotFound{rType: rType}
+	}
+	now := r.now().Time
+	r.Storage.demand.declare(rType, demand{count: count, neededAt: now.Add(in), expires: now.Add(in + expires)})
+	created, err := r.Storage.provisionDemand(rType)
+	if err != nil {
+		logrus.WithError(err).Errorf("failed to provision demand for %s", rType)
+		return 0, err
+	}
+	logrus.WithFields(logrus.Fields{"type": rType, "count": count, "in": in, "created": created}).Info("Declared demand")
+	return created, nil
+}
+
+// Demand returns the declared demand that did not expire yet, sorted by type
+// and by when it is needed.
+func (r *Ranch) Demand() []common.Demand {
+	return r.Storage.demand.list(r.now().Time)
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/crds"
+)
+
+func TestDeclareDemand(t *testing.T) {
+	testCases := []struct {
+		name          string
+		count         int
+		expectCreated int
+	}{
+		{
+			name:          "demand within max count",
+			count:         2,
+			expectCreated: 2,
+		},
+		{
+			name:          "demand above max count",
+			count:         10,
+			expectCreated: 4,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := makeTestRanch([]runtime.Object{
+				&crds.DRLCObject{
+					ObjectMeta: metav1.ObjectMeta{Name: "dr"},
+					Spec:       crds.DRLCSpec{MinCount: 1, MaxCount: 5, InitialState: common.Dirty},
+				},
+				newResource("dr-busy", "dr", common.Busy, "someone", startTime),
+			})
+
+			created, err := r.DeclareDemand("dr", tc.count, 5*time.Minute, time.Minute)
+			if err != nil {
+				t.Fatalf("failed to declare demand: %v", err)
+			}
+			// The busy resource counts against the max count but not towards the demand.
+			if created != tc.expectCreated {
+				t.Errorf("expected %d resources to be created, got %d", tc.expectCreated, created)
+			}
+			demands := r.Demand()
+			if len(demands) != 1 || demands[0].Count != tc.count || !demands[0].NeededAt.Equal(fakeNow.Add(5*time.Minute)) {
+				t.Errorf("expected the demand to be recorded, got %+v", demands)
+			}
+
+			r.now = func() metav1.Time { return metav1.NewTime(fakeNow.Add(10 * time.Minute)) }
+			if demands := r.Demand(); len(demands) != 0 {
+				t.Errorf("expected the demand to expire, got %+v", demands)
+			}
+		})
+	}
+
+	t.Run("flavored type", func(t *testing.T) {
+		r := makeTestRanch([]runtime.Object{
+			&crds.DRLCObject{
+				ObjectMeta: metav1.ObjectMeta{Name: "vm"},
+				Spec: crds.DRLCSpec{
+					InitialState: common.Dirty,
+					MaxCount:     6,
+					Flavors: []common.DynamicResourceFlavor{
+						{Name: "small", MinCount: 1, MaxCount: 3},
+						{Name: "large", MaxCount: 3},
+					},
+				},
+			},
+			withFlavor(newResource("small-busy", "vm", common.Busy, "someone", startTime), "small"),
+		})
+
+		created, err := r.DeclareDemand("vm", 4, 5*time.Minute, time.Minute)
+		if err != nil {
+			t.Fatalf("failed to declare demand: %v", err)
+		}
+		// The small flavor fits two more resources, the large one the rest.
+		if created != 4 {
+			t.Errorf("expected 4 resources to be created, got %d", created)
+		}
+		resources, err := r.Storage.GetResources()
+		if err != nil {
+			t.Fatalf("failed to get resources: %v", err)
+		}
+		flavors := map[string]int{}
+		for _, res := range resources.Items {
+			flavors[res.Status.UserData[common.FlavorUserDataKey]]++
+		}
+		if flavors["small"] != 3 || flavors["large"] != 2 {
+			t.Errorf("expected 3 small and 2 large resources, got %v", flavors)
+		}
+	})
+
+	t.Run("static type", func(t *testing.T) {
+		r := makeTestRanch([]runtime.Object{newResource("res", "t", common.Free, "", startTime)})
+		if _, err := r.DeclareDemand("t", 1, 0, time.Minute); !AreErrorsEqual(err, &ResourceTypeNotFound{rType: "t"}) {
+			t.Errorf("expected a ResourceTypeNotFound error, got %v", err)
+		}
+	})
+}
+
+func TestDemandSatisfiedByAcquires(t *testing.T) {
+	r := makeTestRanch([]runtime.Object{
+		&crds.DRLCObject{
+			ObjectMeta: metav1.ObjectMeta{Name: "dr"},
+			Spec:       crds.DRLCSpec{MaxCount: 10, InitialState: common.Free},
+		},
+	})
+	if created, err := r.DeclareDemand("dr", 2, 0, time.Hour); err != nil || created != 2 {
+		t.Fatalf("expected 2 resources to be created, got %d: %v", created, err)
+	}
+	for _, owner := range []string{"job-1", "job-2"} {
+		if _, _, err := r.Acquire("dr", common.Free, common.Busy, owner, ""); err != nil {
+			t.Fatalf("failed to acquire: %v", err)
+		}
+	}
+
+	// The acquired resources are the demand, not in use on top of it.
+	if created, err := r.Storage.provisionDemand("dr"); err != nil || created != 0 {
+		t.Errorf("expected no resources to be created once the demand is acquired, got %d: %v", created, err)
+	}
+	if demands := r.Demand(); len(demands) != 1 || demands[0].Acquired != 2 {
+		t.Errorf("expected the demand to be acquired in full, got %+v", demands)
+	}
+}
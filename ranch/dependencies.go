@@ -0,0 +1,183 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/util/retry"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/crds"
+)
+
+// dependencyManager holds the resource types co-acquired with each type.
+type dependencyManager struct {
+	lock     sync.RWMutex
+	requires map[string]common.ResourceNeeds
+}
+
+func newDependencyManager() *dependencyManager {
+	return &dependencyManager{requires: map[string]common.ResourceNeeds{}}
+}
+
+func (d *dependencyManager) set(config *common.BoskosConfig) {
+	requires := map[string]common.ResourceNeeds{}
+	for _, entry := range config.Resources {
+		if len(entry.Requires) > 0 {
+			requires[entry.Type] = entry.Requires
+		}
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.requires = requires
+}
+
+func (d *dependencyManager) get(rType string) common.ResourceNeeds {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	return d.requires[rType]
+}
+
+// coAcquire moves free resources of the types needed by res to owner and dest,
+// linking them to res in their user data, along with the resources they need
+// in turn. It returns the names of the resources co-acquired with res itself,
+// or a ResourceNotFound error for the first required type without enough free
+// resources. The resources in taken are skipped, and the co-acquired ones are
+// added to it. Nothing is co-acquired on error.
+func (r *Ranch) coAcquire(needs common.ResourceNeeds, res *crds.ResourceObject, resources []crds.ResourceObject, owner, dest string, taken sets.String) ([]string, error) {
+	if taken == nil {
+		taken = sets.NewString()
+	}
+	taken.Insert(res.Name)
+	var types []string
+	for rType := range needs {
+		types = append(types, rType)
+	}
+	sort.Strings(types)
+
+	var picked []crds.ResourceObject
+	for _, rType := range types {
+		found := 0
+		for idx := range resources {
+			if found == needs[rType] {
+				break
+			}
+			candidate := resources[idx]
+			if candidate.Spec.Type != rType || candidate.Status.State != common.Free || candidate.Status.Owner != "" || candidate.Status.CredentialsExposed || taken.Has(candidate.Name) {
+				continue
+			}
+			taken.Insert(candidate.Name)
+			picked = append(picked, candidate)
+			found++
+		}
+		if found < needs[rType] {
+			return nil, &ResourceNotFound{name: rType}
+		}
+	}
+
+	coAcquiredBy, err := json.Marshal(res.Name)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for idx := range picked {
+		dep := picked[idx]
+		dep.Status.Owner = owner
+		dep.Status.State = dest
+		r.rotations.expose(&dep)
+		if dep.Status.UserData == nil {
+			dep.Status.UserData = map[string]string{}
+		}
+		dep.Status.UserData[common.CoAcquiredBy] = string(coAcquiredBy)
+		var children []string
+		if depNeeds := r.deps.get(dep.Spec.Type); len(depNeeds) > 0 {
+			if children, err = r.coAcquire(depNeeds, &dep, resources, owner, dest, taken); err != nil {
+				r.releaseCoAcquired(names, owner, common.Free)
+				return nil, err
+			}
+			js, err := json.Marshal(common.LeasedResources(children))
+			if err != nil {
+				r.releaseCoAcquired(children, owner, common.Free)
+				r.releaseCoAcquired(names, owner, common.Free)
+				return nil, err
+			}
+			dep.Status.UserData[common.CoAcquiredResources] = string(js)
+		}
+		if _, err := r.Storage.UpdateResource(&dep); err != nil {
+			r.releaseCoAcquired(children, owner, common.Free)
+			r.releaseCoAcquired(names, owner, common.Free)
+			return nil, err
+		}
+		names = append(names, dep.Name)
+	}
+	return names, nil
+}
+
+// coAcquiredResources returns the names of the resources co-acquired with res.
+func coAcquiredResources(res *crds.ResourceObject) []string {
+	value, ok := res.Status.UserData[common.CoAcquiredResources]
+	if !ok {
+		return nil
+	}
+	var names common.LeasedResources
+	if err := json.Unmarshal([]byte(value), &names); err != nil {
+		logrus.WithError(err).Errorf("invalid %s user data of resource %s", common.CoAcquiredResources, res.Name)
+		return nil
+	}
+	return names
+}
+
+// releaseCoAcquired releases co-acquired resources still held by owner to dest,
+// along with the resources co-acquired with them in turn. Failures are only
+// logged: the resources are eventually reset by the reaper. The release goes on
+// even if the request releasing them was abandoned.
+func (r *Ranch) releaseCoAcquired(names []string, owner, dest string) {
+	r, cancel := r.detached()
+	defer cancel()
+	for _, name := range names {
+		var rType string
+		var children []string
+		if err := retryOnConflict(retry.DefaultBackoff, func() error {
+			dep, err := r.Storage.GetResource(name)
+			if err != nil {
+				return err
+			}
+			if dep.Status.Owner != owner {
+				return &OwnerNotMatch{request: owner, owner: dep.Status.Owner}
+			}
+			rType = dep.Spec.Type
+			children = coAcquiredResources(dep)
+			dep.Status.Owner = ""
+			dep.Status.State = dest
+			delete(dep.Status.UserData, common.CoAcquiredBy)
+			delete(dep.Status.UserData, common.CoAcquiredResources)
+			_, err = r.Storage.UpdateResource(dep)
+			return err
+		}); err != nil {
+			logrus.WithError(err).Errorf("failed to release co-acquired resource %s", name)
+			continue
+		}
+		r.quotas.observeRelease(rType, owner, r.now().Time)
+		r.churn.observeRelease(rType, dest, r.now().Time)
+		r.releaseCoAcquired(children, owner, dest)
+	}
+}
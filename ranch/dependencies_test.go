@@ -0,0 +1,175 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+func TestCoAcquisition(t *testing.T) {
+	testCases := []struct {
+		name      string
+		resources []runtime.Object
+		expectErr error
+	}{
+		{
+			name: "required resource available",
+			resources: []runtime.Object{
+				newResource("cluster", "cluster", common.Free, "", startTime),
+				newResource("ip-block", "ip-block", common.Free, "", startTime),
+			},
+		},
+		{
+			name: "required resource busy",
+			resources: []runtime.Object{
+				newResource("cluster", "cluster", common.Free, "", startTime),
+				newResource("ip-block", "ip-block", common.Busy, "someone", startTime),
+			},
+			expectErr: &ResourceNotFound{name: "ip-block"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := makeTestRanch(tc.resources)
+			r.deps.set(&common.BoskosConfig{Resources: []common.ResourceEntry{
+				{Type: "cluster", Requires: common.ResourceNeeds{"ip-block": 1}},
+			}})
+
+			res, _, err := r.Acquire("cluster", common.Free, common.Busy, "owner", "")
+			if !AreErrorsEqual(err, tc.expectErr) {
+				t.Fatalf("expected error %v, got %v", tc.expectErr, err)
+			}
+			if err != nil {
+				cluster, err := r.Storage.GetResource("cluster")
+				if err != nil {
+					t.Fatalf("failed to get resource: %v", err)
+				}
+				if cluster.Status.Owner != "" {
+					t.Errorf("expected the cluster not to be acquired, got owner %s", cluster.Status.Owner)
+				}
+				return
+			}
+			if names := coAcquiredResources(res); len(names) != 1 || names[0] != "ip-block" {
+				t.Fatalf("expected the ip-block to be linked to the cluster, got %v", names)
+			}
+			ipBlock, err := r.Storage.GetResource("ip-block")
+			if err != nil {
+				t.Fatalf("failed to get resource: %v", err)
+			}
+			if ipBlock.Status.Owner != "owner" || ipBlock.Status.State != common.Busy || ipBlock.Status.UserData[common.CoAcquiredBy] != `"cluster"` {
+				t.Errorf("expected the ip-block to be co-acquired, got %+v", ipBlock.Status)
+			}
+
+			if err := r.Release("cluster", common.Dirty, "owner"); err != nil {
+				t.Fatalf("failed to release: %v", err)
+			}
+			ipBlock, err = r.Storage.GetResource("ip-block")
+			if err != nil {
+				t.Fatalf("failed to get resource: %v", err)
+			}
+			if ipBlock.Status.Owner != "" || ipBlock.Status.State != common.Dirty {
+				t.Errorf("expected the release to cascade to the ip-block, got %+v", ipBlock.Status)
+			}
+		})
+	}
+}
+
+func TestTransitiveCoAcquisition(t *testing.T) {
+	testCases := []struct {
+		name      string
+		resources []runtime.Object
+		expectErr error
+	}{
+		{
+			name: "required resources available",
+			resources: []runtime.Object{
+				newResource("cluster", "cluster", common.Free, "", startTime),
+				newResource("network", "network", common.Free, "", startTime),
+				newResource("subnet", "subnet", common.Free, "", startTime),
+			},
+		},
+		{
+			name: "resource required by a required resource busy",
+			resources: []runtime.Object{
+				newResource("cluster", "cluster", common.Free, "", startTime),
+				newResource("network", "network", common.Free, "", startTime),
+				newResource("subnet", "subnet", common.Busy, "someone", startTime),
+			},
+			expectErr: &ResourceNotFound{name: "subnet"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := makeTestRanch(tc.resources)
+			r.deps.set(&common.BoskosConfig{Resources: []common.ResourceEntry{
+				{Type: "cluster", Requires: common.ResourceNeeds{"network": 1}},
+				{Type: "network", Requires: common.ResourceNeeds{"subnet": 1}},
+			}})
+
+			res, _, err := r.Acquire("cluster", common.Free, common.Busy, "owner", "")
+			if !AreErrorsEqual(err, tc.expectErr) {
+				t.Fatalf("expected error %v, got %v", tc.expectErr, err)
+			}
+			if err != nil {
+				for _, name := range []string{"cluster", "network"} {
+					res, err := r.Storage.GetResource(name)
+					if err != nil {
+						t.Fatalf("failed to get resource: %v", err)
+					}
+					if res.Status.Owner != "" || res.Status.State != common.Free {
+						t.Errorf("expected %s not to be acquired, got %+v", name, res.Status)
+					}
+				}
+				return
+			}
+			if names := coAcquiredResources(res); len(names) != 1 || names[0] != "network" {
+				t.Fatalf("expected the network to be linked to the cluster, got %v", names)
+			}
+			network, err := r.Storage.GetResource("network")
+			if err != nil {
+				t.Fatalf("failed to get resource: %v", err)
+			}
+			if names := coAcquiredResources(network); len(names) != 1 || names[0] != "subnet" {
+				t.Fatalf("expected the subnet to be linked to the network, got %v", names)
+			}
+			subnet, err := r.Storage.GetResource("subnet")
+			if err != nil {
+				t.Fatalf("failed to get resource: %v", err)
+			}
+			if subnet.Status.Owner != "owner" || subnet.Status.State != common.Busy || subnet.Status.UserData[common.CoAcquiredBy] != `"network"` {
+				t.Errorf("expected the subnet to be co-acquired, got %+v", subnet.Status)
+			}
+
+			if err := r.Release("cluster", common.Dirty, "owner"); err != nil {
+				t.Fatalf("failed to release: %v", err)
+			}
+			for _, name := range []string{"network", "subnet"} {
+				res, err := r.Storage.GetResource(name)
+				if err != nil {
+					t.Fatalf("failed to get resource: %v", err)
+				}
+				if res.Status.Owner != "" || res.Status.State != common.Dirty || len(coAcquiredResources(res)) != 0 {
+					t.Errorf("expected the release to cascade to %s, got %+v", name, res.Status)
+				}
+			}
+		})
+	}
+}
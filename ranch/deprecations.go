@@ -0,0 +1,74 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"sort"
+	"sync"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+// deprecationCounter counts the requests relying on deprecated behavior by
+// deprecation and owner.
+type deprecationCounter struct {
+	lock   sync.Mutex
+	counts map[string]map[string]int
+}
+
+func newDeprecationCounter() *deprecationCounter {
+	return &deprecationCounter{counts: map[string]map[string]int{}}
+}
+
+func (d *deprecationCounter) observe(id, owner string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.counts[id] == nil {
+		d.counts[id] = map[string]int{}
+	}
+	d.counts[id][owner]++
+}
+
+func (d *deprecationCounter) get() []common.DeprecatedUsageCount {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	var counts []common.DeprecatedUsageCount
+	for id, byOwner := range d.counts {
+		for owner, count := range byOwner {
+			counts = append(counts, common.DeprecatedUsageCount{Deprecation: id, Owner: owner, Count: count})
+		}
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Deprecation != counts[j].Deprecation {
+			return counts[i].Deprecation < counts[j].Deprecation
+		}
+		return counts[i].Owner < counts[j].Owner
+	})
+	return counts
+}
+
+// ObserveDeprecatedUsage counts a request of owner relying on the deprecated
+// behavior identified by id.
+func (r *Ranch) ObserveDeprecatedUsage(id, owner string) {
+	r.deprecations.observe(id, owner)
+}
+
+// DeprecatedUsage returns the counts of the requests relying on deprecated
+// behavior by deprecation and owner, sorted by deprecation and owner.
+func (r *Ranch) DeprecatedUsage() []common.DeprecatedUsageCount {
+	return r.deprecations.get()
+}
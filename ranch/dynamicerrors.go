@@ -0,0 +1,179 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/retry"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+// Classes of the errors updating the dynamic resources of a type.
+const (
+	// DynamicErrorConflict errors are retried right away on a fresh view of
+	// the resources.
+	DynamicErrorConflict = "conflict"
+	// DynamicErrorQuota errors are not retried before the next sync, as
+	// the quota is unlikely to be freed in the meantime.
+	DynamicErrorQuota = "quota"
+	// DynamicErrorTransient errors are retried with a longer backoff, so the
+	// apiserver has time to recover.
+	DynamicErrorTransient = "transient"
+	// DynamicErrorOther errors are not retried.
+	DynamicErrorOther = "other"
+)
+
+// dynamicErrorBackoffs are the backoffs of the retriable error classes.
+var dynamicErrorBackoffs = map[string]wait.Backoff{
+	DynamicErrorConflict: retry.DefaultBackoff,
+	DynamicErrorTransient: {
+		Steps:    4,
+		Duration: 100 * time.Millisecond,
+		Factor:   2.0,
+		Jitter:   0.1,
+	},
+}
+
+// DynamicResourceUpdateError will be returned if the dynamic resources of a
+// type could not be updated.
+type DynamicResourceUpdateError struct {
+	rType string
+	class string
+	err   error
+}
+
+func (d DynamicResourceUpdateError) Error() string {
+	return fmt.Sprintf("failed to update dynamic resources of type %s (%s error): %v", d.rType, d.class, d.err)
+}
+
+func (d DynamicResourceUpdateError) Unwrap() error {
+	return d.err
+}
+
+// Class returns the class of the error, one of the DynamicError constants.
+func (d DynamicResourceUpdateError) Class() string {
+	return d.class
+}
+
+// classifyDynamicError returns the class of an error updating dynamic
+// resources. Conflicts come first, as retrying them on a fresh view of the
+// resources may resolve the other errors too.
+func classifyDynamicError(err error) string {
+	switch {
+	case isConflict(err):
+		return DynamicErrorConflict
+	case matchesAny(err, isQuotaExceeded):
+		return DynamicErrorQuota
+	case matchesAny(err, isTransient):
+		return DynamicErrorTransient
+	default:
+		return DynamicErrorOther
+	}
+}
+
+// isQuotaExceeded matches the errors of the ResourceQuota admission plugin.
+func isQuotaExceeded(err error) bool {
+	return kerrors.IsForbidden(err) && strings.Contains(err.Error(), "exceeded quota")
+}
+
+func isTransient(err error) bool {
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return true
+	}
+	return kerrors.IsServerTimeout(err) || kerrors.IsTimeout(err) || kerrors.IsTooManyRequests(err) ||
+		kerrors.IsServiceUnavailable(err) || kerrors.IsInternalError(err) || kerrors.IsUnexpectedServerError(err)
+}
+
+// dynamicErrorCounter counts the errors updating dynamic resources by type
+// and class.
+type dynamicErrorCounter struct {
+	lock   sync.Mutex
+	counts map[string]map[string]int
+}
+
+func newDynamicErrorCounter() *dynamicErrorCounter {
+	return &dynamicErrorCounter{counts: map[string]map[string]int{}}
+}
+
+func (d *dynamicErrorCounter) observe(rType, class string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.counts[rType] == nil {
+		d.counts[rType] = map[string]int{}
+	}
+	d.counts[rType][class]++
+}
+
+func (d *dynamicErrorCounter) get() []common.DynamicResourceErrorCount {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	var counts []common.DynamicResourceErrorCount
+	for rType, byClass := range d.counts {
+		for class, count := range byClass {
+			counts = append(counts, common.DynamicResourceErrorCount{Type: rType, Class: class, Count: count})
+		}
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Type != counts[j].Type {
+			return counts[i].Type < counts[j].Type
+		}
+		return counts[i].Class < counts[j].Class
+	})
+	return counts
+}
+
+// updateDynamicResourcesWithRetries calls update until it succeeds, retrying
+// each class of errors with its own backoff, and counts the errors.
+// Out: nil on success, or
+//      DynamicResourceUpdateError error once the error is not retried anymore.
+func (s *Storage) updateDynamicResourcesWithRetries(rType string, update func() error) error {
+	backoffs := map[string]wait.Backoff{}
+	for class, backoff := range dynamicErrorBackoffs {
+		backoffs[class] = backoff
+	}
+	for {
+		err := update()
+		if err == nil {
+			return nil
+		}
+		class := classifyDynamicError(err)
+		s.dynamicErrors.observe(rType, class)
+		backoff, retriable := backoffs[class]
+		if !retriable || backoff.Steps <= 1 {
+			return &DynamicResourceUpdateError{rType: rType, class: class, err: err}
+		}
+		logrus.WithError(err).WithFields(logrus.Fields{"type": rType, "class": class}).Warning("Retrying to update dynamic resources.")
+		time.Sleep(backoff.Step())
+		backoffs[class] = backoff
+	}
+}
+
+// DynamicResourceErrors returns the counts of the errors updating dynamic
+// resources by type and class, sorted by type and class.
+func (r *Ranch) DynamicResourceErrors() []common.DynamicResourceErrorCount {
+	return r.Storage.dynamicErrors.get()
+}
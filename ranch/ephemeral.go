@@ -0,0 +1,338 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/crds"
+)
+
+// ephemeralResultTTL is how long the outcome of the creation of an ephemeral
+// resource for a request is kept for the request to collect it.
+const ephemeralResultTTL = 10 * time.Minute
+
+// provisioning is the creation of an ephemeral resource for a request.
+type provisioning struct {
+	name string
+	done bool
+	err  error
+	// finished is when the creation finished.
+	finished time.Time
+}
+
+// ephemeralManager holds the provisioners of the ephemeral types, along with
+// the number of their resources being created and the creations for requests.
+type ephemeralManager struct {
+	lock         sync.Mutex
+	provisioners map[string]common.EphemeralProvisioner
+	creating     map[string]int
+	// pending are the creations for requests, by type, owner and request id.
+	pending map[string]*provisioning
+	client  *http.Client
+	// run runs the command of a provisioner with stdin, returning its output.
+	run func(ctx context.Context, command []string, stdin []byte) ([]byte, error)
+}
+
+func newEphemeralManager() *ephemeralManager {
+	return &ephemeralManager{
+		provisioners: map[string]common.EphemeralProvisioner{},
+		creating:     map[string]int{},
+		pending:      map[string]*provisioning{},
+		client:       &http.Client{},
+		run:          runProvisioner,
+	}
+}
+
+func runProvisioner(ctx context.Context, command []string, stdin []byte) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("provisioner %s failed: %w: %s", command[0], err, stderr.String())
+	}
+	return out, nil
+}
+
+func (m *ephemeralManager) set(config *common.BoskosConfig) {
+	provisioners := map[string]common.EphemeralProvisioner{}
+	for _, entry := range config.Resources {
+		if entry.Ephemeral != nil {
+			provisioners[entry.Type] = *entry.Ephemeral
+		}
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.provisioners = provisioners
+}
+
+func (m *ephemeralManager) get(rType string) (common.EphemeralProvisioner, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	provisioner, ok := m.provisioners[rType]
+	return provisioner, ok
+}
+
+// reserve reserves the creation of a resource of rType within the max
+// concurrency of its provisioner, counting the resources of the type which
+// exist already with count. The lock is held while counting, so that every
+// resource is counted either as existing or as being created. Reservations
+// must be released with done.
+// Out: nil on success, the error of count, or
+//      ResourceNotFound error if the max concurrency is reached.
+func (m *ephemeralManager) reserve(rType string, maxConcurrency int, count func() (int, error)) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	existing, err := count()
+	if err != nil {
+		return err
+	}
+	if existing+m.creating[rType] >= maxConcurrency {
+		return &ResourceNotFound{name: rType}
+	}
+	m.creating[rType]++
+	return nil
+}
+
+func (m *ephemeralManager) done(rType string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.creating[rType]--; m.creating[rType] <= 0 {
+		delete(m.creating, rType)
+	}
+}
+
+func provisioningKey(rType, owner, requestID string) string {
+	return rType + "/" + owner + "/" + requestID
+}
+
+// claim returns the creation for the request key. The second return value is
+// true if it did not exist, in which case the caller must start it, or drop it
+// if it cannot.
+func (m *ephemeralManager) claim(key string, now time.Time) (provisioning, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for k, p := range m.pending {
+		if p.done && now.Sub(p.finished) >= ephemeralResultTTL {
+			delete(m.pending, k)
+		}
+	}
+	if p, ok := m.pending[key]; ok {
+		return *p, false
+	}
+	m.pending[key] = &provisioning{}
+	return provisioning{}, true
+}
+
+// finish records the outcome of the creation for the request key. Failed
+// creations are forgotten once collected, so the request may try again.
+func (m *ephemeralManager) finish(key, name string, err error, now time.Time) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if p, ok := m.pending[key]; ok {
+		p.name, p.err, p.done, p.finished = name, err, true, now
+	}
+}
+
+func (m *ephemeralManager) drop(key string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	delete(m.pending, key)
+}
+
+func (m *ephemeralManager) provision(provisioner common.EphemeralProvisioner, request common.ProvisionRequest) (*common.ProvisionResponse, error) {
+	b, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	timeout := common.DefaultProvisionTimeout
+	if provisioner.Timeout != nil && provisioner.Timeout.Duration != nil {
+		timeout = *provisioner.Timeout.Duration
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	var body []byte
+	if len(provisioner.Command) > 0 {
+		if body, err = m.run(ctx, provisioner.Command, b); err != nil {
+			return nil, err
+		}
+	} else {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, provisioner.URL, bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := m.client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("provisioner request failed: %w", err)
+		}
+		defer resp.Body.Close()
+		if body, err = ioutil.ReadAll(resp.Body); err != nil {
+			return nil, fmt.Errorf("failed to read provisioner response: %w", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("provisioner returned status %d: %s", resp.StatusCode, string(body))
+		}
+	}
+	result := &common.ProvisionResponse{}
+	if err := json.Unmarshal(body, result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal provisioner response: %w", err)
+	}
+	return result, nil
+}
+
+// isEphemeral returns whether res is a resource of an ephemeral type.
+func (r *Ranch) isEphemeral(res *crds.ResourceObject) bool {
+	if res.Labels[common.EphemeralLabel] == "" {
+		return false
+	}
+	_, ok := r.ephemerals.get(res.Spec.Type)
+	return ok
+}
+
+// unpooledDest returns the state res is moved to instead of dest by a reset or
+// a forced release. Ephemeral resources are destroyed by their janitor instead
+// of being pooled, so they go to dirty rather than free.
+func (r *Ranch) unpooledDest(res *crds.ResourceObject, dest string) string {
+	if dest == common.Free && r.isEphemeral(res) {
+		return common.Dirty
+	}
+	return dest
+}
+
+// acquireEphemeral creates a resource of the ephemeral rType with its
+// provisioner, owned by owner in dest. Requests with a request id are
+// provisioned in the background: the first acquire starts the creation, and
+// the acquires with the same request id get the created resource once it
+// exists, so retries never create several resources for a request.
+// Out: The created resource on success, or
+//      ResourceNotFound error if the max concurrency of the type is reached
+//      or the resource of the request is still being created.
+func (r *Ranch) acquireEphemeral(provisioner common.EphemeralProvisioner, rType, dest, owner, requestID string, lease time.Duration) (*crds.ResourceObject, error) {
+	logger := logrus.WithFields(logrus.Fields{"type": rType, "owner": owner, "identifier": requestID})
+	if r.LameDuckMode() {
+		return nil, &LameDuck{}
+	}
+	var key string
+	if requestID != "" {
+		key = provisioningKey(rType, owner, requestID)
+		if p, created := r.ephemerals.claim(key, r.now().Time); !created {
+			return r.collectEphemeral(key, p, owner, rType)
+		}
+	}
+	var held int
+	if err := r.ephemerals.reserve(rType, provisioner.MaxConcurrency, func() (int, error) {
+		resources, err := r.Storage.GetResources()
+		if err != nil {
+			logger.WithError(err).Error("could not get resources")
+			return 0, err
+		}
+		held = countOwned(resources.Items, rType, owner)
+		if err := r.quotas.check(rType, owner, held, r.now().Time); err != nil {
+			return 0, err
+		}
+		var existing int
+		for _, res := range resources.Items {
+			if res.Spec.Type == rType {
+				existing++
+			}
+		}
+		return existing, nil
+	}); err != nil {
+		if key != "" {
+			r.ephemerals.drop(key)
+		}
+		return nil, err
+	}
+
+	name := fmt.Sprintf("%s-%s", rType, r.Storage.generateName())
+	if key == "" {
+		defer r.ephemerals.done(rType)
+		return r.createEphemeral(provisioner, name, rType, dest, owner, requestID, lease, held)
+	}
+	// The creation outlives the request starting it.
+	background := r.WithContext(context.Background())
+	go func() {
+		defer r.ephemerals.done(rType)
+		_, err := background.createEphemeral(provisioner, name, rType, dest, owner, requestID, lease, held)
+		r.ephemerals.finish(key, name, err, r.now().Time)
+	}()
+	return nil, &ResourceNotFound{name: rType}
+}
+
+// collectEphemeral returns the resource created for a request by p.
+func (r *Ranch) collectEphemeral(key string, p provisioning, owner, rType string) (*crds.ResourceObject, error) {
+	if !p.done {
+		return nil, &ResourceNotFound{name: rType}
+	}
+	if p.err != nil {
+		r.ephemerals.drop(key)
+		return nil, p.err
+	}
+	res, err := r.Storage.GetResource(p.name)
+	if err != nil || res.Status.Owner != owner {
+		// The resource was released or reclaimed since.
+		r.ephemerals.drop(key)
+		return nil, &ResourceNotFound{name: rType}
+	}
+	return res, nil
+}
+
+// createEphemeral provisions the resource name of the ephemeral rType and
+// stores it, owned by owner in dest. Held is the number of resources of the
+// type owner held before.
+func (r *Ranch) createEphemeral(provisioner common.EphemeralProvisioner, name, rType, dest, owner, requestID string, lease time.Duration, held int) (*crds.ResourceObject, error) {
+	logger := logrus.WithFields(logrus.Fields{"type": rType, "owner": owner, "identifier": requestID, "resource": name})
+	logger.Info("Provisioning ephemeral resource.")
+	resp, err := r.ephemerals.provision(provisioner, common.ProvisionRequest{Type: rType, Name: name, Owner: owner})
+	if err != nil {
+		logger.WithError(err).Error("Failed to provision ephemeral resource")
+		return nil, err
+	}
+	res := crds.NewResource(name, rType, dest, owner, r.now())
+	res.Labels = map[string]string{common.EphemeralLabel: "true"}
+	res.Status.UserData = resp.UserData
+	if lease > 0 {
+		res.Status.Lease = &crds.LeaseStatus{Expiration: metav1.NewTime(r.now().Add(lease))}
+	}
+	r.Storage.stampTenant(res)
+	if err := r.Storage.AddResource(res); err != nil {
+		// The provisioned resource is left to the janitor of the type, which
+		// should sweep the resources unknown to boskos.
+		logger.WithError(err).Error("Failed to add ephemeral resource")
+		return nil, err
+	}
+	r.audit(common.AuditAcquire, res, owner, common.Free, requestID)
+	r.sla.observeAcquire(name, rType, 0, r.now().Time)
+	r.boosts.clear(owner)
+	r.quotas.observe(rType, owner, held+1, r.now().Time)
+	return res, nil
+}
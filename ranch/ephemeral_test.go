@@ -0,0 +1,173 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/crds"
+)
+
+func TestAcquireEphemeral(t *testing.T) {
+	var requests []common.ProvisionRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request common.ProvisionRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		requests = append(requests, request)
+		json.NewEncoder(w).Encode(common.ProvisionResponse{UserData: map[string]string{"cluster": request.Name}})
+	}))
+	defer server.Close()
+
+	r := makeTestRanch(nil)
+	r.ephemerals.set(&common.BoskosConfig{Resources: []common.ResourceEntry{
+		{Type: "t", Ephemeral: &common.EphemeralProvisioner{URL: server.URL, MaxConcurrency: 1}},
+	}})
+
+	res, _, err := r.Acquire("t", common.Free, common.Busy, "owner", "")
+	if err != nil {
+		t.Fatalf("failed to acquire: %v", err)
+	}
+	if len(requests) != 1 || requests[0].Name != res.Name || requests[0].Owner != "owner" {
+		t.Errorf("unexpected provision requests %v", requests)
+	}
+	if res.Status.Owner != "owner" || res.Status.State != common.Busy {
+		t.Errorf("expected resource busy with owner, got %s with %q", res.Status.State, res.Status.Owner)
+	}
+	if res.Status.UserData["cluster"] != res.Name {
+		t.Errorf("expected provisioned user data, got %v", res.Status.UserData)
+	}
+
+	if _, _, err := r.Acquire("t", common.Free, common.Busy, "other", ""); !AreErrorsEqual(err, &ResourceNotFound{name: "t"}) {
+		t.Errorf("expected max concurrency to be reached, got %v", err)
+	}
+
+	// Released ephemeral resources are cleaned before being destroyed.
+	if err := r.Release(res.Name, common.Free, "owner"); err != nil {
+		t.Fatalf("failed to release: %v", err)
+	}
+	released, err := r.Storage.GetResource(res.Name)
+	if err != nil {
+		t.Fatalf("failed to get resource: %v", err)
+	}
+	if released.Status.State != common.Dirty {
+		t.Errorf("expected released resource to be dirty, got %s", released.Status.State)
+	}
+	if _, _, err := r.Acquire("t", common.Dirty, common.Cleaning, "janitor", ""); err != nil {
+		t.Fatalf("failed to acquire dirty resource: %v", err)
+	}
+	if err := r.Release(res.Name, common.Free, "janitor"); err != nil {
+		t.Fatalf("failed to release cleaned resource: %v", err)
+	}
+	if _, err := r.Storage.GetResource(res.Name); err == nil {
+		t.Error("expected cleaned resource to be deleted")
+	}
+
+	if _, _, err := r.Acquire("t", common.Free, common.Busy, "other", ""); err != nil {
+		t.Errorf("failed to acquire after deletion: %v", err)
+	}
+}
+
+func TestAcquireEphemeralWithRequestID(t *testing.T) {
+	var lock sync.Mutex
+	var provisioned int
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		provisioned++
+		lock.Unlock()
+		<-release
+		json.NewEncoder(w).Encode(common.ProvisionResponse{})
+	}))
+	defer server.Close()
+
+	r := makeTestRanch(nil)
+	r.ephemerals.set(&common.BoskosConfig{Resources: []common.ResourceEntry{
+		{Type: "t", Ephemeral: &common.EphemeralProvisioner{URL: server.URL, MaxConcurrency: 1}},
+	}})
+
+	// The first acquires wait for the creation started in the background.
+	for i := 0; i < 2; i++ {
+		if _, _, err := r.Acquire("t", common.Free, common.Busy, "owner", "request"); !AreErrorsEqual(err, &ResourceNotFound{name: "t"}) {
+			t.Fatalf("expected the resource to be created in the background, got %v", err)
+		}
+	}
+	// Resources being created count towards the max concurrency.
+	if _, _, err := r.Acquire("t", common.Free, common.Busy, "other", "other-request"); !AreErrorsEqual(err, &ResourceNotFound{name: "t"}) {
+		t.Fatalf("expected max concurrency to be reached, got %v", err)
+	}
+	close(release)
+
+	var res *crds.ResourceObject
+	if err := wait.PollImmediate(10*time.Millisecond, wait.ForeverTestTimeout, func() (bool, error) {
+		acquired, _, err := r.Acquire("t", common.Free, common.Busy, "owner", "request")
+		if err != nil {
+			return false, nil
+		}
+		res = acquired
+		return true, nil
+	}); err != nil {
+		t.Fatalf("expected the created resource to be handed to the request: %v", err)
+	}
+	again, _, err := r.Acquire("t", common.Free, common.Busy, "owner", "request")
+	if err != nil || again.Name != res.Name {
+		t.Errorf("expected the request to get the same resource again, got %v, %v", again, err)
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if provisioned != 1 {
+		t.Errorf("expected a single resource to be provisioned for the request, got %d", provisioned)
+	}
+
+	// Resetting leased ephemeral resources does not pool them.
+	r.SetClock(func() metav1.Time { return metav1.NewTime(time.Now().Add(time.Hour)) })
+	if _, err := r.Reset("t", common.Busy, time.Minute, common.Free); err != nil {
+		t.Fatalf("failed to reset: %v", err)
+	}
+	if reset, err := r.Storage.GetResource(res.Name); err != nil || reset.Status.State != common.Dirty {
+		t.Errorf("expected the reset ephemeral resource to be dirty, got %v, %v", reset, err)
+	}
+}
+
+func TestProvisionWithCommand(t *testing.T) {
+	m := newEphemeralManager()
+	m.run = func(ctx context.Context, command []string, stdin []byte) ([]byte, error) {
+		var request common.ProvisionRequest
+		if err := json.Unmarshal(stdin, &request); err != nil {
+			t.Errorf("failed to unmarshal request: %v", err)
+		}
+		return json.Marshal(common.ProvisionResponse{UserData: map[string]string{"project": request.Name}})
+	}
+	resp, err := m.provision(common.EphemeralProvisioner{Command: []string{"create-project"}, MaxConcurrency: 1}, common.ProvisionRequest{Type: "t", Name: "t-1"})
+	if err != nil {
+		t.Fatalf("failed to provision: %v", err)
+	}
+	if resp.UserData["project"] != "t-1" {
+		t.Errorf("expected user data from the command output, got %v", resp.UserData)
+	}
+}
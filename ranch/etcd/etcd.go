@@ -0,0 +1,388 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package etcd implements a ranch.Backend storing the resources in etcd, so
+// boskos can run outside of a Kubernetes cluster. It talks to the JSON gateway
+// of the etcd v3 API, which etcd serves on its client URLs.
+package etcd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"sigs.k8s.io/boskos/crds"
+	"sigs.k8s.io/boskos/ranch"
+)
+
+const (
+	// DefaultPrefix is the default prefix of the keys of boskos.
+	DefaultPrefix = "/boskos"
+	// defaultTimeout bounds the calls to etcd with the default client.
+	defaultTimeout = 10 * time.Second
+)
+
+var (
+	resourcesGroup = crds.Resource(crds.ResourceType.Plural)
+	drlcsGroup     = crds.Resource(crds.DRLCType.Plural)
+)
+
+// Options configure a Backend.
+type Options struct {
+	// Endpoints are the client URLs of the etcd members, e.g.
+	// http://127.0.0.1:2379. They are tried in turn until one answers.
+	Endpoints []string
+	// Prefix is prepended to the keys, so that several boskos instances can
+	// share an etcd cluster. Defaults to DefaultPrefix.
+	Prefix string
+	// Client calls etcd, e.g. with TLS client certificates. Defaults to a
+	// client with a timeout.
+	Client *http.Client
+}
+
+// Backend stores the resources and DynamicResourceLifeCycles as JSON values
+// in etcd. The mod revision of a key is the resource version of its object,
+// so that concurrent updates conflict like they do with custom resources.
+type Backend struct {
+	endpoints []string
+	prefix    string
+	client    *http.Client
+}
+
+var _ ranch.Backend = &Backend{}
+
+// NewBackend returns a Backend configured by opts.
+func NewBackend(opts Options) (*Backend, error) {
+	if len(opts.Endpoints) == 0 {
+		return nil, errors.New("at least one etcd endpoint must be set")
+	}
+	b := &Backend{prefix: strings.TrimSuffix(opts.Prefix, "/"), client: opts.Client}
+	for _, endpoint := range opts.Endpoints {
+		if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
+			return nil, fmt.Errorf("invalid etcd endpoint %q: must be an http(s) URL", endpoint)
+		}
+		b.endpoints = append(b.endpoints, strings.TrimSuffix(endpoint, "/"))
+	}
+	if b.prefix == "" {
+		b.prefix = DefaultPrefix
+	}
+	if b.client == nil {
+		b.client = &http.Client{Timeout: defaultTimeout}
+	}
+	return b, nil
+}
+
+type responseHeader struct {
+	Revision int64 `json:"revision,string"`
+}
+
+type keyValue struct {
+	Key         []byte `json:"key"`
+	Value       []byte `json:"value"`
+	ModRevision int64  `json:"mod_revision,string"`
+}
+
+type rangeRequest struct {
+	Key      []byte `json:"key"`
+	RangeEnd []byte `json:"range_end,omitempty"`
+}
+
+type rangeResponse struct {
+	Kvs []keyValue `json:"kvs"`
+}
+
+type putRequest struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+}
+
+type deleteRangeRequest struct {
+	Key []byte `json:"key"`
+}
+
+type deleteRangeResponse struct {
+	Deleted int64 `json:"deleted,string"`
+}
+
+type compare struct {
+	Key            []byte `json:"key"`
+	Target         string `json:"target"`
+	Result         string `json:"result"`
+	ModRevision    int64  `json:"mod_revision,string,omitempty"`
+	CreateRevision int64  `json:"create_revision,string,omitempty"`
+}
+
+type requestOp struct {
+	RequestPut *putRequest `json:"request_put,omitempty"`
+}
+
+type txnRequest struct {
+	Compare []compare   `json:"compare"`
+	Success []requestOp `json:"success"`
+}
+
+type txnResponse struct {
+	Header    responseHeader `json:"header"`
+	Succeeded bool           `json:"succeeded"`
+}
+
+// call posts in to the endpoint of the KV API at path, and decodes the
+// response into out.
+func (b *Backend) call(ctx context.Context, path string, in, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	var errs []string
+	for _, endpoint := range b.endpoints {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+"/v3/kv/"+path, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := b.client.Do(req)
+		if err != nil {
+			// The member may be down, try the next one.
+			errs = append(errs, err.Error())
+			continue
+		}
+		respBody, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("etcd %s failed with status %s: %s", path, resp.Status, respBody)
+		}
+		return json.Unmarshal(respBody, out)
+	}
+	return fmt.Errorf("no etcd endpoint answered: %s", strings.Join(errs, ", "))
+}
+
+func (b *Backend) key(kind, name string) []byte {
+	return []byte(b.prefix + "/" + kind + "/" + name)
+}
+
+// rangeEnd returns the end of the range of the keys starting with prefix.
+func rangeEnd(prefix []byte) []byte {
+	end := append([]byte{}, prefix...)
+	end[len(end)-1]++
+	return end
+}
+
+// encode encodes obj without its resource version, which is the mod revision
+// of its key.
+func encode(obj metav1.Object) ([]byte, error) {
+	resourceVersion := obj.GetResourceVersion()
+	obj.SetResourceVersion("")
+	defer obj.SetResourceVersion(resourceVersion)
+	return json.Marshal(obj)
+}
+
+func (b *Backend) create(ctx context.Context, group schema.GroupResource, kind string, obj metav1.Object) error {
+	if created := obj.GetCreationTimestamp(); created.IsZero() {
+		obj.SetCreationTimestamp(metav1.Now())
+	}
+	data, err := encode(obj)
+	if err != nil {
+		return err
+	}
+	key := b.key(kind, obj.GetName())
+	var resp txnResponse
+	if err := b.call(ctx, "txn", txnRequest{
+		// A create revision of 0 means the key does not exist.
+		Compare: []compare{{Key: key, Target: "CREATE", Result: "EQUAL"}},
+		Success: []requestOp{{RequestPut: &putRequest{Key: key, Value: data}}},
+	}, &resp); err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return kerrors.NewAlreadyExists(group, obj.GetName())
+	}
+	obj.SetResourceVersion(strconv.FormatInt(resp.Header.Revision, 10))
+	return nil
+}
+
+func (b *Backend) get(ctx context.Context, group schema.GroupResource, kind, name string, obj metav1.Object) error {
+	var resp rangeResponse
+	if err := b.call(ctx, "range", rangeRequest{Key: b.key(kind, name)}, &resp); err != nil {
+		return err
+	}
+	if len(resp.Kvs) == 0 {
+		return kerrors.NewNotFound(group, name)
+	}
+	if err := json.Unmarshal(resp.Kvs[0].Value, obj); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", resp.Kvs[0].Key, err)
+	}
+	obj.SetResourceVersion(strconv.FormatInt(resp.Kvs[0].ModRevision, 10))
+	return nil
+}
+
+// list calls decode with the value and resource version of every key of kind.
+func (b *Backend) list(ctx context.Context, kind string, decode func(value []byte, resourceVersion string) error) error {
+	prefix := b.key(kind, "")
+	var resp rangeResponse
+	if err := b.call(ctx, "range", rangeRequest{Key: prefix, RangeEnd: rangeEnd(prefix)}, &resp); err != nil {
+		return err
+	}
+	for _, kv := range resp.Kvs {
+		if err := decode(kv.Value, strconv.FormatInt(kv.ModRevision, 10)); err != nil {
+			return fmt.Errorf("failed to decode %s: %w", kv.Key, err)
+		}
+	}
+	return nil
+}
+
+// update replaces the object if its resource version is the mod revision of
+// its key, or unconditionally if it has no resource version.
+func (b *Backend) update(ctx context.Context, group schema.GroupResource, kind string, obj metav1.Object) error {
+	key := b.key(kind, obj.GetName())
+	cmp := compare{Key: key, Target: "CREATE", Result: "GREATER"}
+	if rv := obj.GetResourceVersion(); rv != "" {
+		modRevision, err := strconv.ParseInt(rv, 10, 64)
+		if err != nil {
+			return kerrors.NewBadRequest(fmt.Sprintf("invalid resource version %q", rv))
+		}
+		cmp = compare{Key: key, Target: "MOD", Result: "EQUAL", ModRevision: modRevision}
+	}
+	data, err := encode(obj)
+	if err != nil {
+		return err
+	}
+	var resp txnResponse
+	if err := b.call(ctx, "txn", txnRequest{
+		Compare: []compare{cmp},
+		Success: []requestOp{{RequestPut: &putRequest{Key: key, Value: data}}},
+	}, &resp); err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		var existing rangeResponse
+		if err := b.call(ctx, "range", rangeRequest{Key: key}, &existing); err != nil {
+			return err
+		}
+		if len(existing.Kvs) == 0 {
+			return kerrors.NewNotFound(group, obj.GetName())
+		}
+		return kerrors.NewConflict(group, obj.GetName(), errors.New("the object has been modified; please apply your changes to the latest version and try again"))
+	}
+	obj.SetResourceVersion(strconv.FormatInt(resp.Header.Revision, 10))
+	return nil
+}
+
+func (b *Backend) delete(ctx context.Context, group schema.GroupResource, kind, name string) error {
+	var resp deleteRangeResponse
+	if err := b.call(ctx, "deleterange", deleteRangeRequest{Key: b.key(kind, name)}, &resp); err != nil {
+		return err
+	}
+	if resp.Deleted == 0 {
+		return kerrors.NewNotFound(group, name)
+	}
+	return nil
+}
+
+// CreateResource implements ranch.Backend.
+func (b *Backend) CreateResource(ctx context.Context, resource *crds.ResourceObject) error {
+	return b.create(ctx, resourcesGroup, crds.ResourceType.Plural, resource)
+}
+
+// GetResource implements ranch.Backend.
+func (b *Backend) GetResource(ctx context.Context, name string) (*crds.ResourceObject, error) {
+	resource := &crds.ResourceObject{}
+	if err := b.get(ctx, resourcesGroup, crds.ResourceType.Plural, name, resource); err != nil {
+		return nil, err
+	}
+	return resource, nil
+}
+
+// ListResources implements ranch.Backend.
+func (b *Backend) ListResources(ctx context.Context) (*crds.ResourceObjectList, error) {
+	resourceList := &crds.ResourceObjectList{}
+	if err := b.list(ctx, crds.ResourceType.Plural, func(value []byte, resourceVersion string) error {
+		var resource crds.ResourceObject
+		if err := json.Unmarshal(value, &resource); err != nil {
+			return err
+		}
+		resource.ResourceVersion = resourceVersion
+		resourceList.Items = append(resourceList.Items, resource)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return resourceList, nil
+}
+
+// UpdateResource implements ranch.Backend.
+func (b *Backend) UpdateResource(ctx context.Context, resource *crds.ResourceObject) error {
+	return b.update(ctx, resourcesGroup, crds.ResourceType.Plural, resource)
+}
+
+// DeleteResource implements ranch.Backend.
+func (b *Backend) DeleteResource(ctx context.Context, name string) error {
+	return b.delete(ctx, resourcesGroup, crds.ResourceType.Plural, name)
+}
+
+// CreateDynamicResourceLifeCycle implements ranch.Backend.
+func (b *Backend) CreateDynamicResourceLifeCycle(ctx context.Context, drlc *crds.DRLCObject) error {
+	return b.create(ctx, drlcsGroup, crds.DRLCType.Plural, drlc)
+}
+
+// GetDynamicResourceLifeCycle implements ranch.Backend.
+func (b *Backend) GetDynamicResourceLifeCycle(ctx context.Context, name string) (*crds.DRLCObject, error) {
+	drlc := &crds.DRLCObject{}
+	if err := b.get(ctx, drlcsGroup, crds.DRLCType.Plural, name, drlc); err != nil {
+		return nil, err
+	}
+	return drlc, nil
+}
+
+// ListDynamicResourceLifeCycles implements ranch.Backend.
+func (b *Backend) ListDynamicResourceLifeCycles(ctx context.Context) (*crds.DRLCObjectList, error) {
+	drlcList := &crds.DRLCObjectList{}
+	if err := b.list(ctx, crds.DRLCType.Plural, func(value []byte, resourceVersion string) error {
+		var drlc crds.DRLCObject
+		if err := json.Unmarshal(value, &drlc); err != nil {
+			return err
+		}
+		drlc.ResourceVersion = resourceVersion
+		drlcList.Items = append(drlcList.Items, drlc)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return drlcList, nil
+}
+
+// UpdateDynamicResourceLifeCycle implements ranch.Backend.
+func (b *Backend) UpdateDynamicResourceLifeCycle(ctx context.Context, drlc *crds.DRLCObject) error {
+	return b.update(ctx, drlcsGroup, crds.DRLCType.Plural, drlc)
+}
+
+// DeleteDynamicResourceLifeCycle implements ranch.Backend.
+func (b *Backend) DeleteDynamicResourceLifeCycle(ctx context.Context, name string) error {
+	return b.delete(ctx, drlcsGroup, crds.DRLCType.Plural, name)
+}
@@ -0,0 +1,219 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/crds"
+)
+
+type fakeKey struct {
+	value                       []byte
+	createRevision, modRevision int64
+}
+
+// fakeEtcd serves the parts of the JSON gateway of the etcd v3 API the
+// Backend uses, from memory.
+type fakeEtcd struct {
+	lock     sync.Mutex
+	revision int64
+	keys     map[string]*fakeKey
+}
+
+func (f *fakeEtcd) kvs(key, end []byte) []keyValue {
+	var kvs []keyValue
+	for k, v := range f.keys {
+		if k == string(key) || (end != nil && k >= string(key) && k < string(end)) {
+			kvs = append(kvs, keyValue{Key: []byte(k), Value: v.value, ModRevision: v.modRevision})
+		}
+	}
+	sort.Slice(kvs, func(i, j int) bool { return bytes.Compare(kvs[i].Key, kvs[j].Key) < 0 })
+	return kvs
+}
+
+func (f *fakeEtcd) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	var out interface{}
+	switch r.URL.Path {
+	case "/v3/kv/range":
+		var req rangeRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		out = rangeResponse{Kvs: f.kvs(req.Key, req.RangeEnd)}
+	case "/v3/kv/deleterange":
+		var req deleteRangeRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		var resp deleteRangeResponse
+		if _, ok := f.keys[string(req.Key)]; ok {
+			delete(f.keys, string(req.Key))
+			f.revision++
+			resp.Deleted = 1
+		}
+		out = resp
+	case "/v3/kv/txn":
+		var req txnRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		succeeded := true
+		for _, cmp := range req.Compare {
+			var createRevision, modRevision int64
+			if k, ok := f.keys[string(cmp.Key)]; ok {
+				createRevision, modRevision = k.createRevision, k.modRevision
+			}
+			switch {
+			case cmp.Target == "CREATE" && cmp.Result == "EQUAL":
+				succeeded = succeeded && createRevision == cmp.CreateRevision
+			case cmp.Target == "CREATE" && cmp.Result == "GREATER":
+				succeeded = succeeded && createRevision > cmp.CreateRevision
+			case cmp.Target == "MOD" && cmp.Result == "EQUAL":
+				succeeded = succeeded && modRevision == cmp.ModRevision
+			default:
+				http.Error(w, "unsupported compare", http.StatusBadRequest)
+				return
+			}
+		}
+		if succeeded {
+			f.revision++
+			for _, op := range req.Success {
+				k, ok := f.keys[string(op.RequestPut.Key)]
+				if !ok {
+					k = &fakeKey{createRevision: f.revision}
+					f.keys[string(op.RequestPut.Key)] = k
+				}
+				k.value, k.modRevision = op.RequestPut.Value, f.revision
+			}
+		}
+		out = txnResponse{Header: responseHeader{Revision: f.revision}, Succeeded: succeeded}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	json.NewEncoder(w).Encode(out)
+}
+
+func newTestBackend(t *testing.T) *Backend {
+	server := httptest.NewServer(&fakeEtcd{keys: map[string]*fakeKey{}})
+	t.Cleanup(server.Close)
+	// The first endpoint is down, so requests fail over to the second one.
+	b, err := NewBackend(Options{Endpoints: []string{"http://127.0.0.1:1", server.URL}})
+	if err != nil {
+		t.Fatalf("failed to create backend: %v", err)
+	}
+	return b
+}
+
+func TestResources(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBackend(t)
+
+	res := crds.NewResource("res-1", "t", common.Free, "", metav1.Now())
+	if err := b.CreateResource(ctx, res); err != nil {
+		t.Fatalf("failed to create resource: %v", err)
+	}
+	if err := b.CreateResource(ctx, crds.NewResource("res-1", "t", common.Free, "", metav1.Now())); !kerrors.IsAlreadyExists(err) {
+		t.Errorf("expected an already exists error, got %v", err)
+	}
+	if err := b.CreateResource(ctx, crds.NewResource("res-2", "t", common.Dirty, "", metav1.Now())); err != nil {
+		t.Fatalf("failed to create resource: %v", err)
+	}
+
+	got, err := b.GetResource(ctx, "res-1")
+	if err != nil {
+		t.Fatalf("failed to get resource: %v", err)
+	}
+	if got.Spec.Type != "t" || got.ResourceVersion != res.ResourceVersion {
+		t.Errorf("expected the created resource, got %+v", got)
+	}
+
+	got.Status.Owner = "owner"
+	if err := b.UpdateResource(ctx, got); err != nil {
+		t.Fatalf("failed to update resource: %v", err)
+	}
+	// res is stale now.
+	res.Status.Owner = "other"
+	if err := b.UpdateResource(ctx, res); !kerrors.IsConflict(err) {
+		t.Errorf("expected a conflict, got %v", err)
+	}
+	if err := b.UpdateResource(ctx, crds.NewResource("missing", "t", common.Free, "", metav1.Now())); !kerrors.IsNotFound(err) {
+		t.Errorf("expected a not found error, got %v", err)
+	}
+
+	list, err := b.ListResources(ctx)
+	if err != nil {
+		t.Fatalf("failed to list resources: %v", err)
+	}
+	if len(list.Items) != 2 || list.Items[0].Status.Owner != "owner" || list.Items[1].Name != "res-2" {
+		t.Errorf("expected both resources, got %+v", list.Items)
+	}
+
+	if err := b.DeleteResource(ctx, "res-1"); err != nil {
+		t.Fatalf("failed to delete resource: %v", err)
+	}
+	if _, err := b.GetResource(ctx, "res-1"); !kerrors.IsNotFound(err) {
+		t.Errorf("expected a not found error, got %v", err)
+	}
+	if err := b.DeleteResource(ctx, "res-1"); !kerrors.IsNotFound(err) {
+		t.Errorf("expected a not found error, got %v", err)
+	}
+}
+
+func TestDynamicResourceLifeCycles(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBackend(t)
+
+	drlc := &crds.DRLCObject{ObjectMeta: metav1.ObjectMeta{Name: "dr"}, Spec: crds.DRLCSpec{MaxCount: 2}}
+	if err := b.CreateDynamicResourceLifeCycle(ctx, drlc); err != nil {
+		t.Fatalf("failed to create drlc: %v", err)
+	}
+	// Resources and lifecycles do not share keys.
+	if err := b.CreateResource(ctx, crds.NewResource("dr", "t", common.Free, "", metav1.Now())); err != nil {
+		t.Fatalf("failed to create resource: %v", err)
+	}
+
+	drlc.Spec.MaxCount = 3
+	if err := b.UpdateDynamicResourceLifeCycle(ctx, drlc); err != nil {
+		t.Fatalf("failed to update drlc: %v", err)
+	}
+	list, err := b.ListDynamicResourceLifeCycles(ctx)
+	if err != nil {
+		t.Fatalf("failed to list drlcs: %v", err)
+	}
+	if len(list.Items) != 1 || list.Items[0].Spec.MaxCount != 3 {
+		t.Errorf("expected the updated drlc, got %+v", list.Items)
+	}
+
+	if err := b.DeleteDynamicResourceLifeCycle(ctx, "dr"); err != nil {
+		t.Fatalf("failed to delete drlc: %v", err)
+	}
+	if _, err := b.GetDynamicResourceLifeCycle(ctx, "dr"); !kerrors.IsNotFound(err) {
+		t.Errorf("expected a not found error, got %v", err)
+	}
+	if _, err := b.GetResource(ctx, "dr"); err != nil {
+		t.Errorf("expected the resource to be kept, got %v", err)
+	}
+}
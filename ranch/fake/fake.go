@@ -0,0 +1,105 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package fake provides an in-memory ranch with a controllable clock, so
+// handlers built on boskos can be unit-tested without a cluster.
+package fake
+
+import (
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	fakectrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/crds"
+	"sigs.k8s.io/boskos/ranch"
+)
+
+// Namespace holds the resources of fake ranches.
+const Namespace = "test"
+
+// Clock is a settable clock for fake ranches. It is safe for concurrent use.
+type Clock struct {
+	lock sync.Mutex
+	now  time.Time
+}
+
+// NewClock returns a clock stopped at now.
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+// Now returns the time of the clock.
+func (c *Clock) Now() metav1.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return metav1.Time{Time: c.now}
+}
+
+// Set sets the time of the clock.
+func (c *Clock) Set(now time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = now
+}
+
+// Step moves the clock forward by d.
+func (c *Clock) Step(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// NewRanch returns a ranch keeping resources in memory and telling time with
+// clock. config, if set, is applied to the ranch, which creates the resources
+// it declares.
+func NewRanch(config *common.BoskosConfig, clock *Clock, resources ...*crds.ResourceObject) (*ranch.Ranch, error) {
+	var objects []runtime.Object
+	for _, res := range resources {
+		res = res.DeepCopy()
+		res.Namespace = Namespace
+		objects = append(objects, res)
+	}
+	storage := ranch.NewTestingStorage(fakectrlruntimeclient.NewFakeClient(objects...), Namespace, clock.Now)
+	r, err := ranch.NewRanch("", storage, time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	r.SetClock(clock.Now)
+	if config != nil {
+		if err := r.ApplyConfig(config); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// NewResource returns a resource of type rtype named name, in state and held
+// by owner, last updated at lastUpdate.
+func NewResource(name, rtype, state, owner string, lastUpdate time.Time) *crds.ResourceObject {
+	return &crds.ResourceObject{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: Namespace},
+		Spec:       crds.ResourceSpec{Type: rtype},
+		Status: crds.ResourceStatus{
+			State:      state,
+			Owner:      owner,
+			LastUpdate: metav1.Time{Time: lastUpdate},
+		},
+	}
+}
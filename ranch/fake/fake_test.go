@@ -0,0 +1,53 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"testing"
+	"time"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+func TestNewRanch(t *testing.T) {
+	clock := NewClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	r, err := NewRanch(
+		&common.BoskosConfig{Resources: []common.ResourceEntry{{Type: "t", State: common.Free, Names: []string{"res-1", "res-2"}}}},
+		clock,
+		NewResource("res-1", "t", common.Busy, "owner", clock.Now().Time),
+	)
+	if err != nil {
+		t.Fatalf("failed to create ranch: %v", err)
+	}
+
+	clock.Step(time.Hour)
+	res, _, err := r.Acquire("t", common.Free, common.Busy, "someone", "")
+	if err != nil {
+		t.Fatalf("failed to acquire: %v", err)
+	}
+	if res.Name != "res-2" {
+		t.Errorf("expected to acquire the free res-2, got %s", res.Name)
+	}
+
+	reset, err := r.Reset("t", common.Busy, 30*time.Minute, common.Dirty)
+	if err != nil {
+		t.Fatalf("failed to reset: %v", err)
+	}
+	if len(reset) != 1 || reset["res-1"] != "owner" {
+		t.Errorf("expected only res-1 to be stale, got %v", reset)
+	}
+}
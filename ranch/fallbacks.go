@@ -0,0 +1,100 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/crds"
+)
+
+// fallbackManager holds the type acquired instead of each type once it is
+// exhausted.
+type fallbackManager struct {
+	lock      sync.RWMutex
+	fallbacks map[string]string
+}
+
+func newFallbackManager() *fallbackManager {
+	return &fallbackManager{fallbacks: map[string]string{}}
+}
+
+func (f *fallbackManager) set(config *common.BoskosConfig) {
+	fallbacks := map[string]string{}
+	for _, entry := range config.Resources {
+		if entry.Fallback != "" {
+			fallbacks[entry.Type] = entry.Fallback
+		}
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.fallbacks = fallbacks
+}
+
+func (f *fallbackManager) get(rType string) (string, bool) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	fallback, ok := f.fallbacks[rType]
+	return fallback, ok
+}
+
+// AcquireWithFallback is like AcquireWithLease, but acquires a resource of
+// the fallback type of rType instead when no resource of rType is available,
+// or is expected to be within maxWait. The request waits in line for both
+// types. Only the fallback of rType is tried, not the fallback of the fallback.
+// Out: The resource acquired, whose type tells whether it is a fallback, or
+//      the error of the acquisition of rType if no fallback is available.
+func (r *Ranch) AcquireWithFallback(rType, state, dest, owner, requestID string, priority int, maxWait, lease time.Duration) (*crds.ResourceObject, metav1.Time, error) {
+	res, createdTime, err := r.AcquireWithLease(rType, state, dest, owner, requestID, priority, maxWait, lease)
+	fallback, ok := r.fallbacks.get(rType)
+	if !ok {
+		return res, createdTime, err
+	}
+	if err == nil {
+		if requestID != "" {
+			// The request may have waited in line for the fallback too.
+			r.requestMgr.Delete(acquireRequestPriorityKey{rType: fallback, state: state}, requestID)
+		}
+		return res, createdTime, nil
+	}
+	switch err.(type) {
+	case *ResourceNotFound, *WaitEstimateExceeded:
+	default:
+		return nil, createdTime, err
+	}
+
+	fallbackRes, fallbackCreatedTime, fallbackErr := r.acquire(fallback, state, dest, owner, requestID, "", nil, priority, 0, 0, lease)
+	if fallbackErr != nil {
+		logrus.WithError(fallbackErr).Debugf("No fallback %s available for %s", fallback, rType)
+		return nil, createdTime, err
+	}
+	if requestID != "" {
+		// The request was made when it first waited in line for rType.
+		ts := acquireRequestPriorityKey{rType: rType, state: state}
+		if requestedAt, err := r.requestMgr.GetCreatedAt(ts, requestID); err == nil && requestedAt.Before(&fallbackCreatedTime) {
+			fallbackCreatedTime = requestedAt
+		}
+		r.requestMgr.Delete(ts, requestID)
+	}
+	logrus.Infof("Acquired resource %s of fallback type %s for %s", fallbackRes.Name, fallback, rType)
+	return fallbackRes, fallbackCreatedTime, nil
+}
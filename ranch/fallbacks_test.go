@@ -0,0 +1,95 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+func TestAcquireWithFallback(t *testing.T) {
+	testCases := []struct {
+		name       string
+		resources  []runtime.Object
+		fallback   string
+		expectType string
+		expectErr  error
+	}{
+		{
+			name: "primary type available",
+			resources: []runtime.Object{
+				newResource("regional", "regional-project", common.Free, "", startTime),
+				newResource("global", "global-project", common.Free, "", startTime),
+			},
+			fallback:   "global-project",
+			expectType: "regional-project",
+		},
+		{
+			name: "primary type exhausted",
+			resources: []runtime.Object{
+				newResource("regional", "regional-project", common.Busy, "someone", startTime),
+				newResource("global", "global-project", common.Free, "", startTime),
+			},
+			fallback:   "global-project",
+			expectType: "global-project",
+		},
+		{
+			name: "fallback type exhausted too",
+			resources: []runtime.Object{
+				newResource("regional", "regional-project", common.Busy, "someone", startTime),
+				newResource("global", "global-project", common.Busy, "someone", startTime),
+			},
+			fallback:  "global-project",
+			expectErr: &ResourceNotFound{name: "regional-project"},
+		},
+		{
+			name: "no fallback type",
+			resources: []runtime.Object{
+				newResource("regional", "regional-project", common.Busy, "someone", startTime),
+				newResource("global", "global-project", common.Free, "", startTime),
+			},
+			expectErr: &ResourceNotFound{name: "regional-project"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := makeTestRanch(tc.resources)
+			r.fallbacks.set(&common.BoskosConfig{Resources: []common.ResourceEntry{
+				{Type: "regional-project", Fallback: tc.fallback},
+			}})
+
+			res, _, err := r.AcquireWithFallback("regional-project", common.Free, common.Busy, "owner", "request", 0, 0, 0)
+			if !AreErrorsEqual(err, tc.expectErr) {
+				t.Fatalf("expected error %v, got %v", tc.expectErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if res.Spec.Type != tc.expectType || res.Status.Owner != "owner" {
+				t.Errorf("expected a %s acquired by owner, got %+v", tc.expectType, res)
+			}
+			for _, rType := range []string{"regional-project", "global-project"} {
+				if _, err := r.requestMgr.GetCreatedAt(acquireRequestPriorityKey{rType: rType, state: common.Free}, "request"); err == nil {
+					t.Errorf("expected the request to be done waiting for %s", rType)
+				}
+			}
+		})
+	}
+}
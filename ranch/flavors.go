@@ -0,0 +1,132 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/crds"
+)
+
+// updateFlavoredResources implements updateDynamicResources for a lifecycle
+// with flavors. The resources of each flavor are kept within the counts of the
+// flavor, grown for the declared demand, and the resources of a flavor no
+// longer declared are deleted once released.
+func (s *Storage) updateFlavoredResources(lifecycle *crds.DRLCObject, resources []crds.ResourceObject) (toAdd, toDelete []crds.ResourceObject) {
+	byFlavor := map[string][]crds.ResourceObject{}
+	declared := sets.NewString()
+	for _, f := range lifecycle.Spec.Flavors {
+		declared.Insert(f.Name)
+	}
+	var undeclared []crds.ResourceObject
+	for _, r := range resources {
+		if flavor := r.Status.UserData[common.FlavorUserDataKey]; declared.Has(flavor) {
+			byFlavor[flavor] = append(byFlavor[flavor], r)
+		} else {
+			undeclared = append(undeclared, r)
+		}
+	}
+
+	minCounts := s.flavorMinCounts(lifecycle, byFlavor)
+	for i := range lifecycle.Spec.Flavors {
+		flavor := &lifecycle.Spec.Flavors[i]
+		add, del := s.updateResourcesWithin(lifecycle, flavor, byFlavor[flavor.Name], minCounts[flavor.Name], flavor.MaxCount)
+		toAdd = append(toAdd, add...)
+		toDelete = append(toDelete, del...)
+	}
+	_, del := s.updateResourcesWithin(lifecycle, nil, undeclared, 0, 0)
+	toDelete = append(toDelete, del...)
+	return toAdd, toDelete
+}
+
+// pickFlavor picks the flavor of a resource of lifecycle created for an
+// acquire request with selector, or returns false if the flavor requested, or
+// every flavor if none is, is at its max count. The flavor is nil if the
+// lifecycle has no flavors.
+func pickFlavor(lifecycle *crds.DRLCObject, resources []crds.ResourceObject, selector labels.Selector) (*common.DynamicResourceFlavor, bool) {
+	if len(lifecycle.Spec.Flavors) == 0 {
+		return nil, true
+	}
+	var requested string
+	if selector != nil {
+		requested, _ = selector.RequiresExactMatch(common.FlavorUserDataKey)
+	}
+	counts := map[string]int{}
+	for _, r := range resources {
+		if r.Spec.Type == lifecycle.Name {
+			counts[r.Status.UserData[common.FlavorUserDataKey]]++
+		}
+	}
+	for i := range lifecycle.Spec.Flavors {
+		flavor := &lifecycle.Spec.Flavors[i]
+		if requested != "" && flavor.Name != requested {
+			continue
+		}
+		if counts[flavor.Name] < flavor.MaxCount {
+			return flavor, true
+		}
+	}
+	return nil, false
+}
+
+// stampFlavor records in the user data of res, a new dynamic resource, its
+// flavor and the user data of the flavor, rendered once the rest of the user
+// data, like the region, is set.
+func (s *Storage) stampFlavor(res *crds.ResourceObject, flavor *common.DynamicResourceFlavor) {
+	if flavor == nil {
+		return
+	}
+	res.Status.UserData[common.FlavorUserDataKey] = flavor.Name
+	templates, err := flavor.UserData.Parse()
+	if err != nil {
+		// The templates are validated with the config.
+		logrus.WithError(err).Errorf("Failed to parse the user data of flavor %s of type %s", flavor.Name, res.Spec.Type)
+		return
+	}
+	data := common.AccessData{Name: res.Name, Type: res.Spec.Type, UserData: res.Status.UserData}
+	rendered := map[string]string{}
+	for key, t := range templates {
+		var b strings.Builder
+		if err := t.Execute(&b, data); err != nil {
+			logrus.WithError(err).Warningf("Failed to render the user data %s of flavor %s for %s", key, flavor.Name, res.Name)
+			continue
+		}
+		rendered[key] = b.String()
+	}
+	for key, value := range rendered {
+		res.Status.UserData[key] = value
+	}
+}
+
+// Flavors returns the flavors of the dynamic resource type rType, and false if
+// it has none.
+func (r *Ranch) Flavors(rType string) ([]string, bool) {
+	lifecycle, err := r.Storage.GetDynamicResourceLifeCycle(rType)
+	if err != nil || len(lifecycle.Spec.Flavors) == 0 {
+		return nil, false
+	}
+	var flavors []string
+	for _, f := range lifecycle.Spec.Flavors {
+		flavors = append(flavors, f.Name)
+	}
+	return flavors, true
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/crds"
+)
+
+func withFlavor(res *crds.ResourceObject, flavor string) *crds.ResourceObject {
+	res.Status.UserData = map[string]string{common.FlavorUserDataKey: flavor}
+	return res
+}
+
+func TestUpdateFlavoredResources(t *testing.T) {
+	r := makeTestRanch([]runtime.Object{
+		withFlavor(newResource("small-1", "vm", common.Free, "", startTime), "small"),
+		withFlavor(newResource("retired-1", "vm", common.Free, "", startTime), "retired"),
+		withFlavor(newResource("retired-2", "vm", common.Busy, "owner", startTime), "retired"),
+		&crds.DRLCObject{
+			ObjectMeta: metav1.ObjectMeta{Name: "vm"},
+			Spec: crds.DRLCSpec{
+				InitialState: common.Free,
+				MinCount:     3,
+				MaxCount:     5,
+				Flavors: []common.DynamicResourceFlavor{
+					{Name: "small", MinCount: 2, MaxCount: 4},
+					{Name: "large", MinCount: 1, MaxCount: 1, UserData: common.AccessTemplates{"machine": "{{.Name}}-16cpu"}},
+				},
+			},
+		},
+	})
+	if err := r.Storage.UpdateAllDynamicResources(nil); err != nil {
+		t.Fatalf("error updating dynamic resources: %v", err)
+	}
+	resources, err := r.Storage.GetResources()
+	if err != nil {
+		t.Fatalf("failed to get resources: %v", err)
+	}
+	got := map[string]string{}
+	for _, res := range resources.Items {
+		got[res.Name] = res.Status.State + "/" + res.Status.UserData[common.FlavorUserDataKey] + "/" + res.Status.UserData["machine"]
+	}
+	expected := map[string]string{
+		"small-1":           "free/small/",
+		"new-dynamic-res-1": "free/small/",
+		"new-dynamic-res-2": "free/large/new-dynamic-res-2-16cpu",
+		"retired-1":         "toBeDeleted/retired/",
+		"retired-2":         "busy/retired/",
+	}
+	if !reflect.DeepEqual(expected, got) {
+		t.Errorf("expected resources %v, got %v", expected, got)
+	}
+}
+
+func TestAcquireFlavor(t *testing.T) {
+	r := makeTestRanch([]runtime.Object{
+		withFlavor(newResource("small-1", "vm", common.Busy, "other", startTime), "small"),
+		&crds.DRLCObject{
+			ObjectMeta: metav1.ObjectMeta{Name: "vm"},
+			Spec: crds.DRLCSpec{
+				InitialState: common.Free,
+				MaxCount:     3,
+				Flavors: []common.DynamicResourceFlavor{
+					{Name: "small", MaxCount: 1},
+					{Name: "large", MaxCount: 2},
+				},
+			},
+		},
+	})
+	if flavors, ok := r.Flavors("vm"); !ok || !reflect.DeepEqual(flavors, []string{"small", "large"}) {
+		t.Errorf("expected the flavors of vm, got %v", flavors)
+	}
+
+	small := labels.SelectorFromSet(labels.Set{common.FlavorUserDataKey: "small"})
+	if _, _, err := r.AcquireWithSelector("vm", common.Free, common.Busy, "owner", "request-1", small, 0, 0, 0); !AreErrorsEqual(err, &ResourceNotFound{name: "vm"}) {
+		t.Errorf("expected no resource to be added past the max count of the flavor, got %v", err)
+	}
+
+	large := labels.SelectorFromSet(labels.Set{common.FlavorUserDataKey: "large"})
+	if _, _, err := r.AcquireWithSelector("vm", common.Free, common.Busy, "owner", "request-2", large, 0, 0, 0); !AreErrorsEqual(err, &ResourceNotFound{name: "vm"}) {
+		t.Fatalf("expected a resource to be added, got %v", err)
+	}
+	res, _, err := r.AcquireWithSelector("vm", common.Free, common.Busy, "owner", "request-2", large, 0, 0, 0)
+	if err != nil {
+		t.Fatalf("failed to acquire: %v", err)
+	}
+	if flavor := res.Status.UserData[common.FlavorUserDataKey]; flavor != "large" {
+		t.Errorf("expected a large resource, got %q", flavor)
+	}
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/client-go/util/retry"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/crds"
+)
+
+// ForceRelease clears or transfers the ownership of a resource regardless of
+// its current owner, e.g. when the job holding it died. The previous owner is
+// recorded in the ForceReleasedFrom user data entry. Unlike Release, it is
+// not reviewed by the transition webhooks, and the co-acquired resources are
+// left to their owner. The credentials handed out to the previous owner are
+// rotated before the resource is transferred to another owner, and the
+// transfer fails if they cannot be.
+// In: name  - name of the target resource
+//     dest  - destination state, defaults to dirty when clearing the owner
+//             and to the current state when transferring it
+//     owner - new owner of the resource, the ownership is cleared if empty
+// Out: The updated resource on success, or
+//      ResourceNotFound error if target named resource does not exist, or
+//      an error if the credentials handed out cannot be rotated before the
+//      transfer.
+func (r *Ranch) ForceRelease(name, dest, owner string) (*crds.ResourceObject, error) {
+	var updated *crds.ResourceObject
+	// The previous credentials are revoked once rotated, so failed updates
+	// must not lose the new ones.
+	var credentials map[string]string
+	if err := retryOnConflict(retry.DefaultBackoff, func() error {
+		res, err := r.Storage.GetResource(name)
+		if err != nil {
+			logrus.WithError(err).Errorf("unable to force-release resource %s", name)
+			return &ResourceNotFound{name: name}
+		}
+		previousOwner, previousState := res.Status.Owner, res.Status.State
+		// The default dest depends on the state of this attempt.
+		state := dest
+		if state == "" {
+			state = res.Status.State
+			if owner == "" {
+				state = common.Dirty
+			}
+		}
+		if owner == "" {
+			state = r.unpooledDest(res, state)
+		}
+		if owner != "" && owner != previousOwner && res.Status.CredentialsExposed && credentials == nil {
+			if credentials, err = r.rotateForTransfer(res); err != nil {
+				return err
+			}
+		}
+
+		res.Status.Owner = owner
+		res.Status.State = state
+		res.Status.Hold = nil
+		res.Status.Progress = nil
+		res.Status.Lease = nil
+		if previousOwner != "" {
+			if res.Status.UserData == nil {
+				res.Status.UserData = map[string]string{}
+			}
+			res.Status.UserData[common.ForceReleasedFrom] = previousOwner
+		}
+		if len(credentials) > 0 {
+			if res.Status.UserData == nil {
+				res.Status.UserData = map[string]string{}
+			}
+			for key, value := range credentials {
+				res.Status.UserData[key] = value
+			}
+		}
+		if updated, err = r.Storage.UpdateResource(res); err != nil {
+			return err
+		}
+		r.audit(common.AuditForceRelease, res, previousOwner, previousState, "")
+		if previousOwner != "" {
+			r.sla.observeLeaseEnd(res.Name, res.Spec.Type, r.now().Time)
+			r.quotas.observeRelease(res.Spec.Type, previousOwner, r.now().Time)
+			if owner == "" {
+				r.churn.observeRelease(res.Spec.Type, state, r.now().Time)
+			}
+		}
+		if owner != "" {
+			r.sla.observeAcquire(res.Name, res.Spec.Type, 0, r.now().Time)
+		}
+		logrus.WithFields(logrus.Fields{"resource": name, "from": previousOwner, "to": owner, "state": state}).Info("Force-released resource")
+		return nil
+	}); err != nil {
+		logrus.WithError(err).Error("Force release failed")
+		if len(credentials) > 0 {
+			r.keepRotatedCredentials(name, credentials)
+		}
+		return nil, err
+	}
+	return updated, nil
+}
+
+// keepRotatedCredentials stores the credentials rotated for a transfer that
+// failed, as the previous ones are revoked already. The resource stays with
+// its owner, flagged so its credentials are rotated again once released. It
+// goes on even if the request of the transfer was abandoned.
+func (r *Ranch) keepRotatedCredentials(name string, credentials map[string]string) {
+	r, cancel := r.detached()
+	defer cancel()
+	if err := retry.OnError(retry.DefaultBackoff, func(error) bool { return true }, func() error {
+		res, err := r.Storage.GetResource(name)
+		if err != nil {
+			return err
+		}
+		if res.Status.UserData == nil {
+			res.Status.UserData = map[string]string{}
+		}
+		for key, value := range credentials {
+			res.Status.UserData[key] = value
+		}
+		_, err = r.Storage.UpdateResource(res)
+		return err
+	}); err != nil {
+		logrus.WithError(err).WithField("resource", name).Error("Failed to store the credentials rotated for a failed transfer, they are lost")
+		return
+	}
+	logrus.WithField("resource", name).Info("Stored the credentials rotated for a failed transfer")
+}
+
+// rotateForTransfer rotates the credentials of res handed out to its owner, so
+// they are not valid anymore once it is transferred to another owner. It
+// returns the user data entries holding the new credentials.
+func (r *Ranch) rotateForTransfer(res *crds.ResourceObject) (map[string]string, error) {
+	rotation, rotator, ok := r.rotations.get(res.Spec.Type)
+	if !ok {
+		// Rotation is not configured anymore.
+		return map[string]string{}, nil
+	}
+	if rotator == nil {
+		return nil, fmt.Errorf("cannot transfer resource %s: credential rotator %s is not registered", res.Name, rotation.Rotator)
+	}
+	updates, err := rotator.Rotate(res.Name, rotation.CredentialsKey(), res.Status.UserData)
+	if err != nil {
+		return nil, fmt.Errorf("cannot transfer resource %s: failed to rotate its credentials: %w", res.Name, err)
+	}
+	logrus.WithField("resource", res.Name).Info("Rotated credentials before transfer")
+	if updates == nil {
+		updates = map[string]string{}
+	}
+	return updates, nil
+}
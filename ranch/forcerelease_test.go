@@ -0,0 +1,159 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/crds"
+)
+
+func TestForceRelease(t *testing.T) {
+	testCases := []struct {
+		name        string
+		dest        string
+		owner       string
+		expectState string
+		expectOwner string
+	}{
+		{
+			name:        "clearing the owner defaults to dirty",
+			expectState: common.Dirty,
+		},
+		{
+			name:        "clearing the owner to a state",
+			dest:        common.Free,
+			expectState: common.Free,
+		},
+		{
+			name:        "transferring the owner keeps the state",
+			owner:       "operator",
+			expectState: common.Busy,
+			expectOwner: "operator",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := makeTestRanch([]runtime.Object{newResource("res", "t", common.Busy, "dead-job", startTime)})
+			res, err := r.ForceRelease("res", tc.dest, tc.owner)
+			if err != nil {
+				t.Fatalf("failed to force-release: %v", err)
+			}
+			if res.Status.State != tc.expectState || res.Status.Owner != tc.expectOwner {
+				t.Errorf("expected %s owned by %q, got %s owned by %q", tc.expectState, tc.expectOwner, res.Status.State, res.Status.Owner)
+			}
+			if from := res.Status.UserData[common.ForceReleasedFrom]; from != "dead-job" {
+				t.Errorf("expected the previous owner in the user data, got %q", from)
+			}
+		})
+	}
+
+	r := makeTestRanch(nil)
+	if _, err := r.ForceRelease("missing", "", ""); !AreErrorsEqual(err, &ResourceNotFound{name: "missing"}) {
+		t.Errorf("expected ResourceNotFound, got %v", err)
+	}
+}
+
+// failingTransferClient fails every update giving a resource to owner.
+type failingTransferClient struct {
+	ctrlruntimeclient.Client
+	owner string
+}
+
+func (fc *failingTransferClient) Update(ctx context.Context, obj ctrlruntimeclient.Object, opts ...ctrlruntimeclient.UpdateOption) error {
+	if res, ok := obj.(*crds.ResourceObject); ok && res.Status.Owner == fc.owner {
+		return errors.New("update failed")
+	}
+	return fc.Client.Update(ctx, obj, opts...)
+}
+
+func TestForceReleaseRotatesTransferredCredentials(t *testing.T) {
+	testCases := []struct {
+		name         string
+		rotateErr    error
+		failTransfer bool
+		owner        string
+		expectErr    bool
+		expectOwner  string
+		expectSecret string
+	}{
+		{
+			name:         "transfer rotates the credentials",
+			owner:        "operator",
+			expectOwner:  "operator",
+			expectSecret: "secret-1",
+		},
+		{
+			name:         "failed rotation rejects the transfer",
+			rotateErr:    errors.New("injected"),
+			owner:        "operator",
+			expectErr:    true,
+			expectOwner:  "dead-job",
+			expectSecret: "initial",
+		},
+		{
+			name:         "failed transfer keeps the rotated credentials",
+			failTransfer: true,
+			owner:        "operator",
+			expectErr:    true,
+			expectOwner:  "dead-job",
+			expectSecret: "secret-1",
+		},
+		{
+			name:         "clearing the owner leaves the rotation to RotateCredentials",
+			rotateErr:    errors.New("injected"),
+			expectSecret: "initial",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res := newResource("res", "t", common.Busy, "dead-job", startTime)
+			res.Status.UserData[common.DefaultCredentialsKey] = "initial"
+			res.Status.CredentialsExposed = true
+			r := makeTestRanch([]runtime.Object{res})
+			if tc.failTransfer {
+				backend := r.Storage.backend.(*abandonCountingBackend).Backend.(*tracingBackend).Backend.(*crdBackend)
+				backend.client = &failingTransferClient{Client: backend.client, owner: tc.owner}
+			}
+			r.RegisterCredentialRotator(common.StaticRotator, &fakeRotator{err: tc.rotateErr})
+			r.rotations.set(&common.BoskosConfig{Resources: []common.ResourceEntry{
+				{Type: "t", CredentialRotation: &common.CredentialRotation{Rotator: common.StaticRotator}},
+			}})
+
+			if _, err := r.ForceRelease("res", "", tc.owner); (err != nil) != tc.expectErr {
+				t.Fatalf("expected error %t, got %v", tc.expectErr, err)
+			}
+			got, err := r.Storage.GetResource("res")
+			if err != nil {
+				t.Fatalf("failed to get resource: %v", err)
+			}
+			if secret := got.Status.UserData[common.DefaultCredentialsKey]; got.Status.Owner != tc.expectOwner || secret != tc.expectSecret {
+				t.Errorf("expected owner %q with secret %q, got %q with %q", tc.expectOwner, tc.expectSecret, got.Status.Owner, secret)
+			}
+			// The credentials are still out, with the new owner or to be rotated.
+			if !got.Status.CredentialsExposed {
+				t.Error("expected the credentials to be flagged as exposed")
+			}
+		})
+	}
+}
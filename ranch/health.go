@@ -0,0 +1,170 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/crds"
+)
+
+// freeCountTTL is how long the free resources of a type counted by an acquire
+// are trusted by the health advisories, so that the advisory of an acquire
+// response reuses the count of the acquire rather than listing every resource
+// again.
+const freeCountTTL = 5 * time.Second
+
+// freeCount is the number of free resources of a type at a point in time.
+type freeCount struct {
+	count int
+	at    time.Time
+}
+
+// healthManager holds the health thresholds of each resource type, and the
+// free resources of the types with a minimum last counted by acquires.
+type healthManager struct {
+	lock       sync.RWMutex
+	thresholds map[string]common.HealthThresholds
+	free       map[string]freeCount
+}
+
+func newHealthManager() *healthManager {
+	return &healthManager{
+		thresholds: map[string]common.HealthThresholds{},
+		free:       map[string]freeCount{},
+	}
+}
+
+func (h *healthManager) set(config *common.BoskosConfig) {
+	thresholds := map[string]common.HealthThresholds{}
+	for _, entry := range config.Resources {
+		if entry.HealthThresholds != nil {
+			thresholds[entry.Type] = *entry.HealthThresholds
+		}
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.thresholds = thresholds
+	h.free = map[string]freeCount{}
+}
+
+func (h *healthManager) get(rType string) (common.HealthThresholds, bool) {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	thresholds, ok := h.thresholds[rType]
+	return thresholds, ok
+}
+
+// observeFree records the free resources of rType counted by an acquire at
+// now, if the type has a minimum of free resources.
+func (h *healthManager) observeFree(rType string, free int, now time.Time) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.thresholds[rType].MinFree > 0 {
+		h.free[rType] = freeCount{count: free, at: now}
+	}
+}
+
+// recentFree returns the free resources of rType counted within freeCountTTL
+// of now. The second return value is false if there is no such count.
+func (h *healthManager) recentFree(rType string, now time.Time) (int, bool) {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	free, ok := h.free[rType]
+	if !ok || now.Sub(free.at) > freeCountTTL {
+		return 0, false
+	}
+	return free.count, true
+}
+
+// Health returns the advisory of rType if it is degraded, or nil if it is
+// healthy. The free resources are those counted by the latest acquire of the
+// type, unless it is too old, so that the advisories of acquire responses do
+// not list the resources again.
+func (r *Ranch) Health(rType string) *common.HealthAdvisory {
+	if _, ok := r.health.get(rType); !ok && !r.breakers.isOpen(rType) {
+		// Do not count the resources when there is nothing to check.
+		return nil
+	}
+	countFree := func() (int, error) {
+		if free, ok := r.health.recentFree(rType, r.now().Time); ok {
+			return free, nil
+		}
+		free := 0
+		err := r.Storage.ForEachResource(func(res *crds.ResourceObject) error {
+			if isFreeOfType(res, rType) {
+				free++
+			}
+			return nil
+		})
+		return free, err
+	}
+	ts := acquireRequestPriorityKey{rType: rType, state: common.Free}
+	advisory, err := r.healthOf(rType, countFree, r.requestMgr.queued(ts))
+	if err != nil {
+		logrus.WithError(err).Error("cannot get resources")
+		return nil
+	}
+	return advisory
+}
+
+// isFreeOfType tells whether res is a free resource of rType.
+func isFreeOfType(res *crds.ResourceObject, rType string) bool {
+	return res.Spec.Type == rType && res.Status.State == common.Free && res.Status.Owner == ""
+}
+
+// healthOf returns the advisory of rType given the count of its free
+// resources, only made if the type has a minimum, and the number of requests
+// queued for a free resource of the type, or nil if the type is healthy.
+func (r *Ranch) healthOf(rType string, countFree func() (int, error), queued int) (*common.HealthAdvisory, error) {
+	var conditions []common.HealthCondition
+	if r.breakers.isOpen(rType) {
+		conditions = append(conditions, common.HealthCondition{
+			Reason:  common.HealthCleanupPaused,
+			Message: "cleanup is paused after too many failures, dirty resources are not recycled",
+		})
+	}
+	if thresholds, ok := r.health.get(rType); ok {
+		if thresholds.MinFree > 0 {
+			free, err := countFree()
+			if err != nil {
+				return nil, err
+			}
+			if free < thresholds.MinFree {
+				conditions = append(conditions, common.HealthCondition{
+					Reason:  common.HealthLowFree,
+					Message: fmt.Sprintf("%d free resources, fewer than the minimum of %d", free, thresholds.MinFree),
+				})
+			}
+		}
+		if thresholds.MaxQueued > 0 && queued > thresholds.MaxQueued {
+			conditions = append(conditions, common.HealthCondition{
+				Reason:  common.HealthLongQueue,
+				Message: fmt.Sprintf("%d queued requests, more than the maximum of %d", queued, thresholds.MaxQueued),
+			})
+		}
+	}
+	if len(conditions) == 0 {
+		return nil, nil
+	}
+	return &common.HealthAdvisory{Type: rType, Conditions: conditions}, nil
+}
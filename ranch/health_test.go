@@ -0,0 +1,128 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+func TestHealth(t *testing.T) {
+	testCases := []struct {
+		name          string
+		free          int
+		queued        int
+		breakerOpen   bool
+		expectReasons []string
+	}{
+		{
+			name: "healthy",
+			free: 2,
+		},
+		{
+			name:          "cleanup paused",
+			free:          2,
+			breakerOpen:   true,
+			expectReasons: []string{common.HealthCleanupPaused},
+		},
+		{
+			name:          "few free resources",
+			free:          1,
+			expectReasons: []string{common.HealthLowFree},
+		},
+		{
+			name:          "long queue",
+			queued:        3,
+			expectReasons: []string{common.HealthLowFree, common.HealthLongQueue},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var resources []runtime.Object
+			for i := 0; i < tc.free; i++ {
+				resources = append(resources, newResource(fmt.Sprintf("free-%d", i), "t", common.Free, "", startTime))
+			}
+			resources = append(resources, newResource("busy", "t", common.Busy, "owner", startTime))
+			r := makeTestRanch(resources)
+			// The queued requests must not expire with the wall clock in the
+			// middle of the test.
+			r.SetClock(func() metav1.Time { return fakeNow })
+			r.health.set(&common.BoskosConfig{Resources: []common.ResourceEntry{
+				{Type: "t", HealthThresholds: &common.HealthThresholds{MinFree: 2, MaxQueued: 2}},
+			}})
+			if tc.breakerOpen {
+				openedAt := fakeNow.Time
+				r.breakers.states["t"] = &breakerState{openedAt: &openedAt}
+			}
+			ts := acquireRequestPriorityKey{rType: "t", state: common.Free}
+			for i := 0; i < tc.queued; i++ {
+				r.requestMgr.GetRank(ts, fmt.Sprintf("request-%d", i))
+			}
+
+			advisory := r.Health("t")
+			var reasons []string
+			if advisory != nil {
+				for _, c := range advisory.Conditions {
+					reasons = append(reasons, c.Reason)
+				}
+			}
+			if !reflect.DeepEqual(reasons, tc.expectReasons) {
+				t.Errorf("expected reasons %v, got %v", tc.expectReasons, reasons)
+			}
+
+			queue, err := r.Queue("t")
+			if err != nil {
+				t.Fatalf("failed to list the queue: %v", err)
+			}
+			for _, queued := range queue {
+				if !reflect.DeepEqual(queued.Health, advisory) {
+					t.Errorf("expected queued requests to carry advisory %+v, got %+v", advisory, queued.Health)
+				}
+			}
+		})
+	}
+}
+
+func TestHealthReusesAcquireCount(t *testing.T) {
+	r := makeTestRanch([]runtime.Object{
+		newResource("free-0", "t", common.Free, "", startTime),
+		newResource("free-1", "t", common.Free, "", startTime),
+	})
+	r.SetClock(func() metav1.Time { return fakeNow })
+	r.health.set(&common.BoskosConfig{Resources: []common.ResourceEntry{
+		{Type: "t", HealthThresholds: &common.HealthThresholds{MinFree: 2}},
+	}})
+	if _, _, err := r.Acquire("t", common.Free, common.Busy, "owner", ""); err != nil {
+		t.Fatalf("failed to acquire: %v", err)
+	}
+	if free, ok := r.health.recentFree("t", fakeNow.Time); !ok || free != 1 {
+		t.Errorf("expected the acquire to count 1 free resource left, got (%d, %t)", free, ok)
+	}
+	if free, ok := r.health.recentFree("t", fakeNow.Add(2*freeCountTTL)); ok {
+		t.Errorf("expected the count to expire, got %d", free)
+	}
+	advisory := r.Health("t")
+	if advisory == nil || len(advisory.Conditions) != 1 || advisory.Conditions[0].Reason != common.HealthLowFree {
+		t.Errorf("expected a low free advisory, got %+v", advisory)
+	}
+}
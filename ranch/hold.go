@@ -0,0 +1,154 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/crds"
+)
+
+// HoldExpired will be returned if a hold lapsed before it was confirmed.
+type HoldExpired struct {
+	name string
+}
+
+func (h HoldExpired) Error() string {
+	return fmt.Sprintf("hold on resource %s expired", h.name)
+}
+
+// Hold is the first phase of a two-phase acquire: it reserves a resource like
+// Acquire does, but moves it to the Held state for ttl only. The owner either
+// confirms the hold with Confirm, which moves the resource to dest, or lets it
+// lapse, which returns the resource to its original state. This prevents
+// resources from being burned by jobs that fail right after acquiring them.
+func (r *Ranch) Hold(rType, state, dest, owner, requestID string, ttl time.Duration) (*crds.ResourceObject, metav1.Time, error) {
+	return r.acquire(rType, state, dest, owner, requestID, "", nil, 0, 0, ttl, 0)
+}
+
+// Confirm is the second phase of a two-phase acquire: it moves a held resource
+// to the destination state requested by Hold.
+// In: name  - name of the held resource
+//     owner - owner of the hold
+// Out: The confirmed resource on success, or
+//      OwnerNotMatch error if owner does not match the owner of the hold, or
+//      ResourceNotFound error if target named resource does not exist, or
+//      StateNotMatch error if the resource is not held, or
+//      HoldExpired error if the hold already lapsed.
+func (r *Ranch) Confirm(name, owner string) (*crds.ResourceObject, error) {
+	var confirmed *crds.ResourceObject
+	var expired bool
+	if err := retryOnConflict(retry.DefaultBackoff, func() error {
+		res, err := r.Storage.GetResource(name)
+		if err != nil {
+			logrus.WithError(err).Errorf("could not find resource %s to confirm", name)
+			return &ResourceNotFound{name: name}
+		}
+		if owner != res.Status.Owner {
+			return &OwnerNotMatch{request: owner, owner: res.Status.Owner}
+		}
+		if res.Status.State != common.Held || res.Status.Hold == nil {
+			return &StateNotMatch{expect: common.Held, current: res.Status.State}
+		}
+		if r.now().After(res.Status.Hold.Expiration.Time) {
+			expired = true
+			return &HoldExpired{name: name}
+		}
+		res.Status.State = res.Status.Hold.Dest
+		res.Status.Hold = nil
+		if confirmed, err = r.Storage.UpdateResource(res); err != nil {
+			return err
+		}
+		r.audit(common.AuditConfirm, confirmed, owner, common.Held, "")
+		r.moveCoAcquired(coAcquiredResources(confirmed), owner, confirmed.Status.State)
+		return nil
+	}); err != nil {
+		if expired {
+			// Do not wait for the next expiry run, the owner is not coming back.
+			r.ExpireHolds()
+		} else {
+			logrus.WithError(err).Error("Confirm failed")
+		}
+		return nil, err
+	}
+	return confirmed, nil
+}
+
+// ExpireHolds returns resources whose hold lapsed to their original state, and
+// returns how many it found.
+func (r *Ranch) ExpireHolds() int {
+	resources, err := r.Storage.GetResources()
+	if err != nil {
+		logrus.WithError(err).Error("cannot get resources")
+		return 0
+	}
+	var expired int
+	for idx := range resources.Items {
+		res := resources.Items[idx]
+		if res.Status.Hold == nil || !r.now().After(res.Status.Hold.Expiration.Time) {
+			continue
+		}
+		expired++
+		owner := res.Status.Owner
+		coAcquired := coAcquiredResources(&res)
+		res.Status.Owner = ""
+		res.Status.State = res.Status.Hold.OriginalState
+		res.Status.Hold = nil
+		delete(res.Status.UserData, common.CoAcquiredResources)
+		if _, err := r.Storage.UpdateResource(&res); err != nil {
+			// Conflicts are retried on the next run.
+			logrus.WithError(err).Warningf("failed to expire hold on resource %s", res.Name)
+			continue
+		}
+		logrus.Infof("Hold of %s on resource %s lapsed", owner, res.Name)
+		r.audit(common.AuditReset, &res, owner, common.Held, "")
+		r.quotas.observeRelease(res.Spec.Type, owner, r.now().Time)
+		r.releaseCoAcquired(coAcquired, owner, common.Free)
+	}
+	return expired
+}
+
+// moveCoAcquired moves co-acquired resources still held by owner to state,
+// along with the resources co-acquired with them in turn.
+func (r *Ranch) moveCoAcquired(names []string, owner, state string) {
+	for _, name := range names {
+		var children []string
+		if err := retryOnConflict(retry.DefaultBackoff, func() error {
+			dep, err := r.Storage.GetResource(name)
+			if err != nil {
+				return err
+			}
+			if dep.Status.Owner != owner {
+				return &OwnerNotMatch{request: owner, owner: dep.Status.Owner}
+			}
+			children = coAcquiredResources(dep)
+			dep.Status.State = state
+			_, err = r.Storage.UpdateResource(dep)
+			return err
+		}); err != nil {
+			logrus.WithError(err).Errorf("failed to move co-acquired resource %s to %s", name, state)
+			continue
+		}
+		r.moveCoAcquired(children, owner, state)
+	}
+}
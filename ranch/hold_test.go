@@ -0,0 +1,130 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+func TestHoldAndConfirm(t *testing.T) {
+	testCases := []struct {
+		name          string
+		confirmOwner  string
+		elapsed       time.Duration
+		expectErr     error
+		expectState   string
+		expectOwner   string
+		expectHolding bool
+	}{
+		{
+			name:         "confirmed in time",
+			confirmOwner: "owner",
+			elapsed:      30 * time.Second,
+			expectState:  common.Busy,
+			expectOwner:  "owner",
+		},
+		{
+			name:          "confirmed by another owner",
+			confirmOwner:  "someone",
+			elapsed:       30 * time.Second,
+			expectErr:     &OwnerNotMatch{request: "someone", owner: "owner"},
+			expectState:   common.Held,
+			expectOwner:   "owner",
+			expectHolding: true,
+		},
+		{
+			name:         "confirmed after expiry",
+			confirmOwner: "owner",
+			elapsed:      2 * time.Minute,
+			expectErr:    &HoldExpired{name: "res"},
+			expectState:  common.Free,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := makeTestRanch([]runtime.Object{newResource("res", "t", common.Free, "", startTime)})
+			now := fakeNow.Time
+			r.now = func() metav1.Time { return metav1.Time{Time: now} }
+
+			held, _, err := r.Hold("t", common.Free, common.Busy, "owner", "", time.Minute)
+			if err != nil {
+				t.Fatalf("failed to hold: %v", err)
+			}
+			if held.Status.State != common.Held || held.Status.Hold == nil || held.Status.Hold.Dest != common.Busy {
+				t.Fatalf("expected the resource to be held, got %+v", held.Status)
+			}
+
+			now = now.Add(tc.elapsed)
+			_, err = r.Confirm("res", tc.confirmOwner)
+			if !AreErrorsEqual(err, tc.expectErr) {
+				t.Fatalf("expected error %v, got %v", tc.expectErr, err)
+			}
+			res, err := r.Storage.GetResource("res")
+			if err != nil {
+				t.Fatalf("failed to get resource: %v", err)
+			}
+			if res.Status.State != tc.expectState || res.Status.Owner != tc.expectOwner || (res.Status.Hold != nil) != tc.expectHolding {
+				t.Errorf("expected state %q owner %q holding %t, got %+v", tc.expectState, tc.expectOwner, tc.expectHolding, res.Status)
+			}
+		})
+	}
+}
+
+func TestExpireHolds(t *testing.T) {
+	r := makeTestRanch([]runtime.Object{
+		newResource("res-1", "t", common.Free, "", startTime),
+		newResource("res-2", "t", common.Free, "", startTime),
+	})
+	now := fakeNow.Time
+	r.now = func() metav1.Time { return metav1.Time{Time: now} }
+
+	if _, _, err := r.Hold("t", common.Free, common.Busy, "short", "", time.Minute); err != nil {
+		t.Fatalf("failed to hold: %v", err)
+	}
+	if _, _, err := r.Hold("t", common.Free, common.Busy, "long", "", time.Hour); err != nil {
+		t.Fatalf("failed to hold: %v", err)
+	}
+
+	if expired := r.ExpireHolds(); expired != 0 {
+		t.Errorf("expected no hold to expire yet, got %d", expired)
+	}
+	now = now.Add(2 * time.Minute)
+	if expired := r.ExpireHolds(); expired != 1 {
+		t.Errorf("expected one hold to expire, got %d", expired)
+	}
+
+	resources, err := r.Storage.GetResources()
+	if err != nil {
+		t.Fatalf("failed to get resources: %v", err)
+	}
+	owners := map[string]string{}
+	for _, res := range resources.Items {
+		owners[res.Status.State] = res.Status.Owner
+	}
+	if owners[common.Held] != "long" {
+		t.Errorf("expected the long hold to be kept, got %v", owners)
+	}
+	if owner, ok := owners[common.Free]; !ok || owner != "" {
+		t.Errorf("expected the short hold to be released, got %v", owners)
+	}
+}
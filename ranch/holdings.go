@@ -0,0 +1,82 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"sort"
+	"time"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+// HoldingQuery selects the holdings of the resources. Empty fields match
+// every holding.
+type HoldingQuery struct {
+	// Owner selects the holdings of an owner, e.g. a job, and Name those of a
+	// resource.
+	Owner string
+	Name  string
+	// Since and Until bound the archived events the holdings are computed
+	// from. Holdings acquired before Since are missed.
+	Since time.Time
+	Until time.Time
+}
+
+// Holdings returns the periods the resources were held by their owners,
+// matching query, sorted by acquisition time. They are computed from the
+// archived events, so test failures can be correlated with the resources the
+// job held.
+// Out: the holdings on success, or
+//      EventArchiveDisabled error if no archive is set.
+func (r *Ranch) Holdings(query HoldingQuery) ([]common.Holding, error) {
+	events, err := r.Events(EventQuery{Name: query.Name, Since: query.Since, Until: query.Until})
+	if err != nil {
+		return nil, err
+	}
+	return holdingsFromEvents(events, query.Owner), nil
+}
+
+// holdingsFromEvents replays events, oldest first, into the holdings of owner,
+// or of every owner if it is empty. A holding starts when the resource gets an
+// owner and ends when it loses it, or gets another one.
+func holdingsFromEvents(events []common.ResourceEvent, owner string) []common.Holding {
+	var holdings []common.Holding
+	held := map[string]*common.Holding{}
+	for _, event := range events {
+		current := held[event.Name]
+		if current != nil && current.Owner != event.Owner {
+			released := event.Time
+			current.Released = &released
+			holdings = append(holdings, *current)
+			delete(held, event.Name)
+			current = nil
+		}
+		if current == nil && event.Owner != "" && (owner == "" || event.Owner == owner) {
+			held[event.Name] = &common.Holding{Name: event.Name, Type: event.Type, Owner: event.Owner, Acquired: event.Time}
+		}
+	}
+	for _, holding := range held {
+		holdings = append(holdings, *holding)
+	}
+	sort.SliceStable(holdings, func(i, j int) bool {
+		if !holdings[i].Acquired.Equal(holdings[j].Acquired) {
+			return holdings[i].Acquired.Before(holdings[j].Acquired)
+		}
+		return holdings[i].Name < holdings[j].Name
+	})
+	return holdings
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+func TestHoldings(t *testing.T) {
+	base := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return base.Add(time.Duration(minutes) * time.Minute) }
+	released := func(minutes int) *time.Time { t := at(minutes); return &t }
+	events := []common.ResourceEvent{
+		{Kind: common.ResourceChanged, Name: "res", Type: "t", Time: at(0), State: common.Busy, Owner: "job-1"},
+		{Kind: common.ResourceChanged, Name: "other", Type: "t", Time: at(1), State: common.Busy, Owner: "job-1"},
+		// Updates of the owner do not end the holding.
+		{Kind: common.ResourceChanged, Name: "res", Type: "t", Time: at(2), State: common.Busy, Owner: "job-1", PreviousState: common.Busy},
+		{Kind: common.ResourceChanged, Name: "res", Type: "t", Time: at(3), State: common.Dirty, PreviousState: common.Busy},
+		{Kind: common.ResourceChanged, Name: "res", Type: "t", Time: at(4), State: common.Cleaning, Owner: "janitor", PreviousState: common.Dirty},
+		// Claiming the resource ends the holding of the previous owner.
+		{Kind: common.ResourceChanged, Name: "res", Type: "t", Time: at(5), State: common.Busy, Owner: "job-2", PreviousState: common.Cleaning},
+		{Kind: common.ResourceDeleted, Name: "other", Type: "t", Time: at(6)},
+	}
+	testCases := []struct {
+		name     string
+		query    HoldingQuery
+		expected []common.Holding
+	}{
+		{
+			name: "all holdings",
+			expected: []common.Holding{
+				{Name: "res", Type: "t", Owner: "job-1", Acquired: at(0), Released: released(3)},
+				{Name: "other", Type: "t", Owner: "job-1", Acquired: at(1), Released: released(6)},
+				{Name: "res", Type: "t", Owner: "janitor", Acquired: at(4), Released: released(5)},
+				{Name: "res", Type: "t", Owner: "job-2", Acquired: at(5)},
+			},
+		},
+		{
+			name:  "holdings of an owner",
+			query: HoldingQuery{Owner: "job-1"},
+			expected: []common.Holding{
+				{Name: "res", Type: "t", Owner: "job-1", Acquired: at(0), Released: released(3)},
+				{Name: "other", Type: "t", Owner: "job-1", Acquired: at(1), Released: released(6)},
+			},
+		},
+		{
+			name:  "holdings of a resource in a time range",
+			query: HoldingQuery{Name: "res", Since: at(4)},
+			expected: []common.Holding{
+				{Name: "res", Type: "t", Owner: "janitor", Acquired: at(4), Released: released(5)},
+				{Name: "res", Type: "t", Owner: "job-2", Acquired: at(5)},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := makeTestRanch(nil)
+			archive := NewMemoryEventArchive(10)
+			for _, event := range events {
+				if err := archive.Record(context.Background(), event); err != nil {
+					t.Fatalf("failed to record event: %v", err)
+				}
+			}
+			r.SetEventArchive(archive)
+			holdings, err := r.Holdings(tc.query)
+			if err != nil {
+				t.Fatalf("failed to get holdings: %v", err)
+			}
+			if !reflect.DeepEqual(holdings, tc.expected) {
+				t.Errorf("expected holdings %+v, got %+v", tc.expected, holdings)
+			}
+		})
+	}
+}
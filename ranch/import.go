@@ -0,0 +1,147 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/crds"
+)
+
+// importManager holds the static resource types resources may be imported
+// into, along with the state of their resources in the config.
+type importManager struct {
+	lock   sync.RWMutex
+	states map[string]string
+}
+
+func newImportManager() *importManager {
+	return &importManager{states: map[string]string{}}
+}
+
+func (i *importManager) set(config *common.BoskosConfig) {
+	states := map[string]string{}
+	for _, entry := range config.Resources {
+		if !entry.IsDRLC() {
+			states[entry.Type] = entry.State
+		}
+	}
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	i.states = states
+}
+
+func (i *importManager) get(rType string) (string, bool) {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+	state, ok := i.states[rType]
+	return state, ok
+}
+
+// validateImport returns why an imported resource is invalid, if it is.
+func (r *Ranch) validateImport(res *common.ImportedResource) error {
+	if errs := validation.IsDNS1123Subdomain(res.Name); len(errs) != 0 {
+		return fmt.Errorf("invalid name: %s", strings.Join(errs, ", "))
+	}
+	state, ok := r.imports.get(res.Type)
+	if !ok {
+		return fmt.Errorf("resource type %q is not a static type of the config", res.Type)
+	}
+	if res.State == "" {
+		res.State = state
+	}
+	if allowed, ok := r.AllowedStates(res.Type); ok {
+		known := false
+		for _, state := range allowed {
+			known = known || res.State == state
+		}
+		if !known {
+			return fmt.Errorf("invalid state %q for resource type %s: must be one of %v", res.State, res.Type, allowed)
+		}
+	}
+	return nil
+}
+
+// ImportResources creates resources of static types outside of the config,
+// e.g. to onboard a large pre-existing fleet. Resources which already exist
+// are skipped. Nothing is created if any resource is invalid, or on a dry run.
+// In: resources - resources to create, whose state defaults to the state of
+//                 their type in the config
+//     dryRun    - only validate the resources
+// Out: A summary of the import, along with the first error creating resources.
+func (r *Ranch) ImportResources(resources []common.ImportedResource, dryRun bool) (*common.ImportSummary, error) {
+	summary := &common.ImportSummary{DryRun: dryRun}
+	existing, err := r.Storage.GetResources()
+	if err != nil {
+		logrus.WithError(err).Error("cannot get resources")
+		return nil, err
+	}
+	names := map[string]bool{}
+	for _, res := range existing.Items {
+		names[res.Name] = true
+	}
+
+	var toCreate []common.ImportedResource
+	imported := map[string]bool{}
+	for idx := range resources {
+		res := resources[idx]
+		if err := r.validateImport(&res); err != nil {
+			summary.Invalid = append(summary.Invalid, common.ImportError{Index: idx, Name: res.Name, Error: err.Error()})
+			continue
+		}
+		if imported[res.Name] {
+			summary.Invalid = append(summary.Invalid, common.ImportError{Index: idx, Name: res.Name, Error: "duplicate name"})
+			continue
+		}
+		imported[res.Name] = true
+		if names[res.Name] {
+			summary.Existing = append(summary.Existing, res.Name)
+			continue
+		}
+		toCreate = append(toCreate, res)
+	}
+	if len(summary.Invalid) > 0 {
+		return summary, nil
+	}
+	if dryRun {
+		for _, res := range toCreate {
+			summary.Created = append(summary.Created, res.Name)
+		}
+		return summary, nil
+	}
+
+	for _, res := range toCreate {
+		obj := crds.FromResource(common.NewResource(res.Name, res.Type, res.State, "", r.now().Time))
+		obj.Status.UserData = res.UserData
+		obj.Labels = map[string]string{common.ImportedLabel: "true"}
+		r.Storage.stampTenant(obj)
+		if err := r.Storage.AddResource(obj); err != nil {
+			logrus.WithError(err).Errorf("failed to import resource %s", res.Name)
+			return summary, err
+		}
+		r.audit(common.AuditImport, obj, "", "", "")
+		summary.Created = append(summary.Created, res.Name)
+	}
+	logrus.Infof("Imported %d resources, skipped %d existing ones", len(summary.Created), len(summary.Existing))
+	return summary, nil
+}
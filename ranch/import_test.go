@@ -0,0 +1,116 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+func TestImportResources(t *testing.T) {
+	config := &common.BoskosConfig{Resources: []common.ResourceEntry{{
+		Type:  "project",
+		State: common.Dirty,
+		Names: []string{"configured"},
+	}}}
+	testCases := []struct {
+		name          string
+		resources     []common.ImportedResource
+		dryRun        bool
+		expected      common.ImportSummary
+		expectInvalid []int
+		expectCreated []string
+	}{
+		{
+			name: "new and existing resources",
+			resources: []common.ImportedResource{
+				{Name: "imported", Type: "project", UserData: common.UserDataMap{"region": "us-east1"}},
+				{Name: "configured", Type: "project"},
+			},
+			expected: common.ImportSummary{
+				Created:  []string{"imported"},
+				Existing: []string{"configured"},
+			},
+			expectCreated: []string{"imported"},
+		},
+		{
+			name: "dry run",
+			resources: []common.ImportedResource{
+				{Name: "imported", Type: "project"},
+			},
+			dryRun: true,
+			expected: common.ImportSummary{
+				DryRun:  true,
+				Created: []string{"imported"},
+			},
+		},
+		{
+			name: "invalid resources",
+			resources: []common.ImportedResource{
+				{Name: "imported", Type: "project"},
+				{Name: "imported", Type: "project"},
+				{Name: "Invalid_Name", Type: "project"},
+				{Name: "other", Type: "unknown"},
+			},
+			expectInvalid: []int{1, 2, 3},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := makeTestRanch([]runtime.Object{newResource("configured", "project", common.Dirty, "", startTime)})
+			r.imports.set(config)
+			summary, err := r.ImportResources(tc.resources, tc.dryRun)
+			if err != nil {
+				t.Fatalf("failed to import: %v", err)
+			}
+			var invalid []int
+			for _, e := range summary.Invalid {
+				invalid = append(invalid, e.Index)
+			}
+			if !reflect.DeepEqual(invalid, tc.expectInvalid) {
+				t.Errorf("expected invalid resources %v, got %+v", tc.expectInvalid, summary.Invalid)
+			}
+			summary.Invalid = nil
+			if !reflect.DeepEqual(*summary, tc.expected) {
+				t.Errorf("expected summary %+v, got %+v", tc.expected, *summary)
+			}
+			for _, name := range tc.expectCreated {
+				res, err := r.Storage.GetResource(name)
+				if err != nil {
+					t.Fatalf("expected %s to be created: %v", name, err)
+				}
+				if res.Status.State != common.Dirty || res.Labels[common.ImportedLabel] == "" {
+					t.Errorf("expected an imported dirty resource, got %+v", res)
+				}
+			}
+
+			// Imported resources survive config syncs.
+			if err := r.Storage.SyncResources(config); err != nil {
+				t.Fatalf("failed to sync resources: %v", err)
+			}
+			for _, name := range tc.expectCreated {
+				if _, err := r.Storage.GetResource(name); err != nil {
+					t.Errorf("expected %s to be kept by the config sync: %v", name, err)
+				}
+			}
+		})
+	}
+}
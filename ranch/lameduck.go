@@ -0,0 +1,49 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+)
+
+// LameDuck will be returned by acquisitions while the ranch is in lame-duck mode.
+type LameDuck struct{}
+
+func (LameDuck) Error() string {
+	return "boskos is draining for maintenance and does not grant new leases, try again later."
+}
+
+// SetLameDuck puts the ranch in or out of lame-duck mode. In lame-duck mode,
+// existing leases can still be updated and released, but no new lease is
+// granted, so the server can be drained before an upgrade. Requests with a
+// request ID keep their rank in the queue while they are rejected.
+func (r *Ranch) SetLameDuck(enabled bool) {
+	var value int32
+	if enabled {
+		value = 1
+	}
+	if old := atomic.SwapInt32(r.lameDuck, value); old != value {
+		logrus.WithField("lame-duck", enabled).Info("Changed lame-duck mode")
+	}
+}
+
+// LameDuckMode returns whether the ranch is in lame-duck mode.
+func (r *Ranch) LameDuckMode() bool {
+	return atomic.LoadInt32(r.lameDuck) == 1
+}
@@ -0,0 +1,54 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+func TestLameDuck(t *testing.T) {
+	r := makeTestRanch([]runtime.Object{
+		newResource("leased", "t", common.Busy, "owner", startTime),
+		newResource("free", "t", common.Free, "", startTime),
+	})
+	r.SetLameDuck(true)
+
+	if _, _, err := r.Acquire("t", common.Free, common.Busy, "other", "request"); !AreErrorsEqual(err, &LameDuck{}) {
+		t.Errorf("expected acquire to be rejected, got %v", err)
+	}
+	if _, err := r.AcquireByState(common.Free, common.Busy, "other", []string{"free"}); !AreErrorsEqual(err, &LameDuck{}) {
+		t.Errorf("expected acquire by state to be rejected, got %v", err)
+	}
+	if rank, _ := r.requestMgr.GetRank(acquireRequestPriorityKey{rType: "t", state: common.Free}, "request"); rank != 1 {
+		t.Errorf("expected the rejected request to keep its rank, got %d", rank)
+	}
+	if err := r.Update("leased", "owner", common.Busy, nil); err != nil {
+		t.Errorf("expected existing leases to be updated, got %v", err)
+	}
+	if err := r.Release("leased", common.Dirty, "owner"); err != nil {
+		t.Errorf("expected existing leases to be released, got %v", err)
+	}
+
+	r.SetLameDuck(false)
+	if _, _, err := r.Acquire("t", common.Free, common.Busy, "other", "request"); err != nil {
+		t.Errorf("expected acquire to succeed once out of lame-duck mode, got %v", err)
+	}
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/crds"
+)
+
+// AcquireWithLease is like AcquirePrioritized, but the resource is released
+// to the dirty state once lease expires, even if the owner never releases it
+// and keeps sending heartbeats. This bounds how long jobs which can be killed
+// without cleaning up hold resources. A zero lease never expires.
+func (r *Ranch) AcquireWithLease(rType, state, dest, owner, requestID string, priority int, maxWait, lease time.Duration) (*crds.ResourceObject, metav1.Time, error) {
+	return r.acquire(rType, state, dest, owner, requestID, "", nil, priority, maxWait, 0, lease)
+}
+
+// AcquireWithSelector is like AcquireWithLease, but only considers the
+// resources whose user data match selector, e.g. region=us-east-1,size=large,
+// so clients can filter the resources of a type by any dimension instead of
+// splitting them into a type per dimension. The requests of a selector wait
+// in line with those of the same selector only.
+func (r *Ranch) AcquireWithSelector(rType, state, dest, owner, requestID string, selector labels.Selector, priority int, maxWait, lease time.Duration) (*crds.ResourceObject, metav1.Time, error) {
+	return r.acquire(rType, state, dest, owner, requestID, "", selector, priority, maxWait, 0, lease)
+}
+
+// ExpireLeases releases the resources whose lease expired to the dirty state,
+// as the owner may have left them in any state, and returns how many it
+// released.
+func (r *Ranch) ExpireLeases() int {
+	resources, err := r.Storage.GetResources()
+	if err != nil {
+		logrus.WithError(err).Error("cannot get resources")
+		return 0
+	}
+	var expired int
+	for idx := range resources.Items {
+		res := resources.Items[idx]
+		if res.Status.Lease == nil || res.Status.Owner == "" || !r.now().After(res.Status.Lease.Expiration.Time) {
+			continue
+		}
+		if err := r.Release(res.Name, common.Dirty, res.Status.Owner); err != nil {
+			// Failures are retried on the next run.
+			logrus.WithError(err).Warningf("failed to expire lease on resource %s", res.Name)
+			continue
+		}
+		logrus.Infof("Lease of %s on resource %s expired", res.Status.Owner, res.Name)
+		expired++
+	}
+	return expired
+}
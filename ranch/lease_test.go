@@ -0,0 +1,177 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+func TestExpireLeases(t *testing.T) {
+	testCases := []struct {
+		name          string
+		lease         time.Duration
+		heartbeat     bool
+		elapsed       time.Duration
+		expectExpired int
+		expectState   string
+		expectOwner   string
+	}{
+		{
+			name:        "lease not expired",
+			lease:       time.Hour,
+			elapsed:     30 * time.Minute,
+			expectState: common.Busy,
+			expectOwner: "owner",
+		},
+		{
+			name:          "lease expired",
+			lease:         time.Hour,
+			elapsed:       2 * time.Hour,
+			expectExpired: 1,
+			expectState:   common.Dirty,
+		},
+		{
+			name:          "heartbeats do not renew the lease",
+			lease:         time.Hour,
+			heartbeat:     true,
+			elapsed:       2 * time.Hour,
+			expectExpired: 1,
+			expectState:   common.Dirty,
+		},
+		{
+			name:        "no lease",
+			elapsed:     2 * time.Hour,
+			expectState: common.Busy,
+			expectOwner: "owner",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := makeTestRanch([]runtime.Object{newResource("res", "t", common.Free, "", startTime)})
+			acquired, _, err := r.AcquireWithLease("t", common.Free, common.Busy, "owner", "", 0, 0, tc.lease)
+			if err != nil {
+				t.Fatalf("failed to acquire: %v", err)
+			}
+			leaseExpiration := acquired.ToResource().LeaseExpiration
+			if (tc.lease > 0) != (leaseExpiration != nil) {
+				t.Fatalf("expected a lease %t, got expiration %v", tc.lease > 0, leaseExpiration)
+			}
+
+			r.now = func() metav1.Time { return metav1.NewTime(fakeNow.Add(tc.elapsed)) }
+			if tc.heartbeat {
+				if err := r.Update("res", "owner", common.Busy, nil); err != nil {
+					t.Fatalf("failed to update: %v", err)
+				}
+			}
+			if expired := r.ExpireLeases(); expired != tc.expectExpired {
+				t.Errorf("expected %d expired leases, got %d", tc.expectExpired, expired)
+			}
+			res, err := r.Storage.GetResource("res")
+			if err != nil {
+				t.Fatalf("failed to get resource: %v", err)
+			}
+			if res.Status.State != tc.expectState || res.Status.Owner != tc.expectOwner {
+				t.Errorf("expected state %s and owner %q, got %s and %q", tc.expectState, tc.expectOwner, res.Status.State, res.Status.Owner)
+			}
+			if tc.expectExpired > 0 && res.Status.Lease != nil {
+				t.Errorf("expected the lease to be dropped, got %+v", res.Status.Lease)
+			}
+		})
+	}
+}
+
+func TestAcquireWithSelector(t *testing.T) {
+	withUserData := func(name string, userData map[string]string) runtime.Object {
+		res := newResource(name, "t", common.Free, "", startTime)
+		res.Status.UserData = userData
+		return res
+	}
+	testCases := []struct {
+		name      string
+		selector  string
+		expectRes string
+		expectErr error
+	}{
+		{
+			name:      "equality",
+			selector:  "region=us-east-1,size=large",
+			expectRes: "east-large",
+		},
+		{
+			name:      "set based",
+			selector:  "region in (us-west-1),size!=small",
+			expectRes: "west-large",
+		},
+		{
+			name:      "existence",
+			selector:  "!region",
+			expectRes: "unlabeled",
+		},
+		{
+			name:      "no match",
+			selector:  "region=eu-west-1",
+			expectErr: &ResourceNotFound{name: "t"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := makeTestRanch([]runtime.Object{
+				withUserData("east-small", map[string]string{"region": "us-east-1", "size": "small"}),
+				withUserData("east-large", map[string]string{"region": "us-east-1", "size": "large"}),
+				withUserData("west-large", map[string]string{"region": "us-west-1", "size": "large"}),
+				withUserData("unlabeled", nil),
+			})
+			selector, err := labels.Parse(tc.selector)
+			if err != nil {
+				t.Fatalf("failed to parse selector: %v", err)
+			}
+			res, _, err := r.AcquireWithSelector("t", common.Free, common.Busy, "owner", "", selector, 0, 0, 0)
+			if !AreErrorsEqual(err, tc.expectErr) {
+				t.Fatalf("expected error %v, got %v", tc.expectErr, err)
+			}
+			if err == nil && res.Name != tc.expectRes {
+				t.Errorf("expected %s, got %s", tc.expectRes, res.Name)
+			}
+		})
+	}
+}
+
+func TestAcquireWithSelectorQueuesBySelector(t *testing.T) {
+	r := makeTestRanch([]runtime.Object{newResource("res", "t", common.Dirty, "", startTime)})
+	east, _ := labels.Parse("region=us-east-1")
+	west, _ := labels.Parse("region=us-west-1")
+	for _, selector := range []labels.Selector{east, west} {
+		// The request for the other selector does not rank ahead.
+		if _, _, err := r.AcquireWithSelector("t", common.Free, common.Busy, "owner", "first-"+selector.String(), selector, 0, 0, 0); !AreErrorsEqual(err, &ResourceNotFound{name: "t"}) {
+			t.Fatalf("expected no resource, got %v", err)
+		}
+	}
+	queue, err := r.Queue("t")
+	if err != nil {
+		t.Fatalf("failed to list the queue: %v", err)
+	}
+	if len(queue) != 2 || queue[0].Rank != 1 || queue[1].Rank != 1 {
+		t.Errorf("expected a queue of rank 1 per selector, got %+v", queue)
+	}
+}
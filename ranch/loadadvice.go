@@ -0,0 +1,80 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/crds"
+)
+
+// Bounds of the delay clients are advised to wait before retrying to acquire
+// an exhausted type. The minimum is the fixed delay clients used to retry at.
+const (
+	MinAdvisedRetry = 3 * time.Second
+	MaxAdvisedRetry = time.Minute
+)
+
+// LoadAdvice returns the utilization of rType in state for the clients which
+// failed to acquire one, along with how long they are advised to wait before
+// retrying, or nil if there is no resource of the type.
+// The advised delay is the expected time until the next release of the type,
+// stretched by the length of the queue relative to the pool, and within
+// MinAdvisedRetry and MaxAdvisedRetry. It is kept under half the request TTL
+// so that queued requests do not lose their rank by following it.
+func (r *Ranch) LoadAdvice(rType, state string) *common.LoadAdvice {
+	advice := &common.LoadAdvice{Type: rType, State: state}
+	if err := r.Storage.ForEachResource(func(res *crds.ResourceObject) error {
+		if res.Spec.Type != rType {
+			return nil
+		}
+		advice.Total++
+		if res.Status.State == state && res.Status.Owner == "" {
+			advice.Available++
+		}
+		return nil
+	}); err != nil {
+		logrus.WithError(err).Error("cannot get resources")
+		return nil
+	}
+	if advice.Total == 0 {
+		return nil
+	}
+	advice.Pressure = float64(advice.Total-advice.Available) / float64(advice.Total)
+	advice.QueueLength = len(r.requestMgr.list()[acquireRequestPriorityKey{rType: rType, state: state}])
+
+	retry := MinAdvisedRetry
+	if interval, ok := r.churn.estimateWait(rType, state, 1); ok && interval > retry {
+		retry = interval
+	}
+	retry += time.Duration(advice.QueueLength) * retry / time.Duration(advice.Total)
+	max := MaxAdvisedRetry
+	if ttl := r.requestMgr.TTL() / 2; ttl > 0 && ttl < max {
+		max = ttl
+	}
+	if retry > max {
+		retry = max
+	}
+	if retry < MinAdvisedRetry {
+		retry = MinAdvisedRetry
+	}
+	advice.RetryAfterSeconds = retry.Seconds()
+	return advice
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+func TestLoadAdvice(t *testing.T) {
+	pool := []runtime.Object{
+		newResource("free", "t", common.Free, "", startTime),
+		newResource("busy-1", "t", common.Busy, "owner", startTime),
+		newResource("busy-2", "t", common.Busy, "owner", startTime),
+		newResource("dirty", "t", common.Dirty, "", startTime),
+		newResource("other", "u", common.Free, "", startTime),
+	}
+	testCases := []struct {
+		name            string
+		resources       []runtime.Object
+		releaseInterval time.Duration
+		queued          int
+		ttl             time.Duration
+		expected        *common.LoadAdvice
+	}{
+		{
+			name: "no resource of the type",
+		},
+		{
+			name:      "no release history",
+			resources: pool,
+			ttl:       time.Hour,
+			expected:  &common.LoadAdvice{Type: "t", State: common.Free, Pressure: 0.75, Available: 1, Total: 4, RetryAfterSeconds: 3},
+		},
+		{
+			name:            "retry at the next expected release",
+			resources:       pool,
+			releaseInterval: 20 * time.Second,
+			ttl:             time.Hour,
+			expected:        &common.LoadAdvice{Type: "t", State: common.Free, Pressure: 0.75, Available: 1, Total: 4, RetryAfterSeconds: 20},
+		},
+		{
+			name:            "long queues back off further",
+			resources:       pool,
+			releaseInterval: 20 * time.Second,
+			queued:          4,
+			ttl:             time.Hour,
+			expected:        &common.LoadAdvice{Type: "t", State: common.Free, Pressure: 0.75, Available: 1, Total: 4, QueueLength: 4, RetryAfterSeconds: 40},
+		},
+		{
+			name:            "capped by the maximum",
+			resources:       pool,
+			releaseInterval: 10 * time.Minute,
+			ttl:             time.Hour,
+			expected:        &common.LoadAdvice{Type: "t", State: common.Free, Pressure: 0.75, Available: 1, Total: 4, RetryAfterSeconds: 60},
+		},
+		{
+			name:            "capped by half the request TTL",
+			resources:       pool,
+			releaseInterval: 20 * time.Second,
+			ttl:             30 * time.Second,
+			expected:        &common.LoadAdvice{Type: "t", State: common.Free, Pressure: 0.75, Available: 1, Total: 4, RetryAfterSeconds: 15},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := makeTestRanch(tc.resources)
+			r.requestMgr.ttl = tc.ttl
+			if tc.releaseInterval > 0 {
+				for i := 0; i <= minChurnSamples; i++ {
+					r.churn.observeRelease("t", common.Free, startTime.Add(time.Duration(i)*tc.releaseInterval))
+				}
+			}
+			for i := 0; i < tc.queued; i++ {
+				r.requestMgr.GetPriorityRank(acquireRequestPriorityKey{rType: "t", state: common.Free}, fmt.Sprintf("request-%d", i), 0)
+			}
+			if advice := r.LoadAdvice("t", common.Free); !reflect.DeepEqual(advice, tc.expected) {
+				t.Errorf("expected advice %+v, got %+v", tc.expected, advice)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+// LockHeld will be returned if a lock is requested while another owner holds it.
+type LockHeld struct {
+	name   string
+	holder string
+}
+
+func (l LockHeld) Error() string {
+	return fmt.Sprintf("lock %s is held by %s", l.name, l.holder)
+}
+
+// locksStateKey is the key of the locks in the StatePersistence.
+const locksStateKey = "locks"
+
+// lockManager holds the named locks taken by cleanup components and other
+// tools that must not run concurrently, by tenant and name.
+type lockManager struct {
+	lock  sync.Mutex
+	locks map[lockKey]common.Lock
+}
+
+// lockKey names a lock of a tenant, so that tenants never contend for, nor
+// release, the locks of each other.
+type lockKey struct {
+	tenant, name string
+}
+
+func newLockManager() *lockManager {
+	return &lockManager{locks: map[lockKey]common.Lock{}}
+}
+
+// replace replaces the locks with persisted ones. The caller must hold the
+// lock.
+func (m *lockManager) replace(locks []common.Lock) {
+	m.locks = map[lockKey]common.Lock{}
+	for _, l := range locks {
+		m.locks[lockKey{tenant: l.Tenant, name: l.Name}] = l
+	}
+}
+
+// held returns the locks of every tenant which did not expire by now. The
+// caller must hold the lock.
+func (m *lockManager) held(now time.Time) []common.Lock {
+	var locks []common.Lock
+	for key, l := range m.locks {
+		if !now.Before(l.Expires) {
+			delete(m.locks, key)
+			continue
+		}
+		locks = append(locks, l)
+	}
+	sort.Slice(locks, func(i, j int) bool {
+		if locks[i].Tenant != locks[j].Tenant {
+			return locks[i].Tenant < locks[j].Tenant
+		}
+		return locks[i].Name < locks[j].Name
+	})
+	return locks
+}
+
+// changeLocks applies fn to the locks, on top of the persisted ones if they
+// are persisted, so that a new leader never hands out the locks held through
+// the previous one. The caller must hold the lock.
+func (r *Ranch) changeLocks(fn func() error) error {
+	if r.persistence == nil {
+		return fn()
+	}
+	var locks []common.Lock
+	return changeState(r.Storage.ctx, r.persistence, locksStateKey, &locks, func() error {
+		r.locks.replace(locks)
+		if err := fn(); err != nil {
+			return err
+		}
+		locks = r.locks.held(r.now().Time)
+		return nil
+	})
+}
+
+// AcquireLock takes the named lock for owner until ttl elapses, or extends it
+// if owner already holds it. Holders renew the lock by acquiring it again well
+// within ttl. Unless the ranch persists its state, locks are kept in memory
+// and lost when boskos restarts, so deployments relying on them, and those
+// with leader election in particular, must persist them, see
+// SetStatePersistence. The lock is one of the tenant of r.
+// Out: The lock on success, or
+//      LockHeld error if another owner holds the lock.
+func (r *Ranch) AcquireLock(name, owner string, ttl time.Duration) (common.Lock, error) {
+	now := r.now().Time
+	r.locks.lock.Lock()
+	defer r.locks.lock.Unlock()
+	key := lockKey{tenant: r.tenant, name: name}
+	var l common.Lock
+	err := r.changeLocks(func() error {
+		if held, ok := r.locks.locks[key]; ok && held.Owner != owner && now.Before(held.Expires) {
+			return &LockHeld{name: name, holder: held.Owner}
+		}
+		l = common.Lock{Name: name, Owner: owner, Tenant: r.tenant, Expires: now.Add(ttl)}
+		r.locks.locks[key] = l
+		return nil
+	})
+	if err != nil {
+		return common.Lock{}, err
+	}
+	return l, nil
+}
+
+// ReleaseLock releases the named lock of the tenant of r held by owner.
+// Releasing a lock that is not held, or that expired, is a no-op.
+// Out: nil on success, or
+//      OwnerNotMatch error if another owner holds the lock.
+func (r *Ranch) ReleaseLock(name, owner string) error {
+	now := r.now().Time
+	r.locks.lock.Lock()
+	defer r.locks.lock.Unlock()
+	key := lockKey{tenant: r.tenant, name: name}
+	return r.changeLocks(func() error {
+		l, ok := r.locks.locks[key]
+		if ok && now.Before(l.Expires) && l.Owner != owner {
+			return &OwnerNotMatch{request: owner, owner: l.Owner}
+		}
+		delete(r.locks.locks, key)
+		return nil
+	})
+}
+
+// Locks returns the locks of the tenant of r currently held, sorted by name.
+func (r *Ranch) Locks() []common.Lock {
+	now := r.now().Time
+	r.locks.lock.Lock()
+	defer r.locks.lock.Unlock()
+	if r.persistence != nil {
+		var persisted []common.Lock
+		if _, err := loadState(r.Storage.ctx, r.persistence, locksStateKey, &persisted); err != nil {
+			logrus.WithError(err).Warning("Failed to load the persisted locks, listing the ones loaded before")
+		} else {
+			r.locks.replace(persisted)
+		}
+	}
+	var locks []common.Lock
+	for _, l := range r.locks.held(now) {
+		if l.Tenant == r.tenant {
+			locks = append(locks, l)
+		}
+	}
+	return locks
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakectrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestLocks(t *testing.T) {
+	testCases := []struct {
+		name          string
+		owner         string
+		elapsed       time.Duration
+		expectErr     error
+		expectRelease error
+	}{
+		{
+			name:  "renewed by the holder",
+			owner: "holder",
+		},
+		{
+			name:          "requested by another owner",
+			owner:         "someone",
+			elapsed:       30 * time.Second,
+			expectErr:     &LockHeld{name: "lock", holder: "holder"},
+			expectRelease: &OwnerNotMatch{request: "someone", owner: "holder"},
+		},
+		{
+			name:    "requested by another owner after expiry",
+			owner:   "someone",
+			elapsed: 2 * time.Minute,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := makeTestRanch(nil)
+			now := fakeNow.Time
+			r.now = func() metav1.Time { return metav1.Time{Time: now} }
+
+			if _, err := r.AcquireLock("lock", "holder", time.Minute); err != nil {
+				t.Fatalf("failed to acquire lock: %v", err)
+			}
+			now = now.Add(tc.elapsed)
+			lock, err := r.AcquireLock("lock", tc.owner, time.Minute)
+			if !AreErrorsEqual(err, tc.expectErr) {
+				t.Fatalf("expected error %v, got %v", tc.expectErr, err)
+			}
+			if err == nil && (lock.Owner != tc.owner || !lock.Expires.Equal(now.Add(time.Minute))) {
+				t.Errorf("expected the lock to be held by %s until %v, got %+v", tc.owner, now.Add(time.Minute), lock)
+			}
+			if err := r.ReleaseLock("lock", tc.owner); !AreErrorsEqual(err, tc.expectRelease) {
+				t.Errorf("expected release error %v, got %v", tc.expectRelease, err)
+			}
+			if locks := r.Locks(); (len(locks) == 1) != (tc.expectRelease != nil) {
+				t.Errorf("expected the lock to be released only by its holder, got %v", locks)
+			}
+		})
+	}
+}
+
+func TestLocksOfTenants(t *testing.T) {
+	r := makeTestRanch(nil)
+	if _, err := r.ForTenant("team-a").AcquireLock("lock", "holder", time.Minute); err != nil {
+		t.Fatalf("failed to acquire lock: %v", err)
+	}
+	if _, err := r.ForTenant("team-b").AcquireLock("lock", "someone", time.Minute); err != nil {
+		t.Errorf("expected tenants to have their own locks, got %v", err)
+	}
+	if err := r.ForTenant("team-b").ReleaseLock("lock", "someone"); err != nil {
+		t.Errorf("failed to release lock: %v", err)
+	}
+	if locks := r.ForTenant("team-a").Locks(); len(locks) != 1 || locks[0].Owner != "holder" || locks[0].Tenant != "team-a" {
+		t.Errorf("expected the lock of team-a to be held, got %v", locks)
+	}
+	if locks := r.Locks(); len(locks) != 0 {
+		t.Errorf("expected the locks of tenants not to be listed without tenant, got %v", locks)
+	}
+}
+
+func TestLocksPersisted(t *testing.T) {
+	persistence := NewConfigMapStatePersistence(fakectrlruntimeclient.NewFakeClient(), testNS, "boskos-state")
+	leader := makeTestRanch(nil)
+	leader.SetStatePersistence(persistence)
+	if _, err := leader.AcquireLock("lock", "holder", time.Minute); err != nil {
+		t.Fatalf("failed to acquire lock: %v", err)
+	}
+
+	// The next leader, e.g. after a failover, keeps the lock for its holder.
+	successor := makeTestRanch(nil)
+	successor.SetStatePersistence(persistence)
+	expectErr := &LockHeld{name: "lock", holder: "holder"}
+	if _, err := successor.AcquireLock("lock", "someone", time.Minute); !AreErrorsEqual(err, expectErr) {
+		t.Errorf("expected error %v, got %v", expectErr, err)
+	}
+	if locks := successor.Locks(); len(locks) != 1 || locks[0].Owner != "holder" {
+		t.Errorf("expected the lock to be held by holder, got %v", locks)
+	}
+	if err := successor.ReleaseLock("lock", "holder"); err != nil {
+		t.Fatalf("failed to release lock: %v", err)
+	}
+	if _, err := leader.AcquireLock("lock", "someone", time.Minute); err != nil {
+		t.Errorf("expected the released lock to be acquired, got %v", err)
+	}
+}
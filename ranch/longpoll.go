@@ -0,0 +1,74 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"context"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"sigs.k8s.io/boskos/crds"
+)
+
+// MaxAcquireWait bounds how long AcquireWait blocks, so long polls do not
+// outlive proxies and load balancers between clients and boskos.
+const MaxAcquireWait = 5 * time.Minute
+
+// acquireWaitRecheckPeriod is how often AcquireWait tries again when the
+// resources of the type do not change, e.g. to renew its rank in the queue
+// and to notice when it comes first after another request expired.
+var acquireWaitRecheckPeriod = 5 * time.Second
+
+// AcquireWait is like AcquireWithSelector, but blocks for up to timeout, at
+// most MaxAcquireWait, until a resource becomes available or ctx is done,
+// instead of failing right away with a ResourceNotFound error. It tries again
+// whenever a resource of the type changes state or owner, so clients are not
+// left polling.
+func (r *Ranch) AcquireWait(ctx context.Context, rType, state, dest, owner, requestID string, selector labels.Selector, priority int, maxWait, lease, timeout time.Duration) (*crds.ResourceObject, metav1.Time, error) {
+	if timeout > MaxAcquireWait {
+		timeout = MaxAcquireWait
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	// Watching before trying does not miss the changes in between.
+	events, stop := r.Watch(rType)
+	defer func() { stop() }()
+	recheck := time.NewTicker(acquireWaitRecheckPeriod)
+	defer recheck.Stop()
+	for {
+		res, createdTime, err := r.acquire(rType, state, dest, owner, requestID, "", selector, priority, maxWait, 0, lease)
+		switch err.(type) {
+		case *ResourceNotFound, *ApprovalPending:
+			// Approvals are only rechecked periodically, as deciding them does
+			// not change any resource.
+		default:
+			return res, createdTime, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, createdTime, err
+		case <-recheck.C:
+		case _, ok := <-events:
+			if !ok {
+				// Dropped for lagging behind, which a retry catches up with.
+				events, stop = r.Watch(rType)
+			}
+		}
+	}
+}
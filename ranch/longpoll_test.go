@@ -0,0 +1,83 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+func TestAcquireWait(t *testing.T) {
+	// Only changes of the resources wake the waiters up.
+	defer func(period time.Duration) { acquireWaitRecheckPeriod = period }(acquireWaitRecheckPeriod)
+	acquireWaitRecheckPeriod = time.Hour
+
+	testCases := []struct {
+		name      string
+		release   bool
+		expectErr error
+	}{
+		{
+			name:    "resource released while waiting",
+			release: true,
+		},
+		{
+			name:      "timed out",
+			expectErr: &ResourceNotFound{name: "t"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := makeTestRanch([]runtime.Object{newResource("res", "t", common.Busy, "other", startTime)})
+			if tc.release {
+				go func() {
+					// Released once the waiter is likely watching, which it
+					// does before its first try.
+					time.Sleep(10 * time.Millisecond)
+					if err := r.Release("res", common.Free, "other"); err != nil {
+						t.Errorf("failed to release: %v", err)
+					}
+				}()
+			}
+			res, _, err := r.AcquireWait(context.Background(), "t", common.Free, common.Busy, "owner", "", nil, 0, 0, 0, 100*time.Millisecond)
+			if !AreErrorsEqual(err, tc.expectErr) {
+				t.Fatalf("expected error %v, got %v", tc.expectErr, err)
+			}
+			if err == nil && (res.Name != "res" || res.Status.Owner != "owner") {
+				t.Errorf("expected res to be acquired by owner, got %s owned by %s", res.Name, res.Status.Owner)
+			}
+		})
+	}
+}
+
+func TestAcquireWaitStopsWithContext(t *testing.T) {
+	r := makeTestRanch([]runtime.Object{newResource("res", "t", common.Busy, "other", startTime)})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	if _, _, err := r.AcquireWait(ctx, "t", common.Free, common.Busy, "owner", "", nil, 0, 0, 0, time.Minute); !AreErrorsEqual(err, &ResourceNotFound{name: "t"}) {
+		t.Errorf("expected no resource, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("expected to return with the context, returned after %v", elapsed)
+	}
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/client-go/util/retry"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+// migrateUserData applies the user data migrations of the config to the
+// resources they were not applied to yet. Resources are only migrated while
+// unowned, so migrations do not race with the updates of their owner; owned
+// resources are migrated by the first sync after their release.
+func (r *Ranch) migrateUserData(config *common.BoskosConfig) error {
+	migrations := map[string][]common.UserDataMigration{}
+	for _, entry := range config.Resources {
+		if len(entry.UserDataMigrations) > 0 {
+			migrations[entry.Type] = entry.UserDataMigrations
+		}
+	}
+	if len(migrations) == 0 {
+		return nil
+	}
+	resources, err := r.Storage.GetResources()
+	if err != nil {
+		return err
+	}
+	var failed int
+	for idx := range resources.Items {
+		res := resources.Items[idx]
+		pending := pendingMigrations(migrations[res.Spec.Type], res.Status.UserDataVersion)
+		if len(pending) == 0 || res.Status.Owner != "" {
+			continue
+		}
+		if err := retryOnConflict(retry.DefaultBackoff, func() error {
+			current, err := r.Storage.GetResource(res.Name)
+			if err != nil {
+				return err
+			}
+			if current.Status.Owner != "" {
+				return nil
+			}
+			pending := pendingMigrations(migrations[current.Spec.Type], current.Status.UserDataVersion)
+			if len(pending) == 0 {
+				return nil
+			}
+			if current.Status.UserData == nil {
+				current.Status.UserData = map[string]string{}
+			}
+			for _, m := range pending {
+				m.Apply(current.Status.UserData)
+			}
+			current.Status.UserDataVersion = pending[len(pending)-1].Version
+			_, err = r.Storage.UpdateResource(current)
+			return err
+		}); err != nil {
+			logrus.WithError(err).Errorf("Failed to migrate the user data of resource %s", res.Name)
+			failed++
+			continue
+		}
+		logrus.Infof("Migrated the user data of resource %s to version %d", res.Name, pending[len(pending)-1].Version)
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to migrate the user data of %d resources", failed)
+	}
+	return nil
+}
+
+// pendingMigrations returns the migrations newer than version.
+func pendingMigrations(migrations []common.UserDataMigration, version int) []common.UserDataMigration {
+	for idx, m := range migrations {
+		if m.Version > version {
+			return migrations[idx:]
+		}
+	}
+	return nil
+}
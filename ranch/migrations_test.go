@@ -0,0 +1,78 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+func TestMigrateUserData(t *testing.T) {
+	free := newResource("res-1", "t", common.Free, "", startTime)
+	free.Status.UserData = map[string]string{"old": "value"}
+	busy := newResource("res-2", "t", common.Busy, "owner", startTime)
+	busy.Status.UserData = map[string]string{"old": "value"}
+	r := makeTestRanch([]runtime.Object{free, busy})
+
+	config := func(migrations ...common.UserDataMigration) *common.BoskosConfig {
+		return &common.BoskosConfig{Resources: []common.ResourceEntry{{
+			Type:               "t",
+			State:              common.Free,
+			Names:              []string{"res-1", "res-2"},
+			UserDataMigrations: migrations,
+		}}}
+	}
+	rename := common.UserDataMigration{Version: 1, Op: common.RenameUserData, Key: "old", To: "new"}
+	setDefault := common.UserDataMigration{Version: 2, Op: common.SetDefaultUserData, Key: "region", Value: "us-east1"}
+	expect := func(name string, version int, userData map[string]string) {
+		t.Helper()
+		res, err := r.Storage.GetResource(name)
+		if err != nil {
+			t.Fatalf("failed to get resource: %v", err)
+		}
+		if res.Status.UserDataVersion != version || !reflect.DeepEqual(res.Status.UserData, userData) {
+			t.Errorf("expected %s at version %d with %v, got version %d with %v", name, version, userData, res.Status.UserDataVersion, res.Status.UserData)
+		}
+	}
+
+	if err := r.ApplyConfig(config(rename, setDefault)); err != nil {
+		t.Fatalf("failed to apply config: %v", err)
+	}
+	expect("res-1", 2, map[string]string{"new": "value", "region": "us-east1"})
+	expect("res-2", 0, map[string]string{"old": "value"})
+
+	// Owned resources are migrated once released.
+	if err := r.Release("res-2", common.Free, "owner"); err != nil {
+		t.Fatalf("failed to release: %v", err)
+	}
+	if err := r.ApplyConfig(config(rename, setDefault)); err != nil {
+		t.Fatalf("failed to apply config: %v", err)
+	}
+	expect("res-2", 2, map[string]string{"new": "value", "region": "us-east1"})
+
+	// Applied migrations may be dropped from the config, and are not applied
+	// again.
+	drop := common.UserDataMigration{Version: 3, Op: common.DropUserData, Key: "new"}
+	if err := r.ApplyConfig(config(drop)); err != nil {
+		t.Fatalf("failed to apply config: %v", err)
+	}
+	expect("res-1", 3, map[string]string{"region": "us-east1"})
+}
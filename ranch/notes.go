@@ -0,0 +1,47 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"github.com/sirupsen/logrus"
+	"k8s.io/client-go/util/retry"
+
+	"sigs.k8s.io/boskos/crds"
+)
+
+// maxNotes bounds the notes kept about a resource. The oldest notes are
+// dropped first.
+const maxNotes = 50
+
+// AddNote attaches a note of author to the resource called name. Notes do not
+// count as an update of the resource, so they don't renew its lease.
+// Out: nil on success, or
+//      ResourceNotFound error if target named resource does not exist.
+func (r *Ranch) AddNote(name, author, text string) error {
+	return retryOnConflict(retry.DefaultBackoff, func() error {
+		res, err := r.Storage.GetResource(name)
+		if err != nil {
+			logrus.WithError(err).Errorf("could not find resource %s to add a note to", name)
+			return &ResourceNotFound{name: name}
+		}
+		res.Status.Notes = append(res.Status.Notes, crds.Note{Author: author, Text: text, Time: r.now()})
+		if excess := len(res.Status.Notes) - maxNotes; excess > 0 {
+			res.Status.Notes = res.Status.Notes[excess:]
+		}
+		return r.Storage.updateResourceKeepingLastUpdate(res)
+	})
+}
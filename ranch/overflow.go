@@ -0,0 +1,143 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"context"
+	"encoding/json"
+
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// overflowKey is the key of the overflowing values in the Secrets and
+	// ConfigMaps, as JSON.
+	overflowKey = "userdata"
+	// OverflowLabel holds the name of the resource on the Secrets and
+	// ConfigMaps of its overflowing user data.
+	OverflowLabel = "boskos.k8s.io/userdata-of"
+)
+
+// kubeUserDataOverflow stores each version of the overflowing values of a
+// resource in an object named after them.
+type kubeUserDataOverflow struct {
+	client    ctrlruntimeclient.Client
+	namespace string
+	// newObject and newList return an empty object, and list, of the kind
+	// storing the values.
+	newObject func() ctrlruntimeclient.Object
+	newList   func() ctrlruntimeclient.ObjectList
+	// get and set access the values of the object.
+	get func(ctrlruntimeclient.Object) []byte
+	set func(ctrlruntimeclient.Object, []byte)
+}
+
+// NewSecretUserDataOverflow returns a UserDataOverflow storing the values in
+// Secrets of namespace, which suits credentials like kubeconfigs.
+func NewSecretUserDataOverflow(client ctrlruntimeclient.Client, namespace string) UserDataOverflow {
+	return &kubeUserDataOverflow{
+		client:    client,
+		namespace: namespace,
+		newObject: func() ctrlruntimeclient.Object { return &corev1.Secret{} },
+		newList:   func() ctrlruntimeclient.ObjectList { return &corev1.SecretList{} },
+		get:       func(o ctrlruntimeclient.Object) []byte { return o.(*corev1.Secret).Data[overflowKey] },
+		set: func(o ctrlruntimeclient.Object, raw []byte) {
+			o.(*corev1.Secret).Data = map[string][]byte{overflowKey: raw}
+		},
+	}
+}
+
+// NewConfigMapUserDataOverflow returns a UserDataOverflow storing the values
+// in ConfigMaps of namespace.
+func NewConfigMapUserDataOverflow(client ctrlruntimeclient.Client, namespace string) UserDataOverflow {
+	return &kubeUserDataOverflow{
+		client:    client,
+		namespace: namespace,
+		newObject: func() ctrlruntimeclient.Object { return &corev1.ConfigMap{} },
+		newList:   func() ctrlruntimeclient.ObjectList { return &corev1.ConfigMapList{} },
+		get:       func(o ctrlruntimeclient.Object) []byte { return o.(*corev1.ConfigMap).BinaryData[overflowKey] },
+		set: func(o ctrlruntimeclient.Object, raw []byte) {
+			o.(*corev1.ConfigMap).BinaryData = map[string][]byte{overflowKey: raw}
+		},
+	}
+}
+
+func (o *kubeUserDataOverflow) key(resource, version string) types.NamespacedName {
+	return types.NamespacedName{Namespace: o.namespace, Name: "boskos-userdata-" + resource + "-" + version}
+}
+
+func (o *kubeUserDataOverflow) Store(ctx context.Context, resource, version string, values map[string]string) error {
+	raw, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	key := o.key(resource, version)
+	obj := o.newObject()
+	obj.SetNamespace(key.Namespace)
+	obj.SetName(key.Name)
+	obj.SetLabels(map[string]string{OverflowLabel: resource})
+	o.set(obj, raw)
+	// The values of a version never change, so an existing object holds them.
+	if err := o.client.Create(ctx, obj); err != nil && !kerrors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
+
+func (o *kubeUserDataOverflow) Load(ctx context.Context, resource, version string) (map[string]string, error) {
+	obj := o.newObject()
+	if err := o.client.Get(ctx, o.key(resource, version), obj); err != nil {
+		if kerrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	values := map[string]string{}
+	if raw := o.get(obj); len(raw) > 0 {
+		if err := json.Unmarshal(raw, &values); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// Prune lists the objects by their label, so that the versions left behind,
+// e.g. by failed updates or before a restart, are pruned too.
+func (o *kubeUserDataOverflow) Prune(ctx context.Context, resource, keep string) error {
+	list := o.newList()
+	if err := o.client.List(ctx, list, ctrlruntimeclient.InNamespace(o.namespace), ctrlruntimeclient.MatchingLabels{OverflowLabel: resource}); err != nil {
+		return err
+	}
+	objects, err := meta.ExtractList(list)
+	if err != nil {
+		return err
+	}
+	for _, item := range objects {
+		obj, ok := item.(ctrlruntimeclient.Object)
+		if !ok || (keep != "" && obj.GetName() == o.key(resource, keep).Name) {
+			continue
+		}
+		if err := o.client.Delete(ctx, obj); err != nil && !kerrors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
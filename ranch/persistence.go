@@ -0,0 +1,134 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// stateKey is the key of the persisted state in its ConfigMap, as JSON.
+const stateKey = "state"
+
+// StatePersistence stores the state the ranch keeps besides the resources,
+// like the locks and the open cleanup breakers, so that it survives restarts and the failovers of the
+// leader.
+type StatePersistence interface {
+	// LoadState returns the state persisted under key, as JSON, and its
+	// version. A state never saved is empty.
+	LoadState(ctx context.Context, key string) ([]byte, string, error)
+	// SaveState replaces the state persisted under key at version, and
+	// returns a conflict error of the Kubernetes API if it changed since.
+	SaveState(ctx context.Context, key string, raw []byte, version string) error
+}
+
+// SetStatePersistence persists the state the ranch keeps besides the
+// resources with persistence. It must be called before the ranch starts
+// serving requests.
+func (r *Ranch) SetStatePersistence(persistence StatePersistence) {
+	r.persistence = persistence
+}
+
+// loadState decodes the state persisted under key into v, and returns its
+// version.
+func loadState(ctx context.Context, persistence StatePersistence, key string, v interface{}) (string, error) {
+	raw, version, err := persistence.LoadState(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	// A state never saved resets v, as does null.
+	if len(raw) == 0 {
+		raw = []byte("null")
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return "", fmt.Errorf("invalid %s state: %w", key, err)
+	}
+	return version, nil
+}
+
+// changeState loads the state persisted under key into v, applies fn to it
+// and saves it, retrying on top of the latest state when it changed
+// meanwhile.
+func changeState(ctx context.Context, persistence StatePersistence, key string, v interface{}, fn func() error) error {
+	return retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		version, err := loadState(ctx, persistence, key, v)
+		if err != nil {
+			return err
+		}
+		if err := fn(); err != nil {
+			return err
+		}
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		return persistence.SaveState(ctx, key, raw, version)
+	})
+}
+
+// configMapStatePersistence persists each state in a ConfigMap of its own.
+type configMapStatePersistence struct {
+	client    ctrlruntimeclient.Client
+	namespace string
+	prefix    string
+}
+
+// NewConfigMapStatePersistence returns a StatePersistence storing the state
+// under each key in the ConfigMap named prefix-key of namespace, which is
+// created when the state is first saved.
+func NewConfigMapStatePersistence(client ctrlruntimeclient.Client, namespace, prefix string) StatePersistence {
+	return &configMapStatePersistence{client: client, namespace: namespace, prefix: prefix}
+}
+
+func (p *configMapStatePersistence) key(key string) types.NamespacedName {
+	return types.NamespacedName{Namespace: p.namespace, Name: p.prefix + "-" + key}
+}
+
+func (p *configMapStatePersistence) LoadState(ctx context.Context, key string) ([]byte, string, error) {
+	cm := &corev1.ConfigMap{}
+	if err := p.client.Get(ctx, p.key(key), cm); err != nil {
+		if kerrors.IsNotFound(err) {
+			return nil, "", nil
+		}
+		return nil, "", err
+	}
+	return []byte(cm.Data[stateKey]), cm.ResourceVersion, nil
+}
+
+func (p *configMapStatePersistence) SaveState(ctx context.Context, key string, raw []byte, version string) error {
+	name := p.key(key)
+	cm := &corev1.ConfigMap{Data: map[string]string{stateKey: string(raw)}}
+	cm.Namespace, cm.Name = name.Namespace, name.Name
+	if version == "" {
+		err := p.client.Create(ctx, cm)
+		if kerrors.IsAlreadyExists(err) {
+			// Another replica created it meanwhile.
+			return kerrors.NewConflict(schema.GroupResource{Resource: "configmaps"}, name.Name, err)
+		}
+		return err
+	}
+	cm.ResourceVersion = version
+	return p.client.Update(ctx, cm)
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+// PolicyDenied will be returned if the policy of a type does not allow the
+// caller to act on its resources.
+type PolicyDenied struct {
+	action    string
+	rType     string
+	principal string
+}
+
+func (p PolicyDenied) Error() string {
+	return fmt.Sprintf("%q may not %s resources of type %s", p.principal, p.action, p.rType)
+}
+
+// typePolicy is the compiled common.TypePolicy of a type. Nil entries allow
+// anyone.
+type typePolicy struct {
+	acquirers []*regexp.Regexp
+	resetters []*regexp.Regexp
+}
+
+// policyManager holds the policies of the types.
+type policyManager struct {
+	lock     sync.RWMutex
+	policies map[string]typePolicy
+}
+
+func newPolicyManager() *policyManager {
+	return &policyManager{policies: map[string]typePolicy{}}
+}
+
+func compilePolicyEntries(rType string, patterns []string) []*regexp.Regexp {
+	if patterns == nil {
+		return nil
+	}
+	compiled := []*regexp.Regexp{}
+	for _, pattern := range patterns {
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			// Not expected, the config was validated.
+			logrus.WithError(err).Errorf("invalid policy entry %q for type %s", pattern, rType)
+			continue
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled
+}
+
+func (p *policyManager) set(config *common.BoskosConfig) {
+	policies := map[string]typePolicy{}
+	for _, entry := range config.Resources {
+		if entry.Policy == nil {
+			continue
+		}
+		policies[entry.Type] = typePolicy{
+			acquirers: compilePolicyEntries(entry.Type, entry.Policy.Acquirers),
+			resetters: compilePolicyEntries(entry.Type, entry.Policy.Resetters),
+		}
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.policies = policies
+}
+
+func (p *policyManager) allows(action, rType, principal string) error {
+	p.lock.RLock()
+	policy, ok := p.policies[rType]
+	p.lock.RUnlock()
+	if !ok {
+		return nil
+	}
+	entries := policy.acquirers
+	if action == "reset" {
+		entries = policy.resetters
+	}
+	if entries == nil {
+		return nil
+	}
+	for _, re := range entries {
+		if re.MatchString(principal) {
+			return nil
+		}
+	}
+	return &PolicyDenied{action: action, rType: rType, principal: principal}
+}
+
+// MayAcquire returns a PolicyDenied error unless the policy of rType allows
+// principal, the name of the caller or the owner it claims, to acquire its
+// resources.
+func (r *Ranch) MayAcquire(rType, principal string) error {
+	return r.policies.allows("acquire", rType, principal)
+}
+
+// MayReset returns a PolicyDenied error unless the policy of rType allows
+// principal to reset its resources.
+func (r *Ranch) MayReset(rType, principal string) error {
+	return r.policies.allows("reset", rType, principal)
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"testing"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+func TestPolicies(t *testing.T) {
+	r := makeTestRanch(nil)
+	if err := r.ApplyConfig(&common.BoskosConfig{Resources: []common.ResourceEntry{
+		{Type: "open", State: common.Free, Names: []string{"open-1"}},
+		{Type: "guarded", State: common.Free, Names: []string{"guarded-1"}, Policy: &common.TypePolicy{
+			Acquirers: []string{"team-a-.*", "system:serviceaccount:ci:.*"},
+			Resetters: []string{"reaper"},
+		}},
+		{Type: "locked", State: common.Free, Names: []string{"locked-1"}, Policy: &common.TypePolicy{
+			Acquirers: []string{},
+		}},
+	}}); err != nil {
+		t.Fatalf("failed to apply config: %v", err)
+	}
+
+	testCases := []struct {
+		name      string
+		check     func(rType, principal string) error
+		rType     string
+		principal string
+		expected  error
+	}{
+		{
+			name:      "types without policy are open",
+			check:     r.MayAcquire,
+			rType:     "open",
+			principal: "anyone",
+		},
+		{
+			name:      "matching owner acquires",
+			check:     r.MayAcquire,
+			rType:     "guarded",
+			principal: "team-a-job",
+		},
+		{
+			name:      "matching service account acquires",
+			check:     r.MayAcquire,
+			rType:     "guarded",
+			principal: "system:serviceaccount:ci:default",
+		},
+		{
+			name:      "entries match the whole name",
+			check:     r.MayAcquire,
+			rType:     "guarded",
+			principal: "not-team-a-job",
+			expected:  &PolicyDenied{action: "acquire", rType: "guarded", principal: "not-team-a-job"},
+		},
+		{
+			name:      "acquirers may not reset",
+			check:     r.MayReset,
+			rType:     "guarded",
+			principal: "team-a-job",
+			expected:  &PolicyDenied{action: "reset", rType: "guarded", principal: "team-a-job"},
+		},
+		{
+			name:      "resetter resets",
+			check:     r.MayReset,
+			rType:     "guarded",
+			principal: "reaper",
+		},
+		{
+			name:      "empty entries allow nobody",
+			check:     r.MayAcquire,
+			rType:     "locked",
+			principal: "anyone",
+			expected:  &PolicyDenied{action: "acquire", rType: "locked", principal: "anyone"},
+		},
+		{
+			name:      "unset entries allow anyone",
+			check:     r.MayReset,
+			rType:     "locked",
+			principal: "anyone",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.check(tc.rType, tc.principal)
+			if tc.expected == nil {
+				if err != nil {
+					t.Errorf("expected no error, got %v", err)
+				}
+				return
+			}
+			if !AreErrorsEqual(err, tc.expected) {
+				t.Errorf("expected error %v, got %v", tc.expected, err)
+			}
+		})
+	}
+}
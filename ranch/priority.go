@@ -19,6 +19,7 @@ package ranch
 import (
 	"context"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
@@ -26,12 +27,43 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// DefaultPriorityAgingPeriod is how long a request waits for its priority to
+// be raised by one, so that low priority requests are not starved by a steady
+// stream of higher priority ones.
+const DefaultPriorityAgingPeriod = time.Minute
+
+// Reasons requests expire for.
+const (
+	// RequestExpiredTTL requests were not renewed within the request TTL.
+	RequestExpiredTTL = "ttl"
+	// RequestExpiredStale requests were not renewed within the stale period,
+	// and their owner did not heartbeat any of its leases since.
+	RequestExpiredStale = "stale"
+)
+
 // request stores request information with expiration
 type request struct {
-	id         string
+	id string
+	// owner is the requester, if known. It is used for listing and to find
+	// the heartbeats of the requester.
+	owner      string
 	expiration metav1.Time
 	// Used to calculate since when this resource has been acquired
 	createdAt metav1.Time
+	// lastSeen is when the request was last renewed.
+	lastSeen metav1.Time
+	// priority is given by the requester, higher priorities are served
+	// first. Requests of the same priority are served in FIFO order.
+	priority int
+}
+
+// effectivePriority is the priority of the request raised by one for every
+// agingPeriod it waited. A zero agingPeriod disables aging.
+func (req request) effectivePriority(agingPeriod time.Duration, now metav1.Time) int {
+	if agingPeriod <= 0 {
+		return req.priority
+	}
+	return req.priority + int(now.Sub(req.createdAt.Time)/agingPeriod)
 }
 
 type requestNode struct {
@@ -93,9 +125,9 @@ func newRequestQueue() *requestQueue {
 	}
 }
 
-// update updates expiration time is updated if already present,
+// update updates expiration time and priority if already present,
 // add a new requestID at the end otherwise (FIFO)
-func (rq *requestQueue) update(requestID string, newExpiration, now metav1.Time) bool {
+func (rq *requestQueue) update(requestID string, priority int, newExpiration, now metav1.Time) bool {
 	rq.lock.Lock()
 	defer rq.lock.Unlock()
 	req, exists := rq.requestMap[requestID]
@@ -106,11 +138,23 @@ func (rq *requestQueue) update(requestID string, newExpiration, now metav1.Time)
 	}
 	// Update timestamp
 	req.expiration = newExpiration
+	req.lastSeen = now
+	req.priority = priority
 	rq.requestMap[requestID] = req
 	logrus.Infof("request id %s set to expire at %v", requestID, newExpiration)
 	return !exists
 }
 
+// setOwner records the owner of an existing request.
+func (rq *requestQueue) setOwner(requestID, owner string) {
+	rq.lock.Lock()
+	defer rq.lock.Unlock()
+	if req, exists := rq.requestMap[requestID]; exists {
+		req.owner = owner
+		rq.requestMap[requestID] = req
+	}
+}
+
 // delete an element
 func (rq *requestQueue) delete(requestID string) {
 	rq.lock.Lock()
@@ -119,10 +163,12 @@ func (rq *requestQueue) delete(requestID string) {
 	rq.requestList.Delete(requestID)
 }
 
-// cleanup checks for all expired  or marked for deletion items and delete them.
-func (rq *requestQueue) cleanup(now metav1.Time) {
+// cleanup checks for all expired or stale items and delete them. It returns
+// the number of deleted items by reason. isStale may be nil.
+func (rq *requestQueue) cleanup(now metav1.Time, isStale func(request) bool) map[string]int {
 	rq.lock.Lock()
 	defer rq.lock.Unlock()
+	expired := map[string]int{}
 	newRequestList := &requestLinkedList{}
 	newRequestMap := map[string]request{}
 	rq.requestList.Range(func(requestID string) bool {
@@ -130,6 +176,12 @@ func (rq *requestQueue) cleanup(now metav1.Time) {
 		// Checking expiration
 		if now.After(req.expiration.Time) {
 			logrus.Infof("request id %s expired", req.id)
+			expired[RequestExpiredTTL]++
+			return true
+		}
+		if isStale != nil && isStale(req) {
+			logrus.Infof("request id %s is stale", req.id)
+			expired[RequestExpiredStale]++
 			return true
 		}
 		// Keeping
@@ -139,34 +191,83 @@ func (rq *requestQueue) cleanup(now metav1.Time) {
 	})
 	rq.requestMap = newRequestMap
 	rq.requestList = newRequestList
+	return expired
 }
 
 // getRank provides the rank of a given requestID following the order it was added (FIFO).
 // If requestID is an empty string, getRank assumes it is added last (lowest rank + 1).
 func (rq *requestQueue) getRank(requestID string, ttl time.Duration, now metav1.Time) (int, bool) {
+	return rq.getPriorityRank(requestID, 0, ttl, 0, now)
+}
+
+// getPriorityRank is getRank for a request of the given priority, which is
+// ranked after the requests of a higher effective priority only.
+func (rq *requestQueue) getPriorityRank(requestID string, priority int, ttl, agingPeriod time.Duration, now metav1.Time) (int, bool) {
 	// not considering empty requestID as new
 	var new bool
 	if requestID != "" {
-		new = rq.update(requestID, metav1.Time{Time: now.Add(ttl)}, now)
+		new = rq.update(requestID, priority, metav1.Time{Time: now.Add(ttl)}, now)
 	}
 	rank := 1
 	rq.lock.RLock()
 	defer rq.lock.RUnlock()
+	self := request{priority: priority, createdAt: now}
+	if requestID != "" {
+		self = rq.requestMap[requestID]
+	}
+	selfPriority := self.effectivePriority(agingPeriod, now)
+	// Requests before this one in the list, which were added earlier, are
+	// ranked ahead on equal priorities.
+	earlier := true
 	rq.requestList.Range(func(existingID string) bool {
 		req := rq.requestMap[existingID]
+		if requestID == existingID {
+			earlier = false
+			return true
+		}
 		if now.After(req.expiration.Time) {
 			logrus.Infof("request id %s expired", req.id)
 			return true
 		}
-		if requestID == existingID {
-			return false
+		if reqPriority := req.effectivePriority(agingPeriod, now); reqPriority > selfPriority || (earlier && reqPriority == selfPriority) {
+			rank++
 		}
-		rank++
 		return true
 	})
 	return rank, new
 }
 
+// list returns the requests that have not expired, in the order they are
+// served.
+func (rq *requestQueue) list(agingPeriod time.Duration, now metav1.Time) []request {
+	rq.lock.RLock()
+	defer rq.lock.RUnlock()
+	var requests []request
+	rq.requestList.Range(func(requestID string) bool {
+		if req := rq.requestMap[requestID]; !now.After(req.expiration.Time) {
+			requests = append(requests, req)
+		}
+		return true
+	})
+	sort.SliceStable(requests, func(i, j int) bool {
+		return requests[i].effectivePriority(agingPeriod, now) > requests[j].effectivePriority(agingPeriod, now)
+	})
+	return requests
+}
+
+// count returns the number of requests that have not expired.
+func (rq *requestQueue) count(now metav1.Time) int {
+	rq.lock.RLock()
+	defer rq.lock.RUnlock()
+	count := 0
+	for _, req := range rq.requestMap {
+		if !now.After(req.expiration.Time) {
+			count++
+		}
+	}
+	return count
+}
+
 func (rq *requestQueue) isEmpty() bool {
 	rq.lock.Lock()
 	defer rq.lock.Unlock()
@@ -180,6 +281,21 @@ type RequestManager struct {
 	ttl      time.Duration
 	stopGC   context.CancelFunc
 	wg       sync.WaitGroup
+	// configuredTTL and configuredGCPeriod override the TTL and the GC period
+	// the manager was started with, see SetTTL and SetGCPeriod.
+	configuredTTL      time.Duration
+	configuredGCPeriod time.Duration
+	gcPeriod           time.Duration
+	// gcPeriodChanged wakes the GC up to reset its ticker.
+	gcPeriodChanged chan struct{}
+	// staleAfter and heartbeats audit the requests, see SetStaleAfter.
+	staleAfter time.Duration
+	heartbeats func() (map[string]metav1.Time, error)
+	// expired counts the expired requests by reason.
+	expired map[string]int
+	// agingPeriod raises the priority of waiting requests, see
+	// SetPriorityAging.
+	agingPeriod time.Duration
 	// For testing only
 	now func() metav1.Time
 }
@@ -187,39 +303,148 @@ type RequestManager struct {
 // NewRequestManager creates a new RequestManager
 func NewRequestManager(ttl time.Duration) *RequestManager {
 	return &RequestManager{
-		requests: map[interface{}]*requestQueue{},
-		ttl:      ttl,
-		now:      metav1.Now,
+		requests:        map[interface{}]*requestQueue{},
+		ttl:             ttl,
+		gcPeriodChanged: make(chan struct{}, 1),
+		expired:         map[string]int{},
+		agingPeriod:     DefaultPriorityAgingPeriod,
+		now:             metav1.Now,
+	}
+}
+
+// SetTTL overrides the TTL the manager was created with, applying to the
+// requests renewed from now on. A zero ttl restores it.
+func (rp *RequestManager) SetTTL(ttl time.Duration) {
+	rp.lock.Lock()
+	defer rp.lock.Unlock()
+	rp.configuredTTL = ttl
+}
+
+// TTL returns how long requests keep their rank without being renewed.
+func (rp *RequestManager) TTL() time.Duration {
+	rp.lock.Lock()
+	defer rp.lock.Unlock()
+	return rp.currentTTL()
+}
+
+// currentTTL must be called with the lock held.
+func (rp *RequestManager) currentTTL() time.Duration {
+	if rp.configuredTTL > 0 {
+		return rp.configuredTTL
+	}
+	return rp.ttl
+}
+
+// SetGCPeriod overrides the period the GC was started with, live if it is
+// running. A zero gcPeriod restores it.
+func (rp *RequestManager) SetGCPeriod(gcPeriod time.Duration) {
+	rp.lock.Lock()
+	changed := rp.configuredGCPeriod != gcPeriod
+	rp.configuredGCPeriod = gcPeriod
+	rp.lock.Unlock()
+	if changed {
+		select {
+		case rp.gcPeriodChanged <- struct{}{}:
+		default:
+			// The GC will read the latest period anyway.
+		}
+	}
+}
+
+// currentGCPeriod must be called with the lock held.
+func (rp *RequestManager) currentGCPeriod() time.Duration {
+	if rp.configuredGCPeriod > 0 {
+		return rp.configuredGCPeriod
+	}
+	return rp.gcPeriod
+}
+
+// SetPriorityAging sets how long a request waits for its priority to be
+// raised by one. A zero agingPeriod disables aging, so that low priority
+// requests may wait for as long as higher priority requests keep coming.
+func (rp *RequestManager) SetPriorityAging(agingPeriod time.Duration) {
+	rp.lock.Lock()
+	defer rp.lock.Unlock()
+	rp.agingPeriod = agingPeriod
+}
+
+// SetStaleAfter makes the GC expire the requests which were not renewed for
+// staleAfter, even before the TTL, unless their owner heartbeat since.
+// heartbeats returns the last heartbeat of each owner. A zero staleAfter
+// disables this. It must be called before StartGC.
+func (rp *RequestManager) SetStaleAfter(staleAfter time.Duration, heartbeats func() (map[string]metav1.Time, error)) {
+	rp.staleAfter = staleAfter
+	rp.heartbeats = heartbeats
+}
+
+// staleness returns whether requests are stale as of now, or nil when the
+// requests are not audited. Requests are not audited when the heartbeats are
+// unknown either, so that live clients are not expired.
+func (rp *RequestManager) staleness(now metav1.Time) func(request) bool {
+	if rp.staleAfter <= 0 || rp.heartbeats == nil {
+		return nil
+	}
+	heartbeats, err := rp.heartbeats()
+	if err != nil {
+		logrus.WithError(err).Warning("Failed to get the heartbeats, not auditing stale requests.")
+		return nil
+	}
+	staleBefore := now.Add(-rp.staleAfter)
+	return func(req request) bool {
+		if !req.lastSeen.Time.Before(staleBefore) {
+			return false
+		}
+		heartbeat, ok := heartbeats[req.owner]
+		return !ok || heartbeat.Time.Before(staleBefore)
 	}
 }
 
 func (rp *RequestManager) cleanup(now metav1.Time) {
+	// Heartbeats are fetched before locking, so requests are not blocked on
+	// the storage.
+	isStale := rp.staleness(now)
 	rp.lock.Lock()
 	defer rp.lock.Unlock()
 	for key, rq := range rp.requests {
 		logrus.Infof("cleaning up %v request queue", key)
-		rq.cleanup(now)
+		for reason, count := range rq.cleanup(now, isStale) {
+			rp.expired[reason] += count
+		}
 		if rq.isEmpty() {
 			delete(rp.requests, key)
 		}
 	}
 }
 
-// StartGC starts a goroutine that will call cleanup every gcInterval
+// StartGC starts a goroutine that will call cleanup every gcInterval, unless
+// SetGCPeriod overrides it.
 func (rp *RequestManager) StartGC(gcPeriod time.Duration) {
 	ctx, stop := context.WithCancel(context.Background())
 	rp.stopGC = stop
-	tick := time.Tick(gcPeriod)
+	rp.lock.Lock()
+	rp.gcPeriod = gcPeriod
+	period := rp.currentGCPeriod()
+	rp.lock.Unlock()
+	ticker := time.NewTicker(period)
 	rp.wg.Add(1)
 	go func() {
 		logrus.Info("starting cleanup go routine")
 		defer logrus.Info("exiting cleanup go routine")
 		defer rp.wg.Done()
+		defer ticker.Stop()
 		for {
 			select {
 			case <-ctx.Done():
 				return
-			case <-tick:
+			case <-rp.gcPeriodChanged:
+				rp.lock.Lock()
+				if current := rp.currentGCPeriod(); current != period {
+					period = current
+					ticker.Reset(period)
+					logrus.WithField("period", period).Info("Changed the period of the request GC.")
+				}
+				rp.lock.Unlock()
+			case <-ticker.C:
 				rp.cleanup(rp.now())
 			}
 		}
@@ -237,6 +462,13 @@ func (rp *RequestManager) StopGC() {
 
 // GetRank provides the rank of a given request and whether request is new (was added)
 func (rp *RequestManager) GetRank(key interface{}, id string) (int, bool) {
+	return rp.GetPriorityRank(key, id, 0)
+}
+
+// GetPriorityRank is GetRank for a request of the given priority. Requests
+// of a higher priority are ranked first, requests of the same priority in
+// FIFO order.
+func (rp *RequestManager) GetPriorityRank(key interface{}, id string, priority int) (int, bool) {
 	rp.lock.Lock()
 	defer rp.lock.Unlock()
 	rq := rp.requests[key]
@@ -244,7 +476,27 @@ func (rp *RequestManager) GetRank(key interface{}, id string) (int, bool) {
 		rq = newRequestQueue()
 		rp.requests[key] = rq
 	}
-	return rq.getRank(id, rp.ttl, rp.now())
+	return rq.getPriorityRank(id, priority, rp.currentTTL(), rp.agingPeriod, rp.now())
+}
+
+// GetRankForOwner is GetRank, also recording owner as the requester so it
+// can be listed with the request.
+func (rp *RequestManager) GetRankForOwner(key interface{}, id, owner string) (int, bool) {
+	return rp.GetPriorityRankForOwner(key, id, owner, 0)
+}
+
+// GetPriorityRankForOwner is GetPriorityRank, also recording owner as the
+// requester so it can be listed with the request.
+func (rp *RequestManager) GetPriorityRankForOwner(key interface{}, id, owner string, priority int) (int, bool) {
+	rank, new := rp.GetPriorityRank(key, id, priority)
+	if id != "" && owner != "" {
+		rp.lock.Lock()
+		defer rp.lock.Unlock()
+		if rq := rp.requests[key]; rq != nil {
+			rq.setOwner(id, owner)
+		}
+	}
+	return rank, new
 }
 
 // GetCreatedAt returns when the request was created
@@ -276,3 +528,41 @@ func (rp *RequestManager) Delete(key interface{}, requestID string) {
 		rq.delete(requestID)
 	}
 }
+
+// list returns the pending requests of every queue, in the order they are
+// served.
+func (rp *RequestManager) list() map[interface{}][]request {
+	rp.lock.Lock()
+	defer rp.lock.Unlock()
+	now := rp.now()
+	queues := map[interface{}][]request{}
+	for key, rq := range rp.requests {
+		if requests := rq.list(rp.agingPeriod, now); len(requests) > 0 {
+			queues[key] = requests
+		}
+	}
+	return queues
+}
+
+// queued returns the number of pending requests in the queue of key, without
+// listing them.
+func (rp *RequestManager) queued(key interface{}) int {
+	rp.lock.Lock()
+	defer rp.lock.Unlock()
+	rq := rp.requests[key]
+	if rq == nil {
+		return 0
+	}
+	return rq.count(rp.now())
+}
+
+// ExpiredRequests returns the number of requests expired by the GC by reason.
+func (rp *RequestManager) ExpiredRequests() map[string]int {
+	rp.lock.Lock()
+	defer rp.lock.Unlock()
+	expired := make(map[string]int, len(rp.expired))
+	for reason, count := range rp.expired {
+		expired[reason] = count
+	}
+	return expired
+}
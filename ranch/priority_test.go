@@ -17,11 +17,15 @@ limitations under the License.
 package ranch
 
 import (
+	"errors"
 	"fmt"
+	"reflect"
 	"testing"
 	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"sigs.k8s.io/boskos/common"
 )
 
 const (
@@ -63,7 +67,7 @@ func TestRequestQueue(t *testing.T) {
 		if rank, _ := rq.getRank("", testTTL, now); rank != count-i {
 			t.Errorf("expected %d got %d", count-i, rank)
 		}
-		rq.cleanup(now)
+		rq.cleanup(now, nil)
 		// cleanup should not impact result
 		for j := i + 1; j < count; j++ {
 			rank, new := rq.getRank(fmt.Sprintf("request_%d", j), testTTL, now)
@@ -158,3 +162,184 @@ func TestRequestManager_GC(t *testing.T) {
 		t.Errorf("could not STOP GC")
 	}
 }
+
+func TestRequestManagerStaleRequests(t *testing.T) {
+	key := "key"
+	staleAfter := time.Minute
+	ttl := time.Hour
+	now := metav1.Now()
+	longAgo := metav1.NewTime(now.Add(-2 * staleAfter))
+	testCases := []struct {
+		name          string
+		staleAfter    time.Duration
+		heartbeats    map[string]metav1.Time
+		heartbeatsErr error
+		expectIDs     []string
+		expectExpired map[string]int
+	}{
+		{
+			name:          "not audited",
+			expectIDs:     []string{"crashed", "heartbeating", "renewed"},
+			expectExpired: map[string]int{},
+		},
+		{
+			name:          "stale requests of owners without heartbeats",
+			staleAfter:    staleAfter,
+			heartbeats:    map[string]metav1.Time{"heartbeating": now, "crashed": longAgo},
+			expectIDs:     []string{"heartbeating", "renewed"},
+			expectExpired: map[string]int{RequestExpiredStale: 1},
+		},
+		{
+			name:          "heartbeats unknown",
+			staleAfter:    staleAfter,
+			heartbeatsErr: errors.New("apiserver unavailable"),
+			expectIDs:     []string{"crashed", "heartbeating", "renewed"},
+			expectExpired: map[string]int{},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mgr := NewRequestManager(ttl)
+			mgr.SetStaleAfter(tc.staleAfter, func() (map[string]metav1.Time, error) {
+				return tc.heartbeats, tc.heartbeatsErr
+			})
+			mgr.now = func() metav1.Time { return longAgo }
+			for _, owner := range []string{"crashed", "heartbeating", "renewed"} {
+				mgr.GetRankForOwner(key, owner, owner)
+			}
+			mgr.now = func() metav1.Time { return now }
+			mgr.GetRank(key, "renewed")
+
+			mgr.cleanup(now)
+			var ids []string
+			for _, req := range mgr.list()[key] {
+				ids = append(ids, req.id)
+			}
+			if !reflect.DeepEqual(tc.expectIDs, ids) {
+				t.Errorf("expected requests %v, got %v", tc.expectIDs, ids)
+			}
+			if expired := mgr.ExpiredRequests(); !reflect.DeepEqual(tc.expectExpired, expired) {
+				t.Errorf("expected expired requests %v, got %v", tc.expectExpired, expired)
+			}
+		})
+	}
+}
+
+func TestRequestQueuePriorities(t *testing.T) {
+	start := metav1.Now()
+	at := func(d time.Duration) metav1.Time { return metav1.NewTime(start.Add(d)) }
+	type queued struct {
+		id       string
+		priority int
+		at       metav1.Time
+	}
+	testCases := []struct {
+		name        string
+		agingPeriod time.Duration
+		queued      []queued
+		now         metav1.Time
+		expectIDs   []string
+	}{
+		{
+			name: "same priority is FIFO",
+			queued: []queued{
+				{id: "first", at: at(0)},
+				{id: "second", at: at(time.Second)},
+			},
+			now:       at(time.Second),
+			expectIDs: []string{"first", "second"},
+		},
+		{
+			name: "higher priority first",
+			queued: []queued{
+				{id: "periodic", at: at(0)},
+				{id: "presubmit", priority: 10, at: at(time.Second)},
+				{id: "other-periodic", at: at(2 * time.Second)},
+			},
+			now:       at(2 * time.Second),
+			expectIDs: []string{"presubmit", "periodic", "other-periodic"},
+		},
+		{
+			name:        "aged low priority request is not starved",
+			agingPeriod: time.Minute,
+			queued: []queued{
+				{id: "periodic", at: at(0)},
+				{id: "presubmit", priority: 5, at: at(10 * time.Minute)},
+			},
+			now:       at(10 * time.Minute),
+			expectIDs: []string{"periodic", "presubmit"},
+		},
+		{
+			name:        "not aged enough",
+			agingPeriod: time.Minute,
+			queued: []queued{
+				{id: "periodic", at: at(0)},
+				{id: "presubmit", priority: 5, at: at(4 * time.Minute)},
+			},
+			now:       at(4 * time.Minute),
+			expectIDs: []string{"presubmit", "periodic"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rq := newRequestQueue()
+			ttl := time.Hour
+			for _, q := range tc.queued {
+				rq.getPriorityRank(q.id, q.priority, ttl, tc.agingPeriod, q.at)
+			}
+			for idx, id := range tc.expectIDs {
+				var priority int
+				for _, q := range tc.queued {
+					if q.id == id {
+						priority = q.priority
+					}
+				}
+				if rank, _ := rq.getPriorityRank(id, priority, ttl, tc.agingPeriod, tc.now); rank != idx+1 {
+					t.Errorf("expected %s to be ranked %d, got %d", id, idx+1, rank)
+				}
+			}
+			var ids []string
+			for _, req := range rq.list(tc.agingPeriod, tc.now) {
+				ids = append(ids, req.id)
+			}
+			if !reflect.DeepEqual(tc.expectIDs, ids) {
+				t.Errorf("expected requests to be served in order %v, got %v", tc.expectIDs, ids)
+			}
+		})
+	}
+}
+
+func TestApplyRequestsConfig(t *testing.T) {
+	r := makeTestRanch(nil)
+	ttl, gcPeriod := 5*time.Minute, 10*time.Second
+	config := &common.BoskosConfig{
+		Resources: []common.ResourceEntry{{Type: "t", State: common.Free, Names: []string{"res"}}},
+		Requests:  &common.RequestsConfig{TTL: &common.Duration{Duration: &ttl}, GCPeriod: &common.Duration{Duration: &gcPeriod}},
+	}
+	if err := r.ApplyConfig(config); err != nil {
+		t.Fatalf("failed to apply config: %v", err)
+	}
+	if got := r.requestMgr.TTL(); got != ttl {
+		t.Errorf("expected the configured TTL %v, got %v", ttl, got)
+	}
+	r.requestMgr.StartGC(testGCPeriod)
+	defer r.requestMgr.StopGC()
+	r.requestMgr.lock.Lock()
+	if got := r.requestMgr.currentGCPeriod(); got != gcPeriod {
+		t.Errorf("expected the configured GC period %v, got %v", gcPeriod, got)
+	}
+	r.requestMgr.lock.Unlock()
+
+	config.Requests = nil
+	if err := r.ApplyConfig(config); err != nil {
+		t.Fatalf("failed to apply config: %v", err)
+	}
+	if got := r.requestMgr.TTL(); got != testTTL {
+		t.Errorf("expected the TTL to be restored to %v, got %v", testTTL, got)
+	}
+	r.requestMgr.lock.Lock()
+	if got := r.requestMgr.currentGCPeriod(); got != testGCPeriod {
+		t.Errorf("expected the GC period to be restored to %v, got %v", testGCPeriod, got)
+	}
+	r.requestMgr.lock.Unlock()
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// QueueWaitBuckets are the upper bounds in seconds of the buckets of the
+// queue wait histograms, from a second to two hours.
+var QueueWaitBuckets = []float64{1, 5, 15, 30, 60, 120, 300, 600, 1200, 1800, 3600, 7200}
+
+// QueueWaitHistogram is the distribution of the time the acquire requests of
+// a type spent in the queue, from their first attempt with a request ID to
+// the grant of their resource.
+type QueueWaitHistogram struct {
+	Type  string
+	Count uint64
+	// Sum is the total wait in seconds.
+	Sum float64
+	// Buckets are the cumulative counts of the waits of at most each of
+	// QueueWaitBuckets seconds.
+	Buckets map[float64]uint64
+}
+
+// queueWaitTracker records the queue waits of the granted requests by type.
+type queueWaitTracker struct {
+	lock       sync.Mutex
+	histograms map[string]*QueueWaitHistogram
+}
+
+func newQueueWaitTracker() *queueWaitTracker {
+	return &queueWaitTracker{histograms: map[string]*QueueWaitHistogram{}}
+}
+
+// observe records that a request for rType was granted after waiting for wait.
+func (t *queueWaitTracker) observe(rType string, wait time.Duration) {
+	if wait < 0 {
+		wait = 0
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	h, ok := t.histograms[rType]
+	if !ok {
+		h = &QueueWaitHistogram{Type: rType, Buckets: map[float64]uint64{}}
+		for _, bound := range QueueWaitBuckets {
+			h.Buckets[bound] = 0
+		}
+		t.histograms[rType] = h
+	}
+	seconds := wait.Seconds()
+	h.Count++
+	h.Sum += seconds
+	for _, bound := range QueueWaitBuckets {
+		if seconds <= bound {
+			h.Buckets[bound]++
+		}
+	}
+}
+
+func (t *queueWaitTracker) list() []QueueWaitHistogram {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	histograms := make([]QueueWaitHistogram, 0, len(t.histograms))
+	for _, h := range t.histograms {
+		copied := *h
+		copied.Buckets = make(map[float64]uint64, len(h.Buckets))
+		for bound, count := range h.Buckets {
+			copied.Buckets[bound] = count
+		}
+		histograms = append(histograms, copied)
+	}
+	sort.Slice(histograms, func(i, j int) bool {
+		return histograms[i].Type < histograms[j].Type
+	})
+	return histograms
+}
+
+// QueueWaits returns the distribution of the queue waits of the acquire
+// requests granted since boskos started, by type. Requests without a request
+// ID do not wait in line and are not counted.
+func (r *Ranch) QueueWaits() []QueueWaitHistogram {
+	return r.queueWaits.list()
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+func TestQueueWaits(t *testing.T) {
+	now := fakeNow
+	r := makeTestRanch([]runtime.Object{
+		newResource("res-1", "t", common.Busy, "other", fakeNow),
+		newResource("res-2", "t", common.Free, "", fakeNow),
+	})
+	r.SetClock(func() metav1.Time { return now })
+
+	// Requests without request ID are not counted.
+	if _, _, err := r.Acquire("t", common.Free, common.Busy, "owner", ""); err != nil {
+		t.Fatalf("failed to acquire: %v", err)
+	}
+	if _, _, err := r.Acquire("t", common.Free, common.Busy, "owner", "request-1"); !AreErrorsEqual(err, &ResourceNotFound{name: "t"}) {
+		t.Fatalf("expected the request to wait in line, got %v", err)
+	}
+	now = metav1.NewTime(now.Add(90 * time.Second))
+	if err := r.Release("res-1", common.Free, "other"); err != nil {
+		t.Fatalf("failed to release: %v", err)
+	}
+	if _, _, err := r.Acquire("t", common.Free, common.Busy, "owner", "request-1"); err != nil {
+		t.Fatalf("failed to acquire: %v", err)
+	}
+
+	waits := r.QueueWaits()
+	if len(waits) != 1 {
+		t.Fatalf("expected the waits of a single type, got %v", waits)
+	}
+	h := waits[0]
+	if h.Type != "t" || h.Count != 1 || h.Sum != 90 {
+		t.Errorf("expected a single wait of 90s for t, got %+v", h)
+	}
+	if h.Buckets[60] != 0 || h.Buckets[120] != 1 || h.Buckets[7200] != 1 {
+		t.Errorf("expected the wait in the buckets of at least 120s, got %v", h.Buckets)
+	}
+}
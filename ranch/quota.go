@@ -0,0 +1,200 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/crds"
+)
+
+// QuotaExceeded will be returned if the owner may not acquire more resources of the requested type.
+type QuotaExceeded struct {
+	rType  string
+	owner  string
+	held   int
+	reason string
+}
+
+func (q QuotaExceeded) Error() string {
+	return fmt.Sprintf("owner %s holds %d resources of type %s: %s", q.owner, q.held, q.rType, q.reason)
+}
+
+// ownerQuota is the in memory representation of common.OwnerQuota.
+type ownerQuota struct {
+	soft, burst int
+	burstCredit time.Duration
+	owners      map[string]common.OwnerQuotaLimits
+}
+
+// forOwner returns the quota of owner, with its overrides.
+func (q ownerQuota) forOwner(owner string) ownerQuota {
+	if limits, ok := q.owners[owner]; ok {
+		q.soft, q.burst = limits.Soft, limits.Burst
+	}
+	return q
+}
+
+type quotaKey struct {
+	rType, owner string
+}
+
+// burstAccount tracks the burst credits of an owner for a resource type.
+type burstAccount struct {
+	balance    time.Duration
+	held       int
+	lastUpdate time.Time
+}
+
+// quotaManager enforces per owner soft quotas. Owners may exceed the soft quota
+// by up to the burst allowance as long as they have burst credits left. Credits
+// are consumed per resource held above the soft quota and refill while the
+// owner stays at or below it, so bursty owners are served while sustained
+// hogs are not.
+type quotaManager struct {
+	lock     sync.Mutex
+	quotas   map[string]ownerQuota
+	accounts map[quotaKey]*burstAccount
+}
+
+func newQuotaManager() *quotaManager {
+	return &quotaManager{
+		quotas:   map[string]ownerQuota{},
+		accounts: map[quotaKey]*burstAccount{},
+	}
+}
+
+// setQuotas replaces the configured quotas. Accounts of types that no longer
+// have a quota are dropped.
+func (q *quotaManager) setQuotas(config *common.BoskosConfig) {
+	quotas := map[string]ownerQuota{}
+	for _, entry := range config.Resources {
+		if entry.OwnerQuota == nil {
+			continue
+		}
+		quota := ownerQuota{soft: entry.OwnerQuota.Soft, burst: entry.OwnerQuota.Burst, owners: entry.OwnerQuota.Owners}
+		if c := entry.OwnerQuota.BurstCredit; c != nil && c.Duration != nil {
+			quota.burstCredit = *c.Duration
+		}
+		quotas[entry.Type] = quota
+	}
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.quotas = quotas
+	for key := range q.accounts {
+		if _, ok := quotas[key.rType]; !ok {
+			delete(q.accounts, key)
+		}
+	}
+}
+
+// settle brings the balance up to date. Must be called with the lock held.
+func (q *quotaManager) settle(key quotaKey, quota ownerQuota, now time.Time) *burstAccount {
+	account, ok := q.accounts[key]
+	if !ok {
+		account = &burstAccount{balance: quota.burstCredit, lastUpdate: now}
+		q.accounts[key] = account
+	}
+	elapsed := now.Sub(account.lastUpdate)
+	if elapsed > 0 {
+		if over := account.held - quota.soft; over > 0 {
+			account.balance -= time.Duration(over) * elapsed
+		} else {
+			account.balance += elapsed
+		}
+	}
+	if account.balance < 0 {
+		account.balance = 0
+	}
+	if account.balance > quota.burstCredit {
+		account.balance = quota.burstCredit
+	}
+	account.lastUpdate = now
+	return account
+}
+
+// check returns a QuotaExceeded error if owner, currently holding held
+// resources of rType, may not acquire another one.
+func (q *quotaManager) check(rType, owner string, held int, now time.Time) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	quota, ok := q.quotas[rType]
+	if !ok {
+		return nil
+	}
+	quota = quota.forOwner(owner)
+	key := quotaKey{rType: rType, owner: owner}
+	account := q.settle(key, quota, now)
+	account.held = held
+
+	if held < quota.soft {
+		return nil
+	}
+	if held >= quota.soft+quota.burst {
+		return &QuotaExceeded{rType: rType, owner: owner, held: held,
+			reason: fmt.Sprintf("quota of %d plus a burst of %d reached", quota.soft, quota.burst)}
+	}
+	if account.balance <= 0 {
+		return &QuotaExceeded{rType: rType, owner: owner, held: held,
+			reason: fmt.Sprintf("quota of %d reached and no burst credits left", quota.soft)}
+	}
+	return nil
+}
+
+// observe records that owner now holds held resources of rType.
+func (q *quotaManager) observe(rType, owner string, held int, now time.Time) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	quota, ok := q.quotas[rType]
+	if !ok {
+		return
+	}
+	account := q.settle(quotaKey{rType: rType, owner: owner}, quota.forOwner(owner), now)
+	if held < 0 {
+		held = 0
+	}
+	account.held = held
+}
+
+// observeRelease records that owner released one resource of rType.
+func (q *quotaManager) observeRelease(rType, owner string, now time.Time) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	quota, ok := q.quotas[rType]
+	if !ok {
+		return
+	}
+	account := q.settle(quotaKey{rType: rType, owner: owner}, quota.forOwner(owner), now)
+	if account.held > 0 {
+		account.held--
+	}
+}
+
+// countOwned returns the number of resources of rType held by owner.
+func countOwned(resources []crds.ResourceObject, rType, owner string) int {
+	var count int
+	for _, res := range resources {
+		if res.Spec.Type == rType && res.Status.Owner == owner {
+			count++
+		}
+	}
+	return count
+}
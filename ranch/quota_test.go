@@ -0,0 +1,144 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+func quotaConfig(rType string, soft, burst int, credit time.Duration) *common.BoskosConfig {
+	return &common.BoskosConfig{Resources: []common.ResourceEntry{{
+		Type:       rType,
+		OwnerQuota: &common.OwnerQuota{Soft: soft, Burst: burst, BurstCredit: &common.Duration{Duration: &credit}},
+	}}}
+}
+
+func TestQuotaManager(t *testing.T) {
+	type step struct {
+		// elapsed is the time passed since the previous step.
+		elapsed time.Duration
+		held    int
+		allowed bool
+	}
+	testCases := []struct {
+		name  string
+		rType string
+		steps []step
+	}{
+		{
+			name:  "no quota for type",
+			rType: "other",
+			steps: []step{{held: 100, allowed: true}},
+		},
+		{
+			name:  "below soft quota",
+			rType: "t",
+			steps: []step{{held: 0, allowed: true}, {held: 1, allowed: true}},
+		},
+		{
+			name:  "hard limit at soft plus burst",
+			rType: "t",
+			steps: []step{{held: 2, allowed: true}, {held: 3, allowed: true}, {held: 4, allowed: false}},
+		},
+		{
+			name:  "sustained burst drains credits",
+			rType: "t",
+			steps: []step{
+				{held: 2, allowed: true},
+				{elapsed: 5 * time.Minute, held: 3, allowed: true},
+				// One resource over the soft quota for 5m, two for 3m.
+				{elapsed: 3 * time.Minute, held: 3, allowed: false},
+			},
+		},
+		{
+			name:  "credits refill below the soft quota",
+			rType: "t",
+			steps: []step{
+				{held: 3, allowed: true},
+				{elapsed: 10 * time.Minute, held: 3, allowed: false},
+				{held: 1, allowed: true},
+				{elapsed: time.Minute, held: 2, allowed: true},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := newQuotaManager()
+			q.setQuotas(quotaConfig("t", 2, 2, 10*time.Minute))
+			now := time.Now()
+			for i, s := range tc.steps {
+				now = now.Add(s.elapsed)
+				err := q.check(tc.rType, "owner", s.held, now)
+				if (err == nil) != s.allowed {
+					t.Fatalf("step %d: expected allowed: %t, got %v", i, s.allowed, err)
+				}
+				if err == nil {
+					q.observe(tc.rType, "owner", s.held+1, now)
+				}
+			}
+		})
+	}
+}
+
+func TestAcquireQuota(t *testing.T) {
+	r := makeTestRanch([]runtime.Object{
+		newResource("res-1", "t", "free", "", startTime),
+		newResource("res-2", "t", "free", "", startTime),
+		newResource("res-3", "t", "free", "", startTime),
+	})
+	r.quotas.setQuotas(quotaConfig("t", 1, 1, time.Hour))
+
+	for i, expectErr := range []bool{false, false, true} {
+		_, _, err := r.Acquire("t", "free", "busy", "owner", "")
+		if _, isQuota := err.(*QuotaExceeded); isQuota != expectErr {
+			t.Fatalf("acquire %d: expected quota error: %t, got %v", i, expectErr, err)
+		}
+	}
+	if _, _, err := r.Acquire("t", "free", "busy", "other-owner", ""); err != nil {
+		t.Errorf("quota of one owner must not affect others, got %v", err)
+	}
+}
+
+func TestAcquireOwnerQuotaOverride(t *testing.T) {
+	r := makeTestRanch([]runtime.Object{
+		newResource("res-1", "t", "free", "", startTime),
+		newResource("res-2", "t", "free", "", startTime),
+		newResource("res-3", "t", "free", "", startTime),
+		newResource("res-4", "t", "free", "", startTime),
+	})
+	config := quotaConfig("t", 1, 0, 0)
+	config.Resources[0].OwnerQuota.Owners = map[string]common.OwnerQuotaLimits{"scale-test": {Soft: 2}}
+	r.quotas.setQuotas(config)
+
+	for i, expectErr := range []bool{false, false, true} {
+		_, _, err := r.Acquire("t", "free", "busy", "scale-test", "")
+		if _, isQuota := err.(*QuotaExceeded); isQuota != expectErr {
+			t.Fatalf("acquire %d: expected quota error: %t, got %v", i, expectErr, err)
+		}
+	}
+	for i, expectErr := range []bool{false, true} {
+		_, _, err := r.Acquire("t", "free", "busy", "owner", "")
+		if _, isQuota := err.(*QuotaExceeded); isQuota != expectErr {
+			t.Fatalf("acquire %d of owner without override: expected quota error: %t, got %v", i, expectErr, err)
+		}
+	}
+}
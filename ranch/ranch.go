@@ -17,14 +17,18 @@ limitations under the License.
 package ranch
 
 import (
+	"encoding/json"
 	"fmt"
 	"sort"
 	"strings"
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/wait"
@@ -32,12 +36,54 @@ import (
 
 	"sigs.k8s.io/boskos/common"
 	"sigs.k8s.io/boskos/crds"
+	"sigs.k8s.io/boskos/tracing"
 )
 
 // Ranch is the place which all of the Resource objects lives.
 type Ranch struct {
-	Storage    *Storage
-	requestMgr *RequestManager
+	Storage     *Storage
+	requestMgr  *RequestManager
+	quotas      *quotaManager
+	churn       *churnTracker
+	scheduler   SchedulerPolicy
+	deps        *dependencyManager
+	breakers    *breakerManager
+	slices      *sliceManager
+	rotations   *rotationManager
+	transitions *transitionManager
+	shards      *shardManager
+	locks       *lockManager
+	access      *accessManager
+	health      *healthManager
+	aliases     *aliasManager
+	states      *stateManager
+	imports     *importManager
+	fallbacks   *fallbackManager
+	policies    *policyManager
+	sla         *slaTracker
+	boosts      *boostTracker
+	ephemerals  *ephemeralManager
+	approvals   *approvalManager
+	queueWaits  *queueWaitTracker
+	// deprecations counts the requests relying on deprecated behavior.
+	deprecations *deprecationCounter
+	// archive, if set, records the events of the resources, see ArchiveEvents.
+	archive EventArchive
+	// auditLog, if set, records the calls changing the resources.
+	auditLog AuditLog
+	// persistence, if set, stores the locks and the open cleanup breakers,
+	// see SetStatePersistence.
+	persistence StatePersistence
+	// ownsType, if set, tells the resource types synced from the config, see
+	// SetOwnedTypes.
+	ownsType func(rType string) bool
+	// tenant is the tenant resources are acquired on behalf of, see ForTenant.
+	tenant string
+	// lameDuck is set to 1 while no new leases are granted. It is shared
+	// with the views of WithContext.
+	lameDuck *int32
+	// reloadConfig syncs the config on demand, see ReloadConfig.
+	reloadConfig func() error
 	//
 	now func() metav1.Time
 }
@@ -47,12 +93,23 @@ type Ranch struct {
 // ResourceNotFound will be returned if requested resource does not exist.
 type ResourceNotFound struct {
 	name string
+	// estimate is set when the request is queued and the wait can be estimated.
+	estimate *time.Duration
 }
 
 func (r ResourceNotFound) Error() string {
 	return fmt.Sprintf("no available resource %s, try again later.", r.name)
 }
 
+// EstimatedWait returns how long a queued request is estimated to wait for a
+// resource. The second return value is false if there is no estimate.
+func (r ResourceNotFound) EstimatedWait() (time.Duration, bool) {
+	if r.estimate == nil {
+		return 0, false
+	}
+	return *r.estimate, true
+}
+
 // ResourceTypeNotFound will be returned if requested resource type does not exist.
 type ResourceTypeNotFound struct {
 	rType string
@@ -88,16 +145,61 @@ func (s StateNotMatch) Error() string {
 // Out: A Ranch object, loaded from config/storage, or error
 func NewRanch(config string, s *Storage, ttl time.Duration) (*Ranch, error) {
 	newRanch := &Ranch{
-		Storage:    s,
-		requestMgr: NewRequestManager(ttl),
-		now:        metav1.Now,
+		Storage:      s,
+		requestMgr:   NewRequestManager(ttl),
+		quotas:       newQuotaManager(),
+		churn:        newChurnTracker(),
+		sla:          newSLATracker(),
+		boosts:       newBoostTracker(),
+		ephemerals:   newEphemeralManager(),
+		deps:         newDependencyManager(),
+		breakers:     newBreakerManager(),
+		slices:       newSliceManager(),
+		rotations:    newRotationManager(),
+		transitions:  newTransitionManager(),
+		shards:       newShardManager(),
+		locks:        newLockManager(),
+		access:       newAccessManager(),
+		health:       newHealthManager(),
+		aliases:      newAliasManager(),
+		states:       newStateManager(),
+		imports:      newImportManager(),
+		fallbacks:    newFallbackManager(),
+		policies:     newPolicyManager(),
+		approvals:    newApprovalManager(),
+		queueWaits:   newQueueWaitTracker(),
+		deprecations: newDeprecationCounter(),
+		lameDuck:     new(int32),
+		now:          metav1.Now,
 	}
 	return newRanch, nil
 }
 
+// SetClock overrides the clock of the ranch and of its request queues, e.g. to
+// make tests deterministic.
+// It must be called before the ranch starts serving requests.
+func (r *Ranch) SetClock(now func() metav1.Time) {
+	r.now = now
+	r.requestMgr.now = now
+}
+
+// Now returns the current time of the clock of the ranch.
+func (r *Ranch) Now() time.Time {
+	return r.now().Time
+}
+
 // acquireRequestPriorityKey is used as key for request priority cache.
+// Requests with a label selector wait in line with those of the same
+// selector only, as they compete for a subset of the resources.
 type acquireRequestPriorityKey struct {
-	rType, state string
+	rType, state, selector string
+}
+
+// acquireByStateRequestKey is used as key for the priority of requests for a
+// named resource. Requests for several resources wait in the line of each of
+// them, so that waiters for any one of them cannot starve the request.
+type acquireByStateRequestKey struct {
+	name, state string
 }
 
 // Acquire checks out a type of resource in certain state without an owner,
@@ -110,6 +212,51 @@ type acquireRequestPriorityKey struct {
 // Out: A valid Resource object and the time when the resource was originally requested on success, or
 //      ResourceNotFound error if target type resource does not exist in target state.
 func (r *Ranch) Acquire(rType, state, dest, owner, requestID string) (*crds.ResourceObject, metav1.Time, error) {
+	return r.AcquireWithMaxWait(rType, state, dest, owner, requestID, 0)
+}
+
+// AcquireWithMaxWait is like Acquire, but fails fast with a WaitEstimateExceeded
+// error if, judging from the queue depth and the release history of the type,
+// the request is not expected to be fulfilled within maxWait. A zero maxWait
+// waits for as long as it takes.
+func (r *Ranch) AcquireWithMaxWait(rType, state, dest, owner, requestID string, maxWait time.Duration) (*crds.ResourceObject, metav1.Time, error) {
+	return r.AcquirePrioritized(rType, state, dest, owner, requestID, 0, maxWait)
+}
+
+// AcquirePrioritized is like AcquireWithMaxWait for a request of the given
+// priority, which is served before the waiting requests of a lower priority,
+// e.g. so that presubmits jump ahead of periodics when the type is scarce.
+// The default priority is zero. The priority of waiting requests is raised
+// over time, see RequestManager.SetPriorityAging, so they are not starved.
+func (r *Ranch) AcquirePrioritized(rType, state, dest, owner, requestID string, priority int, maxWait time.Duration) (*crds.ResourceObject, metav1.Time, error) {
+	return r.AcquireWithLease(rType, state, dest, owner, requestID, priority, maxWait, 0)
+}
+
+// acquire implements Acquire, AcquireWithLease, AcquireWithSelector,
+// AcquireInShard and Hold. If shardGroup is set, only the resources of the
+// shard of the owner are considered. If selector is set, only the resources
+// whose user data match it are considered. If holdTTL is set, the resource is
+// held for the owner instead of being moved to dest. If lease is set, the
+// resource is released once the lease expires.
+func (r *Ranch) acquire(rType, state, dest, owner, requestID, shardGroup string, selector labels.Selector, priority int, maxWait, holdTTL, lease time.Duration) (_ *crds.ResourceObject, _ metav1.Time, err error) {
+	ctx, span := tracing.Start(r.Storage.ctx, "ranch.acquire",
+		attribute.String("type", rType),
+		attribute.String("state", state),
+		attribute.String("dest", dest),
+		attribute.String("owner", owner),
+		attribute.String("request_id", requestID),
+	)
+	defer func() {
+		// Running out of resources is no failure of the request.
+		spanErr := err
+		if isExpectedAcquireError(err) {
+			span.SetAttributes(attribute.String("outcome", fmt.Sprintf("%T", err)))
+			spanErr = nil
+		}
+		tracing.End(span, spanErr)
+	}()
+	r = r.WithContext(ctx)
+
 	logger := logrus.WithFields(logrus.Fields{
 		"type":       rType,
 		"state":      state,
@@ -120,99 +267,254 @@ func (r *Ranch) Acquire(rType, state, dest, owner, requestID string) (*crds.Reso
 
 	var returnRes *crds.ResourceObject
 	createdTime := r.now()
-	if err := retryOnConflict(retry.DefaultBackoff, func() error {
-		logger.Debug("Determining request priority...")
-		ts := acquireRequestPriorityKey{rType: rType, state: state}
-		rank, new := r.requestMgr.GetRank(ts, requestID)
-		logger.WithFields(logrus.Fields{"rank": rank, "new": new}).Debug("Determined request priority.")
-
+	if err := r.admitTenant(rType); err != nil {
+		return nil, createdTime, err
+	}
+	if err := r.admitApproval(rType, state, dest, owner, requestID); err != nil {
+		return nil, createdTime, err
+	}
+	// Resources of ephemeral types are created for each request instead of
+	// being taken from a pool.
+	if provisioner, ok := r.ephemerals.get(rType); ok && state == common.Free && holdTTL == 0 {
+		res, err := r.acquireEphemeral(provisioner, rType, dest, owner, requestID, lease)
+		if err == nil {
+			r.approvals.complete(rType, owner, requestID)
+		}
+		return res, createdTime, err
+	}
+	if err := retryOnConflict(retry.DefaultBackoff, tracedAttempts(span, func() error {
 		resources, err := r.Storage.GetResources()
 		if err != nil {
 			logger.WithError(err).Errorf("could not get resources")
-			return &ResourceNotFound{rType}
+			return &ResourceNotFound{name: rType}
+		}
+
+		// Owners over their quota must not hold a rank in the queue, so the
+		// quota is checked before determining the request priority.
+		held := countOwned(resources.Items, rType, owner)
+		if err := r.quotas.check(rType, owner, held, r.now().Time); err != nil {
+			return err
+		}
+
+		// Time-sliced resources are handed out to the owner of the slice in
+		// progress only, but may still be cleaned between slices.
+		if _, ok := r.slices.get(rType); ok && state == common.Free {
+			return &TimeSliced{rType: rType}
+		}
+
+		// Handing out dirty resources for cleaning is pointless while the
+		// janitor of the type keeps failing.
+		if state == common.Dirty && r.breakers.isOpen(rType) {
+			return &CleanupPaused{rType: rType}
+		}
+
+		// Members of a shard group never compete for the same resources, so
+		// sharded requests do not wait in line.
+		var shard common.ShardAssignment
+		ts := acquireRequestPriorityKey{rType: rType, state: state}
+		if selector != nil {
+			ts.selector = selector.String()
+		}
+		rank, new := 1, false
+		if shardGroup != "" {
+			var ok bool
+			if shard, ok = r.shards.assignment(shardGroup, owner, r.now().Time); !ok {
+				return &ShardNotAssigned{group: shardGroup, member: owner}
+			}
+			logger.WithFields(logrus.Fields{"shard": shard.Index, "shards": shard.Count}).Debug("Determined shard.")
+		} else {
+			logger.Debug("Determining request priority...")
+			rank, new = r.requestMgr.GetPriorityRankForOwner(ts, requestID, owner, priority+r.boosts.get(owner, r.now().Time))
+			logger.WithFields(logrus.Fields{"rank": rank, "new": new}).Debug("Determined request priority.")
+			span.AddEvent("queued", trace.WithAttributes(attribute.Int("rank", rank), attribute.Bool("new", new)))
+		}
+		if r.LameDuckMode() {
+			return &LameDuck{}
 		}
 		logger.Debugf("Considering %d resources.", len(resources.Items))
 
 		// For request priority we need to go over all the list until a matching rank
-		matchingResoucesCount := 0
-		typeCount := 0
+		var candidates []crds.ResourceObject
+		typeCount, free := 0, 0
 		for idx := range resources.Items {
 			res := resources.Items[idx]
 			if rType != res.Spec.Type {
 				continue
 			}
 			typeCount++
+			if isFreeOfType(&res, rType) {
+				free++
+			}
 
-			if state != res.Status.State || res.Status.Owner != "" {
+			// Resources whose credentials were handed out wait for rotation.
+			if state != res.Status.State || res.Status.Owner != "" || res.Status.CredentialsExposed {
 				continue
 			}
-			matchingResoucesCount++
-
-			if matchingResoucesCount < rank {
+			// Free resources reserved for the window in progress wait to be
+			// handed to the owner of the reservation.
+			if state == common.Free && activeBooking(res.Status.Bookings, r.now().Time) != nil {
 				continue
 			}
+			if shardGroup != "" && !inShard(&res, shard) {
+				continue
+			}
+			if selector != nil && !selector.Matches(labels.Set(res.Status.UserData)) {
+				continue
+			}
+			candidates = append(candidates, res)
+		}
+		if r.scheduler != nil && len(candidates) >= rank {
+			request := SchedulingRequest{Type: rType, State: state, Dest: dest, Owner: owner, RequestID: requestID}
+			if candidates, err = schedule(r.scheduler, request, candidates); err != nil {
+				logger.WithError(err).Error("Scheduler policy failed")
+				return err
+			}
+		}
+		matchingResoucesCount := len(candidates)
+		// The health advisory of the response reuses the count.
+		r.health.observeFree(rType, free, r.now().Time)
+
+		if matchingResoucesCount >= rank {
+			res := candidates[rank-1]
 			logger = logger.WithField("resource", res.Name)
+			if err := r.admitTransition(&res, dest, owner); err != nil {
+				return err
+			}
+			target := dest
+			if holdTTL > 0 {
+				target = common.Held
+				res.Status.Hold = &crds.HoldStatus{
+					Expiration:    metav1.NewTime(r.now().Add(holdTTL)),
+					OriginalState: state,
+					Dest:          dest,
+				}
+			}
+			var coAcquired []string
+			if needs := r.deps.get(rType); len(needs) > 0 {
+				logger.Debug("Co-acquiring required resources.")
+				if coAcquired, err = r.coAcquire(needs, &res, resources.Items, owner, target, nil); err != nil {
+					return err
+				}
+				names, err := json.Marshal(common.LeasedResources(coAcquired))
+				if err != nil {
+					r.releaseCoAcquired(coAcquired, owner, common.Free)
+					return err
+				}
+				if res.Status.UserData == nil {
+					res.Status.UserData = map[string]string{}
+				}
+				res.Status.UserData[common.CoAcquiredResources] = string(names)
+			}
 			res.Status.Owner = owner
-			res.Status.State = dest
+			res.Status.State = target
+			if lease > 0 {
+				res.Status.Lease = &crds.LeaseStatus{Expiration: metav1.NewTime(r.now().Add(lease))}
+			}
+			r.rotations.expose(&res)
 			logger.Debug("Updating resource.")
 			updatedRes, err := r.Storage.UpdateResource(&res)
 			if err != nil {
+				r.releaseCoAcquired(coAcquired, owner, common.Free)
 				return err
 			}
+			r.audit(common.AuditAcquire, updatedRes, owner, state, requestID)
+			if state == common.Free {
+				r.health.observeFree(rType, free-1, r.now().Time)
+			}
 			// Deleting this request since it has been fulfilled
 			if requestID != "" {
 				if createdTime, err = r.requestMgr.GetCreatedAt(ts, requestID); err != nil {
 					// It is chosen NOT to fail the function since the resource has been already updated to give ownership.
 					logger.WithError(err).Errorf("Error occurred when getting the created time")
+				} else {
+					r.queueWaits.observe(rType, r.now().Sub(createdTime.Time))
 				}
 				logger.Debug("Cleaning up requests.")
 				r.requestMgr.Delete(ts, requestID)
 			}
+			r.sla.observeAcquire(updatedRes.Name, rType, r.now().Sub(createdTime.Time), r.now().Time)
+			r.Storage.demand.observeAcquire(rType, r.now().Time)
+			r.boosts.clear(owner)
+			r.quotas.observe(rType, owner, held+1, r.now().Time)
 			logger.Debug("Successfully acquired resource.")
 			returnRes = updatedRes
 			return nil
 		}
 
-		addResource(new, logger, r, rType, typeCount)
+		added := addResource(new, logger, r, rType, typeCount, resources.Items, selector)
 
 		if typeCount > 0 {
-			return &ResourceNotFound{rType}
+			notFound := &ResourceNotFound{name: rType}
+			// Every request ranked ahead of the free resources needs a release.
+			if estimate, ok := r.churn.estimateWait(rType, state, rank-matchingResoucesCount); ok && !added {
+				if maxWait > 0 && estimate > maxWait {
+					if requestID != "" {
+						// The client gives up, so it must not hold up others.
+						r.requestMgr.Delete(ts, requestID)
+					}
+					return &WaitEstimateExceeded{rType: rType, state: state, estimate: estimate, maxWait: maxWait}
+				}
+				notFound.estimate = &estimate
+			}
+			return notFound
 		}
 		return &ResourceTypeNotFound{rType}
-	}); err != nil {
-		switch err.(type) {
-		case *ResourceNotFound:
-			// This error occurs when there are no more resources to lease out.
-			// Such a condition is a normal and expected part of operation, so
-			// it does not warrant an error log.
-		default:
+	})); err != nil {
+		if !isExpectedAcquireError(err) {
 			logrus.WithError(err).Error("Acquire failed")
+			// Failures of boskos itself, like of the storage, are not the
+			// fault of the owner, which will retry.
+			if _, ok := err.(*ResourceTypeNotFound); !ok {
+				r.boosts.raise(owner, "error", r.now().Time)
+			}
 		}
 		return nil, createdTime, err
 	}
 
+	r.approvals.complete(rType, owner, requestID)
 	return returnRes, createdTime, nil
 }
 
-func addResource(new bool, logger *logrus.Entry, r *Ranch, rType string, typeCount int) {
+// isExpectedAcquireError returns whether err occurs when there are no more
+// resources to lease out or the owner already holds its share of them.
+// Such a condition is a normal and expected part of operation, so it does not
+// warrant an error log.
+func isExpectedAcquireError(err error) bool {
+	switch err.(type) {
+	case *ResourceNotFound, *QuotaExceeded, *WaitEstimateExceeded, *LameDuck, *CleanupPaused, *TimeSliced, *TransitionDenied, *ShardNotAssigned,
+		*TransitionNotAllowed, *ApprovalPending, *ApprovalDenied, *ApprovalBacklogFull:
+		return true
+	}
+	return false
+}
+
+func addResource(new bool, logger *logrus.Entry, r *Ranch, rType string, typeCount int, resources []crds.ResourceObject, selector labels.Selector) bool {
 	if !new {
-		return
+		return false
 	}
 	logger.Debug("Checking for associated dynamic resource type...")
 	lifeCycle, err := r.Storage.GetDynamicResourceLifeCycle(rType)
 	// Assuming error means no associated dynamic resource.
 	if err == nil {
-		if typeCount < lifeCycle.Spec.MaxCount {
+		flavor, ok := pickFlavor(lifeCycle, resources, selector)
+		if typeCount < lifeCycle.Spec.MaxCount && ok {
 			logger.Debug("Adding new dynamic resources...")
 			res := newResourceFromNewDynamicResourceLifeCycle(r.Storage.generateName(), lifeCycle, r.now())
+			r.Storage.stampCreation(res, lifeCycle)
+			r.Storage.placeInRegion(res, resources)
+			r.Storage.stampFlavor(res, flavor)
+			r.Storage.stampTenant(res)
 			if err := r.Storage.AddResource(res); err != nil {
 				logger.WithError(err).Warningf("unable to add a new resource of type %s", rType)
+				return false
 			}
 			logger.Infof("Added dynamic resource %s of type %s", res.Name, res.Spec.Type)
+			return true
 		}
 	} else {
 		logrus.WithError(err).Debug("Failed listing DRLC")
 	}
+	return false
 }
 
 // AcquireByState checks out resources of a given type without an owner,
@@ -224,41 +526,114 @@ func addResource(new bool, logger *logrus.Entry, r *Ranch, rType string, typeCou
 // Out: A valid list of Resource object on success, or
 //      ResourceNotFound error if target type resource does not exist in target state.
 func (r *Ranch) AcquireByState(state, dest, owner string, names []string) ([]*crds.ResourceObject, error) {
+	return r.AcquireByStateWithPriority(state, dest, owner, names, "")
+}
+
+// AcquireByStateWithPriority is like AcquireByState, but requests with a
+// requestID wait in line: only a request which is the oldest for each of its
+// names may acquire them, and only once all of them are available.
+// Out: A valid list of Resource object on success, or
+//      ResourceNotFound error if the resources are not available yet.
+func (r *Ranch) AcquireByStateWithPriority(state, dest, owner string, names []string, requestID string) ([]*crds.ResourceObject, error) {
 	if names == nil {
 		return nil, fmt.Errorf("must provide names of expected resources")
 	}
+	// Requests without requestID do not wait in line, but must not overtake
+	// the requests that do. The rank is kept in lame-duck mode, like for Acquire.
+	var keys []acquireByStateRequestKey
+	for _, name := range sets.NewString(names...).List() {
+		keys = append(keys, acquireByStateRequestKey{name: name, state: state})
+	}
+	// The request is ranked in every line, so it keeps its place in all of
+	// them while waiting behind another one.
+	ahead := false
+	for _, key := range keys {
+		if rank, _ := r.requestMgr.GetRank(key, requestID); rank > 1 {
+			ahead = true
+		}
+	}
+	if ahead {
+		return nil, &ResourceNotFound{name: state}
+	}
+	if r.LameDuckMode() {
+		return nil, &LameDuck{}
+	}
 
 	var returnRes []*crds.ResourceObject
+	var approved []string
 	if err := retryOnConflict(retry.DefaultBackoff, func() error {
 		rNames := sets.NewString(names...)
 
 		allResources, err := r.Storage.GetResources()
 		if err != nil {
 			logrus.WithError(err).Errorf("could not get resources")
-			return &ResourceNotFound{state}
+			return &ResourceNotFound{name: state}
+		}
+
+		// Every gated type of the named resources is submitted for approval
+		// at once, like for AcquireBatch.
+		types := sets.NewString()
+		for _, res := range allResources.Items {
+			if rNames.Has(res.Name) {
+				types.Insert(res.Spec.Type)
+			}
+		}
+		var approvalErr error
+		for _, rType := range types.List() {
+			if err := r.admitApproval(rType, state, dest, owner, requestID); err != nil && approvalErr == nil {
+				approvalErr = err
+			}
+		}
+		if approvalErr != nil {
+			return approvalErr
+		}
+		approved = types.List()
+
+		if requestID != "" {
+			available := sets.NewString()
+			for _, res := range allResources.Items {
+				if state == res.Status.State && res.Status.Owner == "" && !res.Status.CredentialsExposed {
+					available.Insert(res.Name)
+				}
+			}
+			if !available.IsSuperset(rNames) {
+				return &ResourceNotFound{name: state}
+			}
 		}
 
 		var resources []*crds.ResourceObject
 
 		for idx := range allResources.Items {
 			res := allResources.Items[idx]
-			if state != res.Status.State || res.Status.Owner != "" || !rNames.Has(res.Name) {
+			if state != res.Status.State || res.Status.Owner != "" || res.Status.CredentialsExposed || !rNames.Has(res.Name) {
 				continue
 			}
+			if err := r.admitTenant(res.Spec.Type); err != nil {
+				returnRes = resources
+				return err
+			}
+			if err := r.admitTransition(&res, dest, owner); err != nil {
+				returnRes = resources
+				return err
+			}
 
 			res.Status.Owner = owner
 			res.Status.State = dest
+			r.rotations.expose(&res)
 			updatedRes, err := r.Storage.UpdateResource(&res)
 			if err != nil {
 				return err
 			}
+			r.audit(common.AuditAcquire, updatedRes, owner, state, requestID)
+			r.sla.observeAcquire(updatedRes.Name, updatedRes.Spec.Type, 0, r.now().Time)
+			r.Storage.demand.observeAcquire(updatedRes.Spec.Type, r.now().Time)
 			resources = append(resources, updatedRes)
 			rNames.Delete(res.Name)
 		}
 
 		if rNames.Len() != 0 {
 			missingResources := rNames.List()
-			err := &ResourceNotFound{state}
+			err := &ResourceNotFound{name: state}
 			logrus.WithError(err).Errorf("could not find required resources %s", strings.Join(missingResources, ", "))
 			returnRes = resources
 			return err
@@ -266,11 +641,21 @@ func (r *Ranch) AcquireByState(state, dest, owner string, names []string) ([]*cr
 		returnRes = resources
 		return nil
 	}); err != nil {
-		logrus.WithError(err).Error("AcquireByState failed")
+		if _, ok := err.(*ResourceNotFound); !ok || requestID == "" {
+			logrus.WithError(err).Error("AcquireByState failed")
+		}
 		// Not a bug, we return what we got even on error.
 		return returnRes, err
 	}
 
+	for _, rType := range approved {
+		r.approvals.complete(rType, owner, requestID)
+	}
+	if requestID != "" {
+		for _, key := range keys {
+			r.requestMgr.Delete(key, requestID)
+		}
+	}
 	return returnRes, nil
 }
 
@@ -282,18 +667,52 @@ func (r *Ranch) AcquireByState(state, dest, owner string, names []string) ([]*cr
 //      OwnerNotMatch error if owner does not match current owner of the resource, or
 //      ResourceNotFound error if target named resource does not exist.
 func (r *Ranch) Release(name, dest, owner string) error {
-	if err := retryOnConflict(retry.DefaultBackoff, func() error {
+	return r.release(name, dest, owner, 0)
+}
+
+// release implements Release and ReleaseCleaned. A positive cleanupDuration is
+// recorded in the cleanup statistics of the resource if it was being cleaned.
+func (r *Ranch) release(name, dest, owner string, cleanupDuration time.Duration) (err error) {
+	ctx, span := tracing.Start(r.Storage.ctx, "ranch.release",
+		attribute.String("name", name),
+		attribute.String("dest", dest),
+		attribute.String("owner", owner),
+	)
+	defer func() { tracing.End(span, err) }()
+	r = r.WithContext(ctx)
+
+	if err := retryOnConflict(retry.DefaultBackoff, tracedAttempts(span, func() error {
 		res, err := r.Storage.GetResource(name)
 		if err != nil {
 			logrus.WithError(err).Errorf("unable to release resource %s", name)
-			return &ResourceNotFound{name}
+			return &ResourceNotFound{name: name}
 		}
 		if owner != res.Status.Owner {
 			return &OwnerNotMatch{request: owner, owner: res.Status.Owner}
 		}
-
+		cleaned := res.Status.State == common.Cleaning && (dest == common.Free || dest == common.Dirty)
+		// Ephemeral resources are destroyed by their janitor instead of
+		// being pooled, so they are only ever released as free once cleaned.
+		ephemeral := r.isEphemeral(res)
+		if ephemeral && dest == common.Free && !cleaned {
+			dest = common.Dirty
+		}
+		if err := r.admitTransition(res, dest, owner); err != nil {
+			return err
+		}
+		if cleaned && cleanupDuration > 0 {
+			observeCleanup(&res.Status, cleanupDuration, dest == common.Dirty, r.now())
+			r.sla.observeCleanup(res.Spec.Type, cleanupDuration, r.now().Time)
+		}
+		previousState := res.Status.State
 		res.Status.Owner = ""
 		res.Status.State = dest
+		res.Status.Hold = nil
+		res.Status.Progress = nil
+		res.Status.Lease = nil
+		res.Status.Bookings = dropActiveBooking(res.Status.Bookings, owner, r.now().Time)
+		coAcquired := coAcquiredResources(res)
+		delete(res.Status.UserData, common.CoAcquiredResources)
 
 		if lf, err := r.Storage.GetDynamicResourceLifeCycle(res.Spec.Type); err == nil {
 			// Assuming error means not existing as the only way to differentiate would be to list
@@ -306,11 +725,28 @@ func (r *Ranch) Release(name, dest, owner string) error {
 			res.Status.ExpirationDate = nil
 		}
 
-		if _, err := r.Storage.UpdateResource(res); err != nil {
+		deleted := ephemeral && cleaned && dest == common.Free
+		if deleted {
+			if err := r.Storage.DeleteResource(res.Name); err != nil {
+				return err
+			}
+		} else if _, err := r.Storage.UpdateResource(res); err != nil {
 			return err
 		}
+		r.audit(common.AuditRelease, res, owner, previousState, "")
+		r.sla.observeLeaseEnd(res.Name, res.Spec.Type, r.now().Time)
+		r.quotas.observeRelease(res.Spec.Type, owner, r.now().Time)
+		if !deleted {
+			r.churn.observeRelease(res.Spec.Type, dest, r.now().Time)
+		}
+		if cleaned {
+			// Janitors release the resources they failed to clean as dirty.
+			r.observeCleanup(res.Spec.Type, dest == common.Dirty)
+		}
+		// Releasing cascades to the resources co-acquired with this one.
+		r.releaseCoAcquired(coAcquired, owner, dest)
 		return nil
-	}); err != nil {
+	})); err != nil {
 		logrus.WithError(err).Error("Release failed")
 		return err
 	}
@@ -328,11 +764,20 @@ func (r *Ranch) Release(name, dest, owner string) error {
 //      ResourceNotFound error if target named resource does not exist, or
 //      StateNotMatch error if state does not match current state of the resource.
 func (r *Ranch) Update(name, owner, state string, ud *common.UserData) error {
+	return r.UpdateWithProgress(name, owner, state, ud, nil)
+}
+
+// UpdateWithProgress is like Update, also recording the progress the owner
+// reports, if any, in place of the progress it reported before.
+func (r *Ranch) UpdateWithProgress(name, owner, state string, ud *common.UserData, progress *common.Progress) error {
+	if err := r.Storage.checkUserDataSize(ud); err != nil {
+		return err
+	}
 	if err := retryOnConflict(retry.DefaultBackoff, func() error {
 		res, err := r.Storage.GetResource(name)
 		if err != nil {
 			logrus.WithError(err).Errorf("could not find resource %s for update", name)
-			return &ResourceNotFound{name}
+			return &ResourceNotFound{name: name}
 		}
 		if owner != res.Status.Owner {
 			return &OwnerNotMatch{request: owner, owner: res.Status.Owner}
@@ -344,9 +789,19 @@ func (r *Ranch) Update(name, owner, state string, ud *common.UserData) error {
 			res.Status.UserData = map[string]string{}
 		}
 		res.Status.UserData = common.UserDataFromMap(res.Status.UserData).Update(ud).ToMap()
+		if progress != nil {
+			res.Status.Progress = &crds.ProgressStatus{
+				Owner:    owner,
+				Phase:    progress.Phase,
+				Percent:  progress.Percent,
+				Message:  progress.Message,
+				Reported: r.now(),
+			}
+		}
 		if _, err := r.Storage.UpdateResource(res); err != nil {
 			return err
 		}
+		r.audit(common.AuditUpdate, res, owner, state, "")
 		return nil
 	}); err != nil {
 		logrus.WithError(err).Error("Update failed")
@@ -363,6 +818,9 @@ func (r *Ranch) Update(name, owner, state string, ud *common.UserData) error {
 //     dest - destination state of expired resources
 // Out: map of resource name - resource owner.
 func (r *Ranch) Reset(rtype, state string, expire time.Duration, dest string) (map[string]string, error) {
+	if err := r.admitTenant(rtype); err != nil {
+		return nil, err
+	}
 	var ret map[string]string
 	if err := retryOnConflict(retry.DefaultBackoff, func() error {
 		ret = make(map[string]string)
@@ -376,13 +834,24 @@ func (r *Ranch) Reset(rtype, state string, expire time.Duration, dest string) (m
 			if rtype != res.Spec.Type || state != res.Status.State || res.Status.Owner == "" || r.now().Sub(res.Status.LastUpdate.Time) < expire {
 				continue
 			}
+			if err := r.admitTransition(&res, dest, ""); err != nil {
+				logrus.WithError(err).Warningf("Not resetting resource %s", res.Name)
+				continue
+			}
 
 			ret[res.Name] = res.Status.Owner
 			res.Status.Owner = ""
-			res.Status.State = dest
+			res.Status.State = r.unpooledDest(&res, dest)
+			res.Status.Progress = nil
+			res.Status.Lease = nil
 			if _, err := r.Storage.UpdateResource(&res); err != nil {
 				return err
 			}
+			r.audit(common.AuditReset, &res, ret[res.Name], state, "")
+			r.sla.observeLeaseEnd(res.Name, rtype, r.now().Time)
+			r.boosts.raise(ret[res.Name], "reset", r.now().Time)
+			r.quotas.observeRelease(rtype, ret[res.Name], r.now().Time)
+			r.churn.observeRelease(rtype, res.Status.State, r.now().Time)
 		}
 		return nil
 	}); err != nil {
@@ -397,12 +866,77 @@ func (r *Ranch) Reset(rtype, state string, expire time.Duration, dest string) (m
 func (r *Ranch) SyncConfig(configPath string) error {
 	config, err := common.ParseConfig(configPath)
 	if err != nil {
+		r.Storage.configSyncs.finish(r.Storage.configSyncs.start(), err, r.now().Time)
 		return err
 	}
+	return r.ApplyConfig(config)
+}
+
+// ApplyConfig updates resource list from a config
+func (r *Ranch) ApplyConfig(config *common.BoskosConfig) error {
+	started := r.Storage.configSyncs.start()
+	err := r.applyConfig(config)
+	r.Storage.configSyncs.finish(started, err, r.now().Time)
+	return err
+}
+
+func (r *Ranch) applyConfig(config *common.BoskosConfig) error {
 	if err := common.ValidateConfig(config); err != nil {
 		return err
 	}
-	return r.Storage.SyncResources(config)
+	// The whole config is validated, as types may refer to types owned by
+	// other instances.
+	config = r.ownedConfig(config)
+	if r.Follower() {
+		// Followers serve listings and check requests like the leader, so
+		// they keep the config in memory, but leave the storage to the
+		// leader.
+		r.Storage.regions.set(config)
+		r.Storage.tenants.set(config)
+		r.setConfig(config)
+		return nil
+	}
+	if err := r.WriteError(); err != nil {
+		return err
+	}
+	// Resources created by the sync are placed in the configured regions,
+	// and belong to the tenant of their type.
+	r.Storage.regions.set(config)
+	r.Storage.tenants.set(config)
+	if err := r.Storage.SyncResources(config); err != nil {
+		return err
+	}
+	r.setConfig(config)
+	if err := r.syncTenants(); err != nil {
+		return err
+	}
+	return r.migrateUserData(config)
+}
+
+// setConfig applies config to the state the ranch keeps in memory.
+func (r *Ranch) setConfig(config *common.BoskosConfig) {
+	r.quotas.setQuotas(config)
+	r.deps.set(config)
+	r.breakers.set(config)
+	r.slices.set(config)
+	r.rotations.set(config)
+	r.transitions.set(config)
+	r.access.set(config)
+	r.health.set(config)
+	r.aliases.set(config)
+	r.states.set(config)
+	r.imports.set(config)
+	r.fallbacks.set(config)
+	r.policies.set(config)
+	r.ephemerals.set(config)
+	r.approvals.set(config)
+	r.setRequestsConfig(config.Requests)
+}
+
+// SetPriorityAging sets how long a request waits for its priority to be
+// raised by one, see RequestManager.SetPriorityAging.
+func (r *Ranch) SetPriorityAging(agingPeriod time.Duration) {
+	r.requestMgr.SetPriorityAging(agingPeriod)
 }
 
 // StartRequestGC starts the GC of expired requests
@@ -410,27 +944,86 @@ func (r *Ranch) StartRequestGC(gcPeriod time.Duration) {
 	r.requestMgr.StartGC(gcPeriod)
 }
 
+// setRequestsConfig applies the TTL and the GC period of the requests of the
+// config, restoring those the ranch was started with when they are unset.
+func (r *Ranch) setRequestsConfig(config *common.RequestsConfig) {
+	var ttl, gcPeriod time.Duration
+	if config != nil {
+		if config.TTL != nil && config.TTL.Duration != nil {
+			ttl = *config.TTL.Duration
+		}
+		if config.GCPeriod != nil && config.GCPeriod.Duration != nil {
+			gcPeriod = *config.GCPeriod.Duration
+		}
+	}
+	r.requestMgr.SetTTL(ttl)
+	r.requestMgr.SetGCPeriod(gcPeriod)
+}
+
+// StopRequestGC stops the GC of expired requests and waits for it to exit.
+func (r *Ranch) StopRequestGC() {
+	r.requestMgr.StopGC()
+}
+
+// SetRequestStaleAfter makes the GC of requests expire the requests which
+// were not renewed for staleAfter, even before the request TTL, unless their
+// owner updated one of its resources since. Requests of crashed clients thus
+// leave the queues early. It must be called before StartRequestGC.
+func (r *Ranch) SetRequestStaleAfter(staleAfter time.Duration) {
+	r.requestMgr.SetStaleAfter(staleAfter, r.ownerHeartbeats)
+}
+
+// ownerHeartbeats returns the last update of the resources of each owner.
+func (r *Ranch) ownerHeartbeats() (map[string]metav1.Time, error) {
+	heartbeats := map[string]metav1.Time{}
+	if err := r.Storage.ForEachResourceForRead(func(res *crds.ResourceObject) error {
+		owner := res.Status.Owner
+		if owner == "" {
+			return nil
+		}
+		if heartbeat, ok := heartbeats[owner]; !ok || heartbeat.Before(&res.Status.LastUpdate) {
+			heartbeats[owner] = res.Status.LastUpdate
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return heartbeats, nil
+}
+
+// ExpiredRequests returns the number of requests expired by the GC of
+// requests by reason, one of the RequestExpired constants.
+func (r *Ranch) ExpiredRequests() map[string]int {
+	return r.requestMgr.ExpiredRequests()
+}
+
 // Metric returns a metric object with metrics filled in
 func (r *Ranch) Metric(rtype string) (common.Metric, error) {
-	metric := common.NewMetric(rtype)
+	return r.metric(rtype, false)
+}
 
-	resources, err := r.Storage.GetResources()
-	if err != nil {
-		logrus.WithError(err).Error("cannot find resources")
-		return metric, &ResourceNotFound{rtype}
-	}
+// MetricByOwner is Metric with the counts of the resources by owner and state
+// filled in.
+func (r *Ranch) MetricByOwner(rtype string) (common.Metric, error) {
+	return r.metric(rtype, true)
+}
 
-	for _, res := range resources.Items {
-		if res.Spec.Type != rtype {
-			continue
-		}
+func (r *Ranch) metric(rtype string, byOwner bool) (common.Metric, error) {
+	metric := newMetric(rtype, byOwner)
 
-		metric.Current[res.Status.State]++
-		metric.Owners[res.Status.Owner]++
+	// The resources are streamed so large pools are not copied for a count.
+	if err := r.Storage.ForEachResourceForRead(func(res *crds.ResourceObject) error {
+		if res.Spec.Type == rtype {
+			countResource(metric, res)
+		}
+		return nil
+	}); err != nil {
+		logrus.WithError(err).Error("cannot find resources")
+		return common.NewMetric(rtype), &ResourceNotFound{name: rtype}
 	}
 
 	if len(metric.Current) == 0 && len(metric.Owners) == 0 {
-		return metric, &ResourceNotFound{rtype}
+		return metric, &ResourceNotFound{name: rtype}
 	}
 
 	return metric, nil
@@ -438,23 +1031,29 @@ func (r *Ranch) Metric(rtype string) (common.Metric, error) {
 
 // AllMetrics returns a list of Metric objects for all resource types.
 func (r *Ranch) AllMetrics() ([]common.Metric, error) {
-	resources, err := r.Storage.GetResources()
-	if err != nil {
-		logrus.WithError(err).Error("cannot get resources")
-		return nil, err
-	}
+	return r.allMetrics(false)
+}
 
-	metrics := map[string]common.Metric{}
+// AllMetricsByOwner is AllMetrics with the counts of the resources by owner and
+// state filled in.
+func (r *Ranch) AllMetricsByOwner() ([]common.Metric, error) {
+	return r.allMetrics(true)
+}
 
-	for _, res := range resources.Items {
+func (r *Ranch) allMetrics(byOwner bool) ([]common.Metric, error) {
+	metrics := map[string]common.Metric{}
+	if err := r.Storage.ForEachResourceForRead(func(res *crds.ResourceObject) error {
 		metric, ok := metrics[res.Spec.Type]
 		if !ok {
-			metric = common.NewMetric(res.Spec.Type)
+			metric = newMetric(res.Spec.Type, byOwner)
 			metrics[res.Spec.Type] = metric
 		}
 
-		metric.Current[res.Status.State]++
-		metric.Owners[res.Status.Owner]++
+		countResource(metric, res)
+		return nil
+	}); err != nil {
+		logrus.WithError(err).Error("cannot get resources")
+		return nil, err
 	}
 
 	result := make([]common.Metric, 0, len(metrics))
@@ -467,6 +1066,92 @@ func (r *Ranch) AllMetrics() ([]common.Metric, error) {
 	return result, nil
 }
 
+func newMetric(rtype string, byOwner bool) common.Metric {
+	metric := common.NewMetric(rtype)
+	if byOwner {
+		metric.ByOwner = map[string]map[string]int{}
+	}
+	return metric
+}
+
+// countResource adds res to the counts of metric.
+func countResource(metric common.Metric, res *crds.ResourceObject) {
+	metric.Current[res.Status.State]++
+	metric.Owners[res.Status.Owner]++
+	if metric.ByOwner == nil {
+		return
+	}
+	states, ok := metric.ByOwner[res.Status.Owner]
+	if !ok {
+		states = map[string]int{}
+		metric.ByOwner[res.Status.Owner] = states
+	}
+	states[res.Status.State]++
+}
+
+// Queue lists the pending acquire requests along with their rank and estimated
+// wait, sorted by type, state and rank. An empty rType lists all types.
+func (r *Ranch) Queue(rType string) ([]common.QueuedRequest, error) {
+	resources, err := r.Storage.GetResources()
+	if err != nil {
+		logrus.WithError(err).Error("cannot get resources")
+		return nil, err
+	}
+	free := map[acquireRequestPriorityKey]int{}
+	for _, res := range resources.Items {
+		if res.Status.Owner == "" {
+			free[acquireRequestPriorityKey{rType: res.Spec.Type, state: res.Status.State}]++
+		}
+	}
+
+	result := []common.QueuedRequest{}
+	queues := r.requestMgr.list()
+	for key, requests := range queues {
+		ts, ok := key.(acquireRequestPriorityKey)
+		if !ok || (rType != "" && ts.rType != rType) {
+			continue
+		}
+		freeKey := acquireRequestPriorityKey{rType: ts.rType, state: common.Free}
+		health, _ := r.healthOf(ts.rType, func() (int, error) {
+			free := 0
+			for idx := range resources.Items {
+				if isFreeOfType(&resources.Items[idx], ts.rType) {
+					free++
+				}
+			}
+			return free, nil
+		}, len(queues[freeKey]))
+		for idx, req := range requests {
+			queued := common.QueuedRequest{
+				Type:      ts.rType,
+				State:     ts.state,
+				Selector:  ts.selector,
+				RequestID: req.id,
+				Owner:     req.owner,
+				Priority:  req.priority,
+				Rank:      idx + 1,
+				CreatedAt: req.createdAt.Time,
+				Health:    health,
+			}
+			if estimate, ok := r.churn.estimateWait(ts.rType, ts.state, queued.Rank-free[acquireRequestPriorityKey{rType: ts.rType, state: ts.state}]); ok {
+				seconds := estimate.Seconds()
+				queued.EstimatedWaitSeconds = &seconds
+			}
+			result = append(result, queued)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Type != result[j].Type {
+			return result[i].Type < result[j].Type
+		}
+		if result[i].State != result[j].State {
+			return result[i].State < result[j].State
+		}
+		return result[i].Rank < result[j].Rank
+	})
+	return result, nil
+}
+
 // newResourceFromNewDynamicResourceLifeCycle creates a resource from DynamicResourceLifeCycle given a name and a time.
 // Using this method helps make sure all the resources are created the same way.
 func newResourceFromNewDynamicResourceLifeCycle(name string, dlrc *crds.DRLCObject, now metav1.Time) *crds.ResourceObject {
@@ -478,15 +1163,21 @@ func retryOnConflict(backoff wait.Backoff, fn func() error) error {
 }
 
 func isConflict(err error) bool {
-	if kerrors.IsConflict(err) {
+	return matchesAny(err, kerrors.IsConflict)
+}
+
+// matchesAny returns whether err, or any error it wraps or aggregates,
+// matches.
+func matchesAny(err error, matches func(error) bool) bool {
+	if matches(err) {
 		return true
 	}
 	if x, ok := err.(interface{ Unwrap() error }); ok {
-		return isConflict(x.Unwrap())
+		return matchesAny(x.Unwrap(), matches)
 	}
 	if aggregate, ok := err.(utilerrors.Aggregate); ok {
 		for _, err := range aggregate.Errors() {
-			if isConflict(err) {
+			if matchesAny(err, matches) {
 				return true
 			}
 		}
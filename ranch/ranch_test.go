@@ -85,9 +85,11 @@ func makeTestRanch(objects []runtime.Object) *Ranch {
 	nameGen := &nameGenerator{}
 	s.generateName = nameGen.name
 	r, _ := NewRanch("", s, testTTL)
-	r.now = func() metav1.Time {
+	// The queued requests must not expire with the wall clock, as testTTL is
+	// shorter than most tests.
+	r.SetClock(func() metav1.Time {
 		return fakeNow
-	}
+	})
 	return r
 }
 
@@ -129,6 +131,84 @@ func AreErrorsEqual(got error, expect error) bool {
 			}
 		}
 		return false
+	case *HoldExpired:
+		if o, ok := expect.(*HoldExpired); ok {
+			if o.name == got.(*HoldExpired).name {
+				return true
+			}
+		}
+		return false
+	case *LameDuck:
+		_, ok := expect.(*LameDuck)
+		return ok
+	case *CleanupPaused:
+		if o, ok := expect.(*CleanupPaused); ok {
+			return o.rType == got.(*CleanupPaused).rType
+		}
+		return false
+	case *TimeSliced:
+		if o, ok := expect.(*TimeSliced); ok {
+			return o.rType == got.(*TimeSliced).rType
+		}
+		return false
+	case *BookingNotFound:
+		if o, ok := expect.(*BookingNotFound); ok {
+			return o.name == got.(*BookingNotFound).name && o.start.Equal(got.(*BookingNotFound).start)
+		}
+		return false
+	case *TransitionDenied:
+		if o, ok := expect.(*TransitionDenied); ok {
+			return *o == *got.(*TransitionDenied)
+		}
+		return false
+	case *TransitionNotAllowed:
+		if o, ok := expect.(*TransitionNotAllowed); ok {
+			return reflect.DeepEqual(o, got)
+		}
+		return false
+	case *ApprovalPending, *ApprovalDenied, *ApprovalNotFound, *ApprovalNotPending, *ApprovalBacklogFull:
+		return reflect.DeepEqual(expect, got)
+	case *ShardNotAssigned:
+		if o, ok := expect.(*ShardNotAssigned); ok {
+			return *o == *got.(*ShardNotAssigned)
+		}
+		return false
+	case *LockHeld:
+		if o, ok := expect.(*LockHeld); ok {
+			return *o == *got.(*LockHeld)
+		}
+		return false
+	case *TypeRenamed:
+		if o, ok := expect.(*TypeRenamed); ok {
+			return *o == *got.(*TypeRenamed)
+		}
+		return false
+	case *ReadOnly:
+		_, ok := expect.(*ReadOnly)
+		return ok
+	case *NotLeader:
+		_, ok := expect.(*NotLeader)
+		return ok
+	case *RegionNotFound:
+		if o, ok := expect.(*RegionNotFound); ok {
+			return *o == *got.(*RegionNotFound)
+		}
+		return false
+	case *TenantMismatch:
+		if o, ok := expect.(*TenantMismatch); ok {
+			return *o == *got.(*TenantMismatch)
+		}
+		return false
+	case *PolicyDenied:
+		if o, ok := expect.(*PolicyDenied); ok {
+			return *o == *got.(*PolicyDenied)
+		}
+		return false
+	case *UserDataTooLarge:
+		if o, ok := expect.(*UserDataTooLarge); ok {
+			return *o == *got.(*UserDataTooLarge)
+		}
+		return false
 	default:
 		return false
 	}
@@ -172,7 +252,7 @@ func TestAcquire(t *testing.T) {
 			rtype:     "t",
 			state:     "s",
 			dest:      "d",
-			expectErr: &ResourceNotFound{"t"},
+			expectErr: &ResourceNotFound{name: "t"},
 		},
 		{
 			name: common.Busy,
@@ -183,7 +263,7 @@ func TestAcquire(t *testing.T) {
 			rtype:     "t",
 			state:     "s",
 			dest:      "d",
-			expectErr: &ResourceNotFound{"t"},
+			expectErr: &ResourceNotFound{name: "t"},
 		},
 		{
 			name: "ok",
@@ -290,6 +370,69 @@ func TestAcquirePriority(t *testing.T) {
 	}
 }
 
+func TestAcquireByStatePriority(t *testing.T) {
+	r := makeTestRanch([]runtime.Object{
+		newResource("host-1", "host", common.Busy, "someone", startTime),
+		newResource("host-2", "host", common.Free, "", startTime),
+	})
+	// Requests do not expire on a stopped clock.
+	r.SetClock(func() metav1.Time { return fakeNow })
+	names := []string{"host-1", "host-2"}
+
+	// The first waiter waits for all the resources to be available.
+	if res, err := r.AcquireByStateWithPriority(common.Free, common.Busy, "first", names, "request_id_1"); !AreErrorsEqual(err, &ResourceNotFound{name: common.Free}) || len(res) != 0 {
+		t.Errorf("expected to wait for host-1 without acquiring host-2, got %v and %v", res, err)
+	}
+	if res, err := r.AcquireByStateWithPriority(common.Free, common.Busy, "second", []string{"host-2", "host-1"}, "request_id_2"); !AreErrorsEqual(err, &ResourceNotFound{name: common.Free}) || len(res) != 0 {
+		t.Errorf("expected to wait behind request_id_1, got %v and %v", res, err)
+	}
+	if err := r.Release("host-1", common.Free, "someone"); err != nil {
+		t.Fatalf("failed to release: %v", err)
+	}
+	// Neither the second waiter nor requests without priority overtake the first.
+	if _, err := r.AcquireByStateWithPriority(common.Free, common.Busy, "second", names, "request_id_2"); !AreErrorsEqual(err, &ResourceNotFound{name: common.Free}) {
+		t.Errorf("expected request_id_2 to wait behind request_id_1, got %v", err)
+	}
+	if _, err := r.AcquireByState(common.Free, common.Busy, "other", names); !AreErrorsEqual(err, &ResourceNotFound{name: common.Free}) {
+		t.Errorf("expected requests without priority to wait behind request_id_1, got %v", err)
+	}
+	res, err := r.AcquireByStateWithPriority(common.Free, common.Busy, "first", names, "request_id_1")
+	if err != nil || len(res) != 2 {
+		t.Fatalf("expected request_id_1 to acquire both resources, got %v and %v", res, err)
+	}
+	for _, name := range names {
+		if err := r.Release(name, common.Free, "first"); err != nil {
+			t.Fatalf("failed to release: %v", err)
+		}
+	}
+	if res, err := r.AcquireByStateWithPriority(common.Free, common.Busy, "second", names, "request_id_2"); err != nil || len(res) != 2 {
+		t.Errorf("expected request_id_2 to be next, got %v and %v", res, err)
+	}
+}
+
+func TestAcquireByStateSingleNameWaitsBehindSeveral(t *testing.T) {
+	r := makeTestRanch([]runtime.Object{
+		newResource("host-1", "host", common.Busy, "someone", startTime),
+		newResource("host-2", "host", common.Free, "", startTime),
+	})
+	r.SetClock(func() metav1.Time { return fakeNow })
+
+	if _, err := r.AcquireByStateWithPriority(common.Free, common.Busy, "both", []string{"host-1", "host-2"}, "request_id_1"); !AreErrorsEqual(err, &ResourceNotFound{name: common.Free}) {
+		t.Fatalf("expected to wait for host-1, got %v", err)
+	}
+	// A later request for one of the names does not take it from under the
+	// request waiting for all of them.
+	if _, err := r.AcquireByStateWithPriority(common.Free, common.Busy, "one", []string{"host-2"}, "request_id_2"); !AreErrorsEqual(err, &ResourceNotFound{name: common.Free}) {
+		t.Errorf("expected request_id_2 to wait behind request_id_1, got %v", err)
+	}
+	if err := r.Release("host-1", common.Free, "someone"); err != nil {
+		t.Fatalf("failed to release: %v", err)
+	}
+	if res, err := r.AcquireByStateWithPriority(common.Free, common.Busy, "both", []string{"host-1", "host-2"}, "request_id_1"); err != nil || len(res) != 2 {
+		t.Fatalf("expected request_id_1 to acquire both resources, got %v and %v", res, err)
+	}
+}
+
 func TestAcquireRoundRobin(t *testing.T) {
 	var resources []runtime.Object
 	for i := 1; i < 5; i++ {
@@ -404,7 +547,7 @@ func TestRelease(t *testing.T) {
 			resName:   "res",
 			owner:     "user",
 			dest:      "d",
-			expectErr: &ResourceNotFound{"res"},
+			expectErr: &ResourceNotFound{name: "res"},
 		},
 		{
 			name:        "wrong owner",
@@ -421,7 +564,7 @@ func TestRelease(t *testing.T) {
 			resName:   "res",
 			owner:     "user",
 			dest:      "d",
-			expectErr: &ResourceNotFound{"res"},
+			expectErr: &ResourceNotFound{name: "res"},
 		},
 		{
 			name:        "ok",
@@ -603,7 +746,7 @@ func TestUpdate(t *testing.T) {
 			resName:   "res",
 			owner:     "user",
 			state:     "s",
-			expectErr: &ResourceNotFound{"res"},
+			expectErr: &ResourceNotFound{name: "res"},
 		},
 		{
 			name: "wrong owner",
@@ -633,7 +776,7 @@ func TestUpdate(t *testing.T) {
 			resName:   "res",
 			owner:     "merlin",
 			state:     "s",
-			expectErr: &ResourceNotFound{"res"},
+			expectErr: &ResourceNotFound{name: "res"},
 		},
 		{
 			name: "ok",
@@ -678,6 +821,41 @@ func TestUpdate(t *testing.T) {
 	}
 }
 
+func TestUpdateWithProgress(t *testing.T) {
+	c := makeTestRanch([]runtime.Object{newResource("res", "t", common.Busy, "merlin", startTime)})
+	progress := &common.Progress{Phase: "testing", Percent: 40, Message: "running e2e"}
+	if err := c.UpdateWithProgress("res", "merlin", common.Busy, nil, progress); err != nil {
+		t.Fatalf("failed to update: %v", err)
+	}
+	// Heartbeats without progress keep the progress reported last.
+	if err := c.Update("res", "merlin", common.Busy, nil); err != nil {
+		t.Fatalf("failed to update: %v", err)
+	}
+	res, err := c.Storage.GetResource("res")
+	if err != nil {
+		t.Fatalf("failed to get resource: %v", err)
+	}
+	expected := &common.Progress{Phase: "testing", Percent: 40, Message: "running e2e", Reported: fakeNow.Time}
+	got := res.ToResource().Progress
+	// Times lose their location in storage.
+	if got != nil && got.Reported.Equal(expected.Reported) {
+		got.Reported = expected.Reported
+	}
+	if !reflect.DeepEqual(expected, got) {
+		t.Errorf("expected progress %+v, got %+v", expected, got)
+	}
+
+	if err := c.Release("res", common.Dirty, "merlin"); err != nil {
+		t.Fatalf("failed to release: %v", err)
+	}
+	if res, err = c.Storage.GetResource("res"); err != nil {
+		t.Fatalf("failed to get resource: %v", err)
+	}
+	if res.Status.Progress != nil {
+		t.Errorf("expected the progress to be dropped on release, got %+v", res.Status.Progress)
+	}
+}
+
 func TestMetric(t *testing.T) {
 	var testcases = []struct {
 		name         string
@@ -689,7 +867,7 @@ func TestMetric(t *testing.T) {
 		{
 			name:       "ranch has no resource",
 			metricType: "t",
-			expectErr:  &ResourceNotFound{"t"},
+			expectErr:  &ResourceNotFound{name: "t"},
 		},
 		{
 			name: "no matching resource",
@@ -697,7 +875,7 @@ func TestMetric(t *testing.T) {
 				newResource("res", "t", "s", "merlin", metav1.Now()),
 			},
 			metricType: "foo",
-			expectErr:  &ResourceNotFound{"foo"},
+			expectErr:  &ResourceNotFound{name: "foo"},
 		},
 		{
 			name: "one resource",
@@ -756,6 +934,41 @@ func TestMetric(t *testing.T) {
 	}
 }
 
+func TestMetricByOwner(t *testing.T) {
+	c := makeTestRanch([]runtime.Object{
+		newResource("res-1", "t", "busy", "merlin", metav1.Now()),
+		newResource("res-2", "t", "busy", "pony", metav1.Now()),
+		newResource("res-3", "t", "cleaning", "merlin", metav1.Now()),
+		newResource("res-4", "t", "free", "", metav1.Now()),
+		newResource("res-5", "foo", "busy", "merlin", metav1.Now()),
+	})
+	expectByOwner := map[string]map[string]int{
+		"merlin": {"busy": 1, "cleaning": 1},
+		"pony":   {"busy": 1},
+		"":       {"free": 1},
+	}
+
+	metric, err := c.MetricByOwner("t")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(metric.ByOwner, expectByOwner) {
+		t.Errorf("wrong counts by owner, got %v, want %v", metric.ByOwner, expectByOwner)
+	}
+
+	metrics, err := c.AllMetricsByOwner()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(metrics) != 2 || !reflect.DeepEqual(metrics[1].ByOwner, expectByOwner) {
+		t.Errorf("wrong metrics by owner, got %v", metrics)
+	}
+
+	if metric, err := c.Metric("t"); err != nil || metric.ByOwner != nil {
+		t.Errorf("expected no counts by owner unless requested, got %v, %v", metric.ByOwner, err)
+	}
+}
+
 func TestAllMetrics(t *testing.T) {
 	var testcases = []struct {
 		name          string
@@ -849,6 +1062,11 @@ func setExpiration(res *crds.ResourceObject, exp metav1.Time) *crds.ResourceObje
 	return res
 }
 
+func setCreation(res *crds.ResourceObject, created metav1.Time) *crds.ResourceObject {
+	res.CreationTimestamp = created
+	return res
+}
+
 func TestSyncResources(t *testing.T) {
 	var testcases = []struct {
 		name        string
@@ -928,6 +1146,27 @@ func TestSyncResources(t *testing.T) {
 				},
 			}},
 		},
+		{
+			name: "initial states of new resources",
+			currentRes: []runtime.Object{
+				newResource("res-1", "t", common.Busy, "", startTime),
+			},
+			config: &common.BoskosConfig{
+				Resources: []common.ResourceEntry{
+					{
+						Type:          "t",
+						State:         common.Free,
+						Names:         []string{"res-1", "res-2", "res-3"},
+						InitialStates: map[string]string{"res-1": common.Dirty, "res-2": common.Dirty},
+					},
+				},
+			},
+			expectedRes: &crds.ResourceObjectList{Items: []crds.ResourceObject{
+				*newResource("res-1", "t", common.Busy, "", startTime),
+				*newResource("res-2", "t", common.Dirty, "", fakeNow),
+				*newResource("res-3", "t", common.Free, "", fakeNow),
+			}},
+		},
 		{
 			name: "should not change anything",
 			currentRes: []runtime.Object{
@@ -1518,6 +1757,7 @@ func TestSyncResources(t *testing.T) {
 }
 
 func TestUpdateAllDynamicResources(t *testing.T) {
+	oneHour := time.Hour
 	var testcases = []struct {
 		name        string
 		currentRes  []runtime.Object
@@ -1776,6 +2016,43 @@ func TestUpdateAllDynamicResources(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "retire resources past their max lifetime",
+			currentRes: []runtime.Object{
+				setCreation(newResource("dt_1", "dt", common.Free, "", startTime), fakeTime(startTime.Add(-2*time.Hour))),
+				setCreation(newResource("dt_2", "dt", common.Free, "", startTime), fakeTime(startTime.Add(-30*time.Minute))),
+				setCreation(newResource("dt_3", "dt", common.Busy, "owner", startTime), fakeTime(startTime.Add(-2*time.Hour))),
+				setCreation(newResource("dt_4", "dt", common.Dirty, "", startTime), fakeTime(startTime.Add(-2*time.Hour))),
+				&crds.DRLCObject{
+					ObjectMeta: metav1.ObjectMeta{Name: "dt"},
+					Spec: crds.DRLCSpec{
+						MinCount:    3,
+						MaxCount:    4,
+						MaxLifetime: &oneHour,
+					},
+				},
+			},
+			expectedRes: &crds.ResourceObjectList{
+				Items: []crds.ResourceObject{
+					*setCreation(newResource("dt_1", "dt", common.ToBeDeleted, "", fakeNow), fakeTime(startTime.Add(-2*time.Hour))),
+					*setCreation(newResource("dt_2", "dt", common.Free, "", startTime), fakeTime(startTime.Add(-30*time.Minute))),
+					*setCreation(newResource("dt_3", "dt", common.Busy, "owner", startTime), fakeTime(startTime.Add(-2*time.Hour))),
+					*setCreation(newResource("dt_4", "dt", common.ToBeDeleted, "", fakeNow), fakeTime(startTime.Add(-2*time.Hour))),
+				},
+			},
+			expectedLCs: &crds.DRLCObjectList{
+				Items: []crds.DRLCObject{
+					{
+						ObjectMeta: metav1.ObjectMeta{Name: "dt"},
+						Spec: crds.DRLCSpec{
+							MinCount:    3,
+							MaxCount:    4,
+							MaxLifetime: &oneHour,
+						},
+					},
+				},
+			},
+		},
 		{
 			name: "delete DRLC when all resources tombstoned",
 			currentRes: []runtime.Object{
@@ -1987,6 +2264,7 @@ func TestIsConflict(t *testing.T) {
 	}
 
 	for _, tc := range testCases {
+		tc := tc
 		t.Run(tc.name, func(t *testing.T) {
 			t.Parallel()
 			if result := isConflict(tc.err); result != tc.shouldMatch {
@@ -0,0 +1,105 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ReadOnly will be returned by changes of the storage while the ranch is in
+// read-only mode.
+type ReadOnly struct{}
+
+func (ReadOnly) Error() string {
+	return "boskos is in read-only mode while its storage is investigated and does not accept changes, try again later."
+}
+
+// NotLeader will be returned by changes of the storage while the ranch is a
+// follower.
+type NotLeader struct{}
+
+func (NotLeader) Error() string {
+	return "this boskos replica is not the leader and does not accept changes, send them to the leader."
+}
+
+// SetReadOnly puts the ranch in or out of read-only mode. In read-only mode,
+// every change of the storage is rejected, including those of the config sync
+// and of the background work like lease expiry, so that operators can freeze
+// the state while investigating a corrupted store. Listings keep working.
+func (r *Ranch) SetReadOnly(enabled bool) {
+	var value int32
+	if enabled {
+		value = 1
+	}
+	if old := atomic.SwapInt32(&r.Storage.readOnly, value); old != value {
+		logrus.WithField("read-only", enabled).Warning("Changed read-only mode")
+	}
+}
+
+// ReadOnlyMode returns whether the ranch is in read-only mode, which
+// followers always are.
+func (r *Ranch) ReadOnlyMode() bool {
+	return r.Storage.readOnlyMode()
+}
+
+// SetFollower makes the ranch a follower of the leader of its replicas, or
+// the leader once elected. Followers reject every change of the storage, like
+// in read-only mode, so the leader alone changes it, and keep serving
+// listings. Leaving read-only mode does not make a follower writable.
+func (r *Ranch) SetFollower(enabled bool) {
+	var value int32
+	if enabled {
+		value = 1
+	}
+	if old := atomic.SwapInt32(&r.Storage.follower, value); old != value {
+		logrus.WithField("follower", enabled).Warning("Changed leadership")
+	}
+}
+
+// Follower returns whether the ranch is a follower.
+func (r *Ranch) Follower() bool {
+	return atomic.LoadInt32(&r.Storage.follower) == 1
+}
+
+func (s *Storage) readOnlyMode() bool {
+	return atomic.LoadInt32(&s.readOnly) == 1 || atomic.LoadInt32(&s.follower) == 1
+}
+
+// writeError returns the error rejecting changes, if they are rejected.
+func (s *Storage) writeError() error {
+	switch {
+	case atomic.LoadInt32(&s.follower) == 1:
+		return &NotLeader{}
+	case atomic.LoadInt32(&s.readOnly) == 1:
+		return &ReadOnly{}
+	}
+	return nil
+}
+
+// WriteError returns NotLeader for followers, ReadOnly in read-only mode, or
+// nil if the ranch accepts changes.
+func (r *Ranch) WriteError() error {
+	return r.Storage.writeError()
+}
+
+// checkWritable returns a NotLeader error for followers and a ReadOnly error
+// in read-only mode.
+func (s *Storage) checkWritable() error {
+	return s.writeError()
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+func TestReadOnly(t *testing.T) {
+	r := makeTestRanch([]runtime.Object{
+		newResource("leased", "t", common.Busy, "owner", startTime),
+		newResource("free", "t", common.Free, "", startTime),
+	})
+	r.SetReadOnly(true)
+
+	if _, _, err := r.Acquire("t", common.Free, common.Busy, "other", "request"); err == nil {
+		t.Error("expected acquire to be rejected")
+	}
+	if err := r.Release("leased", common.Dirty, "owner"); err == nil {
+		t.Error("expected release to be rejected")
+	}
+	if err := r.Storage.DeleteResource("free"); !AreErrorsEqual(err, &ReadOnly{}) {
+		t.Errorf("expected a ReadOnly error, got %v", err)
+	}
+	config := &common.BoskosConfig{Resources: []common.ResourceEntry{{Type: "t", State: common.Free, Names: []string{"new"}}}}
+	if err := r.ApplyConfig(config); !AreErrorsEqual(err, &ReadOnly{}) {
+		t.Errorf("expected the config sync to be rejected, got %v", err)
+	}
+	resources, err := r.Storage.GetResources()
+	if err != nil {
+		t.Fatalf("expected listings to keep working, got %v", err)
+	}
+	for _, res := range resources.Items {
+		if res.Name == "leased" && (res.Status.Owner != "owner" || res.Status.State != common.Busy) {
+			t.Errorf("expected the leased resource to be unchanged, got %+v", res.Status)
+		}
+		if res.Name == "free" && res.Status.Owner != "" {
+			t.Errorf("expected the free resource to stay free, got owner %s", res.Status.Owner)
+		}
+	}
+	if len(resources.Items) != 2 {
+		t.Errorf("expected 2 resources, got %d", len(resources.Items))
+	}
+
+	r.SetReadOnly(false)
+	if err := r.Release("leased", common.Dirty, "owner"); err != nil {
+		t.Errorf("expected release to succeed once out of read-only mode, got %v", err)
+	}
+}
+
+func TestFollowerConfigSync(t *testing.T) {
+	r := makeTestRanch([]runtime.Object{newResource("res", "t", common.Free, "", startTime)})
+	r.SetFollower(true)
+
+	config := &common.BoskosConfig{Resources: []common.ResourceEntry{{Type: "t", State: common.Free, Names: []string{"new"}, Aliases: []common.TypeAlias{{Name: "old"}}}}}
+	if err := r.ApplyConfig(config); err != nil {
+		t.Errorf("expected the follower to keep the config, got %v", err)
+	}
+	if rType, _, err := r.ResolveType("old"); err != nil || rType != "t" {
+		t.Errorf("expected the follower to resolve the aliases of the config, got %q, %v", rType, err)
+	}
+	if res, err := r.Storage.GetResource("res"); err != nil || res.Status.State != common.Free {
+		t.Errorf("expected the resource missing from the config not to be tombstoned, got %v, %v", res, err)
+	}
+	if _, err := r.Storage.GetResource("new"); err == nil {
+		t.Error("expected the sync of the resources to be left to the leader")
+	}
+
+	r.SetFollower(false)
+	if err := r.ApplyConfig(config); err != nil {
+		t.Errorf("expected the leader to sync the config, got %v", err)
+	}
+}
@@ -0,0 +1,227 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/crds"
+)
+
+// regionUsageTTL is how long a usage report is trusted. Regions whose janitor
+// stopped reporting are placed in as if they never reported.
+const regionUsageTTL = time.Hour
+
+// RegionNotFound will be returned if the region is not a region of the type.
+type RegionNotFound struct {
+	rType, region string
+}
+
+func (r RegionNotFound) Error() string {
+	return fmt.Sprintf("region %s is not a region of type %s", r.region, r.rType)
+}
+
+// regionUsage is the last quota usage reported for a region.
+type regionUsage struct {
+	used, limit int
+	// placed counts the resources placed in the region since the report.
+	placed   int
+	reported time.Time
+}
+
+// headroom is how much of the quota of the region is left, accounting for the
+// resources placed since the report.
+func (u *regionUsage) headroom() int {
+	return u.limit - u.used - u.placed
+}
+
+// regionTracker holds the regions of the dynamic resource types, and the quota
+// usage janitors report for them, so new resources are placed where quota is
+// left.
+type regionTracker struct {
+	lock sync.Mutex
+	// regions are the regions of each type, in config order.
+	regions map[string][]string
+	usage   map[string]map[string]*regionUsage
+}
+
+func newRegionTracker() *regionTracker {
+	return &regionTracker{regions: map[string][]string{}, usage: map[string]map[string]*regionUsage{}}
+}
+
+func (t *regionTracker) set(config *common.BoskosConfig) {
+	regions := map[string][]string{}
+	for _, entry := range config.Resources {
+		if len(entry.Regions) > 0 {
+			regions[entry.Type] = entry.Regions
+		}
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.regions = regions
+	// Keep the usage of the regions still configured, so a config sync does
+	// not wait for the next reports.
+	for rType, usage := range t.usage {
+		configured := map[string]bool{}
+		for _, region := range regions[rType] {
+			configured[region] = true
+		}
+		for region := range usage {
+			if !configured[region] {
+				delete(usage, region)
+			}
+		}
+		if len(usage) == 0 {
+			delete(t.usage, rType)
+		}
+	}
+}
+
+func (t *regionTracker) report(rType, region string, used, limit int, now time.Time) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	regions, ok := t.regions[rType]
+	if !ok {
+		return &ResourceTypeNotFound{rType: rType}
+	}
+	known := false
+	for _, r := range regions {
+		known = known || r == region
+	}
+	if !known {
+		return &RegionNotFound{rType: rType, region: region}
+	}
+	if t.usage[rType] == nil {
+		t.usage[rType] = map[string]*regionUsage{}
+	}
+	t.usage[rType][region] = &regionUsage{used: used, limit: limit, reported: now}
+	return nil
+}
+
+// place picks the region of a new resource of rType given the existing
+// resources, or returns "" if rType has no regions. The region with the most
+// headroom is picked among the regions with a recent report and quota left.
+// Otherwise the region with the fewest resources is picked, among the regions
+// without a recent report if there are any, as the others are exhausted.
+func (t *regionTracker) place(rType string, resources []crds.ResourceObject, now time.Time) string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	regions := t.regions[rType]
+	if len(regions) == 0 {
+		return ""
+	}
+
+	var best *regionUsage
+	var picked string
+	var unreported []string
+	for _, region := range regions {
+		usage, ok := t.usage[rType][region]
+		if !ok || now.Sub(usage.reported) > regionUsageTTL {
+			unreported = append(unreported, region)
+			continue
+		}
+		if usage.headroom() > 0 && (best == nil || usage.headroom() > best.headroom()) {
+			best, picked = usage, region
+		}
+	}
+	if best != nil {
+		best.placed++
+		return picked
+	}
+
+	candidates := regions
+	if len(unreported) > 0 {
+		candidates = unreported
+	}
+	counts := map[string]int{}
+	for _, res := range resources {
+		if res.Spec.Type == rType {
+			counts[res.Status.UserData[common.RegionUserDataKey]]++
+		}
+	}
+	picked = candidates[0]
+	for _, region := range candidates[1:] {
+		if counts[region] < counts[picked] {
+			picked = region
+		}
+	}
+	if usage, ok := t.usage[rType][picked]; ok {
+		usage.placed++
+	}
+	return picked
+}
+
+func (t *regionTracker) list() []common.RegionUsage {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	var usages []common.RegionUsage
+	for rType, usage := range t.usage {
+		for region, u := range usage {
+			usages = append(usages, common.RegionUsage{
+				Type:     rType,
+				Region:   region,
+				Used:     u.used,
+				Limit:    u.limit,
+				Placed:   u.placed,
+				Reported: u.reported,
+			})
+		}
+	}
+	sort.Slice(usages, func(i, j int) bool {
+		if usages[i].Type != usages[j].Type {
+			return usages[i].Type < usages[j].Type
+		}
+		return usages[i].Region < usages[j].Region
+	})
+	return usages
+}
+
+// placeInRegion records in the user data of res, a new dynamic resource, the
+// region picked for it given the existing resources.
+func (s *Storage) placeInRegion(res *crds.ResourceObject, resources []crds.ResourceObject) {
+	if s.regions == nil {
+		return
+	}
+	if region := s.regions.place(res.Spec.Type, resources, s.now().Time); region != "" {
+		res.Status.UserData[common.RegionUserDataKey] = region
+	}
+}
+
+// ReportRegionUsage records the quota usage of rType in region reported by a
+// janitor, which new dynamic resources of rType are placed according to.
+// Out: nil on success, or
+//      ResourceTypeNotFound error if rType has no regions, or
+//      RegionNotFound error if region is not one of them.
+func (r *Ranch) ReportRegionUsage(rType, region string, used, limit int) error {
+	if err := r.Storage.regions.report(rType, region, used, limit, r.now().Time); err != nil {
+		return err
+	}
+	logrus.WithFields(logrus.Fields{"type": rType, "region": region, "used": used, "limit": limit}).Info("Reported region usage")
+	return nil
+}
+
+// RegionUsage returns the quota usage reported for the regions, sorted by type
+// and region.
+func (r *Ranch) RegionUsage() []common.RegionUsage {
+	return r.Storage.regions.list()
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/crds"
+)
+
+func TestRegionPlacement(t *testing.T) {
+	type report struct {
+		region      string
+		used, limit int
+		age         time.Duration
+	}
+	testCases := []struct {
+		name          string
+		reports       []report
+		existing      map[string]int
+		create        int
+		expectRegions map[string]int
+	}{
+		{
+			name:          "no reports spreads evenly",
+			existing:      map[string]int{"a": 1},
+			create:        2,
+			expectRegions: map[string]int{"a": 1, "b": 1, "c": 1},
+		},
+		{
+			name: "most headroom first",
+			reports: []report{
+				{region: "a", used: 9, limit: 10},
+				{region: "b", used: 0, limit: 3},
+				{region: "c", used: 3, limit: 5},
+			},
+			create:        4,
+			expectRegions: map[string]int{"a": 1, "b": 2, "c": 1},
+		},
+		{
+			name: "exhausted regions are avoided",
+			reports: []report{
+				{region: "a", used: 10, limit: 10},
+				{region: "b", used: 5, limit: 5},
+			},
+			existing:      map[string]int{"c": 3},
+			create:        2,
+			expectRegions: map[string]int{"c": 5},
+		},
+		{
+			name: "stale reports are ignored",
+			reports: []report{
+				{region: "a", used: 0, limit: 10, age: 2 * regionUsageTTL},
+				{region: "b", used: 10, limit: 10},
+				{region: "c", used: 10, limit: 10},
+			},
+			create:        1,
+			expectRegions: map[string]int{"a": 1},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			objects := []runtime.Object{
+				&crds.DRLCObject{
+					ObjectMeta: metav1.ObjectMeta{Name: "dr"},
+					Spec:       crds.DRLCSpec{MaxCount: 10, InitialState: common.Free},
+				},
+			}
+			for region, count := range tc.existing {
+				for i := 0; i < count; i++ {
+					res := newResource(region+string(rune('0'+i)), "dr", common.Busy, "someone", startTime)
+					res.Status.UserData = map[string]string{common.RegionUserDataKey: region}
+					objects = append(objects, res)
+				}
+			}
+			r := makeTestRanch(objects)
+			r.Storage.regions.set(&common.BoskosConfig{Resources: []common.ResourceEntry{
+				{Type: "dr", MaxCount: 10, Regions: []string{"a", "b", "c"}},
+			}})
+			for _, rep := range tc.reports {
+				r.now = func() metav1.Time { return metav1.NewTime(fakeNow.Add(-rep.age)) }
+				if err := r.ReportRegionUsage("dr", rep.region, rep.used, rep.limit); err != nil {
+					t.Fatalf("failed to report usage: %v", err)
+				}
+			}
+			r.now = func() metav1.Time { return fakeNow }
+
+			if _, err := r.DeclareDemand("dr", tc.create, 0, time.Minute); err != nil {
+				t.Fatalf("failed to declare demand: %v", err)
+			}
+			resources, err := r.Storage.GetResources()
+			if err != nil {
+				t.Fatalf("failed to get resources: %v", err)
+			}
+			regions := map[string]int{}
+			for _, res := range resources.Items {
+				regions[res.Status.UserData[common.RegionUserDataKey]]++
+			}
+			if !reflect.DeepEqual(tc.expectRegions, regions) {
+				t.Errorf("expected resources in regions %v, got %v", tc.expectRegions, regions)
+			}
+		})
+	}
+}
+
+func TestReportRegionUsage(t *testing.T) {
+	r := makeTestRanch(nil)
+	r.Storage.regions.set(&common.BoskosConfig{Resources: []common.ResourceEntry{
+		{Type: "dr", MaxCount: 1, Regions: []string{"a"}},
+	}})
+	if err := r.ReportRegionUsage("other", "a", 1, 2); !AreErrorsEqual(err, &ResourceTypeNotFound{rType: "other"}) {
+		t.Errorf("expected a ResourceTypeNotFound error, got %v", err)
+	}
+	if err := r.ReportRegionUsage("dr", "b", 1, 2); !AreErrorsEqual(err, &RegionNotFound{rType: "dr", region: "b"}) {
+		t.Errorf("expected a RegionNotFound error, got %v", err)
+	}
+	if err := r.ReportRegionUsage("dr", "a", 1, 2); err != nil {
+		t.Fatalf("failed to report usage: %v", err)
+	}
+	expected := []common.RegionUsage{{Type: "dr", Region: "a", Used: 1, Limit: 2, Reported: fakeNow.Time}}
+	if usage := r.RegionUsage(); !reflect.DeepEqual(expected, usage) {
+		t.Errorf("expected usage %v, got %v", expected, usage)
+	}
+
+	// Regions dropped from the config lose their usage.
+	r.Storage.regions.set(&common.BoskosConfig{Resources: []common.ResourceEntry{
+		{Type: "dr", MaxCount: 1, Regions: []string{"b"}},
+	}})
+	if usage := r.RegionUsage(); len(usage) != 0 {
+		t.Errorf("expected no usage, got %v", usage)
+	}
+}
@@ -0,0 +1,40 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"errors"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SetConfigReloader sets how the config is reloaded on demand, e.g. reading
+// the config file again, as the ranch does not know where its config is from.
+func (r *Ranch) SetConfigReloader(reload func() error) {
+	r.reloadConfig = reload
+}
+
+// ReloadConfig forces a sync of the config, for when watching the config
+// file misses updates, like atomic symlink swaps, or the config does not come
+// from a file.
+func (r *Ranch) ReloadConfig() error {
+	if r.reloadConfig == nil {
+		return errors.New("no config to reload")
+	}
+	logrus.Info("Reloading config.")
+	return r.reloadConfig()
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/crds"
+)
+
+// MaxReservationLength bounds the window of a reservation.
+const MaxReservationLength = 7 * 24 * time.Hour
+
+// Reserve books a resource of rType for owner from start to end, for types
+// which are not time-sliced. Reservations are kept in the calendar of the
+// resources like the bookings of time slices: once the window starts, the
+// resource is held out of the free pool and handed to owner in the busy state,
+// and it is released as dirty once the window ends. Resources holding no
+// reservation are preferred, and a window starting right away is only booked
+// on a free resource.
+// Out: The booking on success, or
+//      TimeSliced error if rType is time-sliced, or
+//      ResourceTypeNotFound error if there is no resource of rType, or
+//      ResourceNotFound error if no resource is available for the window.
+func (r *Ranch) Reserve(rType, owner string, start, end time.Time) (*common.Booking, error) {
+	if err := r.admitTenant(rType); err != nil {
+		return nil, err
+	}
+	if _, ok := r.slices.get(rType); ok {
+		return nil, &TimeSliced{rType: rType}
+	}
+	now := r.now().Time
+	if start.Before(now) {
+		// Bookings are cancelled by their start in RFC3339.
+		start = now.Truncate(time.Second)
+	}
+
+	var booking *common.Booking
+	if err := retryOnConflict(retry.DefaultBackoff, func() error {
+		resources, err := r.Storage.GetResources()
+		if err != nil {
+			logrus.WithError(err).Errorf("could not get resources")
+			return &ResourceNotFound{name: rType}
+		}
+		var candidates []crds.ResourceObject
+		typeCount := 0
+		for _, res := range resources.Items {
+			if res.Spec.Type != rType {
+				continue
+			}
+			typeCount++
+			if res.Status.State == common.ToBeDeleted || res.Status.State == common.Tombstone {
+				continue
+			}
+			if overlaps(res.Status.Bookings, start, end) {
+				continue
+			}
+			if !start.After(now) && (res.Status.State != common.Free || res.Status.Owner != "" || res.Status.CredentialsExposed) {
+				continue
+			}
+			candidates = append(candidates, res)
+		}
+		if typeCount == 0 {
+			return &ResourceTypeNotFound{rType: rType}
+		}
+		if len(candidates) == 0 {
+			return &ResourceNotFound{name: rType}
+		}
+		sort.Slice(candidates, func(i, j int) bool {
+			if len(candidates[i].Status.Bookings) != len(candidates[j].Status.Bookings) {
+				return len(candidates[i].Status.Bookings) < len(candidates[j].Status.Bookings)
+			}
+			return candidates[i].Name < candidates[j].Name
+		})
+
+		res := candidates[0]
+		b := crds.Booking{Owner: owner, Start: metav1.NewTime(start), End: metav1.NewTime(end)}
+		res.Status.Bookings = append(res.Status.Bookings, b)
+		sort.Slice(res.Status.Bookings, func(i, j int) bool {
+			return res.Status.Bookings[i].Start.Before(&res.Status.Bookings[j].Start)
+		})
+		if _, err := r.Storage.UpdateResource(&res); err != nil {
+			return err
+		}
+		reserved := toBooking(&res, b)
+		booking = &reserved
+		return nil
+	}); err != nil {
+		switch err.(type) {
+		case *ResourceNotFound, *ResourceTypeNotFound:
+		default:
+			logrus.WithError(err).Error("Reserve failed")
+		}
+		return nil, err
+	}
+	logrus.WithFields(logrus.Fields{"resource": booking.Name, "owner": owner, "start": booking.Start, "end": booking.End}).Info("Reserved resource")
+	r.RotateSlices()
+	return booking, nil
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/crds"
+)
+
+func TestReserve(t *testing.T) {
+	reservedRes := newResource("res-1", "u", common.Free, "", startTime)
+	reservedRes.Status.Bookings = []crds.Booking{booked("someone", at(12, 0), at(14, 0))}
+
+	testCases := []struct {
+		name       string
+		resources  []runtime.Object
+		rType      string
+		start, end time.Time
+		expect     *common.Booking
+		expectErr  error
+	}{
+		{
+			name:      "time-sliced type is booked instead",
+			resources: []runtime.Object{newResource("res-1", "t", common.Free, "", startTime)},
+			rType:     "t",
+			start:     at(12, 0),
+			end:       at(13, 0),
+			expectErr: &TimeSliced{rType: "t"},
+		},
+		{
+			name:      "unknown type",
+			resources: []runtime.Object{newResource("res-1", "u", common.Free, "", startTime)},
+			rType:     "v",
+			start:     at(12, 0),
+			end:       at(13, 0),
+			expectErr: &ResourceTypeNotFound{rType: "v"},
+		},
+		{
+			name:      "future window is reserved on a busy resource",
+			resources: []runtime.Object{newResource("res-1", "u", common.Busy, "someone", startTime)},
+			rType:     "u",
+			start:     at(12, 0),
+			end:       at(13, 0),
+			expect:    &common.Booking{Name: "res-1", Type: "u", Owner: "owner", Start: at(12, 0), End: at(13, 0)},
+		},
+		{
+			name:      "window starting now needs a free resource",
+			resources: []runtime.Object{newResource("res-1", "u", common.Busy, "someone", startTime)},
+			rType:     "u",
+			start:     at(9, 0),
+			end:       at(13, 0),
+			expectErr: &ResourceNotFound{name: "u"},
+		},
+		{
+			name:      "overlapping reservation picks another resource",
+			resources: []runtime.Object{reservedRes.DeepCopy(), newResource("res-2", "u", common.Free, "", startTime)},
+			rType:     "u",
+			start:     at(13, 0),
+			end:       at(15, 0),
+			expect:    &common.Booking{Name: "res-2", Type: "u", Owner: "owner", Start: at(13, 0), End: at(15, 0)},
+		},
+		{
+			name:      "unreserved resources are preferred",
+			resources: []runtime.Object{reservedRes.DeepCopy(), newResource("res-2", "u", common.Free, "", startTime)},
+			rType:     "u",
+			start:     at(15, 0),
+			end:       at(16, 0),
+			expect:    &common.Booking{Name: "res-2", Type: "u", Owner: "owner", Start: at(15, 0), End: at(16, 0)},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			now := at(10, 0)
+			r := makeSlicedRanch(tc.resources, &now)
+			booking, err := r.Reserve(tc.rType, "owner", tc.start, tc.end)
+			if !AreErrorsEqual(err, tc.expectErr) {
+				t.Fatalf("expected error %v, got %v", tc.expectErr, err)
+			}
+			if tc.expect != nil && (booking == nil || *booking != *tc.expect) {
+				t.Errorf("expected booking %+v, got %+v", tc.expect, booking)
+			}
+		})
+	}
+}
+
+func TestReservationHoldsResourceOutOfFreePool(t *testing.T) {
+	now := at(10, 0)
+	r := makeSlicedRanch([]runtime.Object{newResource("res", "u", common.Free, "", startTime)}, &now)
+	if _, err := r.Reserve("u", "owner", at(11, 0), at(12, 0)); err != nil {
+		t.Fatalf("failed to reserve: %v", err)
+	}
+	res, _, err := r.Acquire("u", common.Free, common.Busy, "someone", "")
+	if err != nil {
+		t.Fatalf("expected the resource to be acquirable before the reservation, got %v", err)
+	}
+	if err := r.Release(res.Name, common.Free, "someone"); err != nil {
+		t.Fatalf("failed to release: %v", err)
+	}
+
+	// The window starts, but the resource is not rotated yet.
+	now = at(11, 0)
+	if _, _, err := r.Acquire("u", common.Free, common.Busy, "someone", ""); !AreErrorsEqual(err, &ResourceNotFound{name: "u"}) {
+		t.Errorf("expected the reserved resource not to be handed out, got %v", err)
+	}
+	r.RotateSlices()
+	if res, err = r.Storage.GetResource("res"); err != nil {
+		t.Fatalf("failed to get resource: %v", err)
+	}
+	if res.Status.State != common.Busy || res.Status.Owner != "owner" {
+		t.Errorf("expected the resource to be busy for owner, got %+v", res.Status)
+	}
+
+	now = at(12, 0)
+	r.RotateSlices()
+	if res, err = r.Storage.GetResource("res"); err != nil {
+		t.Fatalf("failed to get resource: %v", err)
+	}
+	if res.Status.State != common.Dirty || res.Status.Owner != "" || len(res.Status.Bookings) != 0 {
+		t.Errorf("expected the resource to be released as dirty, got %+v", res.Status)
+	}
+}
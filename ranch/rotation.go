@@ -0,0 +1,147 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/client-go/util/retry"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/crds"
+)
+
+// CredentialRotator issues new credentials for a resource and revokes the
+// ones stored in its user data.
+type CredentialRotator interface {
+	// Rotate returns the user data entries holding the new credentials. key is
+	// the user data key configured for the resource type.
+	Rotate(name, key string, userData map[string]string) (map[string]string, error)
+}
+
+// rotationManager holds the credential rotation of each resource type, and the
+// registered rotators.
+type rotationManager struct {
+	lock      sync.RWMutex
+	rotations map[string]common.CredentialRotation
+	rotators  map[string]CredentialRotator
+}
+
+func newRotationManager() *rotationManager {
+	return &rotationManager{
+		rotations: map[string]common.CredentialRotation{},
+		rotators:  map[string]CredentialRotator{},
+	}
+}
+
+func (m *rotationManager) set(config *common.BoskosConfig) {
+	rotations := map[string]common.CredentialRotation{}
+	for _, entry := range config.Resources {
+		if entry.CredentialRotation != nil {
+			rotations[entry.Type] = *entry.CredentialRotation
+		}
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.rotations = rotations
+}
+
+func (m *rotationManager) get(rType string) (common.CredentialRotation, CredentialRotator, bool) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	rotation, ok := m.rotations[rType]
+	if !ok {
+		return rotation, nil, false
+	}
+	return rotation, m.rotators[rotation.Rotator], true
+}
+
+// expose flags res so its credentials are rotated once it is released. It must
+// be called whenever a resource is handed out.
+func (m *rotationManager) expose(res *crds.ResourceObject) {
+	if _, _, ok := m.get(res.Spec.Type); ok {
+		res.Status.CredentialsExposed = true
+	}
+}
+
+// RegisterCredentialRotator registers the rotator used by the resource types
+// whose credential rotation names it.
+func (r *Ranch) RegisterCredentialRotator(name string, rotator CredentialRotator) {
+	r.rotations.lock.Lock()
+	defer r.rotations.lock.Unlock()
+	r.rotations.rotators[name] = rotator
+}
+
+// RotateCredentials rotates the credentials of the released resources whose
+// credentials were handed out. Those resources are not handed out again until
+// then, so failed rotations are retried on the next run. It returns how many
+// resources it rotated.
+func (r *Ranch) RotateCredentials() int {
+	resources, err := r.Storage.GetResources()
+	if err != nil {
+		logrus.WithError(err).Error("cannot get resources")
+		return 0
+	}
+	var rotated int
+	for idx := range resources.Items {
+		res := resources.Items[idx]
+		if !res.Status.CredentialsExposed || res.Status.Owner != "" {
+			continue
+		}
+		logger := logrus.WithField("resource", res.Name)
+		rotation, rotator, ok := r.rotations.get(res.Spec.Type)
+		var updates map[string]string
+		switch {
+		case !ok:
+			logger.Info("Credential rotation is not configured anymore")
+		case rotator == nil:
+			logger.Errorf("Credential rotator %s is not registered", rotation.Rotator)
+			continue
+		default:
+			if updates, err = rotator.Rotate(res.Name, rotation.CredentialsKey(), res.Status.UserData); err != nil {
+				logger.WithError(err).Error("Failed to rotate credentials")
+				continue
+			}
+		}
+		// The previous credentials are revoked already, so conflicts must not
+		// lose the new ones.
+		if err := retryOnConflict(retry.DefaultBackoff, func() error {
+			current, err := r.Storage.GetResource(res.Name)
+			if err != nil {
+				return err
+			}
+			if current.Status.UserData == nil {
+				current.Status.UserData = map[string]string{}
+			}
+			for key, value := range updates {
+				current.Status.UserData[key] = value
+			}
+			current.Status.CredentialsExposed = false
+			_, err = r.Storage.UpdateResource(current)
+			return err
+		}); err != nil {
+			logger.WithError(err).Error("Failed to store rotated credentials")
+			continue
+		}
+		if ok {
+			logger.Info("Rotated credentials")
+			rotated++
+		}
+	}
+	return rotated
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+type fakeRotator struct {
+	rotations int
+	err       error
+}
+
+func (f *fakeRotator) Rotate(_, key string, _ map[string]string) (map[string]string, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	f.rotations++
+	return map[string]string{key: fmt.Sprintf("secret-%d", f.rotations)}, nil
+}
+
+func TestRotateCredentials(t *testing.T) {
+	testCases := []struct {
+		name          string
+		rotateErr     error
+		expectRotated int
+		expectSecret  string
+		expectExposed bool
+	}{
+		{
+			name:          "released credentials are rotated",
+			expectRotated: 1,
+			expectSecret:  "secret-1",
+		},
+		{
+			name:          "failed rotation keeps the resource from being handed out",
+			rotateErr:     errors.New("injected"),
+			expectSecret:  "initial",
+			expectExposed: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res := newResource("res", "t", common.Free, "", startTime)
+			res.Status.UserData[common.DefaultCredentialsKey] = "initial"
+			r := makeTestRanch([]runtime.Object{res})
+			r.RegisterCredentialRotator(common.StaticRotator, &fakeRotator{err: tc.rotateErr})
+			r.rotations.set(&common.BoskosConfig{Resources: []common.ResourceEntry{
+				{Type: "t", CredentialRotation: &common.CredentialRotation{Rotator: common.StaticRotator}},
+			}})
+
+			if _, _, err := r.Acquire("t", common.Free, common.Busy, "owner", ""); err != nil {
+				t.Fatalf("failed to acquire: %v", err)
+			}
+			if rotated := r.RotateCredentials(); rotated != 0 {
+				t.Errorf("expected the credentials of the leased resource to be kept, got %d rotations", rotated)
+			}
+			if err := r.Release("res", common.Free, "owner"); err != nil {
+				t.Fatalf("failed to release: %v", err)
+			}
+			if _, _, err := r.Acquire("t", common.Free, common.Busy, "next", ""); !AreErrorsEqual(err, &ResourceNotFound{name: "t"}) {
+				t.Errorf("expected the resource to wait for rotation, got %v", err)
+			}
+
+			if rotated := r.RotateCredentials(); rotated != tc.expectRotated {
+				t.Errorf("expected %d rotations, got %d", tc.expectRotated, rotated)
+			}
+			got, err := r.Storage.GetResource("res")
+			if err != nil {
+				t.Fatalf("failed to get resource: %v", err)
+			}
+			if secret := got.Status.UserData[common.DefaultCredentialsKey]; secret != tc.expectSecret || got.Status.CredentialsExposed != tc.expectExposed {
+				t.Errorf("expected secret %q and exposed %t, got %q and %t", tc.expectSecret, tc.expectExposed, secret, got.Status.CredentialsExposed)
+			}
+		})
+	}
+}
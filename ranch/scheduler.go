@@ -0,0 +1,206 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/crds"
+)
+
+// SchedulingRequest describes the acquire request a resource is picked for.
+type SchedulingRequest struct {
+	Type      string `json:"type"`
+	State     string `json:"state"`
+	Dest      string `json:"dest"`
+	Owner     string `json:"owner"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// SchedulerPolicy decides which of the free resources matching an acquire
+// request are handed out, and in which order. This allows injecting custom
+// placement logic, e.g. based on cost, quota or locality.
+// Candidates are passed in the order boskos would otherwise hand them out.
+type SchedulerPolicy interface {
+	// Filter returns the candidates that may be handed out for the request.
+	Filter(req SchedulingRequest, candidates []crds.ResourceObject) ([]crds.ResourceObject, error)
+	// Score returns a score for every candidate, in the same order as the
+	// candidates. Candidates with a higher score are handed out first.
+	Score(req SchedulingRequest, candidates []crds.ResourceObject) ([]int64, error)
+}
+
+// SetSchedulerPolicy makes the ranch use the given policy to pick resources
+// on acquire. It must be called before the ranch starts serving requests.
+func (r *Ranch) SetSchedulerPolicy(policy SchedulerPolicy) {
+	r.scheduler = policy
+}
+
+// schedule filters and orders the candidates according to the policy. The
+// order of equally scored candidates is preserved.
+func schedule(policy SchedulerPolicy, req SchedulingRequest, candidates []crds.ResourceObject) ([]crds.ResourceObject, error) {
+	filtered, err := policy.Filter(req, candidates)
+	if err != nil {
+		return nil, fmt.Errorf("failed to filter resources: %w", err)
+	}
+	if len(filtered) < 2 {
+		return filtered, nil
+	}
+	scores, err := policy.Score(req, filtered)
+	if err != nil {
+		return nil, fmt.Errorf("failed to score resources: %w", err)
+	}
+	if len(scores) != len(filtered) {
+		return nil, fmt.Errorf("got %d scores for %d resources", len(scores), len(filtered))
+	}
+	indexes := make([]int, len(filtered))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	sort.SliceStable(indexes, func(i, j int) bool {
+		return scores[indexes[i]] > scores[indexes[j]]
+	})
+	result := make([]crds.ResourceObject, 0, len(filtered))
+	for _, i := range indexes {
+		result = append(result, filtered[i])
+	}
+	return result, nil
+}
+
+// WebhookSchedulerRequest is the body sent to the scheduler webhook.
+type WebhookSchedulerRequest struct {
+	Request    SchedulingRequest `json:"request"`
+	Candidates []common.Resource `json:"candidates"`
+}
+
+// WebhookSchedulerResponse is the body expected from the scheduler webhook.
+type WebhookSchedulerResponse struct {
+	// Names lists the candidates passing the filter. Only used for filtering.
+	Names []string `json:"names,omitempty"`
+	// Scores maps candidate names to their score. Only used for scoring,
+	// missing candidates get a score of zero.
+	Scores map[string]int64 `json:"scores,omitempty"`
+}
+
+// WebhookSchedulerPolicy is a SchedulerPolicy delegating to an external
+// service. Candidates are POSTed as a WebhookSchedulerRequest to the /filter
+// and /score paths below the webhook URL, which respond with a
+// WebhookSchedulerResponse.
+type WebhookSchedulerPolicy struct {
+	url     string
+	timeout time.Duration
+	// failOpen makes errors talking to the webhook fall back to the default
+	// behavior instead of failing the acquire request.
+	failOpen bool
+	client   *http.Client
+}
+
+// NewWebhookSchedulerPolicy creates a new WebhookSchedulerPolicy.
+func NewWebhookSchedulerPolicy(url string, timeout time.Duration, failOpen bool) *WebhookSchedulerPolicy {
+	return &WebhookSchedulerPolicy{
+		url:      strings.TrimSuffix(url, "/"),
+		timeout:  timeout,
+		failOpen: failOpen,
+		client:   &http.Client{},
+	}
+}
+
+// Filter implements SchedulerPolicy.
+func (w *WebhookSchedulerPolicy) Filter(req SchedulingRequest, candidates []crds.ResourceObject) ([]crds.ResourceObject, error) {
+	resp, err := w.call("/filter", req, candidates)
+	if err != nil {
+		if w.failOpen {
+			logrus.WithError(err).Warning("Scheduler webhook failed, not filtering resources")
+			return candidates, nil
+		}
+		return nil, err
+	}
+	names := map[string]bool{}
+	for _, name := range resp.Names {
+		names[name] = true
+	}
+	var filtered []crds.ResourceObject
+	for _, candidate := range candidates {
+		if names[candidate.Name] {
+			filtered = append(filtered, candidate)
+		}
+	}
+	return filtered, nil
+}
+
+// Score implements SchedulerPolicy.
+func (w *WebhookSchedulerPolicy) Score(req SchedulingRequest, candidates []crds.ResourceObject) ([]int64, error) {
+	scores := make([]int64, len(candidates))
+	resp, err := w.call("/score", req, candidates)
+	if err != nil {
+		if w.failOpen {
+			logrus.WithError(err).Warning("Scheduler webhook failed, not scoring resources")
+			return scores, nil
+		}
+		return nil, err
+	}
+	for i, candidate := range candidates {
+		scores[i] = resp.Scores[candidate.Name]
+	}
+	return scores, nil
+}
+
+func (w *WebhookSchedulerPolicy) call(path string, req SchedulingRequest, candidates []crds.ResourceObject) (*WebhookSchedulerResponse, error) {
+	body := WebhookSchedulerRequest{Request: req, Candidates: make([]common.Resource, 0, len(candidates))}
+	for _, candidate := range candidates {
+		body.Candidates = append(body.Candidates, candidate.ToResource())
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), w.timeout)
+	defer cancel()
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url+path, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpResp, err := w.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("scheduler webhook request failed: %w", err)
+	}
+	defer httpResp.Body.Close()
+	respBody, err := ioutil.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scheduler webhook response: %w", err)
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("scheduler webhook returned status %d: %s", httpResp.StatusCode, string(respBody))
+	}
+	resp := &WebhookSchedulerResponse{}
+	if err := json.Unmarshal(respBody, resp); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal scheduler webhook response: %w", err)
+	}
+	return resp, nil
+}
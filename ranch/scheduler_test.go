@@ -0,0 +1,94 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestAcquireWithSchedulerPolicy(t *testing.T) {
+	testCases := []struct {
+		name      string
+		handler   http.HandlerFunc
+		failOpen  bool
+		expected  string
+		expectErr bool
+	}{
+		{
+			name: "filter and score",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				resp := WebhookSchedulerResponse{}
+				if strings.HasSuffix(r.URL.Path, "/filter") {
+					resp.Names = []string{"res-a", "res-c"}
+				} else {
+					resp.Scores = map[string]int64{"res-c": 10}
+				}
+				json.NewEncoder(w).Encode(resp)
+			},
+			expected: "res-c",
+		},
+		{
+			name: "nothing passes the filter",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(WebhookSchedulerResponse{})
+			},
+			expectErr: true,
+		},
+		{
+			name: "failing webhook",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "broken", http.StatusInternalServerError)
+			},
+			expectErr: true,
+		},
+		{
+			name: "failing webhook with fail open",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "broken", http.StatusInternalServerError)
+			},
+			failOpen: true,
+			expected: "res-a",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(tc.handler)
+			defer server.Close()
+
+			r := makeTestRanch([]runtime.Object{
+				newResource("res-a", "t", "free", "", startTime),
+				newResource("res-b", "t", "free", "", startTime),
+				newResource("res-c", "t", "free", "", startTime),
+			})
+			r.SetSchedulerPolicy(NewWebhookSchedulerPolicy(server.URL, time.Second, tc.failOpen))
+			res, _, err := r.Acquire("t", "free", "busy", "owner", "")
+			if (err != nil) != tc.expectErr {
+				t.Fatalf("expected error: %t, got %v", tc.expectErr, err)
+			}
+			if err == nil && res.Name != tc.expected {
+				t.Errorf("expected %s to be acquired, got %s", tc.expected, res.Name)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/crds"
+)
+
+// ShardNotAssigned will be returned if a sharded request comes from an owner
+// that is not a live member of the shard group.
+type ShardNotAssigned struct {
+	group  string
+	member string
+}
+
+func (s ShardNotAssigned) Error() string {
+	return fmt.Sprintf("%s is not a member of shard group %s, join the group first", s.member, s.group)
+}
+
+// shardManager holds the members of the shard groups, each with the time its
+// membership lease expires. Members renew their lease by joining again.
+type shardManager struct {
+	lock   sync.Mutex
+	groups map[string]map[string]time.Time
+}
+
+func newShardManager() *shardManager {
+	return &shardManager{groups: map[string]map[string]time.Time{}}
+}
+
+func (s *shardManager) join(group, member string, expires time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.groups[group] == nil {
+		s.groups[group] = map[string]time.Time{}
+	}
+	s.groups[group][member] = expires
+}
+
+// assignment returns the shard of member in group, forgetting members whose
+// lease expired. The second return value is false if member is not live.
+func (s *shardManager) assignment(group, member string, now time.Time) (common.ShardAssignment, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var live []string
+	for name, expires := range s.groups[group] {
+		if !now.Before(expires) {
+			delete(s.groups[group], name)
+			continue
+		}
+		live = append(live, name)
+	}
+	if len(live) == 0 {
+		delete(s.groups, group)
+	}
+	sort.Strings(live)
+	for idx, name := range live {
+		if name == member {
+			return common.ShardAssignment{Group: group, Member: member, Index: idx, Count: len(live)}, true
+		}
+	}
+	return common.ShardAssignment{}, false
+}
+
+// shardOf returns the shard out of count that the resource name belongs to.
+func shardOf(name string, count int) int {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return int(h.Sum32() % uint32(count))
+}
+
+// JoinShardGroup makes member a member of the shard group for ttl, or renews
+// its membership, and returns its current assignment. Members of a group
+// acquire disjoint sets of resources with AcquireInShard, so that replicas of
+// a janitor or mason can share the work without processing a resource twice.
+// Assignments change as members join or let their membership lapse, so
+// members are expected to renew well within ttl.
+func (r *Ranch) JoinShardGroup(group, member string, ttl time.Duration) common.ShardAssignment {
+	now := r.now().Time
+	r.shards.join(group, member, now.Add(ttl))
+	assignment, _ := r.shards.assignment(group, member, now)
+	return assignment
+}
+
+// AcquireInShard is like Acquire, but only considers the resources assigned
+// to the shard of owner in group, which owner must have joined with
+// JoinShardGroup. Sharded requests do not hold a rank in the queue.
+// Out: A valid Resource object on success, or
+//      ShardNotAssigned error if owner is not a live member of group, or
+//      ResourceNotFound error if no resource of the shard is in target state.
+func (r *Ranch) AcquireInShard(rType, state, dest, owner, group string) (*crds.ResourceObject, metav1.Time, error) {
+	return r.acquire(rType, state, dest, owner, "", group, nil, 0, 0, 0, 0)
+}
+
+// inShard tells whether res belongs to the shard of assignment.
+func inShard(res *crds.ResourceObject, assignment common.ShardAssignment) bool {
+	return assignment.Count <= 1 || shardOf(res.Name, assignment.Count) == assignment.Index
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+func TestJoinShardGroup(t *testing.T) {
+	r := makeTestRanch(nil)
+	now := fakeNow.Time
+	r.now = func() metav1.Time { return metav1.Time{Time: now} }
+
+	if a := r.JoinShardGroup("janitors", "b", time.Minute); a.Index != 0 || a.Count != 1 {
+		t.Errorf("expected the only member to hold shard 0 of 1, got %+v", a)
+	}
+	if a := r.JoinShardGroup("janitors", "a", 2*time.Minute); a.Index != 0 || a.Count != 2 {
+		t.Errorf("expected a to hold shard 0 of 2, got %+v", a)
+	}
+	if a := r.JoinShardGroup("janitors", "b", time.Minute); a.Index != 1 || a.Count != 2 {
+		t.Errorf("expected b to hold shard 1 of 2, got %+v", a)
+	}
+	if a := r.JoinShardGroup("masons", "c", time.Minute); a.Index != 0 || a.Count != 1 {
+		t.Errorf("expected groups to be independent, got %+v", a)
+	}
+
+	now = now.Add(90 * time.Second)
+	if a := r.JoinShardGroup("janitors", "a", 2*time.Minute); a.Index != 0 || a.Count != 1 {
+		t.Errorf("expected the lapsed member to be forgotten, got %+v", a)
+	}
+}
+
+func TestAcquireInShard(t *testing.T) {
+	var resources []runtime.Object
+	for i := 0; i < 20; i++ {
+		resources = append(resources, newResource(fmt.Sprintf("res-%d", i), "t", common.Dirty, "", startTime))
+	}
+	r := makeTestRanch(resources)
+
+	if _, _, err := r.AcquireInShard("t", common.Dirty, common.Cleaning, "a", "janitors"); !AreErrorsEqual(err, &ShardNotAssigned{group: "janitors", member: "a"}) {
+		t.Fatalf("expected acquiring before joining to fail, got %v", err)
+	}
+	r.JoinShardGroup("janitors", "a", time.Minute)
+	r.JoinShardGroup("janitors", "b", time.Minute)
+
+	acquired := map[string]string{}
+	for _, member := range []string{"a", "b"} {
+		for {
+			res, _, err := r.AcquireInShard("t", common.Dirty, common.Cleaning, member, "janitors")
+			if err != nil {
+				if !AreErrorsEqual(err, &ResourceNotFound{name: "t"}) {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				break
+			}
+			if owner, ok := acquired[res.Name]; ok {
+				t.Fatalf("resource %s acquired by both %s and %s", res.Name, owner, member)
+			}
+			acquired[res.Name] = member
+		}
+	}
+	if len(acquired) != len(resources) {
+		t.Errorf("expected all %d resources to be acquired, got %d", len(resources), len(acquired))
+	}
+	counts := map[string]int{}
+	for _, member := range acquired {
+		counts[member]++
+	}
+	if counts["a"] == 0 || counts["b"] == 0 {
+		t.Errorf("expected both members to get a share of the resources, got %v", counts)
+	}
+}
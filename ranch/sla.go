@@ -0,0 +1,245 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+const (
+	// slaBucketLength is the granularity the indicators are aggregated at.
+	slaBucketLength = time.Hour
+	// slaRetention is how long the indicators are kept, the longest window.
+	slaRetention = 7 * 24 * time.Hour
+)
+
+// slaWindows are the lengths of the windows of the SLA reports.
+var slaWindows = map[string]time.Duration{
+	common.SLADaily:  24 * time.Hour,
+	common.SLAWeekly: slaRetention,
+}
+
+// UnknownSLAWindow will be returned if an SLA report is requested for a
+// window which is neither daily nor weekly.
+type UnknownSLAWindow struct {
+	window string
+}
+
+func (u UnknownSLAWindow) Error() string {
+	return fmt.Sprintf("unknown SLA window %q, must be %s or %s", u.window, common.SLADaily, common.SLAWeekly)
+}
+
+// slaBucket aggregates the indicators of a resource type over an hour.
+type slaBucket struct {
+	start       time.Time
+	acquires    int
+	acquireWait time.Duration
+	cleanups    int
+	cleanup     time.Duration
+	leases      int
+	lease       time.Duration
+	maxLease    time.Duration
+	// sampled is how long the free resources were sampled for, and exhausted
+	// how long of it none was free.
+	sampled   time.Duration
+	exhausted time.Duration
+}
+
+// slaTracker keeps the service level indicators of the resource types, from
+// which the SLA reports are computed.
+type slaTracker struct {
+	lock    sync.Mutex
+	buckets map[string][]*slaBucket
+	// leasedAt are the times the leased resources were acquired at, by name.
+	leasedAt map[string]time.Time
+	// lastFree are the free resources by type at lastSample.
+	lastFree   map[string]int
+	lastSample time.Time
+}
+
+func newSLATracker() *slaTracker {
+	return &slaTracker{buckets: map[string][]*slaBucket{}, leasedAt: map[string]time.Time{}}
+}
+
+// bucket returns the bucket of rType now falls in, dropping the buckets past
+// the retention. Must be called with the lock held.
+func (s *slaTracker) bucket(rType string, now time.Time) *slaBucket {
+	buckets := s.buckets[rType]
+	for len(buckets) > 0 && now.Sub(buckets[0].start) >= slaRetention {
+		buckets = buckets[1:]
+	}
+	start := now.Truncate(slaBucketLength)
+	if len(buckets) == 0 || buckets[len(buckets)-1].start.Before(start) {
+		buckets = append(buckets, &slaBucket{start: start})
+	}
+	s.buckets[rType] = buckets
+	return buckets[len(buckets)-1]
+}
+
+// observeAcquire records that the resource name of rType was acquired at now
+// by a request which waited for wait.
+func (s *slaTracker) observeAcquire(name, rType string, wait time.Duration, now time.Time) {
+	if wait < 0 {
+		wait = 0
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	b := s.bucket(rType, now)
+	b.acquires++
+	b.acquireWait += wait
+	s.leasedAt[name] = now
+}
+
+// observeLeaseEnd records that the lease of the resource name of rType ended
+// at now. Leases granted before the tracker started are ignored.
+func (s *slaTracker) observeLeaseEnd(name, rType string, now time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	leasedAt, ok := s.leasedAt[name]
+	if !ok {
+		return
+	}
+	delete(s.leasedAt, name)
+	lease := now.Sub(leasedAt)
+	if lease < 0 {
+		return
+	}
+	b := s.bucket(rType, now)
+	b.leases++
+	b.lease += lease
+	if lease > b.maxLease {
+		b.maxLease = lease
+	}
+}
+
+// observeCleanup records that a janitor took duration to clean a resource of
+// rType.
+func (s *slaTracker) observeCleanup(rType string, duration time.Duration, now time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	b := s.bucket(rType, now)
+	b.cleanups++
+	b.cleanup += duration
+}
+
+// observeFree records how many resources of each type are free at now. The
+// time since the previous sample counts as exhausted for the types which had
+// no free resource then.
+func (s *slaTracker) observeFree(free map[string]int, now time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	previous, elapsed := s.lastFree, now.Sub(s.lastSample)
+	s.lastFree, s.lastSample = free, now
+	// A gap longer than a bucket means sampling stopped, e.g. while another
+	// replica led, so it is not attributed to the current bucket.
+	if previous == nil || elapsed <= 0 || elapsed > slaBucketLength {
+		return
+	}
+	for rType, count := range previous {
+		b := s.bucket(rType, now)
+		b.sampled += elapsed
+		if count == 0 {
+			b.exhausted += elapsed
+		}
+	}
+}
+
+// report aggregates the buckets overlapping the window ending at now.
+func (s *slaTracker) report(window string, length time.Duration, now time.Time) common.SLAReport {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	start := now.Add(-length)
+	report := common.SLAReport{Window: window, Start: start, End: now, Types: []common.TypeSLA{}}
+	for rType, buckets := range s.buckets {
+		var total slaBucket
+		for _, b := range buckets {
+			if !b.start.Add(slaBucketLength).After(start) {
+				continue
+			}
+			total.acquires += b.acquires
+			total.acquireWait += b.acquireWait
+			total.cleanups += b.cleanups
+			total.cleanup += b.cleanup
+			total.leases += b.leases
+			total.lease += b.lease
+			if b.maxLease > total.maxLease {
+				total.maxLease = b.maxLease
+			}
+			total.sampled += b.sampled
+			total.exhausted += b.exhausted
+		}
+		sla := common.TypeSLA{
+			Type:            rType,
+			Acquires:        total.acquires,
+			Cleanups:        total.cleanups,
+			Leases:          total.leases,
+			MaxLeaseSeconds: total.maxLease.Seconds(),
+		}
+		if total.acquires > 0 {
+			sla.AcquireWaitSeconds = total.acquireWait.Seconds() / float64(total.acquires)
+		}
+		if total.cleanups > 0 {
+			sla.CleanupSeconds = total.cleanup.Seconds() / float64(total.cleanups)
+		}
+		if total.leases > 0 {
+			sla.LeaseSeconds = total.lease.Seconds() / float64(total.leases)
+		}
+		if total.sampled > 0 {
+			sla.ExhaustedPercent = 100 * float64(total.exhausted) / float64(total.sampled)
+		}
+		report.Types = append(report.Types, sla)
+	}
+	sort.Slice(report.Types, func(i, j int) bool { return report.Types[i].Type < report.Types[j].Type })
+	return report
+}
+
+// SampleSLA records which resource types have no free resource left, from
+// which the SLA reports tell the percentage of time the pools were exhausted.
+// It is meant to be called periodically.
+func (r *Ranch) SampleSLA() error {
+	resources, err := r.Storage.GetResources()
+	if err != nil {
+		return err
+	}
+	free := map[string]int{}
+	for _, res := range resources.Items {
+		if res.Status.State == common.Free && res.Status.Owner == "" {
+			free[res.Spec.Type]++
+		} else if _, ok := free[res.Spec.Type]; !ok {
+			free[res.Spec.Type] = 0
+		}
+	}
+	r.sla.observeFree(free, r.now().Time)
+	return nil
+}
+
+// SLAReport returns the service level indicators of the resource types over
+// the daily or weekly window ending now, sorted by type.
+// Out: the report on success, or
+//      UnknownSLAWindow error if window is neither daily nor weekly.
+func (r *Ranch) SLAReport(window string) (common.SLAReport, error) {
+	length, ok := slaWindows[window]
+	if !ok {
+		return common.SLAReport{}, &UnknownSLAWindow{window: window}
+	}
+	return r.sla.report(window, length, r.now().Time), nil
+}
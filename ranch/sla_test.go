@@ -0,0 +1,142 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+func TestSLATracker(t *testing.T) {
+	start := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	s := newSLATracker()
+	// Two days ago, only counted weekly.
+	s.observeAcquire("old", "t", time.Minute, start.Add(-48*time.Hour))
+	s.observeLeaseEnd("old", "t", start.Add(-47*time.Hour))
+
+	s.observeAcquire("a", "t", 10*time.Second, start)
+	s.observeAcquire("b", "t", 30*time.Second, start)
+	s.observeLeaseEnd("a", "t", start.Add(10*time.Minute))
+	s.observeLeaseEnd("b", "t", start.Add(30*time.Minute))
+	// Leases granted before the tracker started are ignored.
+	s.observeLeaseEnd("unknown", "t", start.Add(30*time.Minute))
+	s.observeCleanup("t", 2*time.Minute, start.Add(40*time.Minute))
+	s.observeFree(map[string]int{"t": 1, "other": 1}, start)
+	s.observeFree(map[string]int{"t": 0, "other": 1}, start.Add(10*time.Minute))
+	s.observeFree(map[string]int{"t": 1, "other": 1}, start.Add(40*time.Minute))
+
+	now := start.Add(50 * time.Minute)
+	testCases := []struct {
+		window   string
+		length   time.Duration
+		expected []common.TypeSLA
+	}{
+		{
+			window: common.SLADaily,
+			length: 24 * time.Hour,
+			expected: []common.TypeSLA{
+				{Type: "other"},
+				{
+					Type:               "t",
+					Acquires:           2,
+					AcquireWaitSeconds: 20,
+					Cleanups:           1,
+					CleanupSeconds:     120,
+					ExhaustedPercent:   75,
+					Leases:             2,
+					LeaseSeconds:       1200,
+					MaxLeaseSeconds:    1800,
+				},
+			},
+		},
+		{
+			window: common.SLAWeekly,
+			length: slaRetention,
+			expected: []common.TypeSLA{
+				{Type: "other"},
+				{
+					Type:               "t",
+					Acquires:           3,
+					AcquireWaitSeconds: 100.0 / 3,
+					Cleanups:           1,
+					CleanupSeconds:     120,
+					ExhaustedPercent:   75,
+					Leases:             3,
+					LeaseSeconds:       2000,
+					MaxLeaseSeconds:    3600,
+				},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.window, func(t *testing.T) {
+			report := s.report(tc.window, tc.length, now)
+			if report.Window != tc.window || !report.Start.Equal(now.Add(-tc.length)) || !report.End.Equal(now) {
+				t.Errorf("unexpected window %s from %v to %v", report.Window, report.Start, report.End)
+			}
+			if diff := cmp.Diff(tc.expected, report.Types); diff != "" {
+				t.Errorf("unexpected indicators (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSLAReport(t *testing.T) {
+	r := makeTestRanch([]runtime.Object{
+		newResource("res", "t", common.Free, "", startTime),
+	})
+	now := fakeNow.Time
+	r.now = func() metav1.Time { return metav1.Time{Time: now} }
+	if err := r.SampleSLA(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, _, err := r.Acquire("t", common.Free, common.Busy, "owner", ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	now = now.Add(time.Minute)
+	if err := r.SampleSLA(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := r.Release("res", common.Dirty, "owner"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	now = now.Add(time.Minute)
+	if err := r.SampleSLA(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	report, err := r.SLAReport(common.SLADaily)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []common.TypeSLA{{Type: "t", Acquires: 1, ExhaustedPercent: 50, Leases: 1, LeaseSeconds: 60, MaxLeaseSeconds: 60}}
+	if diff := cmp.Diff(expected, report.Types); diff != "" {
+		t.Errorf("unexpected indicators (-want +got):\n%s", diff)
+	}
+
+	if _, err := r.SLAReport("monthly"); err == nil {
+		t.Error("expected an error for an unknown window")
+	} else if _, ok := err.(*UnknownSLAWindow); !ok {
+		t.Errorf("expected UnknownSLAWindow, got %v", err)
+	}
+}
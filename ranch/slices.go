@@ -0,0 +1,308 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/crds"
+)
+
+// MaxBookingHorizon bounds how far ahead time slices may be booked.
+const MaxBookingHorizon = 14 * 24 * time.Hour
+
+// TimeSliced will be returned if resources of a time-sliced type are acquired
+// instead of booked.
+type TimeSliced struct {
+	rType string
+}
+
+func (t TimeSliced) Error() string {
+	return fmt.Sprintf("resources of type %s are shared in time slices, book a slice instead of acquiring them", t.rType)
+}
+
+// BookingNotFound will be returned if the booking to cancel does not exist.
+type BookingNotFound struct {
+	name  string
+	start time.Time
+}
+
+func (b BookingNotFound) Error() string {
+	return fmt.Sprintf("no booking of resource %s starting at %s", b.name, b.start.Format(time.RFC3339))
+}
+
+// sliceManager holds the slice length of the time-sliced resource types.
+type sliceManager struct {
+	lock   sync.RWMutex
+	slices map[string]time.Duration
+}
+
+func newSliceManager() *sliceManager {
+	return &sliceManager{slices: map[string]time.Duration{}}
+}
+
+func (s *sliceManager) set(config *common.BoskosConfig) {
+	slices := map[string]time.Duration{}
+	for _, entry := range config.Resources {
+		if entry.TimeSlice != nil && entry.TimeSlice.Duration != nil {
+			slices[entry.Type] = *entry.TimeSlice.Duration
+		}
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.slices = slices
+}
+
+func (s *sliceManager) get(rType string) (time.Duration, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	slice, ok := s.slices[rType]
+	return slice, ok
+}
+
+func overlaps(bookings []crds.Booking, start, end time.Time) bool {
+	for _, b := range bookings {
+		if start.Before(b.End.Time) && b.Start.Time.Before(end) {
+			return true
+		}
+	}
+	return false
+}
+
+// activeBooking returns the booking containing now, if any.
+func activeBooking(bookings []crds.Booking, now time.Time) *crds.Booking {
+	for idx := range bookings {
+		if !now.Before(bookings[idx].Start.Time) && now.Before(bookings[idx].End.Time) {
+			return &bookings[idx]
+		}
+	}
+	return nil
+}
+
+func toBooking(res *crds.ResourceObject, b crds.Booking) common.Booking {
+	return common.Booking{Name: res.Name, Type: res.Spec.Type, Owner: b.Owner, Start: b.Start.Time, End: b.End.Time}
+}
+
+// Book reserves count consecutive time slices of a resource of rType for
+// owner, starting with the earliest slot at or after notBefore, which may be
+// the slot in progress. The resource is handed to owner in the busy state for
+// the duration of the booking, and released as dirty afterwards so it gets
+// cleaned before the next booking.
+// Out: The booking on success, or
+//      ResourceTypeNotFound error if rType is not time-sliced, or
+//      ResourceNotFound error if no slot is available within MaxBookingHorizon.
+func (r *Ranch) Book(rType, owner string, count int, notBefore time.Time) (*common.Booking, error) {
+	if err := r.admitTenant(rType); err != nil {
+		return nil, err
+	}
+	slice, ok := r.slices.get(rType)
+	if !ok {
+		return nil, &ResourceTypeNotFound{rType: rType}
+	}
+	now := r.now().Time
+	if notBefore.Before(now) {
+		notBefore = now
+	}
+	first := notBefore.Truncate(slice)
+	length := time.Duration(count) * slice
+
+	var booking *common.Booking
+	if err := retryOnConflict(retry.DefaultBackoff, func() error {
+		resources, err := r.Storage.GetResources()
+		if err != nil {
+			logrus.WithError(err).Errorf("could not get resources")
+			return &ResourceNotFound{name: rType}
+		}
+		var candidates []crds.ResourceObject
+		for _, res := range resources.Items {
+			if res.Spec.Type == rType {
+				candidates = append(candidates, res)
+			}
+		}
+		sort.Slice(candidates, func(i, j int) bool { return candidates[i].Name < candidates[j].Name })
+
+		for start := first; start.Before(now.Add(MaxBookingHorizon)); start = start.Add(slice) {
+			end := start.Add(length)
+			for idx := range candidates {
+				res := candidates[idx]
+				if overlaps(res.Status.Bookings, start, end) {
+					continue
+				}
+				// The slot in progress is only available if nobody holds the resource.
+				if start.Before(now) && res.Status.Owner != "" {
+					continue
+				}
+				b := crds.Booking{Owner: owner, Start: metav1.NewTime(start), End: metav1.NewTime(end)}
+				res.Status.Bookings = append(res.Status.Bookings, b)
+				sort.Slice(res.Status.Bookings, func(i, j int) bool {
+					return res.Status.Bookings[i].Start.Before(&res.Status.Bookings[j].Start)
+				})
+				if _, err := r.Storage.UpdateResource(&res); err != nil {
+					return err
+				}
+				booked := toBooking(&res, b)
+				booking = &booked
+				return nil
+			}
+		}
+		return &ResourceNotFound{name: rType}
+	}); err != nil {
+		if _, ok := err.(*ResourceNotFound); !ok {
+			logrus.WithError(err).Error("Book failed")
+		}
+		return nil, err
+	}
+	logrus.WithFields(logrus.Fields{"resource": booking.Name, "owner": owner, "start": booking.Start, "end": booking.End}).Info("Booked time slice")
+	r.RotateSlices()
+	return booking, nil
+}
+
+// CancelBooking cancels the booking of owner on resource name starting at
+// start. If the booking is in progress, the resource is released as dirty.
+// Out: nil on success, or
+//      ResourceNotFound error if the resource does not exist, or
+//      BookingNotFound error if there is no such booking.
+func (r *Ranch) CancelBooking(name, owner string, start time.Time) error {
+	return retryOnConflict(retry.DefaultBackoff, func() error {
+		res, err := r.Storage.GetResource(name)
+		if err != nil {
+			return &ResourceNotFound{name: name}
+		}
+		var kept []crds.Booking
+		var cancelled *crds.Booking
+		for idx := range res.Status.Bookings {
+			b := res.Status.Bookings[idx]
+			if cancelled == nil && b.Owner == owner && b.Start.Time.Equal(start) {
+				cancelled = &b
+				continue
+			}
+			kept = append(kept, b)
+		}
+		if cancelled == nil {
+			return &BookingNotFound{name: name, start: start}
+		}
+		res.Status.Bookings = kept
+		if activeBooking([]crds.Booking{*cancelled}, r.now().Time) != nil && res.Status.Owner == owner {
+			res.Status.Owner = ""
+			res.Status.State = common.Dirty
+		}
+		_, err = r.Storage.UpdateResource(res)
+		return err
+	})
+}
+
+// Calendar returns the bookings of the resources of rType, or of all
+// resources if rType is empty, sorted by start and name.
+func (r *Ranch) Calendar(rType string) ([]common.Booking, error) {
+	resources, err := r.Storage.GetResources()
+	if err != nil {
+		return nil, err
+	}
+	var bookings []common.Booking
+	for idx := range resources.Items {
+		res := &resources.Items[idx]
+		if rType != "" && res.Spec.Type != rType {
+			continue
+		}
+		for _, b := range res.Status.Bookings {
+			bookings = append(bookings, toBooking(res, b))
+		}
+	}
+	sort.Slice(bookings, func(i, j int) bool {
+		if !bookings[i].Start.Equal(bookings[j].Start) {
+			return bookings[i].Start.Before(bookings[j].Start)
+		}
+		return bookings[i].Name < bookings[j].Name
+	})
+	return bookings, nil
+}
+
+// RotateSlices hands time-sliced and reserved resources to the owner of the
+// booking in progress, releases them as dirty once the booking of their holder
+// is over, and drops the bookings that ended. A resource is only handed over
+// once it is free, so bookings start late when the previous one is still being
+// cleaned.
+func (r *Ranch) RotateSlices() {
+	resources, err := r.Storage.GetResources()
+	if err != nil {
+		logrus.WithError(err).Error("cannot get resources")
+		return
+	}
+	now := r.now().Time
+	for idx := range resources.Items {
+		res := resources.Items[idx]
+		if len(res.Status.Bookings) == 0 {
+			continue
+		}
+		changed := false
+		var kept []crds.Booking
+		var ended []crds.Booking
+		for _, b := range res.Status.Bookings {
+			if now.Before(b.End.Time) {
+				kept = append(kept, b)
+			} else {
+				ended = append(ended, b)
+			}
+		}
+		active := activeBooking(kept, now)
+		for _, b := range ended {
+			changed = true
+			// Consecutive bookings of the same owner carry on.
+			if res.Status.Owner == b.Owner && (active == nil || active.Owner != b.Owner) {
+				logrus.WithFields(logrus.Fields{"resource": res.Name, "owner": b.Owner}).Info("Time slice ended")
+				res.Status.Owner = ""
+				res.Status.State = common.Dirty
+			}
+		}
+		res.Status.Bookings = kept
+		if active != nil && res.Status.Owner == "" && res.Status.State == common.Free && !res.Status.CredentialsExposed {
+			logrus.WithFields(logrus.Fields{"resource": res.Name, "owner": active.Owner}).Info("Time slice started")
+			res.Status.Owner = active.Owner
+			res.Status.State = common.Busy
+			r.rotations.expose(&res)
+			changed = true
+		}
+		if !changed {
+			continue
+		}
+		if _, err := r.Storage.UpdateResource(&res); err != nil {
+			// Conflicts are retried on the next run.
+			logrus.WithError(err).Warningf("failed to rotate time slices of resource %s", res.Name)
+		}
+	}
+}
+
+// dropActiveBooking removes the booking of owner in progress, so a resource
+// released before the end of its slice is not handed back to owner.
+func dropActiveBooking(bookings []crds.Booking, owner string, now time.Time) []crds.Booking {
+	var kept []crds.Booking
+	for _, b := range bookings {
+		if b.Owner == owner && activeBooking([]crds.Booking{b}, now) != nil {
+			continue
+		}
+		kept = append(kept, b)
+	}
+	return kept
+}
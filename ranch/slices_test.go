@@ -0,0 +1,195 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/crds"
+)
+
+// makeSlicedRanch returns a ranch sharing resources of type t in one hour
+// slices, whose clock reads now.
+func makeSlicedRanch(objects []runtime.Object, now *time.Time) *Ranch {
+	r := makeTestRanch(objects)
+	r.now = func() metav1.Time { return metav1.Time{Time: *now} }
+	slice := time.Hour
+	r.slices.set(&common.BoskosConfig{Resources: []common.ResourceEntry{
+		{Type: "t", TimeSlice: &common.Duration{Duration: &slice}},
+	}})
+	return r
+}
+
+func booked(owner string, start, end time.Time) crds.Booking {
+	return crds.Booking{Owner: owner, Start: metav1.NewTime(start), End: metav1.NewTime(end)}
+}
+
+func at(hour, minute int) time.Time {
+	return time.Date(2021, time.March, 1, hour, minute, 0, 0, time.UTC)
+}
+
+func TestBook(t *testing.T) {
+	bookedRes := newResource("res-1", "t", common.Free, "", startTime)
+	bookedRes.Status.Bookings = []crds.Booking{booked("someone", at(10, 0), at(11, 0))}
+
+	testCases := []struct {
+		name        string
+		resources   []runtime.Object
+		rType       string
+		slices      int
+		notBefore   time.Time
+		expect      *common.Booking
+		expectErr   error
+		expectOwner string
+	}{
+		{
+			name:        "slot in progress is handed over right away",
+			resources:   []runtime.Object{newResource("res-1", "t", common.Free, "", startTime)},
+			rType:       "t",
+			slices:      1,
+			expect:      &common.Booking{Name: "res-1", Type: "t", Owner: "owner", Start: at(10, 0), End: at(11, 0)},
+			expectOwner: "owner",
+		},
+		{
+			name:        "busy resource is booked from the next slot",
+			resources:   []runtime.Object{newResource("res-1", "t", common.Busy, "someone", startTime)},
+			rType:       "t",
+			slices:      1,
+			expect:      &common.Booking{Name: "res-1", Type: "t", Owner: "owner", Start: at(11, 0), End: at(12, 0)},
+			expectOwner: "someone",
+		},
+		{
+			name:        "booked resource is skipped",
+			resources:   []runtime.Object{bookedRes, newResource("res-2", "t", common.Free, "", startTime)},
+			rType:       "t",
+			slices:      1,
+			expect:      &common.Booking{Name: "res-2", Type: "t", Owner: "owner", Start: at(10, 0), End: at(11, 0)},
+			expectOwner: "someone",
+		},
+		{
+			name:      "consecutive slots after not before",
+			resources: []runtime.Object{newResource("res-1", "t", common.Free, "", startTime)},
+			rType:     "t",
+			slices:    2,
+			notBefore: at(13, 15),
+			expect:    &common.Booking{Name: "res-1", Type: "t", Owner: "owner", Start: at(13, 0), End: at(15, 0)},
+		},
+		{
+			name:      "type is not time-sliced",
+			resources: []runtime.Object{newResource("res-1", "other", common.Free, "", startTime)},
+			rType:     "other",
+			slices:    1,
+			expectErr: &ResourceTypeNotFound{rType: "other"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			now := at(10, 30)
+			r := makeSlicedRanch(tc.resources, &now)
+			got, err := r.Book(tc.rType, "owner", tc.slices, tc.notBefore)
+			if !AreErrorsEqual(err, tc.expectErr) {
+				t.Fatalf("expected error %v, got %v", tc.expectErr, err)
+			}
+			if tc.expect == nil {
+				return
+			}
+			if *got != *tc.expect {
+				t.Errorf("expected booking %+v, got %+v", tc.expect, got)
+			}
+			res, err := r.Storage.GetResource("res-1")
+			if err != nil {
+				t.Fatalf("failed to get resource: %v", err)
+			}
+			if res.Status.Owner != tc.expectOwner {
+				t.Errorf("expected res-1 to be owned by %q, got %q", tc.expectOwner, res.Status.Owner)
+			}
+		})
+	}
+}
+
+func TestRotateSlices(t *testing.T) {
+	now := at(10, 30)
+	r := makeSlicedRanch([]runtime.Object{newResource("res", "t", common.Free, "", startTime)}, &now)
+	if _, err := r.Book("t", "first", 1, time.Time{}); err != nil {
+		t.Fatalf("failed to book: %v", err)
+	}
+	if _, err := r.Book("t", "second", 1, time.Time{}); err != nil {
+		t.Fatalf("failed to book: %v", err)
+	}
+	if _, _, err := r.Acquire("t", common.Free, common.Busy, "someone", ""); !AreErrorsEqual(err, &TimeSliced{rType: "t"}) {
+		t.Errorf("expected acquiring a time-sliced resource to fail, got %v", err)
+	}
+
+	assertHolder := func(state, owner string, bookings int) {
+		t.Helper()
+		res, err := r.Storage.GetResource("res")
+		if err != nil {
+			t.Fatalf("failed to get resource: %v", err)
+		}
+		if res.Status.State != state || res.Status.Owner != owner || len(res.Status.Bookings) != bookings {
+			t.Errorf("expected state %q owner %q and %d bookings, got %+v", state, owner, bookings, res.Status)
+		}
+	}
+	assertHolder(common.Busy, "first", 2)
+
+	// The slice ends and the resource is cleaned before the next holder gets it.
+	now = at(11, 0)
+	r.RotateSlices()
+	assertHolder(common.Dirty, "", 1)
+
+	if _, _, err := r.Acquire("t", common.Dirty, common.Cleaning, "janitor", ""); err != nil {
+		t.Fatalf("failed to acquire for cleaning: %v", err)
+	}
+	if err := r.Release("res", common.Free, "janitor"); err != nil {
+		t.Fatalf("failed to release: %v", err)
+	}
+	r.RotateSlices()
+	assertHolder(common.Busy, "second", 1)
+
+	// Releasing early drops the rest of the slice.
+	if err := r.Release("res", common.Dirty, "second"); err != nil {
+		t.Fatalf("failed to release: %v", err)
+	}
+	assertHolder(common.Dirty, "", 0)
+}
+
+func TestCancelBooking(t *testing.T) {
+	now := at(10, 30)
+	r := makeSlicedRanch([]runtime.Object{newResource("res", "t", common.Free, "", startTime)}, &now)
+	booking, err := r.Book("t", "owner", 1, time.Time{})
+	if err != nil {
+		t.Fatalf("failed to book: %v", err)
+	}
+	if err := r.CancelBooking("res", "someone", booking.Start); !AreErrorsEqual(err, &BookingNotFound{name: "res", start: booking.Start}) {
+		t.Errorf("expected cancelling the booking of another owner to fail, got %v", err)
+	}
+	if err := r.CancelBooking("res", "owner", booking.Start); err != nil {
+		t.Fatalf("failed to cancel booking: %v", err)
+	}
+	res, err := r.Storage.GetResource("res")
+	if err != nil {
+		t.Fatalf("failed to get resource: %v", err)
+	}
+	if res.Status.State != common.Dirty || res.Status.Owner != "" || len(res.Status.Bookings) != 0 {
+		t.Errorf("expected the cancelled booking in progress to release the resource, got %+v", res.Status)
+	}
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlbackend
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/ranch"
+)
+
+// EventArchive stores the events of the resources in the rows of a table,
+// indexed by time and by name, so they outlive restarts of boskos.
+type EventArchive struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+var _ ranch.EventArchive = &EventArchive{}
+
+// NewEventArchive returns an EventArchive storing the events in db, after
+// applying the migrations of the schema it lacks. db may also store the
+// resources.
+func NewEventArchive(ctx context.Context, db *sql.DB, dialect Dialect) (*EventArchive, error) {
+	if _, err := NewBackend(ctx, db, dialect); err != nil {
+		return nil, err
+	}
+	return &EventArchive{db: db, dialect: dialect}, nil
+}
+
+func (a *EventArchive) Record(ctx context.Context, event common.ResourceEvent) error {
+	_, err := a.db.ExecContext(ctx, a.dialect.rebind(fmt.Sprintf(
+		"INSERT INTO %s (event_time, kind, name, type, state, owner, previous_state) VALUES (?, ?, ?, ?, ?, ?, ?)", eventsTable)),
+		event.Time.UnixNano(), event.Kind, event.Name, event.Type, event.State, event.Owner, event.PreviousState)
+	return err
+}
+
+// eventsQuery returns the SQL query of the events matching query, and its
+// arguments.
+func eventsQuery(query ranch.EventQuery) (string, []interface{}) {
+	// The zero time predates the range of unix nanoseconds.
+	var since int64
+	if !query.Since.IsZero() {
+		since = query.Since.UnixNano()
+	}
+	where := []string{"event_time >= ?"}
+	args := []interface{}{since}
+	if !query.Until.IsZero() {
+		where = append(where, "event_time < ?")
+		args = append(args, query.Until.UnixNano())
+	}
+	if query.Name != "" {
+		where = append(where, "name = ?")
+		args = append(args, query.Name)
+	}
+	if query.Type != "" {
+		where = append(where, "type = ?")
+		args = append(args, query.Type)
+	}
+	statement := fmt.Sprintf("SELECT event_time, kind, name, type, state, owner, previous_state FROM %s WHERE %s ORDER BY event_time",
+		eventsTable, strings.Join(where, " AND "))
+	if query.Limit > 0 {
+		statement += " LIMIT ?"
+		args = append(args, query.Limit)
+	}
+	return statement, args
+}
+
+func (a *EventArchive) Query(ctx context.Context, query ranch.EventQuery) ([]common.ResourceEvent, error) {
+	statement, args := eventsQuery(query)
+	rows, err := a.db.QueryContext(ctx, a.dialect.rebind(statement), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var events []common.ResourceEvent
+	for rows.Next() {
+		var event common.ResourceEvent
+		var nanos int64
+		if err := rows.Scan(&nanos, &event.Kind, &event.Name, &event.Type, &event.State, &event.Owner, &event.PreviousState); err != nil {
+			return nil, err
+		}
+		event.Time = time.Unix(0, nanos)
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+func (a *EventArchive) Prune(ctx context.Context, before time.Time) (int, error) {
+	result, err := a.db.ExecContext(ctx, a.dialect.rebind(fmt.Sprintf("DELETE FROM %s WHERE event_time < ?", eventsTable)), before.UnixNano())
+	if err != nil {
+		return 0, err
+	}
+	pruned, err := result.RowsAffected()
+	return int(pruned), err
+}
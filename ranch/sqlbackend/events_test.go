@@ -0,0 +1,59 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlbackend
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"sigs.k8s.io/boskos/ranch"
+)
+
+func TestEventsQuery(t *testing.T) {
+	since := time.Unix(100, 0)
+	until := time.Unix(200, 0)
+	testCases := []struct {
+		name         string
+		query        ranch.EventQuery
+		expected     string
+		expectedArgs []interface{}
+	}{
+		{
+			name:         "every event",
+			expected:     "SELECT event_time, kind, name, type, state, owner, previous_state FROM boskos_events WHERE event_time >= ? ORDER BY event_time",
+			expectedArgs: []interface{}{int64(0)},
+		},
+		{
+			name:         "events of a resource in a time range",
+			query:        ranch.EventQuery{Name: "res", Type: "t", Since: since, Until: until, Limit: 10},
+			expected:     "SELECT event_time, kind, name, type, state, owner, previous_state FROM boskos_events WHERE event_time >= ? AND event_time < ? AND name = ? AND type = ? ORDER BY event_time LIMIT ?",
+			expectedArgs: []interface{}{since.UnixNano(), until.UnixNano(), "res", "t", 10},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			query, args := eventsQuery(tc.query)
+			if query != tc.expected {
+				t.Errorf("expected query %q, got %q", tc.expected, query)
+			}
+			if !reflect.DeepEqual(args, tc.expectedArgs) {
+				t.Errorf("expected args %v, got %v", tc.expectedArgs, args)
+			}
+		})
+	}
+}
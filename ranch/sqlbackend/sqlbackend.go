@@ -0,0 +1,480 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package sqlbackend implements a ranch.Backend storing the resources in a
+// relational database, for installations whose tens of thousands of
+// resources outgrow custom resources. It works with any database/sql driver
+// of the supported dialects, which callers register by importing it.
+package sqlbackend
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"sigs.k8s.io/boskos/crds"
+	"sigs.k8s.io/boskos/ranch"
+)
+
+// Dialect is the SQL dialect of a database.
+type Dialect string
+
+// The supported dialects.
+const (
+	Postgres Dialect = "postgres"
+	MySQL    Dialect = "mysql"
+)
+
+// Dialects are the supported dialects, named like their usual drivers.
+var Dialects = []Dialect{Postgres, MySQL}
+
+const (
+	resourcesTable = "boskos_resources"
+	drlcsTable     = "boskos_dynamic_resource_lifecycles"
+	versionsTable  = "boskos_schema_versions"
+	eventsTable    = "boskos_events"
+)
+
+var (
+	resourcesGroup = crds.Resource(crds.ResourceType.Plural)
+	drlcsGroup     = crds.Resource(crds.DRLCType.Plural)
+)
+
+// rebind replaces the ? placeholders of query with those of d.
+func (d Dialect) rebind(query string) string {
+	if d != Postgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// transactionalDDL tells whether the changes of the schema are rolled back
+// with their transaction. MySQL commits each of them on its own.
+func (d Dialect) transactionalDDL() bool {
+	return d != MySQL
+}
+
+// textType is the type of the columns holding objects, which may exceed the
+// 64KiB of a MySQL TEXT with large user data.
+func (d Dialect) textType() string {
+	if d == MySQL {
+		return "MEDIUMTEXT"
+	}
+	return "TEXT"
+}
+
+// migration is a change of the schema, applied once in version order.
+type migration struct {
+	version    int
+	statements func(d Dialect) []string
+}
+
+// migrations are the changes of the schema. They must never be edited once
+// released, changes go into a new migration.
+var migrations = []migration{
+	{
+		version: 1,
+		statements: func(d Dialect) []string {
+			var statements []string
+			for _, table := range []string{resourcesTable, drlcsTable} {
+				statements = append(statements, fmt.Sprintf(
+					"CREATE TABLE %s (name VARCHAR(253) NOT NULL PRIMARY KEY, revision BIGINT NOT NULL, object %s NOT NULL)",
+					table, d.textType()))
+			}
+			return statements
+		},
+	},
+	{
+		// The type is kept out of the object, so operators can query the
+		// resources of a type.
+		version: 2,
+		statements: func(d Dialect) []string {
+			return []string{
+				fmt.Sprintf("ALTER TABLE %s ADD COLUMN type VARCHAR(253) NOT NULL DEFAULT ''", resourcesTable),
+			}
+		},
+	},
+	{
+		// The archive of the events of the resources, see EventArchive.
+		version: 3,
+		statements: func(d Dialect) []string {
+			return []string{
+				fmt.Sprintf("CREATE TABLE %s (event_time BIGINT NOT NULL, kind VARCHAR(32) NOT NULL, name VARCHAR(253) NOT NULL, type VARCHAR(253) NOT NULL, state VARCHAR(253) NOT NULL, owner %s NOT NULL, previous_state VARCHAR(253) NOT NULL)", eventsTable, d.textType()),
+				fmt.Sprintf("CREATE INDEX %s_time ON %s (event_time)", eventsTable, eventsTable),
+				fmt.Sprintf("CREATE INDEX %s_name_time ON %s (name, event_time)", eventsTable, eventsTable),
+			}
+		},
+	},
+}
+
+// Backend stores the resources and DynamicResourceLifeCycles as JSON objects
+// in the rows of a table per kind. Every update increments the revision of the
+// row, which is the resource version of its object, so that concurrent updates
+// conflict like they do with custom resources.
+type Backend struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+var _ ranch.Backend = &Backend{}
+
+// NewBackend returns a Backend storing the resources in db, after applying
+// the migrations of the schema it lacks.
+func NewBackend(ctx context.Context, db *sql.DB, dialect Dialect) (*Backend, error) {
+	known := false
+	for _, d := range Dialects {
+		known = known || d == dialect
+	}
+	if !known {
+		return nil, fmt.Errorf("unknown SQL dialect %q, must be one of %v", dialect, Dialects)
+	}
+	b := &Backend{db: db, dialect: dialect}
+	if err := b.migrate(ctx); err != nil {
+		return nil, fmt.Errorf("failed to migrate the schema: %w", err)
+	}
+	return b, nil
+}
+
+// migrate applies the migrations newer than the version of the schema, each
+// in its own transaction where the dialect rolls back changes of the schema.
+// Elsewhere, a migration failing halfway leaves its version dirty, and no
+// migration is applied until an operator repairs the schema and deletes the
+// version.
+func (b *Backend) migrate(ctx context.Context) error {
+	if _, err := b.db.ExecContext(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (version INTEGER NOT NULL PRIMARY KEY, dirty INTEGER NOT NULL DEFAULT 0)", versionsTable)); err != nil {
+		return err
+	}
+	var dirty sql.NullInt64
+	if err := b.db.QueryRowContext(ctx, fmt.Sprintf("SELECT MIN(version) FROM %s WHERE dirty = 1", versionsTable)).Scan(&dirty); err != nil {
+		return err
+	}
+	if dirty.Valid {
+		return fmt.Errorf("migration %d failed halfway, repair the schema and delete the version from %s", dirty.Int64, versionsTable)
+	}
+	var current sql.NullInt64
+	if err := b.db.QueryRowContext(ctx, fmt.Sprintf("SELECT MAX(version) FROM %s", versionsTable)).Scan(&current); err != nil {
+		return err
+	}
+	for _, m := range migrations {
+		if int64(m.version) <= current.Int64 {
+			continue
+		}
+		apply := b.applyInTransaction
+		if !b.dialect.transactionalDDL() {
+			apply = b.applyMarkingDirty
+		}
+		if err := apply(ctx, m); err != nil {
+			return fmt.Errorf("migration %d failed: %w", m.version, err)
+		}
+		logrus.WithField("version", m.version).Info("Migrated the SQL schema")
+	}
+	return nil
+}
+
+// applyInTransaction applies m in a transaction, which rolls it back as a
+// whole if it fails.
+func (b *Backend) applyInTransaction(ctx context.Context, m migration) error {
+	tx, err := b.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, statement := range m.statements(b.dialect) {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+	// The primary key fails the migration of concurrent instances.
+	if _, err := tx.ExecContext(ctx, b.dialect.rebind(fmt.Sprintf("INSERT INTO %s (version) VALUES (?)", versionsTable)), m.version); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// applyMarkingDirty applies m, whose statements are committed one by one, with
+// its version marked dirty until all of them succeeded.
+func (b *Backend) applyMarkingDirty(ctx context.Context, m migration) error {
+	// The primary key fails the migration of concurrent instances before
+	// they change the schema.
+	if _, err := b.exec(ctx, fmt.Sprintf("INSERT INTO %s (version, dirty) VALUES (?, 1)", versionsTable), m.version); err != nil {
+		return err
+	}
+	for _, statement := range m.statements(b.dialect) {
+		if _, err := b.db.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("%w, the schema is left dirty", err)
+		}
+	}
+	_, err := b.exec(ctx, fmt.Sprintf("UPDATE %s SET dirty = 0 WHERE version = ?", versionsTable), m.version)
+	return err
+}
+
+func (b *Backend) exec(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	result, err := b.db.ExecContext(ctx, b.dialect.rebind(query), args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (b *Backend) exists(ctx context.Context, table, name string) (bool, error) {
+	var count int
+	if err := b.db.QueryRowContext(ctx, b.dialect.rebind(fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE name = ?", table)), name).Scan(&count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// encode encodes obj without its resource version, which is the revision of
+// its row.
+func encode(obj metav1.Object) (string, error) {
+	resourceVersion := obj.GetResourceVersion()
+	obj.SetResourceVersion("")
+	defer obj.SetResourceVersion(resourceVersion)
+	data, err := json.Marshal(obj)
+	return string(data), err
+}
+
+// columns are the columns of the table of a kind besides the name, revision
+// and object, with their values for an object.
+type columns map[string]interface{}
+
+func (b *Backend) create(ctx context.Context, group schema.GroupResource, table string, obj metav1.Object, extra columns) error {
+	if created := obj.GetCreationTimestamp(); created.IsZero() {
+		obj.SetCreationTimestamp(metav1.Now())
+	}
+	object, err := encode(obj)
+	if err != nil {
+		return err
+	}
+	names, placeholders := []string{"name", "revision", "object"}, []string{"?", "1", "?"}
+	args := []interface{}{obj.GetName(), object}
+	for column, value := range extra {
+		names, placeholders, args = append(names, column), append(placeholders, "?"), append(args, value)
+	}
+	if _, err := b.exec(ctx, fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table, strings.Join(names, ", "), strings.Join(placeholders, ", ")), args...); err != nil {
+		// Drivers report duplicate keys differently, so they are told apart
+		// from other failures by looking the row up.
+		if exists, existsErr := b.exists(ctx, table, obj.GetName()); existsErr == nil && exists {
+			return kerrors.NewAlreadyExists(group, obj.GetName())
+		}
+		return err
+	}
+	obj.SetResourceVersion("1")
+	return nil
+}
+
+func (b *Backend) get(ctx context.Context, group schema.GroupResource, table, name string, obj metav1.Object) error {
+	var revision int64
+	var object string
+	err := b.db.QueryRowContext(ctx, b.dialect.rebind(fmt.Sprintf("SELECT revision, object FROM %s WHERE name = ?", table)), name).Scan(&revision, &object)
+	if errors.Is(err, sql.ErrNoRows) {
+		return kerrors.NewNotFound(group, name)
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(object), obj); err != nil {
+		return fmt.Errorf("failed to decode %s %s: %w", group, name, err)
+	}
+	obj.SetResourceVersion(strconv.FormatInt(revision, 10))
+	return nil
+}
+
+// list calls decode with the object and resource version of every row of
+// table.
+func (b *Backend) list(ctx context.Context, table string, decode func(object []byte, resourceVersion string) error) error {
+	rows, err := b.db.QueryContext(ctx, fmt.Sprintf("SELECT name, revision, object FROM %s ORDER BY name", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, object string
+		var revision int64
+		if err := rows.Scan(&name, &revision, &object); err != nil {
+			return err
+		}
+		if err := decode([]byte(object), strconv.FormatInt(revision, 10)); err != nil {
+			return fmt.Errorf("failed to decode %s: %w", name, err)
+		}
+	}
+	return rows.Err()
+}
+
+// update replaces the object if its resource version is the revision of its
+// row, or unconditionally if it has no resource version.
+func (b *Backend) update(ctx context.Context, group schema.GroupResource, table string, obj metav1.Object, extra columns) error {
+	object, err := encode(obj)
+	if err != nil {
+		return err
+	}
+	set := []string{"revision = revision + 1", "object = ?"}
+	args := []interface{}{object}
+	for column, value := range extra {
+		set, args = append(set, column+" = ?"), append(args, value)
+	}
+	where := "name = ?"
+	args = append(args, obj.GetName())
+	if rv := obj.GetResourceVersion(); rv != "" {
+		revision, err := strconv.ParseInt(rv, 10, 64)
+		if err != nil {
+			return kerrors.NewBadRequest(fmt.Sprintf("invalid resource version %q", rv))
+		}
+		where += " AND revision = ?"
+		args = append(args, revision)
+	}
+
+	tx, err := b.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	result, err := tx.ExecContext(ctx, b.dialect.rebind(fmt.Sprintf("UPDATE %s SET %s WHERE %s", table, strings.Join(set, ", "), where)), args...)
+	if err != nil {
+		return err
+	}
+	if updated, err := result.RowsAffected(); err != nil {
+		return err
+	} else if updated == 0 {
+		if exists, err := b.exists(ctx, table, obj.GetName()); err != nil {
+			return err
+		} else if !exists {
+			return kerrors.NewNotFound(group, obj.GetName())
+		}
+		return kerrors.NewConflict(group, obj.GetName(), errors.New("the object has been modified; please apply your changes to the latest version and try again"))
+	}
+	var revision int64
+	if err := tx.QueryRowContext(ctx, b.dialect.rebind(fmt.Sprintf("SELECT revision FROM %s WHERE name = ?", table)), obj.GetName()).Scan(&revision); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	obj.SetResourceVersion(strconv.FormatInt(revision, 10))
+	return nil
+}
+
+func (b *Backend) delete(ctx context.Context, group schema.GroupResource, table, name string) error {
+	deleted, err := b.exec(ctx, fmt.Sprintf("DELETE FROM %s WHERE name = ?", table), name)
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return kerrors.NewNotFound(group, name)
+	}
+	return nil
+}
+
+// CreateResource implements ranch.Backend.
+func (b *Backend) CreateResource(ctx context.Context, resource *crds.ResourceObject) error {
+	return b.create(ctx, resourcesGroup, resourcesTable, resource, columns{"type": resource.Spec.Type})
+}
+
+// GetResource implements ranch.Backend.
+func (b *Backend) GetResource(ctx context.Context, name string) (*crds.ResourceObject, error) {
+	resource := &crds.ResourceObject{}
+	if err := b.get(ctx, resourcesGroup, resourcesTable, name, resource); err != nil {
+		return nil, err
+	}
+	return resource, nil
+}
+
+// ListResources implements ranch.Backend.
+func (b *Backend) ListResources(ctx context.Context) (*crds.ResourceObjectList, error) {
+	resourceList := &crds.ResourceObjectList{}
+	if err := b.list(ctx, resourcesTable, func(object []byte, resourceVersion string) error {
+		var resource crds.ResourceObject
+		if err := json.Unmarshal(object, &resource); err != nil {
+			return err
+		}
+		resource.ResourceVersion = resourceVersion
+		resourceList.Items = append(resourceList.Items, resource)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return resourceList, nil
+}
+
+// UpdateResource implements ranch.Backend.
+func (b *Backend) UpdateResource(ctx context.Context, resource *crds.ResourceObject) error {
+	return b.update(ctx, resourcesGroup, resourcesTable, resource, columns{"type": resource.Spec.Type})
+}
+
+// DeleteResource implements ranch.Backend.
+func (b *Backend) DeleteResource(ctx context.Context, name string) error {
+	return b.delete(ctx, resourcesGroup, resourcesTable, name)
+}
+
+// CreateDynamicResourceLifeCycle implements ranch.Backend.
+func (b *Backend) CreateDynamicResourceLifeCycle(ctx context.Context, drlc *crds.DRLCObject) error {
+	return b.create(ctx, drlcsGroup, drlcsTable, drlc, nil)
+}
+
+// GetDynamicResourceLifeCycle implements ranch.Backend.
+func (b *Backend) GetDynamicResourceLifeCycle(ctx context.Context, name string) (*crds.DRLCObject, error) {
+	drlc := &crds.DRLCObject{}
+	if err := b.get(ctx, drlcsGroup, drlcsTable, name, drlc); err != nil {
+		return nil, err
+	}
+	return drlc, nil
+}
+
+// ListDynamicResourceLifeCycles implements ranch.Backend.
+func (b *Backend) ListDynamicResourceLifeCycles(ctx context.Context) (*crds.DRLCObjectList, error) {
+	drlcList := &crds.DRLCObjectList{}
+	if err := b.list(ctx, drlcsTable, func(object []byte, resourceVersion string) error {
+		var drlc crds.DRLCObject
+		if err := json.Unmarshal(object, &drlc); err != nil {
+			return err
+		}
+		drlc.ResourceVersion = resourceVersion
+		drlcList.Items = append(drlcList.Items, drlc)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return drlcList, nil
+}
+
+// UpdateDynamicResourceLifeCycle implements ranch.Backend.
+func (b *Backend) UpdateDynamicResourceLifeCycle(ctx context.Context, drlc *crds.DRLCObject) error {
+	return b.update(ctx, drlcsGroup, drlcsTable, drlc, nil)
+}
+
+// DeleteDynamicResourceLifeCycle implements ranch.Backend.
+func (b *Backend) DeleteDynamicResourceLifeCycle(ctx context.Context, name string) error {
+	return b.delete(ctx, drlcsGroup, drlcsTable, name)
+}
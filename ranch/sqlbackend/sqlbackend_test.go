@@ -0,0 +1,299 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlbackend
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"sigs.k8s.io/boskos/crds"
+)
+
+func TestRebind(t *testing.T) {
+	testCases := []struct {
+		name     string
+		dialect  Dialect
+		query    string
+		expected string
+	}{
+		{
+			name:     "postgres numbers the placeholders",
+			dialect:  Postgres,
+			query:    "UPDATE t SET object = ? WHERE name = ? AND revision = ?",
+			expected: "UPDATE t SET object = $1 WHERE name = $2 AND revision = $3",
+		},
+		{
+			name:     "mysql keeps the placeholders",
+			dialect:  MySQL,
+			query:    "UPDATE t SET object = ? WHERE name = ?",
+			expected: "UPDATE t SET object = ? WHERE name = ?",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.dialect.rebind(tc.query); got != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestMigrationsAreOrdered(t *testing.T) {
+	for i, m := range migrations {
+		if m.version != i+1 {
+			t.Errorf("expected migration %d to have version %d, got %d", i, i+1, m.version)
+		}
+		for _, d := range Dialects {
+			if len(m.statements(d)) == 0 {
+				t.Errorf("migration %d has no statements for %s", m.version, d)
+			}
+		}
+	}
+}
+
+func TestNewBackendRejectsUnknownDialects(t *testing.T) {
+	if _, err := NewBackend(context.Background(), nil, "sqlite"); err == nil {
+		t.Error("expected an error for an unknown dialect")
+	}
+}
+
+func newMockBackend(t *testing.T, dialect Dialect) (*Backend, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("failed to create the mock database: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		db.Close()
+	})
+	return &Backend{db: db, dialect: dialect}, mock
+}
+
+func expectVersions(mock sqlmock.Sqlmock, dirty, current interface{}) {
+	mock.ExpectExec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (version INTEGER NOT NULL PRIMARY KEY, dirty INTEGER NOT NULL DEFAULT 0)", versionsTable)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(fmt.Sprintf("SELECT MIN(version) FROM %s WHERE dirty = 1", versionsTable)).
+		WillReturnRows(sqlmock.NewRows([]string{"min"}).AddRow(dirty))
+	if dirty == nil {
+		mock.ExpectQuery(fmt.Sprintf("SELECT MAX(version) FROM %s", versionsTable)).
+			WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(current))
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	latest := migrations[len(migrations)-1]
+
+	t.Run("postgres applies a migration in a transaction", func(t *testing.T) {
+		b, mock := newMockBackend(t, Postgres)
+		expectVersions(mock, nil, latest.version-1)
+		mock.ExpectBegin()
+		for _, statement := range latest.statements(Postgres) {
+			mock.ExpectExec(statement).WillReturnResult(sqlmock.NewResult(0, 0))
+		}
+		mock.ExpectExec(fmt.Sprintf("INSERT INTO %s (version) VALUES ($1)", versionsTable)).
+			WithArgs(latest.version).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		if err := b.migrate(context.Background()); err != nil {
+			t.Errorf("failed to migrate: %v", err)
+		}
+	})
+
+	t.Run("mysql marks a migration failing halfway as dirty", func(t *testing.T) {
+		b, mock := newMockBackend(t, MySQL)
+		expectVersions(mock, nil, latest.version-1)
+		mock.ExpectExec(fmt.Sprintf("INSERT INTO %s (version, dirty) VALUES (?, 1)", versionsTable)).
+			WithArgs(latest.version).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(latest.statements(MySQL)[0]).WillReturnError(errors.New("disk full"))
+		if err := b.migrate(context.Background()); err == nil {
+			t.Error("expected the migration to fail")
+		}
+	})
+
+	t.Run("mysql clears the version of a migration once applied", func(t *testing.T) {
+		b, mock := newMockBackend(t, MySQL)
+		expectVersions(mock, nil, latest.version-1)
+		mock.ExpectExec(fmt.Sprintf("INSERT INTO %s (version, dirty) VALUES (?, 1)", versionsTable)).
+			WithArgs(latest.version).WillReturnResult(sqlmock.NewResult(0, 1))
+		for _, statement := range latest.statements(MySQL) {
+			mock.ExpectExec(statement).WillReturnResult(sqlmock.NewResult(0, 0))
+		}
+		mock.ExpectExec(fmt.Sprintf("UPDATE %s SET dirty = 0 WHERE version = ?", versionsTable)).
+			WithArgs(latest.version).WillReturnResult(sqlmock.NewResult(0, 1))
+		if err := b.migrate(context.Background()); err != nil {
+			t.Errorf("failed to migrate: %v", err)
+		}
+	})
+
+	t.Run("a dirty schema is not migrated", func(t *testing.T) {
+		b, mock := newMockBackend(t, MySQL)
+		expectVersions(mock, 2, nil)
+		if err := b.migrate(context.Background()); err == nil {
+			t.Error("expected a dirty schema to fail the migration")
+		}
+	})
+}
+
+func TestCreateResource(t *testing.T) {
+	created := metav1.Unix(1600000000, 0)
+	resource := &crds.ResourceObject{ObjectMeta: metav1.ObjectMeta{Name: "res", CreationTimestamp: created}, Spec: crds.ResourceSpec{Type: "t"}}
+	object, err := encode(resource)
+	if err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	insert := fmt.Sprintf("INSERT INTO %s (name, revision, object, type) VALUES ($1, 1, $2, $3)", resourcesTable)
+
+	b, mock := newMockBackend(t, Postgres)
+	mock.ExpectExec(insert).WithArgs("res", object, "t").WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := b.CreateResource(context.Background(), resource); err != nil {
+		t.Fatalf("failed to create: %v", err)
+	}
+	if resource.ResourceVersion != "1" {
+		t.Errorf("expected the first revision, got %q", resource.ResourceVersion)
+	}
+
+	// Duplicate keys are told apart from other failures by looking the row up.
+	resource.ResourceVersion = ""
+	mock.ExpectExec(insert).WithArgs("res", object, "t").WillReturnError(errors.New("duplicate key"))
+	mock.ExpectQuery(fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE name = $1", resourcesTable)).
+		WithArgs("res").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	if err := b.CreateResource(context.Background(), resource); !kerrors.IsAlreadyExists(err) {
+		t.Errorf("expected an already exists error, got %v", err)
+	}
+}
+
+func TestGetResource(t *testing.T) {
+	query := fmt.Sprintf("SELECT revision, object FROM %s WHERE name = ?", resourcesTable)
+	b, mock := newMockBackend(t, MySQL)
+
+	mock.ExpectQuery(query).WithArgs("res").
+		WillReturnRows(sqlmock.NewRows([]string{"revision", "object"}).AddRow(3, `{"metadata":{"name":"res"},"spec":{"type":"t"}}`))
+	resource, err := b.GetResource(context.Background(), "res")
+	if err != nil {
+		t.Fatalf("failed to get: %v", err)
+	}
+	if resource.Name != "res" || resource.Spec.Type != "t" || resource.ResourceVersion != "3" {
+		t.Errorf("expected res of type t at revision 3, got %+v", resource)
+	}
+
+	mock.ExpectQuery(query).WithArgs("missing").WillReturnError(sql.ErrNoRows)
+	if _, err := b.GetResource(context.Background(), "missing"); !kerrors.IsNotFound(err) {
+		t.Errorf("expected a not found error, got %v", err)
+	}
+}
+
+func TestListResources(t *testing.T) {
+	b, mock := newMockBackend(t, MySQL)
+	mock.ExpectQuery(fmt.Sprintf("SELECT name, revision, object FROM %s ORDER BY name", resourcesTable)).
+		WillReturnRows(sqlmock.NewRows([]string{"name", "revision", "object"}).
+			AddRow("a", 1, `{"metadata":{"name":"a"}}`).
+			AddRow("b", 2, `{"metadata":{"name":"b"}}`))
+	list, err := b.ListResources(context.Background())
+	if err != nil {
+		t.Fatalf("failed to list: %v", err)
+	}
+	if len(list.Items) != 2 || list.Items[0].ResourceVersion != "1" || list.Items[1].ResourceVersion != "2" {
+		t.Errorf("expected a and b at their revisions, got %+v", list.Items)
+	}
+}
+
+func TestUpdateResource(t *testing.T) {
+	update := fmt.Sprintf("UPDATE %s SET revision = revision + 1, object = ?, type = ? WHERE name = ? AND revision = ?", resourcesTable)
+	exists := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE name = ?", resourcesTable)
+	newResource := func() *crds.ResourceObject {
+		return &crds.ResourceObject{ObjectMeta: metav1.ObjectMeta{Name: "res", ResourceVersion: "3"}, Spec: crds.ResourceSpec{Type: "t"}}
+	}
+	testCases := []struct {
+		name    string
+		expect  func(mock sqlmock.Sqlmock, object string)
+		checkFn func(error) bool
+		version string
+	}{
+		{
+			name: "the revision is incremented",
+			expect: func(mock sqlmock.Sqlmock, object string) {
+				mock.ExpectBegin()
+				mock.ExpectExec(update).WithArgs(object, "t", "res", 3).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(fmt.Sprintf("SELECT revision FROM %s WHERE name = ?", resourcesTable)).WithArgs("res").
+					WillReturnRows(sqlmock.NewRows([]string{"revision"}).AddRow(4))
+				mock.ExpectCommit()
+			},
+			checkFn: func(err error) bool { return err == nil },
+			version: "4",
+		},
+		{
+			name: "a stale revision conflicts",
+			expect: func(mock sqlmock.Sqlmock, object string) {
+				mock.ExpectBegin()
+				mock.ExpectExec(update).WithArgs(object, "t", "res", 3).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(exists).WithArgs("res").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+				mock.ExpectRollback()
+			},
+			checkFn: kerrors.IsConflict,
+			version: "3",
+		},
+		{
+			name: "a missing row is not found",
+			expect: func(mock sqlmock.Sqlmock, object string) {
+				mock.ExpectBegin()
+				mock.ExpectExec(update).WithArgs(object, "t", "res", 3).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(exists).WithArgs("res").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				mock.ExpectRollback()
+			},
+			checkFn: kerrors.IsNotFound,
+			version: "3",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			b, mock := newMockBackend(t, MySQL)
+			resource := newResource()
+			object, err := encode(resource)
+			if err != nil {
+				t.Fatalf("failed to encode: %v", err)
+			}
+			tc.expect(mock, object)
+			if err := b.UpdateResource(context.Background(), resource); !tc.checkFn(err) {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if resource.ResourceVersion != tc.version {
+				t.Errorf("expected resource version %q, got %q", tc.version, resource.ResourceVersion)
+			}
+		})
+	}
+}
+
+func TestDeleteResource(t *testing.T) {
+	b, mock := newMockBackend(t, MySQL)
+	statement := fmt.Sprintf("DELETE FROM %s WHERE name = ?", resourcesTable)
+	mock.ExpectExec(statement).WithArgs("res").WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := b.DeleteResource(context.Background(), "res"); err != nil {
+		t.Errorf("failed to delete: %v", err)
+	}
+	mock.ExpectExec(statement).WithArgs("res").WillReturnResult(sqlmock.NewResult(0, 0))
+	if err := b.DeleteResource(context.Background(), "res"); !kerrors.IsNotFound(err) {
+		t.Errorf("expected a not found error, got %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"fmt"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/crds"
+)
+
+// TransitionNotAllowed will be returned if a state change is not one of the
+// transitions allowed for the resource type.
+type TransitionNotAllowed struct {
+	name, from, to string
+	allowed        []string
+}
+
+func (t TransitionNotAllowed) Error() string {
+	msg := fmt.Sprintf("transition of resource %s from %s to %s not allowed", t.name, t.from, t.to)
+	if len(t.allowed) == 0 {
+		return msg + fmt.Sprintf(": no transition is allowed from %s", t.from)
+	}
+	return msg + fmt.Sprintf(": must be to one of %v", t.allowed)
+}
+
+// stateManager holds the states clients may request for each resource type,
+// and the transitions allowed between them.
+type stateManager struct {
+	lock        sync.RWMutex
+	states      map[string]sets.String
+	transitions map[string]map[string]sets.String
+	// aliases are the former names of the states of each type.
+	aliases map[string]map[string]string
+}
+
+func newStateManager() *stateManager {
+	return &stateManager{states: map[string]sets.String{}, transitions: map[string]map[string]sets.String{}, aliases: map[string]map[string]string{}}
+}
+
+func (s *stateManager) set(config *common.BoskosConfig) {
+	states := map[string]sets.String{}
+	transitions := map[string]map[string]sets.String{}
+	aliases := map[string]map[string]string{}
+	for _, entry := range config.Resources {
+		if len(entry.States) > 0 {
+			states[entry.Type] = sets.NewString(entry.States...)
+		}
+		if len(entry.Transitions) > 0 {
+			transitions[entry.Type] = map[string]sets.String{}
+			for from, to := range entry.Transitions {
+				transitions[entry.Type][from] = sets.NewString(to...)
+			}
+		}
+		if len(entry.StateAliases) > 0 {
+			aliases[entry.Type] = entry.StateAliases
+		}
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.states = states
+	s.transitions = transitions
+	s.aliases = aliases
+}
+
+// allowedTransitions returns the states resources of rType may move to from
+// the state from, and false if any transition is allowed.
+func (s *stateManager) allowedTransitions(rType, from string) (sets.String, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	transitions, ok := s.transitions[rType]
+	if !ok {
+		return nil, false
+	}
+	return transitions[from], true
+}
+
+// checkTransition rejects moving res to the state to unless it is one of the
+// transitions allowed for its type. Staying in the same state is always
+// allowed.
+func (r *Ranch) checkTransition(res *crds.ResourceObject, to string) error {
+	from := res.Status.State
+	if from == to {
+		return nil
+	}
+	allowed, ok := r.states.allowedTransitions(res.Spec.Type, from)
+	if !ok || allowed.Has(to) {
+		return nil
+	}
+	return &TransitionNotAllowed{name: res.Name, from: from, to: to, allowed: allowed.List()}
+}
+
+func (s *stateManager) get(rType string) sets.String {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.states[rType]
+}
+
+// AllowedStates returns the states clients may request for resources of
+// rType, sorted, and false if any state is allowed.
+func (r *Ranch) AllowedStates(rType string) ([]string, bool) {
+	states := r.states.get(rType)
+	if states == nil {
+		return nil, false
+	}
+	return states.List(), true
+}
+
+// ResolveState returns the state of rType that state refers to, which is state
+// itself unless it is a former name of a state, and whether it is one.
+func (r *Ranch) ResolveState(rType, state string) (string, bool) {
+	r.states.lock.RLock()
+	defer r.states.lock.RUnlock()
+	if resolved, ok := r.states.aliases[rType][state]; ok {
+		return resolved, true
+	}
+	return state, false
+}
@@ -27,7 +27,6 @@ import (
 	"github.com/sirupsen/logrus"
 	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/types"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/wait"
@@ -40,10 +39,47 @@ import (
 
 // Storage is used to decouple ranch functionality with the resource persistence layer
 type Storage struct {
-	ctx           context.Context
-	client        ctrlruntimeclient.Client
+	*storageState
+	// ctx is the context of the calls to the backend, see WithContext.
+	ctx context.Context
+}
+
+// storageState is shared by a Storage and its views of WithContext.
+type storageState struct {
+	backend Backend
+	// decorated is the outermost decorator of backend, which wraps the
+	// decorators set up later, like those of SetUserDataOptions.
+	decorated *abandonCountingBackend
+	// namespace is the namespace the read replicas list the resources in.
 	namespace     string
 	resourcesLock sync.RWMutex
+	// demand is the declared upcoming demand dynamic resources are sized for.
+	demand *demandTracker
+	// replicas serve the reads of listings when the client fails.
+	replicas []ctrlruntimeclient.Reader
+	// dynamicErrors counts the errors updating dynamic resources.
+	dynamicErrors *dynamicErrorCounter
+	// regions places new dynamic resources in the region with the most quota
+	// headroom.
+	regions *regionTracker
+	// tenants holds the tenant owning the pool of each type.
+	tenants *tenantTracker
+	// configSyncs tracks the health of the config syncs.
+	configSyncs *configSyncTracker
+	// watchers are streamed the changes of the states of the resources.
+	watchers *watchBroadcaster
+	// readOnly is 1 while changes are rejected, see Ranch.SetReadOnly.
+	readOnly int32
+	// follower is 1 while the leader of the replicas changes the storage,
+	// see Ranch.SetFollower.
+	follower int32
+	// abandoned counts the calls to the backend abandoned with their context.
+	abandoned *abandonedOperationCounter
+	// informer, if set and synced, serves ForEachResource.
+	informer ResourceInformer
+	// userDataLimit, if positive, is the largest value a key of user data may
+	// be updated to, see SetUserDataOptions.
+	userDataLimit int
 
 	// For testing
 	now          func() metav1.Time
@@ -52,60 +88,135 @@ type Storage struct {
 
 // NewTestingStorage is used only for testing.
 func NewTestingStorage(client ctrlruntimeclient.Client, namespace string, updateTime func() metav1.Time) *Storage {
-	return &Storage{
-		ctx:       context.Background(),
-		client:    client,
-		namespace: namespace,
-		now:       updateTime,
-	}
+	s := newStorage(context.Background(), NewCRDBackend(client, namespace))
+	s.namespace = namespace
+	s.now = updateTime
+	return s
 }
 
 // NewStorage instantiates a new Storage with a PersistenceLayer implementation
 func NewStorage(ctx context.Context, client ctrlruntimeclient.Client, namespace string) *Storage {
+	s := NewStorageWithBackend(ctx, NewCRDBackend(client, namespace))
+	s.namespace = namespace
+	return s
+}
+
+// NewStorageWithBackend instantiates a new Storage persisting the resources in
+// backend, e.g. to run outside of a Kubernetes cluster.
+func NewStorageWithBackend(ctx context.Context, backend Backend) *Storage {
+	return newStorage(ctx, backend)
+}
+
+func newStorage(ctx context.Context, backend Backend) *Storage {
+	abandoned := newAbandonedOperationCounter()
+	decorated := &abandonCountingBackend{Backend: &tracingBackend{Backend: backend}, counter: abandoned}
 	return &Storage{
-		ctx:          ctx,
-		client:       client,
-		namespace:    namespace,
-		now:          metav1.Now,
-		generateName: common.GenerateDynamicResourceName,
+		storageState: &storageState{
+			backend:       decorated,
+			decorated:     decorated,
+			demand:        newDemandTracker(),
+			dynamicErrors: newDynamicErrorCounter(),
+			regions:       newRegionTracker(),
+			tenants:       newTenantTracker(),
+			configSyncs:   newConfigSyncTracker(),
+			watchers:      newWatchBroadcaster(),
+			abandoned:     abandoned,
+			now:           metav1.Now,
+			generateName:  common.GenerateDynamicResourceName,
+		},
+		ctx: ctx,
 	}
 }
 
+// WithContext returns a view of the storage making the calls to the backend
+// with ctx, e.g. so they are abandoned along with the request they serve.
+func (s *Storage) WithContext(ctx context.Context) *Storage {
+	return &Storage{storageState: s.storageState, ctx: ctx}
+}
+
+// replicaReadTimeout bounds reads from a read replica, whose cache may not
+// have synced.
+const replicaReadTimeout = 10 * time.Second
+
+// SetReadReplicas sets readers of clusters the resources are replicated to,
+// which serve reads for listings like metrics when the client fails, e.g.
+// during an apiserver outage. Writes always go to the client. Replicas are
+// only supported by the Storage of NewStorage.
+func (s *Storage) SetReadReplicas(replicas ...ctrlruntimeclient.Reader) {
+	s.replicas = replicas
+}
+
 // AddResource adds a new resource
 func (s *Storage) AddResource(resource *crds.ResourceObject) error {
-	resource.Namespace = s.namespace
-	return s.client.Create(s.ctx, resource)
+	if err := s.checkWritable(); err != nil {
+		return err
+	}
+	if err := s.backend.CreateResource(s.ctx, resource); err != nil {
+		return err
+	}
+	s.publishResourceEvent(common.ResourceAdded, resource, "")
+	return nil
 }
 
 // DeleteResource deletes a resource if it exists, errors otherwise
 func (s *Storage) DeleteResource(name string) error {
-	o := &crds.ResourceObject{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      name,
-			Namespace: s.namespace,
-		},
+	if err := s.checkWritable(); err != nil {
+		return err
+	}
+	// The type of the resource is only known before deleting it.
+	var deleted *crds.ResourceObject
+	if s.watchers.watched() {
+		deleted, _ = s.backend.GetResource(s.ctx, name)
 	}
-	return s.client.Delete(s.ctx, o)
+	if err := s.backend.DeleteResource(s.ctx, name); err != nil {
+		return err
+	}
+	if deleted != nil {
+		s.publishResourceEvent(common.ResourceDeleted, deleted, "")
+	}
+	return nil
 }
 
 // UpdateResource updates a resource if it exists, errors otherwise
 func (s *Storage) UpdateResource(resource *crds.ResourceObject) (*crds.ResourceObject, error) {
-	resource.Namespace = s.namespace
+	if err := s.checkWritable(); err != nil {
+		return nil, err
+	}
 	resource.Status.LastUpdate = s.now()
 
-	if err := s.client.Update(s.ctx, resource); err != nil {
+	// The previous state is only looked up while someone watches.
+	var previous *crds.ResourceObject
+	if s.watchers.watched() {
+		previous, _ = s.backend.GetResource(s.ctx, resource.Name)
+	}
+	if err := s.backend.UpdateResource(s.ctx, resource); err != nil {
 		return nil, fmt.Errorf("failed to update resources %s: %w", resource.Name, err)
 	}
+	if previous != nil && (previous.Status.State != resource.Status.State || previous.Status.Owner != resource.Status.Owner) {
+		s.publishResourceEvent(common.ResourceChanged, resource, previous.Status.State)
+	}
 
 	return resource, nil
 }
 
+// updateResourceKeepingLastUpdate is UpdateResource for changes which are no
+// activity on the resource, like notes of operators, so that they neither
+// renew leases which went stale nor count as heartbeats of the owner.
+func (s *Storage) updateResourceKeepingLastUpdate(resource *crds.ResourceObject) error {
+	if err := s.checkWritable(); err != nil {
+		return err
+	}
+	if err := s.backend.UpdateResource(s.ctx, resource); err != nil {
+		return fmt.Errorf("failed to update resources %s: %w", resource.Name, err)
+	}
+	return nil
+}
+
 // GetResource gets an existing resource, errors otherwise
 func (s *Storage) GetResource(name string) (*crds.ResourceObject, error) {
-	o := &crds.ResourceObject{}
-	nn := types.NamespacedName{Namespace: s.namespace, Name: name}
-	if err := s.client.Get(s.ctx, nn, o); err != nil {
-		return nil, fmt.Errorf("failed to get resource %s: %v", name, err)
+	o, err := s.backend.GetResource(s.ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get resource %s: %w", name, err)
 	}
 	if o.Status.UserData == nil {
 		o.Status.UserData = map[string]string{}
@@ -116,37 +227,64 @@ func (s *Storage) GetResource(name string) (*crds.ResourceObject, error) {
 
 // GetResources list all resources
 func (s *Storage) GetResources() (*crds.ResourceObjectList, error) {
-	resourceList := &crds.ResourceObjectList{}
-	if err := s.client.List(s.ctx, resourceList, ctrlruntimeclient.InNamespace(s.namespace)); err != nil {
+	resourceList, err := s.backend.ListResources(s.ctx)
+	if err != nil {
 		return nil, fmt.Errorf("failed to list resources; %v", err)
 	}
 
+	sortByLastUpdate(resourceList)
+
+	return resourceList, nil
+}
+
+// GetResourcesForRead is like GetResources, but falls back to the read
+// replicas when the client fails. The resources it returns may be stale, so
+// they must only be read, never updated.
+func (s *Storage) GetResourcesForRead() (*crds.ResourceObjectList, error) {
+	resourceList, err := s.GetResources()
+	if err == nil || len(s.replicas) == 0 {
+		return resourceList, err
+	}
+	for idx, replica := range s.replicas {
+		replicaList := &crds.ResourceObjectList{}
+		ctx, cancel := context.WithTimeout(s.ctx, replicaReadTimeout)
+		replicaErr := replica.List(ctx, replicaList, ctrlruntimeclient.InNamespace(s.namespace))
+		cancel()
+		if replicaErr != nil {
+			logrus.WithError(replicaErr).Warningf("failed to list resources from read replica %d", idx)
+			continue
+		}
+		logrus.WithError(err).Warningf("Listed resources from read replica %d", idx)
+		sortByLastUpdate(replicaList)
+		return replicaList, nil
+	}
+	return nil, err
+}
+
+func sortByLastUpdate(resourceList *crds.ResourceObjectList) {
 	sort.SliceStable(resourceList.Items, func(i, j int) bool {
 		return resourceList.Items[i].Status.LastUpdate.Time.Before(resourceList.Items[j].Status.LastUpdate.Time)
 	})
-
-	return resourceList, nil
 }
 
 // AddDynamicResourceLifeCycle adds a new dynamic resource life cycle
 func (s *Storage) AddDynamicResourceLifeCycle(resource *crds.DRLCObject) error {
-	resource.Namespace = s.namespace
-	return s.client.Create(s.ctx, resource)
+	if err := s.checkWritable(); err != nil {
+		return err
+	}
+	return s.backend.CreateDynamicResourceLifeCycle(s.ctx, resource)
 }
 
 // DeleteDynamicResourceLifeCycle deletes a dynamic resource life cycle if it exists, errors otherwise
 func (s *Storage) DeleteDynamicResourceLifeCycle(name string) error {
-	o := &crds.DRLCObject{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      name,
-			Namespace: s.namespace,
-		},
+	if err := s.checkWritable(); err != nil {
+		return err
 	}
-	if err := s.client.Delete(s.ctx, o); err != nil {
+	if err := s.backend.DeleteDynamicResourceLifeCycle(s.ctx, name); err != nil {
 		return err
 	}
 	if err := wait.Poll(100*time.Millisecond, 5*time.Second, func() (bool, error) {
-		if err := s.client.Get(s.ctx, ctrlruntimeclient.ObjectKey{Namespace: s.namespace, Name: name}, o); err != nil {
+		if _, err := s.backend.GetDynamicResourceLifeCycle(s.ctx, name); err != nil {
 			if kerrors.IsNotFound(err) {
 				return true, nil
 			}
@@ -154,24 +292,26 @@ func (s *Storage) DeleteDynamicResourceLifeCycle(name string) error {
 		}
 		return false, nil
 	}); err != nil {
-		return fmt.Errorf("failed for deleted dynamic resource lifecycle %s/%s to vanish from cache: %w", s.namespace, name, err)
+		return fmt.Errorf("failed for deleted dynamic resource lifecycle %s to vanish from cache: %w", name, err)
 	}
 	return nil
 }
 
 // UpdateDynamicResourceLifeCycle updates a dynamic resource life cycle. if it exists, errors otherwise
 func (s *Storage) UpdateDynamicResourceLifeCycle(resource *crds.DRLCObject) (*crds.DRLCObject, error) {
-	resource.Namespace = s.namespace
-	if err := s.client.Update(s.ctx, resource); err != nil {
+	if err := s.checkWritable(); err != nil {
+		return nil, err
+	}
+	if err := s.backend.UpdateDynamicResourceLifeCycle(s.ctx, resource); err != nil {
 		return nil, fmt.Errorf("failed to update dlrc %s: %w", resource.Name, err)
 	}
 
 	// Make sure we have this change in our cache
 	expectedSpec := resource.Spec
-	name := ctrlruntimeclient.ObjectKey{Namespace: resource.Namespace, Name: resource.Name}
+	name := resource.Name
 	if err := wait.Poll(100*time.Millisecond, 5*time.Second, func() (bool, error) {
-		drlc := &crds.DRLCObject{}
-		if err := s.client.Get(s.ctx, name, drlc); err != nil {
+		drlc, err := s.backend.GetDynamicResourceLifeCycle(s.ctx, name)
+		if err != nil {
 			return false, err
 		}
 		return reflect.DeepEqual(expectedSpec, drlc.Spec), nil
@@ -184,9 +324,8 @@ func (s *Storage) UpdateDynamicResourceLifeCycle(resource *crds.DRLCObject) (*cr
 
 // GetDynamicResourceLifeCycle gets an existing dynamic resource life cycle, errors otherwise
 func (s *Storage) GetDynamicResourceLifeCycle(name string) (*crds.DRLCObject, error) {
-	drlc := &crds.DRLCObject{}
-	nn := types.NamespacedName{Namespace: s.namespace, Name: name}
-	if err := s.client.Get(s.ctx, nn, drlc); err != nil {
+	drlc, err := s.backend.GetDynamicResourceLifeCycle(s.ctx, name)
+	if err != nil {
 		return nil, fmt.Errorf("failed to get dlrc %s: %q", name, err)
 	}
 
@@ -195,8 +334,8 @@ func (s *Storage) GetDynamicResourceLifeCycle(name string) (*crds.DRLCObject, er
 
 // GetDynamicResourceLifeCycles list all dynamic resource life cycle
 func (s *Storage) GetDynamicResourceLifeCycles() (*crds.DRLCObjectList, error) {
-	drlcList := &crds.DRLCObjectList{}
-	if err := s.client.List(s.ctx, drlcList, ctrlruntimeclient.InNamespace(s.namespace)); err != nil {
+	drlcList, err := s.backend.ListDynamicResourceLifeCycles(s.ctx)
+	if err != nil {
 		return nil, fmt.Errorf("failed to list drlcs: %v", err)
 	}
 
@@ -219,11 +358,13 @@ func (s *Storage) SyncResources(config *common.BoskosConfig) error {
 		existingSRByName := map[string]crds.ResourceObject{}
 		newDRLCByType := map[string]crds.DRLCObject{}
 		existingDRLCByType := map[string]crds.DRLCObject{}
+		staticTypes := sets.String{}
 
 		for _, entry := range config.Resources {
 			if entry.IsDRLC() {
 				newDRLCByType[entry.Type] = *crds.FromDynamicResourceLifecycle(common.NewDynamicResourceLifeCycleFromConfig(entry))
 			} else {
+				staticTypes.Insert(entry.Type)
 				for _, res := range common.NewResourcesFromConfig(entry) {
 					staticResourcesFromConfigByName[res.Name] = *crds.FromResource(res)
 				}
@@ -259,6 +400,11 @@ func (s *Storage) SyncResources(config *common.BoskosConfig) error {
 			}
 
 			for _, res := range resources.Items {
+				if (res.Labels[common.ImportedLabel] != "" || res.Labels[common.EphemeralLabel] != "") && staticTypes.Has(res.Spec.Type) {
+					// Imported and ephemeral resources are not listed in the
+					// config.
+					continue
+				}
 				if _, inStaticConfig := staticResourcesFromConfigByName[res.Name]; inStaticConfig || !lifeCycleTypes.Has(res.Spec.Type) {
 					existingSRByName[res.Name] = res
 				}
@@ -293,6 +439,15 @@ func (s *Storage) SyncResources(config *common.BoskosConfig) error {
 // It will make sure than MinCount of resource exists, and attempt to delete expired and resources over MaxCount.
 // If resources are held by another user than Boskos, they will be deleted in a following cycle.
 func (s *Storage) updateDynamicResources(lifecycle *crds.DRLCObject, resources []crds.ResourceObject) (toAdd, toDelete []crds.ResourceObject) {
+	if len(lifecycle.Spec.Flavors) > 0 {
+		return s.updateFlavoredResources(lifecycle, resources)
+	}
+	return s.updateResourcesWithin(lifecycle, nil, resources, s.minCount(lifecycle, resources), lifecycle.Spec.MaxCount)
+}
+
+// updateResourcesWithin implements updateDynamicResources for resources, the
+// resources of flavor if set, keeping them within minCount and maxCount.
+func (s *Storage) updateResourcesWithin(lifecycle *crds.DRLCObject, flavor *common.DynamicResourceFlavor, resources []crds.ResourceObject, minCount, maxCount int) (toAdd, toDelete []crds.ResourceObject) {
 	var notInUseRes []crds.ResourceObject
 	tombStoned := 0
 	toBeDeleted := 0
@@ -317,6 +472,11 @@ func (s *Storage) updateDynamicResources(lifecycle *crds.DRLCObject, resources [
 				// to be released first.
 				toDelete = append(toDelete, r)
 				toBeDeleted++
+			} else if s.pastMaxLifetime(lifecycle, &r) {
+				// Retired like expired resources, and replaced once tombstoned.
+				logrus.Infof("Retiring resource %s of type %s created %v", r.Name, lifecycle.Name, r.CreationTimestamp)
+				toDelete = append(toDelete, r)
+				toBeDeleted++
 			} else {
 				notInUseRes = append(notInUseRes, r)
 			}
@@ -325,8 +485,12 @@ func (s *Storage) updateDynamicResources(lifecycle *crds.DRLCObject, resources [
 
 	// Tombstoned resources are ready to be fully deleted, so replace them if necessary.
 	activeCount := len(resources) - tombStoned
-	for i := activeCount; i < lifecycle.Spec.MinCount; i++ {
+	for i := activeCount; i < minCount; i++ {
 		res := newResourceFromNewDynamicResourceLifeCycle(s.generateName(), lifecycle, s.now())
+		s.stampCreation(res, lifecycle)
+		s.placeInRegion(res, append(resources, toAdd...))
+		s.stampFlavor(res, flavor)
+		s.stampTenant(res)
 		toAdd = append(toAdd, *res)
 		activeCount++
 	}
@@ -334,7 +498,7 @@ func (s *Storage) updateDynamicResources(lifecycle *crds.DRLCObject, resources [
 	// ToBeDeleted resources may take some time to be fully cleaned up.
 	// We can temporarily exceed MaxCount while these are being cleaned up,
 	// particularly if MaxCount was recently lowered.
-	numberOfResToDelete := activeCount - toBeDeleted - lifecycle.Spec.MaxCount
+	numberOfResToDelete := activeCount - toBeDeleted - maxCount
 	// Sorting to get consistent deletion mechanism (ease testing)
 	sort.SliceStable(notInUseRes, func(i, j int) bool {
 		return notInUseRes[i].Name > notInUseRes[j].Name
@@ -349,73 +513,91 @@ func (s *Storage) updateDynamicResources(lifecycle *crds.DRLCObject, resources [
 	return
 }
 
+// stampCreation records the creation time of res, a new dynamic resource, if
+// its type retires resources past their max lifetime. Most backends record it
+// on their own, but not all of them.
+func (s *Storage) stampCreation(res *crds.ResourceObject, lifecycle *crds.DRLCObject) {
+	if lifecycle.Spec.MaxLifetime != nil {
+		res.CreationTimestamp = s.now()
+	}
+}
+
+// pastMaxLifetime returns whether res, a dynamic resource of lifecycle, is
+// older than the max lifetime of its type. Resources whose creation time is
+// unknown never are.
+func (s *Storage) pastMaxLifetime(lifecycle *crds.DRLCObject, res *crds.ResourceObject) bool {
+	if lifecycle.Spec.MaxLifetime == nil || res.CreationTimestamp.IsZero() {
+		return false
+	}
+	return s.now().Sub(res.CreationTimestamp.Time) > *lifecycle.Spec.MaxLifetime
+}
+
 // UpdateAllDynamicResources queries for all existing DynamicResourceLifeCycles
 // and dynamic resources and calls updateDynamicResources for each type.
 // This ensures that the MinCount and MaxCount parameters are honored, that
 // any expired resources are deleted, and that any Tombstoned resources are
 // completely removed.
-// nolint:gocognit
+// Each type is updated on its own, so errors updating one type don't stall
+// the others. Errors are retried depending on their class, see
+// classifyDynamicError.
 func (s *Storage) UpdateAllDynamicResources(staticResources map[string]crds.ResourceObject) error {
 	s.resourcesLock.Lock()
 	defer s.resourcesLock.Unlock()
 
-	return retryOnConflict(retry.DefaultBackoff, func() error {
-		var resToAdd, resToDelete []crds.ResourceObject
-		var dRLCToDelete []crds.DRLCObject
-		existingDRLCByType := map[string]crds.DRLCObject{}
-		existingDRsByType := map[string][]crds.ResourceObject{}
-
-		resources, err := s.GetResources()
-		if err != nil {
-			return err
-		}
-		existingDRLC, err := s.GetDynamicResourceLifeCycles()
-		if err != nil {
-			return err
-		}
-		for _, dRLC := range existingDRLC.Items {
-			existingDRLCByType[dRLC.Name] = dRLC
+	existingDRLC, err := s.GetDynamicResourceLifeCycles()
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, dRLC := range existingDRLC.Items {
+		rType := dRLC.Name
+		if err := s.updateDynamicResourcesWithRetries(rType, func() error {
+			return s.updateDynamicResourcesOfType(rType, staticResources)
+		}); err != nil {
+			logrus.WithError(err).WithField("type", rType).Error("Failed to update dynamic resources.")
+			errs = append(errs, err)
 		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
 
-		// Filter to only look at dynamic resources
-		for _, res := range resources.Items {
-			// Do not delete objects that have a static config
-			if _, hasStaticConfig := staticResources[res.Name]; hasStaticConfig {
-				continue
-			}
-			if _, ok := existingDRLCByType[res.Spec.Type]; ok {
-				existingDRsByType[res.Spec.Type] = append(existingDRsByType[res.Spec.Type], res)
-			}
-		}
+// updateDynamicResourcesOfType calls updateDynamicResources for rType, and
+// deletes its DynamicResourceLifeCycle once it is being removed and its
+// resources are gone.
+func (s *Storage) updateDynamicResourcesOfType(rType string, staticResources map[string]crds.ResourceObject) error {
+	dRLC, err := s.GetDynamicResourceLifeCycle(rType)
+	if err != nil {
+		return err
+	}
+	resources, err := s.GetResources()
+	if err != nil {
+		return err
+	}
 
-		for resType, dRLC := range existingDRLCByType {
-			existingDRs := existingDRsByType[resType]
-			toAdd, toDelete := s.updateDynamicResources(&dRLC, existingDRs)
-			resToAdd = append(resToAdd, toAdd...)
-			resToDelete = append(resToDelete, toDelete...)
-
-			if dRLC.Spec.MinCount == 0 && dRLC.Spec.MaxCount == 0 {
-				currentCount := len(existingDRs)
-				addCount := len(resToAdd)
-				delCount := len(resToDelete)
-				if addCount == 0 && (currentCount == 0 || currentCount == delCount) {
-					dRLCToDelete = append(dRLCToDelete, dRLC)
-				}
-			}
+	// Filter to only look at dynamic resources
+	var existingDRs []crds.ResourceObject
+	for _, res := range resources.Items {
+		// Do not delete objects that have a static config
+		if _, hasStaticConfig := staticResources[res.Name]; hasStaticConfig {
+			continue
 		}
-
-		if err := s.persistResources(resToAdd, resToDelete, true); err != nil {
-			return err
+		if res.Spec.Type == rType {
+			existingDRs = append(existingDRs, res)
 		}
+	}
 
-		if len(dRLCToDelete) > 0 {
-			if err := s.deleteDynamicResourceLifecycles(dRLCToDelete, staticResources); err != nil {
-				return err
-			}
-		}
+	resToAdd, resToDelete := s.updateDynamicResources(dRLC, existingDRs)
+	if err := s.persistResources(resToAdd, resToDelete, true); err != nil {
+		return err
+	}
 
-		return nil
-	})
+	if dRLC.Spec.MinCount == 0 && dRLC.Spec.MaxCount == 0 {
+		currentCount := len(existingDRs)
+		if len(resToAdd) == 0 && (currentCount == 0 || currentCount == len(resToDelete)) {
+			return s.deleteDynamicResourceLifecycles([]crds.DRLCObject{*dRLC}, staticResources)
+		}
+	}
+	return nil
 }
 
 // syncDynamicResourceLifeCycles compares the new DRLC configuration against
@@ -436,10 +618,11 @@ func (s *Storage) syncDynamicResourceLifeCycles(newDRLCByType, existingDRLCByTyp
 			if !reflect.DeepEqual(existingDRLC, newDRLC) {
 				dRLCToUpdate = append(dRLCToUpdate, newDRLC)
 			}
-		} else if existingDRLC.Spec.MinCount != 0 || existingDRLC.Spec.MaxCount != 0 {
+		} else if existingDRLC.Spec.MinCount != 0 || existingDRLC.Spec.MaxCount != 0 || len(existingDRLC.Spec.Flavors) > 0 {
 			// Mark for deletion of all associated dynamic resources.
 			existingDRLC.Spec.MinCount = 0
 			existingDRLC.Spec.MaxCount = 0
+			existingDRLC.Spec.Flavors = nil
 			dRLCToUpdate = append(dRLCToUpdate, existingDRLC)
 		}
 	}
@@ -457,6 +640,8 @@ func (s *Storage) syncDynamicResourceLifeCycles(newDRLCByType, existingDRLCByTyp
 
 func (s *Storage) persistResources(resToAdd, resToDelete []crds.ResourceObject, dynamic bool) error {
 	var errs []error
+	added, tombstoned := 0, 0
+	defer func() { s.configSyncs.observe(added, tombstoned) }()
 	for _, r := range resToDelete {
 		// If currently busy, yield deletion to later cycles.
 		if r.Status.Owner != "" {
@@ -477,6 +662,8 @@ func (s *Storage) persistResources(resToAdd, resToDelete []crds.ResourceObject,
 				l.Info("Marking resource to be deleted")
 				if _, err := s.UpdateResource(&r); err != nil {
 					errs = append(errs, err)
+				} else {
+					tombstoned++
 				}
 			}
 		} else {
@@ -484,6 +671,8 @@ func (s *Storage) persistResources(resToAdd, resToDelete []crds.ResourceObject,
 			l.Info("Deleting resource")
 			if err := s.DeleteResource(r.Name); err != nil {
 				errs = append(errs, err)
+			} else {
+				tombstoned++
 			}
 		}
 	}
@@ -493,6 +682,8 @@ func (s *Storage) persistResources(resToAdd, resToDelete []crds.ResourceObject,
 		r.Status.LastUpdate = s.now()
 		if err := s.AddResource(&r); err != nil {
 			errs = append(errs, err)
+		} else {
+			added++
 		}
 	}
 
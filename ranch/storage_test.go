@@ -0,0 +1,226 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	fakectrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/crds"
+)
+
+// unavailableClient fails every List request, like a client of an apiserver
+// which is down.
+type unavailableClient struct {
+	ctrlruntimeclient.Client
+}
+
+func (uc *unavailableClient) List(_ context.Context, _ ctrlruntimeclient.ObjectList, _ ...ctrlruntimeclient.ListOption) error {
+	return errors.New("apiserver unavailable")
+}
+
+func TestGetResourcesForRead(t *testing.T) {
+	newReplica := func(names ...string) ctrlruntimeclient.Reader {
+		var objects []runtime.Object
+		for _, name := range names {
+			res := newResource(name, "t", common.Free, "", startTime)
+			res.SetNamespace(testNS)
+			objects = append(objects, res)
+		}
+		return fakectrlruntimeclient.NewFakeClient(objects...)
+	}
+	testCases := []struct {
+		name          string
+		primaryDown   bool
+		replicas      []ctrlruntimeclient.Reader
+		expectErr     bool
+		expectedNames []string
+	}{
+		{
+			name:          "primary available",
+			replicas:      []ctrlruntimeclient.Reader{newReplica("replicated")},
+			expectedNames: []string{"primary"},
+		},
+		{
+			name:        "primary down without replicas",
+			primaryDown: true,
+			expectErr:   true,
+		},
+		{
+			name:          "primary down with replicas",
+			primaryDown:   true,
+			replicas:      []ctrlruntimeclient.Reader{&unavailableClient{}, newReplica("replicated")},
+			expectedNames: []string{"replicated"},
+		},
+		{
+			name:        "primary and replicas down",
+			primaryDown: true,
+			replicas:    []ctrlruntimeclient.Reader{&unavailableClient{}},
+			expectErr:   true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res := newResource("primary", "t", common.Free, "", startTime)
+			res.SetNamespace(testNS)
+			var client ctrlruntimeclient.Client = fakectrlruntimeclient.NewFakeClient(res)
+			if tc.primaryDown {
+				client = &unavailableClient{Client: client}
+			}
+			s := NewTestingStorage(client, testNS, func() metav1.Time { return fakeNow })
+			s.SetReadReplicas(tc.replicas...)
+
+			resources, err := s.GetResourcesForRead()
+			if tc.expectErr != (err != nil) {
+				t.Fatalf("expected error %t, got %v", tc.expectErr, err)
+			}
+			if err != nil {
+				return
+			}
+			var names []string
+			for _, res := range resources.Items {
+				names = append(names, res.Name)
+			}
+			if !reflect.DeepEqual(tc.expectedNames, names) {
+				t.Errorf("expected resources %v, got %v", tc.expectedNames, names)
+			}
+		})
+	}
+}
+
+// failingCreateClient fails the first failures requests creating resources of
+// rType with err, or all of them if failures is negative.
+type failingCreateClient struct {
+	ctrlruntimeclient.Client
+	rType    string
+	err      error
+	failures int
+}
+
+func (fc *failingCreateClient) Create(ctx context.Context, obj ctrlruntimeclient.Object, opts ...ctrlruntimeclient.CreateOption) error {
+	if res, ok := obj.(*crds.ResourceObject); ok && res.Spec.Type == fc.rType && fc.failures != 0 {
+		fc.failures--
+		return fc.err
+	}
+	return fc.Client.Create(ctx, obj, opts...)
+}
+
+func TestUpdateAllDynamicResourcesErrors(t *testing.T) {
+	gr := schema.GroupResource{Resource: "resources"}
+	testCases := []struct {
+		name        string
+		err         error
+		failures    int
+		expectClass string
+		expectCount int
+	}{
+		{
+			name:        "quota errors are not retried",
+			err:         kerrors.NewForbidden(gr, "dt_1", errors.New("exceeded quota: boskos, requested: count/resources=1")),
+			failures:    -1,
+			expectClass: DynamicErrorQuota,
+			expectCount: 1,
+		},
+		{
+			name:        "transient errors are retried",
+			err:         kerrors.NewServiceUnavailable("apiserver is shutting down"),
+			failures:    1,
+			expectCount: 1,
+		},
+		{
+			name:        "persistent transient errors",
+			err:         kerrors.NewTooManyRequests("slow down", 1),
+			failures:    -1,
+			expectClass: DynamicErrorTransient,
+			expectCount: 4,
+		},
+		{
+			name:        "other errors are not retried",
+			err:         errors.New("invalid resource"),
+			failures:    -1,
+			expectClass: DynamicErrorOther,
+			expectCount: 1,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var objects []runtime.Object
+			for _, rType := range []string{"broken", "working"} {
+				dRLC := &crds.DRLCObject{
+					ObjectMeta: metav1.ObjectMeta{Name: rType, Namespace: testNS},
+					Spec:       crds.DRLCSpec{MinCount: 1, MaxCount: 1},
+				}
+				objects = append(objects, dRLC)
+			}
+			client := &failingCreateClient{
+				Client:   fakectrlruntimeclient.NewFakeClient(objects...),
+				rType:    "broken",
+				err:      tc.err,
+				failures: tc.failures,
+			}
+			s := NewTestingStorage(client, testNS, func() metav1.Time { return fakeNow })
+			nameGen := &nameGenerator{}
+			s.generateName = nameGen.name
+
+			err := s.UpdateAllDynamicResources(nil)
+			var updateErr *DynamicResourceUpdateError
+			if aggregate, ok := err.(utilerrors.Aggregate); ok && len(aggregate.Errors()) == 1 {
+				updateErr, _ = aggregate.Errors()[0].(*DynamicResourceUpdateError)
+			}
+			if (updateErr != nil) != (tc.expectClass != "") {
+				t.Fatalf("expected an error of class %q, got %v", tc.expectClass, err)
+			}
+			if updateErr != nil && updateErr.Class() != tc.expectClass {
+				t.Errorf("expected an error of class %q, got %q", tc.expectClass, updateErr.Class())
+			}
+
+			resources, err := s.GetResources()
+			if err != nil {
+				t.Fatalf("failed to get resources: %v", err)
+			}
+			expectTypes := []string{"working"}
+			if tc.expectClass == "" {
+				expectTypes = []string{"broken", "working"}
+			}
+			var types []string
+			for _, res := range resources.Items {
+				types = append(types, res.Spec.Type)
+			}
+			sort.Strings(types)
+			if !reflect.DeepEqual(expectTypes, types) {
+				t.Errorf("expected resources of types %v, got %v", expectTypes, types)
+			}
+
+			counts := s.dynamicErrors.get()
+			if len(counts) != 1 || counts[0].Type != "broken" || counts[0].Count != tc.expectCount {
+				t.Errorf("expected %d errors for the broken type, got %+v", tc.expectCount, counts)
+			}
+		})
+	}
+}
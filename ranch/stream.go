@@ -0,0 +1,141 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+	toolscache "k8s.io/client-go/tools/cache"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	"sigs.k8s.io/boskos/crds"
+)
+
+// listPageSize bounds how many resources are listed from the apiserver at
+// once while streaming them.
+const listPageSize = 500
+
+// ResourceStreamer is implemented by the Backends which can hand out the
+// resources one at a time instead of listing them all at once, which keeps
+// the memory of listings of large pools bounded.
+type ResourceStreamer interface {
+	// StreamResources calls fn with every resource until fn fails, in no
+	// particular order.
+	StreamResources(ctx context.Context, fn func(*crds.ResourceObject) error) error
+}
+
+// ResourceInformer is the informer of the resources of a Storage, e.g. the
+// one of the cache of a controller-runtime manager, whose store the listings
+// iterate over instead of copying the resources out of it.
+type ResourceInformer interface {
+	HasSynced() bool
+	GetStore() toolscache.Store
+}
+
+// SetResourceInformer makes the read-only listings of the storage, like
+// metrics, iterate over the store of informer once it has synced. It is only
+// supported by the Storage of NewStorage.
+func (s *Storage) SetResourceInformer(informer ResourceInformer) {
+	s.informer = informer
+}
+
+// ForEachResource calls fn with every resource until fn fails, without
+// listing them all at once. The resources may be shared with a cache, so fn
+// must neither modify nor retain them.
+func (s *Storage) ForEachResource(fn func(*crds.ResourceObject) error) error {
+	if s.informer != nil && s.informer.HasSynced() {
+		for _, obj := range s.informer.GetStore().List() {
+			res, ok := obj.(*crds.ResourceObject)
+			if !ok || (s.namespace != "" && res.Namespace != s.namespace) {
+				continue
+			}
+			if err := fn(res); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return streamResources(s.ctx, s.backend, fn)
+}
+
+// ForEachResourceForRead is like ForEachResource, but falls back to the read
+// replicas when the backend fails before handing out any resource.
+func (s *Storage) ForEachResourceForRead(fn func(*crds.ResourceObject) error) error {
+	streamed := false
+	err := s.ForEachResource(func(res *crds.ResourceObject) error {
+		streamed = true
+		return fn(res)
+	})
+	if err == nil || streamed || len(s.replicas) == 0 {
+		return err
+	}
+	resources, err := s.GetResourcesForRead()
+	if err != nil {
+		return err
+	}
+	for idx := range resources.Items {
+		if err := fn(&resources.Items[idx]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// streamResources streams the resources of backend, listing them at once if
+// it is no ResourceStreamer.
+func streamResources(ctx context.Context, backend Backend, fn func(*crds.ResourceObject) error) error {
+	if streamer, ok := backend.(ResourceStreamer); ok {
+		return streamer.StreamResources(ctx, fn)
+	}
+	resources, err := backend.ListResources(ctx)
+	if err != nil {
+		return err
+	}
+	for idx := range resources.Items {
+		if err := fn(&resources.Items[idx]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StreamResources lists the resources by pages of listPageSize. Cached
+// clients ignore the limit and list them at once.
+func (b *crdBackend) StreamResources(ctx context.Context, fn func(*crds.ResourceObject) error) error {
+	opts := []ctrlruntimeclient.ListOption{ctrlruntimeclient.InNamespace(b.namespace), ctrlruntimeclient.Limit(listPageSize)}
+	for {
+		page := &crds.ResourceObjectList{}
+		if err := b.client.List(ctx, page, opts...); err != nil {
+			return err
+		}
+		for idx := range page.Items {
+			if err := fn(&page.Items[idx]); err != nil {
+				return err
+			}
+		}
+		if page.Continue == "" {
+			return nil
+		}
+		logrus.WithField("continue", page.Continue).Debug("Listing the next page of resources.")
+		opts = []ctrlruntimeclient.ListOption{ctrlruntimeclient.InNamespace(b.namespace), ctrlruntimeclient.Limit(listPageSize), ctrlruntimeclient.Continue(page.Continue)}
+	}
+}
+
+func (b *abandonCountingBackend) StreamResources(ctx context.Context, fn func(*crds.ResourceObject) error) error {
+	return b.counter.observe(ctx, "list_resources", streamResources(ctx, b.Backend, fn))
+}
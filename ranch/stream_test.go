@@ -0,0 +1,144 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	toolscache "k8s.io/client-go/tools/cache"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/crds"
+)
+
+type fakeInformer struct {
+	synced bool
+	store  toolscache.Store
+}
+
+func (f *fakeInformer) HasSynced() bool            { return f.synced }
+func (f *fakeInformer) GetStore() toolscache.Store { return f.store }
+
+func newFakeInformer(t testing.TB, resources ...*crds.ResourceObject) *fakeInformer {
+	store := toolscache.NewStore(toolscache.MetaNamespaceKeyFunc)
+	for _, res := range resources {
+		if err := store.Add(res); err != nil {
+			t.Fatalf("failed to add to the store: %v", err)
+		}
+	}
+	return &fakeInformer{synced: true, store: store}
+}
+
+func TestForEachResource(t *testing.T) {
+	inStore := newResource("in-store", "t", common.Free, "", startTime)
+	inStore.SetNamespace(testNS)
+	otherNS := newResource("other-namespace", "t", common.Free, "", startTime)
+	otherNS.SetNamespace("other")
+
+	testCases := []struct {
+		name     string
+		informer *fakeInformer
+		expected []string
+	}{
+		{
+			name:     "no informer",
+			expected: []string{"stored"},
+		},
+		{
+			name:     "informer not synced",
+			informer: &fakeInformer{store: toolscache.NewStore(toolscache.MetaNamespaceKeyFunc)},
+			expected: []string{"stored"},
+		},
+		{
+			name:     "informer synced",
+			informer: newFakeInformer(t, inStore, otherNS),
+			expected: []string{"in-store"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := makeTestRanch([]runtime.Object{newResource("stored", "t", common.Free, "", startTime)})
+			if tc.informer != nil {
+				r.Storage.SetResourceInformer(tc.informer)
+			}
+			var names []string
+			if err := r.Storage.ForEachResource(func(res *crds.ResourceObject) error {
+				names = append(names, res.Name)
+				return nil
+			}); err != nil {
+				t.Fatalf("failed to stream resources: %v", err)
+			}
+			if !reflect.DeepEqual(names, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, names)
+			}
+		})
+	}
+}
+
+func TestForEachResourceStopsOnError(t *testing.T) {
+	r := makeTestRanch([]runtime.Object{
+		newResource("a", "t", common.Free, "", startTime),
+		newResource("b", "t", common.Free, "", startTime),
+	})
+	calls := 0
+	err := r.Storage.ForEachResource(func(*crds.ResourceObject) error {
+		calls++
+		return fmt.Errorf("stop")
+	})
+	if err == nil || calls != 1 {
+		t.Errorf("expected the first error to stop the stream, got %v after %d calls", err, calls)
+	}
+}
+
+// BenchmarkAllMetrics compares the allocations of the metrics of a large pool
+// listed from the client with those streamed from an informer.
+func BenchmarkAllMetrics(b *testing.B) {
+	const count = 10000
+	var objects []runtime.Object
+	var resources []*crds.ResourceObject
+	for i := 0; i < count; i++ {
+		res := newResource(fmt.Sprintf("res-%d", i), fmt.Sprintf("type-%d", i%10), common.Free, "", startTime)
+		res.SetNamespace(testNS)
+		res.Status.UserData = map[string]string{"key": "value"}
+		objects = append(objects, res)
+		resources = append(resources, res.DeepCopy())
+	}
+	for _, bc := range []struct {
+		name     string
+		informer bool
+	}{
+		{name: "list"},
+		{name: "informer", informer: true},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			r := makeTestRanch(objects)
+			if bc.informer {
+				r.Storage.SetResourceInformer(newFakeInformer(b, resources...))
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := r.AllMetrics(); err != nil {
+					b.Fatalf("failed to get metrics: %v", err)
+				}
+			}
+		})
+	}
+}
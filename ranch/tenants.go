@@ -0,0 +1,160 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/client-go/util/retry"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/crds"
+)
+
+// TenantMismatch will be returned if a resource of a type owned by a tenant is
+// requested on behalf of another tenant, or of none.
+type TenantMismatch struct {
+	rType, tenant, request string
+}
+
+func (t TenantMismatch) Error() string {
+	if t.request == "" {
+		return fmt.Sprintf("resource type %s belongs to tenant %s, requests must be made on its behalf", t.rType, t.tenant)
+	}
+	return fmt.Sprintf("resource type %s belongs to tenant %s, not to tenant %s", t.rType, t.tenant, t.request)
+}
+
+// Tenant returns the tenant the requested type belongs to.
+func (t TenantMismatch) Tenant() string {
+	return t.tenant
+}
+
+// tenantTracker holds the tenant owning the pool of each resource type.
+type tenantTracker struct {
+	lock    sync.RWMutex
+	tenants map[string]string
+}
+
+func newTenantTracker() *tenantTracker {
+	return &tenantTracker{tenants: map[string]string{}}
+}
+
+func (t *tenantTracker) set(config *common.BoskosConfig) {
+	tenants := map[string]string{}
+	for _, entry := range config.Resources {
+		if entry.Tenant != "" {
+			tenants[entry.Type] = entry.Tenant
+		}
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.tenants = tenants
+}
+
+func (t *tenantTracker) get(rType string) string {
+	if t == nil {
+		return ""
+	}
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return t.tenants[rType]
+}
+
+// stampTenant records on res, a resource about to be created, the tenant of
+// its type.
+func (s *Storage) stampTenant(res *crds.ResourceObject) {
+	res.Spec.Tenant = s.tenants.get(res.Spec.Type)
+}
+
+// ForTenant returns a view of the ranch acquiring resources on behalf of
+// tenant, which may only acquire the resources of the types of the tenant and
+// of the types shared by all tenants. The view shares everything else with r.
+func (r *Ranch) ForTenant(tenant string) *Ranch {
+	view := *r
+	view.tenant = tenant
+	return &view
+}
+
+// Tenant returns the tenant owning the pool of rType, or "" if the pool is
+// shared by all tenants.
+func (r *Ranch) Tenant(rType string) string {
+	return r.Storage.tenants.get(rType)
+}
+
+// admitTenant checks that the resources of rType may be acquired on behalf of
+// the tenant of r.
+func (r *Ranch) admitTenant(rType string) error {
+	if tenant := r.Tenant(rType); tenant != "" && tenant != r.tenant {
+		return &TenantMismatch{rType: rType, tenant: tenant, request: r.tenant}
+	}
+	return nil
+}
+
+// syncTenants records the tenant of their type on the existing resources, so
+// moving a pool to another tenant in the config moves its resources along.
+func (r *Ranch) syncTenants() error {
+	resources, err := r.Storage.GetResources()
+	if err != nil {
+		return err
+	}
+	for idx := range resources.Items {
+		res := resources.Items[idx]
+		if res.Spec.Tenant == r.Tenant(res.Spec.Type) {
+			continue
+		}
+		if err := retryOnConflict(retry.DefaultBackoff, func() error {
+			current, err := r.Storage.GetResource(res.Name)
+			if err != nil {
+				return err
+			}
+			current.Spec.Tenant = r.Tenant(current.Spec.Type)
+			return r.Storage.updateResourceKeepingLastUpdate(current)
+		}); err != nil {
+			return fmt.Errorf("failed to set the tenant of resource %s: %w", res.Name, err)
+		}
+		logrus.Infof("Resource %s moved to tenant %q", res.Name, r.Tenant(res.Spec.Type))
+	}
+	return nil
+}
+
+// TenantMetrics returns the number of resources of each tenant by state,
+// sorted by tenant. The resources shared by all tenants are not counted.
+func (r *Ranch) TenantMetrics() ([]common.TenantMetric, error) {
+	byTenant := map[string]map[string]int{}
+	if err := r.Storage.ForEachResourceForRead(func(res *crds.ResourceObject) error {
+		if res.Spec.Tenant == "" {
+			return nil
+		}
+		if byTenant[res.Spec.Tenant] == nil {
+			byTenant[res.Spec.Tenant] = map[string]int{}
+		}
+		byTenant[res.Spec.Tenant][res.Status.State]++
+		return nil
+	}); err != nil {
+		logrus.WithError(err).Error("cannot find resources")
+		return nil, err
+	}
+	var metrics []common.TenantMetric
+	for tenant, current := range byTenant {
+		metrics = append(metrics, common.TenantMetric{Tenant: tenant, Current: current})
+	}
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].Tenant < metrics[j].Tenant })
+	return metrics, nil
+}
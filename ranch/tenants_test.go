@@ -0,0 +1,131 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+func TestAcquireForTenant(t *testing.T) {
+	testCases := []struct {
+		name      string
+		rType     string
+		tenant    string
+		expectErr error
+	}{
+		{
+			name:   "type of the tenant",
+			rType:  "team-a-project",
+			tenant: "team-a",
+		},
+		{
+			name:   "shared type",
+			rType:  "shared-project",
+			tenant: "team-a",
+		},
+		{
+			name:  "shared type without tenant",
+			rType: "shared-project",
+		},
+		{
+			name:      "type of another tenant",
+			rType:     "team-a-project",
+			tenant:    "team-b",
+			expectErr: &TenantMismatch{rType: "team-a-project", tenant: "team-a", request: "team-b"},
+		},
+		{
+			name:      "type of a tenant without tenant",
+			rType:     "team-a-project",
+			expectErr: &TenantMismatch{rType: "team-a-project", tenant: "team-a"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := makeTestRanch([]runtime.Object{
+				newResource("team-a", "team-a-project", common.Free, "", startTime),
+				newResource("shared", "shared-project", common.Free, "", startTime),
+			})
+			r.Storage.tenants.set(&common.BoskosConfig{Resources: []common.ResourceEntry{
+				{Type: "team-a-project", Tenant: "team-a"},
+				{Type: "shared-project"},
+			}})
+
+			res, _, err := r.ForTenant(tc.tenant).Acquire(tc.rType, common.Free, common.Busy, "owner", "")
+			if !AreErrorsEqual(err, tc.expectErr) {
+				t.Fatalf("expected error %v, got %v", tc.expectErr, err)
+			}
+			if err == nil && res.Spec.Type != tc.rType {
+				t.Errorf("expected a %s, got %+v", tc.rType, res)
+			}
+			if _, err := r.ForTenant(tc.tenant).AcquireByState(common.Free, common.Busy, "owner", []string{"team-a"}); tc.expectErr != nil && !AreErrorsEqual(err, tc.expectErr) {
+				t.Errorf("expected error %v acquiring by state, got %v", tc.expectErr, err)
+			}
+			if _, err := r.ForTenant(tc.tenant).Reset(tc.rType, common.Busy, time.Hour, common.Dirty); !AreErrorsEqual(err, tc.expectErr) {
+				t.Errorf("expected error %v resetting, got %v", tc.expectErr, err)
+			}
+			if _, err := r.ForTenant(tc.tenant).Reserve(tc.rType, "owner", startTime.Add(time.Hour), startTime.Add(2*time.Hour)); tc.expectErr != nil && !AreErrorsEqual(err, tc.expectErr) {
+				t.Errorf("expected error %v reserving, got %v", tc.expectErr, err)
+			}
+			if _, err := r.ForTenant(tc.tenant).Book(tc.rType, "owner", 1, startTime.Time); tc.expectErr != nil && !AreErrorsEqual(err, tc.expectErr) {
+				t.Errorf("expected error %v booking, got %v", tc.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestSyncConfigTenants(t *testing.T) {
+	r := makeTestRanch(nil)
+	config := &common.BoskosConfig{Resources: []common.ResourceEntry{
+		{Type: "team-a-project", State: common.Free, Names: []string{"a-1", "a-2"}, Tenant: "team-a"},
+		{Type: "shared-project", State: common.Free, Names: []string{"shared"}},
+	}}
+	if err := r.ApplyConfig(config); err != nil {
+		t.Fatalf("failed to apply config: %v", err)
+	}
+	if _, _, err := r.ForTenant("team-a").Acquire("team-a-project", common.Free, common.Busy, "owner", ""); err != nil {
+		t.Fatalf("failed to acquire: %v", err)
+	}
+	expected := []common.TenantMetric{{Tenant: "team-a", Current: map[string]int{common.Busy: 1, common.Free: 1}}}
+	metrics, err := r.TenantMetrics()
+	if err != nil {
+		t.Fatalf("failed to get tenant metrics: %v", err)
+	}
+	if !reflect.DeepEqual(metrics, expected) {
+		t.Errorf("expected tenant metrics %v, got %v", expected, metrics)
+	}
+
+	// Moving the pool to another tenant moves its resources along.
+	config.Resources[0].Tenant = "team-b"
+	if err := r.ApplyConfig(config); err != nil {
+		t.Fatalf("failed to apply config: %v", err)
+	}
+	for _, name := range []string{"a-1", "a-2"} {
+		res, err := r.Storage.GetResource(name)
+		if err != nil {
+			t.Fatalf("failed to get resource: %v", err)
+		}
+		if res.Spec.Tenant != "team-b" || res.ToResource().Tenant != "team-b" {
+			t.Errorf("expected %s to belong to team-b, got %q", name, res.Spec.Tenant)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"sigs.k8s.io/boskos/crds"
+	"sigs.k8s.io/boskos/tracing"
+)
+
+// tracedAttempts wraps fn, an attempt retried on conflicts, so that every
+// retry is recorded as an event of span.
+func tracedAttempts(span trace.Span, fn func() error) func() error {
+	attempt := 0
+	return func() error {
+		attempt++
+		if attempt > 1 {
+			span.AddEvent("retry on conflict", trace.WithAttributes(attribute.Int("attempt", attempt)))
+		}
+		return fn()
+	}
+}
+
+// tracingBackend records a span for every call to Backend, as a child of the
+// span of the context of the call.
+type tracingBackend struct {
+	Backend
+}
+
+func (b *tracingBackend) CreateResource(ctx context.Context, resource *crds.ResourceObject) (err error) {
+	ctx, span := tracing.Start(ctx, "storage.create_resource", attribute.String("name", resource.Name))
+	defer func() { tracing.End(span, err) }()
+	return b.Backend.CreateResource(ctx, resource)
+}
+
+func (b *tracingBackend) GetResource(ctx context.Context, name string) (_ *crds.ResourceObject, err error) {
+	ctx, span := tracing.Start(ctx, "storage.get_resource", attribute.String("name", name))
+	defer func() { tracing.End(span, err) }()
+	return b.Backend.GetResource(ctx, name)
+}
+
+func (b *tracingBackend) ListResources(ctx context.Context) (_ *crds.ResourceObjectList, err error) {
+	ctx, span := tracing.Start(ctx, "storage.list_resources")
+	defer func() { tracing.End(span, err) }()
+	return b.Backend.ListResources(ctx)
+}
+
+func (b *tracingBackend) UpdateResource(ctx context.Context, resource *crds.ResourceObject) (err error) {
+	ctx, span := tracing.Start(ctx, "storage.update_resource", attribute.String("name", resource.Name))
+	defer func() { tracing.End(span, err) }()
+	return b.Backend.UpdateResource(ctx, resource)
+}
+
+func (b *tracingBackend) DeleteResource(ctx context.Context, name string) (err error) {
+	ctx, span := tracing.Start(ctx, "storage.delete_resource", attribute.String("name", name))
+	defer func() { tracing.End(span, err) }()
+	return b.Backend.DeleteResource(ctx, name)
+}
+
+func (b *tracingBackend) CreateDynamicResourceLifeCycle(ctx context.Context, drlc *crds.DRLCObject) (err error) {
+	ctx, span := tracing.Start(ctx, "storage.create_dynamic_resource_lifecycle", attribute.String("name", drlc.Name))
+	defer func() { tracing.End(span, err) }()
+	return b.Backend.CreateDynamicResourceLifeCycle(ctx, drlc)
+}
+
+func (b *tracingBackend) GetDynamicResourceLifeCycle(ctx context.Context, name string) (_ *crds.DRLCObject, err error) {
+	ctx, span := tracing.Start(ctx, "storage.get_dynamic_resource_lifecycle", attribute.String("name", name))
+	defer func() { tracing.End(span, err) }()
+	return b.Backend.GetDynamicResourceLifeCycle(ctx, name)
+}
+
+func (b *tracingBackend) ListDynamicResourceLifeCycles(ctx context.Context) (_ *crds.DRLCObjectList, err error) {
+	ctx, span := tracing.Start(ctx, "storage.list_dynamic_resource_lifecycles")
+	defer func() { tracing.End(span, err) }()
+	return b.Backend.ListDynamicResourceLifeCycles(ctx)
+}
+
+func (b *tracingBackend) UpdateDynamicResourceLifeCycle(ctx context.Context, drlc *crds.DRLCObject) (err error) {
+	ctx, span := tracing.Start(ctx, "storage.update_dynamic_resource_lifecycle", attribute.String("name", drlc.Name))
+	defer func() { tracing.End(span, err) }()
+	return b.Backend.UpdateDynamicResourceLifeCycle(ctx, drlc)
+}
+
+func (b *tracingBackend) DeleteDynamicResourceLifeCycle(ctx context.Context, name string) (err error) {
+	ctx, span := tracing.Start(ctx, "storage.delete_dynamic_resource_lifecycle", attribute.String("name", name))
+	defer func() { tracing.End(span, err) }()
+	return b.Backend.DeleteDynamicResourceLifeCycle(ctx, name)
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/crds"
+)
+
+// TransitionDenied will be returned if the transition webhook of a resource
+// type denied a state change.
+type TransitionDenied struct {
+	name, from, to, reason string
+}
+
+func (t TransitionDenied) Error() string {
+	msg := fmt.Sprintf("transition of resource %s from %s to %s denied", t.name, t.from, t.to)
+	if t.reason != "" {
+		msg += ": " + t.reason
+	}
+	return msg
+}
+
+// transitionManager holds the transition webhook of each resource type.
+type transitionManager struct {
+	lock     sync.RWMutex
+	webhooks map[string]common.TransitionWebhook
+	client   *http.Client
+}
+
+func newTransitionManager() *transitionManager {
+	return &transitionManager{
+		webhooks: map[string]common.TransitionWebhook{},
+		client:   &http.Client{},
+	}
+}
+
+func (m *transitionManager) set(config *common.BoskosConfig) {
+	webhooks := map[string]common.TransitionWebhook{}
+	for _, entry := range config.Resources {
+		if entry.TransitionWebhook != nil {
+			webhooks[entry.Type] = *entry.TransitionWebhook
+		}
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.webhooks = webhooks
+}
+
+func (m *transitionManager) get(rType string) (common.TransitionWebhook, bool) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	webhook, ok := m.webhooks[rType]
+	return webhook, ok
+}
+
+func (m *transitionManager) review(webhook common.TransitionWebhook, review common.TransitionReview) (*common.TransitionReviewResponse, error) {
+	b, err := json.Marshal(review)
+	if err != nil {
+		return nil, err
+	}
+	timeout := common.DefaultTransitionWebhookTimeout
+	if webhook.Timeout != nil && webhook.Timeout.Duration != nil {
+		timeout = *webhook.Timeout.Duration
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("transition webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transition webhook response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("transition webhook returned status %d: %s", resp.StatusCode, string(body))
+	}
+	result := &common.TransitionReviewResponse{}
+	if err := json.Unmarshal(body, result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal transition webhook response: %w", err)
+	}
+	return result, nil
+}
+
+// admitTransition rejects the transitions not allowed by the config for the
+// type of res, then asks its transition webhook, if any, whether res may move
+// from its current state to state to, on behalf of owner.
+// The user data returned by the webhook is merged into res when admitted. It
+// must be called before res is changed.
+func (r *Ranch) admitTransition(res *crds.ResourceObject, to, owner string) error {
+	if err := r.checkTransition(res, to); err != nil {
+		return err
+	}
+	webhook, ok := r.transitions.get(res.Spec.Type)
+	if !ok || !webhook.Reviews(to) {
+		return nil
+	}
+	from := res.Status.State
+	resp, err := r.transitions.review(webhook, common.TransitionReview{Resource: res.ToResource(), From: from, To: to, Owner: owner})
+	if err != nil {
+		if webhook.FailOpen {
+			logrus.WithError(err).Warningf("Transition webhook failed, admitting transition of %s from %s to %s", res.Name, from, to)
+			return nil
+		}
+		return err
+	}
+	if !resp.Allowed {
+		return &TransitionDenied{name: res.Name, from: from, to: to, reason: resp.Reason}
+	}
+	for key, value := range resp.UserData {
+		if value == "" {
+			delete(res.Status.UserData, key)
+			continue
+		}
+		if res.Status.UserData == nil {
+			res.Status.UserData = map[string]string{}
+		}
+		res.Status.UserData[key] = value
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+func TestReleaseWithTransitionWebhook(t *testing.T) {
+	testCases := []struct {
+		name           string
+		handler        http.HandlerFunc
+		failOpen       bool
+		dest           string
+		expectErr      error
+		expectAnyErr   bool
+		expectState    string
+		expectUserData map[string]string
+	}{
+		{
+			name: "admitted with user data",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(common.TransitionReviewResponse{Allowed: true, UserData: map[string]string{"verified": "true", "scratch": ""}})
+			},
+			dest:           common.Free,
+			expectState:    common.Free,
+			expectUserData: map[string]string{"verified": "true"},
+		},
+		{
+			name: "denied",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(common.TransitionReviewResponse{Reason: "verification job failed"})
+			},
+			dest:           common.Free,
+			expectErr:      &TransitionDenied{name: "res", from: common.Busy, to: common.Free, reason: "verification job failed"},
+			expectState:    common.Busy,
+			expectUserData: map[string]string{"scratch": "data"},
+		},
+		{
+			name: "failing webhook",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "broken", http.StatusInternalServerError)
+			},
+			dest:           common.Free,
+			expectAnyErr:   true,
+			expectState:    common.Busy,
+			expectUserData: map[string]string{"scratch": "data"},
+		},
+		{
+			name: "failing webhook with fail open",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "broken", http.StatusInternalServerError)
+			},
+			failOpen:       true,
+			dest:           common.Free,
+			expectState:    common.Free,
+			expectUserData: map[string]string{"scratch": "data"},
+		},
+		{
+			name: "transition not reviewed",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				t.Error("unexpected call to the webhook")
+			},
+			dest:           common.Dirty,
+			expectState:    common.Dirty,
+			expectUserData: map[string]string{"scratch": "data"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(tc.handler)
+			defer server.Close()
+
+			res := newResource("res", "t", common.Busy, "owner", startTime)
+			res.Status.UserData = map[string]string{"scratch": "data"}
+			r := makeTestRanch([]runtime.Object{res})
+			r.transitions.set(&common.BoskosConfig{Resources: []common.ResourceEntry{
+				{Type: "t", TransitionWebhook: &common.TransitionWebhook{URL: server.URL, States: []string{common.Free}, FailOpen: tc.failOpen}},
+			}})
+
+			err := r.Release("res", tc.dest, "owner")
+			if tc.expectAnyErr {
+				if err == nil {
+					t.Error("expected an error")
+				}
+			} else if !AreErrorsEqual(err, tc.expectErr) {
+				t.Errorf("expected error %v, got %v", tc.expectErr, err)
+			}
+			released, err := r.Storage.GetResource("res")
+			if err != nil {
+				t.Fatalf("failed to get resource: %v", err)
+			}
+			if released.Status.State != tc.expectState {
+				t.Errorf("expected state %s, got %s", tc.expectState, released.Status.State)
+			}
+			if len(released.Status.UserData) != len(tc.expectUserData) {
+				t.Errorf("expected user data %v, got %v", tc.expectUserData, released.Status.UserData)
+			}
+			for key, value := range tc.expectUserData {
+				if released.Status.UserData[key] != value {
+					t.Errorf("expected user data %v, got %v", tc.expectUserData, released.Status.UserData)
+				}
+			}
+		})
+	}
+}
+
+func TestAcquireWithTransitionWebhook(t *testing.T) {
+	var review common.TransitionReview
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&review); err != nil {
+			t.Errorf("failed to decode review: %v", err)
+		}
+		json.NewEncoder(w).Encode(common.TransitionReviewResponse{Reason: "frozen"})
+	}))
+	defer server.Close()
+
+	r := makeTestRanch([]runtime.Object{newResource("res", "t", common.Free, "", startTime)})
+	r.transitions.set(&common.BoskosConfig{Resources: []common.ResourceEntry{
+		{Type: "t", TransitionWebhook: &common.TransitionWebhook{URL: server.URL}},
+	}})
+
+	_, _, err := r.Acquire("t", common.Free, common.Busy, "owner", "")
+	expectErr := &TransitionDenied{name: "res", from: common.Free, to: common.Busy, reason: "frozen"}
+	if !AreErrorsEqual(err, expectErr) {
+		t.Fatalf("expected error %v, got %v", expectErr, err)
+	}
+	if review.Resource.Name != "res" || review.From != common.Free || review.To != common.Busy || review.Owner != "owner" {
+		t.Errorf("unexpected review %+v", review)
+	}
+	res, err := r.Storage.GetResource("res")
+	if err != nil {
+		t.Fatalf("failed to get resource: %v", err)
+	}
+	if res.Status.Owner != "" || res.Status.State != common.Free {
+		t.Errorf("expected the resource not to be acquired, got %+v", res.Status)
+	}
+}
+
+func TestConfiguredTransitions(t *testing.T) {
+	r := makeTestRanch([]runtime.Object{
+		newResource("dirty-res", "t", common.Dirty, "", startTime),
+		newResource("cleaning-res", "t", common.Cleaning, "janitor", startTime),
+	})
+	r.states.set(&common.BoskosConfig{Resources: []common.ResourceEntry{{
+		Type: "t",
+		Transitions: map[string][]string{
+			common.Dirty:    {common.Cleaning},
+			common.Cleaning: {common.Free, common.Dirty},
+		},
+	}}})
+
+	if _, _, err := r.Acquire("t", common.Dirty, common.Busy, "owner", ""); !AreErrorsEqual(err, &TransitionNotAllowed{name: "dirty-res", from: common.Dirty, to: common.Busy, allowed: []string{common.Cleaning}}) {
+		t.Errorf("expected the acquire of a dirty resource as busy to be rejected, got %v", err)
+	}
+	if err := r.Release("cleaning-res", common.Busy, "janitor"); !AreErrorsEqual(err, &TransitionNotAllowed{name: "cleaning-res", from: common.Cleaning, to: common.Busy, allowed: []string{common.Dirty, common.Free}}) {
+		t.Errorf("expected the release of a cleaning resource as busy to be rejected, got %v", err)
+	}
+	if err := r.Release("cleaning-res", common.Free, "janitor"); err != nil {
+		t.Errorf("expected the release of a cleaned resource as free to be allowed, got %v", err)
+	}
+	if _, _, err := r.Acquire("t", common.Dirty, common.Cleaning, "janitor", ""); err != nil {
+		t.Errorf("expected the acquire of a dirty resource for cleaning to be allowed, got %v", err)
+	}
+	// Changes from states without transitions are not allowed at all.
+	if _, _, err := r.Acquire("t", common.Free, common.Busy, "owner", ""); !AreErrorsEqual(err, &TransitionNotAllowed{name: "cleaning-res", from: common.Free, to: common.Busy, allowed: []string{}}) {
+		t.Errorf("expected the acquire of a free resource to be rejected, got %v", err)
+	}
+}
+
+func TestConfiguredTransitionsOfEphemeralRelease(t *testing.T) {
+	res := newResource("ephemeral-res", "t", common.Busy, "owner", startTime)
+	res.Labels = map[string]string{common.EphemeralLabel: "true"}
+	r := makeTestRanch([]runtime.Object{res})
+	r.ephemerals.set(&common.BoskosConfig{Resources: []common.ResourceEntry{
+		{Type: "t", Ephemeral: &common.EphemeralProvisioner{URL: "http://provisioner"}},
+	}})
+	r.states.set(&common.BoskosConfig{Resources: []common.ResourceEntry{{
+		Type:        "t",
+		Transitions: map[string][]string{common.Busy: {common.Free}},
+	}}})
+
+	// Released ephemeral resources go to dirty instead, which must be allowed
+	// too.
+	if err := r.Release("ephemeral-res", common.Free, "owner"); !AreErrorsEqual(err, &TransitionNotAllowed{name: "ephemeral-res", from: common.Busy, to: common.Dirty, allowed: []string{common.Free}}) {
+		t.Errorf("expected the release of an ephemeral resource as dirty to be rejected, got %v", err)
+	}
+}
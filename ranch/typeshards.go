@@ -0,0 +1,43 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"sigs.k8s.io/boskos/common"
+)
+
+// SetOwnedTypes restricts the resources synced from the config to the types
+// owns returns true for, when the resource types are split among several
+// boskos instances. It must be called before the config is synced.
+func (r *Ranch) SetOwnedTypes(owns func(rType string) bool) {
+	r.ownsType = owns
+}
+
+// ownedConfig returns the part of config with the resource types owned by the
+// ranch.
+func (r *Ranch) ownedConfig(config *common.BoskosConfig) *common.BoskosConfig {
+	if r.ownsType == nil {
+		return config
+	}
+	owned := &common.BoskosConfig{Requests: config.Requests}
+	for _, entry := range config.Resources {
+		if r.ownsType(entry.Type) {
+			owned.Resources = append(owned.Resources, entry)
+		}
+	}
+	return owned
+}
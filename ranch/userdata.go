@@ -0,0 +1,327 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/crds"
+)
+
+const (
+	// gzipPrefix marks the user data values stored gzipped, in base64.
+	gzipPrefix = "boskos-gzip:"
+	// overflowPrefix marks the user data values stored in the overflow of
+	// the storage, followed by the version of the overflow and the SHA-256 of
+	// the value.
+	overflowPrefix = "boskos-overflow:"
+
+	// DefaultUserDataOverflowAbove is the size above which the values of user
+	// data overflow, unless set otherwise.
+	DefaultUserDataOverflowAbove = 16 * 1024
+)
+
+// UserDataOptions configure how the user data of the resources is stored, so
+// large values like kubeconfigs don't bloat the resources past the size
+// limits of their storage.
+type UserDataOptions struct {
+	// MaxValueSize, if positive, is the largest size in bytes a key of user
+	// data may be updated to.
+	MaxValueSize int
+	// CompressAbove, if positive, is the size in bytes above which values are
+	// stored gzipped.
+	CompressAbove int
+	// Overflow, if set, stores the values larger than OverflowAbove once
+	// compressed, leaving a reference to them in the resources.
+	Overflow      UserDataOverflow
+	OverflowAbove int
+}
+
+// UserDataOverflow stores the user data values too large for the resources.
+// The values of a resource are stored under a version derived from their
+// content, so that the values referenced by the stored resource are never
+// overwritten before the resource is updated to reference the new ones.
+type UserDataOverflow interface {
+	// Store stores the overflowing values of the resource under version. The
+	// values of a version never change, so storing a version again may be a
+	// no-op.
+	Store(ctx context.Context, resource, version string, values map[string]string) error
+	// Load returns the overflowing values of the resource stored under version.
+	Load(ctx context.Context, resource, version string) (map[string]string, error)
+	// Prune deletes the versions of the resource other than keep, or all of
+	// them if keep is empty.
+	Prune(ctx context.Context, resource, keep string) error
+}
+
+// UserDataTooLarge will be returned when updating a key of user data to a
+// value larger than the limit.
+type UserDataTooLarge struct {
+	key       string
+	size, max int
+}
+
+func (u UserDataTooLarge) Error() string {
+	return fmt.Sprintf("user data %s of %d bytes exceeds the limit of %d bytes", u.key, u.size, u.max)
+}
+
+// SetUserDataOptions sets how the user data of the resources is stored. It
+// must be called before the storage is used.
+func (s *Storage) SetUserDataOptions(opts UserDataOptions) {
+	if opts.Overflow != nil && opts.OverflowAbove <= 0 {
+		opts.OverflowAbove = DefaultUserDataOverflowAbove
+	}
+	s.userDataLimit = opts.MaxValueSize
+	if opts.CompressAbove <= 0 && opts.Overflow == nil {
+		return
+	}
+	s.decorated.Backend = &userDataBackend{Backend: s.decorated.Backend, opts: opts}
+}
+
+// checkUserDataSize returns UserDataTooLarge if ud sets a value larger than
+// the limit of the storage.
+func (s *Storage) checkUserDataSize(ud *common.UserData) error {
+	if s.userDataLimit <= 0 {
+		return nil
+	}
+	for key, value := range ud.ToMap() {
+		if len(value) > s.userDataLimit {
+			return &UserDataTooLarge{key: key, size: len(value), max: s.userDataLimit}
+		}
+	}
+	return nil
+}
+
+// userDataBackend encodes the user data of the resources on their way to the
+// Backend, and decodes it on the way back. Streamed resources are handed out
+// encoded, as the listings streaming them never read user data, like those of
+// an informer.
+// The overflowing values are stored before the resource references them, and
+// the versions it no longer references are pruned only once it is stored, so
+// the stored resource always references values which exist. A failed update
+// may leave a version behind, which the next update of the resource prunes.
+type userDataBackend struct {
+	Backend
+	opts UserDataOptions
+}
+
+func (b *userDataBackend) CreateResource(ctx context.Context, resource *crds.ResourceObject) error {
+	encoded, version, err := b.encode(ctx, resource)
+	if err != nil {
+		return err
+	}
+	if err := b.Backend.CreateResource(ctx, encoded); err != nil {
+		return err
+	}
+	resource.TypeMeta, resource.ObjectMeta = encoded.TypeMeta, encoded.ObjectMeta
+	return b.prune(ctx, resource.Name, version)
+}
+
+func (b *userDataBackend) UpdateResource(ctx context.Context, resource *crds.ResourceObject) error {
+	encoded, version, err := b.encode(ctx, resource)
+	if err != nil {
+		return err
+	}
+	if err := b.Backend.UpdateResource(ctx, encoded); err != nil {
+		return err
+	}
+	// The caller keeps the decoded user data, but must see the new version.
+	resource.TypeMeta, resource.ObjectMeta = encoded.TypeMeta, encoded.ObjectMeta
+	return b.prune(ctx, resource.Name, version)
+}
+
+func (b *userDataBackend) GetResource(ctx context.Context, name string) (*crds.ResourceObject, error) {
+	res, err := b.Backend.GetResource(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return res, b.decode(ctx, res)
+}
+
+// ListResources skips the resources whose user data cannot be decoded, e.g.
+// while their overflow is out of sync, so that they don't fail the listings of
+// all the other resources.
+func (b *userDataBackend) ListResources(ctx context.Context) (*crds.ResourceObjectList, error) {
+	list, err := b.Backend.ListResources(ctx)
+	if err != nil {
+		return nil, err
+	}
+	decoded := list.Items[:0]
+	for idx := range list.Items {
+		if err := b.decode(ctx, &list.Items[idx]); err != nil {
+			logrus.WithError(err).Errorf("Skipping resource %s whose user data cannot be decoded", list.Items[idx].Name)
+			continue
+		}
+		decoded = append(decoded, list.Items[idx])
+	}
+	list.Items = decoded
+	return list, nil
+}
+
+func (b *userDataBackend) DeleteResource(ctx context.Context, name string) error {
+	if err := b.Backend.DeleteResource(ctx, name); err != nil {
+		return err
+	}
+	return b.prune(ctx, name, "")
+}
+
+// prune deletes the overflowing values of the resource other than those of
+// version, which it references once stored.
+func (b *userDataBackend) prune(ctx context.Context, name, version string) error {
+	if b.opts.Overflow == nil {
+		return nil
+	}
+	if err := b.opts.Overflow.Prune(ctx, name, version); err != nil {
+		return fmt.Errorf("failed to prune overflowing user data of %s: %w", name, err)
+	}
+	return nil
+}
+
+func (b *userDataBackend) StreamResources(ctx context.Context, fn func(*crds.ResourceObject) error) error {
+	return streamResources(ctx, b.Backend, fn)
+}
+
+// encode returns a copy of resource with its user data compressed and
+// overflowed, after storing the overflowing values under the returned
+// version, which is empty if none overflows.
+func (b *userDataBackend) encode(ctx context.Context, resource *crds.ResourceObject) (*crds.ResourceObject, string, error) {
+	encoded := resource.DeepCopy()
+	overflow := map[string]string{}
+	for key, value := range encoded.Status.UserData {
+		if b.opts.CompressAbove > 0 && len(value) > b.opts.CompressAbove {
+			compressed, err := compressUserData(value)
+			if err != nil {
+				return nil, "", fmt.Errorf("failed to compress user data %s: %w", key, err)
+			}
+			if len(compressed) < len(value) {
+				value = compressed
+			}
+		}
+		if b.opts.Overflow != nil && len(value) > b.opts.OverflowAbove {
+			overflow[key] = value
+		}
+		encoded.Status.UserData[key] = value
+	}
+	if len(overflow) == 0 {
+		return encoded, "", nil
+	}
+	version, err := overflowVersion(overflow)
+	if err != nil {
+		return nil, "", err
+	}
+	for key, value := range overflow {
+		encoded.Status.UserData[key] = overflowReference(version, value)
+	}
+	if err := b.opts.Overflow.Store(ctx, resource.Name, version, overflow); err != nil {
+		return nil, "", fmt.Errorf("failed to store overflowing user data of %s: %w", resource.Name, err)
+	}
+	return encoded, version, nil
+}
+
+// decode restores the user data of res in place.
+func (b *userDataBackend) decode(ctx context.Context, res *crds.ResourceObject) error {
+	loaded := map[string]map[string]string{}
+	for key, value := range res.Status.UserData {
+		if strings.HasPrefix(value, overflowPrefix) {
+			if b.opts.Overflow == nil {
+				return fmt.Errorf("user data %s of %s overflowed, but no overflow is set", key, res.Name)
+			}
+			version := strings.SplitN(strings.TrimPrefix(value, overflowPrefix), ":", 2)[0]
+			overflow, ok := loaded[version]
+			if !ok {
+				var err error
+				if overflow, err = b.opts.Overflow.Load(ctx, res.Name, version); err != nil {
+					return fmt.Errorf("failed to load overflowing user data of %s: %w", res.Name, err)
+				}
+				loaded[version] = overflow
+			}
+			stored, ok := overflow[key]
+			if !ok || overflowReference(version, stored) != value {
+				return fmt.Errorf("overflowing user data %s of %s is out of sync", key, res.Name)
+			}
+			value = stored
+		}
+		if strings.HasPrefix(value, gzipPrefix) {
+			decompressed, err := decompressUserData(value)
+			if err != nil {
+				return fmt.Errorf("failed to decompress user data %s of %s: %w", key, res.Name, err)
+			}
+			value = decompressed
+		}
+		res.Status.UserData[key] = value
+	}
+	return nil
+}
+
+// overflowVersion derives the version the overflowing values are stored under
+// from their content.
+func overflowVersion(values map[string]string) (string, error) {
+	// Maps are marshaled with sorted keys.
+	raw, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+// overflowReference is the reference replacing an overflowing value in the
+// resource, made of the version of the overflow and the SHA-256 of the value.
+func overflowReference(version, value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return overflowPrefix + version + ":" + hex.EncodeToString(sum[:])
+}
+
+func compressUserData(value string) (string, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write([]byte(value)); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return gzipPrefix + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+func decompressUserData(value string) (string, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, gzipPrefix))
+	if err != nil {
+		return "", err
+	}
+	r, err := gzip.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	decompressed, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	return string(decompressed), nil
+}
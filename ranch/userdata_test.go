@@ -0,0 +1,175 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"context"
+	"encoding/base64"
+	"math/rand"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	fakectrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+func TestUserDataSizeLimit(t *testing.T) {
+	r := makeTestRanch([]runtime.Object{newResource("res", "t", common.Busy, "owner", startTime)})
+	r.Storage.SetUserDataOptions(UserDataOptions{MaxValueSize: 4})
+
+	ud := common.UserDataFromMap(common.UserDataMap{"key": "small"})
+	expected := &UserDataTooLarge{key: "key", size: 5, max: 4}
+	if err := r.Update("res", "owner", common.Busy, ud); !AreErrorsEqual(err, expected) {
+		t.Errorf("expected %v, got %v", expected, err)
+	}
+	if err := r.Update("res", "owner", common.Busy, common.UserDataFromMap(common.UserDataMap{"key": "tiny"})); err != nil {
+		t.Errorf("expected values within the limit to be updated, got %v", err)
+	}
+}
+
+func TestUserDataEncoding(t *testing.T) {
+	random := make([]byte, 1000)
+	rand.New(rand.NewSource(1)).Read(random)
+	userData := map[string]string{
+		"small":        "value",
+		"compressible": strings.Repeat("a", 1000),
+		"large":        base64.StdEncoding.EncodeToString(random),
+	}
+
+	r := makeTestRanch([]runtime.Object{newResource("res", "t", common.Busy, "owner", startTime)})
+	overflowClient := fakectrlruntimeclient.NewFakeClient()
+	r.Storage.SetUserDataOptions(UserDataOptions{
+		CompressAbove: 100,
+		OverflowAbove: 200,
+		Overflow:      NewSecretUserDataOverflow(overflowClient, testNS),
+	})
+	raw := r.Storage.decorated.Backend.(*userDataBackend).Backend
+
+	if err := r.Update("res", "owner", common.Busy, common.UserDataFromMap(userData)); err != nil {
+		t.Fatalf("failed to update: %v", err)
+	}
+	stored, err := raw.GetResource(context.Background(), "res")
+	if err != nil {
+		t.Fatalf("failed to get stored resource: %v", err)
+	}
+	for key, prefix := range map[string]string{"small": "value", "compressible": gzipPrefix, "large": overflowPrefix} {
+		if !strings.HasPrefix(stored.Status.UserData[key], prefix) {
+			t.Errorf("expected %s to be stored as %s..., got %q", key, prefix, stored.Status.UserData[key])
+		}
+	}
+	res, err := r.Storage.GetResource("res")
+	if err != nil {
+		t.Fatalf("failed to get resource: %v", err)
+	}
+	for key, value := range userData {
+		if res.Status.UserData[key] != value {
+			t.Errorf("expected %s to be decoded to %q, got %q", key, value, res.Status.UserData[key])
+		}
+	}
+
+	// Once no value overflows, the overflow is dropped.
+	if err := r.Update("res", "owner", common.Busy, common.UserDataFromMap(common.UserDataMap{"large": ""})); err != nil {
+		t.Fatalf("failed to update: %v", err)
+	}
+	if secrets := listOverflowSecrets(t, overflowClient); len(secrets) != 0 {
+		t.Errorf("expected the overflow to be dropped, got %v", secrets)
+	}
+}
+
+func TestUserDataOverflowVersions(t *testing.T) {
+	r := makeTestRanch([]runtime.Object{
+		newResource("res", "t", common.Busy, "owner", startTime),
+		newResource("other", "t", common.Busy, "owner", startTime),
+	})
+	overflowClient := fakectrlruntimeclient.NewFakeClient()
+	overflow := NewSecretUserDataOverflow(overflowClient, testNS)
+	r.Storage.SetUserDataOptions(UserDataOptions{OverflowAbove: 10, Overflow: overflow})
+	raw := r.Storage.decorated.Backend.(*userDataBackend).Backend
+
+	for _, value := range []string{"first large value", "second large value"} {
+		if err := r.Update("res", "owner", common.Busy, common.UserDataFromMap(common.UserDataMap{"key": value})); err != nil {
+			t.Fatalf("failed to update: %v", err)
+		}
+	}
+	// Only the version referenced by the stored resource is kept.
+	if secrets := listOverflowSecrets(t, overflowClient); len(secrets) != 1 {
+		t.Errorf("expected a single version of the overflow, got %v", secrets)
+	}
+
+	// A failed update leaves the stored resource in sync with its overflow.
+	stale, err := r.Storage.GetResource("res")
+	if err != nil {
+		t.Fatalf("failed to get resource: %v", err)
+	}
+	stale.ResourceVersion = "1"
+	stale.Status.UserData["key"] = "third large value"
+	if _, err := r.Storage.UpdateResource(stale); err == nil {
+		t.Fatal("expected the update of a stale resource to fail")
+	}
+	res, err := r.Storage.GetResource("res")
+	if err != nil {
+		t.Fatalf("expected the resource to still decode, got %v", err)
+	}
+	if res.Status.UserData["key"] != "second large value" {
+		t.Errorf("expected the value of the last successful update, got %q", res.Status.UserData["key"])
+	}
+
+	// The versions left behind are pruned by the next update, which finds them
+	// by their label rather than remembering them, e.g. across restarts.
+	if secrets := listOverflowSecrets(t, overflowClient); len(secrets) != 2 {
+		t.Errorf("expected the failed update to leave a version behind, got %v", secrets)
+	}
+	if err := r.Update("res", "owner", common.Busy, common.UserDataFromMap(common.UserDataMap{"key": "fourth large value"})); err != nil {
+		t.Fatalf("failed to update: %v", err)
+	}
+	if secrets := listOverflowSecrets(t, overflowClient); len(secrets) != 1 {
+		t.Errorf("expected the versions left behind to be pruned, got %v", secrets)
+	}
+
+	// Resources whose overflow is out of sync don't fail the listings.
+	other, err := raw.GetResource(context.Background(), "other")
+	if err != nil {
+		t.Fatalf("failed to get stored resource: %v", err)
+	}
+	other.Status.UserData = map[string]string{"key": overflowReference("missing", "value")}
+	if err := raw.UpdateResource(context.Background(), other); err != nil {
+		t.Fatalf("failed to update stored resource: %v", err)
+	}
+	resources, err := r.Storage.GetResources()
+	if err != nil {
+		t.Fatalf("expected the listing to succeed, got %v", err)
+	}
+	if len(resources.Items) != 1 || resources.Items[0].Name != "res" {
+		t.Errorf("expected only the resource in sync to be listed, got %v", resources.Items)
+	}
+}
+
+func listOverflowSecrets(t *testing.T, client ctrlruntimeclient.Client) []string {
+	var secrets corev1.SecretList
+	if err := client.List(context.Background(), &secrets, ctrlruntimeclient.MatchingLabels{OverflowLabel: "res"}); err != nil {
+		t.Fatalf("failed to list the overflow: %v", err)
+	}
+	var names []string
+	for _, secret := range secrets.Items {
+		names = append(names, secret.Name)
+	}
+	return names
+}
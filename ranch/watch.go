@@ -0,0 +1,163 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	toolscache "k8s.io/client-go/tools/cache"
+
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/crds"
+)
+
+// watchBufferSize is how many events a watcher may lag behind before it is
+// dropped, so a slow watcher never blocks changes of the resources.
+const watchBufferSize = 256
+
+// watchBroadcaster streams the events of the resources to the watchers.
+type watchBroadcaster struct {
+	lock     sync.Mutex
+	next     int
+	watchers map[int]*watcher
+}
+
+type watcher struct {
+	types  map[string]bool
+	events chan common.ResourceEvent
+}
+
+func newWatchBroadcaster() *watchBroadcaster {
+	return &watchBroadcaster{watchers: map[int]*watcher{}}
+}
+
+// watched tells whether anyone watches, so events are only built for them.
+func (b *watchBroadcaster) watched() bool {
+	if b == nil {
+		return false
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return len(b.watchers) > 0
+}
+
+func (b *watchBroadcaster) watch(types []string) (int, *watcher) {
+	w := &watcher{events: make(chan common.ResourceEvent, watchBufferSize)}
+	if len(types) > 0 {
+		w.types = map[string]bool{}
+		for _, rType := range types {
+			w.types[rType] = true
+		}
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	id := b.next
+	b.next++
+	b.watchers[id] = w
+	return id, w
+}
+
+func (b *watchBroadcaster) stop(id int) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if w, ok := b.watchers[id]; ok {
+		delete(b.watchers, id)
+		close(w.events)
+	}
+}
+
+func (b *watchBroadcaster) publish(event common.ResourceEvent) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for id, w := range b.watchers {
+		if w.types != nil && !w.types[event.Type] {
+			continue
+		}
+		select {
+		case w.events <- event:
+		default:
+			logrus.WithField("watcher", id).Warning("Dropping watcher lagging behind the resource events.")
+			delete(b.watchers, id)
+			close(w.events)
+		}
+	}
+}
+
+func (s *Storage) publishResourceEvent(kind string, res *crds.ResourceObject, previousState string) {
+	if !s.watchers.watched() {
+		return
+	}
+	event := common.ResourceEvent{
+		Kind:          kind,
+		Name:          res.Name,
+		Type:          res.Spec.Type,
+		Time:          s.now().Time,
+		PreviousState: previousState,
+	}
+	if kind != common.ResourceDeleted {
+		event.State, event.Owner = res.Status.State, res.Status.Owner
+	}
+	s.watchers.publish(event)
+}
+
+// Watch streams the events of the resources of types, or of every type if
+// none is given, until stop is called. The channel is closed once stopped, or
+// early if the watcher lags too far behind, in which case it must watch again
+// and list the resources to catch up.
+func (r *Ranch) Watch(types ...string) (events <-chan common.ResourceEvent, stop func()) {
+	id, w := r.Storage.watchers.watch(types)
+	return w.events, func() { r.Storage.watchers.stop(id) }
+}
+
+// ResourceEventSource notifies of the changes of the resources in the
+// storage, like the informers of the cache of controller-runtime.
+type ResourceEventSource interface {
+	AddEventHandler(handler toolscache.ResourceEventHandler)
+}
+
+// WatchFollowerEvents publishes the changes of the resources source notifies
+// of to the watchers while the ranch is a follower, whose storage only the
+// leader changes. The leader publishes its own changes.
+func (r *Ranch) WatchFollowerEvents(source ResourceEventSource) {
+	publish := func(kind string, obj interface{}, previousState string) {
+		if tombstone, ok := obj.(toolscache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		res, ok := obj.(*crds.ResourceObject)
+		if !ok || !r.Follower() {
+			return
+		}
+		r.Storage.publishResourceEvent(kind, res, previousState)
+	}
+	source.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) { publish(common.ResourceAdded, obj, "") },
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			old, ok := oldObj.(*crds.ResourceObject)
+			if !ok {
+				return
+			}
+			// Like for the changes of the leader, only changes of the
+			// state or the owner are streamed.
+			if res, ok := newObj.(*crds.ResourceObject); ok && res.Status.State == old.Status.State && res.Status.Owner == old.Status.Owner {
+				return
+			}
+			publish(common.ResourceChanged, newObj, old.Status.State)
+		},
+		DeleteFunc: func(obj interface{}) { publish(common.ResourceDeleted, obj, "") },
+	})
+}
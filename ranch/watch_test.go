@@ -0,0 +1,144 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranch
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	toolscache "k8s.io/client-go/tools/cache"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+func TestWatch(t *testing.T) {
+	r := makeTestRanch([]runtime.Object{
+		newResource("res", "t", common.Dirty, "", startTime),
+		newResource("other", "u", common.Free, "", startTime),
+	})
+	events, stop := r.Watch("t")
+
+	// A change of another type and a change of neither state nor owner are
+	// not streamed.
+	if _, _, err := r.Acquire("u", common.Free, common.Busy, "owner", "request"); err != nil {
+		t.Fatalf("failed to acquire: %v", err)
+	}
+	res, err := r.Storage.GetResource("res")
+	if err != nil {
+		t.Fatalf("failed to get resource: %v", err)
+	}
+	res.Status.UserData = map[string]string{"key": "value"}
+	if res, err = r.Storage.UpdateResource(res); err != nil {
+		t.Fatalf("failed to update resource: %v", err)
+	}
+	res.Status.State = common.Free
+	if _, err := r.Storage.UpdateResource(res); err != nil {
+		t.Fatalf("failed to update resource: %v", err)
+	}
+	if err := r.Storage.DeleteResource("res"); err != nil {
+		t.Fatalf("failed to delete resource: %v", err)
+	}
+
+	expected := []common.ResourceEvent{
+		{Kind: common.ResourceChanged, Name: "res", Type: "t", Time: fakeNow.Time, State: common.Free, PreviousState: common.Dirty},
+		{Kind: common.ResourceDeleted, Name: "res", Type: "t", Time: fakeNow.Time},
+	}
+	for _, want := range expected {
+		select {
+		case got := <-events:
+			if got != want {
+				t.Errorf("expected event %+v, got %+v", want, got)
+			}
+		default:
+			t.Fatalf("expected event %+v, got none", want)
+		}
+	}
+	select {
+	case got := <-events:
+		t.Errorf("expected no more events, got %+v", got)
+	default:
+	}
+
+	stop()
+	if _, ok := <-events; ok {
+		t.Error("expected the events to be closed once stopped")
+	}
+}
+
+func TestWatchDropsLaggingWatchers(t *testing.T) {
+	b := newWatchBroadcaster()
+	_, w := b.watch(nil)
+	for i := 0; i <= watchBufferSize; i++ {
+		b.publish(common.ResourceEvent{Kind: common.ResourceAdded, Name: "res", Type: "t"})
+	}
+	if b.watched() {
+		t.Error("expected the lagging watcher to be dropped")
+	}
+	count := 0
+	for range w.events {
+		count++
+	}
+	if count != watchBufferSize {
+		t.Errorf("expected the %d buffered events, got %d", watchBufferSize, count)
+	}
+}
+
+// fakeEventSource hands its handler to the test notifying of the changes.
+type fakeEventSource struct {
+	handler toolscache.ResourceEventHandler
+}
+
+func (f *fakeEventSource) AddEventHandler(handler toolscache.ResourceEventHandler) {
+	f.handler = handler
+}
+
+func TestWatchFollowerEvents(t *testing.T) {
+	r := makeTestRanch(nil)
+	source := &fakeEventSource{}
+	r.WatchFollowerEvents(source)
+	events, stop := r.Watch()
+	defer stop()
+
+	dirty := newResource("res", "t", common.Dirty, "", startTime)
+	free := newResource("res", "t", common.Free, "", startTime)
+	// The leader publishes its own changes.
+	source.handler.OnUpdate(dirty, free)
+	r.SetFollower(true)
+	source.handler.OnUpdate(free, free)
+	source.handler.OnUpdate(dirty, free)
+	source.handler.OnDelete(toolscache.DeletedFinalStateUnknown{Key: "res", Obj: free})
+
+	expected := []common.ResourceEvent{
+		{Kind: common.ResourceChanged, Name: "res", Type: "t", Time: fakeNow.Time, State: common.Free, PreviousState: common.Dirty},
+		{Kind: common.ResourceDeleted, Name: "res", Type: "t", Time: fakeNow.Time},
+	}
+	for _, want := range expected {
+		select {
+		case got := <-events:
+			if got != want {
+				t.Errorf("expected event %+v, got %+v", want, got)
+			}
+		default:
+			t.Fatalf("expected event %+v, got none", want)
+		}
+	}
+	select {
+	case got := <-events:
+		t.Errorf("expected no more events, got %+v", got)
+	default:
+	}
+}
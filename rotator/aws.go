@@ -0,0 +1,77 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rotator
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+
+	awsboskos "sigs.k8s.io/boskos/common/aws"
+)
+
+// AWSAccessKey replaces the access key stored in the user data of a resource
+// with a new access key of the same IAM user. The user authenticates with its
+// current key, so boskos needs no AWS credentials of its own.
+type AWSAccessKey struct {
+	newClient func(creds credentials.Value) (iamiface.IAMAPI, error)
+}
+
+// NewAWSAccessKey returns an AWSAccessKey rotator.
+func NewAWSAccessKey() *AWSAccessKey {
+	return &AWSAccessKey{newClient: func(creds credentials.Value) (iamiface.IAMAPI, error) {
+		s, err := session.NewSession(aws.NewConfig().WithCredentials(credentials.NewStaticCredentialsFromCreds(creds)))
+		if err != nil {
+			return nil, err
+		}
+		return iam.New(s), nil
+	}}
+}
+
+// Rotate implements ranch.CredentialRotator.
+func (a *AWSAccessKey) Rotate(name, _ string, userData map[string]string) (map[string]string, error) {
+	accessKeyID := userData[awsboskos.UserDataAccessIDKey]
+	secretAccessKey := userData[awsboskos.UserDataSecretAccessKey]
+	if accessKeyID == "" || secretAccessKey == "" {
+		return nil, fmt.Errorf("resource %s has no AWS access key in its user data", name)
+	}
+	client, err := a.newClient(credentials.Value{AccessKeyID: accessKeyID, SecretAccessKey: secretAccessKey})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create IAM client for resource %s: %w", name, err)
+	}
+
+	created, err := client.CreateAccessKey(&iam.CreateAccessKeyInput{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create access key for resource %s: %w", name, err)
+	}
+	if _, err := client.DeleteAccessKey(&iam.DeleteAccessKeyInput{AccessKeyId: aws.String(accessKeyID)}); err != nil {
+		// Do not leak the new key, the rotation is retried from scratch.
+		if _, deleteErr := client.DeleteAccessKey(&iam.DeleteAccessKeyInput{AccessKeyId: created.AccessKey.AccessKeyId}); deleteErr != nil {
+			return nil, fmt.Errorf("failed to delete access key %s of resource %s: %v, and failed to delete new access key %s: %v",
+				accessKeyID, name, err, aws.StringValue(created.AccessKey.AccessKeyId), deleteErr)
+		}
+		return nil, fmt.Errorf("failed to delete access key %s of resource %s: %w", accessKeyID, name, err)
+	}
+	return map[string]string{
+		awsboskos.UserDataAccessIDKey:     aws.StringValue(created.AccessKey.AccessKeyId),
+		awsboskos.UserDataSecretAccessKey: aws.StringValue(created.AccessKey.SecretAccessKey),
+	}, nil
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rotator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// GCPServiceAccountKey replaces the JSON key file of a service account stored
+// in the user data of a resource with a new key of the same service account.
+// Keys are managed with gcloud, using the credentials boskos runs with.
+type GCPServiceAccountKey struct {
+	gcloud func(args ...string) ([]byte, error)
+}
+
+// NewGCPServiceAccountKey returns a GCPServiceAccountKey rotator running the
+// gcloud binary at path.
+func NewGCPServiceAccountKey(path string) *GCPServiceAccountKey {
+	return &GCPServiceAccountKey{gcloud: func(args ...string) ([]byte, error) {
+		return exec.Command(path, args...).CombinedOutput()
+	}}
+}
+
+// serviceAccountKey holds the fields of a JSON key file used for rotation.
+type serviceAccountKey struct {
+	ClientEmail  string `json:"client_email"`
+	PrivateKeyID string `json:"private_key_id"`
+}
+
+// Rotate implements ranch.CredentialRotator.
+func (g *GCPServiceAccountKey) Rotate(name, key string, userData map[string]string) (map[string]string, error) {
+	var current serviceAccountKey
+	if err := json.Unmarshal([]byte(userData[key]), &current); err != nil || current.ClientEmail == "" || current.PrivateKeyID == "" {
+		return nil, fmt.Errorf("resource %s has no service account key in its %s user data", name, key)
+	}
+
+	dir, err := ioutil.TempDir("", "boskos-rotator")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	keyFile := filepath.Join(dir, "key.json")
+
+	if out, err := g.gcloud("iam", "service-accounts", "keys", "create", keyFile, "--iam-account", current.ClientEmail); err != nil {
+		return nil, fmt.Errorf("failed to create key for service account %s of resource %s: %v: %s", current.ClientEmail, name, err, out)
+	}
+	created, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read new key of service account %s: %w", current.ClientEmail, err)
+	}
+	var newKey serviceAccountKey
+	if err := json.Unmarshal(created, &newKey); err != nil {
+		return nil, fmt.Errorf("failed to parse new key of service account %s: %w", current.ClientEmail, err)
+	}
+	if out, err := g.gcloud("iam", "service-accounts", "keys", "delete", current.PrivateKeyID, "--iam-account", current.ClientEmail, "--quiet"); err != nil {
+		// Do not leak the new key, the rotation is retried from scratch.
+		if out, deleteErr := g.gcloud("iam", "service-accounts", "keys", "delete", newKey.PrivateKeyID, "--iam-account", current.ClientEmail, "--quiet"); deleteErr != nil {
+			return nil, fmt.Errorf("failed to delete key %s of service account %s: %v, and failed to delete new key %s: %v: %s",
+				current.PrivateKeyID, current.ClientEmail, err, newKey.PrivateKeyID, deleteErr, out)
+		}
+		return nil, fmt.Errorf("failed to delete key %s of service account %s of resource %s: %v: %s", current.PrivateKeyID, current.ClientEmail, name, err, out)
+	}
+	return map[string]string{key: string(created)}, nil
+}
@@ -0,0 +1,41 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package rotator implements the credential rotators boskos uses to replace
+// the credentials of a resource after every lease.
+package rotator
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+)
+
+// staticSecretBytes is the length of the secrets generated by Static.
+const staticSecretBytes = 32
+
+// Static generates a random secret, for resources whose consumers read their
+// credentials from boskos rather than from a cloud provider.
+type Static struct{}
+
+// Rotate implements ranch.CredentialRotator.
+func (Static) Rotate(name, key string, _ map[string]string) (map[string]string, error) {
+	secret := make([]byte, staticSecretBytes)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate a secret for resource %s: %w", name, err)
+	}
+	return map[string]string{key: hex.EncodeToString(secret)}, nil
+}
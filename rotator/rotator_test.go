@@ -0,0 +1,149 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rotator
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+
+	awsboskos "sigs.k8s.io/boskos/common/aws"
+)
+
+func TestStatic(t *testing.T) {
+	first, err := Static{}.Rotate("res", "password", nil)
+	if err != nil {
+		t.Fatalf("failed to rotate: %v", err)
+	}
+	second, err := Static{}.Rotate("res", "password", nil)
+	if err != nil {
+		t.Fatalf("failed to rotate: %v", err)
+	}
+	if len(first["password"]) != 2*staticSecretBytes {
+		t.Errorf("expected a %d bytes hex secret, got %q", staticSecretBytes, first["password"])
+	}
+	if first["password"] == second["password"] {
+		t.Errorf("expected different secrets, got %q twice", first["password"])
+	}
+}
+
+type fakeIAM struct {
+	iamiface.IAMAPI
+	deleteErr error
+	deleted   []string
+}
+
+func (f *fakeIAM) CreateAccessKey(*iam.CreateAccessKeyInput) (*iam.CreateAccessKeyOutput, error) {
+	return &iam.CreateAccessKeyOutput{AccessKey: &iam.AccessKey{AccessKeyId: aws.String("new-id"), SecretAccessKey: aws.String("new-secret")}}, nil
+}
+
+func (f *fakeIAM) DeleteAccessKey(in *iam.DeleteAccessKeyInput) (*iam.DeleteAccessKeyOutput, error) {
+	f.deleted = append(f.deleted, aws.StringValue(in.AccessKeyId))
+	if f.deleteErr != nil && aws.StringValue(in.AccessKeyId) == "old-id" {
+		return nil, f.deleteErr
+	}
+	return &iam.DeleteAccessKeyOutput{}, nil
+}
+
+func TestAWSAccessKey(t *testing.T) {
+	testCases := []struct {
+		name          string
+		deleteErr     error
+		expect        map[string]string
+		expectDeleted []string
+		expectErr     bool
+	}{
+		{
+			name: "old key is replaced",
+			expect: map[string]string{
+				awsboskos.UserDataAccessIDKey:     "new-id",
+				awsboskos.UserDataSecretAccessKey: "new-secret",
+			},
+			expectDeleted: []string{"old-id"},
+		},
+		{
+			name:          "new key is deleted if the old one cannot be",
+			deleteErr:     errors.New("injected"),
+			expectDeleted: []string{"old-id", "new-id"},
+			expectErr:     true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &fakeIAM{deleteErr: tc.deleteErr}
+			rotator := &AWSAccessKey{newClient: func(creds credentials.Value) (iamiface.IAMAPI, error) {
+				if creds.AccessKeyID != "old-id" || creds.SecretAccessKey != "old-secret" {
+					t.Errorf("expected the client to use the old key, got %+v", creds)
+				}
+				return client, nil
+			}}
+			got, err := rotator.Rotate("res", "", map[string]string{
+				awsboskos.UserDataAccessIDKey:     "old-id",
+				awsboskos.UserDataSecretAccessKey: "old-secret",
+			})
+			if (err != nil) != tc.expectErr {
+				t.Fatalf("expected error %t, got %v", tc.expectErr, err)
+			}
+			if !reflect.DeepEqual(got, tc.expect) {
+				t.Errorf("expected %v, got %v", tc.expect, got)
+			}
+			if !reflect.DeepEqual(client.deleted, tc.expectDeleted) {
+				t.Errorf("expected keys %v to be deleted, got %v", tc.expectDeleted, client.deleted)
+			}
+		})
+	}
+}
+
+func TestGCPServiceAccountKey(t *testing.T) {
+	newKey := `{"client_email":"sa@project.iam.gserviceaccount.com","private_key_id":"new-id"}`
+	var calls []string
+	rotator := &GCPServiceAccountKey{gcloud: func(args ...string) ([]byte, error) {
+		calls = append(calls, strings.Join(args[:4], " "))
+		if args[3] == "create" {
+			return nil, ioutil.WriteFile(args[4], []byte(newKey), 0600)
+		}
+		if args[4] != "old-id" {
+			t.Errorf("expected the old key to be deleted, got %v", args)
+		}
+		return nil, nil
+	}}
+
+	oldKey, _ := json.Marshal(serviceAccountKey{ClientEmail: "sa@project.iam.gserviceaccount.com", PrivateKeyID: "old-id"})
+	got, err := rotator.Rotate("res", "sa-key", map[string]string{"sa-key": string(oldKey)})
+	if err != nil {
+		t.Fatalf("failed to rotate: %v", err)
+	}
+	if got["sa-key"] != newKey {
+		t.Errorf("expected the new key to be returned, got %v", got)
+	}
+	expectCalls := []string{"iam service-accounts keys create", "iam service-accounts keys delete"}
+	if !reflect.DeepEqual(calls, expectCalls) {
+		t.Errorf("expected gcloud calls %v, got %v", expectCalls, calls)
+	}
+
+	if _, err := rotator.Rotate("res", "sa-key", map[string]string{}); err == nil {
+		t.Error("expected an error for a resource without key")
+	}
+}
@@ -0,0 +1,627 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package server wires a complete boskos server, so it can be run by the boskos
+// binary as well as embedded in the process of a test framework, backed by an
+// in-memory storage.
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/reflection"
+	corev1 "k8s.io/api/core/v1"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	fakectrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"sigs.k8s.io/boskos/boskospb"
+	"sigs.k8s.io/boskos/common"
+	"sigs.k8s.io/boskos/handlers"
+	"sigs.k8s.io/boskos/ranch"
+)
+
+// Defaults of the Options.
+const (
+	DefaultAddr                     = "127.0.0.1:0"
+	DefaultRequestTTL               = 30 * time.Second
+	DefaultRequestGCPeriod          = time.Minute
+	DefaultHoldExpiryPeriod         = 10 * time.Second
+	DefaultLeaseExpiryPeriod        = 10 * time.Second
+	DefaultSliceRotationPeriod      = 30 * time.Second
+	DefaultCredentialRotationPeriod = 10 * time.Second
+	DefaultGRPCHealthPeriod         = 10 * time.Second
+	DefaultEventPrunePeriod         = 10 * time.Minute
+	DefaultSLASamplePeriod          = 30 * time.Second
+	DefaultSLAReportPeriod          = time.Hour
+	DefaultShutdownTimeout          = 5 * time.Second
+)
+
+// Options configure a Server. The zero value is a usable in-memory server
+// without resources, listening on a random local port.
+type Options struct {
+	// Config is the resource config. It takes precedence over ConfigPath.
+	Config *common.BoskosConfig
+	// ConfigPath is the path to the resource config, if Config is unset.
+	ConfigPath string
+	// Client is the client storing the resources. Defaults to an in-memory
+	// client.
+	Client ctrlruntimeclient.Client
+	// Backend, if set, stores the resources instead of Client, e.g. in etcd.
+	Backend ranch.Backend
+	// ReadReplicas, if set, serve the reads of listings like metrics when the
+	// client fails.
+	ReadReplicas []ctrlruntimeclient.Reader
+	// ResourceInformer, if set, is the informer of the resources of Client,
+	// which listings like metrics iterate over instead of copying them.
+	ResourceInformer ranch.ResourceInformer
+	// Namespace holds the resources. Defaults to the default namespace.
+	Namespace string
+	// Addr is the address to serve on. Defaults to DefaultAddr.
+	Addr string
+	// GRPCAddr, if set, is the address to serve the gRPC API on, along with
+	// the gRPC health checking and reflection services.
+	GRPCAddr string
+	// GRPCKeepalive and GRPCKeepaliveEnforcement, if set, tune the keepalives
+	// of the connections to the gRPC API, e.g. to outlive the idle timeouts of
+	// load balancers.
+	GRPCKeepalive            *keepalive.ServerParameters
+	GRPCKeepaliveEnforcement *keepalive.EnforcementPolicy
+	// RequestTTL is how long a queued request keeps its rank without being
+	// renewed. Defaults to DefaultRequestTTL.
+	RequestTTL time.Duration
+	// RequestStaleAfter, if set, expires the queued requests which were not
+	// renewed for that long, even before the RequestTTL, unless their owner
+	// updated one of its resources since.
+	RequestStaleAfter time.Duration
+	// PriorityAgingPeriod is how long a queued request waits for its priority
+	// to be raised by one, so low priority requests are not starved. Defaults
+	// to ranch.DefaultPriorityAgingPeriod, a negative period disables aging.
+	PriorityAgingPeriod time.Duration
+	// MaxPriorityBoost is how much the priority of the requests of an owner
+	// is raised at most after its resources were reset or claimed by others,
+	// or its requests failed on errors of boskos. Defaults to
+	// ranch.DefaultMaxPriorityBoost, a negative value disables boosts.
+	MaxPriorityBoost int
+	// LameDuck starts the server without granting new leases.
+	LameDuck bool
+	// ReadOnly starts the server rejecting every change of the resources,
+	// without syncing the config.
+	ReadOnly bool
+	// Authenticator, if set, authenticates the callers of the API.
+	Authenticator *handlers.Authenticator
+	// SchedulerPolicy, if set, picks the resources handed out on acquire.
+	SchedulerPolicy ranch.SchedulerPolicy
+	// CredentialRotators are registered by name with the ranch.
+	CredentialRotators map[string]ranch.CredentialRotator
+	// Middleware, if set, wraps the handler of the API, e.g. to instrument it.
+	Middleware func(http.Handler) http.Handler
+	// EventArchive, if set, records the events of the resources, which are
+	// then queried at /events.
+	EventArchive ranch.EventArchive
+	// EventRetention, if set, is how long the archived events are kept.
+	EventRetention time.Duration
+	// AuditLog, if set, records every acquire, release, update and reset of
+	// the resources.
+	AuditLog ranch.AuditLog
+	// StatePersistence, if set, stores the locks and the open cleanup
+	// breakers, so they survive restarts and the failovers of the leader.
+	StatePersistence ranch.StatePersistence
+	// UserData configures the size limits, compression and overflow of the
+	// user data of the resources.
+	UserData ranch.UserDataOptions
+	// Elected, if set, makes the server a follower until it is closed, once
+	// the server is elected leader among its replicas. Followers serve the
+	// listings, but reject changes and leave the config sync and the
+	// background work to the leader.
+	Elected <-chan struct{}
+	// TypeShards, if set, makes the server own only some of the resource
+	// types, syncing the resources of its types from the config and
+	// forwarding the requests for the other types to the instances owning
+	// them.
+	TypeShards *handlers.TypeShards
+	// SLAReportDir, if set, is the directory the daily and weekly SLA
+	// reports are written to every SLAReportPeriod, as sla-daily.json and
+	// sla-weekly.json.
+	SLAReportDir string
+
+	// Periods of the background work. They default to the Default*Period
+	// constants and are only used once the server is started.
+	RequestGCPeriod          time.Duration
+	HoldExpiryPeriod         time.Duration
+	LeaseExpiryPeriod        time.Duration
+	SliceRotationPeriod      time.Duration
+	CredentialRotationPeriod time.Duration
+	GRPCHealthPeriod         time.Duration
+	EventPrunePeriod         time.Duration
+	SLASamplePeriod          time.Duration
+	SLAReportPeriod          time.Duration
+	// ConfigSyncPeriod, if set, syncs the config periodically. It keeps the
+	// dynamic resources within bounds when no controller syncs the config on
+	// changes of the resources, like with a Backend.
+	ConfigSyncPeriod time.Duration
+}
+
+func (o *Options) defaults() {
+	if o.Client == nil && o.Backend == nil {
+		o.Client = fakectrlruntimeclient.NewFakeClient()
+	}
+	if o.Namespace == "" {
+		o.Namespace = corev1.NamespaceDefault
+	}
+	if o.Addr == "" {
+		o.Addr = DefaultAddr
+	}
+	for _, d := range []struct {
+		value *time.Duration
+		def   time.Duration
+	}{
+		{&o.RequestTTL, DefaultRequestTTL},
+		{&o.RequestGCPeriod, DefaultRequestGCPeriod},
+		{&o.HoldExpiryPeriod, DefaultHoldExpiryPeriod},
+		{&o.LeaseExpiryPeriod, DefaultLeaseExpiryPeriod},
+		{&o.SliceRotationPeriod, DefaultSliceRotationPeriod},
+		{&o.CredentialRotationPeriod, DefaultCredentialRotationPeriod},
+		{&o.GRPCHealthPeriod, DefaultGRPCHealthPeriod},
+		{&o.EventPrunePeriod, DefaultEventPrunePeriod},
+		{&o.SLASamplePeriod, DefaultSLASamplePeriod},
+		{&o.SLAReportPeriod, DefaultSLAReportPeriod},
+	} {
+		if *d.value <= 0 {
+			*d.value = d.def
+		}
+	}
+}
+
+// Server is a boskos server. It is safe for concurrent use.
+type Server struct {
+	opts    Options
+	ranch   *ranch.Ranch
+	handler http.Handler
+
+	// syncLock serializes the config syncs, whether periodic, triggered by
+	// watches or reloads.
+	syncLock sync.Mutex
+
+	lock     sync.Mutex
+	listener net.Listener
+	http     *http.Server
+	grpc     *grpc.Server
+	health   *health.Server
+	grpcAddr net.Addr
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	stopped  bool
+}
+
+// NewServer creates a Server and syncs its config. It does not serve requests
+// until it is started.
+func NewServer(opts Options) (*Server, error) {
+	opts.defaults()
+	var storage *ranch.Storage
+	if opts.Backend != nil {
+		storage = ranch.NewStorageWithBackend(context.Background(), opts.Backend)
+	} else {
+		storage = ranch.NewStorage(context.Background(), opts.Client, opts.Namespace)
+		storage.SetReadReplicas(opts.ReadReplicas...)
+		if opts.ResourceInformer != nil {
+			storage.SetResourceInformer(opts.ResourceInformer)
+		}
+	}
+	storage.SetUserDataOptions(opts.UserData)
+	r, err := ranch.NewRanch("", storage, opts.RequestTTL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ranch: %w", err)
+	}
+	r.SetLameDuck(opts.LameDuck)
+	r.SetReadOnly(opts.ReadOnly)
+	r.SetFollower(opts.Elected != nil)
+	r.SetRequestStaleAfter(opts.RequestStaleAfter)
+	if opts.PriorityAgingPeriod != 0 {
+		r.SetPriorityAging(opts.PriorityAgingPeriod)
+	}
+	if opts.MaxPriorityBoost != 0 {
+		r.SetMaxPriorityBoost(opts.MaxPriorityBoost)
+	}
+	for name, rotator := range opts.CredentialRotators {
+		r.RegisterCredentialRotator(name, rotator)
+	}
+	if opts.SchedulerPolicy != nil {
+		r.SetSchedulerPolicy(opts.SchedulerPolicy)
+	}
+	if opts.EventArchive != nil {
+		r.SetEventArchive(opts.EventArchive)
+	}
+	if opts.AuditLog != nil {
+		r.SetAuditLog(opts.AuditLog)
+	}
+	if opts.StatePersistence != nil {
+		r.SetStatePersistence(opts.StatePersistence)
+	}
+	if opts.TypeShards != nil {
+		r.SetOwnedTypes(opts.TypeShards.Owns)
+	}
+	// Followers learn the changes of the leader from the informer, to
+	// stream them to their watchers.
+	if source, ok := opts.ResourceInformer.(ranch.ResourceEventSource); ok && opts.Elected != nil {
+		r.WatchFollowerEvents(source)
+	}
+
+	var handler http.Handler = handlers.NewBoskosHandler(r)
+	if opts.TypeShards != nil {
+		handler = opts.TypeShards.Wrap(r, handler)
+	}
+	if opts.Authenticator != nil {
+		if opts.TypeShards != nil {
+			opts.Authenticator.TrustTypeShards(opts.TypeShards)
+		}
+		handler = opts.Authenticator.Wrap(handler)
+	}
+	if opts.Middleware != nil {
+		handler = opts.Middleware(handler)
+	}
+
+	s := &Server{opts: opts, ranch: r, handler: handler}
+	r.SetConfigReloader(s.SyncConfig)
+	if err := s.SyncConfig(); err != nil {
+		return nil, fmt.Errorf("failed to sync config: %w", err)
+	}
+	if err := r.RestoreCleanupBreakers(); err != nil {
+		return nil, fmt.Errorf("failed to restore the cleanup breakers: %w", err)
+	}
+	return s, nil
+}
+
+// Ranch returns the ranch of the server, e.g. to inspect resources in tests.
+func (s *Server) Ranch() *ranch.Ranch {
+	return s.ranch
+}
+
+// Handler returns the handler of the API, for callers serving it themselves.
+func (s *Server) Handler() http.Handler {
+	return s.handler
+}
+
+// SyncConfig syncs the resources with the config of the options. It is
+// skipped in read-only mode, where the storage must not change. Followers
+// only apply what the config keeps in memory, like aliases and tenants, as
+// the leader alone syncs the resources so that replicas never race to
+// tombstone the same ones.
+func (s *Server) SyncConfig() error {
+	s.syncLock.Lock()
+	defer s.syncLock.Unlock()
+	if s.skipSync() {
+		return nil
+	}
+	s.lock.Lock()
+	config, path := s.opts.Config, s.opts.ConfigPath
+	s.lock.Unlock()
+	switch {
+	case config != nil:
+		return s.ranch.ApplyConfig(config)
+	case path != "":
+		return s.ranch.SyncConfig(path)
+	}
+	return nil
+}
+
+// SetConfig replaces the config of the server and syncs the resources with it.
+// Servers in read-only mode only keep the config, and followers only apply
+// what it keeps in memory, until they leave read-only mode or are elected.
+func (s *Server) SetConfig(config *common.BoskosConfig) error {
+	s.syncLock.Lock()
+	defer s.syncLock.Unlock()
+	if s.skipSync() {
+		if err := common.ValidateConfig(config); err != nil {
+			return err
+		}
+	} else if err := s.ranch.ApplyConfig(config); err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.opts.Config = config
+	return nil
+}
+
+// skipSync returns whether the config must not be synced, logging why. The
+// sync lock must be held, so that a sync started by a leader is not skipped
+// halfway through.
+func (s *Server) skipSync() bool {
+	// The ranch of followers leaves the resources to the leader itself.
+	if s.ranch.ReadOnlyMode() && !s.ranch.Follower() {
+		logrus.Info("Skipping config sync in read-only mode.")
+		return true
+	}
+	return false
+}
+
+// Start starts serving requests and the background work of the ranch. It
+// returns once the server listens.
+func (s *Server) Start() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.stopped {
+		return errors.New("server was stopped")
+	}
+	if s.listener != nil {
+		return errors.New("server already started")
+	}
+	listener, err := net.Listen("tcp", s.opts.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.opts.Addr, err)
+	}
+	var grpcListener net.Listener
+	if s.opts.GRPCAddr != "" {
+		if grpcListener, err = net.Listen("tcp", s.opts.GRPCAddr); err != nil {
+			listener.Close()
+			return fmt.Errorf("failed to listen on %s: %w", s.opts.GRPCAddr, err)
+		}
+	}
+	s.listener = listener
+	s.http = &http.Server{Handler: s.handler}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	if s.opts.EventArchive != nil {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.ranch.ArchiveEvents(ctx)
+		}()
+	}
+	// Followers sync the config too, to keep its in-memory state current.
+	if s.opts.ConfigSyncPeriod > 0 {
+		s.tick(ctx, func() {
+			if err := s.SyncConfig(); err != nil {
+				logrus.WithError(err).Error("Periodic config sync failed")
+			}
+		}, s.opts.ConfigSyncPeriod)
+	}
+	if s.opts.Elected == nil {
+		s.lead(ctx)
+	} else {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			select {
+			case <-ctx.Done():
+				return
+			case <-s.opts.Elected:
+			}
+			logrus.Info("Elected leader, taking over the changes of the resources.")
+			s.ranch.SetFollower(false)
+			// The followers left the resources to the previous leader.
+			if err := s.SyncConfig(); err != nil {
+				logrus.WithError(err).Error("Config sync on election failed")
+			}
+			// The previous leader may have opened or reset breakers since.
+			if err := s.ranch.RestoreCleanupBreakers(); err != nil {
+				logrus.WithError(err).Error("Failed to restore the cleanup breakers on election")
+			}
+			s.lead(ctx)
+		}()
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		if err := s.http.Serve(listener); err != nil && err != http.ErrServerClosed {
+			logrus.WithError(err).Error("Boskos server failed")
+		}
+	}()
+	logrus.Infof("Boskos serving on %s", listener.Addr())
+	if grpcListener != nil {
+		var opts []grpc.ServerOption
+		var interceptors []grpc.UnaryServerInterceptor
+		if s.opts.Authenticator != nil {
+			interceptors = append(interceptors, s.opts.Authenticator.UnaryServerInterceptor())
+		}
+		if s.opts.TypeShards != nil {
+			interceptors = append(interceptors, s.opts.TypeShards.UnaryServerInterceptor(s.ranch))
+		}
+		if len(interceptors) > 0 {
+			opts = append(opts, grpc.ChainUnaryInterceptor(interceptors...))
+		}
+		if s.opts.GRPCKeepalive != nil {
+			opts = append(opts, grpc.KeepaliveParams(*s.opts.GRPCKeepalive))
+		}
+		if s.opts.GRPCKeepaliveEnforcement != nil {
+			opts = append(opts, grpc.KeepaliveEnforcementPolicy(*s.opts.GRPCKeepaliveEnforcement))
+		}
+		s.grpc = grpc.NewServer(opts...)
+		s.grpcAddr = grpcListener.Addr()
+		boskospb.RegisterBoskosServer(s.grpc, handlers.NewBoskosGRPCServer(s.ranch))
+		s.health = health.NewServer()
+		healthpb.RegisterHealthServer(s.grpc, s.health)
+		reflection.Register(s.grpc)
+		s.updateHealth()
+		s.tick(ctx, s.updateHealth, s.opts.GRPCHealthPeriod)
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			if err := s.grpc.Serve(grpcListener); err != nil {
+				logrus.WithError(err).Error("Boskos gRPC server failed")
+			}
+		}()
+		logrus.Infof("Boskos serving gRPC on %s", grpcListener.Addr())
+	}
+	return nil
+}
+
+// lead starts the background work of the ranch which changes the resources,
+// which only the leader does, until ctx is done.
+func (s *Server) lead(ctx context.Context) {
+	s.ranch.StartRequestGC(s.opts.RequestGCPeriod)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		<-ctx.Done()
+		s.ranch.StopRequestGC()
+	}()
+	s.tick(ctx, func() { s.ranch.ExpireHolds() }, s.opts.HoldExpiryPeriod)
+	s.tick(ctx, func() { s.ranch.ExpireLeases() }, s.opts.LeaseExpiryPeriod)
+	s.tick(ctx, s.ranch.RotateSlices, s.opts.SliceRotationPeriod)
+	s.tick(ctx, func() { s.ranch.RotateCredentials() }, s.opts.CredentialRotationPeriod)
+	if s.opts.EventArchive != nil && s.opts.EventRetention > 0 {
+		s.tick(ctx, s.pruneEvents, s.opts.EventPrunePeriod)
+	}
+	s.tick(ctx, func() {
+		if err := s.ranch.SampleSLA(); err != nil {
+			logrus.WithError(err).Error("Failed to sample the free resources for the SLA reports")
+		}
+	}, s.opts.SLASamplePeriod)
+	if s.opts.SLAReportDir != "" {
+		s.tick(ctx, s.writeSLAReports, s.opts.SLAReportPeriod)
+	}
+}
+
+// updateHealth reports the gRPC API as not serving in lame-duck mode, so load
+// balancers drain the server.
+func (s *Server) updateHealth() {
+	status := healthpb.HealthCheckResponse_SERVING
+	if s.ranch.LameDuckMode() {
+		status = healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	s.health.SetServingStatus("", status)
+	s.health.SetServingStatus(boskospb.Boskos_ServiceDesc.ServiceName, status)
+}
+
+// pruneEvents deletes the archived events past their retention.
+func (s *Server) pruneEvents() {
+	pruned, err := s.ranch.PruneEvents(s.opts.EventRetention)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to prune archived events")
+		return
+	}
+	if pruned > 0 {
+		logrus.WithField("count", pruned).Info("Pruned archived events")
+	}
+}
+
+// writeSLAReports writes the daily and weekly SLA reports to the report
+// directory, replacing the previous ones.
+func (s *Server) writeSLAReports() {
+	for _, window := range []string{common.SLADaily, common.SLAWeekly} {
+		if err := s.writeSLAReport(window); err != nil {
+			logrus.WithError(err).WithField("window", window).Error("Failed to write SLA report")
+		}
+	}
+}
+
+func (s *Server) writeSLAReport(window string) error {
+	report, err := s.ranch.SLAReport(window)
+	if err != nil {
+		return err
+	}
+	js, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	// The report is renamed into place, so readers never see a partial one.
+	path := filepath.Join(s.opts.SLAReportDir, fmt.Sprintf("sla-%s.json", window))
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, js, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (s *Server) tick(ctx context.Context, work func(), period time.Duration) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(period)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				work()
+			}
+		}
+	}()
+}
+
+// URL returns the URL the boskos client reaches the server on, or an empty
+// string if the server is not started.
+func (s *Server) URL() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.listener == nil {
+		return ""
+	}
+	return "http://" + s.listener.Addr().String()
+}
+
+// GRPCAddr returns the address the gRPC API is served on, or an empty string
+// if it is not served.
+func (s *Server) GRPCAddr() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.grpcAddr == nil {
+		return ""
+	}
+	return s.grpcAddr.String()
+}
+
+// Stop gracefully stops serving requests and the background work. Requests
+// in flight are given until ctx is done to complete. A stopped server cannot
+// be started again.
+func (s *Server) Stop(ctx context.Context) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.stopped {
+		return nil
+	}
+	s.stopped = true
+	if s.listener == nil {
+		return nil
+	}
+	err := s.http.Shutdown(ctx)
+	if s.grpc != nil {
+		// Health checks report the server as not serving while it drains.
+		s.health.Shutdown()
+		stopped := make(chan struct{})
+		go func() {
+			s.grpc.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			s.grpc.Stop()
+		}
+	}
+	s.cancel()
+	s.wg.Wait()
+	return err
+}
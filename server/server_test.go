@@ -0,0 +1,222 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"sigs.k8s.io/boskos/boskospb"
+	"sigs.k8s.io/boskos/client"
+	"sigs.k8s.io/boskos/common"
+)
+
+func TestEmbeddedServer(t *testing.T) {
+	s, err := NewServer(Options{Config: &common.BoskosConfig{Resources: []common.ResourceEntry{
+		{Type: "t", State: common.Free, Names: []string{"res-1"}},
+	}}})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	if s.URL() != "" {
+		t.Errorf("expected no URL before the server is started, got %s", s.URL())
+	}
+	if err := s.Start(); err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer s.Stop(context.Background())
+	if err := s.Start(); err == nil {
+		t.Error("expected starting the server twice to fail")
+	}
+
+	c, err := client.NewClient("owner", s.URL(), "", "")
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	res, err := c.Acquire("t", common.Free, common.Busy)
+	if err != nil {
+		t.Fatalf("failed to acquire: %v", err)
+	}
+	if res.Name != "res-1" {
+		t.Errorf("expected to acquire res-1, got %s", res.Name)
+	}
+	if err := c.Release(res.Name, common.Dirty); err != nil {
+		t.Fatalf("failed to release: %v", err)
+	}
+
+	if err := s.SetConfig(&common.BoskosConfig{Resources: []common.ResourceEntry{
+		{Type: "t", State: common.Free, Names: []string{"res-1", "res-2"}},
+	}}); err != nil {
+		t.Fatalf("failed to set config: %v", err)
+	}
+	if res, err = c.Acquire("t", common.Free, common.Busy); err != nil || res.Name != "res-2" {
+		t.Fatalf("expected to acquire the added res-2, got %v, %v", res, err)
+	}
+
+	if err := s.Stop(context.Background()); err != nil {
+		t.Errorf("failed to stop server: %v", err)
+	}
+	if err := s.Start(); err == nil {
+		t.Error("expected starting a stopped server to fail")
+	}
+}
+
+func TestEmbeddedGRPCServer(t *testing.T) {
+	s, err := NewServer(Options{GRPCAddr: DefaultAddr, Config: &common.BoskosConfig{Resources: []common.ResourceEntry{
+		{Type: "t", State: common.Free, Names: []string{"res-1"}},
+	}}})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer s.Stop(context.Background())
+
+	conn, err := grpc.Dial(s.GRPCAddr(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer conn.Close()
+	c := boskospb.NewBoskosClient(conn)
+	res, err := c.Acquire(context.Background(), &boskospb.AcquireRequest{Type: "t", State: common.Free, Dest: common.Busy, Owner: "owner"})
+	if err != nil {
+		t.Fatalf("failed to acquire: %v", err)
+	}
+	if res.Name != "res-1" {
+		t.Errorf("expected to acquire res-1, got %s", res.Name)
+	}
+	if _, err := c.Acquire(context.Background(), &boskospb.AcquireRequest{Type: "t", State: common.Free, Dest: common.Busy, Owner: "owner"}); status.Code(err) != codes.NotFound {
+		t.Errorf("expected no free resource to be found, got %v", err)
+	}
+	if _, err := c.Release(context.Background(), &boskospb.ReleaseRequest{Name: res.Name, Dest: common.Dirty, Owner: "owner"}); err != nil {
+		t.Fatalf("failed to release: %v", err)
+	}
+}
+
+func TestGRPCHealth(t *testing.T) {
+	s, err := NewServer(Options{GRPCAddr: DefaultAddr, Config: &common.BoskosConfig{Resources: []common.ResourceEntry{
+		{Type: "t", State: common.Free, Names: []string{"res-1"}},
+	}}})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer s.Stop(context.Background())
+
+	conn, err := grpc.Dial(s.GRPCAddr(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer conn.Close()
+	c := healthpb.NewHealthClient(conn)
+	check := func(expected healthpb.HealthCheckResponse_ServingStatus) {
+		for _, service := range []string{"", boskospb.Boskos_ServiceDesc.ServiceName} {
+			resp, err := c.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+			if err != nil {
+				t.Fatalf("failed to check the health of %q: %v", service, err)
+			}
+			if resp.Status != expected {
+				t.Errorf("expected %q to be %v, got %v", service, expected, resp.Status)
+			}
+		}
+	}
+	check(healthpb.HealthCheckResponse_SERVING)
+
+	s.Ranch().SetLameDuck(true)
+	s.updateHealth()
+	check(healthpb.HealthCheckResponse_NOT_SERVING)
+}
+
+func TestLeaderElection(t *testing.T) {
+	elected := make(chan struct{})
+	s, err := NewServer(Options{Elected: elected, Config: &common.BoskosConfig{Resources: []common.ResourceEntry{
+		{Type: "t", State: common.Free, Names: []string{"res-1"}},
+	}}})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer s.Stop(context.Background())
+
+	acquire := func() int {
+		resp, err := http.Post(s.URL()+"/acquire?type=t&state=free&dest=busy&owner=owner", "", nil)
+		if err != nil {
+			t.Fatalf("failed to acquire: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := acquire(); code != http.StatusServiceUnavailable {
+		t.Errorf("expected followers to reject changes with %d, got %d", http.StatusServiceUnavailable, code)
+	}
+	s.Ranch().SetReadOnly(false)
+	if !s.Ranch().ReadOnlyMode() {
+		t.Error("expected followers to stay read-only when leaving read-only mode")
+	}
+	// Followers apply the in-memory config set meanwhile and keep the rest
+	// for the takeover.
+	if err := s.SetConfig(&common.BoskosConfig{Resources: []common.ResourceEntry{
+		{Type: "t", State: common.Free, Names: []string{"res-1", "res-2"}, Aliases: []common.TypeAlias{{Name: "old"}}},
+	}}); err != nil {
+		t.Fatalf("failed to set config on follower: %v", err)
+	}
+	if resources, err := s.Ranch().Storage.GetResources(); err != nil || len(resources.Items) != 0 {
+		t.Errorf("expected followers not to sync the resources, got %v, %v", resources, err)
+	}
+	if rType, _, err := s.Ranch().ResolveType("old"); err != nil || rType != "t" {
+		t.Errorf("expected followers to resolve the aliases of the config, got %q, %v", rType, err)
+	}
+
+	close(elected)
+	deadline := time.Now().Add(wait.ForeverTestTimeout)
+	for s.Ranch().Follower() {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the server to lead once elected")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// The leader syncs the config the followers skipped, which the
+	// acquisition waits for.
+	for code := acquire(); code != http.StatusOK; code = acquire() {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the leader to hand out res-1, got %d", code)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if code := acquire(); code != http.StatusOK {
+		t.Errorf("expected the leader to sync the config set on the follower, got %d", code)
+	}
+}
+
+func TestNewServerInvalidConfig(t *testing.T) {
+	if _, err := NewServer(Options{Config: &common.BoskosConfig{}}); err == nil {
+		t.Error("expected an empty config to be rejected")
+	}
+}
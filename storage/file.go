@@ -0,0 +1,103 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"sigs.k8s.io/boskos/common"
+)
+
+type fileStore struct {
+	inMemoryStore
+	path string
+}
+
+// NewFileStorage creates a persistence layer keeping its resources in memory
+// and in the JSON file at path, so that they survive restarts of the process.
+// The resources already recorded in the file are loaded.
+func NewFileStorage(path string) (PersistenceLayer, error) {
+	fs := &fileStore{inMemoryStore: inMemoryStore{resources: map[string]common.Resource{}}, path: path}
+	raw, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return fs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var resources []common.Resource
+	if err := json.Unmarshal(raw, &resources); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	for _, r := range resources {
+		fs.resources[r.Name] = r
+	}
+	return fs, nil
+}
+
+func (fs *fileStore) Add(r common.Resource) error {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+	if _, ok := fs.resources[r.Name]; ok {
+		return fmt.Errorf("resource %s already exists", r.Name)
+	}
+	fs.resources[r.Name] = r
+	return fs.save()
+}
+
+func (fs *fileStore) Delete(name string) error {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+	if _, ok := fs.resources[name]; !ok {
+		return fmt.Errorf("cannot find item %s", name)
+	}
+	delete(fs.resources, name)
+	return fs.save()
+}
+
+func (fs *fileStore) Update(r common.Resource) (common.Resource, error) {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+	if _, ok := fs.resources[r.Name]; !ok {
+		return common.Resource{}, fmt.Errorf("cannot find item %s", r.Name)
+	}
+	fs.resources[r.Name] = r
+	return r, fs.save()
+}
+
+// save writes the resources to the file atomically, so a process killed
+// while saving never leaves a partial file behind. The lock must be held.
+func (fs *fileStore) save() error {
+	resources := make([]common.Resource, 0, len(fs.resources))
+	for _, r := range fs.resources {
+		resources = append(resources, r)
+	}
+	sort.Stable(common.ResourceByName(resources))
+	raw, err := json.MarshalIndent(resources, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := fs.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, raw, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, fs.path)
+}
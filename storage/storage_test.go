@@ -20,6 +20,7 @@ package storage_test
 
 import (
 	"fmt"
+	"path/filepath"
 	"reflect"
 	"sort"
 	"testing"
@@ -28,15 +29,19 @@ import (
 	"sigs.k8s.io/boskos/storage"
 )
 
-func createStorages() []storage.PersistenceLayer {
-
+func createStorages(t *testing.T) []storage.PersistenceLayer {
+	fileStorage, err := storage.NewFileStorage(filepath.Join(t.TempDir(), "leases.json"))
+	if err != nil {
+		t.Fatalf("unable to create file storage, %v", err)
+	}
 	return []storage.PersistenceLayer{
 		storage.NewMemoryStorage(),
+		fileStorage,
 	}
 }
 
 func TestAddDelete(t *testing.T) {
-	for _, s := range createStorages() {
+	for _, s := range createStorages(t) {
 		var resources []common.Resource
 		var err error
 		for i := 0; i < 10; i++ {
@@ -76,7 +81,7 @@ func TestAddDelete(t *testing.T) {
 }
 
 func TestUpdateGet(t *testing.T) {
-	for _, s := range createStorages() {
+	for _, s := range createStorages(t) {
 		oRes := common.Resource{
 			Name: "original",
 			Type: "type",
@@ -100,7 +105,7 @@ func TestUpdateGet(t *testing.T) {
 }
 
 func TestNegativeDeleteGet(t *testing.T) {
-	for _, s := range createStorages() {
+	for _, s := range createStorages(t) {
 		oRes := common.Resource{
 			Name: "original",
 			Type: "type",
@@ -120,3 +125,32 @@ func TestNegativeDeleteGet(t *testing.T) {
 		}
 	}
 }
+
+func TestFileStorageReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "leases.json")
+	s, err := storage.NewFileStorage(path)
+	if err != nil {
+		t.Fatalf("unable to create file storage, %v", err)
+	}
+	for _, name := range []string{"res-1", "res-2"} {
+		if err := s.Add(common.Resource{Name: name, Type: "type", State: common.Busy}); err != nil {
+			t.Errorf("unable to add %s, %v", name, err)
+		}
+	}
+	if err := s.Delete("res-1"); err != nil {
+		t.Errorf("unable to delete res-1, %v", err)
+	}
+
+	reloaded, err := storage.NewFileStorage(path)
+	if err != nil {
+		t.Fatalf("unable to reload file storage, %v", err)
+	}
+	resources, err := reloaded.List()
+	if err != nil {
+		t.Errorf("unable to list resources, %v", err)
+	}
+	expected := []common.Resource{{Name: "res-2", Type: "type", State: common.Busy}}
+	if !reflect.DeepEqual(expected, resources) {
+		t.Errorf("expected the resources (%v) to survive the reload, got %v", expected, resources)
+	}
+}
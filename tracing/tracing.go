@@ -0,0 +1,151 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package tracing sets up the OpenTelemetry tracing of boskos and holds the
+// helpers instrumenting its API, ranch and storage.
+package tracing
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/test-infra/prow/simplifypath"
+)
+
+// TracerName is the name of the tracer creating the spans of boskos.
+const TracerName = "sigs.k8s.io/boskos"
+
+// Options are flag options used to configure the export of the traces to an
+// OpenTelemetry collector.
+// It implements the k8s.io/test-infra/pkg/flagutil.OptionGroup interface.
+type Options struct {
+	endpoint    string
+	insecure    bool
+	sampleRatio float64
+}
+
+// AddFlags adds tracing flags to existing FlagSet.
+func (o *Options) AddFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.endpoint, "otlp-endpoint", "", "If set, host:port of the OTLP/HTTP collector the traces are exported to. Tracing is disabled otherwise.")
+	fs.BoolVar(&o.insecure, "otlp-insecure", false, "Export the traces over plain HTTP instead of HTTPS.")
+	fs.Float64Var(&o.sampleRatio, "otlp-sample-ratio", 1, "Ratio of the traces started by boskos that are sampled. Traces started by clients follow their sampling decision.")
+}
+
+// Validate validates tracing options.
+func (o *Options) Validate(_ bool) error {
+	if o.sampleRatio < 0 || o.sampleRatio > 1 {
+		return fmt.Errorf("--otlp-sample-ratio must be within 0 and 1, got %v", o.sampleRatio)
+	}
+	return nil
+}
+
+// Setup installs the global tracer provider exporting the spans to the
+// collector, and the propagation of the trace context of the clients. The
+// returned function flushes the spans not exported yet and must be called
+// before exiting. Setup does nothing if no collector is configured, in which
+// case the spans are not recorded.
+func (o *Options) Setup(ctx context.Context) (func(context.Context) error, error) {
+	if o.endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	clientOptions := []otlptracehttp.Option{otlptracehttp.WithEndpoint(o.endpoint)}
+	if o.insecure {
+		clientOptions = append(clientOptions, otlptracehttp.WithInsecure())
+	}
+	exporter, err := otlptracehttp.New(ctx, clientOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the OTLP exporter: %w", err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", "boskos"))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(o.sampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return provider.Shutdown, nil
+}
+
+// Start starts a span named name as a child of the span of ctx, if any.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return otel.Tracer(TracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End ends span, marking it as failed with err if set.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Middleware starts a server span for every request, named after its method
+// and its path simplified by simplifier so that requests to the same
+// endpoint are grouped together. The span continues the trace of the client
+// if its headers carry one.
+func Middleware(simplifier simplifypath.Simplifier) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			ctx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+			ctx, span := otel.Tracer(TracerName).Start(ctx, req.Method+" "+simplifier.Simplify(req.URL.Path),
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					attribute.String("http.method", req.Method),
+					attribute.String("http.target", req.URL.Path),
+				))
+			defer span.End()
+
+			recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(recorder, req.WithContext(ctx))
+			span.SetAttributes(attribute.Int("http.status_code", recorder.status))
+			if recorder.status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(recorder.status))
+			}
+		})
+	}
+}
+
+// statusRecorder records the status code of the response written through it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+// Flush keeps streaming responses like the ones of /watch working.
+func (s *statusRecorder) Flush() {
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
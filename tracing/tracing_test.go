@@ -0,0 +1,68 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"k8s.io/test-infra/prow/simplifypath"
+)
+
+func TestMiddleware(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	var childSampled bool
+	handler := Middleware(simplifypath.NewSimplifier(simplifypath.L("", simplifypath.L("acquire"))))(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, span := Start(req.Context(), "ranch.acquire")
+		childSampled = span.SpanContext().IsSampled()
+		End(span, nil)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/acquire?type=t", nil))
+
+	spans := recorder.Ended()
+	if len(spans) != 2 || !childSampled {
+		t.Fatalf("expected a server span with a child span, got %d spans", len(spans))
+	}
+	server := spans[1]
+	if server.Name() != "POST /acquire" {
+		t.Errorf("expected the span to be named after the endpoint, got %q", server.Name())
+	}
+	if spans[0].Parent().SpanID() != server.SpanContext().SpanID() {
+		t.Errorf("expected the span of the handler to be a child of the server span")
+	}
+	if server.Status().Code != codes.Error {
+		t.Errorf("expected the server error to mark the span as failed")
+	}
+	var status attribute.Value
+	for _, attr := range server.Attributes() {
+		if attr.Key == "http.status_code" {
+			status = attr.Value
+		}
+	}
+	if status.AsInt64() != http.StatusInternalServerError {
+		t.Errorf("expected the status code to be recorded, got %v", status.Emit())
+	}
+}